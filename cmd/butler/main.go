@@ -13,34 +13,56 @@ governing permissions and limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/adobe/butler/internal/config"
 	"github.com/adobe/butler/internal/environment"
-	"github.com/adobe/butler/internal/methods"
+	"github.com/adobe/butler/internal/logging"
+	"github.com/adobe/butler/internal/metrics"
 	"github.com/adobe/butler/internal/monitor"
+	"github.com/adobe/butler/internal/selfupdate"
+	"github.com/adobe/butler/internal/service"
+	"github.com/adobe/butler/internal/tracing"
+	"github.com/adobe/butler/pkg/butler"
+	"github.com/adobe/butler/pkg/config"
 
-	"github.com/jasonlvhit/gocron"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	defaultButlerConfigInterval = 300
-	defaultHTTPRetryWaitMin     = 5
-	defaultHTTPRetryWaitMax     = 15
-	defaultHTTPRetries          = 5
-	defaultHTTPTimeout          = 10
+	defaultShutdownTimeout      = 30
+	defaultAdminURL             = "http://localhost:8081"
+)
+
+// The exit codes of -once.
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitDownload   = 2
+	exitValidation = 3
+	exitReload     = 4
 )
 
 var (
 	version        string
+	commit         = "unknown"
+	buildDate      = "unknown"
 	ConfigCache    map[string][]byte
 	AllConfigFiles []string
 	MustacheSubs   map[string]string
@@ -67,37 +89,479 @@ func SetLogLevel(l string) log.Level {
 	}
 }
 
+// butlerOpts are the flags which say where the butler configuration is, and
+// how to retrieve it. They are shared by the daemon and the subcommands which
+// retrieve the butler configuration themselves.
+type butlerOpts struct {
+	path               *string
+	defaults           *string
+	strict             *bool
+	methodOptions      *string
+	pluginsDir         *string
+	logLevel           *string
+	logFormat          *string
+	insecureSkipVerify *bool
+	etcdEndpoints      *string
+	blobAccountKey     *string
+	blobAccountName    *string
+	httpTimeout        *string
+	httpRetries        *string
+	httpRetryWaitMin   *string
+	httpRetryWaitMax   *string
+	httpAuthToken      *string
+	httpAuthType       *string
+	httpAuthUser       *string
+	s3Region           *string
+	s3AccessKeyID      *string
+	s3SecretAccessKey  *string
+	s3SessionToken     *string
+	dnsServers         *string
+	dnsTimeout         *string
+}
+
+func newButlerOpts(fs *flag.FlagSet, logLevel string) *butlerOpts {
+	return &butlerOpts{
+		path:               fs.String("config.path", "", "Full remote path to butler configuration file (eg: full URL scheme://path)."),
+		defaults:           fs.String("config.defaults", "", "Path to a local butler configuration file of defaults, which the butler configuration overlays."),
+		strict:             fs.Bool("config.strict", false, "Reject unknown keys, missing required keys and values of the wrong type in the butler configuration, instead of ignoring them."),
+		methodOptions:      fs.String("config.method-options", "", "Path to a local file of the options of the method of the -config.path, in the form of the options of the method of a repo, eg: an [s3] table. Used instead of the http.*, s3.*, blob.* and etcd.* options."),
+		pluginsDir:         fs.String("plugins.dir", "", "The directory of the method and reloader plugins, named butler-method-<method> and butler-reloader-<method>."),
+		logLevel:           fs.String("log.level", logLevel, "The butler log level. Log levels are: debug, info, warn, error, fatal, panic."),
+		logFormat:          fs.String("log.format", logging.FormatText, "The butler log format, text or json. Overridden by globals.log-format of the butler configuration."),
+		insecureSkipVerify: fs.Bool("tls.insecure-skip-verify", false, "Disable SSL verification for etcd and https."),
+		etcdEndpoints:      fs.String("etcd.endpoints", "", "The endpoints to connect to etcd."),
+		blobAccountKey:     fs.String("blob.account-key", "", "The Azure Blob storage account key (Should probably use the environment variable ACCOUNT_KEY)."),
+		blobAccountName:    fs.String("blob.account-name", "", "The Azure Blob storage account name (Should probably use the environment variable ACCOUNT_NAME)."),
+		httpTimeout:        fs.String("http.timeout", fmt.Sprintf("%v", butler.DefaultHTTPTimeout), "The http timeout, in seconds, for GET requests to obtain the butler configuration file."),
+		httpRetries:        fs.String("http.retries", fmt.Sprintf("%v", butler.DefaultHTTPRetries), "The number of http retries for GET requests to obtain the butler configuration files"),
+		httpRetryWaitMin:   fs.String("http.retry_wait_min", fmt.Sprintf("%v", butler.DefaultHTTPRetryWaitMin), "The minimum amount of time to wait before attemping to retry the http config get operation."),
+		httpRetryWaitMax:   fs.String("http.retry_wait_max", fmt.Sprintf("%v", butler.DefaultHTTPRetryWaitMax), "The maximum amount of time to wait before attemping to retry the http config get operation."),
+		httpAuthToken:      fs.String("http.auth_token", "", "HTTP auth token to use for HTTP authentication."),
+		httpAuthType:       fs.String("http.auth_type", "", "HTTP auth type (eg: basic / digest / token-key) to use. If empty (by default) do not use HTTP authentication."),
+		httpAuthUser:       fs.String("http.auth_user", "", "HTTP auth user to use for HTTP authentication"),
+		s3Region:           fs.String("s3.region", "", "The S3 Region that the config file resides."),
+		s3AccessKeyID:      fs.String("s3.access-key-id", "", "The AWS Access Key ID (Should probably use environment variable AWS_ACCESS_KEY_ID)."),
+		s3SecretAccessKey:  fs.String("s3.secret-access-key", "", "The AWS Secret Access Key (Should probably use environment variable AWS_SECRET_ACCESS_KEY)."),
+		s3SessionToken:     fs.String("s3.session-token", "", "(Optional) The AWS Session Token (Should probably use environment variable AWS_SESSION_TOKEN)."),
+		dnsServers:         fs.String("dns.servers", "", "The dns servers, eg: 10.0.0.2,[fd00::2]:5353, which resolve the host names butler connects to instead of the servers of /etc/resolv.conf. Each query goes to the next server."),
+		dnsTimeout:         fs.String("dns.timeout", fmt.Sprintf("%v", int(butler.DefaultDNSTimeout/time.Second)), "The timeout, in seconds, of each query to the -dns.servers."),
+	}
+}
+
+// setLogLevel sets up the logging at the -log.level, in the -log.format.
+func (o *butlerOpts) setLogLevel() {
+	if err := logging.Init(strings.ToLower(environment.GetVar(*o.logFormat)), SetLogLevel(environment.GetVar(*o.logLevel))); err != nil {
+		log.Fatalf("Cannot properly parse -log.format. err=%v", err.Error())
+	}
+}
+
+// options returns the butler.Options of the flags.
+func (o *butlerOpts) options() (butler.Options, error) {
+	if *o.path == "" {
+		return butler.Options{}, errors.New("You must provide a -config.path for a path to the butler configuration.")
+	}
+	opts := butler.Options{
+		ConfigURL:          environment.GetVar(*o.path),
+		Defaults:           environment.GetVar(*o.defaults),
+		Strict:             *o.strict,
+		MethodOptions:      environment.GetVar(*o.methodOptions),
+		InsecureSkipVerify: *o.insecureSkipVerify,
+		LogLevel:           SetLogLevel(environment.GetVar(*o.logLevel)),
+		PluginsDir:         environment.GetVar(*o.pluginsDir),
+		HTTPAuthType:       environment.GetVar(*o.httpAuthType),
+		HTTPAuthUser:       environment.GetVar(*o.httpAuthUser),
+		HTTPAuthToken:      environment.GetVar(*o.httpAuthToken),
+		S3Region:           environment.GetVar(*o.s3Region),
+		S3AccessKeyID:      environment.GetVar(*o.s3AccessKeyID),
+		S3SecretAccessKey:  environment.GetVar(*o.s3SecretAccessKey),
+		S3SessionToken:     environment.GetVar(*o.s3SessionToken),
+		BlobAccountName:    environment.GetVar(*o.blobAccountName),
+		BlobAccountKey:     environment.GetVar(*o.blobAccountKey),
+	}
+	if u, err := url.Parse(opts.ConfigURL); err != nil || u.Scheme == "" {
+		return opts, fmt.Errorf("Cannot properly parse -config.path. -config.path must be in URL form. -config.path=%v", opts.ConfigURL)
+	}
+	opts.HTTPTimeout, _ = strconv.Atoi(environment.GetVar(*o.httpTimeout))
+	opts.HTTPRetries, _ = strconv.Atoi(environment.GetVar(*o.httpRetries))
+	opts.HTTPRetryWaitMin, _ = strconv.Atoi(environment.GetVar(*o.httpRetryWaitMin))
+	opts.HTTPRetryWaitMax, _ = strconv.Atoi(environment.GetVar(*o.httpRetryWaitMax))
+	if endpoints := environment.GetVar(*o.etcdEndpoints); endpoints != "" {
+		opts.EtcdEndpoints = strings.Split(endpoints, ",")
+	}
+	if servers := environment.GetVar(*o.dnsServers); servers != "" {
+		opts.DNSServers = strings.Split(servers, ",")
+		timeout, err := strconv.Atoi(environment.GetVar(*o.dnsTimeout))
+		if err != nil || timeout <= 0 {
+			return opts, fmt.Errorf("Cannot properly parse -dns.timeout. -dns.timeout=%v", environment.GetVar(*o.dnsTimeout))
+		}
+		opts.DNSTimeout = time.Duration(timeout) * time.Second
+	}
+	return opts, nil
+}
+
+// butlerConfig returns the initialized ButlerConfig which retrieves the
+// butler configuration from the -config.path.
+func (o *butlerOpts) butlerConfig() (*config.ButlerConfig, error) {
+	opts, err := o.options()
+	if err != nil {
+		return nil, err
+	}
+	b, err := butler.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.Config(), nil
+}
+
+// adminOpts are the flags which the subcommands use to reach the admin
+// endpoint of a running butler.
+type adminOpts struct {
+	url                *string
+	timeout            *int
+	insecureSkipVerify *bool
+}
+
+func newAdminOpts(fs *flag.FlagSet, timeout int) *adminOpts {
+	return &adminOpts{
+		url:                fs.String("admin.url", defaultAdminURL, "The URL of the running butler admin endpoint."),
+		timeout:            fs.Int("timeout", timeout, "The timeout, in seconds, to wait for the operation to complete."),
+		insecureSkipVerify: fs.Bool("tls.insecure-skip-verify", false, "Disable SSL verification for the admin endpoint."),
+	}
+}
+
+// post sends a POST to the path of the admin endpoint, and prints the
+// response.
+func (a *adminOpts) post(op string, path string, query url.Values) error {
+	u, err := url.Parse(strings.TrimRight(environment.GetVar(*a.url), "/") + path)
+	if err != nil {
+		return err
+	}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+
+	client := &http.Client{
+		Timeout:   time.Duration(*a.timeout) * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *a.insecureSkipVerify}},
+	}
+	resp, err := client.Post(u.String(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v failed. code=%d", op, resp.StatusCode)
+	}
+	return nil
+}
+
+// runRollback implements the "butler rollback" subcommand. It asks a running
+// butler, through its admin endpoint, to force a manager back to a retained
+// snapshot and reload it.
+func runRollback(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("rollback", flag.ContinueOnError)
+		admin    = newAdminOpts(fs, 60)
+		manager  = fs.String("manager", "", "The manager to roll back.")
+		snapshot = fs.String("snapshot", "", "The snapshot id (or unique prefix) to roll back to. Defaults to the latest snapshot.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manager == "" {
+		return errors.New("you must provide a -manager to roll back")
+	}
+
+	query := url.Values{}
+	if *snapshot != "" {
+		query.Set("snapshot", *snapshot)
+	}
+	return admin.post("rollback", "/v1/rollback/"+url.PathEscape(*manager), query)
+}
+
+// runPause implements the "butler pause" subcommand. It asks a running butler,
+// through its admin endpoint, to stop managing the files of a manager until
+// it is resumed.
+func runPause(args []string) error {
+	var (
+		fs      = flag.NewFlagSet("pause", flag.ContinueOnError)
+		admin   = newAdminOpts(fs, 10)
+		manager = fs.String("manager", "", "The manager to pause.")
+		reason  = fs.String("reason", "", "Why the manager is paused, eg: an incident ticket.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manager == "" {
+		return errors.New("you must provide a -manager to pause")
+	}
+
+	query := url.Values{}
+	if *reason != "" {
+		query.Set("reason", *reason)
+	}
+	return admin.post("pause", "/v1/pause/"+url.PathEscape(*manager), query)
+}
+
+// runResume implements the "butler resume" subcommand. It asks a running
+// butler, through its admin endpoint, to manage the files of a paused manager
+// again.
+func runResume(args []string) error {
+	var (
+		fs      = flag.NewFlagSet("resume", flag.ContinueOnError)
+		admin   = newAdminOpts(fs, 10)
+		manager = fs.String("manager", "", "The manager to resume.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manager == "" {
+		return errors.New("you must provide a -manager to resume")
+	}
+	return admin.post("resume", "/v1/resume/"+url.PathEscape(*manager), nil)
+}
+
+// runNow implements the "butler run" subcommand. It asks a running butler,
+// through its admin endpoint, to run the configuration management of one or
+// all managers right away.
+func runNow(args []string) error {
+	var (
+		fs      = flag.NewFlagSet("run", flag.ContinueOnError)
+		admin   = newAdminOpts(fs, 300)
+		manager = fs.String("manager", "", "The manager to run. Defaults to all managers.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := "/v1/run"
+	if *manager != "" {
+		path += "/" + url.PathEscape(*manager)
+	}
+	return admin.post("run", path, nil)
+}
+
+// runValidate implements the "butler validate" subcommand. It checks butler
+// configuration files offline, the same way butler checks a retrieved butler
+// configuration, eg: in CI before they are deployed.
+func runValidate(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("validate", flag.ContinueOnError)
+		logLevel = fs.String("log.level", "error", "The butler log level. Log levels are: debug, info, warn, error, fatal, panic.")
+		defaults = fs.String("config.defaults", "", "Path to a local butler configuration file of defaults, which the files overlay.")
+		strict   = fs.Bool("config.strict", false, "Reject unknown keys, missing required keys and values of the wrong type, instead of ignoring them.")
+		plugins  = fs.String("plugins.dir", "", "The directory of the method and reloader plugins which the files use.")
+		failed   int
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	log.SetLevel(SetLogLevel(*logLevel))
+	if fs.NArg() == 0 {
+		return errors.New("you must provide the butler configuration files to validate")
+	}
+	if err := butler.LoadPlugins(*plugins); err != nil {
+		return err
+	}
+
+	for _, f := range fs.Args() {
+		data, err := ioutil.ReadFile(f)
+		if err == nil {
+			err = config.CheckConfig(f, data, *defaults, *strict)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", f, err.Error())
+			failed++
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s: ok\n", f)
+	}
+	if failed > 0 {
+		return &config.RunError{Stage: config.StageValidation, Err: fmt.Errorf("%d of %d files are not valid", failed, fs.NArg())}
+	}
+	return nil
+}
+
+// runConfigSchema implements the "butler config-schema" subcommand. It prints
+// the JSON Schema of the butler configuration, eg: for CI pipelines to lint
+// butler configurations before they are deployed.
+func runConfigSchema(args []string) error {
+	var (
+		fs      = flag.NewFlagSet("config-schema", flag.ContinueOnError)
+		plugins = fs.String("plugins.dir", "", "The directory of the method and reloader plugins, whose methods the schema allows.")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := butler.LoadPlugins(*plugins); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config.ConfigSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+	return nil
+}
+
+// runFetch implements the "butler fetch" subcommand. It retrieves the butler
+// configuration, and copies the configuration files of every manager into
+// place, without reloading the managers.
+func runFetch(args []string) error {
+	var (
+		fs   = flag.NewFlagSet("fetch", flag.ContinueOnError)
+		opts = newButlerOpts(fs, "info")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts.setLogLevel()
+
+	bc, err := opts.butlerConfig()
+	if err != nil {
+		return err
+	}
+	return bc.Fetch()
+}
+
+// runDiff implements the "butler diff" subcommand. It retrieves the butler
+// configuration, and the configuration files of every manager, and prints the
+// changes which the next run would make, without changing anything.
+func runDiff(args []string) error {
+	var (
+		fs   = flag.NewFlagSet("diff", flag.ContinueOnError)
+		opts = newButlerOpts(fs, "warn")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts.setLogLevel()
+
+	bc, err := opts.butlerConfig()
+	if err != nil {
+		return err
+	}
+	diffs, err := bc.PendingChanges()
+	for _, d := range diffs {
+		fmt.Fprintf(os.Stdout, "# manager %s: %s\n%s", d.Manager, d.File, d.Diff)
+	}
+	return err
+}
+
+// runVersion implements the "butler version" subcommand.
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, versionInfo())
+	return nil
+}
+
+// versionInfo returns the version of butler along with its build metadata.
+func versionInfo() string {
+	return fmt.Sprintf("butler %s\n  commit: %s\n  built: %s\n  go: %s\n  platform: %s/%s\n", version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// exitCode returns the exit code for the error of -once or of a subcommand.
+// The latest stage at which any manager failed decides the exit code.
+func exitCode(err error) int {
+	var stage config.RunStage
+	switch e := err.(type) {
+	case nil:
+		return exitOK
+	case *config.RunError:
+		stage = e.Stage
+	case config.RunErrors:
+		stage = e.Stage()
+	}
+	switch stage {
+	case config.StageDownload:
+		return exitDownload
+	case config.StageValidation:
+		return exitValidation
+	case config.StageReload:
+		return exitReload
+	}
+	return exitError
+}
+
+// handleSignals calls run for each signal received on signals, one run at a
+// time, until signals is closed. Since signal.Notify drops the signals which
+// do not fit in the channel, the signals received during a run make a single
+// run once it is done, instead of queueing up one run each.
+func handleSignals(signals <-chan os.Signal, run func(os.Signal)) {
+	for sig := range signals {
+		run(sig)
+	}
+}
+
 func main() {
+	// butler subcommands either talk to an already running butler, or do a
+	// single operation and exit, and are handled before the daemon flags are
+	// parsed
+	subcommands := map[string]func([]string) error{
+		"rollback":      runRollback,
+		"pause":         runPause,
+		"resume":        runResume,
+		"run":           runNow,
+		"validate":      runValidate,
+		"config-schema": runConfigSchema,
+		"fetch":         runFetch,
+		"diff":          runDiff,
+		"version":       runVersion,
+	}
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			err := run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "butler %s: %s\n", os.Args[1], err.Error())
+			}
+			os.Exit(exitCode(err))
+		}
+	}
+
 	var (
-		butlerTest                  = flag.Bool("test", false, "Are we testing butler? (probably not!)")
-		configEtcdEndpoints         = flag.String("etcd.endpoints", "", "The endpoints to connect to etcd.")
-		configBlobAccountKey        = flag.String("blob.account-key", "", "The Azure Blob storage account key (Should probably use the environment variable ACCOUNT_KEY).")
-		configBlobAccountName       = flag.String("blob.account-name", "", "The Azure Blob storage account name (Should probably use the environment variable ACCOUNT_NAME).")
-		configHTTPTimeout           = flag.String("http.timeout", fmt.Sprintf("%v", defaultHTTPTimeout), "The http timeout, in seconds, for GET requests to obtain the butler configuration file.")
-		configHTTPRetries           = flag.String("http.retries", fmt.Sprintf("%v", defaultHTTPRetries), "The number of http retries for GET requests to obtain the butler configuration files")
-		configHTTPRetryWaitMin      = flag.String("http.retry_wait_min", fmt.Sprintf("%v", defaultHTTPRetryWaitMin), "The minimum amount of time to wait before attemping to retry the http config get operation.")
-		configHTTPRetryWaitMax      = flag.String("http.retry_wait_max", fmt.Sprintf("%v", defaultHTTPRetryWaitMax), "The maximum amount of time to wait before attemping to retry the http config get operation.")
-		configHTTPAuthToken         = flag.String("http.auth_token", "", "HTTP auth token to use for HTTP authentication.")
-		configHTTPAuthType          = flag.String("http.auth_type", "", "HTTP auth type (eg: basic / digest / token-key) to use. If empty (by default) do not use HTTP authentication.")
-		configHTTPAuthUser          = flag.String("http.auth_user", "", "HTTP auth user to use for HTTP authentication")
-		configInterval              = flag.String("config.retrieve-interval", fmt.Sprintf("%v", defaultButlerConfigInterval), "The interval, in seconds, to retrieve new butler configuration files.")
-		configLogLevel              = flag.String("log.level", "info", "The butler log level. Log levels are: debug, info, warn, error, fatal, panic.")
-		configPath                  = flag.String("config.path", "", "Full remote path to butler configuration file (eg: full URL scheme://path).")
-		configS3Region              = flag.String("s3.region", "", "The S3 Region that the config file resides.")
-		configS3AccessKeyID         = flag.String("s3.access-key-id", "", "The AWS Access Key ID (Should probably use environment variable AWS_ACCESS_KEY_ID).")
-		configS3SecretAccessKey     = flag.String("s3.secret-access-key", "", "The AWS Secret Access Key (Should probably use environment variable AWS_SECRET_ACCESS_KEY).")
-		configS3SessionToken        = flag.String("s3.session-token", "", "(Optional) The AWS Session Token (Should probably use environment variable AWS_SESSION_TOKEN).")
-		configTLSInsecureSkipVerify = flag.Bool("tls.insecure-skip-verify", false, "Disable SSL verification for etcd and https.")
-		err                         error
-		versionFlag                 = flag.Bool("version", false, "Print version information.")
+		adminListen    = flag.String("admin.listen-address", "127.0.0.1:8081", "The address on which to serve the admin endpoints (/v1/status, /v1/run, ...), which are never served on the monitor globals.http-port. An address without a host, eg: :8081, listens on 127.0.0.1.")
+		butlerTest     = flag.Bool("test", false, "Are we testing butler? (probably not!)")
+		butlerOnce     = flag.Bool("once", false, "Retrieve the butler configuration, run the configuration management of every manager once, and exit. Exits 2 on a download failure, 3 on a validation failure and 4 on a reload failure.")
+		butlerOpts     = newButlerOpts(flag.CommandLine, "info")
+		otlpEndpoint   = flag.String("otlp.endpoint", "", "The base URL of the OTLP/HTTP receiver of an OpenTelemetry collector, eg: http://otel-collector:4318, to export the spans of the butler runs to. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.")
+		otlpHeaders    = flag.String("otlp.headers", "", "The headers, eg: key1=value1,key2=value2, to send to the OpenTelemetry collector. Defaults to the OTEL_EXPORTER_OTLP_HEADERS environment variable.")
+		pushURL        = flag.String("pushgateway.url", "", "The base URL, eg: http://pushgateway:9091, of a Prometheus Pushgateway to push the butler metrics to at the end of a -once run.")
+		pushJob        = flag.String("pushgateway.job", metrics.DefaultPushgatewayJob, "The job label of the butler metrics pushed to -pushgateway.url.")
+		pushInstance   = flag.String("pushgateway.instance", "", "The instance label of the butler metrics pushed to -pushgateway.url. Defaults to the hostname.")
+		pushGrouping   = flag.String("pushgateway.grouping", "", "The other labels, eg: env=prod,region=us-east-1, of the grouping key of the butler metrics pushed to -pushgateway.url.")
+		statsdAddress  = flag.String("statsd.address", "", "The address, eg: localhost:8125, of a statsd server to push the butler metrics to, in addition to serving them on /metrics.")
+		statsdFormat   = flag.String("statsd.format", metrics.FormatStatsd, "The format of the metrics pushed to -statsd.address: statsd, which appends the label values to the metric names, or dogstatsd, which sends the labels as tags.")
+		statsdPrefix   = flag.String("statsd.prefix", "", "The prefix, eg: butler., of the metric names pushed to -statsd.address.")
+		statsdTags     = flag.String("statsd.tags", "", "The tags, eg: env:prod,region:us-east-1, to add to every metric pushed to -statsd.address. Only sent in the dogstatsd format.")
+		statsdInterval = flag.String("statsd.interval", fmt.Sprintf("%v", int(metrics.DefaultStatsdInterval/time.Second)), "The interval, in seconds, to push the metrics to -statsd.address.")
+		configInterval = flag.String("config.retrieve-interval", fmt.Sprintf("%v", defaultButlerConfigInterval), "The interval, in seconds, to retrieve new butler configuration files.")
+		configSplay    = flag.String("config.retrieve-splay", "0", "The maximum random delay, in seconds, added to every retrieval of the butler configuration files.")
+		configCron     = flag.String("config.retrieve-cron", "", "A cron expression, with optional seconds and CRON_TZ, of when to retrieve new butler configuration files. Overrides -config.retrieve-interval.")
+		configBoot     = flag.String("config.bootstrap-path", "", "The path of a local copy of the last butler configuration which was parsed, which butler starts up on when it cannot retrieve the butler configuration. Disabled when empty.")
+		configWatch    = flag.Bool("config.watch", true, "Watch a file:// butler configuration, and read it as soon as it changes, in addition to retrieving it on schedule.")
+		err            error
+		updateURL      = flag.String("selfupdate.manifest-url", "", "The http(s) URL of a signed release manifest, which butler checks every -selfupdate.interval, to update itself to a newer release, and restart on it. Disabled when empty.")
+		updateSigURL   = flag.String("selfupdate.signature-url", "", "The URL of the signature of the release manifest. Defaults to the -selfupdate.manifest-url with a .sig suffix.")
+		updateKey      = flag.String("selfupdate.public-key", "", "The path of the PEM encoded ECDSA P-256 public key which the release manifest is signed with.")
+		updateInterval = flag.String("selfupdate.interval", fmt.Sprintf("%v", int(selfupdate.DefaultInterval/time.Second)), "The interval, in seconds, to check the release manifest.")
+		serviceName    = flag.String("service.name", "butler", "The name of the windows service butler runs as, when it is started by the service control manager.")
+		serviceWatch   = flag.String("service.watchdog-timeout", "0", "The time, in seconds, after which butler exits once it is no longer alive, when it runs as a windows service, so that the recovery actions of the service restart it. Under systemd, the WatchdogSec= of the unit applies instead. Disabled when 0.")
+		shutdownWait   = flag.String("shutdown.timeout", fmt.Sprintf("%v", defaultShutdownTimeout), "The maximum amount of time, in seconds, to wait on SIGINT or SIGTERM for the runs in flight to finish, and the queued events to be sent, before exiting.")
+		versionFlag    = flag.Bool("version", false, "Print version information.")
 	)
 	flag.Parse()
-	newConfigLogLevel := environment.GetVar(*configLogLevel)
-	log.SetLevel(SetLogLevel(newConfigLogLevel))
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	butlerOpts.setLogLevel()
 
 	if *versionFlag {
-		fmt.Fprintf(os.Stdout, "butler %s\n", version)
+		fmt.Fprint(os.Stdout, versionInfo())
 		os.Exit(0)
 	}
 
@@ -108,194 +572,205 @@ func main() {
 		butlerTesting = true
 	}
 
-	if *configPath == "" {
-		log.Fatal("You must provide a -config.path for a path to the butler configuration.")
-	}
-
 	log.Infof("Starting Butler CMS version %s", version)
 
-	newURL, err := url.Parse(environment.GetVar(*configPath))
-	if err != nil || newURL.Scheme == "" {
-		log.Fatalf("Cannot properly parse -config.path. -config.path must be in URL form. -config.path=%v", environment.GetVar(*configPath))
+	opts, err := butlerOpts.options()
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
-	opts := &config.ButlerConfigOpts{
-		InsecureSkipVerify: *configTLSInsecureSkipVerify,
-		LogLevel:           SetLogLevel(newConfigLogLevel),
-		URL:                newURL,
-	}
-	bc, err := config.NewButlerConfig(opts)
-	if err != nil {
-		log.Fatalf("Unsupported butler scheme. scheme=%v", bc.Scheme())
+	// Set the butler configuration retrieval interval
+	newConfigInterval, _ := strconv.Atoi(environment.GetVar(*configInterval))
+	if newConfigInterval == 0 {
+		newConfigInterval = defaultButlerConfigInterval
 	}
+	log.Debugf("main(): setting ConfigInterval to %d", newConfigInterval)
+	opts.Interval = time.Duration(newConfigInterval) * time.Second
+	opts.Cron = environment.GetVar(*configCron)
+	opts.Watch = *configWatch
+	opts.Bootstrap = environment.GetVar(*configBoot)
 
-	switch bc.Scheme() {
-	case "http", "https":
-		opts := methods.HTTPMethodOpts{Scheme: bc.Scheme()}
-		newConfigHTTPAuthType := strings.ToLower(environment.GetVar(*configHTTPAuthType))
-		if newConfigHTTPAuthType != "" {
-			if environment.GetVar(*configHTTPAuthUser) != "" && environment.GetVar(*configHTTPAuthToken) != "" {
-			} else {
-				log.Fatalf("HTTP Authentication enabled, but insufficient authentication details provided.")
-			}
-			switch newConfigHTTPAuthType {
-			case "basic", "digest", "token-key":
-				opts.HTTPAuthType = newConfigHTTPAuthType
-				opts.HTTPAuthToken = *configHTTPAuthToken
-				opts.HTTPAuthUser = *configHTTPAuthUser
-				break
-			default:
-				log.Fatalf("Unsupported HTTP Authentication Type: %s", newConfigHTTPAuthType)
-			}
-		}
-		// Set the HTTP Timeout
-		newConfigHTTPTimeout, _ := strconv.Atoi(environment.GetVar(*configHTTPTimeout))
-		if newConfigHTTPTimeout == 0 {
-			newConfigHTTPTimeout = defaultHTTPTimeout
+	newConfigSplay, err := strconv.Atoi(environment.GetVar(*configSplay))
+	if err != nil || newConfigSplay < 0 {
+		log.Fatalf("Cannot properly parse -config.retrieve-splay. -config.retrieve-splay=%v", environment.GetVar(*configSplay))
+	}
+	opts.Splay = time.Duration(newConfigSplay) * time.Second
+	shutdownTimeout, err := strconv.Atoi(environment.GetVar(*shutdownWait))
+	if err != nil || shutdownTimeout < 0 {
+		log.Fatalf("Cannot properly parse -shutdown.timeout. -shutdown.timeout=%v", environment.GetVar(*shutdownWait))
+	}
+	opts.ShutdownTimeout = time.Duration(shutdownTimeout) * time.Second
+	opts.OTLPEndpoint = environment.GetVar(*otlpEndpoint)
+	if headers := environment.GetVar(*otlpHeaders); headers != "" {
+		opts.OTLPHeaders, err = tracing.ParseHeaders(headers)
+		if err != nil {
+			log.Fatalf("Cannot properly parse -otlp.headers. err=%v", err.Error())
 		}
-		log.Debugf("main(): setting HttpTimeout to %d", newConfigHTTPTimeout)
-		opts.Timeout = newConfigHTTPTimeout
+	}
 
-		// Set the HTTP Retries Counter
-		newConfigHTTPRetries, _ := strconv.Atoi(environment.GetVar(*configHTTPRetries))
-		if newConfigHTTPRetries == 0 {
-			newConfigHTTPRetries = defaultHTTPRetries
-		}
-		log.Debugf("main(): setting HttpRetries to %d", newConfigHTTPRetries)
-		opts.Retries = newConfigHTTPRetries
+	b, err := butler.New(opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	bc := b.Config()
 
-		// Set the HTTP Holdoff Values
-		newConfigHTTPRetryWaitMin, _ := strconv.Atoi(environment.GetVar(*configHTTPRetryWaitMin))
-		if newConfigHTTPRetryWaitMin == 0 {
-			newConfigHTTPRetryWaitMin = defaultHTTPRetryWaitMin
+	// Push the metrics to statsd, for the environments which are not
+	// scraped by Prometheus
+	var statsd *metrics.StatsdSink
+	if address := environment.GetVar(*statsdAddress); address != "" {
+		interval, err := strconv.Atoi(environment.GetVar(*statsdInterval))
+		if err != nil || interval <= 0 {
+			log.Fatalf("Cannot properly parse -statsd.interval. -statsd.interval=%v", environment.GetVar(*statsdInterval))
 		}
-		newConfigHTTPRetryWaitMax, _ := strconv.Atoi(environment.GetVar(*configHTTPRetryWaitMax))
-		if newConfigHTTPRetryWaitMax == 0 {
-			newConfigHTTPRetryWaitMax = defaultHTTPRetryWaitMax
-		}
-		log.Debugf("main(): setting RetryWaitMin[%d] and RetryWaitMax[%d]", newConfigHTTPRetryWaitMin, newConfigHTTPRetryWaitMax)
-		opts.RetryWaitMin = newConfigHTTPRetryWaitMin
-		opts.RetryWaitMax = newConfigHTTPRetryWaitMax
-		bc.SetMethodOpts(opts)
-	case "s3":
-		opts := methods.S3MethodOpts{Scheme: bc.Scheme()}
-		if *configS3Region == "" {
-			log.Fatalf("You must provide a -s3.region for use with the s3 downloader.")
+		statsd, err = metrics.NewStatsdSink(metrics.StatsdOpts{
+			Address:  address,
+			Format:   environment.GetVar(*statsdFormat),
+			Prefix:   environment.GetVar(*statsdPrefix),
+			Tags:     metrics.ParseStatsdTags(environment.GetVar(*statsdTags)),
+			Interval: time.Duration(interval) * time.Second,
+		})
+		if err != nil {
+			log.Fatal(err.Error())
 		}
-		accessKeyID := environment.GetVar(*configS3AccessKeyID)
-		if accessKeyID == "" {
-			opts.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
-		} else {
-			opts.AccessKeyID = accessKeyID
+		statsd.Start()
+	}
+	stopStatsd := func() {
+		if statsd == nil {
+			return
 		}
-
-		secretAccessKey := environment.GetVar(*configS3SecretAccessKey)
-		if secretAccessKey == "" {
-			opts.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
-		} else {
-			opts.SecretAccessKey = secretAccessKey
+		if err := statsd.Stop(); err != nil {
+			log.Warnf("main(): could not push the metrics to statsd. err=%s", err.Error())
 		}
+	}
 
-		sessionToken := environment.GetVar(*configS3SessionToken)
-		if sessionToken == "" {
-			opts.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
-		} else {
-			opts.SessionToken = sessionToken
-		}
-		newConfigS3Region := environment.GetVar(*configS3Region)
-		log.Debugf("main(): setting s3 region=%v", newConfigS3Region)
-		opts.Region = newConfigS3Region
-		log.Debugf("main(): setting s3 bucket=%v", bc.Host())
-		opts.Bucket = bc.Host()
-		bc.SetMethodOpts(opts)
-	case "blob":
-		opts := methods.BlobMethodOpts{Scheme: bc.Scheme()}
-		accountKey := environment.GetVar(*configBlobAccountKey)
-		if accountKey == "" {
-			opts.AccountKey = os.Getenv("ACCOUNT_KEY")
-		} else {
-			opts.AccountKey = accountKey
-		}
-		accountName := environment.GetVar(*configBlobAccountName)
-		if accountName == "" {
-			opts.AccountName = bc.Host()
+	if *butlerOnce {
+		err = b.RunOnce()
+		if err != nil {
+			log.Errorf("main(): run failed. err=%s", err.Error())
 		} else {
-			opts.AccountName = accountName
+			log.Infof("main(): run succeeded.")
 		}
-		bc.SetMethodOpts(opts)
-	case "etcd":
-		u := bc.URL()
-		newU := fmt.Sprintf("%v://%v/%v%v", u.Scheme, u.Host, u.Host, u.Path)
-		rewriteURL, _ := url.Parse(newU)
-		bc.SetURL(rewriteURL)
-		opts := methods.EtcdMethodOpts{Scheme: bc.Scheme()}
-		if *configEtcdEndpoints == "" {
-			log.Fatalf("You must provide a valid -etcd.endpoints for use with the etcd downloader.")
+		if u := environment.GetVar(*pushURL); u != "" {
+			grouping, perr := metrics.ParsePushgatewayGrouping(environment.GetVar(*pushGrouping))
+			if perr == nil {
+				grouping["instance"] = environment.GetVar(*pushInstance)
+				if grouping["instance"] == "" {
+					grouping["instance"], _ = os.Hostname()
+				}
+				perr = metrics.PushToGateway(metrics.PushgatewayOpts{URL: u, Job: environment.GetVar(*pushJob), Grouping: grouping})
+			}
+			if perr != nil {
+				log.Errorf("main(): could not push the metrics to the pushgateway. err=%s", perr.Error())
+			}
 		}
-		newConfigEtcdEndpoints := environment.GetVar(*configEtcdEndpoints)
-		log.Debugf("main(): setting etcd endpoints=%v", newConfigEtcdEndpoints)
-		opts.Endpoints = strings.Split(newConfigEtcdEndpoints, ",")
-		bc.SetMethodOpts(opts)
-	case "file":
-		opts := methods.FileMethodOpts{Scheme: bc.Scheme()}
-		bc.SetMethodOpts(opts)
-	default:
-		opts := methods.GenericMethodOpts{Scheme: bc.Scheme()}
-		bc.SetMethodOpts(opts)
-	}
-
-	// Set the butler configuration retrieval interval
-	newConfigInterval, _ := strconv.Atoi(environment.GetVar(*configInterval))
-	if newConfigInterval == 0 {
-		newConfigInterval = defaultButlerConfigInterval
+		stopStatsd()
+		os.Exit(exitCode(err))
 	}
-	log.Debugf("main(): setting ConfigInterval to %d", newConfigInterval)
 
-	bc.SetInterval(newConfigInterval)
+	// SIGINT and SIGTERM let the runs in flight finish, for up to
+	// -shutdown.timeout, before butler exits
+	ctx, cancel := context.WithCancel(context.Background())
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-term
+		log.Infof("main(): received %v, waiting for the runs in flight to finish", sig)
+		cancel()
+	}()
 
-	if err = bc.Init(); err != nil {
-		log.Fatalf("Cannot initialize butler config. err=%s", err.Error())
+	// Report the start up of butler, and whether it is still alive, to
+	// systemd, or to the windows service control manager
+	watchdog, err := strconv.Atoi(environment.GetVar(*serviceWatch))
+	if err != nil || watchdog < 0 {
+		log.Fatalf("Cannot properly parse -service.watchdog-timeout. -service.watchdog-timeout=%v", environment.GetVar(*serviceWatch))
 	}
+	svc, err := service.New(environment.GetVar(*serviceName), cancel, time.Duration(watchdog)*time.Second)
+	if err != nil {
+		log.Fatalf("Cannot report to the service manager. err=%v", err.Error())
+	}
+	go svc.Run(ctx, bc.Ready, bc.Alive)
 
-	// Do initial grab of butler configuration file.
-	// Going to do this in an endless loop until we initially
-	// grab a configuration file.
-	for {
-		log.Infof("main(): Loading initial butler configuration.")
-		log.Debugf("main(): running first bc.Handler()")
-		err = bc.Handler()
-
+	// Update butler from the signed release manifest, and restart on the
+	// new release once the runs in flight are done
+	var updater *selfupdate.Updater
+	restart := make(chan string, 1)
+	if u := environment.GetVar(*updateURL); u != "" {
+		interval, err := strconv.Atoi(environment.GetVar(*updateInterval))
+		if err != nil || interval <= 0 {
+			log.Fatalf("Cannot properly parse -selfupdate.interval. -selfupdate.interval=%v", environment.GetVar(*updateInterval))
+		}
+		updater, err = selfupdate.New(selfupdate.Opts{
+			ManifestURL:  u,
+			SignatureURL: environment.GetVar(*updateSigURL),
+			PublicKey:    environment.GetVar(*updateKey),
+			Version:      version,
+			Interval:     time.Duration(interval) * time.Second,
+		})
 		if err != nil {
-			if butlerTesting {
-				log.Fatalf("Cannot retrieve butler configuration. err=%s butlerTesting=%#v", err.Error(), butlerTesting)
-			}
-			log.Warnf("main(): Sleeping 5 seconds.")
-			time.Sleep(5 * time.Second)
-		} else {
-			log.Infof("main(): Loaded initial butler configuration.")
-			break
+			log.Fatalf("Cannot set up the self-update. err=%v", err.Error())
+		}
+		go updater.Run(ctx, func(v string) {
+			log.Infof("main(): updated to butler %v, restarting on it once the runs in flight are done", v)
+			restart <- v
+			cancel()
+		})
+	}
+
+	// Do initial grab of butler configuration file. Going to do this in an
+	// endless loop until we initially grab a configuration file, unless we
+	// are testing.
+	if butlerTesting {
+		if err = bc.Handler(); err != nil {
+			log.Fatalf("Cannot retrieve butler configuration. err=%s butlerTesting=%#v", err.Error(), butlerTesting)
 		}
+		bc.RunCMHandler()
+		os.Exit(0)
+	}
+	if err = b.Load(ctx); err != nil {
+		svc.Stopped(err)
+		log.Fatal(err.Error())
 	}
 
 	// Start up the monitor web server after we grab the monitor config values
-	monitor := monitor.NewMonitor().WithOpts(&monitor.Opts{Config: bc, Version: version})
+	monitor := monitor.NewMonitor().WithOpts(&monitor.Opts{Config: bc, Version: version, AdminAddr: environment.GetVar(*adminListen)})
 	monitor.Start()
 
-	sched := gocron.NewScheduler()
-	log.Debugf("main(): starting scheduler...")
-
-	log.Debugf("main(): running butler configuration scheduler every %d seconds", bc.GetInterval())
-	sched.Every(uint64(bc.GetInterval())).Seconds().Do(bc.Handler)
-
-	log.Debugf("main(): giving scheduler to butler.")
-	bc.SetScheduler(sched)
+	// SIGUSR1 runs the configuration management handler right away, where
+	// there is one
+	usr1 := make(chan os.Signal, 1)
+	if len(runSignals) > 0 {
+		signal.Notify(usr1, runSignals...)
+	}
+	go handleSignals(usr1, func(os.Signal) {
+		log.Infof("main(): received SIGUSR1, running butler configuration management handler")
+		bc.RunCMHandler()
+	})
 
-	log.Debugf("main(): doing initial run of butler configuration management handler")
-	bc.RunCMHandler()
+	// SIGHUP retrieves and reads the butler configuration right away
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go handleSignals(hup, func(os.Signal) {
+		log.Infof("main(): received SIGHUP, retrieving butler configuration")
+		bc.Handler()
+	})
 
-	if butlerTesting {
-		os.Exit(0)
-	} else {
-		<-sched.Start()
+	err = b.Run(ctx)
+	stopStatsd()
+	select {
+	case v := <-restart:
+		if err == nil {
+			err = svc.Restart(updater.Executable())
+			if err != nil {
+				log.Errorf("main(): could not restart on butler %v. err=%s", v, err.Error())
+			} else {
+				log.Infof("main(): handed off to butler %v.", v)
+			}
+		}
+	default:
+	}
+	svc.Stopped(err)
+	if err != nil {
+		log.Errorf("main(): %s", err.Error())
+		os.Exit(exitError)
 	}
 }
@@ -15,7 +15,18 @@ package main
 import (
 	. "gopkg.in/check.v1"
 
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/adobe/butler/pkg/config"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -50,3 +61,175 @@ func (s *ButlerTestSuite) TestSetLogLevel(c *C) {
 		c.Assert(logLevel, Equals, entry.level)
 	}
 }
+
+func (s *ButlerTestSuite) TestRunRollback(c *C) {
+	var path, query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprint(w, `{"manager":"prometheus","snapshot":"4d7c2a91f0b3","reloaded":true}`)
+	}))
+	defer ts.Close()
+
+	c.Assert(runRollback([]string{"-admin.url", ts.URL}), NotNil)
+	c.Assert(runRollback([]string{"-admin.url", ts.URL, "-manager", "prometheus", "-snapshot", "4d7c"}), IsNil)
+	c.Assert(path, Equals, "/v1/rollback/prometheus")
+	c.Assert(query, Equals, "snapshot=4d7c")
+}
+
+func (s *ButlerTestSuite) TestRunPauseResume(c *C) {
+	var path, query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		if r.URL.Path == "/v1/pause/unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"manager":"prometheus","paused":true}`)
+	}))
+	defer ts.Close()
+
+	c.Assert(runPause([]string{"-admin.url", ts.URL}), NotNil)
+	c.Assert(runPause([]string{"-admin.url", ts.URL, "-manager", "unknown"}), NotNil)
+	c.Assert(runPause([]string{"-admin.url", ts.URL, "-manager", "prometheus", "-reason", "INC-1234"}), IsNil)
+	c.Assert(path, Equals, "/v1/pause/prometheus")
+	c.Assert(query, Equals, "reason=INC-1234")
+
+	c.Assert(runResume([]string{"-admin.url", ts.URL}), NotNil)
+	c.Assert(runResume([]string{"-admin.url", ts.URL, "-manager", "prometheus"}), IsNil)
+	c.Assert(path, Equals, "/v1/resume/prometheus")
+}
+
+func (s *ButlerTestSuite) TestRunNow(c *C) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, `{"managers":["prometheus"]}`)
+	}))
+	defer ts.Close()
+
+	c.Assert(runNow([]string{"-admin.url", ts.URL}), IsNil)
+	c.Assert(path, Equals, "/v1/run")
+	c.Assert(runNow([]string{"-admin.url", ts.URL, "-manager", "prometheus"}), IsNil)
+	c.Assert(path, Equals, "/v1/run/prometheus")
+}
+
+var testValidConfig = `#butlerstart
+[globals]
+  config-managers = ["prometheus"]
+  [prometheus]
+    repos = ["localhost"]
+    dest-path = "/opt/prometheus"
+    primary-config-name = "prometheus.yml"
+    [prometheus.localhost]
+      method = "file"
+      repo-path = "/etc/butler/configs"
+      primary-config = ["prometheus.yml"]
+    [prometheus.reloader]
+      method = "http"
+      [prometheus.reloader.http]
+        host = "localhost"
+        port = "9090"
+        uri = "/-/reload"
+        method = "post"
+#butlerend
+`
+
+func (s *ButlerTestSuite) TestRunValidate(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bvalidate")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/valid.toml", []byte(testValidConfig), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/invalid.toml", []byte(strings.Replace(testValidConfig, `"prometheus"]`, `"missing"]`, 1)), 0644), IsNil)
+
+	c.Assert(runValidate(nil), NotNil)
+	c.Assert(runValidate([]string{dir + "/valid.toml"}), IsNil)
+	err = runValidate([]string{dir + "/valid.toml", dir + "/invalid.toml"})
+	c.Assert(err, NotNil)
+	c.Assert(exitCode(err), Equals, exitValidation)
+	c.Assert(exitCode(runValidate([]string{"/nonexistent/butler.toml"})), Equals, exitValidation)
+}
+
+func (s *ButlerTestSuite) TestVersionInfo(c *C) {
+	c.Assert(versionInfo(), Matches, "(?s)butler .*\n  commit: unknown\n  built: unknown\n  go: go.*\n  platform: .*/.*\n")
+}
+
+func (s *ButlerTestSuite) TestExitCode(c *C) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{errors.New("boom"), exitError},
+		{&config.RunError{Stage: config.StageDownload, Err: errors.New("boom")}, exitDownload},
+		{&config.RunError{Stage: config.StageValidation, Err: errors.New("boom")}, exitValidation},
+		{config.RunErrors{
+			{Manager: "a", Stage: config.StageDownload, Err: errors.New("boom")},
+			{Manager: "b", Stage: config.StageReload, Err: errors.New("boom")},
+			{Manager: "c", Stage: config.StageValidation, Err: errors.New("boom")},
+		}, exitReload},
+	}
+	for _, t := range tests {
+		c.Assert(exitCode(t.err), Equals, t.code, Commentf("err=%v", t.err))
+	}
+}
+
+// notify sends the signal the way signal.Notify does, which drops it when
+// the channel is full.
+func notify(signals chan os.Signal, sig os.Signal) {
+	select {
+	case signals <- sig:
+	default:
+	}
+}
+
+func (s *ButlerTestSuite) TestHandleSignals(c *C) {
+	var runs []os.Signal
+	hup := make(chan os.Signal, 1)
+	started := make(chan bool)
+	release := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		handleSignals(hup, func(sig os.Signal) {
+			runs = append(runs, sig)
+			started <- true
+			<-release
+		})
+		close(done)
+	}()
+	// idle is whether no run starts for a while
+	idle := func() bool {
+		select {
+		case <-started:
+			return false
+		case <-time.After(100 * time.Millisecond):
+			return true
+		}
+	}
+
+	// a SIGHUP is exactly one run
+	notify(hup, syscall.SIGHUP)
+	<-started
+	release <- true
+	c.Assert(idle(), Equals, true)
+
+	// the SIGHUPs received during a run do not start a run next to it, but
+	// a single one once it is done
+	notify(hup, syscall.SIGHUP)
+	<-started
+	notify(hup, syscall.SIGHUP)
+	notify(hup, syscall.SIGHUP)
+	notify(hup, syscall.SIGHUP)
+	c.Assert(idle(), Equals, true)
+	release <- true
+	<-started
+	release <- true
+	c.Assert(idle(), Equals, true)
+
+	close(hup)
+	<-done
+	c.Assert(runs, DeepEquals, []os.Signal{syscall.SIGHUP, syscall.SIGHUP, syscall.SIGHUP})
+}
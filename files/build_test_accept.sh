@@ -32,7 +32,7 @@ cd $BUTLER_GO_PATH
 mv /root/butler/vendor .
 
 ## make butler directories
-mkdir -p cmd/butler internal/monitor internal/metrics internal/config internal/alog internal/environment internal/methods internal/reloaders
+mkdir -p cmd/butler internal/monitor internal/metrics pkg/butler pkg/config internal/alog internal/plugins internal/environment pkg/methods pkg/reloaders
 
 ## move butler main
 mv /root/butler/cmd/butler/*.go cmd/butler
@@ -40,8 +40,11 @@ mv /root/butler/cmd/butler/*.go cmd/butler
 ## move metrics files
 mv /root/butler/internal/metrics/*.go internal/metrics
 
+## move butler package files
+mv /root/butler/pkg/butler/*.go pkg/butler
+
 ## move config files
-mv /root/butler/internal/config/*.go internal/config
+mv /root/butler/pkg/config/*.go pkg/config
 
 ## move environment files
 mv /root/butler/internal/environment/*.go internal/environment
@@ -49,18 +52,21 @@ mv /root/butler/internal/environment/*.go internal/environment
 ## move alog files
 mv /root/butler/internal/alog/*.go internal/alog
 
+## move plugins files
+mv /root/butler/internal/plugins/*.go internal/plugins
+
 ## move monitor files
 mv /root/butler/internal/monitor/*.go internal/monitor
 
-## move internal/methods files
-mv /root/butler/internal/methods/*.go internal/methods
+## move pkg/methods files
+mv /root/butler/pkg/methods/*.go pkg/methods
 
-## move internal/reloaders files
-mv /root/butler/internal/reloaders/*.go internal/reloaders
+## move pkg/reloaders files
+mv /root/butler/pkg/reloaders/*.go pkg/reloaders
 
 ## Let's build local go and perform some tests
 cd $BUTLER_GO_PATH
-go build -ldflags "-X main.version=$VERSION" -o /butler cmd/butler/main.go
+go build -ldflags "-X main.version=$VERSION" -o /butler ./cmd/butler
 
 BASE_SCRIPTS="/www/scripts/base.sh /www/scripts/s3.sh /www/scripts/azure.sh"
 for script in /www/scripts/base.sh /www/scripts/s3.sh /www/scripts/azure.sh
@@ -24,7 +24,7 @@ mv /root/butler/vendor .
 mv /root/butler/.git .
 
 ## make butler directories
-mkdir -p cmd/butler internal/monitor internal/metrics internal/config internal/alog internal/environment internal/methods internal/reloaders
+mkdir -p cmd/butler internal/monitor internal/metrics pkg/butler pkg/config internal/alog internal/plugins internal/environment pkg/methods pkg/reloaders internal/validators internal/diff internal/events internal/healthchecks internal/scheduler internal/tracing internal/logging internal/redact internal/leader internal/metadata internal/kubernetes internal/service internal/selfupdate pkg/destinations
 
 ## move butler main
 mv /root/butler/cmd/butler/*.go cmd/butler
@@ -32,8 +32,11 @@ mv /root/butler/cmd/butler/*.go cmd/butler
 ## move metrics files
 mv /root/butler/internal/metrics/*.go internal/metrics
 
+## move butler package files
+mv /root/butler/pkg/butler/*.go pkg/butler
+
 ## move config files
-mv /root/butler/internal/config/*.go internal/config
+mv /root/butler/pkg/config/*.go pkg/config
 
 ## move environment files
 mv /root/butler/internal/environment/*.go internal/environment
@@ -41,14 +44,52 @@ mv /root/butler/internal/environment/*.go internal/environment
 ## move alog files
 mv /root/butler/internal/alog/*.go internal/alog
 
+## move plugins files
+mv /root/butler/internal/plugins/*.go internal/plugins
+
 ## move monitor files
 mv /root/butler/internal/monitor/*.go internal/monitor
 
-## move internal/methods files
-mv /root/butler/internal/methods/*.go internal/methods
+## move pkg/methods files
+mv /root/butler/pkg/methods/*.go pkg/methods
+
+## move pkg/reloaders files
+mv /root/butler/pkg/reloaders/*.go pkg/reloaders
+
+## move internal/validators files
+mv /root/butler/internal/validators/*.go internal/validators
+## move internal/diff files
+mv /root/butler/internal/diff/*.go internal/diff
+## move internal/events files
+mv /root/butler/internal/events/*.go internal/events
+## move internal/healthchecks files
+mv /root/butler/internal/healthchecks/*.go internal/healthchecks
+## move internal/scheduler files
+mv /root/butler/internal/scheduler/*.go internal/scheduler
+## move internal/tracing files
+mv /root/butler/internal/tracing/*.go internal/tracing
+## move internal/logging files
+mv /root/butler/internal/logging/*.go internal/logging
+## move internal/redact files
+mv /root/butler/internal/redact/*.go internal/redact
+
+## move internal/leader files
+mv /root/butler/internal/leader/*.go internal/leader
+
+## move internal/metadata files
+mv /root/butler/internal/metadata/*.go internal/metadata
+
+## move internal/kubernetes files
+mv /root/butler/internal/kubernetes/*.go internal/kubernetes
+
+## move internal/service files
+mv /root/butler/internal/service/*.go internal/service
+
+## move internal/selfupdate files
+mv /root/butler/internal/selfupdate/*.go internal/selfupdate
 
-## move internal/reloaders files
-mv /root/butler/internal/reloaders/*.go internal/reloaders
+## move pkg/destinations files
+mv /root/butler/pkg/destinations/*.go pkg/destinations
 
 cd $BUTLER_GO_PATH/cmd/butler
 go test -check.vv -coverprofile=/tmp/coverage-main.out
@@ -58,7 +99,15 @@ if [ $ret -ne 0 ]; then
     exit $ret
 fi
 
-cd $BUTLER_GO_PATH/internal/config
+cd $BUTLER_GO_PATH/pkg/butler
+go test -check.vv -coverprofile=/tmp/coverage-butler.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/pkg/config
 go test -check.vv -coverprofile=/tmp/coverage-config.out
 ret=$?
 
@@ -66,7 +115,7 @@ if [ $ret -ne 0 ]; then
     exit $ret
 fi
 
-cd $BUTLER_GO_PATH/internal/methods
+cd $BUTLER_GO_PATH/pkg/methods
 go test -check.vv -coverprofile=/tmp/coverage-config-methods.out
 ret=$?
 
@@ -74,7 +123,7 @@ if [ $ret -ne 0 ]; then
     exit $ret
 fi
 
-cd $BUTLER_GO_PATH/internal/reloaders
+cd $BUTLER_GO_PATH/pkg/reloaders
 go test -check.vv -coverprofile=/tmp/coverage-config-reloaders.out
 ret=$?
 
@@ -82,6 +131,14 @@ if [ $ret -ne 0 ]; then
     exit $ret
 fi
 
+cd $BUTLER_GO_PATH/internal/validators
+go test -check.vv -coverprofile=/tmp/coverage-config-validators.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
 cd $BUTLER_GO_PATH/internal/monitor
 go test -check.vv -coverprofile=/tmp/coverage-monitor.out
 ret=$?
@@ -94,6 +151,102 @@ cd $BUTLER_GO_PATH/internal/metrics
 go test -check.vv -coverprofile=/tmp/coverage-metrics.out
 ret=$?
 
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/diff
+go test -check.vv -coverprofile=/tmp/coverage-diff.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/events
+go test -check.vv -coverprofile=/tmp/coverage-events.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/healthchecks
+go test -check.vv -coverprofile=/tmp/coverage-healthchecks.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/scheduler
+go test -check.vv -coverprofile=/tmp/coverage-scheduler.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/tracing
+go test -check.vv -coverprofile=/tmp/coverage-tracing.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/logging
+go test -check.vv -coverprofile=/tmp/coverage-logging.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/redact
+go test -check.vv -coverprofile=/tmp/coverage-redact.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+cd $BUTLER_GO_PATH/internal/leader
+go test -check.vv -coverprofile=/tmp/coverage-leader.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/internal/metadata
+go test -check.vv -coverprofile=/tmp/coverage-metadata.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/internal/kubernetes
+go test -check.vv -coverprofile=/tmp/coverage-kubernetes.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/internal/service
+go test -check.vv -coverprofile=/tmp/coverage-service.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/internal/selfupdate
+go test -check.vv -coverprofile=/tmp/coverage-selfupdate.out
+ret=$?
+
+if [ $ret -ne 0 ]; then
+    exit $ret
+fi
+
+cd $BUTLER_GO_PATH/pkg/destinations
+go test -check.vv -coverprofile=/tmp/coverage-destinations.out
+ret=$?
+
 if [ $ret -ne 0 ]; then
     exit $ret
 fi
@@ -118,6 +271,11 @@ if [ -f /tmp/coverage-config-reloaders.out ]; then
     echo
 fi
 
+if [ -f /tmp/coverage-config-validators.out ]; then
+    go tool cover -func /tmp/coverage-config-validators.out
+    echo
+fi
+
 if [ -f /tmp/coverage-metrics.out ]; then
     go tool cover -func /tmp/coverage-metrics.out
     echo
@@ -128,6 +286,71 @@ if [ -f /tmp/coverage-monitor.out ]; then
     echo
 fi
 
+if [ -f /tmp/coverage-diff.out ]; then
+    go tool cover -func /tmp/coverage-diff.out
+    echo
+fi
+
+if [ -f /tmp/coverage-events.out ]; then
+    go tool cover -func /tmp/coverage-events.out
+    echo
+fi
+
+if [ -f /tmp/coverage-healthchecks.out ]; then
+    go tool cover -func /tmp/coverage-healthchecks.out
+    echo
+fi
+
+if [ -f /tmp/coverage-tracing.out ]; then
+    go tool cover -func /tmp/coverage-tracing.out
+    echo
+fi
+
+if [ -f /tmp/coverage-logging.out ]; then
+    go tool cover -func /tmp/coverage-logging.out
+    echo
+fi
+
+if [ -f /tmp/coverage-redact.out ]; then
+    go tool cover -func /tmp/coverage-redact.out
+    echo
+fi
+
+if [ -f /tmp/coverage-leader.out ]; then
+    go tool cover -func /tmp/coverage-leader.out
+    echo
+fi
+
+if [ -f /tmp/coverage-metadata.out ]; then
+    go tool cover -func /tmp/coverage-metadata.out
+    echo
+fi
+
+if [ -f /tmp/coverage-kubernetes.out ]; then
+    go tool cover -func /tmp/coverage-kubernetes.out
+    echo
+fi
+
+if [ -f /tmp/coverage-service.out ]; then
+    go tool cover -func /tmp/coverage-service.out
+    echo
+fi
+
+if [ -f /tmp/coverage-selfupdate.out ]; then
+    go tool cover -func /tmp/coverage-selfupdate.out
+    echo
+fi
+
+if [ -f /tmp/coverage-destinations.out ]; then
+    go tool cover -func /tmp/coverage-destinations.out
+    echo
+fi
+
+if [ -f /tmp/coverage-scheduler.out ]; then
+    go tool cover -func /tmp/coverage-scheduler.out
+    echo
+fi
+
 if [ -f /tmp/coverage/coverage.txt ]; then
     cp /dev/null /tmp/coverage/coverage.txt
 else
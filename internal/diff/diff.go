@@ -0,0 +1,282 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package diff produces unified diffs of the files butler manages, and masks
+// secrets out of them before they are logged or exposed.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/adobe/butler/internal/redact"
+)
+
+const (
+	// DefaultContext is the number of unchanged lines shown around changes.
+	DefaultContext = 3
+
+	// maxEdits bounds the work done looking for the shortest edit script.
+	// Past it the differing region is shown as removed and added in full.
+	maxEdits = 1000
+
+	mask = redact.Mask
+)
+
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	op   op
+	line string
+}
+
+// Unified returns the unified diff between the a and b contents, labelled
+// with the from and to names, with context lines of unchanged lines around
+// each change. It returns an empty string when a and b are equal.
+func Unified(from string, to string, a []byte, b []byte, context int) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+
+	// aPos and bPos are the line offsets in a and b at each edit
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.op != opInsert {
+			aPos[i+1]++
+		}
+		if e.op != opDelete {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk for as long as the next change is close enough to
+		// share context with the previous one
+		end := i
+		for j := i; j < len(edits) && j <= end+2*context+1; j++ {
+			if edits[j].op != opEqual {
+				end = j
+			}
+		}
+		stop := end + context + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[stop]-aPos[start]), hunkRange(bPos[start], bPos[stop]-bPos[start]))
+		for _, e := range edits[start:stop] {
+			switch e.op {
+			case opEqual:
+				out.WriteString(" ")
+			case opDelete:
+				out.WriteString("-")
+			case opInsert:
+				out.WriteString("+")
+			}
+			out.WriteString(e.line)
+			out.WriteString("\n")
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+func hunkRange(start int, count int) string {
+	// an empty range refers to the line before it, as diff -u does
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines returns the edit script turning a into b, using the Myers
+// algorithm on the region between the common prefix and suffix.
+func diffLines(a []string, b []string) []edit {
+	var prefix, suffix []edit
+
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{opEqual, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]edit{{opEqual, a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	middle := myers(a, b)
+	if middle == nil {
+		for _, l := range a {
+			middle = append(middle, edit{opDelete, l})
+		}
+		for _, l := range b {
+			middle = append(middle, edit{opInsert, l})
+		}
+	}
+	return append(append(prefix, middle...), suffix...)
+}
+
+// myers returns the shortest edit script between a and b, or nil if it takes
+// more than maxEdits edits.
+func myers(a []string, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return []edit{}
+	}
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+
+	// v[k+offset] is the furthest x reached on diagonal k, and trace keeps
+	// the v of every round for the backtrack
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, a []string, b []string, offset int) []edit {
+	var res []edit
+
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+offset]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, edit{opEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				res = append(res, edit{opInsert, b[y-1]})
+			} else {
+				res = append(res, edit{opDelete, a[x-1]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// secretKeys matches "key: value" and "key = value" lines, in yaml, toml,
+// ini, json and the like, whose key looks like it holds a secret.
+var secretKeys = regexp.MustCompile(`(?i)^(\s*-?\s*["']?[\w.-]*(password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credentials?|authorization)[\w.-]*["']?\s*[:=]\s*)(\S.*)$`)
+
+// Masker masks secrets out of diffs.
+type Masker struct {
+	patterns []*regexp.Regexp
+}
+
+// NewMasker returns a Masker which masks the values of keys that look like
+// they hold a secret, as well as anything matching the extra patterns.
+func NewMasker(patterns []string) (*Masker, error) {
+	m := &Masker{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask pattern %v. err=%v", p, err.Error())
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+// Mask returns the unified diff with the secrets masked.
+func (m *Masker) Mask(diff string) string {
+	if diff == "" {
+		return diff
+	}
+	lines := strings.Split(diff, "\n")
+	for i, l := range lines {
+		if l == "" || strings.HasPrefix(l, "--- ") || strings.HasPrefix(l, "+++ ") || strings.HasPrefix(l, "@@ ") {
+			continue
+		}
+		lines[i] = l[:1] + m.MaskLine(l[1:])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MaskLine returns the line with the secrets masked, including those which
+// redact masks everywhere.
+func (m *Masker) MaskLine(line string) string {
+	line = secretKeys.ReplaceAllString(line, "${1}"+mask)
+	line = redact.String(line)
+	for _, re := range m.patterns {
+		line = re.ReplaceAllString(line, mask)
+	}
+	return line
+}
@@ -15,11 +15,55 @@ package environment
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
+
+	"github.com/adobe/butler/internal/metadata"
 
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	// metadataProvider looks up the meta: variables.
+	metadataProvider metadata.Provider
+	metadataMutex    sync.RWMutex
+
+	// metadataVar matches the ${meta:<key>} variables within a value.
+	metadataVar = regexp.MustCompile(`\$\{meta:([^}]+)\}`)
+)
+
+// SetMetadata sets the provider of the instance metadata the meta: variables
+// are looked up from, or unsets it when nil.
+func SetMetadata(p metadata.Provider) {
+	metadataMutex.Lock()
+	defer metadataMutex.Unlock()
+	metadataProvider = p
+}
+
+// getMetadata returns the instance metadata of the key, or an empty value
+// when it cannot be looked up.
+func getMetadata(key string) string {
+	metadataMutex.RLock()
+	p := metadataProvider
+	metadataMutex.RUnlock()
+	if p == nil {
+		log.Warnf("Instance metadata %s is used, but globals.instance-metadata is not set.", key)
+		return ""
+	}
+	v, err := p.Get(key)
+	if err != nil {
+		log.Warnf("Instance metadata %s does not exist. err=%v", key, err.Error())
+		return ""
+	}
+	return v
+}
+
+// GetVar returns the value of a configuration entry. A string entry which
+// starts with "env:" is the value of the environment variable, and one which
+// starts with "meta:" is the value of the instance metadata, see
+// SetMetadata. The ${meta:<key>} variables within any other string entry are
+// replaced by the values of the instance metadata.
 func GetVar(entry interface{}) string {
 	// if the length of the entry is less than what we're trying
 	// to check against, then this is probably not an environment
@@ -28,6 +72,9 @@ func GetVar(entry interface{}) string {
 	case int:
 		return fmt.Sprintf("%d", val)
 	case string:
+		if len(val) >= len("meta:") && strings.ToLower(val[:5]) == "meta:" {
+			return getMetadata(val[5:])
+		}
 		if len(val) < len("env:") {
 			return val
 		}
@@ -38,6 +85,10 @@ func GetVar(entry interface{}) string {
 				log.Warnf("Environment variable %s does not exist.", envKey)
 			}
 			return envVal
+		} else if strings.Contains(val, "${meta:") {
+			return metadataVar.ReplaceAllStringFunc(val, func(v string) string {
+				return getMetadata(metadataVar.FindStringSubmatch(v)[1])
+			})
 		} else {
 			return val
 		}
@@ -17,6 +17,8 @@ import (
 
 	"os"
 	"testing"
+
+	"github.com/adobe/butler/internal/metadata"
 )
 
 func Test(t *testing.T) { TestingT(t) }
@@ -56,3 +58,15 @@ func (s *ButlerTestSuite) TestGetVar(c *C) {
 	Test6 := GetVar(Foo{})
 	c.Assert(Test6, Equals, "")
 }
+
+func (s *ButlerTestSuite) TestGetVarMetadata(c *C) {
+	c.Assert(GetVar("meta:region"), Equals, "")
+	c.Assert(GetVar("/etc/${meta:region}/prometheus"), Equals, "/etc//prometheus")
+
+	SetMetadata(metadata.Placeholder{})
+	defer SetMetadata(nil)
+	c.Assert(GetVar("meta:region"), Equals, "region")
+	c.Assert(GetVar("META:tags.Team"), Equals, "tags.Team")
+	c.Assert(GetVar("/etc/${meta:region}/${meta:availability-zone}/prometheus"), Equals, "/etc/region/availability-zone/prometheus")
+	c.Assert(GetVar("${meta:region"), Equals, "${meta:region")
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// AuditRecord is a line of the audit log. Each record carries the hash of the
+// previous one, and its own hash covers its sequence number, the previous
+// hash and the event, so that any edit, removal or reordering of records
+// breaks the chain.
+type AuditRecord struct {
+	Seq   uint64          `json:"seq"`
+	Event json.RawMessage `json:"event"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash"`
+}
+
+func (r AuditRecord) sum() string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatUint(r.Seq, 10)))
+	h.Write([]byte("\n"))
+	h.Write([]byte(r.Prev))
+	h.Write([]byte("\n"))
+	h.Write(r.Event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditLog is an append only, hash chained, JSON lines file of events.
+type AuditLog struct {
+	Path  string
+	file  *os.File
+	seq   uint64
+	prev  string
+	mutex sync.Mutex
+}
+
+// NewAuditLog opens the audit log at path, creating it if need be, and picks
+// up the chain where the last record left it. The existing chain is not
+// verified, see VerifyAuditLog.
+func NewAuditLog(path string) (*AuditLog, error) {
+	a := &AuditLog{Path: path}
+
+	if f, err := os.Open(path); err == nil {
+		var last AuditRecord
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("could not parse audit log %v. err=%v", path, err.Error())
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		a.seq, a.prev = last.Seq, last.Hash
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a.file = f
+	return a, nil
+}
+
+func (a *AuditLog) Name() string {
+	return "audit-log"
+}
+
+// Send appends the event to the audit log, and syncs it to disk.
+func (a *AuditLog) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	r := AuditRecord{Seq: a.seq + 1, Event: data, Prev: a.prev}
+	r.Hash = r.sum()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	a.seq, a.prev = r.Seq, r.Hash
+	return nil
+}
+
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
+
+// VerifyAuditLog walks the hash chain of the audit log at path. It returns
+// the number of records verified, and an error describing the first record
+// which breaks the chain, if any.
+func VerifyAuditLog(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		count int
+		prev  string
+		seq   uint64
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return count, fmt.Errorf("could not parse record after seq %v. err=%v", seq, err.Error())
+		}
+		if r.Seq != seq+1 {
+			return count, fmt.Errorf("record seq %v follows seq %v", r.Seq, seq)
+		}
+		if r.Prev != prev {
+			return count, fmt.Errorf("record seq %v does not chain to the previous record", r.Seq)
+		}
+		if r.sum() != r.Hash {
+			return count, fmt.Errorf("record seq %v does not match its hash", r.Seq)
+		}
+		prev, seq = r.Hash, r.Seq
+		count++
+	}
+	return count, scanner.Err()
+}
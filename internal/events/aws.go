@@ -0,0 +1,393 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+)
+
+const (
+	snsAPIVersion = "2010-03-31"
+	sqsAPIVersion = "2012-11-05"
+
+	// snsMaxSubject is the longest subject SNS accepts.
+	snsMaxSubject = 100
+)
+
+// DefaultAWSEvents are the events published to SNS and SQS when the notifier
+// does not configure its own. The successful change and reload events carry
+// the config version, so that fleet tooling can tell which hosts converged on
+// which files.
+var DefaultAWSEvents = []string{TypeChange, TypeReload, TypeRestore, TypeRollback, "*:failure"}
+
+// AWSOpts are the region, credential and retry options shared by the
+// notifiers which publish to AWS. Like the S3 method, the credentials fall
+// back to the AWS_* environment variables. When none are found, the default
+// credential chain, eg: the instance role, is used. Endpoint overrides the
+// service endpoint, eg: for a local stack.
+type AWSOpts struct {
+	AccessKeyID     string `json:"access-key-id"`
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Retries         string `json:"retries"`
+	SecretAccessKey string `json:"secret-access-key"`
+	SessionToken    string `json:"session-token"`
+	Timeout         string `json:"timeout"`
+}
+
+// awsMessageAttribute is a string message attribute. The attributes let SNS
+// subscriptions filter the events, eg: on the manager or the type.
+type awsMessageAttribute struct {
+	_ struct{} `type:"structure"`
+
+	DataType    *string `type:"string" required:"true"`
+	StringValue *string `type:"string"`
+}
+
+type snsPublishInput struct {
+	_ struct{} `type:"structure"`
+
+	Message           *string                         `type:"string" required:"true"`
+	MessageAttributes map[string]*awsMessageAttribute `locationNameKey:"Name" locationNameValue:"Value" type:"map"`
+	Subject           *string                         `type:"string"`
+	TopicArn          *string                         `type:"string"`
+}
+
+type snsPublishOutput struct {
+	_ struct{} `type:"structure"`
+
+	MessageId *string `type:"string"`
+}
+
+type sqsSendMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	MessageAttributes      map[string]*awsMessageAttribute `locationName:"MessageAttribute" locationNameKey:"Name" locationNameValue:"Value" type:"map" flattened:"true"`
+	MessageBody            *string                         `type:"string" required:"true"`
+	MessageDeduplicationId *string                         `type:"string"`
+	MessageGroupId         *string                         `type:"string"`
+	QueueUrl               *string                         `type:"string" required:"true"`
+}
+
+type sqsSendMessageOutput struct {
+	_ struct{} `type:"structure"`
+
+	MessageId *string `type:"string"`
+}
+
+// newClient returns a client for the AWS query protocol service. SNS and SQS
+// only need a single call each, so butler talks to them through the query
+// protocol handlers rather than pulling in the full service packages.
+func (o *AWSOpts) newClient(service string, apiVersion string) (*client.Client, error) {
+	o.AccessKeyID = strings.TrimSpace(environment.GetVar(o.AccessKeyID))
+	if o.AccessKeyID == "" {
+		o.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	o.SecretAccessKey = strings.TrimSpace(environment.GetVar(o.SecretAccessKey))
+	if o.SecretAccessKey == "" {
+		o.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	o.SessionToken = strings.TrimSpace(environment.GetVar(o.SessionToken))
+	if o.SessionToken == "" {
+		o.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	o.Region = strings.TrimSpace(environment.GetVar(o.Region))
+	if o.Region == "" {
+		o.Region = os.Getenv("AWS_REGION")
+	}
+	if o.Region == "" {
+		return nil, errors.New("no region defined")
+	}
+	o.Endpoint = strings.TrimSpace(environment.GetVar(o.Endpoint))
+	if o.Endpoint != "" && !validHTTPURL(o.Endpoint) {
+		return nil, fmt.Errorf("invalid endpoint %v", o.Endpoint)
+	}
+
+	timeout, err := intOpt(o.Timeout, defaultNotifyTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout %v", o.Timeout)
+	}
+	retries, err := intOpt(o.Retries, defaultNotifyRetries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retries %v", o.Retries)
+	}
+
+	cfg := &aws.Config{
+		Region:     aws.String(o.Region),
+		HTTPClient: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		MaxRetries: aws.Int(retries),
+	}
+	if o.Endpoint != "" {
+		cfg.Endpoint = aws.String(o.Endpoint)
+	}
+	if o.AccessKeyID != "" || o.SecretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(o.AccessKeyID, o.SecretAccessKey, o.SessionToken)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := sess.ClientConfig(service)
+	signingName := c.SigningName
+	if signingName == "" {
+		signingName = service
+	}
+	svc := client.New(*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   service,
+			SigningName:   signingName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return svc, nil
+}
+
+// awsCall runs the query protocol action, retrying as the client is set up to.
+func awsCall(c *client.Client, action string, input interface{}, output interface{}) error {
+	req := c.NewRequest(&request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}, input, output)
+	return req.Send()
+}
+
+// awsMessageAttributes returns the attributes describing the event, leaving
+// out the empty ones, which AWS rejects.
+func awsMessageAttributes(e Event) map[string]*awsMessageAttribute {
+	res := make(map[string]*awsMessageAttribute)
+	for k, v := range map[string]string{
+		"type":    e.Type,
+		"manager": e.Manager,
+		"host":    e.Host,
+		"success": strconv.FormatBool(e.Success),
+		"version": e.Version,
+	} {
+		if v != "" {
+			res[k] = &awsMessageAttribute{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+	}
+	return res
+}
+
+// SNSNotifier publishes the events matching its filters, as JSON, to an SNS
+// topic.
+type SNSNotifier struct {
+	Opts   SNSNotifierOpts `json:"opts"`
+	client *client.Client
+	queue  *queue
+}
+
+type SNSNotifierOpts struct {
+	TopicArn string   `json:"topic-arn"`
+	Events   []string `json:"events"`
+	AWSOpts
+}
+
+func NewSNSNotifier(entry []byte) (Sink, error) {
+	var opts SNSNotifierOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	opts.TopicArn = strings.TrimSpace(environment.GetVar(opts.TopicArn))
+	arn := strings.Split(opts.TopicArn, ":")
+	if len(arn) != 6 || arn[0] != "arn" || arn[2] != "sns" {
+		return nil, fmt.Errorf("invalid sns topic-arn %v", opts.TopicArn)
+	}
+	// the topic arn holds the region, so it need not be configured twice
+	if strings.TrimSpace(environment.GetVar(opts.Region)) == "" {
+		opts.Region = arn[3]
+	}
+
+	if len(opts.Events) == 0 {
+		opts.Events = DefaultAWSEvents
+	}
+	if err := ValidateFilters(opts.Events); err != nil {
+		return nil, err
+	}
+
+	c, err := opts.newClient("sns", snsAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("sns notifier: %v", err.Error())
+	}
+
+	s := &SNSNotifier{Opts: opts, client: c}
+	s.queue = newQueue(s.Name(), DefaultQueueSize, s.publish)
+	return s, nil
+}
+
+// snsSubject returns the event summary as an SNS subject, which must be
+// printable ASCII on a single line, and at most 100 characters long.
+func snsSubject(e Event) string {
+	subject := []rune(Summary(e))
+	for i, r := range subject {
+		if r < ' ' || r > '~' {
+			subject[i] = ' '
+		}
+	}
+	if len(subject) > snsMaxSubject {
+		subject = append(subject[:snsMaxSubject-3], []rune("...")...)
+	}
+	return string(subject)
+}
+
+func (s *SNSNotifier) Name() string {
+	return "sns"
+}
+
+// Send queues the event for the topic if it matches the notifier events.
+func (s *SNSNotifier) Send(e Event) error {
+	if !MatchEvent(s.Opts.Events, e) {
+		return nil
+	}
+	return s.queue.push(e)
+}
+
+func (s *SNSNotifier) publish(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	input := &snsPublishInput{
+		Message:           aws.String(string(data)),
+		MessageAttributes: awsMessageAttributes(e),
+		Subject:           aws.String(snsSubject(e)),
+		TopicArn:          aws.String(s.Opts.TopicArn),
+	}
+	return awsCall(s.client, "Publish", input, &snsPublishOutput{})
+}
+
+func (s *SNSNotifier) Close() error {
+	s.queue.close()
+	return nil
+}
+
+func (s *SNSNotifier) wait() {
+	s.queue.wait()
+}
+
+// SQSNotifier sends the events matching its filters, as JSON, to an SQS
+// queue. For FIFO queues the events are grouped by the message-group-id,
+// which defaults to the host, and deduplicated on their content.
+type SQSNotifier struct {
+	Opts   SQSNotifierOpts `json:"opts"`
+	client *client.Client
+	queue  *queue
+}
+
+type SQSNotifierOpts struct {
+	QueueURL       string   `json:"queue-url"`
+	MessageGroupID string   `json:"message-group-id"`
+	Events         []string `json:"events"`
+	AWSOpts
+}
+
+func NewSQSNotifier(entry []byte) (Sink, error) {
+	var opts SQSNotifierOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	opts.QueueURL = strings.TrimSpace(environment.GetVar(opts.QueueURL))
+	if !validHTTPURL(opts.QueueURL) {
+		return nil, fmt.Errorf("invalid sqs queue-url %v", opts.QueueURL)
+	}
+	opts.MessageGroupID = strings.TrimSpace(environment.GetVar(opts.MessageGroupID))
+
+	if len(opts.Events) == 0 {
+		opts.Events = DefaultAWSEvents
+	}
+	if err := ValidateFilters(opts.Events); err != nil {
+		return nil, err
+	}
+
+	c, err := opts.newClient("sqs", sqsAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("sqs notifier: %v", err.Error())
+	}
+
+	s := &SQSNotifier{Opts: opts, client: c}
+	s.queue = newQueue(s.Name(), DefaultQueueSize, s.sendMessage)
+	return s, nil
+}
+
+func (s *SQSNotifier) Name() string {
+	return "sqs"
+}
+
+// Send queues the event for the queue if it matches the notifier events.
+func (s *SQSNotifier) Send(e Event) error {
+	if !MatchEvent(s.Opts.Events, e) {
+		return nil
+	}
+	return s.queue.push(e)
+}
+
+func (s *SQSNotifier) sendMessage(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	input := &sqsSendMessageInput{
+		MessageAttributes: awsMessageAttributes(e),
+		MessageBody:       aws.String(string(data)),
+		QueueUrl:          aws.String(s.Opts.QueueURL),
+	}
+	if strings.HasSuffix(s.Opts.QueueURL, ".fifo") {
+		group := s.Opts.MessageGroupID
+		if group == "" {
+			group = e.Host
+		}
+		sum := sha256.Sum256(data)
+		input.MessageGroupId = aws.String(group)
+		input.MessageDeduplicationId = aws.String(hex.EncodeToString(sum[:]))
+	}
+	return awsCall(s.client, "SendMessage", input, &sqsSendMessageOutput{})
+}
+
+func (s *SQSNotifier) Close() error {
+	s.queue.close()
+	return nil
+}
+
+func (s *SQSNotifier) wait() {
+	s.queue.wait()
+}
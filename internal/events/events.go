@@ -0,0 +1,220 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package events records what butler does to the hosts it manages, and
+// hands each event to the configured sinks, eg: the audit log.
+package events
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The types of event butler emits.
+const (
+	TypeChange     = "change"
+	TypeFetch      = "fetch"
+	TypeValidation = "validation"
+	TypeCopy       = "copy"
+	TypeDelete     = "delete"
+	TypeReload     = "reload"
+	TypeHealth     = "health"
+	TypeHook       = "hook"
+	TypeRestore    = "restore"
+	TypeRollback   = "rollback"
+	TypePause      = "pause"
+	TypeResume     = "resume"
+	TypeBreaker    = "breaker"
+	TypeStale      = "stale"
+)
+
+// DefaultActor is the actor of the events which butler emits on its own, as
+// opposed to those triggered through the admin endpoints.
+const DefaultActor = "butler"
+
+// Event is a single thing butler did, or failed to do, to a manager. Hash is
+// the hash of the diff for copy and delete events. Version is the content
+// address of the manager config files, set on change and reload events, so
+// that hosts which converged on the same files report the same version.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Host     string    `json:"host"`
+	Actor    string    `json:"actor"`
+	Manager  string    `json:"manager,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// Sink is the interface which all the event destinations must implement.
+type Sink interface {
+	Send(Event) error
+	Name() string
+	Close() error
+}
+
+var (
+	hostname  string
+	sinks     []Sink
+	notifiers []Sink
+	mutex     sync.Mutex
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+}
+
+// New returns a successful event of the type for the manager.
+func New(t string, manager string) Event {
+	return Event{Type: t, Manager: manager, Actor: DefaultActor, Success: true}
+}
+
+func (e Event) WithFile(f string) Event {
+	e.File = f
+	return e
+}
+
+func (e Event) WithSource(s string) Event {
+	e.Source = s
+	return e
+}
+
+func (e Event) WithHash(h string) Event {
+	e.Hash = h
+	return e
+}
+
+func (e Event) WithSnapshot(s string) Event {
+	e.Snapshot = s
+	return e
+}
+
+func (e Event) WithVersion(v string) Event {
+	e.Version = v
+	return e
+}
+
+func (e Event) WithMessage(m string) Event {
+	e.Message = m
+	return e
+}
+
+func (e Event) WithActor(a string) Event {
+	if a != "" {
+		e.Actor = a
+	}
+	return e
+}
+
+// WithError marks the event as failed if err is not nil.
+func (e Event) WithError(err error) Event {
+	if err != nil {
+		e.Success = false
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// SetSinks replaces the sinks events are emitted to, and closes the previous
+// ones.
+func SetSinks(s ...Sink) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	closeSinks(sinks)
+	sinks = s
+}
+
+// SetNotifiers replaces the notifiers events are emitted to, and closes the
+// previous ones. Notifiers are kept apart from the sinks since they are set
+// up again on every butler config change, while the sinks are not.
+func SetNotifiers(n ...Sink) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	closeSinks(notifiers)
+	notifiers = n
+}
+
+// waiter is implemented by the sinks which send their events in the
+// background, and lets Close wait for the events they still have queued.
+type waiter interface {
+	wait()
+}
+
+// Close closes the sinks and the notifiers, and waits up to timeout for the
+// events which are still queued to be sent. It returns an error when they
+// are not all sent in time.
+func Close(timeout time.Duration) error {
+	mutex.Lock()
+	closing := append(append([]Sink{}, sinks...), notifiers...)
+	closeSinks(closing)
+	sinks, notifiers = nil, nil
+	mutex.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		for _, s := range closing {
+			if w, ok := s.(waiter); ok {
+				w.wait()
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("events still queued after %v", timeout)
+	}
+}
+
+func closeSinks(s []Sink) {
+	for _, old := range s {
+		if err := old.Close(); err != nil {
+			log.Warnf("events.closeSinks(): could not close %v sink. err=%v", old.Name(), err.Error())
+		}
+	}
+}
+
+// Emit stamps the event and sends it to each of the sinks in turn. A failing
+// sink is logged, and does not keep the event from the others.
+func Emit(e Event) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(sinks) == 0 && len(notifiers) == 0 {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Host = hostname
+	for _, s := range append(append([]Sink{}, sinks...), notifiers...) {
+		if err := s.Send(e); err != nil {
+			log.Errorf("events.Emit(): could not send %v event for manager %v to %v sink. err=%v", e.Type, e.Manager, s.Name(), err.Error())
+			metrics.SetButlerEventVal(metrics.FAILURE, s.Name())
+			continue
+		}
+		metrics.SetButlerEventVal(metrics.SUCCESS, s.Name())
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&EventsTestSuite{})
+
+type EventsTestSuite struct {
+	Dir string
+}
+
+func (s *EventsTestSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bevents")
+	c.Assert(err, IsNil)
+	s.Dir = dir
+}
+
+func (s *EventsTestSuite) TearDownTest(c *C) {
+	SetSinks()
+	SetNotifiers()
+	os.RemoveAll(s.Dir)
+}
+
+type memorySink struct {
+	events []Event
+	err    error
+	closed bool
+}
+
+func (m *memorySink) Send(e Event) error {
+	m.events = append(m.events, e)
+	return m.err
+}
+
+func (m *memorySink) Name() string {
+	return "memory"
+}
+
+func (m *memorySink) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (s *EventsTestSuite) TestEmit(c *C) {
+	failing := &memorySink{err: errors.New("boom")}
+	sink := &memorySink{}
+	SetSinks(failing, sink)
+
+	Emit(New(TypeCopy, "testing").WithFile("foo.yml").WithHash("abc"))
+	Emit(New(TypeReload, "testing").WithError(errors.New("reload failed")).WithActor("api:127.0.0.1"))
+	c.Assert(sink.events, HasLen, 2)
+	c.Assert(sink.events[0].Success, Equals, true)
+	c.Assert(sink.events[0].Actor, Equals, DefaultActor)
+	c.Assert(sink.events[0].Time.IsZero(), Equals, false)
+	c.Assert(sink.events[1].Success, Equals, false)
+	c.Assert(sink.events[1].Error, Equals, "reload failed")
+	c.Assert(sink.events[1].Actor, Equals, "api:127.0.0.1")
+
+	SetSinks()
+	c.Assert(sink.closed, Equals, true)
+	Emit(New(TypeCopy, "testing"))
+	c.Assert(sink.events, HasLen, 2)
+}
+
+func (s *EventsTestSuite) TestAuditLog(c *C) {
+	path := s.Dir + "/audit.jsonl"
+	a, err := NewAuditLog(path)
+	c.Assert(err, IsNil)
+	c.Assert(a.Send(New(TypeFetch, "testing").WithSource("http://localhost/foo.yml")), IsNil)
+	c.Assert(a.Send(New(TypeCopy, "testing").WithFile("foo.yml")), IsNil)
+	c.Assert(a.Close(), IsNil)
+
+	// the chain carries on after a restart
+	a, err = NewAuditLog(path)
+	c.Assert(err, IsNil)
+	c.Assert(a.Send(New(TypeReload, "testing")), IsNil)
+	c.Assert(a.Close(), IsNil)
+
+	n, err := VerifyAuditLog(path)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var r AuditRecord
+	c.Assert(json.Unmarshal([]byte(lines[2]), &r), IsNil)
+	c.Assert(r.Seq, Equals, uint64(3))
+
+	// tampering with a record is detected
+	tampered := strings.Replace(string(data), `"file":"foo.yml"`, `"file":"bar.yml"`, 1)
+	c.Assert(ioutil.WriteFile(path, []byte(tampered), 0600), IsNil)
+	n, err = VerifyAuditLog(path)
+	c.Assert(err, ErrorMatches, "record seq 2 does not match its hash")
+	c.Assert(n, Equals, 1)
+
+	// and so is removing one
+	removed := strings.Join([]string{lines[0], lines[2]}, "\n")
+	c.Assert(ioutil.WriteFile(path, []byte(removed), 0600), IsNil)
+	_, err = VerifyAuditLog(path)
+	c.Assert(err, ErrorMatches, "record seq 3 follows seq 1")
+}
+
+func (s *EventsTestSuite) TestHTTPSink(c *C) {
+	var got Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer ts.Close()
+
+	c.Assert(NewHTTPSink(ts.URL+"/events", 0).Send(New(TypeRollback, "testing").WithSnapshot("abc")), IsNil)
+	c.Assert(got.Type, Equals, TypeRollback)
+	c.Assert(got.Snapshot, Equals, "abc")
+	c.Assert(NewHTTPSink(ts.URL+"/fail", 1).Send(New(TypeRollback, "testing")), NotNil)
+}
+
+func (s *EventsTestSuite) TestMatchEvent(c *C) {
+	failed := New(TypeReload, "testing").WithError(errors.New("boom"))
+	c.Assert(MatchEvent([]string{TypeReload}, failed), Equals, true)
+	c.Assert(MatchEvent([]string{"reload:failure"}, failed), Equals, true)
+	c.Assert(MatchEvent([]string{"reload:success"}, failed), Equals, false)
+	c.Assert(MatchEvent([]string{"*:failure"}, failed), Equals, true)
+	c.Assert(MatchEvent([]string{TypeCopy}, failed), Equals, false)
+	c.Assert(MatchEvent(DefaultNotifyEvents, New(TypeReload, "testing")), Equals, false)
+
+	c.Assert(ValidateFilters(DefaultNotifyEvents), IsNil)
+	c.Assert(ValidateFilters([]string{"reload:maybe"}), NotNil)
+}
+
+func (s *EventsTestSuite) TestNewNotifiers(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[globals]`))), IsNil)
+	res, err := NewNotifiers()
+	c.Assert(err, IsNil)
+	c.Assert(res, HasLen, 0)
+
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[notify]
+  method = "carrier-pigeon"
+`))), IsNil)
+	_, err = NewNotifiers()
+	c.Assert(err, ErrorMatches, "unknown notify method carrier-pigeon")
+
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[notify]
+  method = ["webhook"]
+  [notify.webhook]
+    urls = ["https://localhost/hooks/butler"]
+    events = ["reload:failure"]
+    retries = "5"
+`))), IsNil)
+	res, err = NewNotifiers()
+	c.Assert(err, IsNil)
+	c.Assert(res, HasLen, 1)
+	c.Assert(res[0].(*WebhookNotifier).Opts.Client.RetryMax, Equals, 5)
+	c.Assert(res[0].Close(), IsNil)
+
+	_, err = NewWebhookNotifier([]byte(`{"urls": ["ftp://localhost"]}`))
+	c.Assert(err, NotNil)
+	_, err = NewWebhookNotifier([]byte(`{"urls": []}`))
+	c.Assert(err, NotNil)
+	_, err = NewWebhookNotifier([]byte(`{"urls": ["http://localhost"], "retries": "many"}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *EventsTestSuite) TestWebhookNotifier(c *C) {
+	var (
+		got      []Event
+		attempts int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// fail the first attempt, so that the retry is exercised
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		got = append(got, e)
+	}))
+	defer ts.Close()
+
+	n, err := NewWebhookNotifier([]byte(`{"urls": ["` + ts.URL + `"], "retry-wait-min": "0", "retry-wait-max": "0"}`))
+	c.Assert(err, IsNil)
+	w := n.(*WebhookNotifier)
+	c.Assert(w.Send(New(TypeReload, "testing")), IsNil)
+	c.Assert(w.Send(New(TypeReload, "testing").WithError(errors.New("boom"))), IsNil)
+	c.Assert(w.Send(New(TypeRollback, "testing").WithSnapshot("abc")), IsNil)
+	c.Assert(w.Close(), IsNil)
+	w.queue.wait()
+
+	// the successful reload does not match the default events
+	c.Assert(got, HasLen, 2)
+	c.Assert(got[0].Type, Equals, TypeReload)
+	c.Assert(got[0].Error, Equals, "boom")
+	c.Assert(got[1].Snapshot, Equals, "abc")
+	c.Assert(attempts, Equals, 3)
+}
+
+func (s *EventsTestSuite) TestClose(c *C) {
+	var (
+		mutex sync.Mutex
+		got   int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		got++
+		mutex.Unlock()
+	}))
+	defer ts.Close()
+
+	// the events still queued are sent before Close returns
+	n, err := NewWebhookNotifier([]byte(`{"urls": ["` + ts.URL + `"], "retry-wait-min": "0", "retry-wait-max": "0"}`))
+	c.Assert(err, IsNil)
+	SetNotifiers(n)
+	Emit(New(TypeReload, "testing").WithError(errors.New("boom")))
+	Emit(New(TypeRollback, "testing"))
+	c.Assert(Close(5*time.Second), IsNil)
+	mutex.Lock()
+	c.Assert(got, Equals, 2)
+	mutex.Unlock()
+
+	// nothing is emitted once closed
+	Emit(New(TypeRollback, "testing"))
+
+	// but Close does not wait past the timeout
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+	n, err = NewWebhookNotifier([]byte(`{"urls": ["` + slow.URL + `"], "retry-wait-min": "0", "retry-wait-max": "0"}`))
+	c.Assert(err, IsNil)
+	SetNotifiers(n)
+	Emit(New(TypeRollback, "testing"))
+	c.Assert(Close(100*time.Millisecond), ErrorMatches, "events still queued after 100ms")
+}
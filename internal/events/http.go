@@ -0,0 +1,63 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultHTTPTimeout is the time, in seconds, the HTTP sink waits for the
+// remote endpoint.
+var DefaultHTTPTimeout = 10
+
+// HTTPSink POSTs each event, as JSON, to a remote endpoint. Any response
+// other than a 2xx is an error.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTPSink(url string, timeout int) *HTTPSink {
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &HTTPSink{URL: url, Client: &http.Client{Timeout: time.Duration(timeout) * time.Second}}
+}
+
+func (h *HTTPSink) Name() string {
+	return "http"
+}
+
+func (h *HTTPSink) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := h.Client.Post(h.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %v from %v", resp.Status, h.URL)
+	}
+	return nil
+}
+
+func (h *HTTPSink) Close() error {
+	return nil
+}
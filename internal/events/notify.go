@@ -0,0 +1,332 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// NotifyKey is the section of the butler config the notifiers are
+	// configured under.
+	NotifyKey = "notify"
+
+	// DefaultQueueSize is the number of events a notifier holds on to while
+	// it is busy sending.
+	DefaultQueueSize = 100
+)
+
+// DefaultNotifyEvents are the events notifiers are sent when they do not
+// configure their own.
+var DefaultNotifyEvents = []string{TypeChange, TypeValidation, TypeReload + ":failure", TypeHealth + ":failure", TypeRestore, TypeRollback, TypePause, TypeResume, TypeBreaker, TypeStale}
+
+// NewNotifiers returns the notifiers which have been configured in the
+// notify section. Like the validators, notifiers are optional, so when none
+// have been defined an empty slice and nil error are returned.
+func NewNotifiers() ([]Sink, error) {
+	var (
+		methods []string
+		result  map[string]interface{}
+		res     []Sink
+	)
+
+	if !viper.IsSet(NotifyKey) {
+		return res, nil
+	}
+
+	if err := viper.UnmarshalKey(NotifyKey, &result); err != nil {
+		return res, err
+	}
+
+	if result == nil || result["method"] == nil {
+		return res, errors.New("no notify method has been defined")
+	}
+
+	// method can either be a single string, or an array of methods
+	switch m := result["method"].(type) {
+	case string:
+		methods = append(methods, m)
+	case []interface{}:
+		for _, i := range m {
+			methods = append(methods, fmt.Sprintf("%v", i))
+		}
+	default:
+		return res, fmt.Errorf("unknown notify method type %T", m)
+	}
+
+	for _, method := range methods {
+		jsonRes, err := json.Marshal(result[method])
+		if err != nil {
+			return res, err
+		}
+
+		n, err := newNotifier(method, jsonRes)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func newNotifier(method string, entry []byte) (Sink, error) {
+	switch method {
+	case "webhook":
+		return NewWebhookNotifier(entry)
+	case "slack":
+		return NewSlackNotifier(entry)
+	case "pagerduty":
+		return NewPagerDutyNotifier(entry)
+	case "sns":
+		return NewSNSNotifier(entry)
+	case "sqs":
+		return NewSQSNotifier(entry)
+	default:
+		return nil, fmt.Errorf("unknown notify method %v", method)
+	}
+}
+
+// MatchEvent returns true if the event matches any of the filters. A filter
+// is an event type, eg: "reload", optionally followed by ":failure" or
+// ":success" to only match the failed or successful events of that type.
+// "*" matches every type.
+func MatchEvent(filters []string, e Event) bool {
+	for _, f := range filters {
+		parts := strings.SplitN(f, ":", 2)
+		if parts[0] != "*" && parts[0] != e.Type {
+			continue
+		}
+		if len(parts) == 1 {
+			return true
+		}
+		switch parts[1] {
+		case "failure":
+			if !e.Success {
+				return true
+			}
+		case "success":
+			if e.Success {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateFilters returns an error for the first filter which MatchEvent
+// does not understand.
+func ValidateFilters(filters []string) error {
+	for _, f := range filters {
+		parts := strings.SplitN(f, ":", 2)
+		if parts[0] == "" {
+			return fmt.Errorf("invalid event filter %q", f)
+		}
+		if len(parts) == 2 && parts[1] != "failure" && parts[1] != "success" {
+			return fmt.Errorf("invalid event filter %q", f)
+		}
+	}
+	return nil
+}
+
+// Route sends the events of the managers which match its filters somewhere
+// else than the notifier default, eg: to the owning team. An empty Managers
+// matches every manager. Only the destination fields which apply to the
+// notifier are used.
+type Route struct {
+	Managers   []string `json:"managers"`
+	Events     []string `json:"events"`
+	URL        string   `json:"url"`
+	Channel    string   `json:"channel"`
+	RoutingKey string   `json:"routing-key"`
+}
+
+// Match returns true if the route applies to the event.
+func (r Route) Match(e Event) bool {
+	if len(r.Managers) > 0 {
+		found := false
+		for _, m := range r.Managers {
+			if m == e.Manager {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return MatchEvent(r.Events, e)
+}
+
+// Routes is the per event routing of a notifier. The first route which
+// matches an event wins, and the default route is used for the events no
+// route matches.
+type Routes struct {
+	Default Route
+	Routes  []Route
+}
+
+// Find returns the route for the event, and false if the event is not to be
+// sent at all.
+func (r Routes) Find(e Event) (Route, bool) {
+	for _, route := range r.Routes {
+		if route.Match(e) {
+			return route, true
+		}
+	}
+	return r.Default, r.Default.Match(e)
+}
+
+// setupRoutes expands the environment in the routes, and checks their event
+// filters. Routes without events get the default events.
+func setupRoutes(routes []Route, events []string) error {
+	for i := range routes {
+		routes[i].URL = strings.TrimSpace(environment.GetVar(routes[i].URL))
+		routes[i].Channel = strings.TrimSpace(environment.GetVar(routes[i].Channel))
+		routes[i].RoutingKey = strings.TrimSpace(environment.GetVar(routes[i].RoutingKey))
+		if len(routes[i].Events) == 0 {
+			routes[i].Events = events
+		}
+		if err := ValidateFilters(routes[i].Events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RateLimiter allows up to Limit events per key within Period. A Limit of 0
+// allows everything.
+type RateLimiter struct {
+	Limit  int
+	Period time.Duration
+	sent   map[string][]time.Time
+	mutex  sync.Mutex
+}
+
+func NewRateLimiter(limit int, period time.Duration) *RateLimiter {
+	return &RateLimiter{Limit: limit, Period: period, sent: make(map[string][]time.Time)}
+}
+
+// Allow returns true, and counts the event, if another event can be sent for
+// the key at now.
+func (r *RateLimiter) Allow(key string, now time.Time) bool {
+	if r.Limit == 0 {
+		return true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var recent []time.Time
+	for _, t := range r.sent[key] {
+		if now.Sub(t) < r.Period {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.Limit {
+		r.sent[key] = recent
+		return false
+	}
+	r.sent[key] = append(recent, now)
+	return true
+}
+
+// Summary returns a one line, human readable, description of the event.
+func Summary(e Event) string {
+	var res string
+	if e.Success {
+		res = fmt.Sprintf("butler %v succeeded for manager %v on %v", e.Type, e.Manager, e.Host)
+	} else {
+		res = fmt.Sprintf("butler %v failed for manager %v on %v", e.Type, e.Manager, e.Host)
+	}
+	if e.File != "" {
+		res = fmt.Sprintf("%v, file %v", res, e.File)
+	}
+	if e.Snapshot != "" {
+		res = fmt.Sprintf("%v, snapshot %v", res, e.Snapshot)
+	}
+	if e.Message != "" {
+		res = fmt.Sprintf("%v: %v", res, e.Message)
+	}
+	if e.Error != "" {
+		res = fmt.Sprintf("%v: %v", res, e.Error)
+	}
+	return res
+}
+
+// queue hands the events to send in the background, so that slow or
+// retrying notifiers do not hold up butler.
+type queue struct {
+	name   string
+	send   func(Event) error
+	events chan queued
+	done   chan struct{}
+}
+
+type queued struct {
+	event Event
+	send  func(Event) error
+}
+
+func newQueue(name string, size int, send func(Event) error) *queue {
+	q := &queue{name: name, send: send, events: make(chan queued, size), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+	for i := range q.events {
+		if err := i.send(i.event); err != nil {
+			log.Errorf("events.queue::run(): could not send %v event for manager %v to %v notifier. err=%v", i.event.Type, i.event.Manager, q.name, err.Error())
+			metrics.SetButlerEventVal(metrics.FAILURE, q.name)
+			continue
+		}
+		metrics.SetButlerEventVal(metrics.SUCCESS, q.name)
+	}
+}
+
+// push queues the event for the queue send function, and returns an error if
+// the queue is full.
+func (q *queue) push(e Event) error {
+	return q.pushFunc(e, q.send)
+}
+
+// pushFunc queues the event for the send function, and returns an error if
+// the queue is full.
+func (q *queue) pushFunc(e Event, send func(Event) error) error {
+	select {
+	case q.events <- queued{event: e, send: send}:
+		return nil
+	default:
+		return fmt.Errorf("%v notifier queue is full, dropping %v event", q.name, e.Type)
+	}
+}
+
+// close stops the queue once the events already queued have been sent.
+func (q *queue) close() {
+	close(q.events)
+}
+
+// wait blocks until the queue has been closed and drained.
+func (q *queue) wait() {
+	<-q.done
+}
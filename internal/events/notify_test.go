@@ -0,0 +1,270 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+type recorder struct {
+	server *httptest.Server
+	paths  []string
+	bodies []map[string]interface{}
+	mutex  sync.Mutex
+}
+
+func newRecorder() *recorder {
+	r := &recorder{}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.paths = append(r.paths, req.URL.Path)
+		r.bodies = append(r.bodies, body)
+	}))
+	return r
+}
+
+func (s *EventsTestSuite) TestRoutes(c *C) {
+	routes := Routes{
+		Default: Route{URL: "default", Events: []string{"reload:failure"}},
+		Routes:  []Route{{Managers: []string{"prometheus"}, Events: []string{"reload"}, URL: "prometheus"}},
+	}
+	failed := New(TypeReload, "prometheus").WithError(errors.New("boom"))
+
+	r, ok := routes.Find(failed)
+	c.Assert(ok, Equals, true)
+	c.Assert(r.URL, Equals, "prometheus")
+	r, ok = routes.Find(New(TypeReload, "prometheus"))
+	c.Assert(ok, Equals, true)
+	c.Assert(r.URL, Equals, "prometheus")
+
+	failed.Manager = "alertmanager"
+	r, ok = routes.Find(failed)
+	c.Assert(ok, Equals, true)
+	c.Assert(r.URL, Equals, "default")
+	_, ok = routes.Find(New(TypeReload, "alertmanager"))
+	c.Assert(ok, Equals, false)
+}
+
+func (s *EventsTestSuite) TestRateLimiter(c *C) {
+	now := time.Now()
+	r := NewRateLimiter(2, time.Minute)
+	c.Assert(r.Allow("a", now), Equals, true)
+	c.Assert(r.Allow("a", now.Add(time.Second)), Equals, true)
+	c.Assert(r.Allow("a", now.Add(2*time.Second)), Equals, false)
+	c.Assert(r.Allow("b", now.Add(2*time.Second)), Equals, true)
+	c.Assert(r.Allow("a", now.Add(time.Minute+time.Second)), Equals, true)
+
+	r = NewRateLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		c.Assert(r.Allow("a", now), Equals, true)
+	}
+}
+
+func (s *EventsTestSuite) TestSlackNotifier(c *C) {
+	rec := newRecorder()
+	defer rec.server.Close()
+
+	_, err := NewSlackNotifier([]byte(`{}`))
+	c.Assert(err, ErrorMatches, "no url defined for slack notifier")
+
+	n, err := NewSlackNotifier([]byte(`{
+		"url": "` + rec.server.URL + `/default",
+		"channel": "#butler",
+		"rate-limit": "1",
+		"route": [{"managers": ["prometheus"], "events": ["reload:failure"], "url": "` + rec.server.URL + `/prometheus", "channel": "#prometheus"}]
+	}`))
+	c.Assert(err, IsNil)
+	slack := n.(*SlackNotifier)
+	failed := New(TypeReload, "prometheus").WithError(errors.New("boom"))
+	failed.Host = "host01"
+	c.Assert(slack.Send(failed), IsNil)
+	// over the rate limit of the prometheus route
+	c.Assert(slack.Send(failed), IsNil)
+	c.Assert(slack.Send(New(TypeRollback, "alertmanager").WithSnapshot("abc")), IsNil)
+	// does not match the default events
+	c.Assert(slack.Send(New(TypeCopy, "alertmanager")), IsNil)
+	c.Assert(slack.Close(), IsNil)
+	slack.queue.wait()
+
+	c.Assert(rec.paths, DeepEquals, []string{"/prometheus", "/default"})
+	c.Assert(rec.bodies[0]["channel"], Equals, "#prometheus")
+	c.Assert(rec.bodies[0]["text"], Equals, ":x: butler reload failed for manager prometheus on host01: boom")
+	c.Assert(rec.bodies[1]["channel"], Equals, "#butler")
+}
+
+func (s *EventsTestSuite) TestPagerDutyNotifier(c *C) {
+	rec := newRecorder()
+	defer rec.server.Close()
+
+	_, err := NewPagerDutyNotifier([]byte(`{}`))
+	c.Assert(err, ErrorMatches, "no routing-key defined for pagerduty notifier")
+	_, err = NewPagerDutyNotifier([]byte(`{"routing-key": "abc", "severity": "meh"}`))
+	c.Assert(err, NotNil)
+
+	n, err := NewPagerDutyNotifier([]byte(`{
+		"url": "` + rec.server.URL + `",
+		"routing-key": "default-key",
+		"route": [{"managers": ["prometheus"], "events": ["reload"], "routing-key": "prometheus-key"}]
+	}`))
+	c.Assert(err, IsNil)
+	pd := n.(*PagerDutyNotifier)
+	failed := New(TypeReload, "prometheus").WithError(errors.New("boom"))
+	failed.Host = "host01"
+	ok := New(TypeReload, "prometheus")
+	ok.Host = "host01"
+	c.Assert(pd.Send(failed), IsNil)
+	c.Assert(pd.Send(ok), IsNil)
+	c.Assert(pd.Send(New(TypeRestore, "alertmanager").WithError(errors.New("boom"))), IsNil)
+	// successful events of other managers are not routed
+	c.Assert(pd.Send(New(TypeReload, "alertmanager")), IsNil)
+	c.Assert(pd.Close(), IsNil)
+	pd.queue.wait()
+
+	c.Assert(rec.bodies, HasLen, 3)
+	c.Assert(rec.bodies[0]["routing_key"], Equals, "prometheus-key")
+	c.Assert(rec.bodies[0]["event_action"], Equals, "trigger")
+	c.Assert(rec.bodies[0]["dedup_key"], Equals, "butler/host01/prometheus/reload")
+	c.Assert(rec.bodies[0]["payload"].(map[string]interface{})["severity"], Equals, "error")
+	c.Assert(rec.bodies[1]["event_action"], Equals, "resolve")
+	c.Assert(rec.bodies[1]["dedup_key"], Equals, "butler/host01/prometheus/reload")
+	c.Assert(rec.bodies[2]["routing_key"], Equals, "default-key")
+}
+
+func (s *EventsTestSuite) TestNewNotifiersRoutes(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[notify]
+  method = ["slack", "pagerduty"]
+  [notify.slack]
+    url = "https://hooks.slack.com/services/T0/B0/X"
+  [notify.pagerduty]
+    routing-key = "default-key"
+    [[notify.pagerduty.route]]
+      managers = ["prometheus"]
+      routing-key = "prometheus-key"
+`))), IsNil)
+	res, err := NewNotifiers()
+	c.Assert(err, IsNil)
+	c.Assert(res, HasLen, 2)
+	pd := res[1].(*PagerDutyNotifier)
+	c.Assert(pd.Opts.Routes, HasLen, 1)
+	c.Assert(pd.Opts.Routes[0].RoutingKey, Equals, "prometheus-key")
+	c.Assert(pd.Opts.Routes[0].Events, DeepEquals, DefaultPagerDutyEvents)
+	for _, n := range res {
+		c.Assert(n.Close(), IsNil)
+	}
+}
+
+func newAWSRecorder(result string) (*httptest.Server, *[]url.Values) {
+	var (
+		forms []url.Values
+		mutex sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		mutex.Lock()
+		forms = append(forms, req.PostForm)
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(result))
+	}))
+	return server, &forms
+}
+
+func (s *EventsTestSuite) TestSNSNotifier(c *C) {
+	server, forms := newAWSRecorder(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`)
+	defer server.Close()
+
+	_, err := NewSNSNotifier([]byte(`{"topic-arn": "butler"}`))
+	c.Assert(err, ErrorMatches, "invalid sns topic-arn butler")
+
+	n, err := NewSNSNotifier([]byte(`{
+		"topic-arn": "arn:aws:sns:us-west-2:123456789012:butler",
+		"endpoint": "` + server.URL + `",
+		"access-key-id": "key",
+		"secret-access-key": "secret"
+	}`))
+	c.Assert(err, IsNil)
+	sns := n.(*SNSNotifier)
+	c.Assert(sns.Opts.Region, Equals, "us-west-2")
+	change := New(TypeChange, "prometheus").WithVersion("abc123")
+	change.Host = "host01"
+	c.Assert(sns.Send(change), IsNil)
+	// does not match the default events
+	c.Assert(sns.Send(New(TypeCopy, "prometheus")), IsNil)
+	c.Assert(sns.Close(), IsNil)
+	sns.queue.wait()
+
+	c.Assert(*forms, HasLen, 1)
+	form := (*forms)[0]
+	c.Assert(form.Get("Action"), Equals, "Publish")
+	c.Assert(form.Get("TopicArn"), Equals, "arn:aws:sns:us-west-2:123456789012:butler")
+	c.Assert(form.Get("Subject"), Equals, "butler change succeeded for manager prometheus on host01")
+	c.Assert(form.Get("MessageAttributes.entry.5.Name"), Equals, "version")
+	c.Assert(form.Get("MessageAttributes.entry.5.Value.StringValue"), Equals, "abc123")
+	var e Event
+	c.Assert(json.Unmarshal([]byte(form.Get("Message")), &e), IsNil)
+	c.Assert(e.Version, Equals, "abc123")
+
+	long := New(TypeReload, "prometheus").WithError(errors.New(string(bytes.Repeat([]byte("x"), 200))))
+	c.Assert(len(snsSubject(long)), Equals, snsMaxSubject)
+}
+
+func (s *EventsTestSuite) TestSQSNotifier(c *C) {
+	server, forms := newAWSRecorder(`<SendMessageResponse><SendMessageResult><MessageId>1</MessageId></SendMessageResult></SendMessageResponse>`)
+	defer server.Close()
+
+	_, err := NewSQSNotifier([]byte(`{"queue-url": "butler"}`))
+	c.Assert(err, ErrorMatches, "invalid sqs queue-url butler")
+	_, err = NewSQSNotifier([]byte(`{"queue-url": "https://sqs.us-west-2.amazonaws.com/123456789012/butler", "region": "", "endpoint": "` + server.URL + `"}`))
+	if os.Getenv("AWS_REGION") == "" {
+		c.Assert(err, ErrorMatches, "sqs notifier: no region defined")
+	}
+
+	n, err := NewSQSNotifier([]byte(`{
+		"queue-url": "https://sqs.us-west-2.amazonaws.com/123456789012/butler.fifo",
+		"region": "us-west-2",
+		"endpoint": "` + server.URL + `",
+		"access-key-id": "key",
+		"secret-access-key": "secret"
+	}`))
+	c.Assert(err, IsNil)
+	sqs := n.(*SQSNotifier)
+	failed := New(TypeValidation, "prometheus").WithError(errors.New("boom"))
+	failed.Host = "host01"
+	c.Assert(sqs.Send(failed), IsNil)
+	c.Assert(sqs.Close(), IsNil)
+	sqs.queue.wait()
+
+	c.Assert(*forms, HasLen, 1)
+	form := (*forms)[0]
+	c.Assert(form.Get("Action"), Equals, "SendMessage")
+	c.Assert(form.Get("QueueUrl"), Equals, "https://sqs.us-west-2.amazonaws.com/123456789012/butler.fifo")
+	c.Assert(form.Get("MessageGroupId"), Equals, "host01")
+	c.Assert(form.Get("MessageDeduplicationId"), HasLen, 64)
+	c.Assert(form.Get("MessageAttribute.3.Name"), Equals, "success")
+	c.Assert(form.Get("MessageAttribute.3.Value.StringValue"), Equals, "false")
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint.
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+	defaultPagerDutySeverity = "error"
+)
+
+// DefaultPagerDutyEvents are the events which page when the pagerduty
+// notifier does not configure its own.
+var DefaultPagerDutyEvents = []string{TypeValidation + ":failure", TypeReload + ":failure", TypeHealth + ":failure", TypeRestore + ":failure", TypeRollback + ":failure", TypeStale + ":failure"}
+
+// PagerDutyNotifier sends the events matching its routes to the PagerDuty
+// Events API v2. Failed events trigger an incident, and successful events
+// resolve the incident of the same type for the manager on the host, so that
+// routing "reload" rather than "reload:failure" resolves the page once the
+// manager reloads again.
+type PagerDutyNotifier struct {
+	Opts    PagerDutyNotifierOpts `json:"opts"`
+	routes  Routes
+	limiter *RateLimiter
+	queue   *queue
+}
+
+type PagerDutyNotifierOpts struct {
+	URL             string   `json:"url"`
+	RoutingKey      string   `json:"routing-key"`
+	Severity        string   `json:"severity"`
+	Events          []string `json:"events"`
+	Routes          []Route  `json:"route"`
+	RateLimit       string   `json:"rate-limit"`
+	RateLimitPeriod string   `json:"rate-limit-period"`
+	HTTPOpts
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string    `json:"summary"`
+	Source        string    `json:"source"`
+	Severity      string    `json:"severity"`
+	Timestamp     time.Time `json:"timestamp"`
+	Component     string    `json:"component,omitempty"`
+	Group         string    `json:"group,omitempty"`
+	Class         string    `json:"class"`
+	CustomDetails Event     `json:"custom_details"`
+}
+
+func NewPagerDutyNotifier(entry []byte) (Sink, error) {
+	var opts PagerDutyNotifierOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	opts.URL = strings.TrimSpace(environment.GetVar(opts.URL))
+	if opts.URL == "" {
+		opts.URL = DefaultPagerDutyURL
+	}
+	if !validHTTPURL(opts.URL) {
+		return nil, fmt.Errorf("invalid pagerduty url %v", opts.URL)
+	}
+	opts.RoutingKey = strings.TrimSpace(environment.GetVar(opts.RoutingKey))
+	opts.Severity = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Severity)))
+	switch opts.Severity {
+	case "":
+		opts.Severity = defaultPagerDutySeverity
+	case "critical", "error", "warning", "info":
+	default:
+		return nil, fmt.Errorf("invalid pagerduty severity %v", opts.Severity)
+	}
+
+	if len(opts.Events) == 0 {
+		opts.Events = DefaultPagerDutyEvents
+	}
+	if err := ValidateFilters(opts.Events); err != nil {
+		return nil, err
+	}
+	if err := setupRoutes(opts.Routes, opts.Events); err != nil {
+		return nil, err
+	}
+	for i, r := range opts.Routes {
+		if r.RoutingKey == "" {
+			if opts.RoutingKey == "" {
+				return nil, fmt.Errorf("no routing-key defined for pagerduty notifier route[%v]", i)
+			}
+			opts.Routes[i].RoutingKey = opts.RoutingKey
+		}
+	}
+	if opts.RoutingKey == "" && len(opts.Routes) == 0 {
+		return nil, errors.New("no routing-key defined for pagerduty notifier")
+	}
+
+	limit, err := intOpt(opts.RateLimit, defaultRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pagerduty rate-limit %v", opts.RateLimit)
+	}
+	period, err := intOpt(opts.RateLimitPeriod, defaultRateLimitPeriod)
+	if err != nil || period == 0 {
+		return nil, fmt.Errorf("invalid pagerduty rate-limit-period %v", opts.RateLimitPeriod)
+	}
+
+	if err := opts.SetClient(); err != nil {
+		return nil, fmt.Errorf("pagerduty notifier: %v", err.Error())
+	}
+
+	p := &PagerDutyNotifier{Opts: opts, limiter: NewRateLimiter(limit, time.Duration(period)*time.Second)}
+	p.routes = Routes{Routes: opts.Routes}
+	if opts.RoutingKey != "" {
+		p.routes.Default = Route{RoutingKey: opts.RoutingKey, Events: opts.Events}
+	}
+	p.queue = newQueue(p.Name(), DefaultQueueSize, nil)
+	return p, nil
+}
+
+func (p *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// Send queues the event for the route it matches, unless the routing key is
+// over its rate limit.
+func (p *PagerDutyNotifier) Send(e Event) error {
+	route, ok := p.routes.Find(e)
+	if !ok || route.RoutingKey == "" {
+		return nil
+	}
+	if !p.limiter.Allow(route.RoutingKey, e.Time) {
+		log.Warnf("PagerDutyNotifier::Send(): rate limit reached, dropping %v event for manager %v", e.Type, e.Manager)
+		return nil
+	}
+	return p.queue.pushFunc(e, func(e Event) error {
+		return p.post(route, e)
+	})
+}
+
+func (p *PagerDutyNotifier) post(route Route, e Event) error {
+	pe := pagerDutyEvent{
+		RoutingKey:  route.RoutingKey,
+		EventAction: "resolve",
+		DedupKey:    fmt.Sprintf("butler/%v/%v/%v", e.Host, e.Manager, e.Type),
+	}
+	if !e.Success {
+		pe.EventAction = "trigger"
+		pe.Payload = &pagerDutyPayload{
+			Summary:       Summary(e),
+			Source:        e.Host,
+			Severity:      p.Opts.Severity,
+			Timestamp:     e.Time,
+			Component:     e.Manager,
+			Group:         "butler",
+			Class:         e.Type,
+			CustomDetails: e,
+		}
+	}
+	data, err := json.Marshal(pe)
+	if err != nil {
+		return err
+	}
+	return postJSON(p.Opts.Client, p.Opts.URL, data)
+}
+
+func (p *PagerDutyNotifier) Close() error {
+	p.queue.close()
+	return nil
+}
+
+func (p *PagerDutyNotifier) wait() {
+	p.queue.wait()
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRateLimit       = 10
+	defaultRateLimitPeriod = 60
+)
+
+// SlackNotifier posts the events matching its routes to Slack incoming
+// webhooks. Each route is rate limited on its own, so that a flapping
+// manager cannot flood a channel.
+type SlackNotifier struct {
+	Opts    SlackNotifierOpts `json:"opts"`
+	routes  Routes
+	limiter *RateLimiter
+	queue   *queue
+}
+
+type SlackNotifierOpts struct {
+	URL             string   `json:"url"`
+	Channel         string   `json:"channel"`
+	Username        string   `json:"username"`
+	Events          []string `json:"events"`
+	Routes          []Route  `json:"route"`
+	RateLimit       string   `json:"rate-limit"`
+	RateLimitPeriod string   `json:"rate-limit-period"`
+	HTTPOpts
+}
+
+type slackMessage struct {
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text"`
+}
+
+func NewSlackNotifier(entry []byte) (Sink, error) {
+	var opts SlackNotifierOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	opts.URL = strings.TrimSpace(environment.GetVar(opts.URL))
+	opts.Channel = strings.TrimSpace(environment.GetVar(opts.Channel))
+	opts.Username = strings.TrimSpace(environment.GetVar(opts.Username))
+	if len(opts.Events) == 0 {
+		opts.Events = DefaultNotifyEvents
+	}
+	if err := ValidateFilters(opts.Events); err != nil {
+		return nil, err
+	}
+	if err := setupRoutes(opts.Routes, opts.Events); err != nil {
+		return nil, err
+	}
+	for i, r := range opts.Routes {
+		if r.URL == "" {
+			if opts.URL == "" {
+				return nil, fmt.Errorf("no url defined for slack notifier route[%v]", i)
+			}
+			opts.Routes[i].URL = opts.URL
+		}
+		if !validHTTPURL(opts.Routes[i].URL) {
+			return nil, fmt.Errorf("invalid slack url for route[%v]", i)
+		}
+		if r.Channel == "" {
+			opts.Routes[i].Channel = opts.Channel
+		}
+	}
+	if opts.URL == "" && len(opts.Routes) == 0 {
+		return nil, errors.New("no url defined for slack notifier")
+	}
+	if opts.URL != "" && !validHTTPURL(opts.URL) {
+		return nil, errors.New("invalid slack url")
+	}
+
+	limit, err := intOpt(opts.RateLimit, defaultRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slack rate-limit %v", opts.RateLimit)
+	}
+	period, err := intOpt(opts.RateLimitPeriod, defaultRateLimitPeriod)
+	if err != nil || period == 0 {
+		return nil, fmt.Errorf("invalid slack rate-limit-period %v", opts.RateLimitPeriod)
+	}
+
+	if err := opts.SetClient(); err != nil {
+		return nil, fmt.Errorf("slack notifier: %v", err.Error())
+	}
+
+	s := &SlackNotifier{Opts: opts, limiter: NewRateLimiter(limit, time.Duration(period)*time.Second)}
+	s.routes = Routes{Routes: opts.Routes}
+	// without a default url, only the routed events are sent
+	if opts.URL != "" {
+		s.routes.Default = Route{URL: opts.URL, Channel: opts.Channel, Events: opts.Events}
+	}
+	s.queue = newQueue(s.Name(), DefaultQueueSize, nil)
+	return s, nil
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Send queues the event for the route it matches, unless the route is over
+// its rate limit.
+func (s *SlackNotifier) Send(e Event) error {
+	route, ok := s.routes.Find(e)
+	if !ok || route.URL == "" {
+		return nil
+	}
+	if !s.limiter.Allow(route.URL+"#"+route.Channel, e.Time) {
+		log.Warnf("SlackNotifier::Send(): rate limit reached, dropping %v event for manager %v", e.Type, e.Manager)
+		return nil
+	}
+	return s.queue.pushFunc(e, func(e Event) error {
+		return s.post(route, e)
+	})
+}
+
+func (s *SlackNotifier) post(route Route, e Event) error {
+	icon := ":white_check_mark:"
+	if !e.Success {
+		icon = ":x:"
+	}
+	data, err := json.Marshal(slackMessage{Channel: route.Channel, Username: s.Opts.Username, Text: fmt.Sprintf("%v %v", icon, Summary(e))})
+	if err != nil {
+		return err
+	}
+	return postJSON(s.Opts.Client, route.URL, data)
+}
+
+func (s *SlackNotifier) Close() error {
+	s.queue.close()
+	return nil
+}
+
+func (s *SlackNotifier) wait() {
+	s.queue.wait()
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package events
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+const (
+	defaultNotifyTimeout      = 10
+	defaultNotifyRetries      = 3
+	defaultNotifyRetryWaitMin = 1
+	defaultNotifyRetryWaitMax = 10
+)
+
+// WebhookNotifier POSTs the events matching its filters, as JSON, to each of
+// its URLs. Failed requests are retried with backoff.
+type WebhookNotifier struct {
+	Opts  WebhookNotifierOpts `json:"opts"`
+	queue *queue
+}
+
+type WebhookNotifierOpts struct {
+	URLs   []string `json:"urls"`
+	Events []string `json:"events"`
+	HTTPOpts
+}
+
+// HTTPOpts are the retry and timeout options shared by the notifiers which
+// talk http.
+type HTTPOpts struct {
+	InsecureSkipVerify string                `json:"insecure-skip-verify"`
+	Retries            string                `json:"retries"`
+	RetryWaitMax       string                `json:"retry-wait-max"`
+	RetryWaitMin       string                `json:"retry-wait-min"`
+	Timeout            string                `json:"timeout"`
+	Client             *retryablehttp.Client `json:"-"`
+}
+
+// SetClient sets up the retrying client from the options.
+func (o *HTTPOpts) SetClient() error {
+	timeout, err := intOpt(o.Timeout, defaultNotifyTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %v", o.Timeout)
+	}
+	retries, err := intOpt(o.Retries, defaultNotifyRetries)
+	if err != nil {
+		return fmt.Errorf("invalid retries %v", o.Retries)
+	}
+	retryWaitMin, err := intOpt(o.RetryWaitMin, defaultNotifyRetryWaitMin)
+	if err != nil {
+		return fmt.Errorf("invalid retry-wait-min %v", o.RetryWaitMin)
+	}
+	retryWaitMax, err := intOpt(o.RetryWaitMax, defaultNotifyRetryWaitMax)
+	if err != nil {
+		return fmt.Errorf("invalid retry-wait-max %v", o.RetryWaitMax)
+	}
+
+	o.Client = retryablehttp.NewClient()
+	o.Client.Logger.SetFlags(0)
+	o.Client.Logger.SetOutput(ioutil.Discard)
+	o.Client.HTTPClient.Timeout = time.Duration(timeout) * time.Second
+	o.Client.HTTPClient.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: strings.ToLower(environment.GetVar(o.InsecureSkipVerify)) == "true"},
+	}
+	o.Client.RetryMax = retries
+	o.Client.RetryWaitMin = time.Duration(retryWaitMin) * time.Second
+	o.Client.RetryWaitMax = time.Duration(retryWaitMax) * time.Second
+	return nil
+}
+
+func NewWebhookNotifier(entry []byte) (Sink, error) {
+	var opts WebhookNotifierOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	for i := range opts.URLs {
+		opts.URLs[i] = strings.TrimSpace(environment.GetVar(opts.URLs[i]))
+		if !validHTTPURL(opts.URLs[i]) {
+			// the url is left out of the error, since it may hold a token
+			return nil, fmt.Errorf("invalid webhook url urls[%v]", i)
+		}
+	}
+	if len(opts.URLs) == 0 {
+		return nil, errors.New("no urls defined for webhook notifier")
+	}
+
+	if len(opts.Events) == 0 {
+		opts.Events = DefaultNotifyEvents
+	}
+	if err := ValidateFilters(opts.Events); err != nil {
+		return nil, err
+	}
+
+	if err := opts.SetClient(); err != nil {
+		return nil, fmt.Errorf("webhook notifier: %v", err.Error())
+	}
+
+	w := &WebhookNotifier{Opts: opts}
+	w.queue = newQueue(w.Name(), DefaultQueueSize, w.post)
+	return w, nil
+}
+
+func validHTTPURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
+
+// intOpt converts the stringed integer option, which may come from the
+// environment, falling back to def when it is not set.
+func intOpt(opt string, def int) (int, error) {
+	opt = strings.TrimSpace(environment.GetVar(opt))
+	if opt == "" {
+		return def, nil
+	}
+	res, err := strconv.Atoi(opt)
+	if err != nil || res < 0 {
+		return 0, fmt.Errorf("invalid value %v", opt)
+	}
+	return res, nil
+}
+
+// postJSON POSTs the data to the url, retrying with the client, and returns
+// an error for any response other than a 2xx. Webhook urls often embed a
+// token, so errors only name the host.
+func postJSON(client *retryablehttp.Client, u string, data []byte) error {
+	req, err := retryablehttp.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	host := req.URL.Host
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %v failed after %v attempts", host, client.RetryMax+1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %v from %v", resp.Status, host)
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Send queues the event for the webhooks if it matches the notifier events.
+func (w *WebhookNotifier) Send(e Event) error {
+	if !MatchEvent(w.Opts.Events, e) {
+		return nil
+	}
+	return w.queue.push(e)
+}
+
+func (w *WebhookNotifier) post(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, u := range w.Opts.URLs {
+		if err := postJSON(w.Opts.Client, u, data); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) Close() error {
+	w.queue.close()
+	return nil
+}
+
+func (w *WebhookNotifier) wait() {
+	w.queue.wait()
+}
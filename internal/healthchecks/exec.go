@@ -0,0 +1,98 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package healthchecks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func NewExecHealthCheck(manager string, method string, entry []byte) (HealthCheck, error) {
+	var (
+		err    error
+		result ExecHealthCheck
+		opts   ExecHealthCheckOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Command = strings.TrimSpace(environment.GetVar(opts.Command))
+	if opts.Command == "" {
+		return result, errors.New("no command defined for exec health check")
+	}
+	opts.timeout = time.Duration(parseSeconds(opts.AttemptTimeout, defaultAttemptTimeout)) * time.Second
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// ExecHealthCheck runs a command, which must exit zero for the manager to be
+// healthy. Like the exec reloader, the command is split on whitespace and run
+// directly, not through a shell.
+type ExecHealthCheck struct {
+	Manager string              `json:"-"`
+	Counter int                 `json:"-"`
+	Method  string              `json:"method"`
+	Opts    ExecHealthCheckOpts `json:"opts"`
+}
+
+type ExecHealthCheckOpts struct {
+	Command        string `json:"command"`
+	AttemptTimeout string `json:"attempt-timeout"`
+	timeout        time.Duration
+}
+
+func (e ExecHealthCheck) Check() error {
+	o := e.GetOpts().(ExecHealthCheckOpts)
+	args := strings.Fields(o.Command)
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	log.Debugf("ExecHealthCheck::Check()[count=%v][manager=%v]: running %v", e.Counter, e.Manager, args)
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("health check command timed out after %v", o.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("health check command failed err=%v output=%v", err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (e ExecHealthCheck) GetMethod() string {
+	return e.Method
+}
+
+func (e ExecHealthCheck) GetOpts() HealthCheckOpts {
+	return e.Opts
+}
+
+func (e ExecHealthCheck) SetCounter(c int) HealthCheck {
+	e.Counter = c
+	return e
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package healthchecks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultTimeout        = 60
+	defaultInterval       = 5
+	defaultAttemptTimeout = 5
+)
+
+// HealthCheck is the interface which all the manager health checks must
+// implement. Check makes a single attempt at checking that the manager is
+// healthy.
+type HealthCheck interface {
+	Check() error
+	GetMethod() string
+	GetOpts() HealthCheckOpts
+	SetCounter(int) HealthCheck
+}
+
+type HealthCheckOpts interface {
+}
+
+// HealthChecker polls the health check of a manager after it has been
+// reloaded, until the check passes or the timeout has passed.
+type HealthChecker struct {
+	Manager     string        `json:"-"`
+	Method      string        `json:"method"`
+	CfgTimeout  string        `json:"-"`
+	Timeout     time.Duration `json:"timeout"`
+	CfgInterval string        `json:"-"`
+	Interval    time.Duration `json:"interval"`
+	Check       HealthCheck   `json:"check"`
+}
+
+// New returns the health checker which has been configured for the manager
+// entry. Like the validators, the health check is optional, so when none has
+// been defined a nil health checker and nil error are returned.
+func New(entry string) (*HealthChecker, error) {
+	var (
+		err    error
+		result map[string]interface{}
+	)
+
+	key := fmt.Sprintf("%s.health-check", entry)
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+
+	err = viper.UnmarshalKey(key, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// health check is defined, but there's no method
+	if result == nil || result["method"] == nil {
+		return nil, errors.New("no health check method has been defined for manager")
+	}
+
+	method := fmt.Sprintf("%v", result["method"])
+	if _, ok := result[method]; !ok {
+		return nil, fmt.Errorf("no health check configuration has been defined for method %v", method)
+	}
+	jsonRes, err := json.Marshal(result[method])
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &HealthChecker{Manager: entry, Method: method}
+	if t, ok := result["timeout"]; ok {
+		hc.CfgTimeout = fmt.Sprintf("%v", t)
+	}
+	if i, ok := result["interval"]; ok {
+		hc.CfgInterval = fmt.Sprintf("%v", i)
+	}
+	hc.Timeout = time.Duration(parseSeconds(hc.CfgTimeout, defaultTimeout)) * time.Second
+	hc.Interval = time.Duration(parseSeconds(hc.CfgInterval, defaultInterval)) * time.Second
+
+	switch method {
+	case "http", "https":
+		hc.Check, err = NewHTTPHealthCheck(entry, method, jsonRes)
+	case "exec":
+		hc.Check, err = NewExecHealthCheck(entry, method, jsonRes)
+	default:
+		return nil, fmt.Errorf("unknown health check method %v", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// Wait runs the health check every interval until it passes, and returns the
+// error of the last attempt when it has not passed within the timeout.
+func (h *HealthChecker) Wait(counter int) error {
+	deadline := time.Now().Add(h.Timeout)
+	for attempt := 1; ; attempt++ {
+		err := h.Check.SetCounter(counter).Check()
+		if err == nil {
+			log.Infof("HealthChecker::Wait()[count=%v][manager=%v]: manager is healthy after %v attempt(s).", counter, h.Manager, attempt)
+			return nil
+		}
+		log.Debugf("HealthChecker::Wait()[count=%v][manager=%v]: attempt %v failed. err=%v", counter, h.Manager, attempt, err.Error())
+		if time.Now().Add(h.Interval).After(deadline) {
+			log.Errorf("HealthChecker::Wait()[count=%v][manager=%v]: manager is not healthy after %v. err=%v", counter, h.Manager, h.Timeout, err.Error())
+			return fmt.Errorf("manager is not healthy after %v: %v", h.Timeout, err.Error())
+		}
+		time.Sleep(h.Interval)
+	}
+}
+
+// parseSeconds returns the number of seconds in the option, or the default
+// when it is not set or not a positive integer.
+func parseSeconds(opt string, def int) int {
+	res, _ := strconv.Atoi(environment.GetVar(opt))
+	if res <= 0 {
+		return def
+	}
+	return res
+}
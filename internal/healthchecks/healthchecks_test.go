@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package healthchecks
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&HealthChecksTestSuite{})
+
+type HealthChecksTestSuite struct {
+}
+
+var TestHealthCheckConfig = []byte(`[testing]
+  [testing.health-check]
+    method = "exec"
+    timeout = "3"
+    interval = "1"
+    [testing.health-check.exec]
+      command = "true"
+`)
+
+var TestHealthCheckConfigNoMethod = []byte(`[testing]
+  [testing.health-check]
+    [testing.health-check.exec]
+      command = "true"
+`)
+
+func (s *HealthChecksTestSuite) TestNewNotConfigured(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[testing]`))), IsNil)
+	hc, err := New("testing")
+	c.Assert(err, IsNil)
+	c.Assert(hc, IsNil)
+}
+
+func (s *HealthChecksTestSuite) TestNewNoMethod(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(TestHealthCheckConfigNoMethod)), IsNil)
+	_, err := New("testing")
+	c.Assert(err, NotNil)
+}
+
+func (s *HealthChecksTestSuite) TestNewExec(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(TestHealthCheckConfig)), IsNil)
+	hc, err := New("testing")
+	c.Assert(err, IsNil)
+	c.Assert(hc.Timeout, Equals, 3*time.Second)
+	c.Assert(hc.Interval, Equals, time.Second)
+	c.Assert(hc.Check.GetMethod(), Equals, "exec")
+	c.Assert(hc.Wait(0), IsNil)
+}
+
+func (s *HealthChecksTestSuite) TestExecFailure(c *C) {
+	check, err := NewExecHealthCheck("testing", "exec", []byte(`{"command": "false"}`))
+	c.Assert(err, IsNil)
+	hc := &HealthChecker{Manager: "testing", Method: "exec", Timeout: time.Second, Interval: time.Second, Check: check}
+	c.Assert(hc.Wait(0), NotNil)
+
+	_, err = NewExecHealthCheck("testing", "exec", []byte(`{"command": ""}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *HealthChecksTestSuite) TestHTTP(c *C) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the manager only becomes ready on the second attempt
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	check, err := NewHTTPHealthCheck("testing", "http", []byte(`{"url": "`+ts.URL+`/-/ready"}`))
+	c.Assert(err, IsNil)
+	hc := &HealthChecker{Manager: "testing", Method: "http", Timeout: 5 * time.Second, Interval: 10 * time.Millisecond, Check: check}
+	c.Assert(hc.Wait(0), IsNil)
+	c.Assert(requests, Equals, 2)
+
+	// the service unavailable response is not one of the success codes
+	check, err = NewHTTPHealthCheck("testing", "http", []byte(`{"url": "`+ts.URL+`/-/ready", "success-codes": ["204"]}`))
+	c.Assert(err, IsNil)
+	c.Assert(check.Check(), NotNil)
+
+	_, err = NewHTTPHealthCheck("testing", "http", []byte(`{"url": "localhost:9090"}`))
+	c.Assert(err, NotNil)
+	_, err = NewHTTPHealthCheck("testing", "http", []byte(`{"url": "`+ts.URL+`", "success-codes": ["ok"]}`))
+	c.Assert(err, NotNil)
+}
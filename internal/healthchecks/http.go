@@ -0,0 +1,145 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package healthchecks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	defaultSuccessCodes = []string{"2xx"}
+	successCodeRe       = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+)
+
+func NewHTTPHealthCheck(manager string, method string, entry []byte) (HealthCheck, error) {
+	var (
+		err    error
+		result HTTPHealthCheck
+		opts   HTTPHealthCheckOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.URL = environment.GetVar(opts.URL)
+	if !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return result, fmt.Errorf("invalid http health check url %v", opts.URL)
+	}
+
+	if len(opts.SuccessCodes) == 0 {
+		opts.SuccessCodes = defaultSuccessCodes
+	}
+	for i, c := range opts.SuccessCodes {
+		opts.SuccessCodes[i] = strings.ToLower(environment.GetVar(c))
+		if !successCodeRe.MatchString(opts.SuccessCodes[i]) {
+			return result, fmt.Errorf("invalid http health check success-codes %v, expected eg: 200 or 2xx", c)
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"}
+	opts.TLSCA = environment.GetVar(opts.TLSCA)
+	if opts.TLSCA != "" {
+		ca, err := ioutil.ReadFile(opts.TLSCA)
+		if err != nil {
+			return result, fmt.Errorf("could not read http health check tls-ca %v", opts.TLSCA)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return result, errors.New("no certificates found in http health check tls-ca")
+		}
+	}
+
+	opts.client = &http.Client{
+		Timeout:   time.Duration(parseSeconds(opts.AttemptTimeout, defaultAttemptTimeout)) * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// HTTPHealthCheck GETs a url, which must respond with one of the success codes
+// for the manager to be healthy, eg: the prometheus /-/ready endpoint.
+type HTTPHealthCheck struct {
+	Manager string              `json:"-"`
+	Counter int                 `json:"-"`
+	Method  string              `json:"method"`
+	Opts    HTTPHealthCheckOpts `json:"opts"`
+}
+
+type HTTPHealthCheckOpts struct {
+	URL                string   `json:"url"`
+	SuccessCodes       []string `json:"success-codes"`
+	AttemptTimeout     string   `json:"attempt-timeout"`
+	InsecureSkipVerify string   `json:"insecure-skip-verify"`
+	TLSCA              string   `json:"tls-ca"`
+	client             *http.Client
+}
+
+// IsSuccessCode returns whether the status code is one of the success-codes,
+// which are either exact codes or classes, eg: 2xx.
+func (h HTTPHealthCheckOpts) IsSuccessCode(code int) bool {
+	status := strconv.Itoa(code)
+	for _, c := range h.SuccessCodes {
+		if c == status || (strings.HasSuffix(c, "xx") && c[0] == status[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HTTPHealthCheck) Check() error {
+	o := h.GetOpts().(HTTPHealthCheckOpts)
+
+	log.Debugf("HTTPHealthCheck::Check()[count=%v][manager=%v]: checking %v", h.Counter, h.Manager, o.URL)
+	resp, err := o.client.Get(o.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !o.IsSuccessCode(resp.StatusCode) {
+		return fmt.Errorf("received bad response from %v. http_code=%d", o.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (h HTTPHealthCheck) GetMethod() string {
+	return h.Method
+}
+
+func (h HTTPHealthCheck) GetOpts() HealthCheckOpts {
+	return h.Opts
+}
+
+func (h HTTPHealthCheck) SetCounter(c int) HealthCheck {
+	h.Counter = c
+	return h
+}
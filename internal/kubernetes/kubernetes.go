@@ -0,0 +1,174 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package kubernetes is a small client of the kubernetes API, for butler
+// running in a pod of the cluster, with the service account of the pod, or
+// talking to an API server of its own.
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultServiceAccountDir is where the service account of a pod is
+	// mounted.
+	DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// DefaultTimeout is the timeout of the requests to the API server.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Config tells how to talk to the API server. The fields which are left
+// empty default to those of the cluster butler runs in.
+type Config struct {
+	APIServer          string
+	TokenFile          string
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	ServiceAccountDir  string
+}
+
+// Client talks to the API server of a Config.
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+// StatusError is the error of a request which the API server has refused.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http_code=%d message=%v", e.Code, e.Message)
+}
+
+// IsNotFound returns whether the error is a StatusError for an object which
+// does not exist.
+func IsNotFound(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// NewClient returns a Client of the API server of the config.
+func NewClient(c Config) (*Client, error) {
+	if c.ServiceAccountDir == "" {
+		c.ServiceAccountDir = DefaultServiceAccountDir
+	}
+	if c.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("no api-server defined, and not running in a cluster")
+		}
+		c.APIServer = fmt.Sprintf("https://%s", net.JoinHostPort(host, port))
+	}
+	c.APIServer = strings.TrimRight(c.APIServer, "/")
+	if c.TokenFile == "" {
+		c.TokenFile = fmt.Sprintf("%s/token", c.ServiceAccountDir)
+	}
+	if c.CAFile == "" {
+		c.CAFile = fmt.Sprintf("%s/ca.crt", c.ServiceAccountDir)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if !tlsConfig.InsecureSkipVerify && strings.HasPrefix(c.APIServer, "https://") {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca-file %v", c.CAFile)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in ca-file %v", c.CAFile)
+		}
+	}
+	return &Client{
+		config: c,
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Namespace returns the namespace of the pod butler runs in.
+func (c *Client) Namespace() (string, error) {
+	ns, err := ioutil.ReadFile(fmt.Sprintf("%s/namespace", c.config.ServiceAccountDir))
+	if err != nil {
+		return "", errors.New("no namespace defined, and not running in a cluster")
+	}
+	return strings.TrimSpace(string(ns)), nil
+}
+
+// Do sends a request for the path of the API server, with the body as JSON
+// unless it is nil, and decodes the JSON response into out unless it is
+// nil. It returns a StatusError when the API server refuses the request.
+func (c *Client) Do(method string, path string, body interface{}, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.config.APIServer+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// the token is read on every request, since it is rotated
+	if token, err := ioutil.ReadFile(c.config.TokenFile); err == nil {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &status)
+		return &StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
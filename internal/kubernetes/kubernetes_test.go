@@ -0,0 +1,92 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type KubernetesTestSuite struct {
+}
+
+var _ = Suite(&KubernetesTestSuite{})
+
+func (s *KubernetesTestSuite) TestClient(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "forbidden"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/monitoring/configmaps/prometheus":
+			w.Write([]byte(`{"metadata": {"name": "prometheus"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	dir := c.MkDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(dir+"/ca.crt", ca, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/token", []byte("sa-token\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/namespace", []byte("monitoring\n"), 0644), IsNil)
+
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	_, err := NewClient(Config{ServiceAccountDir: dir})
+	c.Assert(err, ErrorMatches, "no api-server defined, and not running in a cluster")
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+	defer os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+	client, err := NewClient(Config{ServiceAccountDir: dir})
+	c.Assert(err, IsNil)
+	ns, err := client.Namespace()
+	c.Assert(err, IsNil)
+	c.Assert(ns, Equals, "monitoring")
+
+	var obj struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	c.Assert(client.Do("GET", "/api/v1/namespaces/monitoring/configmaps/prometheus", nil, &obj), IsNil)
+	c.Assert(obj.Metadata.Name, Equals, "prometheus")
+	err = client.Do("GET", "/api/v1/namespaces/monitoring/configmaps/missing", nil, &obj)
+	c.Assert(IsNotFound(err), Equals, true)
+	c.Assert(err, ErrorMatches, "http_code=404 message=not found")
+
+	// a token which is not the one of the service account is refused
+	client, err = NewClient(Config{ServiceAccountDir: dir, TokenFile: dir + "/namespace"})
+	c.Assert(err, IsNil)
+	err = client.Do("GET", "/api/v1/namespaces/monitoring/configmaps/prometheus", nil, nil)
+	c.Assert(IsNotFound(err), Equals, false)
+	c.Assert(err, ErrorMatches, "http_code=403 message=forbidden")
+
+	_, err = NewClient(Config{APIServer: server.URL, CAFile: dir + "/token"})
+	c.Assert(err, ErrorMatches, "no certificates found in ca-file .*")
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+)
+
+const (
+	// DefaultConsulAddress is the address of the local consul agent.
+	DefaultConsulAddress = "http://127.0.0.1:8500"
+	// consulMinTTL is the shortest ttl of a consul session.
+	consulMinTTL = 10 * time.Second
+)
+
+// ConsulLockOpts are the options of the consul lock. The token is the ACL
+// token of the requests, if any.
+type ConsulLockOpts struct {
+	Address            string `json:"address"`
+	Key                string `json:"key"`
+	Token              string `json:"token"`
+	InsecureSkipVerify string `json:"insecure-skip-verify"`
+}
+
+// ConsulLock is a key in the consul KV store, which is held by a consul
+// session of the holder, through the consul HTTP API. The session expires
+// along with the hold, which releases the key. The fencing token is the lock
+// index of the key. Consul sessions last 10 seconds at least.
+type ConsulLock struct {
+	Opts    ConsulLockOpts
+	client  *http.Client
+	mutex   sync.Mutex
+	session string
+}
+
+func NewConsulLock(entry []byte) (Lock, error) {
+	var opts ConsulLockOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+	opts.Address = strings.TrimSuffix(strings.TrimSpace(environment.GetVar(opts.Address)), "/")
+	if opts.Address == "" {
+		opts.Address = DefaultConsulAddress
+	}
+	if u, err := url.Parse(opts.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid consul address %v", opts.Address)
+	}
+	opts.Key = strings.Trim(environment.GetVar(opts.Key), "/")
+	if opts.Key == "" {
+		return nil, errors.New("no key defined for the consul lock")
+	}
+	opts.Token = environment.GetVar(opts.Token)
+	insecure := strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"
+	return &ConsulLock{
+		Opts: opts,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+		},
+	}, nil
+}
+
+func (l *ConsulLock) Name() string {
+	return "consul"
+}
+
+// do sends a request to the consul HTTP API, and decodes its JSON response
+// into res, if any. It returns the status code of the response.
+func (l *ConsulLock) do(ctx context.Context, method string, path string, body interface{}, res interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, l.Opts.Address+path, r)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if l.Opts.Token != "" {
+		req.Header.Set("X-Consul-Token", l.Opts.Token)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, fmt.Errorf("unexpected response %v from consul", resp.Status)
+	}
+	if res == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(res)
+}
+
+// renewSession renews the session of the lock, or creates one when there is
+// none, or it has expired.
+func (l *ConsulLock) renewSession(ctx context.Context, id string, ttl time.Duration) error {
+	if l.session != "" {
+		code, err := l.do(ctx, "PUT", "/v1/session/renew/"+l.session, nil, nil)
+		if err == nil {
+			return nil
+		}
+		if code != http.StatusNotFound {
+			return err
+		}
+		l.session = ""
+	}
+	if ttl < consulMinTTL {
+		ttl = consulMinTTL
+	}
+	var res struct {
+		ID string `json:"ID"`
+	}
+	body := map[string]string{
+		"Name":      "butler-leader:" + id,
+		"TTL":       fmt.Sprintf("%ds", int(ttl/time.Second)),
+		"Behavior":  "release",
+		"LockDelay": "0s",
+	}
+	if _, err := l.do(ctx, "PUT", "/v1/session/create", body, &res); err != nil {
+		return err
+	}
+	l.session = res.ID
+	return nil
+}
+
+func (l *ConsulLock) Acquire(ctx context.Context, id string, ttl time.Duration) (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.renewSession(ctx, id, ttl); err != nil {
+		return 0, err
+	}
+
+	var acquired bool
+	if _, err := l.do(ctx, "PUT", "/v1/kv/"+l.Opts.Key+"?acquire="+url.QueryEscape(l.session), id, &acquired); err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, ErrHeld
+	}
+	var pairs []struct {
+		LockIndex uint64 `json:"LockIndex"`
+		Session   string `json:"Session"`
+	}
+	if _, err := l.do(ctx, "GET", "/v1/kv/"+l.Opts.Key, nil, &pairs); err != nil {
+		return 0, err
+	}
+	if len(pairs) == 0 || pairs[0].Session != l.session {
+		return 0, ErrHeld
+	}
+	return pairs[0].LockIndex, nil
+}
+
+func (l *ConsulLock) Release(ctx context.Context, id string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.session == "" {
+		return nil
+	}
+	_, err := l.do(ctx, "PUT", "/v1/kv/"+l.Opts.Key+"?release="+url.QueryEscape(l.session), nil, nil)
+	if _, derr := l.do(ctx, "PUT", "/v1/session/destroy/"+l.session, nil, nil); err == nil {
+		err = derr
+	}
+	l.session = ""
+	return err
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	"github.com/coreos/etcd/client"
+)
+
+// EtcdLockOpts are the options of the etcd lock.
+type EtcdLockOpts struct {
+	Endpoints          []string `json:"endpoints"`
+	Key                string   `json:"key"`
+	InsecureSkipVerify string   `json:"insecure-skip-verify"`
+}
+
+// EtcdLock is a key in etcd, which holds the id of the holder and expires
+// along with the hold. The fencing token is the index at which the key was
+// created.
+type EtcdLock struct {
+	Opts EtcdLockOpts
+	api  client.KeysAPI
+}
+
+func NewEtcdLock(entry []byte) (Lock, error) {
+	var opts EtcdLockOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+	endpoints := strings.TrimSpace(environment.GetVar(strings.Join(opts.Endpoints, ",")))
+	if endpoints == "" {
+		return nil, errors.New("no endpoints defined for the etcd lock")
+	}
+	opts.Endpoints = strings.Split(endpoints, ",")
+	opts.Key = environment.GetVar(opts.Key)
+	if opts.Key == "" {
+		return nil, errors.New("no key defined for the etcd lock")
+	}
+	insecure := strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"
+	c, err := client.New(client.Config{
+		Endpoints: opts.Endpoints,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+		HeaderTimeoutPerRequest: time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdLock{Opts: opts, api: client.NewKeysAPI(c)}, nil
+}
+
+func (l *EtcdLock) Name() string {
+	return "etcd"
+}
+
+// isConflict returns whether err is etcd refusing to set the key because it
+// is held by another holder.
+func isConflict(err error) bool {
+	e, ok := err.(client.Error)
+	return ok && (e.Code == client.ErrorCodeNodeExist || e.Code == client.ErrorCodeTestFailed)
+}
+
+func (l *EtcdLock) Acquire(ctx context.Context, id string, ttl time.Duration) (uint64, error) {
+	resp, err := l.api.Get(ctx, l.Opts.Key, nil)
+	switch {
+	case client.IsKeyNotFound(err):
+		resp, err = l.api.Set(ctx, l.Opts.Key, id, &client.SetOptions{PrevExist: client.PrevNoExist, TTL: ttl})
+	case err != nil:
+		return 0, err
+	case resp.Node.Value != id:
+		return 0, ErrHeld
+	default:
+		resp, err = l.api.Set(ctx, l.Opts.Key, "", &client.SetOptions{PrevValue: id, TTL: ttl, Refresh: true})
+	}
+	if isConflict(err) {
+		return 0, ErrHeld
+	}
+	if err != nil {
+		return 0, err
+	}
+	return resp.Node.CreatedIndex, nil
+}
+
+func (l *EtcdLock) Release(ctx context.Context, id string) error {
+	_, err := l.api.Delete(ctx, l.Opts.Key, &client.DeleteOptions{PrevValue: id})
+	if client.IsKeyNotFound(err) || isConflict(err) {
+		return nil
+	}
+	return err
+}
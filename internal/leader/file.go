@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// FileLockOpts are the options of the file lock.
+type FileLockOpts struct {
+	Path string `json:"path"`
+}
+
+// FileLock is a lock file on the shared filesystem, eg: next to the shared
+// destination. The holder, the fencing token and when the hold expires are
+// kept in the file, which is only read and written under a flock, so the
+// shared filesystem has to support flock, as EFS and NFSv4 do, or under a
+// LockFileEx lock on windows, as SMB shares do. The hosts which share the
+// lock must keep their clocks in sync.
+type FileLock struct {
+	Opts FileLockOpts
+}
+
+// fileLockState is the content of the lock file.
+type fileLockState struct {
+	Holder  string    `json:"holder"`
+	Token   uint64    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func NewFileLock(entry []byte) (Lock, error) {
+	var opts FileLockOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Path == "" {
+		return nil, errors.New("no path defined for the file lock")
+	}
+	return &FileLock{Opts: opts}, nil
+}
+
+func (l *FileLock) Name() string {
+	return "file"
+}
+
+// update runs fn on the state of the lock under a lock of the lock file, and
+// writes the state back when fn returns true.
+func (l *FileLock) update(fn func(s *fileLockState) (bool, error)) error {
+	f, err := os.OpenFile(l.Opts.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	var s fileLockState
+	// an empty file is a lock which has never been held
+	if err = json.NewDecoder(f).Decode(&s); err != nil && err != io.EOF {
+		return err
+	}
+	write, err := fn(&s)
+	if err != nil || !write {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (l *FileLock) Acquire(ctx context.Context, id string, ttl time.Duration) (uint64, error) {
+	var token uint64
+	err := l.update(func(s *fileLockState) (bool, error) {
+		now := time.Now()
+		if s.Holder != id && s.Holder != "" && now.Before(s.Expires) {
+			return false, ErrHeld
+		}
+		if s.Holder != id || !now.Before(s.Expires) {
+			s.Token++
+		}
+		s.Holder = id
+		s.Expires = now.Add(ttl)
+		token = s.Token
+		return true, nil
+	})
+	return token, err
+}
+
+func (l *FileLock) Release(ctx context.Context, id string) error {
+	return l.update(func(s *fileLockState) (bool, error) {
+		if s.Holder != id {
+			return false, nil
+		}
+		// the token is kept, so that it keeps growing
+		s.Holder = ""
+		s.Expires = time.Time{}
+		return true, nil
+	})
+}
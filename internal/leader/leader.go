@@ -0,0 +1,188 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package leader elects a single butler, among those which manage the same
+// shared destination, eg: on EFS or NFS, to copy the configuration files and
+// reload the managers at a time. The leader holds a Lock, which it renews
+// before it expires, and which passes on to another butler once the leader
+// stops renewing it. A Semaphore of several such locks lets a few butlers at a
+// time through, eg: to stagger the reloads of a fleet.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTTL is how long a leader holds the lock without renewing it.
+	DefaultTTL = 30 * time.Second
+)
+
+// ErrHeld is returned by Lock.Acquire when another holder has the lock.
+var ErrHeld = errors.New("the lock is held by another holder")
+
+// Lock is a lock which is held for a ttl, and which has to be renewed before
+// the ttl is up to be kept.
+type Lock interface {
+	// Acquire takes the lock for ttl on behalf of the id, or renews it when
+	// the id already holds it. It returns the fencing token of the hold,
+	// which grows every time the lock changes hands, or ErrHeld when
+	// another holder has the lock.
+	Acquire(ctx context.Context, id string, ttl time.Duration) (uint64, error)
+	// Release gives the lock up when the id holds it.
+	Release(ctx context.Context, id string) error
+	Name() string
+}
+
+// DefaultID returns the id of this butler among those which hold the lock,
+// its hostname and pid.
+func DefaultID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%v:%v", host, os.Getpid())
+}
+
+// NewLock returns the Lock of the method, whose options are the JSON entry.
+func NewLock(method string, entry []byte) (Lock, error) {
+	switch method {
+	case "file":
+		return NewFileLock(entry)
+	case "etcd":
+		return NewEtcdLock(entry)
+	case "consul":
+		return NewConsulLock(entry)
+	default:
+		return nil, fmt.Errorf("unknown leader method %v", method)
+	}
+}
+
+// Elector campaigns for a Lock on behalf of an id, and renews it while it
+// holds it.
+type Elector struct {
+	lock  Lock
+	id    string
+	ttl   time.Duration
+	mutex sync.Mutex
+	token uint64
+	// until is when the hold expires as far as this butler knows, which
+	// is a little before it does for the Lock
+	until time.Time
+	stop  chan bool
+	done  chan bool
+}
+
+// NewElector returns an Elector of the id for the lock, held for ttl at a
+// time, or DefaultTTL when it is 0.
+func NewElector(lock Lock, id string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if id == "" {
+		id = DefaultID()
+	}
+	return &Elector{lock: lock, id: id, ttl: ttl}
+}
+
+// ID returns the id the Elector campaigns on behalf of.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Campaign tries to take the lock, or to renew it when it is held already. It
+// returns whether this butler is the leader.
+func (e *Elector) Campaign(ctx context.Context) (bool, error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+	token, err := e.lock.Acquire(ctx, e.id, e.ttl)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	wasLeader := e.isLeader(time.Now())
+	if err != nil {
+		if wasLeader && err == ErrHeld {
+			log.Warnf("Elector::Campaign(): lost the %v lock.", e.lock.Name())
+			e.until = time.Time{}
+		}
+		if err == ErrHeld {
+			return false, nil
+		}
+		return e.isLeader(time.Now()), err
+	}
+	if !wasLeader || token != e.token {
+		log.Infof("Elector::Campaign(): became the leader with the %v lock, as %v. token=%v", e.lock.Name(), e.id, token)
+	}
+	e.token = token
+	// the hold is counted from before the lock was asked for, and is given
+	// up a little early, so that it always expires here first
+	e.until = start.Add(e.ttl * 9 / 10)
+	return true, nil
+}
+
+// Leader returns the fencing token of the hold, and whether this butler is
+// the leader.
+func (e *Elector) Leader() (uint64, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.token, e.isLeader(time.Now())
+}
+
+func (e *Elector) isLeader(now time.Time) bool {
+	return now.Before(e.until)
+}
+
+// Start campaigns for the lock right away, and then every third of the ttl,
+// until Stop is called.
+func (e *Elector) Start() {
+	e.stop = make(chan bool)
+	e.done = make(chan bool)
+	go func() {
+		defer close(e.done)
+		for {
+			if _, err := e.Campaign(context.Background()); err != nil {
+				log.Errorf("Elector::Start(): could not campaign for the %v lock. err=%v", e.lock.Name(), err.Error())
+			}
+			select {
+			case <-e.stop:
+				return
+			case <-time.After(e.ttl / 3):
+			}
+		}
+	}()
+}
+
+// Stop stops campaigning, and releases the lock when this butler holds it, so
+// that another butler can take over right away.
+func (e *Elector) Stop() error {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+	e.mutex.Lock()
+	leader := e.isLeader(time.Now())
+	e.until = time.Time{}
+	e.mutex.Unlock()
+	if !leader {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+	log.Infof("Elector::Stop(): releasing the %v lock.", e.lock.Name())
+	return e.lock.Release(ctx, e.id)
+}
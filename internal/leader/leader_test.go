@@ -0,0 +1,238 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type LeaderTestSuite struct{}
+
+var _ = Suite(&LeaderTestSuite{})
+
+func (s *LeaderTestSuite) TestNewLock(c *C) {
+	_, err := NewLock("zookeeper", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "unknown leader method zookeeper")
+	_, err = NewLock("file", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "no path defined for the file lock")
+	_, err = NewLock("etcd", []byte(`{"endpoints": ["http://127.0.0.1:2379"]}`))
+	c.Assert(err, ErrorMatches, "no key defined for the etcd lock")
+	_, err = NewLock("consul", []byte(`{"address": "ftp://consul", "key": "butler/leader"}`))
+	c.Assert(err, ErrorMatches, "invalid consul address ftp://consul")
+	l, err := NewLock("consul", []byte(`{"key": "/butler/leader/"}`))
+	c.Assert(err, IsNil)
+	c.Assert(l.(*ConsulLock).Opts.Address, Equals, DefaultConsulAddress)
+	c.Assert(l.(*ConsulLock).Opts.Key, Equals, "butler/leader")
+}
+
+func (s *LeaderTestSuite) TestFileLock(c *C) {
+	path := filepath.Join(c.MkDir(), "butler.lock")
+	l, err := NewLock("file", []byte(`{"path": "`+path+`"}`))
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+
+	token, err := l.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(1))
+	// renewing keeps the token
+	token, err = l.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(1))
+	_, err = l.Acquire(ctx, "b", time.Minute)
+	c.Assert(err, Equals, ErrHeld)
+
+	// a released lock changes hands, with a new token
+	c.Assert(l.Release(ctx, "b"), IsNil)
+	c.Assert(l.Release(ctx, "a"), IsNil)
+	token, err = l.Acquire(ctx, "b", time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(2))
+
+	// and so does an expired one
+	time.Sleep(5 * time.Millisecond)
+	token, err = l.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(3))
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(data), `"holder":"a"`), Equals, true)
+}
+
+func (s *LeaderTestSuite) TestElector(c *C) {
+	path := filepath.Join(c.MkDir(), "butler.lock")
+	l, err := NewLock("file", []byte(`{"path": "`+path+`"}`))
+	c.Assert(err, IsNil)
+	a := NewElector(l, "a", time.Minute)
+	b := NewElector(l, "b", time.Minute)
+	c.Assert(NewElector(l, "", 0).ID(), Equals, DefaultID())
+
+	a.Start()
+	leader := false
+	for i := 0; i < 50 && !leader; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, leader = a.Leader()
+	}
+	c.Assert(leader, Equals, true)
+
+	ok, err := b.Campaign(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+	_, leader = b.Leader()
+	c.Assert(leader, Equals, false)
+
+	// the leader which stops hands over right away
+	c.Assert(a.Stop(), IsNil)
+	_, leader = a.Leader()
+	c.Assert(leader, Equals, false)
+	ok, err = b.Campaign(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	token, leader := b.Leader()
+	c.Assert(leader, Equals, true)
+	c.Assert(token, Equals, uint64(2))
+}
+
+// consulServer fakes the sessions and the locks of the consul HTTP API.
+type consulServer struct {
+	sync.Mutex
+	sessions  map[string]bool
+	holder    string
+	lockIndex uint64
+	next      int
+	token     string
+}
+
+func (cs *consulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.token = r.Header.Get("X-Consul-Token")
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		cs.next++
+		id := string(rune('a' + cs.next))
+		cs.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		if !cs.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		delete(cs.sessions, strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+	case r.URL.Path == "/v1/kv/butler/leader" && r.Method == "GET":
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"LockIndex": cs.lockIndex, "Session": cs.holder}})
+	case r.URL.Path == "/v1/kv/butler/leader" && r.URL.Query().Get("acquire") != "":
+		session := r.URL.Query().Get("acquire")
+		if cs.holder != "" && cs.holder != session {
+			w.Write([]byte("false"))
+			return
+		}
+		if cs.holder != session {
+			cs.lockIndex++
+		}
+		cs.holder = session
+		w.Write([]byte("true"))
+	case r.URL.Path == "/v1/kv/butler/leader" && r.URL.Query().Get("release") != "":
+		if cs.holder == r.URL.Query().Get("release") {
+			cs.holder = ""
+		}
+		w.Write([]byte("true"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *LeaderTestSuite) TestConsulLock(c *C) {
+	cs := &consulServer{sessions: make(map[string]bool)}
+	ts := httptest.NewServer(cs)
+	defer ts.Close()
+	entry := []byte(`{"address": "` + ts.URL + `", "key": "butler/leader", "token": "acl"}`)
+	a, err := NewLock("consul", entry)
+	c.Assert(err, IsNil)
+	b, err := NewLock("consul", entry)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+
+	token, err := a.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(1))
+	c.Assert(cs.token, Equals, "acl")
+	token, err = a.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(1))
+	_, err = b.Acquire(ctx, "b", time.Minute)
+	c.Assert(err, Equals, ErrHeld)
+
+	// an expired session is replaced
+	cs.Lock()
+	cs.sessions = make(map[string]bool)
+	cs.holder = ""
+	cs.Unlock()
+	token, err = a.Acquire(ctx, "a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(2))
+
+	c.Assert(a.Release(ctx, "a"), IsNil)
+	token, err = b.Acquire(ctx, "b", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, uint64(3))
+}
+
+func (s *LeaderTestSuite) TestSemaphore(c *C) {
+	path := filepath.Join(c.MkDir(), "rollout.lock")
+	entry := []byte(`{"path": "` + path + `"}`)
+	poll := SemaphorePoll
+	SemaphorePoll = 10 * time.Millisecond
+	defer func() { SemaphorePoll = poll }()
+
+	_, err := NewSemaphore("file", entry, "prometheus", 0, "a", time.Minute)
+	c.Assert(err, ErrorMatches, "invalid semaphore size 0")
+	_, err = NewSemaphore("etcd", []byte(`{}`), "prometheus", 1, "a", time.Minute)
+	c.Assert(err, ErrorMatches, "no key defined for the etcd lock")
+
+	newSemaphore := func(id string) *Semaphore {
+		sem, err := NewSemaphore("file", entry, "prometheus", 2, id, time.Minute)
+		c.Assert(err, IsNil)
+		return sem
+	}
+	a, err := newSemaphore("a").Acquire(context.Background())
+	c.Assert(err, IsNil)
+	b, err := newSemaphore("b").Acquire(context.Background())
+	c.Assert(err, IsNil)
+	_, err = ioutil.ReadFile(path + ".prometheus.1")
+	c.Assert(err, IsNil)
+
+	// both slots are held, until one is released
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = newSemaphore("c").Acquire(ctx)
+	c.Assert(err, ErrorMatches, "no free slot")
+	c.Assert(a.Release(context.Background()), IsNil)
+	h, err := newSemaphore("c").Acquire(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(h.Release(context.Background()), IsNil)
+	c.Assert(b.Release(context.Background()), IsNil)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SemaphorePoll is how long Semaphore.Acquire waits before it tries the slots
+// again when they are all held.
+var SemaphorePoll = 5 * time.Second
+
+// Semaphore is a set of slots, each of which is a Lock, so that at most as
+// many butlers as there are slots hold one at a time, eg: to reload at most
+// max-unavailable hosts of a fleet at a time.
+type Semaphore struct {
+	slots []Lock
+	id    string
+	ttl   time.Duration
+}
+
+// Hold is a slot of a Semaphore, which is renewed in the background until it
+// is released.
+type Hold struct {
+	lock Lock
+	id   string
+	stop chan bool
+	done chan bool
+}
+
+// NewSemaphore returns the Semaphore of size slots of the method, whose
+// options are the JSON entry, for the name, held by id for ttl at a time. The
+// slots are the key of the lock, or the path of a file lock, suffixed with the
+// name and the number of the slot.
+func NewSemaphore(method string, entry []byte, name string, size int, id string, ttl time.Duration) (*Semaphore, error) {
+	var opts map[string]interface{}
+
+	if size < 1 {
+		return nil, fmt.Errorf("invalid semaphore size %v", size)
+	}
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = make(map[string]interface{})
+	}
+	key, format := "key", "%v/%v/%v"
+	if method == "file" {
+		key, format = "path", "%v.%v.%v"
+	}
+	base := strings.TrimSuffix(environment.GetVar(fmt.Sprintf("%v", opts[key])), "/")
+	if opts[key] == nil || base == "" {
+		return nil, fmt.Errorf("no %v defined for the %v lock", key, method)
+	}
+
+	s := &Semaphore{id: id, ttl: ttl}
+	if s.ttl <= 0 {
+		s.ttl = DefaultTTL
+	}
+	if s.id == "" {
+		s.id = DefaultID()
+	}
+	for i := 0; i < size; i++ {
+		opts[key] = fmt.Sprintf(format, base, name, i)
+		slot, err := json.Marshal(opts)
+		if err != nil {
+			return nil, err
+		}
+		lock, err := NewLock(method, slot)
+		if err != nil {
+			return nil, err
+		}
+		s.slots = append(s.slots, lock)
+	}
+	return s, nil
+}
+
+// Acquire takes the first free slot, starting from a random one so that the
+// butlers do not all go for the same slot, and waits for one to free up until
+// ctx is done.
+func (s *Semaphore) Acquire(ctx context.Context) (*Hold, error) {
+	var lastErr error
+	for {
+		start := rand.Intn(len(s.slots))
+		for i := range s.slots {
+			lock := s.slots[(start+i)%len(s.slots)]
+			if _, err := lock.Acquire(ctx, s.id, s.ttl); err != nil {
+				if err != ErrHeld {
+					lastErr = err
+				}
+				continue
+			}
+			h := &Hold{lock: lock, id: s.id, stop: make(chan bool), done: make(chan bool)}
+			go h.renew(s.ttl)
+			return h, nil
+		}
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return nil, fmt.Errorf("no free slot, err=%v", lastErr.Error())
+			}
+			return nil, errors.New("no free slot")
+		case <-time.After(SemaphorePoll):
+		}
+	}
+}
+
+func (h *Hold) renew(ttl time.Duration) {
+	defer close(h.done)
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(ttl / 3):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+		if _, err := h.lock.Acquire(ctx, h.id, ttl); err != nil {
+			log.Errorf("Hold::renew(): could not renew the %v slot. err=%v", h.lock.Name(), err.Error())
+		}
+		cancel()
+	}
+}
+
+// Release stops renewing the slot, and gives it up.
+func (h *Hold) Release(ctx context.Context) error {
+	close(h.stop)
+	<-h.done
+	return h.lock.Release(ctx, h.id)
+}
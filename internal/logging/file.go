@@ -0,0 +1,164 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedFormat is the time format of the suffix of the rotated log files.
+const rotatedFormat = "20060102T150405"
+
+// RotatingFile is a log file which is rotated once it is larger than its max
+// size, or older than its max age. A rotated file is renamed after the time
+// of its rotation, eg: butler.log.20180905T130211, and only the latest max
+// backups of them are kept.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	now    func() time.Time
+}
+
+// OpenRotatingFile opens the log file at the path, which is appended to when
+// it exists. A maxSize, in bytes, maxAge, or maxBackups of 0 is no limit.
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes the line to the log file, once it has been rotated when
+// needed. A failed rotation keeps writing to the current file.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && ((f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize) || (f.maxAge > 0 && f.now().Sub(f.opened) >= f.maxAge)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not rotate the log file %v. err=%v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	rotated := f.path + "." + f.now().Format(rotatedFormat)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%v.%v.%d", f.path, f.now().Format(rotatedFormat), i)
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	f.file.Close()
+	if err := f.open(); err != nil {
+		// keep on writing to the rotated file rather than losing the logs
+		file, ferr := os.OpenFile(rotated, os.O_WRONLY|os.O_APPEND, 0644)
+		if ferr == nil {
+			f.file = file
+		}
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune removes the oldest of the rotated files, beyond the max backups.
+func (f *RotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	rotated, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, r := range rotated {
+		if isRotated(r, f.path) {
+			backups = append(backups, r)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// isRotated tells whether the file is a rotated log file of the path, eg:
+// butler.log.20180905T130211, or butler.log.20180905T130211.1 when several
+// were rotated within the same second.
+func isRotated(file, path string) bool {
+	suffix := strings.TrimPrefix(file, path+".")
+	if i := strings.Index(suffix, "."); i >= 0 {
+		suffix = suffix[:i]
+	}
+	_, err := time.Parse(rotatedFormat, suffix)
+	return err == nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package logging sets up the butler logs: their format, the log level of
+// each of the components of butler, the run id which correlates the log
+// lines of a configuration management run, and where they go besides stderr. It formats the lines logged
+// through the standard logrus logger, so that the packages of butler keep
+// logging the way they do.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adobe/butler/internal/redact"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The formats of the logs.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// The components of butler whose log level can be set on their own.
+const (
+	ComponentConfig    = "config"
+	ComponentMethods   = "methods"
+	ComponentReloaders = "reloaders"
+	ComponentMetrics   = "metrics"
+)
+
+// componentPackages are the packages of each of the components.
+var componentPackages = map[string]string{
+	"github.com/adobe/butler/pkg/config":       ComponentConfig,
+	"github.com/adobe/butler/pkg/methods":      ComponentMethods,
+	"github.com/adobe/butler/pkg/reloaders":    ComponentReloaders,
+	"github.com/adobe/butler/internal/metrics": ComponentMetrics,
+}
+
+var (
+	settingsMutex sync.RWMutex
+	// format and level are the ones of Init, which apply unless Update
+	// overrides them.
+	format = FormatText
+	level  log.Level
+	// installed is whether the standard logger has been set up, either by
+	// Init or by an Update with settings of its own. Until then, the
+	// standard logger is left as is, eg: for the programs embedding butler.
+	installed bool
+	// currentFormat and levels are the ones of Update.
+	currentFormat string
+	levels        map[string]log.Level
+	runID         string
+)
+
+// Components returns the components whose log level can be set on their own.
+func Components() []string {
+	var res []string
+	for _, c := range componentPackages {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Init logs in the format, text or json, at the level, the one of the
+// components which have no log level of their own.
+func Init(f string, l log.Level) error {
+	if err := checkFormat(f); err != nil {
+		return err
+	}
+	settingsMutex.Lock()
+	format, level, installed = f, l, true
+	settingsMutex.Unlock()
+	apply()
+	return nil
+}
+
+// Update overrides the format of Init, when f is not empty, and sets the log
+// levels of the components, eg: from the butler configuration.
+func Update(f string, l map[string]log.Level) error {
+	if f != "" {
+		if err := checkFormat(f); err != nil {
+			return err
+		}
+	}
+	settingsMutex.Lock()
+	currentFormat, levels = f, l
+	if !installed && (f != "" || len(l) > 0) {
+		level, installed = log.GetLevel(), true
+	}
+	install := installed
+	settingsMutex.Unlock()
+	if install {
+		apply()
+	}
+	return nil
+}
+
+// apply sets up the standard logger, at the most verbose of the log levels,
+// as the lines of the components logged at another level are dropped by the
+// formatter.
+func apply() {
+	settingsMutex.RLock()
+	max := level
+	for _, l := range levels {
+		if l > max {
+			max = l
+		}
+	}
+	settingsMutex.RUnlock()
+	log.SetLevel(max)
+	log.SetFormatter(&formatter{
+		text: &log.TextFormatter{FullTimestamp: true},
+		json: &log.JSONFormatter{},
+	})
+}
+
+// ParseLevels parses the log levels of the components, by component.
+func ParseLevels(l map[string]string) (map[string]log.Level, error) {
+	res := make(map[string]log.Level)
+	for c, v := range l {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !isComponent(c) {
+			return nil, fmt.Errorf("unknown log component %v, it must be one of %v", c, strings.Join(Components(), ", "))
+		}
+		lvl, err := log.ParseLevel(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %v of the %v component", v, c)
+		}
+		res[c] = lvl
+	}
+	return res, nil
+}
+
+// SetRunID sets the run id which the lines logged from then on carry, until
+// it is set to "".
+func SetRunID(id string) {
+	settingsMutex.Lock()
+	runID = id
+	settingsMutex.Unlock()
+}
+
+// NewRunID returns a random run id.
+func NewRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func checkFormat(f string) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unknown log format %v, it must be %v or %v", f, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+func isComponent(c string) bool {
+	for _, v := range componentPackages {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// formatter drops the lines of the components which are below their log
+// level, and formats the others, along with their component and run id.
+type formatter struct {
+	text log.Formatter
+	json log.Formatter
+}
+
+func (f *formatter) Format(e *log.Entry) ([]byte, error) {
+	entry, json, ok := prepare(e)
+	if !ok {
+		return nil, nil
+	}
+	if json {
+		return f.json.Format(entry)
+	}
+	return f.text.Format(entry)
+}
+
+// prepare returns a copy of the entry, with its secrets masked, along with
+// its component and run id, whether it is to be formatted in json, and
+// whether it is to be logged at all, which it is not when its component logs
+// at a lower level.
+func prepare(e *log.Entry) (*log.Entry, bool, bool) {
+	component := callerComponent()
+
+	settingsMutex.RLock()
+	lvl, ok := levels[component]
+	if !ok {
+		lvl = level
+	}
+	json := currentFormat == FormatJSON || (currentFormat == "" && format == FormatJSON)
+	id := runID
+	settingsMutex.RUnlock()
+
+	if e.Level > lvl {
+		return nil, false, false
+	}
+
+	// the fields of the entry may be shared with other entries
+	entry := *e
+	entry.Message = redact.String(e.Message)
+	entry.Data = make(log.Fields, len(e.Data)+2)
+	for k, v := range e.Data {
+		if s, ok := v.(string); ok {
+			v = redact.String(s)
+		}
+		entry.Data[k] = v
+	}
+	if component != "" {
+		entry.Data["component"] = component
+	}
+	if id != "" {
+		entry.Data["run_id"] = id
+	}
+	return &entry, json, true
+}
+
+// callerComponent returns the component of the caller of logrus, or "" when
+// it is not one of the components.
+func callerComponent() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	inLogrus := false
+	for {
+		frame, more := frames.Next()
+		if strings.Contains(frame.Function, "sirupsen/logrus.") {
+			inLogrus = true
+		} else if inLogrus {
+			return packageComponent(frame.Function)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// packageComponent returns the component of the function, eg:
+// github.com/adobe/butler/pkg/config.(*ButlerConfig).Handler.
+func packageComponent(function string) string {
+	pkg := function
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		if j := strings.Index(pkg[i:], "."); j >= 0 {
+			pkg = pkg[:i+j]
+		}
+	}
+	return componentPackages[pkg]
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SyslogLocal sends the logs to the local syslog daemon, or journald.
+const SyslogLocal = "local"
+
+// syslogTag is the tag of the lines sent to syslog.
+const syslogTag = "butler"
+
+// OutputOpts say where the logs go besides stderr.
+type OutputOpts struct {
+	// File is the path of a log file, see RotatingFile.
+	File string
+	// FileMaxSize is the size, in bytes, past which the log file is
+	// rotated.
+	FileMaxSize int64
+	// FileMaxAge is the age past which the log file is rotated.
+	FileMaxAge time.Duration
+	// FileMaxBackups is the number of rotated log files which are kept.
+	FileMaxBackups int
+	// Syslog is local, for the local syslog daemon or journald, or the URL
+	// of a remote syslog daemon, eg: udp://syslog:514 or tcp://syslog:514.
+	Syslog string
+}
+
+var (
+	outputMutex sync.Mutex
+	outputs     OutputOpts
+	outputFile  *RotatingFile
+	syslogOut   = &syslogHook{}
+	hookAdded   bool
+)
+
+// SetOutputs sends the logs to the outputs, besides stderr. The outputs are
+// only reopened when they changed. When an output cannot be opened, the logs
+// keep going where they went.
+func SetOutputs(o OutputOpts) error {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if reflect.DeepEqual(o, outputs) {
+		return nil
+	}
+
+	var (
+		file   *RotatingFile
+		writer syslogWriter
+		err    error
+	)
+	if o.File != "" {
+		file, err = OpenRotatingFile(o.File, o.FileMaxSize, o.FileMaxAge, o.FileMaxBackups)
+		if err != nil {
+			return fmt.Errorf("could not open the log file %v. err=%v", o.File, err.Error())
+		}
+	}
+	if o.Syslog != "" {
+		writer, err = dialSyslog(o.Syslog)
+		if err != nil {
+			if file != nil {
+				file.Close()
+			}
+			return fmt.Errorf("could not connect to syslog %v. err=%v", o.Syslog, err.Error())
+		}
+	}
+
+	if file != nil {
+		log.SetOutput(io.MultiWriter(os.Stderr, file))
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+	if outputFile != nil {
+		outputFile.Close()
+	}
+	outputFile = file
+
+	if writer != nil && !hookAdded {
+		log.AddHook(syslogOut)
+		hookAdded = true
+	}
+	syslogOut.set(writer)
+	outputs = o
+	return nil
+}
+
+// CheckSyslog checks that the syslog output is local, or the URL of a remote
+// syslog daemon.
+func CheckSyslog(s string) error {
+	_, err := syslogURL(s)
+	return err
+}
+
+func syslogURL(s string) (*url.URL, error) {
+	if s == SyslogLocal {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("%v must be %v, or in the form of udp://host:port or tcp://host:port", s, SyslogLocal)
+	}
+	return u, nil
+}
+
+// syslogWriter writes the lines to syslog, at their severity.
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Crit(m string) error
+	Emerg(m string) error
+	Close() error
+}
+
+// syslogHook sends the lines which are logged to syslog, at their severity.
+type syslogHook struct {
+	mutex  sync.Mutex
+	writer syslogWriter
+	text   log.Formatter
+	json   log.Formatter
+}
+
+func (h *syslogHook) set(w syslogWriter) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.writer != nil {
+		h.writer.Close()
+	}
+	h.writer = w
+	// syslog has timestamps of its own
+	h.text = &log.TextFormatter{DisableTimestamp: true, DisableColors: true}
+	h.json = &log.JSONFormatter{DisableTimestamp: true}
+}
+
+func (h *syslogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *syslogHook) Fire(e *log.Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.writer == nil {
+		return nil
+	}
+	entry, json, ok := prepare(e)
+	if !ok {
+		return nil
+	}
+	fmtr := h.text
+	if json {
+		fmtr = h.json
+	}
+	line, err := fmtr.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	msg := string(line)
+	switch e.Level {
+	case log.DebugLevel:
+		return h.writer.Debug(msg)
+	case log.InfoLevel:
+		return h.writer.Info(msg)
+	case log.WarnLevel:
+		return h.writer.Warning(msg)
+	case log.ErrorLevel:
+		return h.writer.Err(msg)
+	case log.FatalLevel:
+		return h.writer.Crit(msg)
+	default:
+		return h.writer.Emerg(msg)
+	}
+}
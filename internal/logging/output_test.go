@@ -0,0 +1,156 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package logging
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+type OutputTestSuite struct {
+	dir string
+}
+
+var _ = Suite(&OutputTestSuite{})
+
+func (s *OutputTestSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+func (s *OutputTestSuite) TearDownTest(c *C) {
+	c.Assert(SetOutputs(OutputOpts{}), IsNil)
+}
+
+func (s *OutputTestSuite) files(c *C) []string {
+	infos, err := ioutil.ReadDir(s.dir)
+	c.Assert(err, IsNil)
+	var res []string
+	for _, i := range infos {
+		res = append(res, i.Name())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *OutputTestSuite) TestRotateOnSize(c *C) {
+	path := filepath.Join(s.dir, "logs", "butler.log")
+	f, err := OpenRotatingFile(path, 10, 0, 2)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	now := time.Date(2018, 9, 5, 13, 2, 11, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		c.Assert(err, IsNil)
+		now = now.Add(time.Second)
+	}
+
+	// the first of the rotated files is pruned
+	s.dir = filepath.Dir(path)
+	c.Assert(s.files(c), DeepEquals, []string{"butler.log", "butler.log.20180905T130213", "butler.log.20180905T130214"})
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "fourth\n")
+	data, err = ioutil.ReadFile(path + ".20180905T130214")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "third\n")
+}
+
+func (s *OutputTestSuite) TestRotateOnAge(c *C) {
+	path := filepath.Join(s.dir, "butler.log")
+	c.Assert(ioutil.WriteFile(path, []byte("before\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(path+".old", []byte("not rotated by butler\n"), 0644), IsNil)
+
+	f, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	// the existing file is appended to
+	f.Write([]byte("first\n"))
+	now = now.Add(time.Hour)
+	f.Write([]byte("second\n"))
+	f.Write([]byte("third\n"))
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(s.files(c), DeepEquals, []string{"butler.log", "butler.log." + now.Format(rotatedFormat), "butler.log.old"})
+	data, err := ioutil.ReadFile(path + "." + now.Format(rotatedFormat))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "before\nfirst\n")
+	data, err = ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "second\nthird\n")
+}
+
+func (s *OutputTestSuite) TestRotateWithinASecond(c *C) {
+	path := filepath.Join(s.dir, "butler.log")
+	f, err := OpenRotatingFile(path, 1, 0, 0)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	now := time.Date(2018, 9, 5, 13, 2, 11, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	f.Write([]byte("1\n"))
+	f.Write([]byte("2\n"))
+	f.Write([]byte("3\n"))
+	c.Assert(s.files(c), DeepEquals, []string{"butler.log", "butler.log.20180905T130211", "butler.log.20180905T130211.1"})
+	c.Assert(isRotated(path+".20180905T130211.1", path), Equals, true)
+	c.Assert(isRotated(path+".old", path), Equals, false)
+}
+
+func (s *OutputTestSuite) TestSetOutputsFile(c *C) {
+	path := filepath.Join(s.dir, "butler.log")
+	c.Assert(SetOutputs(OutputOpts{File: path}), IsNil)
+	log.Warn("to the log file")
+	c.Assert(SetOutputs(OutputOpts{}), IsNil)
+	log.Warn("not to the log file")
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*msg="to the log file".*`)
+	c.Assert(strings.Contains(string(data), "not to the log file"), Equals, false)
+
+	// the current outputs are kept when the new ones cannot be opened
+	c.Assert(SetOutputs(OutputOpts{File: path}), IsNil)
+	c.Assert(SetOutputs(OutputOpts{File: "/proc/butler/butler.log"}), ErrorMatches, "could not open the log file /proc/butler/butler.log.*")
+	c.Assert(SetOutputs(OutputOpts{File: path, Syslog: "ftp://syslog"}), ErrorMatches, "could not connect to syslog ftp://syslog.*")
+	log.Warn("still to the log file")
+	data, err = ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*msg="still to the log file".*`)
+}
+
+func (s *OutputTestSuite) TestSetOutputsSyslog(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	c.Assert(SetOutputs(OutputOpts{Syslog: "udp://" + conn.LocalAddr().String()}), IsNil)
+	log.WithField("manager", "prometheus").Error("reload failed")
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	// <daemon|err>, and no timestamp of its own
+	c.Assert(string(buf[:n]), Matches, `<27>.* butler\[[0-9]+\]: level=error msg="reload failed" manager=prometheus\n`)
+}
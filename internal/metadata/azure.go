@@ -0,0 +1,109 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// AzureEndpoint is the instance metadata service of Azure.
+	AzureEndpoint = "http://169.254.169.254"
+
+	azureAPIVersion = "2021-02-01"
+)
+
+// azureCompute is the part of the Azure instance metadata butler uses.
+type azureCompute struct {
+	VMID     string `json:"vmId"`
+	Location string `json:"location"`
+	Zone     string `json:"zone"`
+	TagsList []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"tagsList"`
+}
+
+// Azure looks up the metadata of an Azure virtual machine. The availability
+// zone is empty for the virtual machines which are not in one.
+type Azure struct {
+	endpoint string
+	client   *http.Client
+
+	mutex   sync.Mutex
+	compute *azureCompute
+}
+
+// NewAzure returns an Azure which talks to the instance metadata service at
+// the endpoint, usually AzureEndpoint.
+func NewAzure(endpoint string) *Azure {
+	return &Azure{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   &http.Client{Timeout: Timeout},
+	}
+}
+
+func (a *Azure) Name() string {
+	return "azure"
+}
+
+func (a *Azure) Get(key string) (string, error) {
+	compute, err := a.getCompute()
+	if err != nil {
+		return "", fmt.Errorf("could not get azure instance metadata %v. err=%v", key, err.Error())
+	}
+	switch {
+	case key == "instance-id":
+		return compute.VMID, nil
+	case key == "region":
+		return compute.Location, nil
+	case key == "availability-zone":
+		return compute.Zone, nil
+	case strings.HasPrefix(key, "tags.") && len(key) > len("tags."):
+		for _, t := range compute.TagsList {
+			if t.Name == key[len("tags."):] {
+				return t.Value, nil
+			}
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown azure instance metadata %v", key)
+}
+
+// getCompute returns the compute metadata of the virtual machine, which is
+// requested once.
+func (a *Azure) getCompute() (*azureCompute, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.compute != nil {
+		return a.compute, nil
+	}
+	body, found, err := fetch(a.client, "GET", fmt.Sprintf("%s/metadata/instance/compute?api-version=%s&format=json", a.endpoint, azureAPIVersion), map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("no compute metadata")
+	}
+	var compute azureCompute
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, err
+	}
+	a.compute = &compute
+	return a.compute, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EC2Endpoint is the instance metadata service of EC2.
+	EC2Endpoint = "http://169.254.169.254"
+
+	// ec2TokenTTL is how long the IMDSv2 tokens are asked for.
+	ec2TokenTTL = 6 * time.Hour
+)
+
+// ec2Paths maps the keys to their paths under meta-data.
+var ec2Paths = map[string]string{
+	"instance-id":       "instance-id",
+	"region":            "placement/region",
+	"availability-zone": "placement/availability-zone",
+}
+
+// EC2 looks up the metadata of an EC2 instance. It uses IMDSv2, and falls
+// back to IMDSv1 when no token can be had. The tags are only available when
+// the instance allows the tags in its instance metadata.
+type EC2 struct {
+	endpoint string
+	client   *http.Client
+	cache    cache
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewEC2 returns an EC2 which talks to the instance metadata service at the
+// endpoint, usually EC2Endpoint.
+func NewEC2(endpoint string) *EC2 {
+	return &EC2{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   &http.Client{Timeout: Timeout},
+	}
+}
+
+func (e *EC2) Name() string {
+	return "ec2"
+}
+
+func (e *EC2) Get(key string) (string, error) {
+	return e.cache.get(key, e.lookup)
+}
+
+func (e *EC2) lookup(key string) (string, error) {
+	path, ok := ec2Paths[key]
+	tag := strings.HasPrefix(key, "tags.") && len(key) > len("tags.")
+	if tag {
+		path = fmt.Sprintf("tags/instance/%s", key[len("tags."):])
+	} else if !ok {
+		return "", fmt.Errorf("unknown ec2 instance metadata %v", key)
+	}
+
+	headers := make(map[string]string)
+	if token := e.getToken(); token != "" {
+		headers["X-aws-ec2-metadata-token"] = token
+	}
+	body, found, err := fetch(e.client, "GET", fmt.Sprintf("%s/latest/meta-data/%s", e.endpoint, path), headers)
+	if err != nil {
+		return "", fmt.Errorf("could not get ec2 instance metadata %v. err=%v", key, err.Error())
+	}
+	if !found && !tag {
+		return "", fmt.Errorf("no ec2 instance metadata %v", key)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// getToken returns an IMDSv2 token, or an empty one when none can be had.
+func (e *EC2) getToken() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.token != "" && time.Now().Before(e.expires) {
+		return e.token
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": fmt.Sprintf("%d", int(ec2TokenTTL.Seconds()))}
+	body, found, err := fetch(e.client, "PUT", fmt.Sprintf("%s/latest/api/token", e.endpoint), headers)
+	if err != nil || !found {
+		return ""
+	}
+	e.token = string(body)
+	// renewed a minute before it expires
+	e.expires = time.Now().Add(ec2TokenTTL - time.Minute)
+	return e.token
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// GCEEndpoint is the instance metadata service of GCE.
+	GCEEndpoint = "http://metadata.google.internal"
+)
+
+// GCE looks up the metadata of a GCE instance. Its tags are the custom
+// metadata attributes of the instance, since the labels of an instance are
+// not in its metadata.
+type GCE struct {
+	endpoint string
+	client   *http.Client
+	cache    cache
+}
+
+// NewGCE returns a GCE which talks to the instance metadata service at the
+// endpoint, usually GCEEndpoint.
+func NewGCE(endpoint string) *GCE {
+	return &GCE{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   &http.Client{Timeout: Timeout},
+	}
+}
+
+func (g *GCE) Name() string {
+	return "gce"
+}
+
+func (g *GCE) Get(key string) (string, error) {
+	return g.cache.get(key, g.lookup)
+}
+
+func (g *GCE) lookup(key string) (string, error) {
+	var path string
+	tag := strings.HasPrefix(key, "tags.") && len(key) > len("tags.")
+	switch {
+	case tag:
+		path = fmt.Sprintf("instance/attributes/%s", key[len("tags."):])
+	case key == "instance-id":
+		path = "instance/id"
+	case key == "region", key == "availability-zone":
+		// projects/<number>/zones/<zone>, the region being the zone
+		// without its last dash, eg: us-central1 for us-central1-a
+		zone, err := g.get("instance/zone", false)
+		if err != nil {
+			return "", fmt.Errorf("could not get gce instance metadata %v. err=%v", key, err.Error())
+		}
+		zone = zone[strings.LastIndex(zone, "/")+1:]
+		if key == "region" {
+			if i := strings.LastIndex(zone, "-"); i > 0 {
+				return zone[:i], nil
+			}
+		}
+		return zone, nil
+	default:
+		return "", fmt.Errorf("unknown gce instance metadata %v", key)
+	}
+
+	value, err := g.get(path, tag)
+	if err != nil {
+		return "", fmt.Errorf("could not get gce instance metadata %v. err=%v", key, err.Error())
+	}
+	return value, nil
+}
+
+// get returns the value at the path of the metadata, or an empty one when
+// optional and not found.
+func (g *GCE) get(path string, optional bool) (string, error) {
+	body, found, err := fetch(g.client, "GET", fmt.Sprintf("%s/computeMetadata/v1/%s", g.endpoint, path), map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return "", err
+	}
+	if !found && !optional {
+		return "", fmt.Errorf("%v not found", path)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
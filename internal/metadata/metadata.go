@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package metadata looks up the metadata of the cloud instance butler runs
+// on, eg: its instance id, region, availability zone and tags, from the
+// instance metadata service of EC2, GCE or Azure.
+package metadata
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Timeout is the timeout of the requests to the instance metadata
+	// service.
+	Timeout = 5 * time.Second
+)
+
+// Provider looks up the metadata of the instance. The keys are
+// "instance-id", "region", "availability-zone" and "tags.<name>". A tag
+// which the instance does not have is empty.
+type Provider interface {
+	Get(key string) (string, error)
+	Name() string
+}
+
+// Clouds are the clouds New knows of.
+var Clouds = []string{"ec2", "gce", "azure"}
+
+// New returns the Provider of the cloud, one of Clouds, which talks to its
+// instance metadata service.
+func New(cloud string) (Provider, error) {
+	switch cloud {
+	case "ec2":
+		return NewEC2(EC2Endpoint), nil
+	case "gce":
+		return NewGCE(GCEEndpoint), nil
+	case "azure":
+		return NewAzure(AzureEndpoint), nil
+	default:
+		return nil, fmt.Errorf("unknown instance metadata cloud %v, expected one of %v", cloud, strings.Join(Clouds, ", "))
+	}
+}
+
+// Placeholder is a Provider which returns the keys themselves, for the
+// configurations which are checked away from the instances.
+type Placeholder struct{}
+
+func (Placeholder) Get(key string) (string, error) {
+	return key, nil
+}
+
+func (Placeholder) Name() string {
+	return "placeholder"
+}
+
+// cache keeps the values which have been looked up, since the metadata of
+// an instance hardly ever changes.
+type cache struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+// get returns the value of the key, looking it up with fn the first time.
+func (c *cache) get(key string, fn func(string) (string, error)) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if v, ok := c.values[key]; ok {
+		return v, nil
+	}
+	v, err := fn(key)
+	if err != nil {
+		return "", err
+	}
+	if c.values == nil {
+		c.values = make(map[string]string)
+	}
+	c.values[key] = v
+	return v, nil
+}
+
+// fetch gets the URL with the headers. It returns found false, and no
+// error, when the URL is not found.
+func fetch(client *http.Client, method string, url string, headers map[string]string) (body []byte, found bool, err error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, false, fmt.Errorf("http_code=%d", resp.StatusCode)
+	}
+	return body, true, nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MetadataTestSuite struct {
+}
+
+var _ = Suite(&MetadataTestSuite{})
+
+func (s *MetadataTestSuite) TestNew(c *C) {
+	for _, cloud := range Clouds {
+		p, err := New(cloud)
+		c.Assert(err, IsNil)
+		c.Assert(p.Name(), Equals, cloud)
+	}
+	_, err := New("openstack")
+	c.Assert(err, ErrorMatches, "unknown instance metadata cloud openstack.*")
+}
+
+func (s *MetadataTestSuite) TestEC2(c *C) {
+	var (
+		tokens   int
+		requests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/latest/api/token" {
+			tokens++
+			w.Write([]byte("imds-token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests++
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-0123456789"))
+		case "/latest/meta-data/placement/region":
+			w.Write([]byte("us-east-1"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		case "/latest/meta-data/tags/instance/Team":
+			w.Write([]byte("observability"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	e := NewEC2(server.URL)
+	for key, value := range map[string]string{"instance-id": "i-0123456789", "region": "us-east-1", "availability-zone": "us-east-1a", "tags.Team": "observability", "tags.Missing": ""} {
+		v, err := e.Get(key)
+		c.Assert(err, IsNil, Commentf("key %v", key))
+		c.Assert(v, Equals, value, Commentf("key %v", key))
+	}
+	// the values and the token are kept
+	_, err := e.Get("region")
+	c.Assert(err, IsNil)
+	c.Assert(requests, Equals, 5)
+	c.Assert(tokens, Equals, 1)
+
+	_, err = e.Get("hostname")
+	c.Assert(err, ErrorMatches, "unknown ec2 instance metadata hostname")
+
+	server.Close()
+	_, err = NewEC2(server.URL).Get("instance-id")
+	c.Assert(err, ErrorMatches, "could not get ec2 instance metadata instance-id.*")
+}
+
+func (s *MetadataTestSuite) TestGCE(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("4567"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/1234/zones/us-central1-a"))
+		case "/computeMetadata/v1/instance/attributes/team":
+			w.Write([]byte("observability"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	g := NewGCE(server.URL)
+	for key, value := range map[string]string{"instance-id": "4567", "region": "us-central1", "availability-zone": "us-central1-a", "tags.team": "observability", "tags.missing": ""} {
+		v, err := g.Get(key)
+		c.Assert(err, IsNil, Commentf("key %v", key))
+		c.Assert(v, Equals, value, Commentf("key %v", key))
+	}
+	_, err := g.Get("tags.")
+	c.Assert(err, ErrorMatches, "unknown gce instance metadata tags.")
+}
+
+func (s *MetadataTestSuite) TestAzure(c *C) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance/compute" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests++
+		w.Write([]byte(`{"vmId": "02aab8a4", "location": "westeurope", "zone": "2", "tagsList": [{"name": "team", "value": "observability"}]}`))
+	}))
+	defer server.Close()
+
+	a := NewAzure(server.URL)
+	for key, value := range map[string]string{"instance-id": "02aab8a4", "region": "westeurope", "availability-zone": "2", "tags.team": "observability", "tags.missing": ""} {
+		v, err := a.Get(key)
+		c.Assert(err, IsNil, Commentf("key %v", key))
+		c.Assert(v, Equals, value, Commentf("key %v", key))
+	}
+	c.Assert(requests, Equals, 1)
+	_, err := a.Get("hostname")
+	c.Assert(err, ErrorMatches, "unknown azure instance metadata hostname")
+}
@@ -14,6 +14,8 @@ package metrics
 
 import (
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	//log "github.com/sirupsen/logrus"
@@ -32,13 +34,28 @@ const (
 
 // Prometheus metrics
 var (
+	butlerBlackout          *prometheus.GaugeVec
+	butlerCleanCount        *prometheus.GaugeVec
 	butlerConfigValid       *prometheus.GaugeVec
 	butlerContactRetry      *prometheus.GaugeVec
 	butlerContactRetryTime  *prometheus.GaugeVec
 	butlerContactSuccess    *prometheus.GaugeVec
+	butlerConfigBootstrap   *prometheus.GaugeVec
+	butlerReportSuccess     *prometheus.GaugeVec
+	butlerReportTime        *prometheus.GaugeVec
+	butlerLeader            *prometheus.GaugeVec
 	butlerContactTime       *prometheus.GaugeVec
+	butlerEventSuccess      *prometheus.GaugeVec
+	butlerHealthCheck       *prometheus.GaugeVec
 	butlerKnownGoodCached   *prometheus.GaugeVec
 	butlerKnownGoodRestored *prometheus.GaugeVec
+	butlerKnownGoodReload   *prometheus.GaugeVec
+	butlerPaused            *prometheus.GaugeVec
+	butlerBreakerOpen       *prometheus.GaugeVec
+	butlerStale             *prometheus.GaugeVec
+	butlerConfigAge         *prometheus.GaugeVec
+	butlerFailedRuns        *prometheus.GaugeVec
+	butlerCanaryHeld        *prometheus.GaugeVec
 	butlerReloadCount       *prometheus.GaugeVec
 	butlerReloadSuccess     *prometheus.GaugeVec
 	butlerReloadTime        *prometheus.GaugeVec
@@ -48,11 +65,41 @@ var (
 	butlerRenderSuccess     *prometheus.GaugeVec
 	butlerRenderTime        *prometheus.GaugeVec
 	butlerRepoInSync        *prometheus.GaugeVec
+	butlerSchedulerOverrun  *prometheus.GaugeVec
+	butlerSchedulerSuccess  *prometheus.GaugeVec
+	butlerSchedulerTime     *prometheus.GaugeVec
+	butlerSyncFiles         *prometheus.GaugeVec
+	butlerUnitState         *prometheus.GaugeVec
 	butlerWriteSuccess      *prometheus.GaugeVec
 	butlerWriteTime         *prometheus.GaugeVec
+
+	butlerConfigInfo         *prometheus.GaugeVec
+	butlerCopyDuration       *prometheus.HistogramVec
+	butlerRolloutWait        *prometheus.HistogramVec
+	butlerDownloadBytes      *prometheus.CounterVec
+	butlerResponseCacheHits  *prometheus.CounterVec
+	butlerSharedDownloads    *prometheus.CounterVec
+	butlerDownloadDuration   *prometheus.HistogramVec
+	butlerInternalFailures   *prometheus.CounterVec
+	butlerCopyNoop           *prometheus.CounterVec
+	butlerOptionalFile       *prometheus.GaugeVec
+	butlerLastFetchSuccess   *prometheus.GaugeVec
+	butlerLastReloadSuccess  *prometheus.GaugeVec
+	butlerReloadDuration     *prometheus.HistogramVec
+	butlerValidationDuration *prometheus.HistogramVec
+
+	// configVersions are the versions of the butlerConfigInfo series, by
+	// manager, so that the series of a replaced version can be deleted.
+	configVersions     = make(map[string]string)
+	configVersionsLock sync.Mutex
 )
 
 func init() {
+	butlerCleanCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_localconfig_clean_count",
+		Help: "Number of times butler deleted an unknown file with clean-files",
+	}, []string{"manager", "config_file"})
+
 	butlerConfigValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "butler_remoterepo_config_valid",
 		Help: "Is the butler configuration valid",
@@ -78,6 +125,31 @@ func init() {
 		Help: "Time that butler successfully contacted the remote repository",
 	}, []string{"config_file", "repo"})
 
+	butlerReportSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_report_success",
+		Help: "Did butler successfully send the last report of its managers to the report endpoint",
+	}, []string{"host"})
+
+	butlerReportTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_report_time",
+		Help: "Time that butler successfully sent a report of its managers to the report endpoint",
+	}, []string{"host"})
+
+	butlerLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_leader",
+		Help: "Is butler the leader among the butlers which share its destination",
+	}, []string{"id"})
+
+	butlerConfigBootstrap = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_config_bootstrapped",
+		Help: "Is butler running on its bootstrap copy of the butler configuration, because the remote repository could not be contacted on start up",
+	}, []string{"config_file", "repo"})
+
+	butlerEventSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_events_sink_success",
+		Help: "Did butler successfully send the last event to the sink",
+	}, []string{"sink"})
+
 	butlerKnownGoodCached = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "butler_lastknowngood_cached",
 		Help: "Did butler cache the known good configuration",
@@ -88,6 +160,11 @@ func init() {
 		Help: "Did butler restore the known good configuration",
 	}, []string{"manager"})
 
+	butlerKnownGoodReload = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_lastknowngood_reload_success",
+		Help: "Did butler successfully reload the manager with the restored known good configuration",
+	}, []string{"manager"})
+
 	butlerReloadCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "butler_localconfig_reload_count",
 		Help: "butler reload counter",
@@ -143,14 +220,185 @@ func init() {
 		Help: "Time that butler successfully write the configuration",
 	}, []string{"config_file"})
 
+	butlerSyncFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_localconfig_sync_files",
+		Help: "Number of files butler added, changed or deleted for the manager in the last run which changed files",
+	}, []string{"manager", "change"})
+
+	butlerBlackout = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_blackout",
+		Help: "Is the manager in a blackout window, during which files are not copied and the manager is not reloaded",
+	}, []string{"manager"})
+
+	butlerSchedulerOverrun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_scheduler_job_overrun",
+		Help: "How many scheduled runs of the job were skipped because its previous run was still in flight",
+	}, []string{"job"})
+
+	butlerSchedulerSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_scheduler_job_success",
+		Help: "Did the last scheduled run of the job complete without panicking",
+	}, []string{"job"})
+
+	butlerSchedulerTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_scheduler_job_time",
+		Help: "Time of the last successful scheduled run of the job",
+	}, []string{"job"})
+
+	butlerPaused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_paused",
+		Help: "Has the manager been paused through the admin endpoint, so that butler does not manage its files",
+	}, []string{"manager"})
+
+	butlerBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_breaker_open",
+		Help: "Is the circuit breaker of the manager open, so that butler backs off the manager after consecutive failed runs",
+	}, []string{"manager"})
+
+	butlerStale = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_config_stale",
+		Help: "Is the last successful run of the manager older than its stale-threshold, so that the host runs potentially stale configuration files",
+	}, []string{"manager"})
+
+	butlerConfigAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_config_age_seconds",
+		Help: "Time since the last successful run of the manager, or since butler started when it has not had one",
+	}, []string{"manager"})
+
+	butlerCanaryHeld = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_canary_held",
+		Help: "Are the changes of the manager held back until a canary manager has soaked them",
+	}, []string{"manager"})
+
+	butlerFailedRuns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_consecutive_failed_runs",
+		Help: "Number of runs of the manager in a row which failed to download, validate or reload its configuration",
+	}, []string{"manager"})
+
+	butlerHealthCheck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_health_check_success",
+		Help: "Did the manager pass its health check after butler last reloaded it",
+	}, []string{"manager"})
+
+	butlerUnitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_unit_state",
+		Help: "ActiveState of the systemd unit after butler last reloaded the manager, 1 for the current state",
+	}, []string{"manager", "unit", "state"})
+
+	butlerDownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "butler_remoterepo_download_duration_seconds",
+		Help:    "How long butler took to download the configuration file from the remote repository",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"config_file", "repo"})
+
+	butlerDownloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "butler_remoterepo_download_bytes_total",
+		Help: "Number of bytes butler downloaded for the configuration file from the remote repository",
+	}, []string{"config_file", "repo"})
+
+	butlerResponseCacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "butler_remoterepo_response_cache_hits_total",
+		Help: "Number of files butler took from the response cache rather than fetching them from the remote repository",
+	}, []string{"repo"})
+
+	butlerSharedDownloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "butler_remoterepo_shared_downloads_total",
+		Help: "Number of files butler took from the download of the same url by another manager during the run rather than downloading them again",
+	}, []string{"repo"})
+
+	butlerInternalFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "butler_internal_failures_total",
+		Help: "Number of times an operation of butler itself failed, eg: writing the status-file, by the operation",
+	}, []string{"operation"})
+
+	butlerCopyNoop = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "butler_localconfig_copy_noop_total",
+		Help: "Number of files butler did not copy because they were identical to the installed files, by manager",
+	}, []string{"manager"})
+
+	butlerOptionalFile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_remoterepo_optional_file_present",
+		Help: "Whether the optional configuration file was present in the remote repository on the last run",
+	}, []string{"config_file", "repo"})
+
+	butlerValidationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "butler_localconfig_validation_duration_seconds",
+		Help:    "How long the validators (pre-copy) or post-validators (post-copy) of the manager took to validate its configuration files",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"manager", "stage"})
+
+	butlerCopyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "butler_localconfig_copy_duration_seconds",
+		Help:    "How long butler took to copy the configuration files of the manager into its dest-path",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"manager"})
+
+	// reloads include their retries and the health check, so they get
+	// buckets of up to a few minutes
+	butlerReloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "butler_manager_reload_duration_seconds",
+		Help:    "How long butler took to reload the manager, including the retries and the health check",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"manager"})
+
+	// the reloads of a fleet wait for each other, for up to the rollout wait
+	butlerRolloutWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "butler_manager_rollout_wait_seconds",
+		Help:    "How long the reload of the manager waited for a rollout slot",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	}, []string{"manager"})
+
+	butlerLastFetchSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_last_fetch_success_timestamp_seconds",
+		Help: "UNIX timestamp of the last run in which butler retrieved all of the configuration files of the manager",
+	}, []string{"manager"})
+
+	butlerLastReloadSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_last_reload_success_timestamp_seconds",
+		Help: "UNIX timestamp of the last successful reload of the manager",
+	}, []string{"manager"})
+
+	butlerConfigInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_manager_config_info",
+		Help: "Content address, a truncated sha256, of the configuration files of the manager as they are installed, always 1",
+	}, []string{"manager", "version"})
+
+	prometheus.MustRegister(butlerBlackout)
+	prometheus.MustRegister(butlerBreakerOpen)
+	prometheus.MustRegister(butlerStale)
+	prometheus.MustRegister(butlerConfigAge)
+	prometheus.MustRegister(butlerCanaryHeld)
+	prometheus.MustRegister(butlerCleanCount)
+	prometheus.MustRegister(butlerConfigInfo)
 	prometheus.MustRegister(butlerConfigValid)
+	prometheus.MustRegister(butlerCopyDuration)
+	prometheus.MustRegister(butlerRolloutWait)
 	prometheus.MustRegister(butlerContactRetry)
 	prometheus.MustRegister(butlerContactRetryTime)
 	prometheus.MustRegister(butlerContactSuccess)
 	prometheus.MustRegister(butlerContactTime)
+	prometheus.MustRegister(butlerConfigBootstrap)
+	prometheus.MustRegister(butlerReportSuccess)
+	prometheus.MustRegister(butlerReportTime)
+	prometheus.MustRegister(butlerLeader)
+	prometheus.MustRegister(butlerDownloadBytes)
+	prometheus.MustRegister(butlerResponseCacheHits)
+	prometheus.MustRegister(butlerSharedDownloads)
+	prometheus.MustRegister(butlerDownloadDuration)
+	prometheus.MustRegister(butlerEventSuccess)
+	prometheus.MustRegister(butlerFailedRuns)
+	prometheus.MustRegister(butlerHealthCheck)
+	prometheus.MustRegister(butlerInternalFailures)
+	prometheus.MustRegister(butlerCopyNoop)
+	prometheus.MustRegister(butlerOptionalFile)
 	prometheus.MustRegister(butlerKnownGoodCached)
 	prometheus.MustRegister(butlerKnownGoodRestored)
+	prometheus.MustRegister(butlerKnownGoodReload)
+	prometheus.MustRegister(butlerLastFetchSuccess)
+	prometheus.MustRegister(butlerLastReloadSuccess)
+	prometheus.MustRegister(butlerPaused)
 	prometheus.MustRegister(butlerReloadCount)
+	prometheus.MustRegister(butlerReloadDuration)
 	prometheus.MustRegister(butlerReloadSuccess)
 	prometheus.MustRegister(butlerReloadTime)
 	prometheus.MustRegister(butlerReloaderRetry)
@@ -159,6 +407,12 @@ func init() {
 	prometheus.MustRegister(butlerRenderSuccess)
 	prometheus.MustRegister(butlerRenderTime)
 	prometheus.MustRegister(butlerRepoInSync)
+	prometheus.MustRegister(butlerSchedulerOverrun)
+	prometheus.MustRegister(butlerSchedulerSuccess)
+	prometheus.MustRegister(butlerSchedulerTime)
+	prometheus.MustRegister(butlerSyncFiles)
+	prometheus.MustRegister(butlerUnitState)
+	prometheus.MustRegister(butlerValidationDuration)
 	prometheus.MustRegister(butlerWriteTime)
 	prometheus.MustRegister(butlerWriteSuccess)
 }
@@ -216,6 +470,21 @@ func SetButlerContactVal(res float64, repo string, file string) {
 	}
 }
 
+// SetButlerConfigBootstrapVal sets whether butler runs on its bootstrap copy
+// of the butler configuration.
+func SetButlerConfigBootstrapVal(res float64, repo string, file string) {
+	butlerConfigBootstrap.With(prometheus.Labels{"config_file": file, "repo": repo}).Set(res)
+}
+
+// SetButlerReportVal sets whether the last report to the report endpoint on
+// the host succeeded.
+func SetButlerReportVal(res float64, host string) {
+	butlerReportSuccess.With(prometheus.Labels{"host": host}).Set(res)
+	if res == SUCCESS {
+		butlerReportTime.With(prometheus.Labels{"host": host}).SetToCurrentTime()
+	}
+}
+
 func SetButlerContactRetryVal(res float64, repo string, file string) {
 	// If there are no legit labels, then we don't want to log anything
 	// this is a bit hokey, but for some reason it's getting triggered
@@ -243,6 +512,199 @@ func SetButlerKnownGoodRestoredVal(res float64, label string) {
 	}
 }
 
+func SetButlerKnownGoodReloadVal(res float64, label string) {
+	if res == SUCCESS {
+		butlerKnownGoodReload.With(prometheus.Labels{"manager": label}).Set(SUCCESS)
+	} else {
+		butlerKnownGoodReload.With(prometheus.Labels{"manager": label}).Set(FAILURE)
+	}
+}
+
+// SetButlerCleanVal counts a file which was deleted by clean-files.
+func SetButlerCleanVal(manager string, file string) {
+	butlerCleanCount.With(prometheus.Labels{"manager": manager, "config_file": file}).Inc()
+}
+
+// SetButlerSyncFilesVal sets the number of files which were added, changed
+// and deleted for the manager.
+func SetButlerSyncFilesVal(manager string, added int, changed int, deleted int) {
+	butlerSyncFiles.With(prometheus.Labels{"manager": manager, "change": "added"}).Set(float64(added))
+	butlerSyncFiles.With(prometheus.Labels{"manager": manager, "change": "changed"}).Set(float64(changed))
+	butlerSyncFiles.With(prometheus.Labels{"manager": manager, "change": "deleted"}).Set(float64(deleted))
+}
+
+// SetButlerBlackoutVal sets whether the manager is in a blackout window.
+func SetButlerBlackoutVal(res float64, manager string) {
+	butlerBlackout.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// SetButlerSchedulerJobVal sets whether the last scheduled run of the job
+// completed.
+func SetButlerSchedulerJobVal(res float64, job string) {
+	if res == SUCCESS {
+		butlerSchedulerSuccess.With(prometheus.Labels{"job": job}).Set(SUCCESS)
+		butlerSchedulerTime.With(prometheus.Labels{"job": job}).SetToCurrentTime()
+	} else {
+		butlerSchedulerSuccess.With(prometheus.Labels{"job": job}).Set(FAILURE)
+	}
+}
+
+// SetButlerSchedulerOverrun counts the scheduled runs of the job which were
+// skipped because its previous run was still in flight.
+func SetButlerSchedulerOverrun(job string, skipped int) {
+	butlerSchedulerOverrun.With(prometheus.Labels{"job": job}).Add(float64(skipped))
+}
+
+// SetButlerPausedVal sets whether the manager is paused.
+func SetButlerPausedVal(res float64, manager string) {
+	butlerPaused.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// SetButlerBreakerVal sets whether the circuit breaker of the manager is
+// open.
+func SetButlerBreakerVal(res float64, manager string) {
+	butlerBreakerOpen.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// SetButlerStaleVal sets whether the config files of the manager are stale.
+func SetButlerStaleVal(res float64, manager string) {
+	butlerStale.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// SetButlerConfigAge sets the time since the last successful run of the
+// manager.
+func SetButlerConfigAge(manager string, age time.Duration) {
+	butlerConfigAge.With(prometheus.Labels{"manager": manager}).Set(age.Seconds())
+}
+
+// SetButlerCanaryHeldVal sets whether the changes of the manager are held
+// back by a canary manager.
+func SetButlerCanaryHeldVal(res float64, manager string) {
+	butlerCanaryHeld.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// SetButlerFailedRuns sets the number of consecutive failed runs of the
+// manager.
+func SetButlerFailedRuns(manager string, n int) {
+	butlerFailedRuns.With(prometheus.Labels{"manager": manager}).Set(float64(n))
+}
+
+// SetButlerHealthCheckVal sets whether the manager passed its health check.
+func SetButlerHealthCheckVal(res float64, manager string) {
+	butlerHealthCheck.With(prometheus.Labels{"manager": manager}).Set(res)
+}
+
+// UnitStates are the ActiveStates of a systemd unit.
+var UnitStates = []string{"active", "reloading", "inactive", "failed", "activating", "deactivating"}
+
+// SetButlerUnitStateVal sets the ActiveState of the systemd unit of the
+// manager, 1 for the state the unit is in and 0 for the others.
+func SetButlerUnitStateVal(manager string, unit string, state string) {
+	for _, s := range UnitStates {
+		if s == state {
+			butlerUnitState.With(prometheus.Labels{"manager": manager, "unit": unit, "state": s}).Set(SUCCESS)
+		} else {
+			butlerUnitState.With(prometheus.Labels{"manager": manager, "unit": unit, "state": s}).Set(FAILURE)
+		}
+	}
+}
+
+// SetButlerEventVal sets whether the last event was sent to the sink.
+func SetButlerEventVal(res float64, sink string) {
+	if res == SUCCESS {
+		butlerEventSuccess.With(prometheus.Labels{"sink": sink}).Set(SUCCESS)
+	} else {
+		butlerEventSuccess.With(prometheus.Labels{"sink": sink}).Set(FAILURE)
+	}
+}
+
+// IncButlerResponseCacheHit counts a file taken from the response cache
+// rather than fetched from the repo.
+func IncButlerResponseCacheHit(repo string) {
+	butlerResponseCacheHits.With(prometheus.Labels{"repo": repo}).Inc()
+}
+
+// IncButlerSharedDownload counts a file taken from the download of the same
+// url by another manager during the run.
+func IncButlerSharedDownload(repo string) {
+	butlerSharedDownloads.With(prometheus.Labels{"repo": repo}).Inc()
+}
+
+// SetButlerDownloadVal records how long the download of the file from the
+// repo took, and how many bytes were downloaded.
+func SetButlerDownloadVal(repo string, file string, d time.Duration, bytes int64) {
+	butlerDownloadDuration.With(prometheus.Labels{"config_file": file, "repo": repo}).Observe(d.Seconds())
+	butlerDownloadBytes.With(prometheus.Labels{"config_file": file, "repo": repo}).Add(float64(bytes))
+}
+
+// IncButlerInternalFailure counts a failure of the operation of butler.
+func IncButlerInternalFailure(op string) {
+	butlerInternalFailures.With(prometheus.Labels{"operation": op}).Inc()
+}
+
+// IncButlerCopyNoop counts a file of the manager which was not copied, since
+// it was identical to the installed file.
+func IncButlerCopyNoop(manager string) {
+	butlerCopyNoop.With(prometheus.Labels{"manager": manager}).Inc()
+}
+
+// SetButlerOptionalFileVal sets whether the optional file was present in the
+// repository.
+func SetButlerOptionalFileVal(present bool, repo string, file string) {
+	if present {
+		butlerOptionalFile.With(prometheus.Labels{"config_file": file, "repo": repo}).Set(SUCCESS)
+	} else {
+		butlerOptionalFile.With(prometheus.Labels{"config_file": file, "repo": repo}).Set(FAILURE)
+	}
+}
+
+// SetButlerValidationDuration records how long the validation of the files
+// of the manager took at the stage, pre-copy or post-copy.
+func SetButlerValidationDuration(manager string, stage string, d time.Duration) {
+	butlerValidationDuration.With(prometheus.Labels{"manager": manager, "stage": stage}).Observe(d.Seconds())
+}
+
+// SetButlerCopyDuration records how long copying the files of the manager
+// into place took.
+func SetButlerCopyDuration(manager string, d time.Duration) {
+	butlerCopyDuration.With(prometheus.Labels{"manager": manager}).Observe(d.Seconds())
+}
+
+// SetButlerRolloutWait records how long the reload of the manager waited for
+// a rollout slot.
+func SetButlerRolloutWait(manager string, d time.Duration) {
+	butlerRolloutWait.With(prometheus.Labels{"manager": manager}).Observe(d.Seconds())
+}
+
+// SetButlerReloadDuration records how long the reload of the manager took.
+func SetButlerReloadDuration(manager string, d time.Duration) {
+	butlerReloadDuration.With(prometheus.Labels{"manager": manager}).Observe(d.Seconds())
+}
+
+// SetButlerLastFetchSuccess sets the time butler last retrieved all of the
+// files of the manager to now.
+func SetButlerLastFetchSuccess(manager string) {
+	butlerLastFetchSuccess.With(prometheus.Labels{"manager": manager}).SetToCurrentTime()
+}
+
+// SetButlerLastReloadSuccess sets the time of the last successful reload of
+// the manager to now.
+func SetButlerLastReloadSuccess(manager string) {
+	butlerLastReloadSuccess.With(prometheus.Labels{"manager": manager}).SetToCurrentTime()
+}
+
+// SetButlerConfigVersion sets the version of the installed files of the
+// manager, replacing the series of the previous version.
+func SetButlerConfigVersion(manager string, version string) {
+	configVersionsLock.Lock()
+	defer configVersionsLock.Unlock()
+	if prev, ok := configVersions[manager]; ok && prev != version {
+		butlerConfigInfo.Delete(prometheus.Labels{"manager": manager, "version": prev})
+	}
+	configVersions[manager] = version
+	butlerConfigInfo.With(prometheus.Labels{"manager": manager, "version": version}).Set(1)
+}
+
 func SetButlerReloaderRetry(res float64, manager string) {
 	butlerReloaderRetry.With(prometheus.Labels{"manager": manager}).Inc()
 }
@@ -277,3 +739,9 @@ func GetStatsLabel(file string) string {
 	ret := fileSplit[len(fileSplit)-1]
 	return ret
 }
+
+// SetButlerLeaderVal sets whether butler, by the id it campaigns as, is the
+// leader among the butlers which share its destination.
+func SetButlerLeaderVal(res float64, id string) {
+	butlerLeader.With(prometheus.Labels{"id": id}).Set(res)
+}
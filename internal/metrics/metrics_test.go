@@ -15,6 +15,7 @@ package metrics
 import (
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_model/go"
 	log "github.com/sirupsen/logrus"
 	. "gopkg.in/check.v1"
@@ -73,8 +74,8 @@ func (s *ButlerStatsTestSuite) TestSetButlerReloadVal(c *C) {
 	c.Assert(butlerReloadTimeMetric, NotNil)
 	c.Assert(err, IsNil)
 
-	c.Assert(butlerReloadSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_reload_success\", help: \"Did butler successfully reload prometheus\", constLabels: {}, variableLabels: [manager]}")
-	c.Assert(butlerReloadTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_reload_time\", help: \"Time that butler successfully reload prometheus\", constLabels: {}, variableLabels: [manager]}")
+	c.Assert(butlerReloadSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_reload_success\", help: \"Did butler successfully reload prometheus\", unit: \"\", constLabels: {}, variableLabels: {manager}}")
+	c.Assert(butlerReloadTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_reload_time\", help: \"Time that butler successfully reload prometheus\", unit: \"\", constLabels: {}, variableLabels: {manager}}")
 
 	// Let's get the metric values for FAILURE
 	butlerReloadSuccessMetric.Write(&metricFailure)
@@ -140,8 +141,8 @@ func (s *ButlerStatsTestSuite) TestSetButlerRenderVal(c *C) {
 	c.Assert(butlerRenderTimeMetric, NotNil)
 	c.Assert(err, IsNil)
 
-	c.Assert(butlerRenderSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_render_success\", help: \"Did butler successfully render the prometheus.yml\", constLabels: {}, variableLabels: [config_file repo]}")
-	c.Assert(butlerRenderTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_render_time\", help: \"Time that butler successfully rendered the prometheus.yml\", constLabels: {}, variableLabels: [config_file repo]}")
+	c.Assert(butlerRenderSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_render_success\", help: \"Did butler successfully render the prometheus.yml\", unit: \"\", constLabels: {}, variableLabels: {config_file,repo}}")
+	c.Assert(butlerRenderTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_render_time\", help: \"Time that butler successfully rendered the prometheus.yml\", unit: \"\", constLabels: {}, variableLabels: {config_file,repo}}")
 
 	// Let's get the metric values for FAILURE
 	butlerRenderSuccessMetric.Write(&metricFailure)
@@ -203,8 +204,8 @@ func (s *ButlerStatsTestSuite) TestSetButlerWriteVal(c *C) {
 	c.Assert(butlerWriteTimeMetric, NotNil)
 	c.Assert(err, IsNil)
 
-	c.Assert(butlerWriteSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_write_success\", help: \"Did butler successfully write the configuration\", constLabels: {}, variableLabels: [config_file]}")
-	c.Assert(butlerWriteTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_write_time\", help: \"Time that butler successfully write the configuration\", constLabels: {}, variableLabels: [config_file]}")
+	c.Assert(butlerWriteSuccessMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_write_success\", help: \"Did butler successfully write the configuration\", unit: \"\", constLabels: {}, variableLabels: {config_file}}")
+	c.Assert(butlerWriteTimeMetric.Desc().String(), Equals, "Desc{fqName: \"butler_localconfig_write_time\", help: \"Time that butler successfully write the configuration\", unit: \"\", constLabels: {}, variableLabels: {config_file}}")
 
 	// Let's get the metric values for FAILURE
 	butlerWriteSuccessMetric.Write(&metricFailure)
@@ -239,6 +240,90 @@ func (s *ButlerStatsTestSuite) TestSetButlerWriteVal(c *C) {
 	c.Assert(tsMetric.Truncate(time.Second), Equals, tsNow.Truncate(time.Second))
 }
 
+func (s *ButlerStatsTestSuite) TestSetButlerDurations(c *C) {
+	metricDuration := io_prometheus_client.Metric{}
+	metricBytes := io_prometheus_client.Metric{}
+
+	SetButlerDownloadVal(s.TestRepo, s.TestLabel, 250*time.Millisecond, 1024)
+	SetButlerDownloadVal(s.TestRepo, s.TestLabel, 2*time.Second, 512)
+
+	observer, err := butlerDownloadDuration.GetMetricWithLabelValues(s.TestLabel, s.TestRepo)
+	c.Assert(err, IsNil)
+	butlerDownloadDurationMetric := observer.(prometheus.Histogram)
+	c.Assert(butlerDownloadDurationMetric.Desc().String(), Equals, "Desc{fqName: \"butler_remoterepo_download_duration_seconds\", help: \"How long butler took to download the configuration file from the remote repository\", unit: \"\", constLabels: {}, variableLabels: {config_file,repo}}")
+	butlerDownloadDurationMetric.Write(&metricDuration)
+	c.Assert(*metricDuration.Histogram.SampleCount, Equals, uint64(2))
+	c.Assert(*metricDuration.Histogram.SampleSum, Equals, 2.25)
+
+	butlerDownloadBytesMetric, err := butlerDownloadBytes.GetMetricWithLabelValues(s.TestLabel, s.TestRepo)
+	c.Assert(err, IsNil)
+	butlerDownloadBytesMetric.Write(&metricBytes)
+	c.Assert(*metricBytes.Counter.Value, Equals, 1536.0)
+
+	for _, t := range []struct {
+		observe func()
+		vec     *prometheus.HistogramVec
+		labels  []string
+	}{
+		{func() { SetButlerValidationDuration(s.TestRepo, "pre-copy", time.Second) }, butlerValidationDuration, []string{s.TestRepo, "pre-copy"}},
+		{func() { SetButlerCopyDuration(s.TestRepo, time.Second) }, butlerCopyDuration, []string{s.TestRepo}},
+		{func() { SetButlerReloadDuration(s.TestRepo, time.Second) }, butlerReloadDuration, []string{s.TestRepo}},
+	} {
+		t.observe()
+		m := io_prometheus_client.Metric{}
+		h, err := t.vec.GetMetricWithLabelValues(t.labels...)
+		c.Assert(err, IsNil)
+		h.(prometheus.Histogram).Write(&m)
+		c.Assert(*m.Histogram.SampleCount, Equals, uint64(1))
+		c.Assert(*m.Histogram.SampleSum, Equals, 1.0)
+	}
+}
+
+func (s *ButlerStatsTestSuite) TestSetButlerLastSuccess(c *C) {
+	tsNow := time.Now()
+	SetButlerLastFetchSuccess(s.TestRepo)
+	SetButlerLastReloadSuccess(s.TestRepo)
+
+	for _, vec := range []*prometheus.GaugeVec{butlerLastFetchSuccess, butlerLastReloadSuccess} {
+		m := io_prometheus_client.Metric{}
+		g, err := vec.GetMetricWithLabelValues(s.TestRepo)
+		c.Assert(err, IsNil)
+		g.Write(&m)
+		tsMetric := time.Unix(int64(*m.Gauge.Value), 0)
+		c.Assert(tsMetric.Truncate(time.Second), Equals, tsNow.Truncate(time.Second))
+	}
+}
+
+func (s *ButlerStatsTestSuite) TestSetButlerConfigVersion(c *C) {
+	versions := func() map[string]float64 {
+		res := make(map[string]float64)
+		ch := make(chan prometheus.Metric, 10)
+		butlerConfigInfo.Collect(ch)
+		close(ch)
+		for metric := range ch {
+			m := io_prometheus_client.Metric{}
+			metric.Write(&m)
+			labels := make(map[string]string)
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["manager"] == s.TestRepo {
+				res[labels["version"]] = *m.Gauge.Value
+			}
+		}
+		return res
+	}
+
+	SetButlerConfigVersion(s.TestRepo, "3f2a9c1b7d0e")
+	c.Assert(versions(), DeepEquals, map[string]float64{"3f2a9c1b7d0e": 1})
+	SetButlerConfigVersion(s.TestRepo, "3f2a9c1b7d0e")
+	c.Assert(versions(), DeepEquals, map[string]float64{"3f2a9c1b7d0e": 1})
+
+	// only the installed version is kept
+	SetButlerConfigVersion(s.TestRepo, "5e8c0f2a41b7")
+	c.Assert(versions(), DeepEquals, map[string]float64{"5e8c0f2a41b7": 1})
+}
+
 func (s *ButlerStatsTestSuite) TestGetStatsLabel(c *C) {
 	c.Assert(GetStatsLabel(s.TestFile), Equals, s.TestFileResult)
 }
@@ -0,0 +1,160 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultPushgatewayJob is the job label of the metrics pushed to the
+// Pushgateway.
+const DefaultPushgatewayJob = "butler"
+
+// PushgatewayOpts say where the metrics of a butler run are pushed to, and
+// under which grouping key.
+type PushgatewayOpts struct {
+	// URL is the base URL of the Pushgateway, eg: http://pushgateway:9091.
+	URL string
+	// Job is the job label of the pushed metrics, butler by default.
+	Job string
+	// Grouping are the other labels of the grouping key, eg: instance.
+	Grouping map[string]string
+	// Timeout is the timeout of the push, 10 seconds by default.
+	Timeout time.Duration
+}
+
+// PushToGateway pushes the butler metrics, the same ones which are served on
+// /metrics, to the Pushgateway at opts.URL, for the runs of -once which are
+// not around long enough to be scraped. They replace the metrics previously
+// pushed under the same grouping key.
+func PushToGateway(opts PushgatewayOpts) error {
+	return pushToGateway(opts, prometheus.DefaultGatherer)
+}
+
+func pushToGateway(opts PushgatewayOpts, gatherer prometheus.Gatherer) error {
+	u, err := pushgatewayURL(opts)
+	if err != nil {
+		return err
+	}
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, f := range families {
+		// the go_ and process_ metrics of a process which exited are noise
+		if !strings.HasPrefix(f.GetName(), "butler_") {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if _, ok := opts.Grouping[l.GetName()]; ok || l.GetName() == "job" {
+					return fmt.Errorf("the metric %v already has the label %v of the grouping key", f.GetName(), l.GetName())
+				}
+			}
+		}
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	req, err := http.NewRequest(http.MethodPut, u, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(expfmt.FmtText))
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("could not push the metrics to %v. code=%d body=%s", u, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// pushgatewayURL returns the URL of the grouping key of the opts, eg:
+// http://pushgateway:9091/metrics/job/butler/instance/host1.
+func pushgatewayURL(opts PushgatewayOpts) (string, error) {
+	if opts.URL == "" {
+		return "", errors.New("no pushgateway url has been defined")
+	}
+	if u, err := url.Parse(opts.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("the pushgateway url %v must be in URL form, eg: http://pushgateway:9091", opts.URL)
+	}
+	job := opts.Job
+	if job == "" {
+		job = DefaultPushgatewayJob
+	}
+
+	var names []string
+	for k := range opts.Grouping {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	path := "/metrics" + pushgatewayLabel("job", job)
+	for _, k := range names {
+		path += pushgatewayLabel(k, opts.Grouping[k])
+	}
+	return strings.TrimRight(opts.URL, "/") + path, nil
+}
+
+// pushgatewayLabel returns the path of a label of the grouping key. The
+// values which could not be a path segment, empty or with a /, are base64
+// encoded.
+func pushgatewayLabel(name, value string) string {
+	switch {
+	case value == "":
+		return "/" + name + "@base64/="
+	case strings.Contains(value, "/"):
+		return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+// ParsePushgatewayGrouping parses the labels of a grouping key in the form
+// of name1=value1,name2=value2.
+func ParsePushgatewayGrouping(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid grouping label %q, it must be in the form of name=value", kv)
+		}
+		res[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return res, nil
+}
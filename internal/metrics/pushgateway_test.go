@@ -0,0 +1,100 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type PushgatewayTestSuite struct{}
+
+var _ = Suite(&PushgatewayTestSuite{})
+
+func (s *PushgatewayTestSuite) TestPushgatewayURL(c *C) {
+	u, err := pushgatewayURL(PushgatewayOpts{URL: "http://pushgateway:9091/"})
+	c.Assert(err, IsNil)
+	c.Assert(u, Equals, "http://pushgateway:9091/metrics/job/butler")
+
+	u, err = pushgatewayURL(PushgatewayOpts{
+		URL:      "http://pushgateway:9091",
+		Job:      "butler-cron",
+		Grouping: map[string]string{"instance": "host1", "path": "/etc/butler", "empty": ""},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(u, Equals, "http://pushgateway:9091/metrics/job/butler-cron/empty@base64/=/instance/host1/path@base64/L2V0Yy9idXRsZXI")
+
+	_, err = pushgatewayURL(PushgatewayOpts{})
+	c.Assert(err, ErrorMatches, "no pushgateway url has been defined")
+	_, err = pushgatewayURL(PushgatewayOpts{URL: "pushgateway:9091"})
+	c.Assert(err, ErrorMatches, "the pushgateway url pushgateway:9091 must be in URL form.*")
+}
+
+func (s *PushgatewayTestSuite) TestParsePushgatewayGrouping(c *C) {
+	g, err := ParsePushgatewayGrouping("instance=host1, dc = or1,")
+	c.Assert(err, IsNil)
+	c.Assert(g, DeepEquals, map[string]string{"instance": "host1", "dc": "or1"})
+	_, err = ParsePushgatewayGrouping("instance")
+	c.Assert(err, ErrorMatches, `invalid grouping label "instance".*`)
+}
+
+func (s *PushgatewayTestSuite) TestPushToGateway(c *C) {
+	var (
+		method, path, contentType string
+		body                      []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_test_gauge",
+		Help: "a test gauge",
+	}, []string{"manager"})
+	notButler := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "go_test_gauge",
+		Help: "a test gauge which is not pushed",
+	})
+	registry.MustRegister(gauge, notButler)
+	gauge.WithLabelValues("prometheus").Set(1)
+
+	opts := PushgatewayOpts{URL: ts.URL, Grouping: map[string]string{"instance": "host1"}}
+	c.Assert(pushToGateway(opts, registry), IsNil)
+	c.Assert(method, Equals, http.MethodPut)
+	c.Assert(path, Equals, "/metrics/job/butler/instance/host1")
+	c.Assert(contentType, Matches, "text/plain; version=0.0.4.*")
+	c.Assert(strings.Contains(string(body), `butler_test_gauge{manager="prometheus"} 1`), Equals, true)
+	c.Assert(strings.Contains(string(body), "go_test_gauge"), Equals, false)
+
+	// a label of the grouping key would be overwritten by the Pushgateway
+	opts.Grouping["manager"] = "other"
+	c.Assert(pushToGateway(opts, registry), ErrorMatches, "the metric butler_test_gauge already has the label manager of the grouping key")
+}
+
+func (s *PushgatewayTestSuite) TestPushToGatewayFailure(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	err := pushToGateway(PushgatewayOpts{URL: ts.URL}, prometheus.NewRegistry())
+	c.Assert(err, ErrorMatches, "could not push the metrics to .*/metrics/job/butler. code=400 body=bad metrics")
+}
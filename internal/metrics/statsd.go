@@ -0,0 +1,275 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// The formats of the StatsdSink.
+const (
+	// FormatStatsd appends the label values to the metric name, eg:
+	// butler_localconfig_reload_success.prometheus.
+	FormatStatsd = "statsd"
+	// FormatDogStatsD sends the labels as DogStatsD tags, eg:
+	// butler_localconfig_reload_success:1|g|#manager:prometheus.
+	FormatDogStatsD = "dogstatsd"
+)
+
+// DefaultStatsdInterval is how often the metrics are pushed.
+var DefaultStatsdInterval = 10 * time.Second
+
+// statsdMaxPacket keeps the datagrams within the MTU of most networks.
+const statsdMaxPacket = 1432
+
+// StatsdOpts say where the metrics are pushed to, and how.
+type StatsdOpts struct {
+	// Address is the host:port of the statsd server, eg: localhost:8125.
+	Address string
+	// Format is statsd or dogstatsd, statsd by default.
+	Format string
+	// Prefix is prepended to the metric names, eg: "butler.".
+	Prefix string
+	// Tags are added to every metric as DogStatsD tags, eg: env:prod.
+	// They are ignored by the statsd format.
+	Tags []string
+	// Interval is how often the metrics are pushed.
+	Interval time.Duration
+}
+
+// StatsdSink pushes the butler metrics, the same ones which are served on
+// /metrics, to a statsd server, for the environments which are not scraped
+// by Prometheus. The gauges are sent as gauges, and the counters, along with
+// the count and sum of the histograms, as counters of their increase since
+// the previous push.
+type StatsdSink struct {
+	opts     StatsdOpts
+	conn     net.Conn
+	gatherer prometheus.Gatherer
+	// last are the values of the counters at the previous push, by series.
+	last  map[string]float64
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewStatsdSink returns a StatsdSink which pushes the metrics to the
+// opts.Address.
+func NewStatsdSink(opts StatsdOpts) (*StatsdSink, error) {
+	if opts.Address == "" {
+		return nil, errors.New("no statsd address has been defined")
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = FormatStatsd
+	case FormatStatsd, FormatDogStatsD:
+	default:
+		return nil, fmt.Errorf("unknown statsd format %v, it must be %v or %v", opts.Format, FormatStatsd, FormatDogStatsD)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultStatsdInterval
+	}
+	conn, err := net.Dial("udp", opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to statsd %v. err=%v", opts.Address, err.Error())
+	}
+	return &StatsdSink{
+		opts:     opts,
+		conn:     conn,
+		gatherer: prometheus.DefaultGatherer,
+		last:     make(map[string]float64),
+	}, nil
+}
+
+// Start pushes the metrics every opts.Interval, until Stop is called.
+func (s *StatsdSink) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Push(); err != nil {
+					log.Warnf("StatsdSink::Start(): could not push the metrics to %v. err=%v", s.opts.Address, err.Error())
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops pushing the metrics, pushes them a last time, and closes the
+// connection.
+func (s *StatsdSink) Stop() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	err := s.Push()
+	s.conn.Close()
+	return err
+}
+
+// Push sends the current values of the butler metrics.
+func (s *StatsdSink) Push() error {
+	families, err := s.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	var lines []string
+	for _, f := range families {
+		// the go_ and process_ metrics are left to the statsd agent
+		if !strings.HasPrefix(f.GetName(), "butler_") {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			switch f.GetType() {
+			case io_prometheus_client.MetricType_GAUGE:
+				lines = append(lines, s.gauge(f.GetName(), m.GetLabel(), m.GetGauge().GetValue())...)
+			case io_prometheus_client.MetricType_COUNTER:
+				lines = append(lines, s.counter(f.GetName(), m.GetLabel(), m.GetCounter().GetValue())...)
+			case io_prometheus_client.MetricType_HISTOGRAM:
+				lines = append(lines, s.counter(f.GetName()+"_count", m.GetLabel(), float64(m.GetHistogram().GetSampleCount()))...)
+				lines = append(lines, s.counter(f.GetName()+"_sum", m.GetLabel(), m.GetHistogram().GetSampleSum())...)
+			}
+		}
+	}
+	s.mutex.Unlock()
+	return s.send(lines)
+}
+
+func (s *StatsdSink) gauge(name string, labels []*io_prometheus_client.LabelPair, v float64) []string {
+	// a gauge which starts with a sign is changed by the value, instead of
+	// set to it, so a negative gauge is first reset to 0
+	if v < 0 {
+		return []string{s.line(name, labels, 0, "g"), s.line(name, labels, v, "g")}
+	}
+	return []string{s.line(name, labels, v, "g")}
+}
+
+func (s *StatsdSink) counter(name string, labels []*io_prometheus_client.LabelPair, v float64) []string {
+	key := s.line(name, labels, 0, "c")
+	delta := v - s.last[key]
+	s.last[key] = v
+	// a counter which went down was reset, eg: by the deletion of its series
+	if delta < 0 {
+		delta = v
+	}
+	if delta == 0 {
+		return nil
+	}
+	return []string{s.line(name, labels, delta, "c")}
+}
+
+// line formats a metric in the statsd line protocol, name:value|type, with
+// the labels appended to the name, or as DogStatsD tags.
+func (s *StatsdSink) line(name string, labels []*io_prometheus_client.LabelPair, v float64, typ string) string {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	value := strconv.FormatFloat(v, 'f', -1, 64)
+	name = s.opts.Prefix + name
+
+	// the empty labels are left out, as they would make empty name
+	// components and tags
+	if s.opts.Format == FormatStatsd {
+		for _, l := range labels {
+			if l.GetValue() != "" {
+				name += "." + statsdSanitize(l.GetValue())
+			}
+		}
+		return fmt.Sprintf("%s:%s|%s", name, value, typ)
+	}
+
+	tags := append([]string{}, s.opts.Tags...)
+	for _, l := range labels {
+		if l.GetValue() != "" {
+			tags = append(tags, l.GetName()+":"+dogstatsdSanitize(l.GetValue()))
+		}
+	}
+	if len(tags) == 0 {
+		return fmt.Sprintf("%s:%s|%s", name, value, typ)
+	}
+	return fmt.Sprintf("%s:%s|%s|#%s", name, value, typ, strings.Join(tags, ","))
+}
+
+// send writes the lines in as few datagrams as fit them.
+func (s *StatsdSink) send(lines []string) error {
+	var (
+		buf bytes.Buffer
+		res error
+	)
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			res = err
+		}
+		buf.Reset()
+	}
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(l) > statsdMaxPacket {
+			flush()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+	flush()
+	return res
+}
+
+// statsdSanitize keeps a label value from breaking the statsd metric name.
+func statsdSanitize(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, v)
+}
+
+// dogstatsdSanitize keeps a label value from breaking the DogStatsD tags.
+func dogstatsdSanitize(v string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(v)
+}
+
+// ParseStatsdTags parses the tags in the form of key1:value1,key2:value2.
+func ParseStatsdTags(s string) []string {
+	var res []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type StatsdTestSuite struct {
+	conn     net.PacketConn
+	registry *prometheus.Registry
+	gauge    *prometheus.GaugeVec
+	counter  prometheus.Counter
+}
+
+var _ = Suite(&StatsdTestSuite{})
+
+func (s *StatsdTestSuite) SetUpTest(c *C) {
+	var err error
+	s.conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	s.registry = prometheus.NewRegistry()
+	s.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "butler_test_gauge",
+		Help: "a test gauge",
+	}, []string{"manager", "file"})
+	s.counter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "butler_test_total",
+		Help: "a test counter",
+	})
+	notButler := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "go_test_gauge",
+		Help: "a test gauge which is not pushed",
+	})
+	notButler.Set(1)
+	s.registry.MustRegister(s.gauge, s.counter, notButler)
+}
+
+func (s *StatsdTestSuite) TearDownTest(c *C) {
+	s.conn.Close()
+}
+
+func (s *StatsdTestSuite) sink(c *C, opts StatsdOpts) *StatsdSink {
+	opts.Address = s.conn.LocalAddr().String()
+	sink, err := NewStatsdSink(opts)
+	c.Assert(err, IsNil)
+	sink.gatherer = s.registry
+	return sink
+}
+
+func (s *StatsdTestSuite) read(c *C) []string {
+	buf := make([]byte, 65536)
+	s.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := s.conn.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func (s *StatsdTestSuite) TestNewStatsdSinkErrors(c *C) {
+	_, err := NewStatsdSink(StatsdOpts{})
+	c.Assert(err, ErrorMatches, "no statsd address has been defined")
+	_, err = NewStatsdSink(StatsdOpts{Address: "127.0.0.1:8125", Format: "graphite"})
+	c.Assert(err, ErrorMatches, "unknown statsd format graphite.*")
+}
+
+func (s *StatsdTestSuite) TestPushStatsd(c *C) {
+	sink := s.sink(c, StatsdOpts{Prefix: "ops.", Tags: []string{"env:test"}})
+	s.gauge.WithLabelValues("prometheus", "/etc/prometheus.yml").Set(2.5)
+	s.gauge.WithLabelValues("prometheus", "").Set(1)
+	s.counter.Add(3)
+
+	c.Assert(sink.Push(), IsNil)
+	c.Assert(s.read(c), DeepEquals, []string{
+		"ops.butler_test_gauge.prometheus:1|g",
+		"ops.butler_test_gauge._etc_prometheus_yml.prometheus:2.5|g",
+		"ops.butler_test_total:3|c",
+	})
+
+	// Stop pushes the metrics a last time
+	c.Assert(sink.Stop(), IsNil)
+	c.Assert(s.read(c), DeepEquals, []string{
+		"ops.butler_test_gauge.prometheus:1|g",
+		"ops.butler_test_gauge._etc_prometheus_yml.prometheus:2.5|g",
+	})
+}
+
+func (s *StatsdTestSuite) TestPushDogStatsD(c *C) {
+	sink := s.sink(c, StatsdOpts{Format: FormatDogStatsD, Tags: ParseStatsdTags("env:test, dc:or1,")})
+	defer sink.Stop()
+	s.gauge.WithLabelValues("prometheus", "a,b").Set(-1)
+	s.counter.Add(3)
+
+	c.Assert(sink.Push(), IsNil)
+	c.Assert(s.read(c), DeepEquals, []string{
+		"butler_test_gauge:0|g|#env:test,dc:or1,file:a_b,manager:prometheus",
+		"butler_test_gauge:-1|g|#env:test,dc:or1,file:a_b,manager:prometheus",
+		"butler_test_total:3|c|#env:test,dc:or1",
+	})
+
+	// the counters are sent as their increase since the previous push, and
+	// not at all when they did not increase
+	s.counter.Add(2)
+	c.Assert(sink.Push(), IsNil)
+	c.Assert(s.read(c), DeepEquals, []string{
+		"butler_test_gauge:0|g|#env:test,dc:or1,file:a_b,manager:prometheus",
+		"butler_test_gauge:-1|g|#env:test,dc:or1,file:a_b,manager:prometheus",
+		"butler_test_total:2|c|#env:test,dc:or1",
+	})
+	s.gauge.Reset()
+	c.Assert(sink.Push(), IsNil)
+	s.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err := s.conn.ReadFrom(make([]byte, 1024))
+	c.Assert(err, NotNil)
+}
+
+func (s *StatsdTestSuite) TestSendSplitsPackets(c *C) {
+	sink := s.sink(c, StatsdOpts{})
+	defer sink.Stop()
+	line := strings.Repeat("a", 1000) + ":1|g"
+	c.Assert(sink.send([]string{line, line}), IsNil)
+	c.Assert(s.read(c), DeepEquals, []string{line})
+	c.Assert(s.read(c), DeepEquals, []string{line})
+}
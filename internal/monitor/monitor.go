@@ -5,17 +5,26 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/adobe/butler/internal/alog"
-	"github.com/adobe/butler/internal/config"
+	"github.com/adobe/butler/pkg/config"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
+// defaultAdminAddr is the address of the admin endpoints when the Opts have
+// none, which is on the loopback interface, so that they are not reachable by
+// whoever can scrape /metrics.
+const defaultAdminAddr = "127.0.0.1:8081"
+
 // NewMonitor returns a Monitor object which is used to bring up the
 // monitor health check and prometheus metrics http endpoints.
 func NewMonitor() *Monitor {
@@ -27,24 +36,35 @@ func NewMonitor() *Monitor {
 func (m *Monitor) WithOpts(opts *Opts) *Monitor {
 	m.config = opts.Config
 	m.version = opts.Version
+	m.adminAddr = opts.AdminAddr
+	if m.adminAddr == "" {
+		m.adminAddr = defaultAdminAddr
+	}
 	return m
 }
 
 // Monitor is the empty structure to be used for starting up the monitor
 // health check and prometheus metrics http endpoints.
 type Monitor struct {
-	config  *config.ButlerConfig
-	mux     *http.ServeMux
-	server  *http.Server
-	version string
+	config      *config.ButlerConfig
+	mux         *http.ServeMux
+	routed      bool
+	server      *http.Server
+	adminAddr   string
+	adminServer *http.Server
+	version     string
 }
 
 // Opts is an object which stores the Monitor object's configuration details
 // It expects a butler version which will be used for the monitor output,
-// and the butler configuration.
+// and the butler configuration. The admin endpoints are served on AdminAddr,
+// eg: "127.0.0.1:8081", which is the default, and never on the monitor
+// http-port. An AdminAddr without a host, eg: ":8081", listens on the loopback
+// interface.
 type Opts struct {
-	Version string
-	Config  *config.ButlerConfig
+	Version   string
+	Config    *config.ButlerConfig
+	AdminAddr string
 }
 
 // Output is the structure which holds the formatting which is output
@@ -60,48 +80,95 @@ type Output struct {
 	Version          string                `json:"version"`
 }
 
-// Start turns up the http server for monitoring butler.
+// Start turns up the http server for monitoring butler, and the admin http
+// server on its own listen address. The admin endpoints are only served on
+// the admin address, so that they are not reachable by whoever can scrape
+// /metrics.
 func (m *Monitor) Start() {
-	var (
-		err      error
-		listener net.Listener
-		mux      *http.ServeMux
-		server   *http.Server
-	)
 	if m.mux == nil {
-		mux = http.DefaultServeMux
-		mux.HandleFunc("/health-check", m.Handler)
-		mux.Handle("/metrics", promhttp.Handler())
-		m.mux = mux
+		m.mux = http.DefaultServeMux
+	}
+	if !m.routed {
+		m.mux.HandleFunc("/health-check", m.Handler)
+		m.mux.HandleFunc("/healthz", m.HealthzHandler)
+		m.mux.HandleFunc("/readyz", m.ReadyzHandler)
+		m.mux.Handle("/metrics", promhttp.Handler())
+		m.mux.HandleFunc("/v1/webhook", m.WebhookHandler)
+		m.routed = true
+	}
+
+	m.server = &http.Server{Handler: m.handler(m.mux)}
+	go m.server.Serve(m.listen(fmt.Sprintf(":%v", m.config.Config.Globals.HTTPPort)))
+
+	mux := http.NewServeMux()
+	m.adminRoutes(mux)
+	m.adminServer = &http.Server{Handler: m.handler(mux)}
+	go m.adminServer.Serve(m.listen(adminListenAddr(m.adminAddr)))
+}
+
+// adminListenAddr returns the address the admin endpoints listen on, which
+// is on the loopback interface unless the address has a host, eg: "8081" or
+// ":8081" listen on 127.0.0.1:8081.
+func adminListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = "", strings.TrimPrefix(addr, ":")
+	}
+	if host == "" {
+		host = "127.0.0.1"
 	}
+	return net.JoinHostPort(host, port)
+}
+
+// adminRoutes adds the admin endpoints to the mux.
+func (m *Monitor) adminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/status", m.StatusHandler)
+	mux.HandleFunc("/v1/status/", m.StatusHandler)
+	mux.HandleFunc("/v1/snapshots", m.SnapshotsHandler)
+	mux.HandleFunc("/v1/snapshots/", m.SnapshotsHandler)
+	mux.HandleFunc("/v1/rollback/", m.RollbackHandler)
+	mux.HandleFunc("/v1/pause/", m.PauseHandler)
+	mux.HandleFunc("/v1/resume/", m.PauseHandler)
+	mux.HandleFunc("/v1/run", m.RunHandler)
+	mux.HandleFunc("/v1/run/", m.RunHandler)
+	mux.HandleFunc("/v1/diffs", m.DiffsHandler)
+	mux.HandleFunc("/v1/diffs/", m.DiffsHandler)
+}
 
+// handler returns the handler of the mux, which logs the requests when
+// globals.enable-http-log is set.
+func (m *Monitor) handler(mux *http.ServeMux) http.Handler {
 	if m.config.Config.Globals.EnableHTTPLog {
-		loggingHandler := alog.NewApacheLoggingHandler(mux, m.config)
-		server = &http.Server{
-			Handler: loggingHandler,
-		}
-	} else {
-		server = &http.Server{}
+		return alog.NewApacheLoggingHandler(mux, m.config)
 	}
-	m.server = server
+	return mux
+}
+
+// listen returns the listener of the address, which serves https when
+// globals.http-proto is https.
+func (m *Monitor) listen(addr string) net.Listener {
+	var (
+		err      error
+		listener net.Listener
+	)
 	if m.config.Config.Globals.HTTPProto == "https" {
 		cer, err := tls.LoadX509KeyPair(m.config.Config.Globals.HTTPTLSCert, m.config.Config.Globals.HTTPTLSKey)
 		if err != nil {
 			log.Fatalf("Error loading ssl certificate/key data: %s", err.Error())
 		}
 		config := &tls.Config{Certificates: []tls.Certificate{cer}}
-		listener, err = tls.Listen("tcp", fmt.Sprintf(":%v", m.config.Config.Globals.HTTPPort), config)
+		listener, err = tls.Listen("tcp", addr, config)
 		if err != nil {
 			log.Fatalf("Error creating listener: %s", err.Error())
 		}
 	} else {
-		listener, err = net.Listen("tcp", fmt.Sprintf(":%v", m.config.Config.Globals.HTTPPort))
+		listener, err = net.Listen("tcp", addr)
 
 		if err != nil {
 			log.Fatalf("Error creating listener: %s", err.Error())
 		}
 	}
-	go server.Serve(listener)
+	return listener
 }
 
 // Stop is to shut down the butler webserver used for the monitor and health
@@ -118,6 +185,12 @@ func (m *Monitor) Stop() error {
 		}
 	}
 	m.server = nil
+	if m.adminServer != nil {
+		if err := m.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	m.adminServer = nil
 	return nil
 }
 
@@ -149,5 +222,367 @@ func (m *Monitor) Handler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, string(resp))
+	fmt.Fprint(w, string(resp))
+}
+
+// ProbeOutput is the structure which is returned by the /healthz and /readyz
+// endpoints. Reason tells why butler is not alive, or not ready.
+type ProbeOutput struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// HealthzHandler is the handler function for the /healthz liveness endpoint.
+// It returns 200 as long as butler runs on schedule, and 503 once the
+// scheduler has stopped.
+func (m *Monitor) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, m.config.Alive())
+}
+
+// ReadyzHandler is the handler function for the /readyz readiness endpoint.
+// It returns 503 until butler has retrieved and parsed the butler
+// configuration, and has attempted the first configuration management run,
+// and 200 from then on while it is alive.
+func (m *Monitor) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, m.config.Ready())
+}
+
+func probe(w http.ResponseWriter, err error) {
+	out := ProbeOutput{Status: "ok"}
+	code := http.StatusOK
+	if err != nil {
+		out = ProbeOutput{Status: "unavailable", Reason: err.Error()}
+		code = http.StatusServiceUnavailable
+	}
+	resp, _ := json.Marshal(out)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(resp)
+}
+
+// StatusOutput is the structure which is returned by the /v1/status
+// endpoint.
+type StatusOutput struct {
+	Version string `json:"version"`
+	*config.ButlerStatus
+}
+
+// StatusHandler is the handler function for the /v1/status endpoint. It
+// returns the state of butler, and of each manager: the outcome of its latest
+// runs and reload, the sums of its config files on disk, its schedule, and its
+// status record from the status file. /v1/status/<manager> returns the state
+// of a single manager.
+func (m *Monitor) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	var out interface{}
+
+	status := m.config.Status()
+	out = StatusOutput{Version: m.version, ButlerStatus: status}
+	if name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/status"), "/"); name != "" {
+		mgr, ok := status.Managers[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+			return
+		}
+		out = mgr
+	}
+
+	resp, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// SnapshotsHandler is the handler function for the /v1/snapshots endpoint.
+// /v1/snapshots returns the retained known good snapshots of every manager
+// which has caching enabled, and /v1/snapshots/<manager> those of a single
+// manager, newest first.
+func (m *Monitor) SnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	res := make(map[string][]*config.Snapshot)
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/snapshots"), "/")
+	for _, mgr := range m.config.GetManagers() {
+		if name != "" && mgr.Name != name {
+			continue
+		}
+		if mgr.Snapshots == nil {
+			res[mgr.Name] = []*config.Snapshot{}
+			continue
+		}
+		snaps, err := mgr.Snapshots.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res[mgr.Name] = snaps
+	}
+
+	if name != "" && len(res) == 0 {
+		http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// DiffsHandler is the handler function for the /v1/diffs endpoint. /v1/diffs
+// returns the retained diffs of every manager, and /v1/diffs/<manager> those
+// of a single manager, newest first. Secrets are masked out of the diffs.
+func (m *Monitor) DiffsHandler(w http.ResponseWriter, r *http.Request) {
+	res := make(map[string][]config.FileDiff)
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/diffs"), "/")
+	for _, mgr := range m.config.GetManagers() {
+		if name != "" && mgr.Name != name {
+			continue
+		}
+		res[mgr.Name] = mgr.Diffs.List()
+	}
+
+	if name != "" && len(res) == 0 {
+		http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+		return
+	}
+
+	resp, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// RollbackOutput is the structure which is returned by the /v1/rollback
+// endpoint.
+type RollbackOutput struct {
+	Manager  string `json:"manager"`
+	Snapshot string `json:"snapshot,omitempty"`
+	Reloaded bool   `json:"reloaded"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RollbackHandler is the handler function for the /v1/rollback/<manager>
+// endpoint. A POST restores the manager files from the snapshot given by the
+// snapshot query parameter, or the latest snapshot when it is not set, and
+// reloads the manager.
+func (m *Monitor) RollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/rollback"), "/")
+	mgr := m.config.GetManager(name)
+	if name == "" || mgr == nil {
+		http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+		return
+	}
+
+	out := RollbackOutput{Manager: name}
+	status := http.StatusOK
+	snap, err := m.config.Rollback(name, r.URL.Query().Get("snapshot"), fmt.Sprintf("api:%v", r.RemoteAddr))
+	if snap != nil {
+		out.Snapshot = snap.ID
+	}
+	if err != nil {
+		out.Error = err.Error()
+		if snap == nil {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+	} else {
+		out.Reloaded = true
+	}
+
+	resp, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// PauseOutput is the structure which is returned by the /v1/pause and
+// /v1/resume endpoints.
+type PauseOutput struct {
+	Manager string             `json:"manager"`
+	Paused  bool               `json:"paused"`
+	State   *config.PauseState `json:"state,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// PauseHandler is the handler function for the /v1/pause/<manager> and
+// /v1/resume/<manager> endpoints. A POST to /v1/pause stops butler from
+// managing the files of the manager, with the optional reason query
+// parameter, until a POST to /v1/resume. A GET returns whether the manager is
+// paused.
+func (m *Monitor) PauseHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		name string
+	)
+	resume := strings.HasPrefix(r.URL.Path, "/v1/resume")
+	if resume {
+		name = strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/resume"), "/")
+	} else {
+		name = strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/pause"), "/")
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		w.Header().Set("Allow", fmt.Sprintf("%v, %v", http.MethodGet, http.MethodPost))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if name == "" || m.config.GetManager(name) == nil {
+		http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+		return
+	}
+
+	out := PauseOutput{Manager: name}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		actor := fmt.Sprintf("api:%v", r.RemoteAddr)
+		if resume {
+			err = m.config.Resume(name, actor)
+		} else {
+			_, err = m.config.Pause(name, r.URL.Query().Get("reason"), actor)
+		}
+	}
+	if err != nil {
+		out.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	out.State = config.GetManagerPaused(m.config.GetStatusFile(), name)
+	out.Paused = out.State != nil
+
+	resp, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// RunOutput is the structure which is returned by the /v1/run endpoint.
+type RunOutput struct {
+	Managers []string `json:"managers"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// RunHandler is the handler function for the /v1/run endpoint. A POST to
+// /v1/run runs the configuration management of every manager which is not
+// paused right away, and /v1/run/<manager> that of a single manager, instead
+// of waiting for the next scheduled run. It returns once the run is done.
+func (m *Monitor) RunHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	out := RunOutput{Managers: []string{}}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/run"), "/")
+	if name == "" {
+		for _, mgr := range m.config.GetManagers() {
+			if config.GetManagerPaused(m.config.GetStatusFile(), mgr.Name) == nil {
+				out.Managers = append(out.Managers, mgr.Name)
+			}
+		}
+		sort.Strings(out.Managers)
+		err = m.config.RunCMHandler()
+	} else {
+		if m.config.GetManager(name) == nil {
+			http.Error(w, fmt.Sprintf("unknown manager %v", name), http.StatusNotFound)
+			return
+		}
+		if config.GetManagerPaused(m.config.GetStatusFile(), name) != nil {
+			http.Error(w, fmt.Sprintf("manager %v is paused", name), http.StatusConflict)
+			return
+		}
+		out.Managers = append(out.Managers, name)
+		err = m.config.RunManager(name)
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		out.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	resp, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// maxWebhookSize is the largest webhook payload butler reads, that of GitHub.
+const maxWebhookSize = 25 << 20
+
+// WebhookHandler is the handler function for the /v1/webhook endpoint, which
+// GitHub and GitLab push webhooks are sent to. The managers whose
+// webhook-repo was pushed to are run in the background, and the endpoint
+// returns them right away, as the webhooks time out after 10 seconds. The
+// endpoint is only served with a globals.webhook-secret, which the webhooks
+// must be signed with.
+func (m *Monitor) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := m.config.Config.Globals.WebhookSecret
+	if secret == "" {
+		http.Error(w, "webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	push, err := config.ParsePush(r.Header, body, secret)
+	if err == config.ErrWebhookUnauthorized {
+		log.Warnf("Monitor::WebhookHandler(): rejecting a webhook from %v. err=%v", r.RemoteAddr, err.Error())
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := RunOutput{Managers: []string{}}
+	status := http.StatusOK
+	if push != nil {
+		if managers := m.config.RunPushed(push); len(managers) > 0 {
+			out.Managers = managers
+			status = http.StatusAccepted
+		}
+	}
+	resp, err := json.Marshal(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
 }
@@ -16,18 +16,24 @@ import (
 	. "gopkg.in/check.v1"
 
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	//"net/http/httptest"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
-	//"time"
+	"time"
 
-	"github.com/adobe/butler/internal/config"
-	"github.com/adobe/butler/internal/methods"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/pkg/config"
+	"github.com/adobe/butler/pkg/methods"
 	//log "github.com/sirupsen/logrus"
 )
 
@@ -154,3 +160,360 @@ func (s *ButlerTestSuite) TestStartHTTPs(c *C) {
 	buf.ReadFrom(resp.Body)
 	c.Assert(buf.String(), Matches, `.*"http-proto\":\"https\",\"http-port\":58532,.*`)
 }
+
+func (s *ButlerTestSuite) TestSnapshotsHandler(c *C) {
+	dir, err := ioutil.TempDir("", "bsnapshots")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("foo: bar\n"), 0644), IsNil)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	mgr := &config.Manager{Name: "prometheus", Snapshots: config.NewSnapshotStore("prometheus", dir+"/cache", 5)}
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": mgr}
+	snap, err := mgr.Snapshots.Save([]string{dir + "/prometheus.yml"})
+	c.Assert(err, IsNil)
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.SnapshotsHandler(w, httptest.NewRequest("GET", "/v1/snapshots/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, fmt.Sprintf(`.*"prometheus":\[\{"id":"%v".*`, snap.ID))
+
+	w = httptest.NewRecorder()
+	m.SnapshotsHandler(w, httptest.NewRequest("GET", "/v1/snapshots/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
+
+func (s *ButlerTestSuite) TestDiffsHandler(c *C) {
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	diffs, err := config.NewDiffStore("prometheus", 5, false, nil)
+	c.Assert(err, IsNil)
+	diffs.Record("prometheus.yml", []byte("foo: bar\npassword: foo\n"), []byte("foo: baz\npassword: bar\n"), false)
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": &config.Manager{Name: "prometheus", Diffs: diffs}}
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.DiffsHandler(w, httptest.NewRequest("GET", "/v1/diffs/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `.*"file":"prometheus.yml".*\+foo: baz.*`)
+	c.Assert(strings.Contains(w.Body.String(), "password: bar"), Equals, false)
+
+	w = httptest.NewRecorder()
+	m.DiffsHandler(w, httptest.NewRequest("GET", "/v1/diffs/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
+
+func (s *ButlerTestSuite) TestRollbackHandler(c *C) {
+	dir, err := ioutil.TempDir("", "brollback")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("foo: bar\n"), 0644), IsNil)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	mgr := &config.Manager{Name: "prometheus", Snapshots: config.NewSnapshotStore("prometheus", dir+"/cache", 5)}
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": mgr}
+	snap, err := mgr.Snapshots.Save([]string{dir + "/prometheus.yml"})
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("foo: wrong\n"), 0644), IsNil)
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.RollbackHandler(w, httptest.NewRequest("GET", "/v1/rollback/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	m.RollbackHandler(w, httptest.NewRequest("POST", "/v1/rollback/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	m.RollbackHandler(w, httptest.NewRequest("POST", "/v1/rollback/prometheus?snapshot=nonexistent", nil))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+
+	w = httptest.NewRecorder()
+	m.RollbackHandler(w, httptest.NewRequest("POST", "/v1/rollback/prometheus?snapshot="+snap.ID[:6], nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, fmt.Sprintf(`{"manager":"prometheus","snapshot":"%v","reloaded":true}`, snap.ID))
+	data, err := ioutil.ReadFile(dir + "/prometheus.yml")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "foo: bar\n")
+	c.Assert(config.GetManagerStatus(bc.GetStatusFile(), "prometheus"), Equals, true)
+}
+
+func (s *ButlerTestSuite) TestPauseHandler(c *C) {
+	dir, err := ioutil.TempDir("", "bpause")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": &config.Manager{Name: "prometheus"}}
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.PauseHandler(w, httptest.NewRequest("DELETE", "/v1/pause/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	m.PauseHandler(w, httptest.NewRequest("POST", "/v1/pause/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	m.PauseHandler(w, httptest.NewRequest("POST", "/v1/pause/prometheus?reason=INC-1234", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `\{"manager":"prometheus","paused":true,"state":\{.*"reason":"INC-1234"\}\}`)
+	c.Assert(config.GetManagerPaused(bc.GetStatusFile(), "prometheus"), NotNil)
+
+	w = httptest.NewRecorder()
+	m.PauseHandler(w, httptest.NewRequest("GET", "/v1/pause/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `.*"paused":true.*`)
+
+	w = httptest.NewRecorder()
+	m.PauseHandler(w, httptest.NewRequest("POST", "/v1/resume/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"manager":"prometheus","paused":false}`)
+	c.Assert(config.GetManagerPaused(bc.GetStatusFile(), "prometheus"), IsNil)
+}
+
+func (s *ButlerTestSuite) TestRunHandler(c *C) {
+	dir, err := ioutil.TempDir("", "brun")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	bc.Config.Managers = map[string]*config.Manager{
+		"prometheus":   &config.Manager{Name: "prometheus"},
+		"alertmanager": &config.Manager{Name: "alertmanager"},
+	}
+	c.Assert(config.SetManagerPaused(bc.GetStatusFile(), "alertmanager", &config.PauseState{}), IsNil)
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.RunHandler(w, httptest.NewRequest("GET", "/v1/run", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+
+	w = httptest.NewRecorder()
+	m.RunHandler(w, httptest.NewRequest("POST", "/v1/run/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	m.RunHandler(w, httptest.NewRequest("POST", "/v1/run/alertmanager", nil))
+	c.Assert(w.Code, Equals, http.StatusConflict)
+
+	w = httptest.NewRecorder()
+	m.RunHandler(w, httptest.NewRequest("POST", "/v1/run/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"managers":["prometheus"]}`)
+	c.Assert(bc.GetManager("prometheus").LastRun.IsZero(), Equals, false)
+	c.Assert(bc.GetManager("alertmanager").LastRun.IsZero(), Equals, true)
+
+	w = httptest.NewRecorder()
+	m.RunHandler(w, httptest.NewRequest("POST", "/v1/run", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"managers":["prometheus"]}`)
+	c.Assert(bc.GetManager("alertmanager").LastRun.IsZero(), Equals, true)
+}
+
+func (s *ButlerTestSuite) TestWebhookHandler(c *C) {
+	dir, err := ioutil.TempDir("", "bwebhook")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	bc.Config.Managers = map[string]*config.Manager{
+		"webhook-prometheus": &config.Manager{Name: "webhook-prometheus", WebhookRepo: "monitoring/configs", WebhookPaths: []string{"prometheus"}},
+		"webhook-other":      &config.Manager{Name: "webhook-other", WebhookRepo: "monitoring/other"},
+	}
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+	push := []byte(`{"ref":"refs/heads/main","repository":{"full_name":"monitoring/configs","default_branch":"main"},"commits":[{"modified":["prometheus/prometheus.yml"]}]}`)
+	webhook := func(event string, body []byte, secret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/webhook", bytes.NewReader(body))
+		r.Header.Set("X-GitHub-Event", event)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		m.WebhookHandler(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	m.WebhookHandler(w, httptest.NewRequest("GET", "/v1/webhook", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+
+	// webhooks are only accepted with a secret
+	c.Assert(webhook("push", push, "").Code, Equals, http.StatusNotFound)
+	bc.Config.Globals.WebhookSecret = "s3cr3t"
+	c.Assert(webhook("push", push, "guess").Code, Equals, http.StatusUnauthorized)
+	c.Assert(webhook("push", []byte("{"), "s3cr3t").Code, Equals, http.StatusBadRequest)
+
+	w = webhook("ping", []byte(`{"zen":"Keep it logically awesome."}`), "s3cr3t")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"managers":[]}`)
+
+	w = webhook("push", push, "s3cr3t")
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+	c.Assert(w.Body.String(), Equals, `{"managers":["webhook-prometheus"]}`)
+	for i := 0; i < 100 && config.GetRunStatus("webhook-prometheus").LastRun.IsZero(); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.Assert(config.GetRunStatus("webhook-prometheus").LastRun.IsZero(), Equals, false)
+	c.Assert(config.GetRunStatus("webhook-other").LastRun.IsZero(), Equals, true)
+}
+
+func (s *ButlerTestSuite) TestStatusHandler(c *C) {
+	dir, err := ioutil.TempDir("", "bstatus")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": &config.Manager{Name: "prometheus"}}
+	c.Assert(config.RecordManagerStatus(bc.GetStatusFile(), "prometheus", config.StatusFailed, "", errors.New("reload failed")), IsNil)
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.StatusHandler(w, httptest.NewRequest("GET", "/v1/status/unknown", nil))
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	m.StatusHandler(w, httptest.NewRequest("GET", "/v1/status/prometheus", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, `\{"last-run":.*"status":"failed","consecutive-failures":1,"history":\[\{.*"error":"reload failed"\}\]\}`)
+}
+
+func (s *ButlerTestSuite) TestAdminServer(c *C) {
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.HTTPProto = "http"
+	bc.Config.Globals.HTTPPort = 58533
+	bc.Config.Managers = map[string]*config.Manager{"prometheus": &config.Manager{Name: "prometheus"}}
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3", AdminAddr: "127.0.0.1:58534"})
+	// keep the monitor endpoints off the default mux of the other tests
+	m.mux = http.NewServeMux()
+	m.Start()
+	defer m.Stop()
+
+	resp, err := http.Get("http://127.0.0.1:58534/v1/status")
+	c.Assert(err, IsNil)
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(buf.String(), Matches, `\{"version":"1.2.3","config-url":"https://localhost",.*"managers":\{"prometheus":\{"last-run":.*"files":\{\}.*`)
+
+	// the admin address only serves the admin endpoints
+	resp, err = http.Get("http://127.0.0.1:58534/metrics")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	// and they are taken off the monitor http-port
+	resp, err = http.Post("http://127.0.0.1:58533/v1/run", "text/plain", nil)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+	resp, err = http.Get("http://127.0.0.1:58533/metrics")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	// an admin address without a host listens on the loopback interface
+	c.Assert(adminListenAddr(":8081"), Equals, "127.0.0.1:8081")
+	c.Assert(adminListenAddr("8081"), Equals, "127.0.0.1:8081")
+	c.Assert(adminListenAddr("0.0.0.0:8081"), Equals, "0.0.0.0:8081")
+	c.Assert(adminListenAddr("[::1]:8081"), Equals, "[::1]:8081")
+}
+
+func (s *ButlerTestSuite) TestAdminServerDefault(c *C) {
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	bc.Config.Globals.HTTPProto = "http"
+	bc.Config.Globals.HTTPPort = 58535
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+	c.Assert(m.adminAddr, Equals, defaultAdminAddr)
+	m.mux = http.NewServeMux()
+	m.Start()
+	defer m.Stop()
+
+	// without an admin address, the admin endpoints are still not on the
+	// public mux
+	for _, path := range []string{"/v1/run", "/v1/run/prometheus", "/v1/status", "/v1/pause/prometheus", "/v1/rollback/prometheus"} {
+		w := httptest.NewRecorder()
+		m.mux.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		c.Assert(w.Code, Equals, http.StatusNotFound, Commentf("path %v", path))
+	}
+	resp, err := http.Post("http://127.0.0.1:58535/v1/run", "text/plain", nil)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	// but on the loopback interface
+	resp, err = http.Get("http://" + defaultAdminAddr + "/v1/status")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+}
+
+func (s *ButlerTestSuite) TestProbeHandlers(c *C) {
+	u, err := url.Parse("https://localhost")
+	c.Assert(err, IsNil)
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{InsecureSkipVerify: true, URL: u})
+	c.Assert(err, IsNil)
+	bc.Config = config.NewConfigSettings()
+	m := NewMonitor().WithOpts(&Opts{Config: bc, Version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	m.HealthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Equals, `{"status":"ok"}`)
+
+	w = httptest.NewRecorder()
+	m.ReadyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Body.String(), Equals, `{"status":"unavailable","reason":"the butler configuration has not been retrieved yet"}`)
+
+	// a scheduler which has not started, or has stopped
+	bc.SetScheduler(scheduler.NewScheduler())
+	w = httptest.NewRecorder()
+	m.HealthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Body.String(), Equals, `{"status":"unavailable","reason":"the scheduler is not running"}`)
+}
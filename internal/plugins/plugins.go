@@ -0,0 +1,170 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package plugins finds and runs the out-of-tree retrieval methods and
+// reloaders of butler. A plugin is an executable in the plugins directory,
+// named butler-method-<name> or butler-reloader-<name>, which provides the
+// method, or reloader, <name>. butler runs the plugin with the operation as
+// its only argument, eg: butler-method-vault get, and writes the request to
+// its stdin as JSON. The plugin writes its result to stdout, and exits
+// non-zero, with the reason on stderr, when the operation failed.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The prefixes of the names of the plugin executables.
+const (
+	MethodPrefix   = "butler-method-"
+	ReloaderPrefix = "butler-reloader-"
+)
+
+// maxStderr is how much of the stderr of a failed plugin is kept in its
+// error.
+const maxStderr = 512
+
+// Registry holds the plugins of one kind, eg: the method plugins, by the
+// name of the method, or reloader, which they provide.
+type Registry struct {
+	prefix   string
+	builtins []string
+	lock     sync.RWMutex
+	paths    map[string]string
+}
+
+// NewRegistry returns a Registry of the plugins whose names start with the
+// prefix. The builtins, which are built into butler, can not be replaced by a
+// plugin.
+func NewRegistry(prefix string, builtins ...string) *Registry {
+	return &Registry{prefix: prefix, builtins: builtins, paths: make(map[string]string)}
+}
+
+// Load registers the plugins in the dir, and returns their names.
+func (r *Registry) Load(dir string) ([]string, error) {
+	found, err := find(dir, r.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var res []string
+	for name, path := range found {
+		if containsString(r.builtins, name) {
+			log.Warnf("Registry::Load(): skipping %v, %v is built into butler.", path, name)
+			continue
+		}
+		log.Debugf("Registry::Load(): registered %v for %v.", path, name)
+		r.paths[name] = path
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Path returns the path of the plugin which provides the name.
+func (r *Registry) Path(name string) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	path, ok := r.paths[strings.ToLower(name)]
+	return path, ok
+}
+
+// Names returns the names which are provided by plugins.
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var res []string
+	for name := range r.paths {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// find returns the paths of the executables in the dir whose names start
+// with the prefix, by the rest of their names.
+func find(dir string, prefix string) (map[string]string, error) {
+	res := make(map[string]string)
+	if dir == "" {
+		return res, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return res, fmt.Errorf("could not read plugins directory %v. err=%v", dir, err.Error())
+	}
+	for _, f := range files {
+		name := strings.TrimPrefix(f.Name(), prefix)
+		if name == f.Name() || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		// follow symlinks, eg: to a plugin installed elsewhere
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() || stat.Mode()&0111 == 0 {
+			log.Warnf("plugins.find(): skipping %v, which is not an executable file.", path)
+			continue
+		}
+		res[strings.ToLower(name)] = path
+	}
+	return res, nil
+}
+
+// Run runs the operation of the plugin at the path with the request on its
+// stdin, and returns its stdout. The plugin is killed once ctx is done.
+func Run(ctx context.Context, path string, op string, req interface{}) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, op)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("plugin %v %v: %v", filepath.Base(path), op, ctx.Err().Error())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = "..." + msg[len(msg)-maxStderr:]
+		}
+		return nil, fmt.Errorf("plugin %v %v failed: %v: %v", filepath.Base(path), op, err.Error(), msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a cron expression schedule. It has an optional seconds field in
+// front of the usual five fields, and an optional time zone.
+type Cron struct {
+	spec   string
+	second field
+	minute field
+	hour   field
+	dom    field
+	month  field
+	dow    field
+	loc    *time.Location
+}
+
+// field is the set of values a cron field matches. restricted is false for
+// "*", which matters for the day of month and day of week fields.
+type field struct {
+	bits       uint64
+	restricted bool
+}
+
+// has returns whether the field matches v.
+func (f field) has(v int) bool {
+	return f.bits&(1<<uint(v)) != 0
+}
+
+var (
+	descriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dowNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCron parses a "[CRON_TZ=<zone>] [<second>] <minute> <hour> <day of
+// month> <month> <day of week>" cron expression, or one of the @yearly,
+// @monthly, @weekly, @daily and @hourly descriptors. The fields take "*",
+// values, ranges, lists and steps, eg: "*/15", "1-5" or "0,30", and the month
+// and day of week fields also take names, eg: "jan" or "mon-fri". The day of
+// week is 0 to 6, sunday being 0 (or 7). Without a seconds field the schedule
+// runs at second 0, and without a time zone in the local time zone.
+func ParseCron(spec string) (*Cron, error) {
+	var err error
+	res := &Cron{spec: strings.Join(strings.Fields(spec), " "), loc: time.Local}
+
+	fields := strings.Fields(spec)
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "CRON_TZ=") || strings.HasPrefix(fields[0], "TZ=")) {
+		zone := fields[0][strings.Index(fields[0], "=")+1:]
+		res.loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q in cron expression %q", zone, spec)
+		}
+		fields = fields[1:]
+	}
+	if len(fields) == 1 && strings.HasPrefix(fields[0], "@") {
+		d, ok := descriptors[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown descriptor %q in cron expression %q", fields[0], spec)
+		}
+		fields = strings.Fields(d)
+	}
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid cron expression %q, expected \"[<second>] <minute> <hour> <day of month> <month> <day of week>\"", spec)
+	}
+
+	bounds := [][2]int{{0, 59}, {0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := []map[string]int{nil, nil, nil, nil, monthNames, dowNames}
+	parsed := make([]field, 6)
+	for i := range parsed {
+		parsed[i], err = parseField(fields[i], bounds[i][0], bounds[i][1], names[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", spec, err.Error())
+		}
+	}
+	// sunday is both 0 and 7
+	if parsed[5].has(7) {
+		parsed[5].bits |= 1
+	}
+	res.second, res.minute, res.hour, res.dom, res.month, res.dow = parsed[0], parsed[1], parsed[2], parsed[3], parsed[4], parsed[5]
+	return res, nil
+}
+
+func parseField(spec string, min int, max int, names map[string]int) (field, error) {
+	res := field{restricted: spec != "*" && spec != "?"}
+	for _, part := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return res, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = parseValue(bounds[0], names)
+			if err != nil {
+				return res, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = parseValue(bounds[1], names)
+				if err != nil {
+					return res, err
+				}
+			} else if step > 1 {
+				// "5/15" is every 15 starting at 5
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return res, fmt.Errorf("%q is out of range %v-%v", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			res.bits |= 1 << uint(v)
+		}
+	}
+	if res.bits == 0 {
+		return res, errors.New("empty field")
+	}
+	return res, nil
+}
+
+func parseValue(v string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(v)]; ok {
+		return n, nil
+	}
+	res, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", v)
+	}
+	return res, nil
+}
+
+// String returns the cron expression.
+func (c *Cron) String() string {
+	return c.spec
+}
+
+// Location returns the time zone of the schedule.
+func (c *Cron) Location() *time.Location {
+	return c.loc
+}
+
+// Matches returns whether the schedule runs at the second of t. Like cron,
+// when both the day of month and the day of week are restricted, either of
+// them matching is enough.
+func (c *Cron) Matches(t time.Time) bool {
+	t = t.In(c.loc)
+	return c.second.has(t.Second()) && c.minute.has(t.Minute()) && c.hour.has(t.Hour()) && c.month.has(int(t.Month())) && c.dayMatches(t)
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.dom.restricted && c.dow.restricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first time after t the schedule runs, or the zero time if
+// it never does, eg: for the 30th of february.
+func (c *Cron) Next(t time.Time) time.Time {
+	orig := t.Location()
+	t = t.In(c.loc)
+	// start from the next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	limit := t.Year() + 5
+	truncated := false
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+	for !c.month.has(int(t.Month())) {
+		if !truncated {
+			truncated = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, c.loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !c.dayMatches(t) {
+		if !truncated {
+			truncated = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// midnight may be skipped by a daylight saving time change
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for !c.hour.has(t.Hour()) {
+		if !truncated {
+			truncated = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, c.loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for !c.minute.has(t.Minute()) {
+		if !truncated {
+			truncated = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, c.loc)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	for !c.second.has(t.Second()) {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	return t.In(orig)
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Schedule is when a job runs.
+type Schedule interface {
+	// Next returns the first time after t the job runs, or the zero time if
+	// it never runs again.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every returns a schedule which runs every interval.
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return fmt.Sprintf("@every %v", time.Duration(e))
+}
+
+var (
+	splayMutex sync.Mutex
+	splayRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+type splayed struct {
+	schedule Schedule
+	splay    time.Duration
+}
+
+// WithSplay returns a schedule which runs up to splay after schedule does, by
+// a random amount which is picked for every run. This keeps many butler
+// instances on the same schedule from all hitting the origin at once.
+func WithSplay(schedule Schedule, splay time.Duration) Schedule {
+	if splay <= 0 {
+		return schedule
+	}
+	return splayed{schedule: schedule, splay: splay}
+}
+
+func (s splayed) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t)
+	if next.IsZero() {
+		return next
+	}
+	splayMutex.Lock()
+	defer splayMutex.Unlock()
+	return next.Add(time.Duration(splayRand.Int63n(int64(s.splay) + 1)))
+}
+
+func (s splayed) String() string {
+	return fmt.Sprintf("%v with splay %v", s.schedule, s.splay)
+}
+
+// Parse parses an "@every <duration>" schedule, eg: "@every 5m", or a cron
+// expression, see ParseCron.
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) > 0 && fields[0] == "@every" {
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid schedule %q, expected \"@every <duration>\"", spec)
+		}
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q, the duration must be at least 1s", spec)
+		}
+		return Every(d), nil
+	}
+	return ParseCron(spec)
+}
+
+// Scheduler runs named jobs on their schedules. Runs of the same job never
+// overlap: a run which is due while the previous run of the job is still in
+// flight is skipped, and the next run is computed from the time the previous
+// one finished. A job which panics is recovered, and runs again on its
+// schedule.
+type Scheduler struct {
+	mutex   sync.Mutex
+	jobs    map[string]*job
+	running map[string]bool
+	// runStart is when the runs which are in flight started, by job name.
+	runStart map[string]time.Time
+	started  bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopped  chan bool
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       func(ctx context.Context)
+	timer    *time.Timer
+	next     time.Time
+}
+
+// NewScheduler returns an empty Scheduler. Jobs only run once it has been
+// started.
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*job), running: make(map[string]bool), runStart: make(map[string]time.Time), stopped: make(chan bool)}
+}
+
+// Add schedules fn to run as the job name on schedule. A job of the same name
+// is replaced, unless its schedule is the same, in which case it keeps its
+// next run and Add returns false. The context which fn is called with is
+// cancelled when the scheduler is stopped.
+func (s *Scheduler) Add(name string, schedule Schedule, fn func(ctx context.Context)) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if j, ok := s.jobs[name]; ok {
+		if j.schedule.String() == schedule.String() {
+			j.fn = fn
+			return false
+		}
+		s.remove(j)
+	}
+	j := &job{name: name, schedule: schedule, fn: fn}
+	s.jobs[name] = j
+	log.Debugf("Scheduler::Add(): scheduling job %v %v", name, schedule)
+	// a job which replaces one that is still running is armed once that run
+	// is done
+	if s.started && !s.running[name] {
+		s.arm(j, time.Now())
+	}
+	return true
+}
+
+// Remove removes the job name. A run which is in flight is not interrupted.
+func (s *Scheduler) Remove(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if j, ok := s.jobs[name]; ok {
+		s.remove(j)
+	}
+}
+
+func (s *Scheduler) remove(j *job) {
+	log.Debugf("Scheduler::Remove(): removing job %v", j.name)
+	if j.timer != nil {
+		j.timer.Stop()
+		j.timer = nil
+	}
+	delete(s.jobs, j.name)
+}
+
+// Jobs returns the names of the jobs, sorted.
+func (s *Scheduler) Jobs() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// NextRun returns when the job name runs next, and whether it is scheduled to
+// run at all.
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if j, ok := s.jobs[name]; ok && j.timer != nil {
+		return j.next, true
+	}
+	return time.Time{}, false
+}
+
+// Schedule returns the schedule of the job name, and whether there is such a
+// job.
+func (s *Scheduler) Schedule(name string) (Schedule, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if j, ok := s.jobs[name]; ok {
+		return j.schedule, true
+	}
+	return nil, false
+}
+
+// Start starts running the jobs. The returned channel is closed once the
+// scheduler has been stopped.
+func (s *Scheduler) Start() chan bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.started {
+		s.started = true
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		now := time.Now()
+		for name, j := range s.jobs {
+			if !s.running[name] {
+				s.arm(j, now)
+			}
+		}
+	}
+	return s.stopped
+}
+
+// Running returns whether the scheduler has been started, and not stopped
+// since.
+func (s *Scheduler) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.started
+}
+
+// Overdue returns the names of the jobs, sorted, whose runs are overdue by
+// more than grace: the run which came due has not started, or the run in
+// flight has not finished by the time the next one came due, eg: as it is
+// stuck on a download which never returns. A scheduler with overdue jobs is
+// wedged, rather than stopped.
+func (s *Scheduler) Overdue(grace time.Duration) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var res []string
+	if !s.started {
+		return res
+	}
+	now := time.Now()
+	for name, j := range s.jobs {
+		due := j.next
+		if s.running[name] {
+			due = j.schedule.Next(s.runStart[name])
+		} else if j.timer == nil {
+			continue
+		}
+		if !due.IsZero() && now.Sub(due) > grace {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Stop stops running the jobs, cancels the context of the runs which are in
+// flight and waits for them to return.
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	if !s.started {
+		s.mutex.Unlock()
+		return
+	}
+	s.started = false
+	s.cancel()
+	for _, j := range s.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+			j.timer = nil
+		}
+	}
+	stopped := s.stopped
+	s.stopped = make(chan bool)
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	close(stopped)
+}
+
+// arm sets the timer of the next run of the job after now. The caller holds
+// the mutex.
+func (s *Scheduler) arm(j *job, now time.Time) {
+	j.timer = nil
+	j.next = j.schedule.Next(now)
+	if j.next.IsZero() {
+		log.Warnf("Scheduler::arm(): job %v %v never runs again.", j.name, j.schedule)
+		return
+	}
+	j.timer = time.AfterFunc(j.next.Sub(now), func() { s.run(j) })
+}
+
+func (s *Scheduler) run(j *job) {
+	s.mutex.Lock()
+	if s.jobs[j.name] != j || !s.started || s.running[j.name] {
+		s.mutex.Unlock()
+		return
+	}
+	j.timer = nil
+	fn, ctx := j.fn, s.ctx
+	start := time.Now()
+	s.running[j.name] = true
+	s.runStart[j.name] = start
+	s.wg.Add(1)
+	s.mutex.Unlock()
+
+	log.Debugf("Scheduler::run(): running job %v", j.name)
+	if call(ctx, j.name, fn) {
+		metrics.SetButlerSchedulerJobVal(metrics.SUCCESS, j.name)
+	} else {
+		metrics.SetButlerSchedulerJobVal(metrics.FAILURE, j.name)
+	}
+	finish := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	defer s.wg.Done()
+	delete(s.running, j.name)
+	delete(s.runStart, j.name)
+
+	// the runs which came due while this one was in flight are skipped
+	skipped := 0
+	for next := j.schedule.Next(start); !next.IsZero() && next.Before(finish) && skipped < 1000; next = j.schedule.Next(next) {
+		skipped++
+	}
+	if skipped > 0 {
+		log.Warnf("Scheduler::run(): job %v ran for %v, skipped %v runs which came due in the meantime.", j.name, finish.Sub(start), skipped)
+		metrics.SetButlerSchedulerOverrun(j.name, skipped)
+	}
+
+	// the job may have been replaced in the meantime
+	if cur, ok := s.jobs[j.name]; ok && s.started && cur.timer == nil {
+		s.arm(cur, finish)
+	}
+}
+
+// call runs fn, and recovers it from a panic. It returns whether fn returned
+// without panicking.
+func call(ctx context.Context, name string, fn func(ctx context.Context)) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Scheduler::run(): job %v panicked. err=%v\n%s", name, r, debug.Stack())
+			ok = false
+		}
+	}()
+	fn(ctx)
+	return true
+}
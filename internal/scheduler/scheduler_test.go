@@ -0,0 +1,216 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SchedulerTestSuite struct {
+}
+
+var _ = Suite(&SchedulerTestSuite{})
+
+func (s *SchedulerTestSuite) TestParseCron(c *C) {
+	for _, spec := range []string{"*/15 9-17 * * 1-5", "30 */5 * * * *", "0 0 1 jan,jul *", "0 22 * * fri,sat,sun", "CRON_TZ=UTC 0 0 * * *", "TZ=Europe/Berlin 0 30 6 * * mon", "@daily", "CRON_TZ=UTC @hourly", "5/20 * * * 7"} {
+		_, err := ParseCron(spec)
+		c.Assert(err, IsNil, Commentf("spec %v", spec))
+	}
+	for _, spec := range []string{"", "* * * *", "* * * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@fortnightly", "CRON_TZ=Nowhere/Special * * * * *"} {
+		_, err := ParseCron(spec)
+		c.Assert(err, NotNil, Commentf("spec %v", spec))
+	}
+
+	sched, err := Parse("@every 5m")
+	c.Assert(err, IsNil)
+	c.Assert(sched.String(), Equals, "@every 5m0s")
+	_, err = Parse("@every 10ms")
+	c.Assert(err, NotNil)
+	_, err = Parse("@every")
+	c.Assert(err, NotNil)
+}
+
+func (s *SchedulerTestSuite) TestCronNext(c *C) {
+	utc := func(spec string) *Cron {
+		res, err := ParseCron("CRON_TZ=UTC " + spec)
+		c.Assert(err, IsNil)
+		return res
+	}
+	// friday 16 october 2026
+	t := time.Date(2026, time.October, 16, 10, 14, 30, 500, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, time.October, 16, 10, 15, 0, 0, time.UTC)},
+		{"*/20 * * * * *", time.Date(2026, time.October, 16, 10, 14, 40, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 1", time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.October, 16, 11, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		c.Assert(utc(test.spec).Next(t).Equal(test.next), Equals, true, Commentf("spec %v next %v", test.spec, utc(test.spec).Next(t)))
+	}
+	c.Assert(utc("0 0 30 2 *").Next(t).IsZero(), Equals, true)
+	c.Assert(utc("*/15 * * * *").Matches(time.Date(2026, time.October, 16, 10, 15, 0, 0, time.UTC)), Equals, true)
+	c.Assert(utc("*/15 * * * *").Matches(time.Date(2026, time.October, 16, 10, 15, 1, 0, time.UTC)), Equals, false)
+
+	// the time zone of the schedule applies, not that of t
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	c.Assert(err, IsNil)
+	sched, err := ParseCron("CRON_TZ=Europe/Berlin 0 6 * * *")
+	c.Assert(err, IsNil)
+	next := sched.Next(t)
+	c.Assert(next.Equal(time.Date(2026, time.October, 17, 6, 0, 0, 0, berlin)), Equals, true)
+	c.Assert(next.Location(), Equals, time.UTC)
+}
+
+func (s *SchedulerTestSuite) TestWithSplay(c *C) {
+	t := time.Date(2026, time.October, 16, 10, 14, 30, 0, time.UTC)
+	c.Assert(WithSplay(Every(time.Minute), 0), Equals, Every(time.Minute))
+
+	sched := WithSplay(Every(time.Minute), 10*time.Second)
+	c.Assert(sched.String(), Equals, "@every 1m0s with splay 10s")
+	seen := make(map[time.Time]bool)
+	for i := 0; i < 100; i++ {
+		next := sched.Next(t)
+		c.Assert(next.Before(t.Add(time.Minute)), Equals, false)
+		c.Assert(next.After(t.Add(70*time.Second)), Equals, false)
+		seen[next] = true
+	}
+	c.Assert(len(seen) > 1, Equals, true)
+
+	never, err := ParseCron("CRON_TZ=UTC 0 0 30 2 *")
+	c.Assert(err, IsNil)
+	c.Assert(WithSplay(never, time.Minute).Next(t).IsZero(), Equals, true)
+}
+
+func (s *SchedulerTestSuite) TestScheduler(c *C) {
+	var (
+		mutex sync.Mutex
+		runs  int
+	)
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return runs
+	}
+	sched := NewScheduler()
+	c.Assert(sched.Add("counter", Every(20*time.Millisecond), func(ctx context.Context) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		runs++
+	}), Equals, true)
+	c.Assert(sched.Add("other", Every(time.Hour), func(ctx context.Context) {}), Equals, true)
+	c.Assert(sched.Add("other", Every(time.Hour), func(ctx context.Context) {}), Equals, false)
+	c.Assert(sched.Jobs(), DeepEquals, []string{"counter", "other"})
+
+	// nothing runs before the scheduler is started
+	_, ok := sched.NextRun("counter")
+	c.Assert(ok, Equals, false)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(count(), Equals, 0)
+
+	stopped := sched.Start()
+	next, ok := sched.NextRun("other")
+	c.Assert(ok, Equals, true)
+	c.Assert(next.After(time.Now().Add(59*time.Minute)), Equals, true)
+	time.Sleep(110 * time.Millisecond)
+	c.Assert(count() >= 3, Equals, true, Commentf("runs %v", count()))
+
+	sched.Remove("other")
+	c.Assert(sched.Jobs(), DeepEquals, []string{"counter"})
+	sched.Stop()
+	<-stopped
+	n := count()
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(count(), Equals, n)
+}
+
+func (s *SchedulerTestSuite) TestSchedulerOverrun(c *C) {
+	var (
+		mutex   sync.Mutex
+		active  int
+		overlap bool
+		runs    int
+	)
+	sched := NewScheduler()
+	sched.Add("slow", Every(10*time.Millisecond), func(ctx context.Context) {
+		mutex.Lock()
+		active++
+		overlap = overlap || active > 1
+		runs++
+		mutex.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-time.After(35 * time.Millisecond):
+		}
+		mutex.Lock()
+		active--
+		mutex.Unlock()
+	})
+	sched.Add("panics", Every(10*time.Millisecond), func(ctx context.Context) {
+		panic("boom")
+	})
+	stopped := sched.Start()
+	time.Sleep(150 * time.Millisecond)
+
+	// a panicking job stays scheduled
+	_, ok := sched.NextRun("panics")
+	c.Assert(ok, Equals, true)
+
+	// stop cancels the running job and waits for it to return
+	sched.Stop()
+	<-stopped
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Assert(overlap, Equals, false)
+	c.Assert(active, Equals, 0)
+	c.Assert(runs >= 2, Equals, true, Commentf("runs %v", runs))
+}
+
+func (s *SchedulerTestSuite) TestSchedulerOverdue(c *C) {
+	release := make(chan bool)
+	sched := NewScheduler()
+	sched.Add("stuck", Every(10*time.Millisecond), func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+		case <-release:
+		}
+	})
+	sched.Add("other", Every(time.Hour), func(ctx context.Context) {})
+	c.Assert(sched.Overdue(0), HasLen, 0)
+
+	stopped := sched.Start()
+	time.Sleep(50 * time.Millisecond)
+	// the run in flight is stuck past the next run of its job
+	c.Assert(sched.Overdue(10*time.Millisecond), DeepEquals, []string{"stuck"})
+	c.Assert(sched.Overdue(time.Minute), HasLen, 0)
+
+	close(release)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(sched.Overdue(10*time.Millisecond), HasLen, 0)
+	sched.Stop()
+	<-stopped
+	c.Assert(sched.Overdue(0), HasLen, 0)
+}
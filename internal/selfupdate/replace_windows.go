@@ -0,0 +1,33 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package selfupdate
+
+import (
+	"os"
+)
+
+// replace moves the old binary aside, as windows does not let a running
+// binary be replaced, but lets it be renamed, and renames the new binary
+// into its place. The old binary is removed by the next update.
+func replace(file string, exe string) error {
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(file, exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package selfupdate updates the butler binary in place from a signed
+// release manifest, so that the butler installs at the edge do not need a
+// deployment pipeline of their own to be kept up to date.
+//
+// The manifest is a JSON document which names the latest version of butler,
+// and the URL and the SHA-256 of its binary for each platform:
+//
+//	{
+//	    "version": "v1.2.5",
+//	    "binaries": {
+//	        "linux/amd64": {"url": "butler-linux-amd64", "sha256": "9f86d0..."}
+//	    }
+//	}
+//
+// It is signed with an ECDSA P-256 key, over SHA-256, eg: with
+// "openssl dgst -sha256 -sign key.pem manifest.json | base64", and the
+// base64 encoded signature is served next to it.
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The defaults of the Opts which are left empty.
+const (
+	DefaultInterval = time.Hour
+	DefaultTimeout  = 5 * time.Minute
+)
+
+// maxManifestSize is the size past which the manifest, or its signature, is
+// not read.
+const maxManifestSize = 1 << 20
+
+// Opts say where the release manifest is, and how to verify it.
+type Opts struct {
+	// ManifestURL is the http(s) URL of the release manifest.
+	ManifestURL string
+	// SignatureURL is the URL of the signature of the manifest. Defaults
+	// to the ManifestURL with a .sig suffix.
+	SignatureURL string
+	// PublicKey is the path of the PEM encoded ECDSA P-256 public key the
+	// manifest is signed with.
+	PublicKey string
+	// Version is the version of the running butler, which is only ever
+	// updated to a newer version.
+	Version string
+	// Interval is how often the manifest is checked.
+	Interval time.Duration
+	// Timeout bounds the retrieval of the manifest and of the binary.
+	Timeout time.Duration
+	// Executable is the path of the binary which is updated. Defaults to
+	// the path of the running butler.
+	Executable string
+}
+
+// Manifest is the release manifest.
+type Manifest struct {
+	Version  string            `json:"version"`
+	Binaries map[string]Binary `json:"binaries"`
+}
+
+// Binary is the binary of a release for a platform. The URL may be relative
+// to the URL of the manifest.
+type Binary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// Updater updates the butler binary.
+type Updater struct {
+	opts   Opts
+	key    *ecdsa.PublicKey
+	client *http.Client
+}
+
+// New returns the Updater of the opts.
+func New(opts Opts) (*Updater, error) {
+	u, err := url.Parse(opts.ManifestURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid manifest url %v, must be http(s)", opts.ManifestURL)
+	}
+	if opts.SignatureURL == "" {
+		opts.SignatureURL = opts.ManifestURL + ".sig"
+	}
+	if _, err := parseVersion(opts.Version); err != nil {
+		return nil, fmt.Errorf("cannot update butler version %q, which is not a release", opts.Version)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Executable == "" {
+		if opts.Executable, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("could not find the butler binary. err=%v", err.Error())
+		}
+	}
+	key, err := LoadPublicKey(opts.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Updater{opts: opts, key: key, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// LoadPublicKey reads the PEM encoded ECDSA P-256 public key in the file.
+func LoadPublicKey(path string) (*ecdsa.PublicKey, error) {
+	if path == "" {
+		return nil, errors.New("no public key to verify the release manifest with")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key in %v", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in %v. err=%v", path, err.Error())
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok || key.Curve.Params().Name != "P-256" {
+		return nil, fmt.Errorf("the public key in %v is not an ECDSA P-256 key", path)
+	}
+	return key, nil
+}
+
+// Executable returns the path of the butler binary which is updated.
+func (u *Updater) Executable() string {
+	return u.opts.Executable
+}
+
+// Run checks the manifest every Interval until the ctx is done, or butler
+// has been updated, in which case it calls updated with the new version, eg:
+// for butler to restart on it.
+func (u *Updater) Run(ctx context.Context, updated func(version string)) {
+	tick := time.NewTicker(u.opts.Interval)
+	defer tick.Stop()
+	for {
+		version, err := u.Update(ctx)
+		if err != nil {
+			log.Errorf("Updater::Run(): could not update butler. err=%v", err.Error())
+		} else if version != "" {
+			updated(version)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Update replaces the butler binary with the one of the manifest, when its
+// version is newer, and returns the new version, or an empty string when
+// butler is up to date.
+func (u *Updater) Update(ctx context.Context) (string, error) {
+	m, err := u.Check(ctx)
+	if err != nil || m == nil {
+		return "", err
+	}
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	bin, ok := m.Binaries[platform]
+	if !ok {
+		return "", fmt.Errorf("the release manifest of %v has no binary for %v", m.Version, platform)
+	}
+	log.Infof("Updater::Update(): updating butler from %v to %v", u.opts.Version, m.Version)
+	if err = u.install(ctx, bin); err != nil {
+		return "", err
+	}
+	log.Infof("Updater::Update(): updated %v to %v", u.opts.Executable, m.Version)
+	return m.Version, nil
+}
+
+// Check retrieves the manifest and verifies its signature. It returns the
+// manifest when its version is newer than that of butler, and nil otherwise.
+func (u *Updater) Check(ctx context.Context) (*Manifest, error) {
+	data, err := u.get(ctx, u.opts.ManifestURL, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := u.get(ctx, u.opts.SignatureURL, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	if err = Verify(u.key, data, sig); err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid release manifest. err=%v", err.Error())
+	}
+	newer, err := Newer(m.Version, u.opts.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release manifest version %q", m.Version)
+	}
+	if !newer {
+		log.Debugf("Updater::Check(): butler %v is up to date, the latest release is %v", u.opts.Version, m.Version)
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// Verify returns an error unless sig is a valid signature of data by the
+// key. The signature is ASN.1 DER encoded, as openssl writes them, and may
+// be base64 encoded.
+func Verify(key *ecdsa.PublicKey, data []byte, sig []byte) error {
+	if dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = dec
+	}
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) != 0 || rs.R == nil || rs.S == nil {
+		return errors.New("invalid release manifest signature")
+	}
+	sum := sha256.Sum256(data)
+	if !ecdsa.Verify(key, sum[:], rs.R, rs.S) {
+		return errors.New("the release manifest signature does not verify")
+	}
+	return nil
+}
+
+// install downloads the binary next to the butler binary, checks it against
+// its SHA-256, and renames it over the butler binary.
+func (u *Updater) install(ctx context.Context, bin Binary) error {
+	want, err := hex.DecodeString(bin.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid sha256 %q in the release manifest", bin.SHA256)
+	}
+	base, _ := url.Parse(u.opts.ManifestURL)
+	ref, err := url.Parse(bin.URL)
+	if err != nil || bin.URL == "" {
+		return fmt.Errorf("invalid binary url %q in the release manifest", bin.URL)
+	}
+	body, err := u.open(ctx, base.ResolveReference(ref).String())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dir := filepath.Dir(u.opts.Executable)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(u.opts.Executable)+".update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not download the butler binary. err=%v", err.Error())
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("the butler binary does not match its sha256, got %x", got)
+	}
+	if err = os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return replace(tmp.Name(), u.opts.Executable)
+}
+
+func (u *Updater) get(ctx context.Context, rawurl string, max int64) ([]byte, error) {
+	body, err := u.open(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%v is larger than %v bytes", rawurl, max)
+	}
+	return data, nil
+}
+
+func (u *Updater) open(ctx context.Context, rawurl string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("could not get %v, status=%v", rawurl, res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+// Newer returns whether the version a is newer than b. The versions are
+// dotted numbers, eg: v1.2.4, whose pre-release and build suffixes are
+// ignored.
+func Newer(a string, b string) (bool, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return false, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x > y, nil
+		}
+	}
+	return false, nil
+}
+
+func parseVersion(v string) ([]int, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var res []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
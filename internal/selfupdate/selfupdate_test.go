@@ -0,0 +1,194 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package selfupdate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SelfUpdateTestSuite struct {
+	dir string
+	key *ecdsa.PrivateKey
+	pub string
+}
+
+var _ = Suite(&SelfUpdateTestSuite{})
+
+func (s *SelfUpdateTestSuite) SetUpTest(c *C) {
+	var err error
+	s.dir = c.MkDir()
+	s.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	c.Assert(err, IsNil)
+	s.pub = filepath.Join(s.dir, "butler.pub")
+	c.Assert(ioutil.WriteFile(s.pub, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644), IsNil)
+}
+
+// sign returns the base64 encoded signature of the data, as openssl and
+// base64 write it.
+func (s *SelfUpdateTestSuite) sign(c *C, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	sig, err := s.key.Sign(rand.Reader, sum[:], nil)
+	c.Assert(err, IsNil)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// release serves a release manifest of the version, with the binary for the
+// running platform, and returns the Updater of butler v1.2.4 for it.
+func (s *SelfUpdateTestSuite) release(c *C, version string, binary []byte, sum []byte) (*Updater, string) {
+	manifest, err := json.Marshal(Manifest{Version: version, Binaries: map[string]Binary{
+		runtime.GOOS + "/" + runtime.GOARCH: {URL: "bin/butler", SHA256: hex.EncodeToString(sum)},
+	}})
+	c.Assert(err, IsNil)
+	sig := s.sign(c, manifest)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/manifest.json":
+			w.Write(manifest)
+		case "/releases/manifest.json.sig":
+			w.Write(sig)
+		case "/releases/bin/butler":
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	exe := filepath.Join(s.dir, "butler")
+	c.Assert(ioutil.WriteFile(exe, []byte("v1.2.4"), 0755), IsNil)
+	u, err := New(Opts{ManifestURL: ts.URL + "/releases/manifest.json", PublicKey: s.pub, Version: "v1.2.4", Executable: exe})
+	c.Assert(err, IsNil)
+	return u, exe
+}
+
+func (s *SelfUpdateTestSuite) TestNewer(c *C) {
+	for _, t := range []struct {
+		a, b  string
+		newer bool
+	}{
+		{"v1.2.5", "v1.2.4", true},
+		{"1.10.0", "v1.9.9", true},
+		{"v1.2.4", "v1.2.4", false},
+		{"v1.2", "v1.2.0", false},
+		{"v1.2.4.1", "v1.2.4", true},
+		{"v1.2.3", "v1.2.4", false},
+		{"v2.0.0-rc1", "v1.9.0", true},
+	} {
+		newer, err := Newer(t.a, t.b)
+		c.Assert(err, IsNil)
+		c.Assert(newer, Equals, t.newer, Commentf("%v > %v", t.a, t.b))
+	}
+	_, err := Newer("latest", "v1.2.4")
+	c.Assert(err, NotNil)
+	_, err = Newer("v1.2.4", "")
+	c.Assert(err, NotNil)
+}
+
+func (s *SelfUpdateTestSuite) TestNew(c *C) {
+	_, err := New(Opts{ManifestURL: "file:///releases/manifest.json", PublicKey: s.pub, Version: "v1.2.4"})
+	c.Assert(err, ErrorMatches, "invalid manifest url .*")
+	_, err = New(Opts{ManifestURL: "https://releases.example.com/manifest.json", PublicKey: s.pub})
+	c.Assert(err, ErrorMatches, "cannot update butler version \"\", which is not a release")
+	_, err = New(Opts{ManifestURL: "https://releases.example.com/manifest.json", Version: "v1.2.4"})
+	c.Assert(err, ErrorMatches, "no public key to verify the release manifest with")
+
+	rsa := filepath.Join(s.dir, "rsa.pub")
+	c.Assert(ioutil.WriteFile(rsa, []byte("not a key"), 0644), IsNil)
+	_, err = New(Opts{ManifestURL: "https://releases.example.com/manifest.json", PublicKey: rsa, Version: "v1.2.4"})
+	c.Assert(err, ErrorMatches, "no PEM encoded public key in .*")
+
+	u, err := New(Opts{ManifestURL: "https://releases.example.com/manifest.json", PublicKey: s.pub, Version: "v1.2.4"})
+	c.Assert(err, IsNil)
+	c.Assert(u.opts.SignatureURL, Equals, "https://releases.example.com/manifest.json.sig")
+	c.Assert(u.opts.Interval, Equals, DefaultInterval)
+}
+
+func (s *SelfUpdateTestSuite) TestVerify(c *C) {
+	data := []byte(`{"version": "v1.2.5"}`)
+	sig := s.sign(c, data)
+	c.Assert(Verify(&s.key.PublicKey, data, sig), IsNil)
+	// raw DER signatures too
+	raw, err := base64.StdEncoding.DecodeString(string(sig[:len(sig)-1]))
+	c.Assert(err, IsNil)
+	c.Assert(Verify(&s.key.PublicKey, data, raw), IsNil)
+
+	c.Assert(Verify(&s.key.PublicKey, []byte(`{"version": "v9.9.9"}`), sig), ErrorMatches, "the release manifest signature does not verify")
+	c.Assert(Verify(&s.key.PublicKey, data, []byte("garbage")), ErrorMatches, "invalid release manifest signature")
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	c.Assert(Verify(&other.PublicKey, data, sig), NotNil)
+}
+
+func (s *SelfUpdateTestSuite) TestUpdate(c *C) {
+	binary := []byte("v1.2.5")
+	sum := sha256.Sum256(binary)
+	u, exe := s.release(c, "v1.2.5", binary, sum[:])
+
+	version, err := u.Update(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, "v1.2.5")
+	data, err := ioutil.ReadFile(exe)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "v1.2.5")
+	fi, err := os.Stat(exe)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0755))
+	// no temporary file is left behind
+	files, _ := filepath.Glob(filepath.Join(s.dir, ".butler.update-*"))
+	c.Assert(files, HasLen, 0)
+}
+
+func (s *SelfUpdateTestSuite) TestUpdateUpToDate(c *C) {
+	binary := []byte("v1.2.3")
+	sum := sha256.Sum256(binary)
+	// an older release, eg: a replayed manifest, is never installed
+	for _, version := range []string{"v1.2.4", "v1.2.3"} {
+		u, exe := s.release(c, version, binary, sum[:])
+		res, err := u.Update(context.Background())
+		c.Assert(err, IsNil)
+		c.Assert(res, Equals, "")
+		data, _ := ioutil.ReadFile(exe)
+		c.Assert(string(data), Equals, "v1.2.4")
+	}
+}
+
+func (s *SelfUpdateTestSuite) TestUpdateChecksum(c *C) {
+	sum := sha256.Sum256([]byte("v1.2.5"))
+	u, exe := s.release(c, "v1.2.5", []byte("tampered"), sum[:])
+	_, err := u.Update(context.Background())
+	c.Assert(err, ErrorMatches, "the butler binary does not match its sha256, got .*")
+	data, _ := ioutil.ReadFile(exe)
+	c.Assert(string(data), Equals, "v1.2.4")
+	files, _ := filepath.Glob(filepath.Join(s.dir, ".butler.update-*"))
+	c.Assert(files, HasLen, 0)
+}
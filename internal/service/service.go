@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package service reports the state of butler to the service manager which
+// runs it, systemd through sd_notify, or the Windows service control
+// manager, so that the service manager can tell a wedged butler, whose
+// scheduler no longer runs the configuration management, from a live
+// process.
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pollInterval is how often the readiness of butler is checked while it
+// starts up.
+var pollInterval = time.Second
+
+// Service is butler, run by a service manager. A Service which is not run by
+// a service manager reports nothing.
+type Service struct {
+	// Watchdog is the time within which the service manager expects butler
+	// to report that it is alive, or 0 when there is no watchdog.
+	Watchdog time.Duration
+	sys
+}
+
+// Run reports the start up of butler to the service manager until ready
+// returns nil, and then that butler is ready. It then reports to the watchdog
+// every half of the Watchdog, as long as alive returns nil, and that butler
+// is stopping once the ctx is done.
+func (s *Service) Run(ctx context.Context, ready func() error, alive func() error) {
+	tick := time.NewTicker(pollInterval)
+	defer func() { tick.Stop() }()
+
+	for {
+		err := ready()
+		if err == nil {
+			break
+		}
+		s.starting(err.Error())
+		select {
+		case <-ctx.Done():
+			s.stopping()
+			return
+		case <-tick.C:
+		}
+	}
+	log.Infof("Service::Run(): butler is ready.")
+	s.ready()
+
+	if s.Watchdog <= 0 {
+		<-ctx.Done()
+		s.stopping()
+		return
+	}
+	tick.Stop()
+	tick = time.NewTicker(s.Watchdog / 2)
+	last := time.Now()
+	for {
+		if err := check(alive, s.Watchdog/2); err != nil {
+			log.Errorf("Service::Run(): butler is not alive, not reporting to the watchdog. err=%v", err.Error())
+			if time.Since(last) >= s.Watchdog {
+				s.wedged(err)
+			}
+		} else {
+			last = time.Now()
+			s.ping()
+		}
+		select {
+		case <-ctx.Done():
+			s.stopping()
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// check returns the error of alive, or an error when alive does not return
+// within the timeout, eg: as the scheduler is deadlocked.
+func check(alive func() error, timeout time.Duration) error {
+	res := make(chan error, 1)
+	go func() { res <- alive() }()
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("the liveness check did not return within %v", timeout)
+	}
+}
@@ -0,0 +1,159 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ServiceTestSuite struct {
+}
+
+var _ = Suite(&ServiceTestSuite{})
+
+// listen listens on a NOTIFY_SOCKET, and returns the func which returns the
+// states notified so far.
+func listen(c *C) func() []string {
+	dir, err := ioutil.TempDir("", "butler-service")
+	c.Assert(err, IsNil)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	c.Assert(err, IsNil)
+
+	var (
+		mutex  sync.Mutex
+		states []string
+	)
+	go func() {
+		defer os.RemoveAll(dir)
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			states = append(states, string(buf[:n]))
+			mutex.Unlock()
+		}
+	}()
+	os.Setenv("NOTIFY_SOCKET", socket)
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), states...)
+	}
+}
+
+func (s *ServiceTestSuite) TestNotify(c *C) {
+	pollInterval = 10 * time.Millisecond
+	states := listen(c)
+	os.Setenv("WATCHDOG_USEC", "100000")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	svc, err := New("butler", nil, 0)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Watchdog, Equals, 100*time.Millisecond)
+	// the commands butler runs do not inherit them
+	c.Assert(os.Getenv("NOTIFY_SOCKET"), Equals, "")
+	c.Assert(os.Getenv("WATCHDOG_USEC"), Equals, "")
+
+	var (
+		mutex        sync.Mutex
+		isReady      bool
+		aliveErr     error
+		readyAttempt int
+	)
+	ready := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		readyAttempt++
+		if !isReady {
+			return errors.New("loading")
+		}
+		return nil
+	}
+	alive := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return aliveErr
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		svc.Run(ctx, ready, alive)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	// the status is only notified when it changes
+	c.Assert(states(), DeepEquals, []string{"STATUS=loading"})
+
+	mutex.Lock()
+	isReady = true
+	mutex.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	got := states()
+	c.Assert(len(got) >= 3, Equals, true, Commentf("states %v", got))
+	c.Assert(got[1], Equals, "READY=1\nSTATUS=running")
+	c.Assert(got[2], Equals, "WATCHDOG=1")
+
+	// a wedged butler stops reporting to the watchdog, and triggers it
+	mutex.Lock()
+	aliveErr = errors.New("the scheduler is wedged")
+	mutex.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	got = states()
+	c.Assert(got[len(got)-1], Equals, "WATCHDOG=trigger\nSTATUS=the scheduler is wedged")
+
+	cancel()
+	<-done
+	time.Sleep(20 * time.Millisecond)
+	got = states()
+	c.Assert(got[len(got)-1], Equals, "STOPPING=1")
+}
+
+func (s *ServiceTestSuite) TestNoNotifySocket(c *C) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("WATCHDOG_USEC", "100000")
+	svc, err := New("butler", nil, time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Watchdog, Equals, time.Duration(0))
+
+	// it runs until the ctx is done, reporting nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.Run(ctx, func() error { return nil }, func() error { return nil })
+}
+
+func (s *ServiceTestSuite) TestCheck(c *C) {
+	c.Assert(check(func() error { return nil }, time.Second), IsNil)
+	c.Assert(check(func() error { return errors.New("dead") }, time.Second), ErrorMatches, "dead")
+	c.Assert(check(func() error { time.Sleep(time.Second); return nil }, 10*time.Millisecond), ErrorMatches, "the liveness check did not return within 10ms")
+}
@@ -0,0 +1,119 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package service
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sys notifies systemd, over the NOTIFY_SOCKET of a Type=notify unit.
+type sys struct {
+	socket string
+	status string
+	// env are the environment variables of systemd, which are unset.
+	env []string
+}
+
+// New returns the Service of butler. Under systemd, it notifies the
+// NOTIFY_SOCKET, and the Watchdog is the WatchdogSec= of the unit. The name,
+// the stop func and the watchdog only apply on windows. The environment
+// variables of systemd are unset, so that the commands butler runs, eg: the
+// exec reloaders, do not notify systemd on behalf of butler.
+func New(name string, stop func(), watchdog time.Duration) (*Service, error) {
+	s := &Service{}
+	s.socket = os.Getenv("NOTIFY_SOCKET")
+	if usec := os.Getenv("WATCHDOG_USEC"); usec != "" {
+		pid := os.Getenv("WATCHDOG_PID")
+		if n, err := strconv.ParseInt(usec, 10, 64); err == nil && n > 0 && (pid == "" || pid == strconv.Itoa(os.Getpid())) {
+			s.Watchdog = time.Duration(n) * time.Microsecond
+		}
+	}
+	for _, env := range []string{"NOTIFY_SOCKET", "WATCHDOG_USEC", "WATCHDOG_PID"} {
+		if v, ok := os.LookupEnv(env); ok {
+			s.env = append(s.env, env+"="+v)
+			os.Unsetenv(env)
+		}
+	}
+	if s.socket == "" {
+		s.Watchdog = 0
+		return s, nil
+	}
+	// an abstract socket
+	if strings.HasPrefix(s.socket, "@") {
+		s.socket = "\x00" + s.socket[1:]
+	}
+	return s, nil
+}
+
+// notify sends the state to systemd, see sd_notify(3).
+func (s *sys) notify(state string) {
+	if s.socket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: s.socket, Net: "unixgram"})
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		conn.Close()
+	}
+	if err != nil {
+		log.Warnf("Service::notify(): could not notify systemd of %q. err=%v", state, err.Error())
+	}
+}
+
+func (s *sys) starting(status string) {
+	if status != s.status {
+		s.status = status
+		s.notify("STATUS=" + status)
+	}
+}
+
+func (s *sys) ready() {
+	s.notify("READY=1\nSTATUS=running")
+}
+
+func (s *sys) ping() {
+	s.notify("WATCHDOG=1")
+}
+
+// wedged asks systemd to act on the watchdog right away, rather than once
+// the WatchdogSec= is up.
+func (s *sys) wedged(err error) {
+	s.notify("WATCHDOG=trigger\nSTATUS=" + err.Error())
+}
+
+func (s *sys) stopping() {
+	s.notify("STOPPING=1")
+}
+
+// Restart executes the butler binary exe, eg: once it has been updated, in
+// place of butler, with the same arguments. It keeps the pid of butler, and
+// the environment variables of systemd, so that systemd keeps supervising
+// it. It only returns on an error.
+func (s *Service) Restart(exe string) error {
+	return syscall.Exec(exe, os.Args, append(os.Environ(), s.env...))
+}
+
+// Stopped reports that butler has stopped, with the error it stopped on, if
+// any. systemd learns it from the exit code of butler.
+func (s *Service) Stopped(err error) {
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	serviceWin32OwnProcess = 0x00000010
+
+	serviceStopped      = 0x00000001
+	serviceStartPending = 0x00000002
+	serviceStopPending  = 0x00000003
+	serviceRunning      = 0x00000004
+
+	serviceAcceptStop     = 0x00000001
+	serviceAcceptShutdown = 0x00000004
+
+	serviceControlStop        = 0x00000001
+	serviceControlInterrogate = 0x00000004
+	serviceControlShutdown    = 0x00000005
+
+	errorServiceSpecificError = 1066
+	errorNotAService          = syscall.Errno(1063)
+
+	// serviceWaitHint is how long the service control manager waits for
+	// the next report while butler starts up and stops.
+	serviceWaitHint = 30 * time.Second
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+// serviceStatus is the SERVICE_STATUS which is reported to the service
+// control manager.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is a SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	main uintptr
+}
+
+// sys reports to the service control manager, when butler runs as a
+// windows service.
+type sys struct {
+	mutex  sync.Mutex
+	handle uintptr
+	status serviceStatus
+	stop   func()
+	done   chan bool
+}
+
+// current is the Service which the callbacks of the service control manager
+// report for, there is only one per process.
+var current *Service
+
+// New returns the Service of butler. When butler is started by the service
+// control manager as the service name, it reports to it, the stop func is
+// called when the service is stopped, and butler exits once it has not been
+// alive for the watchdog, so that the recovery actions of the service restart
+// it. Otherwise, eg: when butler runs in a console, it reports nothing.
+func New(name string, stop func(), watchdog time.Duration) (*Service, error) {
+	s := &Service{}
+	s.stop = stop
+	s.done = make(chan bool)
+	current = s
+
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	started := make(chan error, 1)
+	serviceMain := syscall.NewCallback(func(argc uint32, argv **uint16) uintptr {
+		h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(n)), syscall.NewCallback(handler), 0)
+		if h == 0 {
+			started <- err
+			return 0
+		}
+		s.mutex.Lock()
+		s.handle = h
+		s.mutex.Unlock()
+		s.starting("starting")
+		started <- nil
+		// the service runs for as long as serviceMain does
+		<-s.done
+		return 0
+	})
+	go func() {
+		table := []serviceTableEntry{{name: n, main: serviceMain}, {}}
+		// it returns once the service has stopped, or right away when
+		// butler is not run by the service control manager
+		if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+			started <- err
+		}
+	}()
+
+	if err = <-started; err != nil {
+		if err == errorNotAService {
+			return &Service{}, nil
+		}
+		return nil, err
+	}
+	s.Watchdog = watchdog
+	return s, nil
+}
+
+// handler handles the controls of the service control manager.
+func handler(control uint32, eventType uint32, eventData uintptr, context uintptr) uintptr {
+	s := current
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		log.Infof("Service::handler(): the service control manager is stopping butler.")
+		s.stopping()
+		go s.stop()
+	case serviceControlInterrogate:
+		s.mutex.Lock()
+		s.report()
+		s.mutex.Unlock()
+	}
+	return 0
+}
+
+// setState reports the state to the service control manager, if butler runs
+// as a service.
+func (s *sys) setState(state uint32, exitCode uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.handle == 0 {
+		return
+	}
+	if state == s.status.CurrentState {
+		s.status.CheckPoint++
+	} else {
+		s.status.CheckPoint = 0
+	}
+	s.status.ServiceType = serviceWin32OwnProcess
+	s.status.CurrentState = state
+	s.status.ControlsAccepted = 0
+	s.status.WaitHint = 0
+	switch state {
+	case serviceRunning:
+		s.status.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+		s.status.CheckPoint = 0
+	case serviceStartPending, serviceStopPending:
+		s.status.WaitHint = uint32(serviceWaitHint / time.Millisecond)
+	}
+	s.status.Win32ExitCode = 0
+	s.status.ServiceSpecificExitCode = exitCode
+	if exitCode != 0 {
+		s.status.Win32ExitCode = errorServiceSpecificError
+	}
+	s.report()
+}
+
+// report sets the status of the service. The caller holds the mutex.
+func (s *sys) report() {
+	if r, _, err := procSetServiceStatus.Call(s.handle, uintptr(unsafe.Pointer(&s.status))); r == 0 {
+		log.Warnf("Service::report(): could not report to the service control manager. err=%v", err)
+	}
+}
+
+// starting reports that butler is still starting up, which also keeps the
+// service control manager from timing the start up out.
+func (s *sys) starting(status string) {
+	s.setState(serviceStartPending, 0)
+}
+
+func (s *sys) ready() {
+	s.setState(serviceRunning, 0)
+}
+
+// ping does nothing, the service control manager has no watchdog.
+func (s *sys) ping() {
+}
+
+// wedged exits, as the service control manager restarts the services which
+// fail, when their recovery actions say so, but not those which hang.
+func (s *sys) wedged(err error) {
+	log.Errorf("Service::wedged(): butler is wedged, exiting so that the service is recovered. err=%v", err.Error())
+	os.Exit(1)
+}
+
+func (s *sys) stopping() {
+	s.setState(serviceStopPending, 0)
+}
+
+// Restart starts the butler binary exe, eg: once it has been updated, with
+// the same arguments, and exits. A service is reported as stopped with an
+// error instead, for the recovery actions of the service to start it again,
+// as the process the service control manager started has to be the service.
+// It only returns on an error.
+func (s *Service) Restart(exe string) error {
+	s.mutex.Lock()
+	service := s.handle != 0
+	s.mutex.Unlock()
+	if service {
+		s.Stopped(errors.New("restarting"))
+		os.Exit(1)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// Stopped reports that butler has stopped, with the error it stopped on, if
+// any, as a service specific exit code.
+func (s *Service) Stopped(err error) {
+	var code uint32
+	if err != nil {
+		code = 1
+	}
+	s.setState(serviceStopped, code)
+	if s.done != nil {
+		close(s.done)
+	}
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The defaults of the exporter.
+const (
+	DefaultServiceName = "butler"
+	DefaultTimeout     = 10 * time.Second
+	// TracesPath is the path of the OTLP/HTTP traces endpoint of the
+	// collector.
+	TracesPath = "/v1/traces"
+)
+
+var (
+	// batchSize is the number of spans which are exported at once, and
+	// queueSize the number of spans which are queued before spans are
+	// dropped.
+	batchSize = 512
+	queueSize = 2048
+	// flushInterval is how often the queued spans are exported.
+	flushInterval = 5 * time.Second
+)
+
+// Opts say where the spans are exported to.
+type Opts struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver of the collector,
+	// eg: http://otel-collector:4318. The spans are POSTed to its
+	// /v1/traces.
+	Endpoint string
+	// Headers are sent along with every export, eg: for authentication.
+	Headers map[string]string
+	// ServiceName is the service.name of the spans, butler by default.
+	ServiceName string
+	// Timeout is how long an export waits for the collector.
+	Timeout time.Duration
+}
+
+// WithEnv returns a copy of the opts, with the settings which were left
+// empty taken from the OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME environment variables.
+func (o Opts) WithEnv() (Opts, error) {
+	if o.Endpoint == "" {
+		o.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if o.Headers == nil && os.Getenv("OTEL_EXPORTER_OTLP_HEADERS") != "" {
+		headers, err := ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+		if err != nil {
+			return o, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS. err=%v", err.Error())
+		}
+		o.Headers = headers
+	}
+	if o.ServiceName == "" {
+		o.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	return o, nil
+}
+
+// ParseHeaders parses headers in the form of the OTEL_EXPORTER_OTLP_HEADERS
+// environment variable, key1=value1,key2=value2, with URL encoded values.
+func ParseHeaders(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("header %q is not in the form key=value", pair)
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("header %q has an invalid value. err=%v", pair, err.Error())
+		}
+		res[strings.TrimSpace(kv[0])] = v
+	}
+	return res, nil
+}
+
+// Exporter queues the spans which have ended, and exports them in batches.
+type Exporter struct {
+	URL         string
+	Headers     map[string]string
+	ServiceName string
+	Client      *http.Client
+
+	queue    chan *Span
+	flush    chan chan error
+	stop     chan struct{}
+	stopped  chan struct{}
+	dropped  int
+	hostname string
+	mutex    sync.Mutex
+}
+
+// Init starts exporting the spans to the opts.Endpoint. Tracing stays
+// disabled when the Endpoint is empty. A previous exporter is shut down.
+func Init(opts Opts) error {
+	if opts.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid OTLP endpoint %v, it must be a http:// or https:// URL", opts.Endpoint)
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DefaultServiceName
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	hostname, _ := os.Hostname()
+
+	e := &Exporter{
+		URL:         strings.TrimRight(opts.Endpoint, "/") + TracesPath,
+		Headers:     opts.Headers,
+		ServiceName: opts.ServiceName,
+		Client:      &http.Client{Timeout: opts.Timeout},
+		queue:       make(chan *Span, queueSize),
+		flush:       make(chan chan error),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		hostname:    hostname,
+	}
+	go e.run()
+
+	exporterMutex.Lock()
+	prev := exporter
+	exporter = e
+	exporterMutex.Unlock()
+	if prev != nil {
+		prev.shutdown(context.Background())
+	}
+	log.Infof("tracing.Init(): exporting spans to %v", e.URL)
+	return nil
+}
+
+// Enabled returns whether the spans are exported.
+func Enabled() bool {
+	exporterMutex.RLock()
+	defer exporterMutex.RUnlock()
+	return exporter != nil
+}
+
+// Flush exports the queued spans, and waits until they are exported or the
+// ctx is done.
+func Flush(ctx context.Context) error {
+	exporterMutex.RLock()
+	e := exporter
+	exporterMutex.RUnlock()
+	if e == nil {
+		return nil
+	}
+	res := make(chan error, 1)
+	select {
+	case e.flush <- res:
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans, and disables tracing. It waits until
+// the spans are exported or the ctx is done.
+func Shutdown(ctx context.Context) error {
+	exporterMutex.Lock()
+	e := exporter
+	exporter = nil
+	exporterMutex.Unlock()
+	if e == nil {
+		return nil
+	}
+	return e.shutdown(ctx)
+}
+
+func (e *Exporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// add queues the span, or drops it when the queue is full, eg: while the
+// collector is unreachable.
+func (e *Exporter) add(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mutex.Lock()
+		e.dropped++
+		e.mutex.Unlock()
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	export := func() error {
+		var err error
+		for len(batch) > 0 {
+			n := len(batch)
+			if n > batchSize {
+				n = batchSize
+			}
+			if err = e.export(batch[:n]); err != nil {
+				log.Warnf("Exporter::run(): could not export %v spans to %v. err=%v", n, e.URL, err.Error())
+			}
+			batch = batch[n:]
+		}
+		batch = nil
+		return err
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case res := <-e.flush:
+			drain()
+			res <- export()
+		case <-e.stop:
+			drain()
+			export()
+			return
+		}
+	}
+}
+
+// export POSTs the spans to the collector as an OTLP ExportTraceServiceRequest
+// in the JSON encoding.
+func (e *Exporter) export(spans []*Span) error {
+	e.mutex.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mutex.Unlock()
+	if dropped > 0 {
+		log.Warnf("Exporter::export(): dropped %v spans, the queue was full.", dropped)
+	}
+
+	data, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of the spans, see
+// https://github.com/open-telemetry/opentelemetry-proto. The ids are hex
+// encoded, and the 64 bit integers are strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// The OTLP span kind and status codes butler uses.
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+// scopeName is the instrumentation scope of the spans.
+const scopeName = "github.com/adobe/butler"
+
+func (e *Exporter) request(spans []*Span) otlpRequest {
+	resource := otlpResource{Attributes: otlpAttributes([]Attribute{
+		String("service.name", e.ServiceName),
+		String("host.name", e.hostname),
+	})}
+
+	var res []otlpSpan
+	for _, s := range spans {
+		s.mutex.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attrs),
+		}
+		if s.ParentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		if s.Err != nil {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+		}
+		s.mutex.Unlock()
+		res = append(res, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: res}},
+	}}}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	var res []otlpKeyValue
+	for _, a := range attrs {
+		var v map[string]interface{}
+		switch t := a.Value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": t}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(t)}
+		case bool:
+			v = map[string]interface{}{"boolValue": t}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprintf("%v", t)}
+		}
+		res = append(res, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return res
+}
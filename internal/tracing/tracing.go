@@ -0,0 +1,142 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package tracing records the spans of what butler does, eg: retrieving the
+// butler configuration, or downloading, validating, copying and reloading the
+// files of a manager, and exports them to an OpenTelemetry collector with
+// OTLP over HTTP. The spans carry W3C trace and span ids, so that they can be
+// correlated with those of other services in the tracing backend.
+//
+// Nothing is recorded until Init is called with an endpoint. Until then Start
+// returns a nil *Span, whose methods do nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attribute is a key and a value of a span. The value is a string, an int or
+// a bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string Attribute.
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an int Attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a bool Attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a single timed operation of butler, within a trace.
+type Span struct {
+	Name      string
+	TraceID   [16]byte
+	SpanID    [8]byte
+	ParentID  [8]byte
+	StartTime time.Time
+	EndTime   time.Time
+	Attrs     []Attribute
+	Err       error
+
+	mutex    sync.Mutex
+	ended    bool
+	exporter *Exporter
+}
+
+type spanKey struct{}
+
+var (
+	exporter      *Exporter
+	exporterMutex sync.RWMutex
+)
+
+// Start starts a span, the child of the span in the ctx, if any, and returns
+// a copy of the ctx which carries it. It returns the ctx and a nil *Span when
+// tracing is not enabled.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	exporterMutex.RLock()
+	e := exporter
+	exporterMutex.RUnlock()
+	if e == nil {
+		return ctx, nil
+	}
+
+	s := &Span{Name: name, StartTime: time.Now(), Attrs: attrs, exporter: e}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the span the ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttributes adds the attrs to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// End ends the span, failed when err is not nil, and hands it to the
+// exporter. Only the first call has an effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.Err = err
+	s.mutex.Unlock()
+	s.exporter.add(s)
+}
+
+// TraceIDString returns the hex trace id of the span, or an empty string for
+// a nil span, eg: to log it.
+func (s *Span) TraceIDString() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.TraceID[:])
+}
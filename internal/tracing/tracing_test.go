@@ -0,0 +1,191 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TracingTestSuite struct{}
+
+var _ = Suite(&TracingTestSuite{})
+
+// collector is an OTLP/HTTP receiver which keeps the requests it receives.
+type collector struct {
+	mutex    sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+	server   *httptest.Server
+}
+
+func newCollector(c *C) *collector {
+	col := &collector{}
+	col.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, TracesPath)
+		c.Check(r.Header.Get("Content-Type"), Equals, "application/json")
+		data, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		var req otlpRequest
+		c.Check(json.Unmarshal(data, &req), IsNil)
+		col.mutex.Lock()
+		col.requests = append(col.requests, req)
+		col.headers = append(col.headers, r.Header)
+		col.mutex.Unlock()
+	}))
+	return col
+}
+
+func (col *collector) spans() map[string]otlpSpan {
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+	res := make(map[string]otlpSpan)
+	for _, req := range col.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					res[s.Name] = s
+				}
+			}
+		}
+	}
+	return res
+}
+
+func (s *TracingTestSuite) TestDisabled(c *C) {
+	c.Assert(Enabled(), Equals, false)
+	ctx, span := Start(context.Background(), "noop")
+	c.Assert(span, IsNil)
+	c.Assert(FromContext(ctx), IsNil)
+	// the methods of a nil span do nothing
+	span.SetAttributes(String("foo", "bar"))
+	span.End(errors.New("boom"))
+	c.Assert(span.TraceIDString(), Equals, "")
+	c.Assert(Flush(context.Background()), IsNil)
+	c.Assert(Shutdown(context.Background()), IsNil)
+	c.Assert(Init(Opts{}), IsNil)
+	c.Assert(Enabled(), Equals, false)
+}
+
+func (s *TracingTestSuite) TestInitErrors(c *C) {
+	c.Assert(Init(Opts{Endpoint: "otel-collector:4318"}), ErrorMatches, "invalid OTLP endpoint otel-collector:4318.*")
+	c.Assert(Init(Opts{Endpoint: "ftp://otel-collector"}), ErrorMatches, "invalid OTLP endpoint ftp://otel-collector.*")
+	c.Assert(Enabled(), Equals, false)
+}
+
+func (s *TracingTestSuite) TestExport(c *C) {
+	col := newCollector(c)
+	defer col.server.Close()
+	c.Assert(Init(Opts{Endpoint: col.server.URL + "/", Headers: map[string]string{"Authorization": "Bearer foo"}, ServiceName: "butler-test"}), IsNil)
+	defer Shutdown(context.Background())
+	c.Assert(Enabled(), Equals, true)
+
+	ctx, parent := Start(context.Background(), "butler.run", Int("butler.run.count", 3))
+	c.Assert(FromContext(ctx), Equals, parent)
+	_, child := Start(ctx, "butler.download", String("butler.repo", "localhost"))
+	child.SetAttributes(Bool("butler.cached", false))
+	child.End(errors.New("no route to host"))
+	child.End(nil)
+	parent.End(nil)
+	c.Assert(Flush(context.Background()), IsNil)
+
+	spans := col.spans()
+	c.Assert(spans, HasLen, 2)
+	run, download := spans["butler.run"], spans["butler.download"]
+	c.Assert(run.TraceID, Equals, parent.TraceIDString())
+	c.Assert(run.TraceID, HasLen, 32)
+	c.Assert(run.SpanID, HasLen, 16)
+	c.Assert(run.ParentSpanID, Equals, "")
+	c.Assert(run.Status, Equals, otlpStatus{})
+	c.Assert(run.Attributes, DeepEquals, []otlpKeyValue{{Key: "butler.run.count", Value: map[string]interface{}{"intValue": "3"}}})
+	c.Assert(download.TraceID, Equals, run.TraceID)
+	c.Assert(download.ParentSpanID, Equals, run.SpanID)
+	c.Assert(download.Kind, Equals, otlpSpanKindInternal)
+	// only the first End counts
+	c.Assert(download.Status, Equals, otlpStatus{Code: otlpStatusError, Message: "no route to host"})
+	c.Assert(download.Attributes, DeepEquals, []otlpKeyValue{
+		{Key: "butler.repo", Value: map[string]interface{}{"stringValue": "localhost"}},
+		{Key: "butler.cached", Value: map[string]interface{}{"boolValue": false}},
+	})
+	c.Assert(download.StartTimeUnixNano <= download.EndTimeUnixNano, Equals, true)
+
+	col.mutex.Lock()
+	defer col.mutex.Unlock()
+	c.Assert(col.headers[0].Get("Authorization"), Equals, "Bearer foo")
+	hostname, _ := os.Hostname()
+	c.Assert(col.requests[0].ResourceSpans[0].Resource.Attributes, DeepEquals, []otlpKeyValue{
+		{Key: "service.name", Value: map[string]interface{}{"stringValue": "butler-test"}},
+		{Key: "host.name", Value: map[string]interface{}{"stringValue": hostname}},
+	})
+	c.Assert(col.requests[0].ResourceSpans[0].ScopeSpans[0].Scope.Name, Equals, scopeName)
+}
+
+func (s *TracingTestSuite) TestShutdown(c *C) {
+	col := newCollector(c)
+	defer col.server.Close()
+	c.Assert(Init(Opts{Endpoint: col.server.URL}), IsNil)
+
+	_, span := Start(context.Background(), "butler.config")
+	span.End(nil)
+	c.Assert(Shutdown(context.Background()), IsNil)
+	c.Assert(Enabled(), Equals, false)
+	c.Assert(col.spans(), HasLen, 1)
+
+	// spans started after the shutdown are not recorded
+	_, span = Start(context.Background(), "butler.config")
+	c.Assert(span, IsNil)
+}
+
+func (s *TracingTestSuite) TestParseHeaders(c *C) {
+	headers, err := ParseHeaders("Authorization=Bearer%20foo, x-tenant = ops,")
+	c.Assert(err, IsNil)
+	c.Assert(headers, DeepEquals, map[string]string{"Authorization": "Bearer foo", "x-tenant": "ops"})
+
+	_, err = ParseHeaders("Authorization")
+	c.Assert(err, ErrorMatches, `header "Authorization" is not in the form key=value`)
+	_, err = ParseHeaders("=foo")
+	c.Assert(err, ErrorMatches, `header "=foo" is not in the form key=value`)
+}
+
+func (s *TracingTestSuite) TestWithEnv(c *C) {
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4318")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret")
+	os.Setenv("OTEL_SERVICE_NAME", "butler-prometheus")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+	defer os.Unsetenv("OTEL_SERVICE_NAME")
+
+	opts, err := Opts{}.WithEnv()
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, Opts{Endpoint: "http://otel-collector:4318", Headers: map[string]string{"api-key": "secret"}, ServiceName: "butler-prometheus"})
+
+	// the opts win over the environment
+	opts, err = Opts{Endpoint: "https://collector", Headers: map[string]string{}, ServiceName: "butler"}.WithEnv()
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, Opts{Endpoint: "https://collector", Headers: map[string]string{}, ServiceName: "butler"})
+
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key")
+	_, err = Opts{}.WithEnv()
+	c.Assert(err, ErrorMatches, "invalid OTEL_EXPORTER_OTLP_HEADERS.*")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/adobe/butler/internal/environment"
+
+	amconfig "github.com/prometheus/alertmanager/config"
+	log "github.com/sirupsen/logrus"
+)
+
+func NewAlertmanagerValidator(manager string, method string, entry []byte) (Validator, error) {
+	var (
+		err    error
+		result AlertmanagerValidator
+		opts   PrometheusValidatorOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	for i := range opts.Files {
+		opts.Files[i] = environment.GetVar(opts.Files[i])
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, err
+}
+
+type AlertmanagerValidator struct {
+	Manager string                  `json:"-"`
+	Counter int                     `json:"-"`
+	Method  string                  `json:"method"`
+	Opts    PrometheusValidatorOpts `json:"opts"`
+}
+
+// Validate loads the staged file with the alertmanager configuration loader,
+// which alertmanager itself uses, so unknown fields, the routing tree, the
+// receivers, inhibit rules and time intervals are checked the same way
+// alertmanager would.
+func (v AlertmanagerValidator) Validate(file string, name string) error {
+	o := v.GetOpts().(PrometheusValidatorOpts)
+	if !MatchFile(o.Files, name) {
+		log.Debugf("AlertmanagerValidator::Validate()[count=%v][manager=%v]: skipping %v, does not match %v", v.Counter, v.Manager, name, o.Files)
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return NewValidatorError().WithFile(name).WithMessage(err.Error())
+	}
+
+	if _, err = amconfig.Load(string(data)); err != nil {
+		msg := fmt.Sprintf("could not parse alertmanager config. err=%v", err.Error())
+		log.Errorf("AlertmanagerValidator::Validate()[count=%v][manager=%v]: %v for %v", v.Counter, v.Manager, msg, name)
+		return NewValidatorError().WithFile(name).WithMessage(msg)
+	}
+	log.Debugf("AlertmanagerValidator::Validate()[count=%v][manager=%v]: %v passed validation", v.Counter, v.Manager, name)
+	return nil
+}
+
+func (v AlertmanagerValidator) GetMethod() string {
+	return v.Method
+}
+
+func (v AlertmanagerValidator) GetOpts() ValidatorOpts {
+	return v.Opts
+}
+
+func (v AlertmanagerValidator) SetOpts(opts ValidatorOpts) bool {
+	v.Opts = opts.(PrometheusValidatorOpts)
+	return true
+}
+
+func (v AlertmanagerValidator) SetCounter(c int) Validator {
+	v.Counter = c
+	return v
+}
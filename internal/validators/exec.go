@@ -0,0 +1,135 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultExecTimeout = 30
+	// filePlaceholder is replaced in the command line with the path to the
+	// staged file which is being validated
+	filePlaceholder = "%file%"
+)
+
+func NewExecValidator(manager string, method string, entry []byte) (Validator, error) {
+	var (
+		err    error
+		result ExecValidator
+		opts   ExecValidatorOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Command = strings.TrimSpace(environment.GetVar(opts.Command))
+	if opts.Command == "" {
+		return result, errors.New("no command defined for exec validator")
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout == 0 {
+		log.Warnf("NewExecValidator(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultExecTimeout)
+		newTimeout = defaultExecTimeout
+	}
+	opts.timeout = time.Duration(newTimeout) * time.Second
+
+	for i := range opts.Files {
+		opts.Files[i] = environment.GetVar(opts.Files[i])
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, err
+}
+
+type ExecValidator struct {
+	Manager string            `json:"-"`
+	Counter int               `json:"-"`
+	Method  string            `json:"method"`
+	Opts    ExecValidatorOpts `json:"opts"`
+}
+
+type ExecValidatorOpts struct {
+	Command string   `json:"command"`
+	Files   []string `json:"files"`
+	Timeout string   `json:"timeout"`
+	timeout time.Duration
+}
+
+// Validate runs the configured command against the staged file. A non-zero
+// exit status, or the command not completing within the timeout, is
+// considered a validation failure.
+func (v ExecValidator) Validate(file string, name string) error {
+	o := v.GetOpts().(ExecValidatorOpts)
+	if !MatchFile(o.Files, name) {
+		log.Debugf("ExecValidator::Validate()[count=%v][manager=%v]: skipping %v, does not match %v", v.Counter, v.Manager, name, o.Files)
+		return nil
+	}
+
+	args := strings.Fields(o.Command)
+	for i := range args {
+		args[i] = strings.Replace(args[i], filePlaceholder, file, -1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	log.Debugf("ExecValidator::Validate()[count=%v][manager=%v]: running %v for %v", v.Counter, v.Manager, args, name)
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		msg := fmt.Sprintf("validator command timed out after %v", o.timeout)
+		log.Errorf("ExecValidator::Validate()[count=%v][manager=%v]: %v for %v", v.Counter, v.Manager, msg, name)
+		return NewValidatorError().WithFile(name).WithMessage(msg)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("validator command failed err=%v output=%v", err.Error(), strings.TrimSpace(string(out)))
+		log.Errorf("ExecValidator::Validate()[count=%v][manager=%v]: %v for %v", v.Counter, v.Manager, msg, name)
+		return NewValidatorError().WithFile(name).WithMessage(msg)
+	}
+	log.Debugf("ExecValidator::Validate()[count=%v][manager=%v]: %v passed validation", v.Counter, v.Manager, name)
+	return nil
+}
+
+func (v ExecValidator) GetMethod() string {
+	return v.Method
+}
+
+func (v ExecValidator) GetOpts() ValidatorOpts {
+	return v.Opts
+}
+
+func (v ExecValidator) SetOpts(opts ValidatorOpts) bool {
+	v.Opts = opts.(ExecValidatorOpts)
+	return true
+}
+
+func (v ExecValidator) SetCounter(c int) Validator {
+	v.Counter = c
+	return v
+}
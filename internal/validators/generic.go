@@ -0,0 +1,49 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"fmt"
+)
+
+func NewGenericValidator(manager string, method string, entry []byte) (Validator, error) {
+	return GenericValidator{}, fmt.Errorf("unknown validator method %v", method)
+}
+
+type GenericValidator struct {
+	Opts GenericValidatorOpts
+}
+
+type GenericValidatorOpts struct {
+}
+
+func (v GenericValidator) Validate(file string, name string) error {
+	return nil
+}
+
+func (v GenericValidator) GetMethod() string {
+	return "none"
+}
+
+func (v GenericValidator) GetOpts() ValidatorOpts {
+	return v.Opts
+}
+
+func (v GenericValidator) SetOpts(opts ValidatorOpts) bool {
+	v.Opts = opts.(GenericValidatorOpts)
+	return true
+}
+
+func (v GenericValidator) SetCounter(c int) Validator {
+	return v
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/adobe/butler/internal/environment"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	log "github.com/sirupsen/logrus"
+)
+
+func NewPrometheusRulesValidator(manager string, method string, entry []byte) (Validator, error) {
+	var (
+		err    error
+		result PrometheusRulesValidator
+		opts   PrometheusValidatorOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	for i := range opts.Files {
+		opts.Files[i] = environment.GetVar(opts.Files[i])
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, err
+}
+
+type PrometheusRulesValidator struct {
+	Manager string                  `json:"-"`
+	Counter int                     `json:"-"`
+	Method  string                  `json:"method"`
+	Opts    PrometheusValidatorOpts `json:"opts"`
+}
+
+// PrometheusValidatorOpts are shared by the prometheus-rules and
+// alertmanager validators.
+type PrometheusValidatorOpts struct {
+	Files []string `json:"files"`
+}
+
+// Validate parses the staged file with the prometheus rulefmt parser, which
+// prometheus loads the rules files with, so the groups, rules, PromQL
+// expressions and templates are checked the same way prometheus would, with
+// the UTF-8 metric and label names prometheus accepts by default.
+func (v PrometheusRulesValidator) Validate(file string, name string) error {
+	o := v.GetOpts().(PrometheusValidatorOpts)
+	if !MatchFile(o.Files, name) {
+		log.Debugf("PrometheusRulesValidator::Validate()[count=%v][manager=%v]: skipping %v, does not match %v", v.Counter, v.Manager, name, o.Files)
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return NewValidatorError().WithFile(name).WithMessage(err.Error())
+	}
+
+	if _, errs := rulefmt.Parse(data, false, model.UTF8Validation); len(errs) > 0 {
+		var msgs []string
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		msg := fmt.Sprintf("could not parse rules. err=%v", strings.Join(msgs, "; "))
+		log.Errorf("PrometheusRulesValidator::Validate()[count=%v][manager=%v]: %v for %v", v.Counter, v.Manager, msg, name)
+		return NewValidatorError().WithFile(name).WithMessage(msg)
+	}
+	log.Debugf("PrometheusRulesValidator::Validate()[count=%v][manager=%v]: %v passed validation", v.Counter, v.Manager, name)
+	return nil
+}
+
+func (v PrometheusRulesValidator) GetMethod() string {
+	return v.Method
+}
+
+func (v PrometheusRulesValidator) GetOpts() ValidatorOpts {
+	return v.Opts
+}
+
+func (v PrometheusRulesValidator) SetOpts(opts ValidatorOpts) bool {
+	v.Opts = opts.(PrometheusValidatorOpts)
+	return true
+}
+
+func (v PrometheusRulesValidator) SetCounter(c int) Validator {
+	v.Counter = c
+	return v
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PrometheusValidatorsTestSuite{})
+
+type PrometheusValidatorsTestSuite struct {
+}
+
+var TestRulesGood = []byte(`groups:
+- name: example
+  interval: 30s
+  rules:
+  - record: job:http_inprogress_requests:sum
+    expr: sum(http_inprogress_requests) by (job)
+  - alert: HighRequestLatency
+    expr: job:request_latency_seconds:mean5m{job="myjob"} > 0.5
+    for: 10m
+    labels:
+      severity: page
+    annotations:
+      summary: High request latency
+`)
+
+var TestRulesBad = map[string][]byte{
+	"unknown field": []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up\n    bogus: true\n"),
+	"no expr":       []byte("groups:\n- name: a\n  rules:\n  - alert: A\n"),
+	"both":          []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    record: a\n    expr: up\n"),
+	"dup group":     []byte("groups:\n- name: a\n  rules: []\n- name: a\n  rules: []\n"),
+	"record for":    []byte("groups:\n- name: a\n  rules:\n  - record: a\n    expr: up\n    for: 5m\n"),
+	"bad for":       []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up\n    for: 10x\n"),
+	"bad label":     []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up\n    labels:\n      __name__: c\n"),
+	"bad expr":      []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: sum(up\n"),
+	"bad template":  []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up\n    annotations:\n      summary: '{{ $labels.job'\n"),
+}
+
+var TestAlertmanagerGood = []byte(`global:
+  resolve_timeout: 5m
+route:
+  receiver: default
+  group_by: ['alertname']
+  group_wait: 30s
+  routes:
+  - receiver: pager
+    match_re:
+      severity: page|critical
+    mute_time_intervals: ['weekends']
+receivers:
+- name: default
+- name: pager
+  pagerduty_configs:
+  - service_key: foo
+time_intervals:
+- name: weekends
+  time_intervals:
+  - weekdays: ['saturday', 'sunday']
+`)
+
+var TestAlertmanagerBad = map[string][]byte{
+	"no route":           []byte("receivers:\n- name: a\n"),
+	"no root receiver":   []byte("route:\n  group_by: [a]\nreceivers:\n- name: a\n"),
+	"undefined receiver": []byte("route:\n  receiver: a\n  routes:\n  - receiver: b\nreceivers:\n- name: a\n"),
+	"dup receiver":       []byte("route:\n  receiver: a\nreceivers:\n- name: a\n- name: a\n"),
+	"bad regex":          []byte("route:\n  receiver: a\n  routes:\n  - receiver: a\n    match_re:\n      a: '('\nreceivers:\n- name: a\n"),
+	"unknown top level":  []byte("route:\n  receiver: a\nreceivers:\n- name: a\nbogus: true\n"),
+	"bad duration":       []byte("route:\n  receiver: a\n  group_wait: 5y5\nreceivers:\n- name: a\n"),
+	"bad matcher":        []byte("route:\n  receiver: a\n  routes:\n  - receiver: a\n    matchers: ['a=~(']\nreceivers:\n- name: a\n"),
+	"bad integration":    []byte("route:\n  receiver: a\nreceivers:\n- name: a\n  pagerduty_configs:\n  - severity: page\n"),
+}
+
+func writeTmp(c *C, data []byte) string {
+	f, err := ioutil.TempFile("/tmp", "bvalidator")
+	c.Assert(err, IsNil)
+	f.Write(data)
+	f.Close()
+	return f.Name()
+}
+
+func (s *PrometheusValidatorsTestSuite) TestPrometheusRules(c *C) {
+	v, err := NewPrometheusRulesValidator("testing", "prometheus-rules", []byte(`{"files": ["*.rules"]}`))
+	c.Assert(err, IsNil)
+
+	good := writeTmp(c, TestRulesGood)
+	defer os.Remove(good)
+	c.Assert(v.Validate(good, "alerts/example.rules"), IsNil)
+
+	for k, data := range TestRulesBad {
+		f := writeTmp(c, data)
+		c.Assert(v.Validate(f, "example.rules"), NotNil, Commentf("expected failure for %v", k))
+		// does not match the files glob, so it is skipped
+		c.Assert(v.Validate(f, "prometheus.yml"), IsNil)
+		os.Remove(f)
+	}
+}
+
+func (s *PrometheusValidatorsTestSuite) TestAlertmanager(c *C) {
+	v, err := NewAlertmanagerValidator("testing", "alertmanager", []byte(`null`))
+	c.Assert(err, IsNil)
+
+	good := writeTmp(c, TestAlertmanagerGood)
+	defer os.Remove(good)
+	c.Assert(v.Validate(good, "alertmanager.yml"), IsNil)
+
+	for k, data := range TestAlertmanagerBad {
+		f := writeTmp(c, data)
+		c.Assert(v.Validate(f, "alertmanager.yml"), NotNil, Commentf("expected failure for %v", k))
+		os.Remove(f)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/spf13/viper"
+)
+
+// Validator is the interface which all the manager validators must
+// implement. Validate is handed the path to the staged (downloaded,
+// rendered and sanitized) file, along with the name the file will have
+// underneath the manager dest-path.
+type Validator interface {
+	Validate(file string, name string) error
+	GetMethod() string
+	GetOpts() ValidatorOpts
+	SetOpts(ValidatorOpts) bool
+	SetCounter(int) Validator
+}
+
+type ValidatorOpts interface {
+}
+
+// New returns the validators which have been configured for the manager
+// entry. Unlike the reloaders, validators are optional, so when none have
+// been defined an empty slice and nil error are returned.
+func New(entry string) ([]Validator, error) {
+	return newFromKey(entry, fmt.Sprintf("%s.validator", entry))
+}
+
+// NewPost returns the post-copy validators which have been configured for the
+// manager entry. They are configured the same way as the validators, but
+// under the manager post-validator section.
+func NewPost(entry string) ([]Validator, error) {
+	return newFromKey(entry, fmt.Sprintf("%s.post-validator", entry))
+}
+
+// NewFileGroup returns the validators which have been configured for the
+// file group of the manager entry, under its file-groups section.
+func NewFileGroup(entry string, group string) ([]Validator, error) {
+	return newFromKey(entry, fmt.Sprintf("%s.file-groups.%s.validator", entry, group))
+}
+
+func newFromKey(entry string, key string) ([]Validator, error) {
+	var (
+		err     error
+		methods []string
+		result  map[string]interface{}
+		res     []Validator
+	)
+
+	if !viper.IsSet(key) {
+		return res, nil
+	}
+
+	err = viper.UnmarshalKey(key, &result)
+	if err != nil {
+		return res, err
+	}
+
+	// validator is defined, but there's no method
+	if result == nil || result["method"] == nil {
+		return res, errors.New("no validator method has been defined for manager")
+	}
+
+	// method can either be a single string, or an array of methods which
+	// are run in order
+	switch m := result["method"].(type) {
+	case string:
+		methods = append(methods, m)
+	case []interface{}:
+		for _, i := range m {
+			methods = append(methods, fmt.Sprintf("%v", i))
+		}
+	default:
+		return res, fmt.Errorf("unknown validator method type %T", m)
+	}
+
+	for _, method := range methods {
+		jsonRes, err := json.Marshal(result[method])
+		if err != nil {
+			return res, err
+		}
+
+		v, err := newValidator(entry, method, jsonRes)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func newValidator(manager string, method string, entry []byte) (Validator, error) {
+	switch method {
+	case "exec":
+		return NewExecValidator(manager, method, entry)
+	case "prometheus-rules":
+		return NewPrometheusRulesValidator(manager, method, entry)
+	case "alertmanager":
+		return NewAlertmanagerValidator(manager, method, entry)
+	default:
+		return NewGenericValidator(manager, method, entry)
+	}
+}
+
+// MatchFile returns true if the name matches any of the provided glob
+// patterns. An empty pattern list matches everything.
+func MatchFile(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		// allow matching against the base name as well, so that "*.yml"
+		// catches "alerts/foo.yml"
+		if ok, _ := path.Match(p, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func NewValidatorError() *ValidatorError {
+	return &ValidatorError{}
+}
+
+func (v *ValidatorError) WithFile(f string) *ValidatorError {
+	v.File = f
+	return v
+}
+
+func (v *ValidatorError) WithMessage(m string) *ValidatorError {
+	v.Message = m
+	return v
+}
+
+func (v *ValidatorError) Error() string {
+	msg := fmt.Sprintf("%v. file=%v", v.Message, v.File)
+	return msg
+}
+
+type ValidatorError struct {
+	File    string
+	Message string
+}
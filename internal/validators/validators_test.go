@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package validators
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&ValidatorsTestSuite{})
+
+type ValidatorsTestSuite struct {
+	TmpFile string
+}
+
+var TestValidatorConfig = []byte(`[testing]
+  [testing.validator]
+    method = "exec"
+    [testing.validator.exec]
+      command = "test -s %file%"
+      timeout = "5"
+      files = ["*.yml"]
+`)
+
+var TestValidatorConfigNoMethod = []byte(`[testing]
+  [testing.validator]
+    [testing.validator.exec]
+      command = "true"
+`)
+
+func (s *ValidatorsTestSuite) SetUpSuite(c *C) {
+	f, err := ioutil.TempFile("/tmp", "bvalidator")
+	c.Assert(err, IsNil)
+	f.Write([]byte("hello\n"))
+	f.Close()
+	s.TmpFile = f.Name()
+}
+
+func (s *ValidatorsTestSuite) TearDownSuite(c *C) {
+	os.Remove(s.TmpFile)
+}
+
+func (s *ValidatorsTestSuite) TestNewNotConfigured(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer([]byte(`[testing]`))), IsNil)
+	res, err := New("testing")
+	c.Assert(err, IsNil)
+	c.Assert(len(res), Equals, 0)
+}
+
+func (s *ValidatorsTestSuite) TestNewNoMethod(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(TestValidatorConfigNoMethod)), IsNil)
+	_, err := New("testing")
+	c.Assert(err, NotNil)
+}
+
+func (s *ValidatorsTestSuite) TestNewExec(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(TestValidatorConfig)), IsNil)
+	res, err := New("testing")
+	c.Assert(err, IsNil)
+	c.Assert(len(res), Equals, 1)
+	c.Assert(res[0].GetMethod(), Equals, "exec")
+	c.Assert(res[0].Validate(s.TmpFile, "prometheus.yml"), IsNil)
+	c.Assert(res[0].Validate("/nonexistent/file", "prometheus.yml"), NotNil)
+	// does not match the files glob, so it is skipped
+	c.Assert(res[0].Validate("/nonexistent/file", "prometheus.json"), IsNil)
+}
+
+func (s *ValidatorsTestSuite) TestNewPost(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(TestValidatorConfig)), IsNil)
+	res, err := NewPost("testing")
+	c.Assert(err, IsNil)
+	c.Assert(len(res), Equals, 0)
+
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(bytes.Replace(TestValidatorConfig, []byte("validator"), []byte("post-validator"), -1))), IsNil)
+	res, err = NewPost("testing")
+	c.Assert(err, IsNil)
+	c.Assert(len(res), Equals, 1)
+	res, err = New("testing")
+	c.Assert(err, IsNil)
+	c.Assert(len(res), Equals, 0)
+}
+
+func (s *ValidatorsTestSuite) TestExecValidatorTimeout(c *C) {
+	v, err := NewExecValidator("testing", "exec", []byte(`{"command": "sleep 5", "timeout": "1"}`))
+	c.Assert(err, IsNil)
+	err = v.Validate(s.TmpFile, "foo.yml")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, ".*timed out.*")
+}
+
+func (s *ValidatorsTestSuite) TestExecValidatorNoCommand(c *C) {
+	_, err := NewExecValidator("testing", "exec", []byte(`{"timeout": "1"}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *ValidatorsTestSuite) TestMatchFile(c *C) {
+	c.Assert(MatchFile(nil, "foo.yml"), Equals, true)
+	c.Assert(MatchFile([]string{"*.yml"}, "alerts/foo.yml"), Equals, true)
+	c.Assert(MatchFile([]string{"alerts/*.yml"}, "alerts/foo.yml"), Equals, true)
+	c.Assert(MatchFile([]string{"rules/*.yml"}, "alerts/foo.yml"), Equals, false)
+}
@@ -0,0 +1,433 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package butler embeds the butler configuration management engine in other
+// Go services. It retrieves the butler configuration, and manages the
+// configuration files of every manager on schedule, the same way the butler
+// binary does:
+//
+//	b, err := butler.New(butler.Options{ConfigURL: "https://config.example.com/butler.toml"})
+//	if err != nil {
+//		return err
+//	}
+//	return b.Run(ctx)
+//
+// The butler configuration, and the retrieval of the configuration files, is
+// implemented by the config, methods and reloaders packages, which can be
+// used on their own. butler keeps its state in package variables, so only one
+// Butler can run in a process.
+package butler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/internal/tracing"
+	"github.com/adobe/butler/pkg/config"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The defaults of the Options which are left empty.
+const (
+	DefaultInterval         = 300 * time.Second
+	DefaultShutdownTimeout  = 30 * time.Second
+	DefaultHTTPTimeout      = 10
+	DefaultHTTPRetries      = 5
+	DefaultHTTPRetryWaitMin = 5
+	DefaultHTTPRetryWaitMax = 15
+	DefaultDNSTimeout       = methods.DefaultDNSTimeout
+)
+
+// loadRetryWait is how long Load waits before it retries to retrieve the
+// butler configuration.
+var loadRetryWait = 5 * time.Second
+
+// Options say where the butler configuration is, how to retrieve it, and how
+// often.
+type Options struct {
+	// ConfigURL is the full URL of the butler configuration, eg:
+	// https://host/butler.toml, s3://bucket/butler.toml, blob://account/container/butler.toml,
+	// etcd://host/butler.toml or file:///etc/butler/butler.toml.
+	ConfigURL string
+	// Defaults is the path of a local butler configuration file of defaults,
+	// which the butler configuration overlays.
+	Defaults string
+	// Strict rejects unknown keys, missing required keys and values of the
+	// wrong type in the butler configuration.
+	Strict bool
+	// InsecureSkipVerify disables SSL verification for etcd and https.
+	InsecureSkipVerify bool
+	// LogLevel is the log level of the butler configuration.
+	LogLevel log.Level
+	// PluginsDir is the directory of the method and reloader plugins, see
+	// LoadPlugins.
+	PluginsDir string
+	// Bootstrap is the path of a copy of the last butler configuration
+	// which was parsed, which butler starts up on when it cannot retrieve
+	// the butler configuration, eg: during an outage of the remote
+	// repository. Nothing is kept when it is empty.
+	Bootstrap string
+	// MethodOptions is the path of a local file of the options of the
+	// method which retrieves the butler configuration, in the form of the
+	// options of the method of a repo, eg: an [s3] table of the bucket,
+	// region and credentials. They are used instead of the HTTP, S3, Blob
+	// and Etcd Options below, so that every option of the repo methods,
+	// eg: the insecure-skip-verify of http, is available.
+	MethodOptions string
+
+	// HTTPTimeout, HTTPRetries, HTTPRetryWaitMin and HTTPRetryWaitMax, in
+	// seconds, are used to retrieve a http:// or https:// butler
+	// configuration. Zero uses the Default value.
+	HTTPTimeout      int
+	HTTPRetries      int
+	HTTPRetryWaitMin int
+	HTTPRetryWaitMax int
+	// HTTPAuthType is basic, digest or token-key, or empty for no HTTP
+	// authentication.
+	HTTPAuthType  string
+	HTTPAuthUser  string
+	HTTPAuthToken string
+
+	// S3Region is required for a s3:// butler configuration. The credentials
+	// default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN environment variables.
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+
+	// BlobAccountName defaults to the host of a blob:// butler configuration,
+	// and BlobAccountKey to the ACCOUNT_KEY environment variable.
+	BlobAccountName string
+	BlobAccountKey  string
+
+	// EtcdEndpoints are required for an etcd:// butler configuration.
+	EtcdEndpoints []string
+
+	// DNSServers, eg: 10.0.0.2 or [fd00::2]:5353, resolve the host names
+	// butler connects to instead of the servers of /etc/resolv.conf, with
+	// DNSTimeout for each query, see methods.SetResolver. Empty leaves the
+	// resolver of the system.
+	DNSServers []string
+	DNSTimeout time.Duration
+
+	// Interval is how often the butler configuration is retrieved. Cron, a
+	// cron expression with optional seconds and CRON_TZ, overrides it.
+	Interval time.Duration
+	Cron     string
+	// Splay is the maximum random delay added to every retrieval of the
+	// butler configuration.
+	Splay time.Duration
+	// Watch reads a file:// butler configuration as soon as it changes, in
+	// addition to retrieving it on schedule.
+	Watch bool
+	// ShutdownTimeout is how long Run waits, once its context is done, for
+	// the runs in flight to finish.
+	ShutdownTimeout time.Duration
+
+	// OTLPEndpoint is the base URL of the OTLP/HTTP receiver of an
+	// OpenTelemetry collector, eg: http://otel-collector:4318, which the
+	// spans of the butler runs are exported to. OTLPHeaders are sent along,
+	// eg: for authentication. They default to the OTEL_EXPORTER_OTLP_ENDPOINT
+	// and OTEL_EXPORTER_OTLP_HEADERS environment variables, and nothing is
+	// traced without an endpoint.
+	OTLPEndpoint string
+	OTLPHeaders  map[string]string
+}
+
+// Butler retrieves the butler configuration, and manages the configuration
+// files of every manager.
+type Butler struct {
+	opts     Options
+	schedule scheduler.Schedule
+	bc       *config.ButlerConfig
+	loaded   bool
+}
+
+// New returns a Butler which retrieves the butler configuration at the
+// opts.ConfigURL. It does not retrieve anything until Load, RunOnce or Run is
+// called.
+func New(opts Options) (*Butler, error) {
+	if opts.ConfigURL == "" {
+		return nil, errors.New("you must provide a ConfigURL for the butler configuration")
+	}
+	u, err := url.Parse(opts.ConfigURL)
+	if err != nil || u.Scheme == "" {
+		return nil, fmt.Errorf("cannot parse ConfigURL. ConfigURL must be in URL form. ConfigURL=%v", opts.ConfigURL)
+	}
+	if err = LoadPlugins(opts.PluginsDir); err != nil {
+		return nil, err
+	}
+	if err = methods.SetResolver(opts.DNSServers, opts.DNSTimeout); err != nil {
+		return nil, err
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Splay < 0 {
+		return nil, fmt.Errorf("Splay must not be negative. Splay=%v", opts.Splay)
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	schedule := scheduler.Every(opts.Interval)
+	if cron := strings.TrimSpace(opts.Cron); cron != "" {
+		schedule, err = scheduler.Parse(cron)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse Cron. err=%s", err.Error())
+		}
+	}
+
+	bc, err := config.NewButlerConfig(&config.ButlerConfigOpts{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		LogLevel:           opts.LogLevel,
+		URL:                u,
+		Defaults:           opts.Defaults,
+		Strict:             opts.Strict,
+		Bootstrap:          opts.Bootstrap,
+		MethodOptions:      opts.MethodOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unsupported butler scheme. scheme=%v", u.Scheme)
+	}
+	if err = setMethodOpts(bc, &opts); err != nil {
+		return nil, err
+	}
+	if err = bc.Init(); err != nil {
+		return nil, fmt.Errorf("cannot initialize butler config. err=%s", err.Error())
+	}
+	traceOpts, err := tracing.Opts{Endpoint: opts.OTLPEndpoint, Headers: opts.OTLPHeaders}.WithEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err = tracing.Init(traceOpts); err != nil {
+		return nil, err
+	}
+	bc.SetInterval(int(opts.Interval / time.Second))
+
+	return &Butler{
+		opts:     opts,
+		schedule: scheduler.WithSplay(schedule, opts.Splay),
+		bc:       bc,
+	}, nil
+}
+
+// setMethodOpts sets the options of the method which retrieves the butler
+// configuration from the scheme of its URL.
+func setMethodOpts(bc *config.ButlerConfig, o *Options) error {
+	// the method is set up from the MethodOptions instead
+	if o.MethodOptions != "" {
+		if bc.Scheme() == "etcd" {
+			bc.SetURL(etcdConfigURL(bc.URL()))
+		}
+		bc.SetMethodOpts(methods.GenericMethodOpts{Scheme: bc.Scheme()})
+		return nil
+	}
+	switch bc.Scheme() {
+	case "http", "https":
+		opts := methods.HTTPMethodOpts{Scheme: bc.Scheme()}
+		authType := strings.ToLower(o.HTTPAuthType)
+		if authType != "" {
+			if o.HTTPAuthUser == "" || o.HTTPAuthToken == "" {
+				return errors.New("HTTP Authentication enabled, but insufficient authentication details provided.")
+			}
+			switch authType {
+			case "basic", "digest", "token-key":
+				opts.HTTPAuthType = authType
+				opts.HTTPAuthToken = o.HTTPAuthToken
+				opts.HTTPAuthUser = o.HTTPAuthUser
+			default:
+				return fmt.Errorf("Unsupported HTTP Authentication Type: %s", authType)
+			}
+		}
+		opts.Timeout = orDefault(o.HTTPTimeout, DefaultHTTPTimeout)
+		opts.Retries = orDefault(o.HTTPRetries, DefaultHTTPRetries)
+		opts.RetryWaitMin = orDefault(o.HTTPRetryWaitMin, DefaultHTTPRetryWaitMin)
+		opts.RetryWaitMax = orDefault(o.HTTPRetryWaitMax, DefaultHTTPRetryWaitMax)
+		log.Debugf("butler.New(): setting HttpTimeout[%d] HttpRetries[%d] RetryWaitMin[%d] RetryWaitMax[%d]", opts.Timeout, opts.Retries, opts.RetryWaitMin, opts.RetryWaitMax)
+		bc.SetMethodOpts(opts)
+	case "s3":
+		if o.S3Region == "" {
+			return errors.New("you must provide a S3Region for use with the s3 downloader")
+		}
+		opts := methods.S3MethodOpts{
+			Scheme:          bc.Scheme(),
+			Region:          o.S3Region,
+			Bucket:          bc.Host(),
+			AccessKeyID:     orEnv(o.S3AccessKeyID, "AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: orEnv(o.S3SecretAccessKey, "AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    orEnv(o.S3SessionToken, "AWS_SESSION_TOKEN"),
+		}
+		log.Debugf("butler.New(): setting s3 region=%v bucket=%v", opts.Region, opts.Bucket)
+		bc.SetMethodOpts(opts)
+	case "blob":
+		opts := methods.BlobMethodOpts{
+			Scheme:      bc.Scheme(),
+			AccountKey:  orEnv(o.BlobAccountKey, "ACCOUNT_KEY"),
+			AccountName: o.BlobAccountName,
+		}
+		if opts.AccountName == "" {
+			opts.AccountName = bc.Host()
+		}
+		bc.SetMethodOpts(opts)
+	case "etcd":
+		if len(o.EtcdEndpoints) == 0 {
+			return errors.New("you must provide EtcdEndpoints for use with the etcd downloader")
+		}
+		bc.SetURL(etcdConfigURL(bc.URL()))
+		log.Debugf("butler.New(): setting etcd endpoints=%v", o.EtcdEndpoints)
+		bc.SetMethodOpts(methods.EtcdMethodOpts{Scheme: bc.Scheme(), Endpoints: o.EtcdEndpoints})
+	case "file":
+		bc.SetMethodOpts(methods.FileMethodOpts{Scheme: bc.Scheme()})
+	default:
+		if methods.IsPlugin(bc.Scheme()) {
+			bc.SetMethodOpts(methods.PluginMethodOpts{Scheme: bc.Scheme()})
+			break
+		}
+		bc.SetMethodOpts(methods.GenericMethodOpts{Scheme: bc.Scheme()})
+	}
+	return nil
+}
+
+// etcdConfigURL returns the URL of an etcd butler configuration for the etcd
+// method, which reads the key at the path of the URL, while the key of the
+// butler configuration starts with the host.
+func etcdConfigURL(u *url.URL) *url.URL {
+	res, _ := url.Parse(fmt.Sprintf("%v://%v/%v%v", u.Scheme, u.Host, u.Host, u.Path))
+	return res
+}
+
+// LoadPlugins registers the method plugins, named butler-method-<method>,
+// and the reloader plugins, named butler-reloader-<method>, in the dir, so
+// that the butler configuration can use their methods. A method plugin can
+// retrieve the butler configuration itself, eg: vault://host/butler.toml.
+// Nothing is loaded when the dir is empty.
+func LoadPlugins(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := methods.LoadPlugins(dir); err != nil {
+		return err
+	}
+	_, err := reloaders.LoadPlugins(dir)
+	return err
+}
+
+// Config returns the butler configuration, eg: to serve it with the monitor.
+func (b *Butler) Config() *config.ButlerConfig {
+	return b.bc
+}
+
+// Load retrieves the butler configuration, and retries every 5 seconds until
+// it is retrieved, or the ctx is done.
+func (b *Butler) Load(ctx context.Context) error {
+	for {
+		log.Infof("butler.Load(): Loading initial butler configuration.")
+		err := b.bc.Handler()
+		if err == nil {
+			log.Infof("butler.Load(): Loaded initial butler configuration.")
+			b.loaded = true
+			return nil
+		}
+		log.Warnf("butler.Load(): Sleeping %v.", loadRetryWait)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cannot retrieve butler configuration. err=%s", err.Error())
+		case <-time.After(loadRetryWait):
+		}
+	}
+}
+
+// RunOnce retrieves the butler configuration, and runs the configuration
+// management of every manager once. It returns the errors of
+// config.ButlerConfig.RunOnce.
+func (b *Butler) RunOnce() error {
+	err := b.bc.RunOnce()
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.ShutdownTimeout)
+	defer cancel()
+	if terr := tracing.Flush(ctx); terr != nil {
+		log.Warnf("butler.RunOnce(): could not export the spans of the run. err=%s", terr.Error())
+	}
+	return err
+}
+
+// Run loads the butler configuration, unless Load was already called, and
+// runs the configuration management of every manager on the schedule of the
+// butler configuration until the ctx is done. It then waits up to the
+// ShutdownTimeout for the runs in flight to finish, and returns an error when
+// butler did not stop cleanly.
+func (b *Butler) Run(ctx context.Context) error {
+	if !b.loaded {
+		if err := b.Load(ctx); err != nil {
+			return err
+		}
+	}
+
+	if b.opts.Watch && b.bc.Scheme() == "file" {
+		stopWatch, err := b.bc.WatchConfig()
+		if err != nil {
+			log.Warnf("butler.Run(): cannot watch the butler configuration, it is only retrieved on schedule. err=%s", err.Error())
+		} else {
+			defer stopWatch()
+		}
+	}
+
+	sched := scheduler.NewScheduler()
+	log.Debugf("butler.Run(): running butler configuration scheduler %v", b.schedule)
+	sched.Add(config.ConfigJob, b.schedule, func(ctx context.Context) { b.bc.Handler() })
+	b.bc.SetScheduler(sched)
+	b.bc.UpdateSchedules()
+	b.bc.WatchRepos()
+
+	// the scheduler is running, see config.ButlerConfig.Alive, while the
+	// initial run is under way
+	sched.Start()
+	log.Debugf("butler.Run(): doing initial run of butler configuration management handler")
+	b.bc.RunCMHandler()
+
+	<-ctx.Done()
+	log.Infof("butler.Run(): stopping, waiting for the runs in flight to finish")
+	if err := b.bc.Shutdown(b.opts.ShutdownTimeout); err != nil {
+		return fmt.Errorf("butler did not stop cleanly. err=%s", err.Error())
+	}
+	tctx, cancel := context.WithTimeout(context.Background(), b.opts.ShutdownTimeout)
+	defer cancel()
+	if err := tracing.Shutdown(tctx); err != nil {
+		log.Warnf("butler.Run(): could not export the remaining spans. err=%s", err.Error())
+	}
+	log.Infof("butler.Run(): butler stopped.")
+	return nil
+}
+
+func orDefault(v int, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func orEnv(v string, env string) string {
+	if v == "" {
+		return os.Getenv(env)
+	}
+	return v
+}
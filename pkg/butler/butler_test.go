@@ -0,0 +1,206 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package butler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ButlerTestSuite struct{}
+
+var _ = Suite(&ButlerTestSuite{})
+
+func (s *ButlerTestSuite) TestNewErrors(c *C) {
+	for _, t := range []struct {
+		opts Options
+		err  string
+	}{
+		{Options{}, "you must provide a ConfigURL.*"},
+		{Options{ConfigURL: "/etc/butler.toml"}, "cannot parse ConfigURL.*"},
+		{Options{ConfigURL: "ftp://host/butler.toml"}, "unsupported butler scheme. scheme=ftp"},
+		{Options{ConfigURL: "s3://bucket/butler.toml"}, "you must provide a S3Region.*"},
+		{Options{ConfigURL: "etcd://host/butler.toml"}, "you must provide EtcdEndpoints.*"},
+		{Options{ConfigURL: "http://host/butler.toml", HTTPAuthType: "basic"}, "HTTP Authentication enabled.*"},
+		{Options{ConfigURL: "http://host/butler.toml", HTTPAuthType: "ntlm", HTTPAuthUser: "u", HTTPAuthToken: "t"}, "Unsupported HTTP Authentication Type: ntlm"},
+		{Options{ConfigURL: "file:///etc/butler.toml", Cron: "not a cron"}, "cannot parse Cron.*"},
+		{Options{ConfigURL: "file:///etc/butler.toml", Splay: -time.Second}, "Splay must not be negative.*"},
+	} {
+		_, err := New(t.opts)
+		c.Assert(err, ErrorMatches, t.err, Commentf("opts=%+v", t.opts))
+	}
+}
+
+func (s *ButlerTestSuite) TestNewMethodOpts(c *C) {
+	b, err := New(Options{ConfigURL: "http://host/butler.toml", HTTPRetries: 2})
+	c.Assert(err, IsNil)
+	opts := b.Config().Opts().(methods.HTTPMethodOpts)
+	c.Assert(opts.Retries, Equals, 2)
+	c.Assert(opts.Timeout, Equals, DefaultHTTPTimeout)
+	c.Assert(b.Config().GetInterval(), Equals, int(DefaultInterval/time.Second))
+
+	b, err = New(Options{ConfigURL: "etcd://host/butler.toml", EtcdEndpoints: []string{"http://etcd:2379"}})
+	c.Assert(err, IsNil)
+	c.Assert(b.Config().URL().String(), Equals, "etcd://host/host/butler.toml")
+	c.Assert(b.Config().Opts().(methods.EtcdMethodOpts).Endpoints, DeepEquals, []string{"http://etcd:2379"})
+}
+
+func (s *ButlerTestSuite) TestNewMethodOptions(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bbutleropts")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "method.toml")
+	c.Assert(ioutil.WriteFile(path, []byte("[s3]\n  region = \"us-west-2\"\n[etcd]\n  endpoints = [\"http://etcd:2379\"]\n"), 0644), IsNil)
+
+	// the method is set up from the method options rather than the S3 options
+	b, err := New(Options{ConfigURL: "s3://butler-configs/butler.toml", MethodOptions: path})
+	c.Assert(err, IsNil)
+	m := b.Config().Client.Method.(methods.S3Method)
+	c.Assert(m.Bucket, Equals, "butler-configs")
+	c.Assert(m.Region, Equals, "us-west-2")
+
+	b, err = New(Options{ConfigURL: "etcd://host/butler.toml", MethodOptions: path})
+	c.Assert(err, IsNil)
+	c.Assert(b.Config().URL().String(), Equals, "etcd://host/host/butler.toml")
+	c.Assert(b.Config().Client.Method.(methods.EtcdMethod).Endpoints, DeepEquals, []string{"http://etcd:2379"})
+
+	_, err = New(Options{ConfigURL: "http://host/butler.toml", MethodOptions: path})
+	c.Assert(err, ErrorMatches, "cannot initialize butler config. err=no http method options in .*")
+}
+
+func (s *ButlerTestSuite) TestLoadCancelled(c *C) {
+	b, err := New(Options{ConfigURL: "file:///nonexistent/butler.toml"})
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(b.Load(ctx), ErrorMatches, "cannot retrieve butler configuration.*")
+	c.Assert(b.Run(ctx), ErrorMatches, "cannot retrieve butler configuration.*")
+}
+
+// runFixture writes a butler configuration with a single manager, whose
+// file is copied from dir/repo to dir/dest.
+func runFixture(c *C) string {
+	dir, err := ioutil.TempDir("/tmp", "bembed")
+	c.Assert(err, IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "repo"), 0755), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "dest"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "repo", "app.conf"), []byte("#butlerstart\nkey = value\n#butlerend\n"), 0644), IsNil)
+
+	cfg := fmt.Sprintf(`#butlerstart
+[globals]
+  config-managers = ["app"]
+  status-file = "%[1]v/butler.status"
+  [app]
+    repos = ["localhost"]
+    dest-path = "%[1]v/dest"
+    primary-config-name = "app.conf"
+    [app.localhost]
+      method = "file"
+      repo-path = "%[1]v/repo"
+      primary-config = ["app.conf"]
+#butlerend
+`, dir)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "butler.toml"), []byte(cfg), 0644), IsNil)
+	return dir
+}
+
+// runUntilCopied runs b until the file of the runFixture is in place.
+func runUntilCopied(c *C, b *Butler, dir string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+
+	dest := filepath.Join(dir, "dest", "app.conf")
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(dest); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+	c.Assert(<-done, IsNil)
+}
+
+func (s *ButlerTestSuite) TestRun(c *C) {
+	dir := runFixture(c)
+	defer os.RemoveAll(dir)
+
+	b, err := New(Options{ConfigURL: "file://" + filepath.Join(dir, "butler.toml"), ShutdownTimeout: 5 * time.Second})
+	c.Assert(err, IsNil)
+	runUntilCopied(c, b, dir)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dest", "app.conf"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "key = value\n")
+}
+
+func (s *ButlerTestSuite) TestRunTraced(c *C) {
+	dir := runFixture(c)
+	defer os.RemoveAll(dir)
+
+	var (
+		mutex sync.Mutex
+		spans = make(map[string]map[string]interface{})
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]interface{}
+				}
+			}
+		}
+		c.Check(json.NewDecoder(r.Body).Decode(&req), IsNil)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span["name"].(string)] = span
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	b, err := New(Options{ConfigURL: "file://" + filepath.Join(dir, "butler.toml"), ShutdownTimeout: 5 * time.Second, OTLPEndpoint: collector.URL})
+	c.Assert(err, IsNil)
+	// Run exports the remaining spans once it stops
+	runUntilCopied(c, b, dir)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, name := range []string{"butler.config", "butler.run", "butler.manager", "butler.download", "butler.validate", "butler.copy"} {
+		c.Assert(spans[name], NotNil, Commentf("span %v", name))
+	}
+	c.Assert(spans["butler.config"]["traceId"], Not(Equals), spans["butler.run"]["traceId"])
+	c.Assert(spans["butler.manager"]["parentSpanId"], Equals, spans["butler.run"]["spanId"])
+	c.Assert(spans["butler.download"]["parentSpanId"], Equals, spans["butler.manager"]["spanId"])
+	c.Assert(spans["butler.copy"]["parentSpanId"], Equals, spans["butler.manager"]["spanId"])
+	c.Assert(spans["butler.download"]["traceId"], Equals, spans["butler.run"]["traceId"])
+}
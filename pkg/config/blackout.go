@@ -0,0 +1,105 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/scheduler"
+)
+
+// BlackoutWindow is a recurring window during which the manager files are
+// fetched and validated, but neither copied into place nor reloaded. The
+// window is a cron style schedule of when it opens, followed by how long it
+// stays open, eg: "0 22 * * 5 60h" for the weekend from friday 22:00.
+type BlackoutWindow struct {
+	Spec     string        `json:"spec"`
+	Duration time.Duration `json:"duration"`
+	schedule *scheduler.Cron
+}
+
+// ParseBlackoutWindows parses the blackout-windows of a manager.
+func ParseBlackoutWindows(entries []string) ([]BlackoutWindow, error) {
+	var res []BlackoutWindow
+	for _, e := range entries {
+		w, err := ParseBlackoutWindow(environment.GetVar(e))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+// ParseBlackoutWindow parses a "<minute> <hour> <day of month> <month> <day
+// of week> <duration>" blackout window. The cron fields take "*", values,
+// ranges, lists and steps, eg: "*/15", "1-5" or "0,30". The day of week is 0
+// to 6, sunday being 0 (or 7).
+func ParseBlackoutWindow(spec string) (BlackoutWindow, error) {
+	var (
+		err error
+		res BlackoutWindow
+	)
+	fields := strings.Fields(spec)
+	if len(fields) != 6 {
+		return res, fmt.Errorf("invalid blackout window %q, expected \"<minute> <hour> <day of month> <month> <day of week> <duration>\"", spec)
+	}
+	res.Spec = strings.Join(fields, " ")
+	res.Duration, err = time.ParseDuration(fields[5])
+	if err != nil || res.Duration <= 0 {
+		return res, fmt.Errorf("invalid blackout window duration %q", fields[5])
+	}
+
+	// windows open at second 0 of the minute
+	res.schedule, err = scheduler.ParseCron("0 " + strings.Join(fields[:5], " "))
+	if err != nil {
+		return res, fmt.Errorf("invalid blackout window %q: %v", spec, err.Error())
+	}
+	return res, nil
+}
+
+// End returns when the window which is open at t closes, and whether a window
+// is open at t at all.
+func (w BlackoutWindow) End(t time.Time) (time.Time, bool) {
+	var (
+		end  time.Time
+		open bool
+	)
+	t = t.Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.schedule.Matches(start) {
+			if e := start.Add(w.Duration); e.After(end) {
+				end, open = e, true
+			}
+		}
+	}
+	return end, open
+}
+
+// BlackoutEnd returns when the blackout of the manager which is in effect at
+// t ends, and whether the manager is in a blackout window at t at all.
+func (bm *Manager) BlackoutEnd(t time.Time) (time.Time, bool) {
+	var (
+		end     time.Time
+		blocked bool
+	)
+	for _, w := range bm.BlackoutWindows {
+		if e, ok := w.End(t); ok && e.After(end) {
+			end, blocked = e, true
+		}
+	}
+	return end, blocked
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestParseBlackoutWindow(c *C) {
+	for _, spec := range []string{"0 22 * * 5 60h", "*/15 9-17 * * 1-5 10m", "0,30 * 1 1 * 1h", "5/20 * * * 7 1m"} {
+		_, err := ParseBlackoutWindow(spec)
+		c.Assert(err, IsNil, Commentf("spec %v", spec))
+	}
+	for _, spec := range []string{"", "0 22 * * 5", "0 22 * * 5 forever", "0 22 * * 5 -1h", "60 * * * * 1h", "* 24 * * * 1h", "* * 0 * * 1h", "* * * 13 * 1h", "* * * * 8 1h", "5-1 * * * * 1h", "*/0 * * * * 1h", "a * * * * 1h"} {
+		_, err := ParseBlackoutWindow(spec)
+		c.Assert(err, NotNil, Commentf("spec %v", spec))
+	}
+	_, err := ParseBlackoutWindows([]string{"0 22 * * 5 60h", "bad"})
+	c.Assert(err, NotNil)
+}
+
+func (s *ConfigTestSuite) TestBlackoutEnd(c *C) {
+	// friday 16 october 2026
+	friday := func(hour int, min int) time.Time {
+		return time.Date(2026, time.October, 16, hour, min, 0, 0, time.Local)
+	}
+	weekend, err := ParseBlackoutWindow("0 22 * * 5 60h")
+	c.Assert(err, IsNil)
+	mgr := &Manager{Name: "blackout-manager", BlackoutWindows: []BlackoutWindow{weekend}}
+
+	_, blocked := mgr.BlackoutEnd(friday(21, 59))
+	c.Assert(blocked, Equals, false)
+	end, blocked := mgr.BlackoutEnd(friday(22, 0))
+	c.Assert(blocked, Equals, true)
+	c.Assert(end.Equal(friday(22, 0).Add(60*time.Hour)), Equals, true)
+	_, blocked = mgr.BlackoutEnd(friday(22, 0).Add(48 * time.Hour))
+	c.Assert(blocked, Equals, true)
+	_, blocked = mgr.BlackoutEnd(friday(22, 0).Add(60 * time.Hour))
+	c.Assert(blocked, Equals, false)
+
+	// either the day of month or the day of week matches
+	either, err := ParseBlackoutWindow("0 12 1 * 1 1h")
+	c.Assert(err, IsNil)
+	c.Assert(either.schedule.Matches(time.Date(2026, time.October, 1, 12, 0, 0, 0, time.Local)), Equals, true)
+	c.Assert(either.schedule.Matches(time.Date(2026, time.October, 19, 12, 0, 0, 0, time.Local)), Equals, true)
+	c.Assert(either.schedule.Matches(friday(12, 0)), Equals, false)
+
+	// no windows, no blackout
+	_, blocked = (&Manager{}).BlackoutEnd(friday(22, 0))
+	c.Assert(blocked, Equals, false)
+}
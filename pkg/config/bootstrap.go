@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bootstrapConfig is the copy of the last butler configuration which was
+// successfully parsed, which butler starts up on when it cannot retrieve the
+// butler configuration, see ButlerConfigOpts.Bootstrap. The configuration is
+// kept after the defaults have been overlaid, along with its includes.
+type bootstrapConfig struct {
+	URL       string           `json:"url"`
+	Saved     time.Time        `json:"saved"`
+	Version   string           `json:"version"`
+	Format    string           `json:"format"`
+	Config    []byte           `json:"config"`
+	Fragments []configFragment `json:"fragments,omitempty"`
+	Sources   []configFragment `json:"sources,omitempty"`
+}
+
+// saveBootstrap keeps the butler configuration which has just been parsed in
+// the bootstrap file, if there is one. It may carry secrets, so only the
+// user butler runs as can read it.
+func (bc *ButlerConfig) saveBootstrap(config []byte, format string, fragments []configFragment, sources []configFragment) {
+	if bc.bootstrap == "" {
+		return
+	}
+	b := bootstrapConfig{
+		URL:       RedactURL(bc.URL().String()),
+		Saved:     time.Now(),
+		Version:   contentVersion(rawConfig(config, fragments)),
+		Format:    format,
+		Config:    config,
+		Fragments: fragments,
+		Sources:   sources,
+	}
+	data, err := json.Marshal(b)
+	if err == nil {
+		err = InstallFile(bytes.NewReader(data), bc.bootstrap, InstallOpts{Fsync: true, Perms: FilePerms{Mode: 0600}})
+	}
+	if err != nil {
+		log.Errorf("ButlerConfig::saveBootstrap()[count=%v]: could not write to %v. err=%v", handlerCounter, bc.bootstrap, err.Error())
+	}
+}
+
+// loadBootstrap parses the butler configuration in the bootstrap file, so
+// that butler can manage the files of the managers while the butler
+// configuration cannot be retrieved. The configuration is retrieved again on
+// schedule, and replaces the bootstrap copy once it has been.
+func (bc *ButlerConfig) loadBootstrap() error {
+	data, err := ioutil.ReadFile(bc.bootstrap)
+	if err != nil {
+		return err
+	}
+	var b bootstrapConfig
+	if err = json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("could not parse %v. err=%v", bc.bootstrap, err.Error())
+	}
+	if u := RedactURL(bc.URL().String()); b.URL != u {
+		return fmt.Errorf("%v is a copy of %v, not of %v", bc.bootstrap, b.URL, u)
+	}
+	if err = bc.Config.parseConfig(b.Config, b.Format, b.Fragments, b.Sources); err != nil {
+		return err
+	}
+	bc.RawConfig = rawConfig(b.Config, b.Fragments)
+	bc.bootstrapped = true
+	log.Warnf("ButlerConfig::loadBootstrap()[count=%v]: running on the copy of the butler configuration saved at %v in %v, version %v.", handlerCounter, b.Saved.Format(time.RFC3339), bc.bootstrap, b.Version)
+	metrics.SetButlerConfigBootstrapVal(metrics.SUCCESS, bc.Host(), bc.Path())
+	if bc.FirstRun {
+		bc.FirstRun = false
+		bc.readiness.set(&bc.readiness.loaded)
+	}
+	bc.UpdateSchedules()
+	bc.UpdateLogging()
+	return nil
+}
+
+// Bootstrapped returns whether butler runs on the bootstrap copy of the
+// butler configuration, because it has not been able to retrieve it since
+// it started.
+func (bc *ButlerConfig) Bootstrapped() bool {
+	return bc.bootstrapped
+}
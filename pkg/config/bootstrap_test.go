@@ -0,0 +1,75 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestBootstrap(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bbootstrap")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	write := func(interval string) {
+		cfg := strings.Replace(string(TestConfigCompleteEnvironment), "scheduler-interval = 300", "scheduler-interval = "+interval, 1)
+		c.Assert(ioutil.WriteFile(dir+"/butler.toml", []byte("#butlerstart\n"+cfg+"#butlerend\n"), 0644), IsNil)
+	}
+	newConfig := func(path string) *ButlerConfig {
+		u, err := url.Parse("file://" + dir + "/" + path)
+		c.Assert(err, IsNil)
+		bc, err := NewButlerConfig(&ButlerConfigOpts{LogLevel: log.DebugLevel, URL: u, Bootstrap: dir + "/bootstrap.json"})
+		c.Assert(err, IsNil)
+		bc.SetMethodOpts(methods.FileMethodOpts{Scheme: "file"})
+		c.Assert(bc.Init(), IsNil)
+		return bc
+	}
+
+	// nothing to start up on yet
+	bc := newConfig("butler.toml")
+	c.Assert(bc.Handler(), NotNil)
+	c.Assert(bc.Bootstrapped(), Equals, false)
+
+	write("300")
+	c.Assert(bc.Handler(), IsNil)
+	fi, err := os.Stat(dir + "/bootstrap.json")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0600))
+
+	// a restarted butler starts up on the copy while the configuration
+	// cannot be retrieved
+	c.Assert(os.Remove(dir+"/butler.toml"), IsNil)
+	bc = newConfig("butler.toml")
+	c.Assert(bc.Handler(), IsNil)
+	c.Assert(bc.Bootstrapped(), Equals, true)
+	c.Assert(bc.Status().Bootstrapped, Equals, true)
+	c.Assert(bc.GetCMInterval(), Equals, 300)
+
+	// and replaces it once it can
+	write("60")
+	c.Assert(bc.Handler(), IsNil)
+	c.Assert(bc.Bootstrapped(), Equals, false)
+	c.Assert(bc.GetCMInterval(), Equals, 60)
+
+	// the copy of another butler configuration is not used
+	bc = newConfig("other.toml")
+	c.Assert(bc.Handler(), NotNil)
+	c.Assert(bc.Bootstrapped(), Equals, false)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// forceRunKey marks the context of the runs which were asked for through the
+// admin endpoints. They bypass the breaker of the manager, and the canary
+// managers.
+type forceRunKey struct{}
+
+// withForceRun returns a context which bypasses the breaker of the managers,
+// and the canary managers.
+func withForceRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRunKey{}, true)
+}
+
+func isForceRun(ctx context.Context) bool {
+	force, _ := ctx.Value(forceRunKey{}).(bool)
+	return force
+}
+
+// BreakerEnd returns when the breaker of the manager closes, and whether it
+// is open at t. The breaker of a manager opens once its runs have failed
+// breaker-threshold times in a row, after which the manager only runs every
+// breaker-interval seconds until a run succeeds.
+func (bm *Manager) BreakerEnd(t time.Time) (time.Time, bool) {
+	s := GetRunStatus(bm.Name)
+	if s.BreakerOpenUntil == nil {
+		return time.Time{}, false
+	}
+	return *s.BreakerOpenUntil, t.Before(*s.BreakerOpenUntil)
+}
+
+// updateBreaker opens or closes the breaker of the manager after a run, once
+// the run has been recorded.
+func (bc *ButlerConfig) updateBreaker(m *Manager) {
+	runStatusLock.Lock()
+	s := runStatus(m.Name)
+	failures, wasOpen, lastError := s.ConsecutiveFailedRuns, s.BreakerOpenUntil != nil, s.LastError
+	var until time.Time
+	switch {
+	case m.BreakerThreshold > 0 && failures >= m.BreakerThreshold:
+		until = time.Now().Add(time.Duration(m.BreakerInterval) * time.Second)
+		s.BreakerOpenUntil = &until
+	default:
+		s.BreakerOpenUntil = nil
+	}
+	runStatusLock.Unlock()
+
+	metrics.SetButlerFailedRuns(m.Name, failures)
+	if until.IsZero() {
+		metrics.SetButlerBreakerVal(metrics.FAILURE, m.Name)
+		if wasOpen {
+			log.Infof("Config::updateBreaker()[count=%v][manager=%v]: breaker closed.", cmHandlerCounter, m.Name)
+			events.Emit(events.New(events.TypeBreaker, m.Name).WithMessage("breaker closed"))
+		}
+		return
+	}
+	metrics.SetButlerBreakerVal(metrics.SUCCESS, m.Name)
+	if !wasOpen {
+		msg := fmt.Sprintf("breaker opened after %v failed runs, next run at %v", failures, until.Format(time.RFC3339))
+		log.Warnf("Config::updateBreaker()[count=%v][manager=%v]: %v.", cmHandlerCounter, m.Name, msg)
+		events.Emit(events.New(events.TypeBreaker, m.Name).WithMessage(msg).WithError(errors.New(lastError)))
+	} else {
+		log.Warnf("Config::updateBreaker()[count=%v][manager=%v]: %v failed runs, breaker open until %v.", cmHandlerCounter, m.Name, failures, until.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestBreaker(c *C) {
+	m := &Manager{Name: "breaker-manager", BreakerThreshold: 2, BreakerInterval: 60}
+	bc := &ButlerConfig{}
+	defer func() {
+		runStatusLock.Lock()
+		delete(runStatuses, m.Name)
+		runStatusLock.Unlock()
+	}()
+
+	recordRun(m.Name, errors.New("download failed"))
+	bc.updateBreaker(m)
+	_, open := m.BreakerEnd(time.Now())
+	c.Assert(open, Equals, false)
+
+	// the breaker opens on the threshold
+	recordRun(m.Name, errors.New("download failed"))
+	bc.updateBreaker(m)
+	end, open := m.BreakerEnd(time.Now())
+	c.Assert(open, Equals, true)
+	c.Assert(end.After(time.Now().Add(59*time.Second)), Equals, true)
+	_, open = m.BreakerEnd(time.Now().Add(2 * time.Minute))
+	c.Assert(open, Equals, false)
+	c.Assert(GetRunStatus(m.Name).ConsecutiveFailedRuns, Equals, 2)
+
+	// and closes on the next successful run
+	recordRun(m.Name, nil)
+	bc.updateBreaker(m)
+	_, open = m.BreakerEnd(time.Now())
+	c.Assert(open, Equals, false)
+	c.Assert(GetRunStatus(m.Name).ConsecutiveFailedRuns, Equals, 0)
+
+	// a breaker-threshold of 0 never opens it
+	m.BreakerThreshold = 0
+	for i := 0; i < 5; i++ {
+		recordRun(m.Name, errors.New("download failed"))
+		bc.updateBreaker(m)
+	}
+	_, open = m.BreakerEnd(time.Now())
+	c.Assert(open, Equals, false)
+
+	c.Assert(isForceRun(context.Background()), Equals, false)
+	c.Assert(isForceRun(withForceRun(context.Background())), Equals, true)
+}
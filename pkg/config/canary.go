@@ -0,0 +1,115 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// canariesFirst returns the managers, sorted by name, with the canary
+// managers first, so that a run copies the changes of the canaries before it
+// decides whether to hold back those of the other managers.
+func canariesFirst(managers map[string]*Manager) []*Manager {
+	res := make([]*Manager, 0, len(managers))
+	for _, m := range managers {
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Canary != res[j].Canary {
+			return res[i].Canary
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// recordCanaryChange records that the canary manager copied changed files at
+// t, which starts its soak.
+func recordCanaryChange(name string, t time.Time) {
+	runStatusLock.Lock()
+	defer runStatusLock.Unlock()
+	s := runStatus(name)
+	s.CanaryChanged = &t
+	s.CanaryPromoted = false
+}
+
+// CanaryHold returns the canary manager which holds back the changes of the
+// manager at t, along with why, or "" when the manager may copy its files.
+// Once a canary manager has copied changed files, the changes of the managers
+// which are not canaries are held back until the canary has run on them for
+// canary-soak seconds, and then for as long as the canary is unhealthy: its
+// last run or reload failed, its reload is still pending, or it runs on
+// restored files. The changes are promoted to the other managers once the
+// canary has soaked them healthy, and are not held back again until the next
+// change of the canary. It is protected by cmHandlerLock.
+func (bc *ButlerConfig) CanaryHold(m *Manager, t time.Time) (string, string) {
+	if m.Canary {
+		return "", ""
+	}
+	for _, c := range canariesFirst(bc.GetManagers()) {
+		if !c.Canary {
+			break
+		}
+		s := GetRunStatus(c.Name)
+		if s.CanaryChanged == nil || s.CanaryPromoted {
+			continue
+		}
+		if end := s.CanaryChanged.Add(time.Duration(c.CanarySoak) * time.Second); t.Before(end) {
+			return c.Name, fmt.Sprintf("soaks until %v", end.Format(time.RFC3339))
+		}
+		if reason := bc.canaryUnhealthy(c, s); reason != "" {
+			return c.Name, reason
+		}
+		log.Infof("Config::CanaryHold()[count=%v][manager=%v]: canary soaked healthy for %vs, promoting its changes.", cmHandlerCounter, c.Name, c.CanarySoak)
+		runStatusLock.Lock()
+		runStatus(c.Name).CanaryPromoted = true
+		runStatusLock.Unlock()
+	}
+	return "", ""
+}
+
+// canaryUnhealthy returns why the canary manager is unhealthy, or "".
+func (bc *ButlerConfig) canaryUnhealthy(c *Manager, s RunStatus) string {
+	if s.LastError != "" {
+		return "failed its last run"
+	}
+	if s.LastReload != nil && !s.LastReload.Success {
+		return "failed its last reload"
+	}
+	if _, ok := pendingReloads[c.Name]; ok {
+		return "has not reloaded yet"
+	}
+	if r := GetManagerStatusRecord(bc.GetStatusFile(), c.Name); r != nil && r.Status != StatusOK {
+		return fmt.Sprintf("is %v", r.Status)
+	}
+	return ""
+}
+
+// holdForCanary returns whether the changes of the manager are held back by a
+// canary manager, and sets the canary metric of the manager.
+func (bc *ButlerConfig) holdForCanary(m *Manager) bool {
+	canary, reason := bc.CanaryHold(m, time.Now())
+	if canary == "" {
+		metrics.SetButlerCanaryHeldVal(metrics.FAILURE, m.Name)
+		return false
+	}
+	log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: canary manager %v %v, not copying files.", cmHandlerCounter, m.Name, canary, reason)
+	metrics.SetButlerCanaryHeldVal(metrics.SUCCESS, m.Name)
+	return true
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestCanary(c *C) {
+	canary := &Manager{Name: "canary-b", Canary: true, CanarySoak: 60}
+	m := &Manager{Name: "canary-a"}
+	bc := &ButlerConfig{Config: &ConfigSettings{
+		Managers: map[string]*Manager{m.Name: m, canary.Name: canary},
+		Globals:  ConfigGlobals{StatusFile: c.MkDir() + "/butler.status"},
+	}}
+	defer func() {
+		runStatusLock.Lock()
+		delete(runStatuses, canary.Name)
+		runStatusLock.Unlock()
+	}()
+
+	// the canaries are run first
+	c.Assert(canariesFirst(bc.GetManagers()), DeepEquals, []*Manager{canary, m})
+
+	// nothing is held back until the canary has changed
+	now := time.Now()
+	name, _ := bc.CanaryHold(m, now)
+	c.Assert(name, Equals, "")
+
+	recordCanaryChange(canary.Name, now)
+	name, reason := bc.CanaryHold(m, now.Add(time.Second))
+	c.Assert(name, Equals, canary.Name)
+	c.Assert(reason, Matches, "soaks until .*")
+	name, _ = bc.CanaryHold(canary, now.Add(time.Second))
+	c.Assert(name, Equals, "")
+
+	// an unhealthy canary holds the changes back past the soak
+	recordRun(canary.Name, errors.New("download failed"))
+	name, reason = bc.CanaryHold(m, now.Add(2*time.Minute))
+	c.Assert(name, Equals, canary.Name)
+	c.Assert(reason, Equals, "failed its last run")
+
+	// a healthy one promotes them, for good
+	recordRun(canary.Name, nil)
+	name, _ = bc.CanaryHold(m, now.Add(2*time.Minute))
+	c.Assert(name, Equals, "")
+	c.Assert(GetRunStatus(canary.Name).CanaryPromoted, Equals, true)
+	recordRun(canary.Name, errors.New("download failed"))
+	name, _ = bc.CanaryHold(m, now.Add(3*time.Minute))
+	c.Assert(name, Equals, "")
+
+	// until the next change of the canary
+	recordCanaryChange(canary.Name, now.Add(3*time.Minute))
+	name, _ = bc.CanaryHold(m, now.Add(3*time.Minute))
+	c.Assert(name, Equals, canary.Name)
+}
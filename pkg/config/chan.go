@@ -0,0 +1,420 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// errRenderFile and errValidateFile are the failures of files which were
+	// retrieved from the repository, but are not fit to be copied.
+	errRenderFile   = errors.New("could not render file")
+	errValidateFile = errors.New("could not validate file")
+
+	// errFileNotFound is the failure of files which the repository does not
+	// have.
+	errFileNotFound = errors.New("file not found")
+)
+
+// ChanEvent is the interface which gets passed along to the different
+// retrieval mechanisms which ultimately keeps track of which files
+// have been downlaoded, changed, etc.
+type ChanEvent interface {
+	CanCopyFiles() bool
+	Invalid() bool
+	Fetched() bool
+	CleanTmpFiles() error
+	GetTmpFileMap() []TmpFile
+	SetSuccess(string, string, error) error
+	SetTmpFile(string, string, string) error
+	SetBinary(string, string) error
+	MergePrimaryConfigFiles(map[string]*ManagerOpts) error
+	GetMergedConfigFile() string
+	CopyPrimaryConfigFiles(map[string]*ManagerOpts) bool
+	CopyAdditionalConfigFiles(string) bool
+	DiffPrimaryConfigFiles(map[string]*ManagerOpts) (*FileDiff, error)
+	DiffAdditionalConfigFiles(string) ([]FileDiff, error)
+	GetChangeCounts() (int, int)
+	GetChangedFiles() []string
+}
+
+// ConfigChanEvent is the object passed around in the channel which contains
+// information on whether the file has changed, the path to the tempfile,
+// the config name, and repository event information
+type ConfigChanEvent struct {
+	HasChanged bool
+	TmpFile    *os.File
+	ConfigFile *string
+	Manager    string
+	Repo       map[string]*RepoFileEvent
+	Install    InstallOpts
+	Diffs      *DiffStore
+	merged     bool
+	added      int
+	changed    int
+	files      []string
+}
+
+// CanCopyFiles returns a boolean which tells whether or not butler is able to
+// copy the files from the repository to the local filesystem. The assumption
+// is that ALL files have to pass before butler attempts to copy over.
+func (c *ConfigChanEvent) CanCopyFiles() bool {
+	var (
+		res bool
+	)
+	res = true
+
+	log.Debugf("ConfigChanEvent::CanCopyFiles(): seeing if we can copy files")
+	for _, r := range c.Repo {
+		for _, v := range r.Success {
+			if v == false {
+				res = false
+			}
+		}
+	}
+	log.Debugf("ConfigChanEvent::CanCopyFiles(): returning %v", res)
+	return res
+}
+
+// Invalid returns whether any of the files which butler is not able to copy
+// was retrieved from the repository, but could not be rendered or validated.
+func (c *ConfigChanEvent) Invalid() bool {
+	for _, r := range c.Repo {
+		for f, v := range r.Success {
+			if !v && (r.Error[f] == errRenderFile || r.Error[f] == errValidateFile) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fetched returns whether all of the files were retrieved from the
+// repository, whether or not they could be rendered and validated.
+func (c *ConfigChanEvent) Fetched() bool {
+	for _, r := range c.Repo {
+		for f, v := range r.Success {
+			if !v && r.Error[f] != errRenderFile && r.Error[f] != errValidateFile {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CleanTmpFiles returns an error, or not, depending on whether butler was able
+// to delete all the tempfiles that were created during the config file
+// retrieval from the remote repository
+func (c *ConfigChanEvent) CleanTmpFiles() error {
+	log.Debugf("ConfigChanEvent::CleanTmpFiles(): cleaning up temporary files")
+	for _, r := range c.Repo {
+		for _, f := range r.TmpFile {
+			log.Debugf("ConfigChanEvent::CleanTmpFiles(): removing file %#v", f)
+			removeTempFile(f)
+		}
+	}
+
+	if c.TmpFile != nil {
+		removeTempFile(c.TmpFile.Name())
+	}
+	return nil
+}
+
+// GetTmpFileMap returns a slice of SORTED TmpFile objects which contain the
+// names of all the temp files creted during the config file retrieval from the
+// remote repository.
+func (c *ConfigChanEvent) GetTmpFileMap() []TmpFile {
+	var (
+		keys   []string
+		res    []TmpFile
+		tmpRes map[string]string
+		binRes map[string]bool
+	)
+	tmpRes = make(map[string]string)
+	binRes = make(map[string]bool)
+
+	for _, r := range c.Repo {
+		for k, v := range r.TmpFile {
+			keys = append(keys, k)
+			tmpRes[k] = v
+			binRes[k] = r.Binary[k]
+		}
+	}
+
+	// Due to the way that golang handles the ordering of maps (random), we have to
+	// enforce a sorted ordering, otherwise we may write config files differently,
+	// but with the same data (eg: the merged primary config file), causing an undesired
+	// configuration reload
+	sort.Strings(keys)
+	for _, v := range keys {
+		res = append(res, TmpFile{Name: v, File: tmpRes[v], Binary: binRes[v]})
+	}
+	log.Debugf("ConfigChanEvent::GetTmpFileMap(): res=%#v", res)
+	return res
+}
+
+// SetSuccess sets the value for the file argument in the repo argument to true
+func (c *ConfigChanEvent) SetSuccess(repo string, file string, err error) error {
+	// If c.Repo has not been initialized, do so.
+	if c.Repo == nil {
+		c.Repo = make(map[string]*RepoFileEvent)
+	}
+	if _, ok := c.Repo[repo]; !ok {
+		rfe := &RepoFileEvent{}
+		rfe.Success = make(map[string]bool)
+		rfe.Error = make(map[string]error)
+		rfe.TmpFile = make(map[string]string)
+		c.Repo[repo] = rfe
+	}
+	c.Repo[repo].SetSuccess(file, err)
+	return nil
+}
+
+// SetFailure sets the value for the file argument in the repo argument to false
+func (c *ConfigChanEvent) SetFailure(repo string, file string, err error) error {
+	// If c.Repo has not been initialized, do so.
+	if c.Repo == nil {
+		c.Repo = make(map[string]*RepoFileEvent)
+	}
+	if _, ok := c.Repo[repo]; !ok {
+		rfe := &RepoFileEvent{}
+		rfe.Success = make(map[string]bool)
+		rfe.Error = make(map[string]error)
+		rfe.TmpFile = make(map[string]string)
+		c.Repo[repo] = rfe
+	}
+	c.Repo[repo].SetFailure(file, err)
+	return nil
+}
+
+func (c *ConfigChanEvent) SetTmpFile(repo string, file string, tmpfile string) error {
+	if _, ok := c.Repo[repo]; ok {
+		c.Repo[repo].SetTmpFile(file, tmpfile)
+	}
+	return nil
+}
+
+// SetBinary marks the file in the repo argument as binary. Binary files are
+// copied as is, and only compared by size and checksum.
+func (c *ConfigChanEvent) SetBinary(repo string, file string) error {
+	if _, ok := c.Repo[repo]; ok {
+		c.Repo[repo].SetBinary(file)
+	}
+	return nil
+}
+
+// MergePrimaryConfigFiles merges all of the downloaded primary config files,
+// in order, into the ConfigChanEvent temporary file. The merged file is what
+// gets validated and then compared against the file on the filesystem.
+func (c *ConfigChanEvent) MergePrimaryConfigFiles(opts map[string]*ManagerOpts) error {
+	var (
+		primaryConfigs []string
+	)
+
+	// need to get a list of the primary config files, in order from first to last, through each repo
+	for _, opt := range opts {
+		for _, config := range opt.PrimaryConfig {
+			primaryConfigs = append(primaryConfigs, config)
+		}
+	}
+
+	out, err := os.OpenFile(c.TmpFile.Name(), os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Infof("ConfigChanEvent::MergePrimaryConfigFiles(): Could not process and merge new %v err=%s.", c.ConfigFile, err.Error())
+		metrics.SetButlerConfigVal(metrics.FAILURE, "local", metrics.GetStatsLabel(*c.ConfigFile))
+		return err
+	}
+	defer out.Close()
+
+	// we need to go through each fo the primary config files in order, and then find the corresponding tmpMap entry
+	for _, f := range primaryConfigs {
+		for _, t := range c.GetTmpFileMap() {
+			if t.Name == f {
+				in, err := os.Open(t.File)
+				if err != nil {
+					log.Infof("ConfigChanEvent::MergePrimaryConfigFiles(): Could not process and merge new %v err=%s.", c.ConfigFile, err.Error())
+					metrics.SetButlerConfigVal(metrics.FAILURE, "local", metrics.GetStatsLabel(t.Name))
+					return err
+				}
+				_, err = io.Copy(out, in)
+				in.Close()
+				if err != nil {
+					log.Infof("ConfigChanEvent::MergePrimaryConfigFiles(): Could not process and merge new %v err=%s.", c.ConfigFile, err.Error())
+					metrics.SetButlerConfigVal(metrics.FAILURE, "local", metrics.GetStatsLabel(t.Name))
+					return err
+				}
+				break
+			}
+		}
+	}
+	out.Sync()
+	c.merged = true
+	return nil
+}
+
+// GetMergedConfigFile returns the path to the merged primary config file.
+func (c *ConfigChanEvent) GetMergedConfigFile() string {
+	if c.TmpFile == nil {
+		return ""
+	}
+	return c.TmpFile.Name()
+}
+
+func (c *ConfigChanEvent) CopyPrimaryConfigFiles(opts map[string]*ManagerOpts) bool {
+	// a manager which only has file groups has no primary config file
+	if !hasPrimaryConfig(opts) {
+		return false
+	}
+	// The primary config files may have already been merged for validation.
+	if !c.merged {
+		if err := c.MergePrimaryConfigFiles(opts); err != nil {
+			c.CleanTmpFiles()
+			return false
+		}
+	}
+	_, statErr := os.Stat(*c.ConfigFile)
+	old, _ := ioutil.ReadFile(*c.ConfigFile)
+	if !CompareAndCopy(c.TmpFile.Name(), *c.ConfigFile, c.Manager, c.Install.ForFile(filepath.Base(*c.ConfigFile))) {
+		return false
+	}
+	c.countChange(*c.ConfigFile, statErr == nil)
+	c.recordCopy(filepath.Base(*c.ConfigFile), *c.ConfigFile, old, false)
+	return true
+}
+
+// DiffPrimaryConfigFiles returns the diff between the merged primary config
+// file and the file on the filesystem, without copying it. It returns nil if
+// the files are the same.
+func (c *ConfigChanEvent) DiffPrimaryConfigFiles(opts map[string]*ManagerOpts) (*FileDiff, error) {
+	if !hasPrimaryConfig(opts) {
+		return nil, nil
+	}
+	if !c.merged {
+		if err := c.MergePrimaryConfigFiles(opts); err != nil {
+			return nil, err
+		}
+	}
+	new, err := stripButlerHeaderFooter(c.TmpFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	old, _ := ioutil.ReadFile(*c.ConfigFile)
+	return c.Diffs.Diff(filepath.Base(*c.ConfigFile), old, new, false), nil
+}
+
+// recordCopy records the diff between the old contents and the freshly
+// copied dest file in the manager diff store, and emits the copy event.
+func (c *ConfigChanEvent) recordCopy(name string, dest string, old []byte, binary bool) {
+	e := events.New(events.TypeCopy, c.Manager).WithFile(dest)
+	if c.Diffs != nil {
+		new, err := ioutil.ReadFile(dest)
+		if err != nil {
+			log.Warnf("ConfigChanEvent::recordCopy()[manager=%v]: could not read %v for diff. err=%v", c.Manager, dest, err.Error())
+		} else if d := c.Diffs.Record(name, old, new, binary); d != nil {
+			e = e.WithHash(d.Hash)
+		}
+	}
+	events.Emit(e)
+}
+
+func (c *ConfigChanEvent) countChange(dest string, existed bool) {
+	c.files = append(c.files, dest)
+	if existed {
+		c.changed++
+	} else {
+		c.added++
+	}
+}
+
+// GetChangeCounts returns the number of files which were added and changed
+// by the last copy.
+func (c *ConfigChanEvent) GetChangeCounts() (int, int) {
+	return c.added, c.changed
+}
+
+// GetChangedFiles returns the dest paths of the files which were added or
+// changed by the last copy.
+func (c *ConfigChanEvent) GetChangedFiles() []string {
+	return c.files
+}
+
+// DiffAdditionalConfigFiles returns the diffs between the downloaded
+// additional config files and the files in destDir, without copying them.
+func (c *ConfigChanEvent) DiffAdditionalConfigFiles(destDir string) ([]FileDiff, error) {
+	var (
+		res []FileDiff
+	)
+	for _, f := range c.GetTmpFileMap() {
+		var (
+			new []byte
+			err error
+		)
+		if f.Binary {
+			new, err = ioutil.ReadFile(f.File)
+		} else {
+			new, err = stripButlerHeaderFooter(f.File)
+		}
+		if err != nil {
+			return nil, err
+		}
+		old, _ := ioutil.ReadFile(filepath.Join(destDir, f.Name))
+		if d := c.Diffs.Diff(f.Name, old, new, f.Binary); d != nil {
+			res = append(res, *d)
+		}
+	}
+	return res, nil
+}
+
+func (c *ConfigChanEvent) CopyAdditionalConfigFiles(destDir string) bool {
+	var (
+		IsModified bool
+	)
+	log.Debugf("Manager::CopyAdditionalConfigFiles(): entering")
+	IsModified = false
+
+	for _, f := range c.GetTmpFileMap() {
+		destFile := filepath.Join(destDir, f.Name)
+		_, statErr := os.Stat(destFile)
+		if statErr != nil {
+			// files found in a sync-dir may live in directories which do not
+			// exist locally yet
+			if err := os.MkdirAll(filepath.Dir(destFile), 0755); err != nil {
+				log.Errorf("Manager::CopyAdditionalConfigFiles(): could not create directory for %v. err=%v", destFile, err.Error())
+			}
+		}
+		var copied bool
+		old, _ := ioutil.ReadFile(destFile)
+		if f.Binary {
+			copied = CompareAndCopyBinary(f.File, destFile, c.Manager, c.Install.ForFile(f.Name))
+		} else {
+			copied = CompareAndCopy(f.File, destFile, c.Manager, c.Install.ForFile(f.Name))
+		}
+		if copied {
+			c.countChange(destFile, statErr == nil)
+			c.recordCopy(f.Name, destFile, old, f.Binary)
+			IsModified = true
+		}
+	}
+	return IsModified
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestChanFetched(c *C) {
+	ev := NewConfigChanEvent()
+	c.Assert(ev.Fetched(), Equals, true)
+	ev.SetSuccess("repo", "a.yml", nil)
+	c.Assert(ev.Fetched(), Equals, true)
+
+	// files which were retrieved, but did not render or validate
+	ev.SetFailure("repo", "b.yml", errValidateFile)
+	ev.SetFailure("other", "c.yml", errRenderFile)
+	c.Assert(ev.Fetched(), Equals, true)
+	c.Assert(ev.CanCopyFiles(), Equals, false)
+	c.Assert(ev.Invalid(), Equals, true)
+
+	ev.SetFailure("repo", "d.yml", errors.New("could not download file"))
+	c.Assert(ev.Fetched(), Equals, false)
+}
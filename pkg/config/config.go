@@ -0,0 +1,612 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/logging"
+	"github.com/adobe/butler/internal/redact"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/pkg/methods"
+
+	"github.com/hashicorp/go-retryablehttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	ConfigSchedulerInterval   = 300
+	DefaultMaxRollbacks       = 3
+	DefaultReloadRetryWaitMin = 1
+	DefaultReloadRetryWaitMax = 30
+	DefaultBreakerInterval    = 600
+	DefaultCanarySoak         = 600
+	DefaultHookTimeout        = 30
+	DefaultLogFileMaxSize     = 100
+	DefaultLogFileMaxBackups  = 5
+	DefaultDownloadCachePath  = filepath.Join(stateDir, "butler.downloads")
+	DefaultReportInterval     = 300
+	DefaultSchedulerStall     = 3600
+	ValidSchemes              = []string{"blob", "file", "http", "https", "s3", "S3", "etcd"}
+	ValidContentTypes         = []string{"auto", "text", "json", "yaml", "toml", "hcl", "ini", "xml", "binary"}
+)
+
+// butlerHeader and butlerFooter represent the strings that need to be matched
+// against in the configuration files. If these entries do not exist in the
+// downloaded file, then we cannot be assured that these files are legitimate
+// configurations.
+const (
+	butlerHeader = "#butlerstart"
+	butlerFooter = "#butlerend"
+)
+
+type ButlerConfigOpts struct {
+	InsecureSkipVerify bool
+	LogLevel           log.Level
+	URL                *url.URL
+	// Defaults is the path of local defaults which the butler
+	// configuration overlays, see overlayConfig.
+	Defaults string
+	// Strict parses the butler configuration strictly, see
+	// ConfigSettings.Strict.
+	Strict bool
+	// Bootstrap is the path of the copy of the last butler configuration
+	// which was parsed, which butler starts up on when it cannot retrieve
+	// the butler configuration. Nothing is kept when it is empty.
+	Bootstrap string
+	// MethodOptions is the path of a local file of the options of the method
+	// which retrieves the butler configuration, which are used instead of
+	// the MethodOpts when it is set, see newConfigMethod.
+	MethodOptions string
+}
+
+type ConfigClient struct {
+	Scheme     string
+	Method     methods.Method
+	HTTPClient *retryablehttp.Client
+}
+
+func (c *ConfigClient) SetTimeout(val int) {
+	switch c.Scheme {
+	case "http", "https":
+		log.Debugf("ConfigClient::SetTimeout(): setting timeout to %v", val)
+		c.HTTPClient.HTTPClient.Timeout = time.Duration(val) * time.Second
+	}
+}
+
+func (c *ConfigClient) SetRetryMax(val int) {
+	switch c.Scheme {
+	case "http", "https":
+		log.Debugf("ConfigClient::SetRetryMax(): setting retry max to %v", val)
+		c.HTTPClient.RetryMax = val
+	}
+}
+
+func (c *ConfigClient) SetRetryWaitMin(val int) {
+	switch c.Scheme {
+	case "http", "https":
+		c.HTTPClient.RetryWaitMin = time.Duration(val) * time.Second
+	}
+}
+
+func (c *ConfigClient) SetRetryWaitMax(val int) {
+	switch c.Scheme {
+	case "http", "https":
+		c.HTTPClient.RetryWaitMax = time.Duration(val) * time.Second
+	}
+}
+
+func (c *ConfigClient) Get(val *url.URL) (*methods.Response, error) {
+	var (
+		response *methods.Response
+		err      error
+	)
+	if IsValidScheme(val.Scheme) {
+		response, err = c.Method.Get(val)
+	} else {
+		response = &methods.Response{}
+		err = errors.New("unsupported scheme")
+	}
+	return response, err
+}
+
+// CheckConfig validates a butler configuration offline, eg: before it is
+// deployed. It is parsed like a retrieved butler configuration, but the
+// event sinks and notifiers of butler are left alone, and an invalid
+// configuration never exits, whatever its globals.exit-on-config-failure.
+// The name of the configuration tells its format, see ConfigFormat. The
+// configuration overlays the defaults at the path, unless it is empty, and
+// is parsed strictly when strict is set, see ConfigSettings.Strict.
+func CheckConfig(name string, config []byte, defaults string, strict bool) error {
+	err := ValidateConfig(NewValidateOpts().WithData(config).WithFileName(name).WithManager("butler-config"))
+	if err != nil {
+		return err
+	}
+	sources := []configFragment{{Name: name, Data: config}}
+	d, err := readDefaults(defaults)
+	if err != nil {
+		return err
+	}
+	if d != nil {
+		sources = append(sources, *d)
+	}
+	config, format, err := overlayConfig(d, config, ConfigFormat(name, config))
+	if err != nil {
+		return err
+	}
+	fragments, err := includeFragments(config, format, filepath.Dir(name), nil)
+	if err != nil {
+		return err
+	}
+	c := &ConfigSettings{Strict: strict, check: true}
+	return c.parseConfig(config, format, fragments, sources)
+}
+
+// ParseConfig parses a butler configuration whose format is told by its
+// content.
+func (c *ConfigSettings) ParseConfig(config []byte) error {
+	return c.ParseConfigFormat(config, ConfigFormat("", config))
+}
+
+// ParseConfigFormat parses a butler configuration in the format, one of
+// ConfigFormats.
+func (c *ConfigSettings) ParseConfigFormat(config []byte, format string) error {
+	return c.parseConfig(config, format, nil, nil)
+}
+
+// parseConfig parses a butler configuration in the format, along with the
+// fragments it includes. The sources are the documents the configuration has
+// been put together from, eg: the retrieved butler configuration and its
+// defaults, which tell where the problems found by the strict parsing are.
+// Without sources, they are looked for in the configuration itself.
+func (c *ConfigSettings) parseConfig(config []byte, format string, fragments []configFragment, sources []configFragment) error {
+	var (
+		Config  ConfigSettings
+		Globals ConfigGlobals
+		path    string
+	)
+	log.Debugf("ConfigSettings::ParseConfig(): entering. format=%v", format)
+	if !isValidConfigFormat(format) {
+		return fmt.Errorf("unknown butler configuration format %v", format)
+	}
+	viper.SetConfigType(format)
+
+	// We grab the config from a remote repo so it's in []byte format. let's see
+	// if we can process it. The butler header and footer are not valid JSON.
+	err := viper.ReadConfig(bytes.NewBuffer(stripConfigHeaderFooter(config)))
+	if err != nil {
+		log.Debugf("ConfigSettings::ParseConfig(): could not parse config. err=%v", err)
+		return err
+	}
+
+	Config = ConfigSettings{}
+
+	// Let's start piecing together the globals
+	err = viper.UnmarshalKey("globals", &Globals)
+	if err != nil {
+		if c.check {
+			return fmt.Errorf("unable to decode globals. err=%v", err.Error())
+		}
+		log.Fatalf("Unable to decode into struct, %v", err)
+	}
+	Config.Globals = Globals
+
+	// Let's grab some of the global settings
+	envExitOnFailure := strings.ToLower(environment.GetVar(Config.Globals.CfgExitOnFailure))
+	if envExitOnFailure == "true" {
+		Config.Globals.ExitOnFailure = true
+	} else if envExitOnFailure == "false" {
+		Config.Globals.ExitOnFailure = false
+	} else {
+		Config.Globals.ExitOnFailure = false
+	}
+	if c.check {
+		Config.Globals.ExitOnFailure = false
+	}
+
+	// The managers of the included fragments are added to those of the
+	// butler configuration.
+	included, err := mergeFragments(fragments)
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): %v. exiting...", err.Error())
+		}
+		return err
+	}
+	Config.Globals.Managers = appendManagers(Config.Globals.Managers, included...)
+
+	if c.Strict {
+		if len(sources) == 0 {
+			sources = []configFragment{{Data: config}}
+		}
+		err = checkStrict(viper.AllSettings(), Config.Globals.Managers, append(append([]configFragment{}, sources...), fragments...))
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): %v. exiting...", err.Error())
+			}
+			return err
+		}
+	}
+
+	// The instance metadata is set up first, so that the meta: variables
+	// can be used by every other option.
+	Config.Globals.InstanceMetadata = strings.ToLower(strings.TrimSpace(environment.GetVar(Config.Globals.CfgInstanceMetadata)))
+	if err := setInstanceMetadata(Config.Globals.InstanceMetadata, c.check); err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.instance-metadata. err=%v exiting...", err.Error())
+		}
+		return fmt.Errorf("invalid globals.instance-metadata. err=%v", err.Error())
+	}
+
+	envSchedulerInterval, _ := strconv.Atoi(environment.GetVar(Config.Globals.CfgSchedulerInterval))
+	if envSchedulerInterval == 0 {
+		log.Warnf("ConfigSettings::ParseConfig() could not convert %v to integer for scheduler-interval, defaulting to 0. This is probably undesired.", Config.Globals.CfgSchedulerInterval)
+		Config.Globals.SchedulerInterval = ConfigSchedulerInterval
+	} else {
+		Config.Globals.SchedulerInterval = envSchedulerInterval
+	}
+
+	Config.Globals.SchedulerCron = strings.TrimSpace(environment.GetVar(Config.Globals.CfgSchedulerCron))
+	if Config.Globals.SchedulerCron != "" {
+		Config.Globals.Schedule, err = scheduler.Parse(Config.Globals.SchedulerCron)
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.scheduler-cron. err=%v exiting...", err.Error())
+			}
+			return fmt.Errorf("invalid globals.scheduler-cron. err=%v", err.Error())
+		}
+	} else {
+		Config.Globals.Schedule = scheduler.Every(time.Duration(Config.Globals.SchedulerInterval) * time.Second)
+	}
+	Config.Globals.SchedulerSplay, err = parseNonNegativeInt(Config.Globals.CfgSchedulerSplay)
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.scheduler-splay %v. exiting...", Config.Globals.CfgSchedulerSplay)
+		}
+		return fmt.Errorf("invalid globals.scheduler-splay %v", Config.Globals.CfgSchedulerSplay)
+	}
+	Config.Globals.Schedule = scheduler.WithSplay(Config.Globals.Schedule, time.Duration(Config.Globals.SchedulerSplay)*time.Second)
+
+	Config.Globals.SchedulerStall = DefaultSchedulerStall
+	if strings.TrimSpace(Config.Globals.CfgSchedulerStall) != "" {
+		Config.Globals.SchedulerStall, err = parseNonNegativeInt(Config.Globals.CfgSchedulerStall)
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.scheduler-stall-timeout %v. exiting...", Config.Globals.CfgSchedulerStall)
+			}
+			return fmt.Errorf("invalid globals.scheduler-stall-timeout %v", Config.Globals.CfgSchedulerStall)
+		}
+	}
+
+	Config.Globals.ParallelManagers = 1
+	if strings.TrimSpace(Config.Globals.CfgParallelManagers) != "" {
+		Config.Globals.ParallelManagers, err = parseNonNegativeInt(Config.Globals.CfgParallelManagers)
+		if err != nil || Config.Globals.ParallelManagers == 0 {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.parallel-managers %v. exiting...", Config.Globals.CfgParallelManagers)
+			}
+			return fmt.Errorf("invalid globals.parallel-managers %v", Config.Globals.CfgParallelManagers)
+		}
+	}
+
+	Config.Globals.StatusFile = environment.GetVar(Config.Globals.CfgStatusFile)
+	if Config.Globals.StatusFile == "" {
+		Config.Globals.StatusFile = filepath.Join(stateDir, "butler.status")
+	}
+
+	Config.Globals.FailurePolicy = strings.ToLower(environment.GetVar(Config.Globals.CfgFailurePolicy))
+	if Config.Globals.FailurePolicy == "" {
+		Config.Globals.FailurePolicy = DefaultFailurePolicy
+	}
+	if !IsValidFailurePolicy(Config.Globals.FailurePolicy) {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.failure-policy %v. exiting...", Config.Globals.CfgFailurePolicy)
+		}
+		return fmt.Errorf("invalid globals.failure-policy %v", Config.Globals.CfgFailurePolicy)
+	}
+
+	Config.Globals.DownloadCachePath = environment.GetVar(Config.Globals.CfgDownloadCachePath)
+	if Config.Globals.DownloadCachePath == "" {
+		Config.Globals.DownloadCachePath = DefaultDownloadCachePath
+	}
+
+	Config.Globals.ResponseCacheTTL, err = parseNonNegativeInt(Config.Globals.CfgResponseCacheTTL)
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.response-cache-ttl %v. exiting...", Config.Globals.CfgResponseCacheTTL)
+		}
+		return fmt.Errorf("invalid globals.response-cache-ttl %v", Config.Globals.CfgResponseCacheTTL)
+	}
+
+	envEnableHTTPLog := strings.ToLower(environment.GetVar(Config.Globals.CfgEnableHTTPLog))
+	if envEnableHTTPLog == "true" {
+		Config.Globals.EnableHTTPLog = true
+		// enable http logging
+	} else if envEnableHTTPLog == "false" {
+		Config.Globals.EnableHTTPLog = false
+		// disable http logging
+	} else {
+		Config.Globals.EnableHTTPLog = true
+		// enable http logging
+	}
+
+	// Let's determine the http proto and the port
+	envHTTPPort, _ := strconv.Atoi(environment.GetVar(Config.Globals.CfgHTTPPort))
+	if envHTTPPort == 0 {
+		Config.Globals.HTTPPort = 8080
+	} else {
+		Config.Globals.HTTPPort = envHTTPPort
+	}
+
+	Config.Globals.HTTPProto = strings.ToLower(environment.GetVar(Config.Globals.CfgHTTPProto))
+	if (Config.Globals.HTTPProto != "http") && (Config.Globals.HTTPProto != "https") {
+		Config.Globals.HTTPProto = "http"
+	}
+
+	if Config.Globals.HTTPProto == "https" {
+		Config.Globals.HTTPTLSCert = environment.GetVar(Config.Globals.CfgHTTPTLSCert)
+		Config.Globals.HTTPTLSKey = environment.GetVar(Config.Globals.CfgHTTPTLSKey)
+		if (Config.Globals.HTTPTLSCert == "") || (Config.Globals.HTTPTLSKey == "") {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSetings::ParseConfig(): globlals.http-proto set to \"https\" but no cert and/or key defined! exiting...")
+			} else {
+				log.Debugf("ConfigSetings::ParseConfig(): globlals.http-proto set to \"https\" but no cert and/or key defined")
+				return errors.New("globals.http-proto set to https but no tls options defined.")
+			}
+		}
+	}
+
+	Config.Globals.WebhookSecret = environment.GetVar(Config.Globals.CfgWebhookSecret)
+
+	Config.Globals.AuditLog = strings.TrimSpace(environment.GetVar(Config.Globals.CfgAuditLog))
+	Config.Globals.AuditURL = strings.TrimSpace(environment.GetVar(Config.Globals.CfgAuditURL))
+	if Config.Globals.AuditURL != "" {
+		u, err := url.Parse(Config.Globals.AuditURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.audit-url %v. exiting...", Config.Globals.AuditURL)
+			}
+			return fmt.Errorf("invalid globals.audit-url %v", Config.Globals.AuditURL)
+		}
+	}
+
+	Config.Globals.ReportURL = strings.TrimSpace(environment.GetVar(Config.Globals.CfgReportURL))
+	if Config.Globals.ReportURL != "" {
+		if err := parseReportOpts(&Config.Globals); err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): %v. exiting...", err.Error())
+			}
+			return err
+		}
+	}
+
+	Config.Globals.LogFormat = strings.ToLower(strings.TrimSpace(environment.GetVar(Config.Globals.CfgLogFormat)))
+	if Config.Globals.LogFormat != "" && Config.Globals.LogFormat != logging.FormatText && Config.Globals.LogFormat != logging.FormatJSON {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-format %v. exiting...", Config.Globals.LogFormat)
+		}
+		return fmt.Errorf("invalid globals.log-format %v, it must be %v or %v", Config.Globals.LogFormat, logging.FormatText, logging.FormatJSON)
+	}
+	cfgLevels := make(map[string]string)
+	for k, v := range Config.Globals.CfgLogLevels {
+		cfgLevels[k] = environment.GetVar(v)
+	}
+	levels, err := logging.ParseLevels(cfgLevels)
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-levels. err=%v exiting...", err.Error())
+		}
+		return fmt.Errorf("invalid globals.log-levels. err=%v", err.Error())
+	}
+	Config.Globals.LogLevels = make(map[string]string)
+	for k, v := range levels {
+		Config.Globals.LogLevels[k] = v.String()
+	}
+
+	Config.Globals.LogFile = strings.TrimSpace(environment.GetVar(Config.Globals.CfgLogFile))
+	Config.Globals.LogFileMaxSize = DefaultLogFileMaxSize
+	if strings.TrimSpace(environment.GetVar(Config.Globals.CfgLogFileMaxSize)) != "" {
+		Config.Globals.LogFileMaxSize, err = parseNonNegativeInt(Config.Globals.CfgLogFileMaxSize)
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-file-max-size %v. exiting...", Config.Globals.CfgLogFileMaxSize)
+			}
+			return fmt.Errorf("invalid globals.log-file-max-size %v", Config.Globals.CfgLogFileMaxSize)
+		}
+	}
+	Config.Globals.LogFileMaxAge, err = parseNonNegativeInt(Config.Globals.CfgLogFileMaxAge)
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-file-max-age %v. exiting...", Config.Globals.CfgLogFileMaxAge)
+		}
+		return fmt.Errorf("invalid globals.log-file-max-age %v", Config.Globals.CfgLogFileMaxAge)
+	}
+	Config.Globals.LogFileMaxBackups = DefaultLogFileMaxBackups
+	if strings.TrimSpace(environment.GetVar(Config.Globals.CfgLogFileMaxBackups)) != "" {
+		Config.Globals.LogFileMaxBackups, err = parseNonNegativeInt(Config.Globals.CfgLogFileMaxBackups)
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-file-max-backups %v. exiting...", Config.Globals.CfgLogFileMaxBackups)
+			}
+			return fmt.Errorf("invalid globals.log-file-max-backups %v", Config.Globals.CfgLogFileMaxBackups)
+		}
+	}
+	Config.Globals.LogSyslog = strings.TrimSpace(environment.GetVar(Config.Globals.CfgLogSyslog))
+	if Config.Globals.LogSyslog != "" {
+		if err := logging.CheckSyslog(Config.Globals.LogSyslog); err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.log-syslog. err=%v exiting...", err.Error())
+			}
+			return fmt.Errorf("invalid globals.log-syslog. err=%v", err.Error())
+		}
+	}
+
+	if _, err := redact.Compile(Config.Globals.Redact); err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid globals.redact. err=%v exiting...", err.Error())
+		}
+		return fmt.Errorf("invalid globals.redact. err=%v", err.Error())
+	}
+
+	// If there are no entries for config-managers, then the Unmarshal will create an empty array
+	if len(Config.Globals.Managers) < 1 {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): globals.config-managers has no entries! exiting...")
+		} else {
+			log.Debugf("ConfigSettings::ParseConfig(): globals.config-managers has no entries!")
+			return errors.New("globals.config-managers has no entries. Nothing to do")
+		}
+	}
+
+	Config.Managers = make(map[string]*Manager)
+	// Now let's start processing the managers. This is going
+	for _, entry := range Config.Globals.Managers {
+		log.Debugf("ConfigSettings::ParseConfig(): checking config entry=%s", entry)
+		if !viper.IsSet(entry) {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): %v is not in the configuration as a manager! exiting...", entry)
+			} else {
+				log.Debugf("ConfigSettings::ParseConfig(): %v is not in the configuration as a manager", entry)
+				msg := fmt.Sprintf("Cannot find manager for %s", entry)
+				return errors.New(msg)
+			}
+		} else {
+			err = GetConfigManager(entry, &Config)
+			if err != nil {
+				if Config.Globals.ExitOnFailure {
+					log.Fatalf("ConfigSettings::ParseConfig(): could not retrieve config options for %v. err=%v", entry, err.Error())
+				} else {
+					log.Debugf("ConfigSettings::ParseConfig(): could not retrieve config options for %v. err=%v", entry, err.Error())
+					msg := fmt.Sprintf("could not retrieve config options for %v. err=%v", entry, err.Error())
+					return errors.New(msg)
+				}
+			}
+		}
+	}
+
+	// The managers whose host-selector does not match this host are left
+	// out, as are the dependencies on them.
+	if !c.check {
+		if err := selectManagers(Config.Managers, newHostLabels()); err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): could not match the host-selector of the managers. err=%v", err.Error())
+			}
+			return fmt.Errorf("could not match the host-selector of the managers. err=%v", err.Error())
+		}
+	}
+
+	if err := checkDependencies(Config.Managers); err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): invalid depends-on. err=%v", err.Error())
+		}
+		return fmt.Errorf("invalid depends-on. err=%v", err.Error())
+	}
+
+	// The event sinks are only replaced when their settings change, so that
+	// the audit log is not reopened on every butler config change.
+	if !c.check && (Config.Globals.AuditLog != c.Globals.AuditLog || Config.Globals.AuditURL != c.Globals.AuditURL) {
+		sinks, err := Config.Globals.EventSinks()
+		if err != nil {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ConfigSettings::ParseConfig(): could not set up event sinks. err=%v", err.Error())
+			}
+			return fmt.Errorf("could not set up event sinks. err=%v", err.Error())
+		}
+		events.SetSinks(sinks...)
+	}
+
+	notifiers, err := events.NewNotifiers()
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): could not set up notifiers. err=%v", err.Error())
+		}
+		return fmt.Errorf("could not set up notifiers. err=%v", err.Error())
+	}
+	e, settings, err := newElector()
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): could not set up leader election. err=%v", err.Error())
+		}
+		return fmt.Errorf("could not set up leader election. err=%v", err.Error())
+	}
+	r, err := newRollout()
+	if err != nil {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ConfigSettings::ParseConfig(): could not set up rollout coordination. err=%v", err.Error())
+		}
+		return fmt.Errorf("could not set up rollout coordination. err=%v", err.Error())
+	}
+	if !c.check {
+		events.SetNotifiers(notifiers...)
+		setFailurePolicy(Config.Globals.FailurePolicy)
+		setElector(e, settings)
+		setRollout(r)
+	}
+
+	// Set the values in the config structure
+	c.Managers = Config.Managers
+	c.Globals = Config.Globals
+
+	// Let's get the path arrays dialed in
+	for _, m := range c.Managers {
+		for _, u := range m.Repos {
+			opts := fmt.Sprintf("%s.%s", m.Name, u)
+			m.ManagerOpts[opts].SetParentManager(m.Name)
+			m.ManagerOpts[opts].SetDownloadCache(filepath.Join(c.Globals.DownloadCachePath, m.Name))
+			m.ManagerOpts[opts].SetResponseCache(filepath.Join(c.Globals.DownloadCachePath, responseCacheDir), time.Duration(c.Globals.ResponseCacheTTL)*time.Second)
+			repo := strings.Replace(u, "/", "", -1)
+			// stripping a leading slash
+			if strings.HasPrefix(m.ManagerOpts[opts].RepoPath, "/") {
+				path = strings.Replace(m.ManagerOpts[opts].RepoPath, "/", "", 1)
+			} else {
+				path = m.ManagerOpts[opts].RepoPath
+			}
+			baseRemotePath := fmt.Sprintf("%s://%s/%s", m.ManagerOpts[opts].Method, repo, path)
+			m.ManagerOpts[opts].SetBasePaths(baseRemotePath, m.DestPath)
+			for _, f := range m.ManagerOpts[opts].PrimaryConfig {
+				fullRemotePath := fmt.Sprintf("%s/%s", baseRemotePath, f)
+				m.ManagerOpts[opts].AppendPrimaryConfigURL(fullRemotePath)
+				log.Debugf("ConfigSettings::ParseConfig(): full remote path to primary config: %s", fullRemotePath)
+			}
+			// we've only got one primary config, so we only need the array to have that element
+			// we still need to populate the remote paths, since we are merging multiple files
+			// into one. This used to be in the above loop
+			// a repo which only has file groups has no primary config
+			if len(m.ManagerOpts[opts].PrimaryConfig) > 0 {
+				fullLocalPath := filepath.Join(m.DestPath, m.PrimaryConfigName)
+				m.ManagerOpts[opts].AppendPrimaryConfigFile(fullLocalPath)
+				log.Debugf("ConfigSettings::ParseConfig(): full local path to primary config: %s", fullLocalPath)
+			}
+			for _, f := range m.ManagerOpts[opts].AdditionalConfig {
+				fullRemotePath := fmt.Sprintf("%s/%s", baseRemotePath, f)
+				fullLocalPath := filepath.Join(m.DestPath, m.ManagerOpts[opts].destName(f))
+				log.Debugf("ConfigSettings::ParseConfig(): full remote path to additional config: %s", fullRemotePath)
+				log.Debugf("ConfigSettings::ParseConfig(): full local path to primary config: %s", fullLocalPath)
+				m.ManagerOpts[opts].AppendAdditionalConfigURL(fullRemotePath)
+				m.ManagerOpts[opts].AppendAdditionalConfigFile(fullLocalPath)
+			}
+		}
+	}
+
+	return nil
+}
@@ -13,17 +13,22 @@ governing permissions and limitations under the License.
 package config
 
 import (
+	"context"
 	"fmt"
 	. "gopkg.in/check.v1"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/adobe/butler/internal/methods"
-	"github.com/adobe/butler/internal/reloaders"
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
 
 	"github.com/bouk/monkey"
 	log "github.com/sirupsen/logrus"
@@ -308,6 +313,19 @@ func (s *ConfigTestSuite) TestConfigConfigHandler_NotFound(c *C) {
 	c.Assert(err.Error(), Matches, "Did not receive 200.*404")
 }
 
+func (s *ConfigTestSuite) TestCheckConfig(c *C) {
+	wrap := func(cfg []byte) []byte {
+		return []byte("#butlerstart\n" + string(cfg) + "#butlerend\n")
+	}
+	c.Assert(CheckConfig("butler.toml", wrap(TestConfigCompleteEnvironment), "", false), IsNil)
+	c.Assert(CheckConfig("butler.toml", TestConfigCompleteEnvironment, "", false), NotNil)
+	c.Assert(CheckConfig("butler.toml", wrap([]byte("[globals")), "", false), NotNil)
+	// an invalid configuration never exits, even with exit-on-config-failure
+	err := CheckConfig("butler.toml", wrap(TestConfigNoHandlersExit), "", false)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, "globals.config-managers has no entries.*")
+}
+
 func (s *ConfigTestSuite) TestParseConfigEmpty(c *C) {
 	var err error
 	err = ParseConfig(TestConfigEmpty)
@@ -455,7 +473,7 @@ func (s *ConfigTestSuite) TestGetManagerOptsFullCheck(c *C) {
 	log.Debugf("TestGetManagerOptsNoConfig(): opts=%#v", opts)
 	c.Assert(err, NotNil)
 	// stegen
-	c.Assert(err.Error(), Matches, "no manager.primary-config defined")
+	c.Assert(err.Error(), Matches, "no manager.primary-config or manager.file-groups defined")
 }
 
 func (s *ConfigTestSuite) TestConfigCompleteEnvironment(c *C) {
@@ -490,3 +508,139 @@ func (s *ConfigTestSuite) TestConfigCompleteEnvironment(c *C) {
 	os.Unsetenv("RELOADER_HOST")
 	os.Unsetenv("MSUB")
 }
+
+func (s *ConfigTestSuite) TestParseConfigAuditLog(c *C) {
+	var config ConfigSettings
+
+	dir, err := ioutil.TempDir("/tmp", "baudit")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	defer events.SetSinks()
+
+	os.Setenv("RELOADER_HOST", "testing.com")
+	defer os.Unsetenv("RELOADER_HOST")
+	cfg := strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", fmt.Sprintf("audit-log = \"%s/audit.jsonl\"\n  [test-handler]", dir), 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.AuditLog, Equals, dir+"/audit.jsonl")
+
+	bc := &ButlerConfig{Config: &config}
+	_, err = bc.Rollback("test-handler", "", "api:127.0.0.1:1234")
+	c.Assert(err, NotNil)
+
+	data, err := ioutil.ReadFile(dir + "/audit.jsonl")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*"type":"rollback".*"actor":"api:127.0.0.1:1234".*"success":false.*`)
+	n, err := events.VerifyAuditLog(dir + "/audit.jsonl")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "audit-url = \"ftp://localhost\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.audit-url.*")
+}
+
+func (s *ConfigTestSuite) TestParseConfigLogging(c *C) {
+	var config ConfigSettings
+
+	os.Setenv("RELOADER_HOST", "testing.com")
+	defer os.Unsetenv("RELOADER_HOST")
+	os.Setenv("CONFIG_LOG_LEVEL", "debug")
+	defer os.Unsetenv("CONFIG_LOG_LEVEL")
+	c.Assert(config.ParseConfig(TestConfigCompleteEnvironment), IsNil)
+	c.Assert(config.Globals.LogFormat, Equals, "")
+	c.Assert(config.Globals.LogLevels, DeepEquals, map[string]string{})
+
+	cfg := strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-format = \"JSON\"\n  log-levels = { config = \"env:CONFIG_LOG_LEVEL\", reloaders = \"warn\" }\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.LogFormat, Equals, "json")
+	c.Assert(config.Globals.LogLevels, DeepEquals, map[string]string{"config": "debug", "reloaders": "warning"})
+
+	c.Assert(config.Globals.LogFile, Equals, "")
+	c.Assert(config.Globals.LogFileMaxSize, Equals, DefaultLogFileMaxSize)
+	c.Assert(config.Globals.LogFileMaxAge, Equals, 0)
+	c.Assert(config.Globals.LogFileMaxBackups, Equals, DefaultLogFileMaxBackups)
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-file = \"/var/log/butler/butler.log\"\n  log-file-max-size = \"10\"\n  log-file-max-age = \"24\"\n  log-file-max-backups = \"0\"\n  log-syslog = \"udp://syslog:514\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.LogFile, Equals, "/var/log/butler/butler.log")
+	c.Assert(config.Globals.LogFileMaxSize, Equals, 10)
+	c.Assert(config.Globals.LogFileMaxAge, Equals, 24)
+	c.Assert(config.Globals.LogFileMaxBackups, Equals, 0)
+	c.Assert(config.Globals.LogSyslog, Equals, "udp://syslog:514")
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-file-max-size = \"-1\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.log-file-max-size -1")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-syslog = \"syslog:514\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.log-syslog. err=syslog:514 must be local.*")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "redact = [\"sk-[a-z0-9]+\"]\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.Redact, DeepEquals, []string{"sk-[a-z0-9]+"})
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "redact = [\"sk-[\"]\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.redact. err=invalid redact pattern sk-\\[.*")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-format = \"xml\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.log-format xml.*")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "log-levels = { monitor = \"debug\" }\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.log-levels. err=unknown log component monitor.*")
+}
+
+func (s *ConfigTestSuite) TestParseConfigSchedules(c *C) {
+	var config ConfigSettings
+
+	os.Setenv("RELOADER_HOST", "testing.com")
+	defer os.Unsetenv("RELOADER_HOST")
+	c.Assert(config.ParseConfig(TestConfigCompleteEnvironment), IsNil)
+	c.Assert(config.Globals.Schedule.String(), Equals, "@every 5m0s")
+	c.Assert(config.Managers["test-handler"].Schedule, IsNil)
+
+	cfg := strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "scheduler-cron = \"CRON_TZ=UTC 0 */10 * * * *\"\n  [test-handler]", 1)
+	cfg = strings.Replace(cfg, "    repos = [", "    scheduler-interval = \"60\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.Schedule.String(), Equals, "CRON_TZ=UTC 0 */10 * * * *")
+	c.Assert(config.Managers["test-handler"].Schedule.String(), Equals, "@every 1m0s")
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "    repos = [", "    scheduler-interval = \"60\"\n    scheduler-cron = \"@hourly\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Managers["test-handler"].Schedule.String(), Equals, "@hourly")
+
+	// the globals splay applies to the schedule of the manager, unless it has
+	// a splay of its own
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "scheduler-splay = \"30\"\n  [test-handler]", 1)
+	cfg = strings.Replace(cfg, "    repos = [", "    scheduler-interval = \"60\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Globals.Schedule.String(), Equals, "@every 5m0s with splay 30s")
+	c.Assert(config.Managers["test-handler"].Schedule.String(), Equals, "@every 1m0s with splay 30s")
+	cfg = strings.Replace(cfg, "    repos = [", "    scheduler-splay = \"0\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), IsNil)
+	c.Assert(config.Managers["test-handler"].Schedule.String(), Equals, "@every 1m0s")
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "    repos = [", "    scheduler-splay = \"10\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, ".*Invalid scheduler-splay=10 for manager test-handler.*")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "scheduler-splay = \"-1\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.scheduler-splay.*")
+
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "[test-handler]", "scheduler-cron = \"61 * * * *\"\n  [test-handler]", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, "invalid globals.scheduler-cron.*")
+	cfg = strings.Replace(string(TestConfigCompleteEnvironment), "    repos = [", "    scheduler-interval = \"0\"\n    repos = [", 1)
+	c.Assert(config.ParseConfig([]byte(cfg)), ErrorMatches, ".*Invalid scheduler-interval=0 for manager test-handler.*")
+}
+
+func (s *ConfigTestSuite) TestUpdateSchedules(c *C) {
+	every := &Manager{Name: "every-manager"}
+	own := &Manager{Name: "own-manager", Schedule: scheduler.Every(time.Hour)}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{every.Name: every, own.Name: own}}}
+	bc.Config.Globals.SchedulerInterval = 300
+
+	// without a scheduler there is nothing to update
+	bc.UpdateSchedules()
+
+	sched := scheduler.NewScheduler()
+	sched.Add("butler-config", scheduler.Every(time.Hour), func(ctx context.Context) {})
+	bc.SetScheduler(sched)
+	bc.UpdateSchedules()
+	c.Assert(sched.Jobs(), DeepEquals, []string{"butler-config", CMHandlerJob, ManagerJobPrefix + own.Name})
+
+	// a manager which no longer has a schedule of its own runs on the
+	// globals schedule again
+	own.Schedule = nil
+	bc.UpdateSchedules()
+	c.Assert(sched.Jobs(), DeepEquals, []string{"butler-config", CMHandlerJob})
+}
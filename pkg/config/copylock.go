@@ -0,0 +1,94 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+)
+
+var (
+	// DefaultCopyLockTimeout is how long, in seconds, the copy waits for the
+	// copy-lock when manager.copy-lock-timeout is not set.
+	DefaultCopyLockTimeout = 30
+)
+
+// copyLockPoll is how often a copy-lock which is held is tried again.
+var copyLockPoll = 100 * time.Millisecond
+
+// initCopyLock checks the copy-lock options of the manager.
+func (bm *Manager) initCopyLock() error {
+	bm.CopyLock = strings.TrimSpace(environment.GetVar(bm.CopyLock))
+	bm.CopyLockMethod = strings.ToLower(strings.TrimSpace(environment.GetVar(bm.CopyLockMethod)))
+	if bm.CopyLockMethod == "" {
+		bm.CopyLockMethod = "flock"
+	}
+	if bm.CopyLockMethod != "flock" && bm.CopyLockMethod != "fcntl" {
+		return fmt.Errorf("Invalid copy-lock-method=%v", bm.CopyLockMethod)
+	}
+	bm.CopyLockTimeout = DefaultCopyLockTimeout
+	if t := strings.TrimSpace(environment.GetVar(bm.CfgCopyLockTimeout)); t != "" {
+		var err error
+		bm.CopyLockTimeout, err = strconv.Atoi(t)
+		if err != nil || bm.CopyLockTimeout < 0 {
+			return fmt.Errorf("Invalid copy-lock-timeout=%v", t)
+		}
+	}
+	if bm.CopyLock != "" {
+		bm.CopyLock = filepath.Clean(bm.CopyLock)
+		if !filepath.IsAbs(bm.CopyLock) {
+			return fmt.Errorf("Invalid copy-lock %v, must be absolute", bm.CopyLock)
+		}
+	}
+	return nil
+}
+
+// LockCopy takes the copy-lock of the manager, if it has one, an exclusive
+// advisory lock of the lock file, which is created when it does not exist.
+// The files of the manager are only written under the lock, so that the
+// managed service, and eg: the log rotators, which take the same lock, never
+// read them mid-write. It waits up to the copy-lock-timeout for the lock, and
+// returns the func which releases it.
+func (bm *Manager) LockCopy() (func(), error) {
+	if bm.CopyLock == "" {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(bm.CopyLock, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the copy-lock %v. err=%v", bm.CopyLock, err.Error())
+	}
+	deadline := time.Now().Add(time.Duration(bm.CopyLockTimeout) * time.Second)
+	for {
+		err = lockFile(f, bm.CopyLockMethod)
+		if err == nil {
+			break
+		}
+		if !lockBusy(err) {
+			f.Close()
+			return nil, fmt.Errorf("could not lock the copy-lock %v. err=%v", bm.CopyLock, err.Error())
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out after %vs waiting for the copy-lock %v", bm.CopyLockTimeout, bm.CopyLock)
+		}
+		time.Sleep(copyLockPoll)
+	}
+	// closing the file releases the lock, of either method
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestInitCopyLock(c *C) {
+	mgr := &Manager{}
+	c.Assert(mgr.initCopyLock(), IsNil)
+	c.Assert(mgr.CopyLockMethod, Equals, "flock")
+	c.Assert(mgr.CopyLockTimeout, Equals, DefaultCopyLockTimeout)
+
+	for _, m := range []*Manager{
+		{CopyLock: "nginx.lock"},
+		{CopyLock: "/run/nginx.lock", CopyLockMethod: "lockf"},
+		{CopyLock: "/run/nginx.lock", CfgCopyLockTimeout: "-1"},
+	} {
+		c.Assert(m.initCopyLock(), NotNil, Commentf("manager %#v", m))
+	}
+}
+
+func (s *ConfigTestSuite) TestLockCopy(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bcopylock")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	// no copy-lock, nothing to lock
+	unlock, err := (&Manager{}).LockCopy()
+	c.Assert(err, IsNil)
+	unlock()
+
+	mgr := &Manager{Name: "nginx", CopyLock: dir + "/nginx.lock", CfgCopyLockTimeout: "0"}
+	c.Assert(mgr.initCopyLock(), IsNil)
+	unlock, err = mgr.LockCopy()
+	c.Assert(err, IsNil)
+	_, err = os.Stat(dir + "/nginx.lock")
+	c.Assert(err, IsNil)
+	unlock()
+
+	// the service holds the lock
+	f, err := os.Open(dir + "/nginx.lock")
+	c.Assert(err, IsNil)
+	defer f.Close()
+	c.Assert(syscall.Flock(int(f.Fd()), syscall.LOCK_EX), IsNil)
+	_, err = mgr.LockCopy()
+	c.Assert(err, ErrorMatches, "timed out after 0s waiting for the copy-lock .*")
+
+	// the copy waits for the service to release it
+	mgr.CopyLockTimeout = 5
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(200 * time.Millisecond)
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+	unlock, err = mgr.LockCopy()
+	// the file is not closed until the service is done with it
+	<-released
+	c.Assert(err, IsNil)
+	unlock()
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file without waiting, with either
+// flock, or a POSIX record lock of the whole file.
+func lockFile(f *os.File, method string) error {
+	if method == "fcntl" {
+		return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart})
+	}
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// lockBusy returns whether the lock could not be taken as it is held.
+func lockBusy(err error) bool {
+	return err == syscall.EWOULDBLOCK || err == syscall.EAGAIN || err == syscall.EACCES
+}
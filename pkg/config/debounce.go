@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingReload is a change triggered reload of a manager which has been
+// deferred by its reload-debounce or reload-min-interval.
+type pendingReload struct {
+	timer *time.Timer
+	files []string
+}
+
+var (
+	// pendingReloads and lastReloads are keyed by manager name, so that they
+	// survive the managers being re-created on a butler config change. Both
+	// are protected by cmHandlerLock.
+	pendingReloads = make(map[string]*pendingReload)
+	lastReloads    = make(map[string]time.Time)
+)
+
+// ReloadDelay returns how long a change triggered reload of the manager has
+// to wait. Every change waits out the reload-debounce, so that changes which
+// are found in quick succession are coalesced into one reload, and no reload
+// happens within reload-min-interval of the previous one.
+func (bm *Manager) ReloadDelay(now time.Time) time.Duration {
+	delay := time.Duration(bm.ReloadDebounce) * time.Second
+	if last, ok := lastReloads[bm.Name]; ok && bm.ReloadMinInterval > 0 {
+		if wait := last.Add(time.Duration(bm.ReloadMinInterval) * time.Second).Sub(now); wait > delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// scheduleReload reloads the manager after its files have changed, or defers
+// the reload by its ReloadDelay. The changed files of a pending reload are
+// carried over into the next one. It returns the error of a reload which was
+// not deferred.
+func (bc *ButlerConfig) scheduleReload(mgr *Manager) error {
+	if p, ok := pendingReloads[mgr.Name]; ok {
+		p.timer.Stop()
+		delete(pendingReloads, mgr.Name)
+		mgr.ChangedFiles = mergeFiles(p.files, mgr.ChangedFiles)
+	}
+
+	now := time.Now()
+	delay := mgr.ReloadDelay(now)
+	// a debounced reload may come due in a blackout window
+	if end, blocked := mgr.BlackoutEnd(now.Add(delay)); blocked {
+		delay = end.Sub(now)
+	}
+	if delay <= 0 {
+		return bc.reloadManager(mgr)
+	}
+
+	log.Infof("Config::scheduleReload()[count=%v][manager=%v]: deferring reload for %v.", cmHandlerCounter, mgr.Name, delay)
+	// butler may be stopped before the deferred reload runs, in which case
+	// the manager is reloaded on the first run after it is started again
+	if err := bc.recordStatus(mgr.Name, StatusPending, "", nil); err != nil {
+		log.Errorf("Config::scheduleReload()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, mgr.Name, bc.GetStatusFile(), err.Error())
+	}
+	name := mgr.Name
+	p := &pendingReload{files: mgr.ChangedFiles}
+	p.timer = time.AfterFunc(delay, func() { bc.runPendingReload(name, p) })
+	pendingReloads[name] = p
+	return nil
+}
+
+// runPendingReload runs a deferred reload, unless it has been replaced by a
+// later change in the meantime.
+func (bc *ButlerConfig) runPendingReload(name string, p *pendingReload) {
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	if pendingReloads[name] != p {
+		return
+	}
+	delete(pendingReloads, name)
+
+	mgr := bc.GetManager(name)
+	if mgr == nil {
+		log.Warnf("Config::runPendingReload()[count=%v][manager=%v]: manager no longer exists, not reloading.", cmHandlerCounter, name)
+		return
+	}
+	if end, blocked := mgr.BlackoutEnd(time.Now()); blocked {
+		log.Infof("Config::runPendingReload()[count=%v][manager=%v]: in a blackout window until %v, deferring reload.", cmHandlerCounter, name, end.Format(time.RFC3339))
+		p.timer = time.AfterFunc(end.Sub(time.Now()), func() { bc.runPendingReload(name, p) })
+		pendingReloads[name] = p
+		return
+	}
+	if dep := blockingDependency(mgr, nil, nil, true); dep != "" {
+		// the manager stays pending, and is reloaded by the first run
+		// after the dependency has reloaded
+		log.Warnf("Config::runPendingReload()[count=%v][manager=%v]: dependency %v has not reloaded, not reloading.", cmHandlerCounter, name, dep)
+		return
+	}
+	log.Infof("Config::runPendingReload()[count=%v][manager=%v]: running deferred reload.", cmHandlerCounter, name)
+	mgr.ChangedFiles = p.files
+	bc.reloadManager(mgr)
+	bc.saveState(mgr)
+}
+
+// mergeFiles appends the files which are not in a yet.
+func mergeFiles(a []string, b []string) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0, len(a)+len(b))
+	for _, f := range append(append([]string{}, a...), b...) {
+		if !seen[f] {
+			seen[f] = true
+			res = append(res, f)
+		}
+	}
+	return res
+}
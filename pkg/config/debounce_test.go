@@ -0,0 +1,94 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/adobe/butler/pkg/reloaders"
+
+	. "gopkg.in/check.v1"
+)
+
+// countingReloader records the changed files of every reload.
+type countingReloader struct {
+	reloads *[][]string
+	files   []string
+}
+
+func (r countingReloader) Reload() error {
+	*r.reloads = append(*r.reloads, r.files)
+	return nil
+}
+func (r countingReloader) GetMethod() string                   { return "counting" }
+func (r countingReloader) GetOpts() reloaders.ReloaderOpts     { return nil }
+func (r countingReloader) SetOpts(reloaders.ReloaderOpts) bool { return true }
+func (r countingReloader) SetCounter(int) reloaders.Reloader   { return r }
+func (r countingReloader) SetChangedFiles(files []string) reloaders.Reloader {
+	r.files = files
+	return r
+}
+
+func (s *ConfigTestSuite) TestReloadDelay(c *C) {
+	now := time.Now()
+	mgr := &Manager{Name: "delay-manager"}
+	c.Assert(mgr.ReloadDelay(now), Equals, time.Duration(0))
+
+	mgr.ReloadDebounce = 5
+	c.Assert(mgr.ReloadDelay(now), Equals, 5*time.Second)
+
+	// the min interval wins when the last reload was recent
+	mgr.ReloadMinInterval = 60
+	lastReloads[mgr.Name] = now.Add(-30 * time.Second)
+	defer delete(lastReloads, mgr.Name)
+	c.Assert(mgr.ReloadDelay(now), Equals, 30*time.Second)
+	lastReloads[mgr.Name] = now.Add(-59 * time.Second)
+	c.Assert(mgr.ReloadDelay(now), Equals, 5*time.Second)
+
+	_, err := parseNonNegativeInt("-1")
+	c.Assert(err, NotNil)
+	res, err := parseNonNegativeInt("")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, 0)
+}
+
+func (s *ConfigTestSuite) TestScheduleReload(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bdebounce")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var reloads [][]string
+	mgr := &Manager{Name: "debounce-manager", ReloadDebounce: 1, Reloader: countingReloader{reloads: &reloads}}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{mgr.Name: mgr}}}
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+
+	// two changes in quick succession are coalesced into one reload
+	cmHandlerLock.Lock()
+	mgr.ChangedFiles = []string{"/a.yml"}
+	bc.scheduleReload(mgr)
+	mgr.ChangedFiles = []string{"/a.yml", "/b.yml"}
+	bc.scheduleReload(mgr)
+	c.Assert(len(reloads), Equals, 0)
+	cmHandlerLock.Unlock()
+
+	time.Sleep(1500 * time.Millisecond)
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+	c.Assert(reloads, DeepEquals, [][]string{{"/a.yml", "/b.yml"}})
+	_, pending := pendingReloads[mgr.Name]
+	c.Assert(pending, Equals, false)
+	c.Assert(GetManagerStatus(bc.GetStatusFile(), mgr.Name), Equals, true)
+	delete(lastReloads, mgr.Name)
+}
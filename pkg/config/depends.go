@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkDependencies returns an error when a manager depends on itself, on a
+// manager which is not configured, or on a manager which depends on it.
+func checkDependencies(managers map[string]*Manager) error {
+	for _, m := range managers {
+		for _, dep := range m.DependsOn {
+			if dep == m.Name {
+				return fmt.Errorf("manager %v depends on itself", m.Name)
+			}
+			if _, ok := managers[dep]; !ok {
+				return fmt.Errorf("manager %v depends on unknown manager %v", m.Name, dep)
+			}
+		}
+	}
+	order := runOrder(managers)
+	seen := make(map[string]bool)
+	for _, m := range order {
+		for _, dep := range m.DependsOn {
+			if !seen[dep] {
+				var cycle []string
+				for _, c := range order {
+					if !seen[c.Name] {
+						cycle = append(cycle, c.Name)
+					}
+				}
+				return fmt.Errorf("managers %v depend on each other", strings.Join(cycle, ", "))
+			}
+		}
+		seen[m.Name] = true
+	}
+	return nil
+}
+
+// runOrder returns the managers in the order they are run in: every manager
+// after those it depends on, and otherwise the canary managers first, then by
+// name. The managers which depend on each other come last.
+func runOrder(managers map[string]*Manager) []*Manager {
+	var (
+		res     []*Manager
+		ready   []*Manager
+		pending = make(map[string]int)
+		users   = make(map[string][]*Manager)
+	)
+	for _, m := range canariesFirst(managers) {
+		for _, dep := range m.DependsOn {
+			if _, ok := managers[dep]; ok {
+				pending[m.Name]++
+				users[dep] = append(users[dep], m)
+			}
+		}
+		if pending[m.Name] == 0 {
+			ready = append(ready, m)
+		}
+	}
+	less := func(a, b *Manager) bool {
+		if a.Canary != b.Canary {
+			return a.Canary
+		}
+		return a.Name < b.Name
+	}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		m := ready[0]
+		ready = ready[1:]
+		res = append(res, m)
+		for _, u := range users[m.Name] {
+			if pending[u.Name]--; pending[u.Name] == 0 {
+				ready = append(ready, u)
+			}
+		}
+	}
+	for _, m := range canariesFirst(managers) {
+		if pending[m.Name] > 0 {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// blockingDependency returns the dependency of the manager which holds it
+// back, or "". A dependency holds the manager back when its run failed, in
+// the run which failed and ran the managers or, when it is not part of that
+// run, in its last run. Before the reload of the manager, a dependency whose
+// own last reload failed, or is still pending, holds it back as well. It is
+// protected by cmHandlerLock.
+func blockingDependency(m *Manager, failed RunErrors, ran []string, reloading bool) string {
+	for _, dep := range m.DependsOn {
+		if failed.For(dep) != nil {
+			return dep
+		}
+		s := GetRunStatus(dep)
+		if !containsString(ran, dep) && s.LastError != "" {
+			return dep
+		}
+		if !reloading {
+			continue
+		}
+		if s.LastReload != nil && !s.LastReload.Success {
+			return dep
+		}
+		if _, ok := pendingReloads[dep]; ok {
+			return dep
+		}
+	}
+	return ""
+}
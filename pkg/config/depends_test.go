@@ -0,0 +1,66 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestDependencies(c *C) {
+	rules := &Manager{Name: "deps-rules"}
+	alertmanager := &Manager{Name: "deps-alertmanager", DependsOn: []string{"deps-rules"}}
+	canary := &Manager{Name: "deps-canary", Canary: true, DependsOn: []string{"deps-rules"}}
+	other := &Manager{Name: "deps-other"}
+	managers := map[string]*Manager{rules.Name: rules, alertmanager.Name: alertmanager, canary.Name: canary, other.Name: other}
+	defer func() {
+		runStatusLock.Lock()
+		delete(runStatuses, rules.Name)
+		runStatusLock.Unlock()
+	}()
+
+	// the managers run after their dependencies, and otherwise the
+	// canaries first
+	c.Assert(checkDependencies(managers), IsNil)
+	c.Assert(runOrder(managers), DeepEquals, []*Manager{other, rules, canary, alertmanager})
+
+	rules.DependsOn = []string{"deps-rules"}
+	c.Assert(checkDependencies(managers), ErrorMatches, "manager deps-rules depends on itself")
+	rules.DependsOn = []string{"deps-missing"}
+	c.Assert(checkDependencies(managers), ErrorMatches, "manager deps-rules depends on unknown manager deps-missing")
+	rules.DependsOn = []string{"deps-alertmanager"}
+	c.Assert(checkDependencies(managers), ErrorMatches, "managers deps-canary, deps-alertmanager, deps-rules depend on each other")
+	c.Assert(runOrder(managers), HasLen, 4)
+	rules.DependsOn = nil
+
+	// a dependency which failed in the run holds the manager back
+	failed := RunErrors{&RunError{Manager: rules.Name, Stage: StageDownload, Err: errors.New("download failed")}}
+	c.Assert(blockingDependency(alertmanager, failed, []string{rules.Name}, false), Equals, rules.Name)
+	c.Assert(blockingDependency(alertmanager, nil, []string{rules.Name}, false), Equals, "")
+
+	// and so does one whose last run failed, when it is not part of the run
+	recordRun(rules.Name, errors.New("download failed"))
+	c.Assert(blockingDependency(alertmanager, nil, nil, false), Equals, rules.Name)
+	c.Assert(blockingDependency(alertmanager, nil, []string{rules.Name}, false), Equals, "")
+	recordRun(rules.Name, nil)
+	c.Assert(blockingDependency(alertmanager, nil, nil, false), Equals, "")
+
+	// the reload waits for the reload of the dependency
+	recordReload(rules.Name, errors.New("reload failed"))
+	c.Assert(blockingDependency(alertmanager, nil, nil, false), Equals, "")
+	c.Assert(blockingDependency(alertmanager, nil, nil, true), Equals, rules.Name)
+	recordReload(rules.Name, nil)
+	c.Assert(blockingDependency(alertmanager, nil, nil, true), Equals, "")
+	c.Assert(StageDependency.String(), Equals, "dependency")
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/diff"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultDiffRetention is the number of diffs that are kept per manager
+	// when manager.diff-retention is not set.
+	DefaultDiffRetention = 10
+)
+
+// FileDiff is the masked unified diff of a change butler made to a managed
+// file. Hash is the sha256 of the diff, so that a change can be referred to
+// from logs and notifications without including its contents.
+type FileDiff struct {
+	Manager string    `json:"manager"`
+	File    string    `json:"file"`
+	Time    time.Time `json:"time"`
+	Hash    string    `json:"hash"`
+	Diff    string    `json:"diff"`
+}
+
+// DiffStore keeps the last Retention diffs of the files of a manager in
+// memory, and optionally logs them as they are recorded.
+type DiffStore struct {
+	Manager   string `json:"-"`
+	Retention int    `json:"retention"`
+	Log       bool   `json:"log"`
+	masker    *diff.Masker
+	diffs     []FileDiff
+	mutex     sync.Mutex
+}
+
+func NewDiffStore(manager string, retention int, logDiffs bool, mask []string) (*DiffStore, error) {
+	masker, err := diff.NewMasker(mask)
+	if err != nil {
+		return nil, err
+	}
+	return &DiffStore{Manager: manager, Retention: retention, Log: logDiffs, masker: masker}, nil
+}
+
+// Diff computes the diff between the old and new contents of the file,
+// without storing it. A nil old means the file is created, and a nil new that
+// it is removed. Binary files are only compared by checksum. It returns nil if
+// there is no change. A nil store masks the usual secrets only.
+func (s *DiffStore) Diff(file string, old []byte, new []byte, binary bool) *FileDiff {
+	masker, manager := &diff.Masker{}, ""
+	if s != nil {
+		masker, manager = s.masker, s.Manager
+	}
+
+	var d string
+	if binary {
+		oldSum, newSum := sha256.Sum256(old), sha256.Sum256(new)
+		if oldSum == newSum {
+			return nil
+		}
+		d = fmt.Sprintf("Binary files a/%s (sha256 %s) and b/%s (sha256 %s) differ\n", file, hex.EncodeToString(oldSum[:]), file, hex.EncodeToString(newSum[:]))
+	} else {
+		d = masker.Mask(diff.Unified("a/"+file, "b/"+file, old, new, diff.DefaultContext))
+	}
+	if d == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(d))
+	return &FileDiff{Manager: manager, File: file, Time: time.Now(), Hash: hex.EncodeToString(sum[:]), Diff: d}
+}
+
+// Record computes the diff between the old and new contents of the file and
+// stores it, see Diff. It returns nil if there is no change, or the store is
+// nil.
+func (s *DiffStore) Record(file string, old []byte, new []byte, binary bool) *FileDiff {
+	if s == nil {
+		return nil
+	}
+	fd := s.Diff(file, old, new, binary)
+	if fd == nil {
+		return nil
+	}
+	if s.Log {
+		log.Infof("DiffStore::Record()[count=%v][manager=%v]: %v changed, diff hash=%v\n%v", cmHandlerCounter, s.Manager, file, fd.Hash, fd.Diff)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.diffs = append(s.diffs, *fd)
+	if len(s.diffs) > s.Retention {
+		s.diffs = append([]FileDiff{}, s.diffs[len(s.diffs)-s.Retention:]...)
+	}
+	return fd
+}
+
+// List returns the retained diffs, newest first.
+func (s *DiffStore) List() []FileDiff {
+	res := []FileDiff{}
+	if s == nil {
+		return res
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.diffs) - 1; i >= 0; i-- {
+		res = append(res, s.diffs[i])
+	}
+	return res
+}
+
+// PendingChanges retrieves the butler configuration, and the configuration
+// files of every manager which is not paused, and returns the diffs of the
+// files which the next run would change, without changing anything. The
+// diffs are returned along with RunErrors for the managers which failed.
+func (bc *ButlerConfig) PendingChanges() ([]FileDiff, error) {
+	var (
+		res    []FileDiff
+		failed []*RunError
+		names  []string
+	)
+	if err := bc.Handler(); err != nil {
+		return nil, err
+	}
+
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	for name := range bc.GetManagers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c1 := make(chan ChanEvent)
+	c2 := make(chan ChanEvent)
+	for _, name := range names {
+		m := bc.GetManager(name)
+		if GetManagerPaused(bc.GetStatusFile(), name) != nil {
+			log.Infof("Config::PendingChanges()[manager=%v]: paused, skipping.", name)
+			continue
+		}
+		go m.DownloadPrimaryConfigFiles(context.Background(), c1)
+		go m.DownloadAdditionalConfigFiles(context.Background(), c2)
+		primary, additional := <-c1, <-c2
+
+		diffs, err := m.pendingChanges(primary, additional)
+		primary.CleanTmpFiles()
+		additional.CleanTmpFiles()
+		if err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		res = append(res, diffs...)
+	}
+	if len(failed) > 0 {
+		return res, RunErrors(failed)
+	}
+	return res, nil
+}
+
+// pendingChanges returns the diffs of the files of the manager which the
+// downloaded files would change.
+func (bm *Manager) pendingChanges(primary ChanEvent, additional ChanEvent) ([]FileDiff, *RunError) {
+	var (
+		res []FileDiff
+	)
+	if !primary.CanCopyFiles() || !additional.CanCopyFiles() {
+		if primary.Invalid() || additional.Invalid() {
+			return nil, &RunError{Manager: bm.Name, Stage: StageValidation, Err: errors.New("could not render or validate the configuration files")}
+		}
+		return nil, &RunError{Manager: bm.Name, Stage: StageDownload, Err: errors.New("could not download the configuration files")}
+	}
+	if err := bm.ValidateStagedFiles(primary, additional); err != nil {
+		return nil, &RunError{Manager: bm.Name, Stage: StageValidation, Err: err}
+	}
+
+	d, err := primary.DiffPrimaryConfigFiles(bm.ManagerOpts)
+	if err != nil {
+		return nil, &RunError{Manager: bm.Name, Stage: StageDownload, Err: err}
+	}
+	if d != nil {
+		res = append(res, *d)
+	}
+	diffs, err := additional.DiffAdditionalConfigFiles(bm.DestPath)
+	if err != nil {
+		return nil, &RunError{Manager: bm.Name, Stage: StageDownload, Err: err}
+	}
+	res = append(res, diffs...)
+	for i := range res {
+		res[i].Manager = bm.Name
+	}
+	return res, nil
+}
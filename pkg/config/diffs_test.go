@@ -0,0 +1,120 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestDiffStore(c *C) {
+	var nilStore *DiffStore
+	c.Assert(nilStore.Record("foo.yml", nil, []byte("foo"), false), IsNil)
+	c.Assert(nilStore.List(), HasLen, 0)
+
+	store, err := NewDiffStore("testing", 2, false, []string{`sk-[a-z0-9]+`})
+	c.Assert(err, IsNil)
+	c.Assert(store.Record("foo.yml", []byte("foo\n"), []byte("foo\n"), false), IsNil)
+
+	d := store.Record("foo.yml", []byte("token: abc\nkey: sk-abc\n"), []byte("token: def\nkey: sk-def\n"), false)
+	c.Assert(d, NotNil)
+	c.Assert(d.Manager, Equals, "testing")
+	c.Assert(d.Hash, HasLen, 64)
+	c.Assert(d.Diff, Equals, "--- a/foo.yml\n+++ b/foo.yml\n@@ -1,2 +1,2 @@\n-token: ********\n-key: ********\n+token: ********\n+key: ********\n")
+
+	d = store.Record("foo.bin", []byte{0, 1}, []byte{0, 2}, true)
+	c.Assert(d, NotNil)
+	c.Assert(d.Diff, Matches, "Binary files a/foo.bin .* and b/foo.bin .* differ\n")
+
+	store.Record("bar.yml", []byte("bar\n"), nil, false)
+	diffs := store.List()
+	c.Assert(diffs, HasLen, 2)
+	c.Assert(diffs[0].File, Equals, "bar.yml")
+	c.Assert(diffs[1].File, Equals, "foo.bin")
+
+	_, err = NewDiffStore("testing", 2, false, []string{`[`})
+	c.Assert(err, NotNil)
+}
+
+func (s *ConfigTestSuite) TestCopyRecordsDiff(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bdiffs")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/src.yml", []byte("foo: baz\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/foo.yml", []byte("foo: bar\n"), 0644), IsNil)
+
+	store, err := NewDiffStore("testing", 5, false, nil)
+	c.Assert(err, IsNil)
+	chanEvent := NewConfigChanEvent()
+	chanEvent.Manager = "testing"
+	chanEvent.Diffs = store
+	chanEvent.SetSuccess("localhost", "foo.yml", nil)
+	chanEvent.SetTmpFile("localhost", "foo.yml", dir+"/src.yml")
+	c.Assert(chanEvent.CopyAdditionalConfigFiles(dir), Equals, true)
+
+	diffs := store.List()
+	c.Assert(diffs, HasLen, 1)
+	c.Assert(diffs[0].Diff, Equals, "--- a/foo.yml\n+++ b/foo.yml\n@@ -1 +1 @@\n-foo: bar\n+foo: baz\n")
+}
+
+func (s *ConfigTestSuite) TestPendingChanges(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bpending")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/staged", 0755), IsNil)
+	c.Assert(os.MkdirAll(dir+"/dest", 0755), IsNil)
+	for f, data := range map[string]string{"staged/a.yml": "a\n", "staged/b.yml": "#butlerstart\nb: new\n#butlerend\n", "staged/prometheus.yml": "p\n", "dest/a.yml": "a\n", "dest/b.yml": "b: old\n", "dest/prometheus.yml": "p\n"} {
+		c.Assert(ioutil.WriteFile(dir+"/"+f, []byte(data), 0644), IsNil)
+	}
+
+	mgr := &Manager{Name: "pending-manager", DestPath: dir + "/dest", PrimaryConfigName: "prometheus.yml"}
+	mgr.ManagerOpts = map[string]*ManagerOpts{"pending-manager.repo": {PrimaryConfig: []string{"primary.yml"}}}
+	staged := func() (*ConfigChanEvent, *ConfigChanEvent) {
+		primary := NewConfigChanEvent()
+		configFile := dir + "/dest/prometheus.yml"
+		primary.ConfigFile = &configFile
+		primary.TmpFile, err = os.Create(dir + "/staged/merged")
+		c.Assert(err, IsNil)
+		primary.Repo["repo"] = &RepoFileEvent{Success: map[string]bool{}, Error: map[string]error{}, TmpFile: map[string]string{"primary.yml": dir + "/staged/prometheus.yml"}, Binary: map[string]bool{}}
+		additional := NewConfigChanEvent()
+		additional.Repo["repo"] = &RepoFileEvent{Success: map[string]bool{}, Error: map[string]error{}, TmpFile: map[string]string{"a.yml": dir + "/staged/a.yml", "b.yml": dir + "/staged/b.yml"}, Binary: map[string]bool{}}
+		return primary, additional
+	}
+
+	// only the changed file is diffed, without the butler header and footer
+	primary, additional := staged()
+	diffs, runErr := mgr.pendingChanges(primary, additional)
+	c.Assert(runErr, IsNil)
+	c.Assert(diffs, HasLen, 1)
+	c.Assert(diffs[0].Manager, Equals, mgr.Name)
+	c.Assert(diffs[0].File, Equals, "b.yml")
+	c.Assert(diffs[0].Diff, Matches, "(?s).*-b: old\n\\+b: new\n")
+	data, err := ioutil.ReadFile(dir + "/dest/b.yml")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "b: old\n")
+
+	// files which failed to download or validate are not diffed
+	primary, additional = staged()
+	additional.SetFailure("repo", "b.yml", errValidateFile)
+	_, runErr = mgr.pendingChanges(primary, additional)
+	c.Assert(runErr, NotNil)
+	c.Assert(runErr.Stage, Equals, StageValidation)
+	primary, additional = staged()
+	primary.SetFailure("repo", "primary.yml", errors.New("could not download file"))
+	_, runErr = mgr.pendingChanges(primary, additional)
+	c.Assert(runErr, NotNil)
+	c.Assert(runErr.Stage, Equals, StageDownload)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The failure policies decide how butler handles the failures of its own
+// operations, eg: writing the status-file, or creating the directories and
+// temporary files of the managers, as opposed to the failures of the managers.
+const (
+	// FailurePolicyExit exits butler.
+	FailurePolicyExit = "exit"
+	// FailurePolicyRetry retries the operation FailureRetries times, and then
+	// degrades.
+	FailurePolicyRetry = "retry"
+	// FailurePolicyDegrade carries on without the operation, which fails the
+	// run of the manager.
+	FailurePolicyDegrade = "degrade"
+)
+
+// The operations which are handled by the failure policy.
+const (
+	FailureStatusFile = "status-file"
+	FailureMkdir      = "mkdir"
+	FailureTempFile   = "temp-file"
+)
+
+var (
+	DefaultFailurePolicy = FailurePolicyRetry
+	// FailureRetries is the number of times a failed operation is retried
+	// with the retry policy, FailureRetryWait apart.
+	FailureRetries   = 3
+	FailureRetryWait = time.Second
+
+	failurePolicy     = DefaultFailurePolicy
+	failurePolicyLock sync.Mutex
+)
+
+// IsValidFailurePolicy returns true if p is a known failure policy.
+func IsValidFailurePolicy(p string) bool {
+	switch p {
+	case FailurePolicyExit, FailurePolicyRetry, FailurePolicyDegrade:
+		return true
+	}
+	return false
+}
+
+func setFailurePolicy(p string) {
+	failurePolicyLock.Lock()
+	defer failurePolicyLock.Unlock()
+	failurePolicy = p
+}
+
+func getFailurePolicy() string {
+	failurePolicyLock.Lock()
+	defer failurePolicyLock.Unlock()
+	return failurePolicy
+}
+
+// handleFailure runs the operation op, and handles its failure by the failure
+// policy. Every failure is counted by the butler_internal_failures_total
+// metric. It returns the error of the operation when butler carries on
+// without it.
+func handleFailure(op string, fn func() error) error {
+	policy := getFailurePolicy()
+	err := fn()
+	for i := 0; err != nil && policy == FailurePolicyRetry && i < FailureRetries; i++ {
+		metrics.IncButlerInternalFailure(op)
+		log.Warnf("Config::handleFailure()[count=%v]: %v failed, retrying in %v. err=%v", cmHandlerCounter, op, FailureRetryWait, err.Error())
+		time.Sleep(FailureRetryWait)
+		err = fn()
+	}
+	if err == nil {
+		return nil
+	}
+	metrics.IncButlerInternalFailure(op)
+	if policy == FailurePolicyExit {
+		log.Fatalf("Config::handleFailure()[count=%v]: %v failed, exiting. err=%v", cmHandlerCounter, op, err.Error())
+	}
+	return err
+}
+
+// recordStatus records the status of the manager in the status file, like
+// RecordManagerStatus, by the failure policy.
+func (bc *ButlerConfig) recordStatus(name string, state string, version string, err error) error {
+	return handleFailure(FailureStatusFile, func() error {
+		return RecordManagerStatus(bc.GetStatusFile(), name, state, version, err)
+	})
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestHandleFailure(c *C) {
+	defer setFailurePolicy(DefaultFailurePolicy)
+	defer func(wait time.Duration) { FailureRetryWait = wait }(FailureRetryWait)
+	FailureRetryWait = time.Millisecond
+
+	c.Assert(IsValidFailurePolicy(FailurePolicyDegrade), Equals, true)
+	c.Assert(IsValidFailurePolicy("ignore"), Equals, false)
+
+	calls := 0
+	flaky := func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}
+
+	// a transient failure is retried away
+	setFailurePolicy(FailurePolicyRetry)
+	c.Assert(handleFailure(FailureStatusFile, flaky), IsNil)
+	c.Assert(calls, Equals, 3)
+
+	// and degrades once the retries are used up
+	calls = -10
+	c.Assert(handleFailure(FailureStatusFile, flaky), ErrorMatches, "transient")
+	c.Assert(calls, Equals, FailureRetries-10+1)
+
+	calls = 0
+	setFailurePolicy(FailurePolicyDegrade)
+	c.Assert(handleFailure(FailureStatusFile, flaky), ErrorMatches, "transient")
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *ConfigTestSuite) TestCheckPathsFailure(c *C) {
+	defer setFailurePolicy(DefaultFailurePolicy)
+	setFailurePolicy(FailurePolicyDegrade)
+
+	dir, err := ioutil.TempDir("/tmp", "bcheckpaths")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	// a directory cannot be created underneath a file
+	c.Assert(ioutil.WriteFile(dir+"/file", []byte("x"), 0644), IsNil)
+
+	ok := &Manager{Name: "ok-manager", ManagerOpts: map[string]*ManagerOpts{
+		"ok-manager.repo": {PrimaryConfigsFullLocalPaths: []string{dir + "/ok/ok.yml"}},
+	}}
+	broken := &Manager{Name: "broken-manager", ManagerOpts: map[string]*ManagerOpts{
+		"broken-manager.repo": {PrimaryConfigsFullLocalPaths: []string{dir + "/file/broken/broken.yml"}},
+	}}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{ok.Name: ok, broken.Name: broken}}}
+
+	err = bc.CheckPaths()
+	c.Assert(err, NotNil)
+	failed, isRunErrors := err.(RunErrors)
+	c.Assert(isRunErrors, Equals, true)
+	c.Assert(len(failed), Equals, 1)
+	c.Assert(failed[0].Manager, Equals, "broken-manager")
+	c.Assert(failed[0].Stage, Equals, StageDownload)
+	_, err = os.Stat(dir + "/ok")
+	c.Assert(err, IsNil)
+}
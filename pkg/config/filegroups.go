@@ -0,0 +1,345 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/validators"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FileGroup is a named group of config files of the manager, which the repos
+// list under their file-groups. The files of a group are installed
+// underneath its own dest-path, either one by one or merged into a single
+// file, and are validated and reloaded with the validators and reloader of
+// the group, on top of those of the manager.
+type FileGroup struct {
+	Name        string                 `mapstructure:"-" json:"-"`
+	DestPath    string                 `mapstructure:"dest-path" json:"dest-path,omitempty"`
+	Merge       string                 `mapstructure:"merge" json:"merge,omitempty"`
+	ContentType string                 `mapstructure:"content-type" json:"content-type,omitempty"`
+	Reloader    reloaders.Reloader     `mapstructure:"-" json:"reloader,omitempty"`
+	Validators  []validators.Validator `mapstructure:"-" json:"validators,omitempty"`
+	// files are the dest paths of the files of the group, across all of the
+	// repos of the manager.
+	files []string
+}
+
+// groupFile is a file which a repo lists under one of its file-groups.
+type groupFile struct {
+	group *FileGroup
+	// file is the path of the file in the repo.
+	file string
+	// name is the path the file is installed to, relative to the dest-path
+	// of the manager. The files of a merged group share the name of the
+	// merged file.
+	name string
+}
+
+// localName returns the path, relative to the dest-path of the manager, the
+// file of the group is installed to.
+func (g *FileGroup) localName(file string) string {
+	if g.Merge != "" {
+		return filepath.Join(g.DestPath, g.Merge)
+	}
+	return filepath.Join(g.DestPath, file)
+}
+
+// isRelativePath returns whether the path is relative, and does not escape
+// the directory it is relative to.
+func isRelativePath(p string) bool {
+	p = filepath.ToSlash(filepath.Clean(p))
+	return !filepath.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+// initFileGroups checks the file groups of the manager, and the files the
+// repos list under them, and sets up the validators and reloaders of the
+// groups.
+func (bm *Manager) initFileGroups(entry string) error {
+	var err error
+
+	for name, g := range bm.FileGroups {
+		if g == nil {
+			g = &FileGroup{}
+			bm.FileGroups[name] = g
+		}
+		g.Name = name
+		g.DestPath = filepath.Clean(environment.GetVar(g.DestPath))
+		if !isRelativePath(g.DestPath) {
+			return fmt.Errorf("invalid file-groups.%v.dest-path %v, it has to be relative to the manager dest-path", name, g.DestPath)
+		}
+		g.Merge = strings.TrimSpace(environment.GetVar(g.Merge))
+		if g.Merge != "" {
+			g.Merge = filepath.Clean(g.Merge)
+			if g.Merge == "." || !isRelativePath(g.Merge) {
+				return fmt.Errorf("invalid file-groups.%v.merge %v", name, g.Merge)
+			}
+		}
+		g.ContentType = strings.ToLower(strings.TrimSpace(environment.GetVar(g.ContentType)))
+		if g.ContentType != "" && !IsValidContentType(g.ContentType) {
+			return fmt.Errorf("unknown file-groups.%v.content-type=%v", name, g.ContentType)
+		}
+		if g.ContentType == "binary" && g.Merge != "" {
+			return fmt.Errorf("file-groups.%v can not be merged, since its content-type is binary", name)
+		}
+		g.Validators, err = validators.NewFileGroup(entry, name)
+		if err != nil {
+			return fmt.Errorf("could not get validators for file group %v: %v", name, err.Error())
+		}
+		g.Reloader, err = reloaders.NewFileGroupReloader(entry, name)
+		if err != nil {
+			return fmt.Errorf("could not get reloader for file group %v: %v", name, err.Error())
+		}
+		g.files = nil
+	}
+
+	for _, r := range bm.Repos {
+		opts, ok := bm.ManagerOpts[fmt.Sprintf("%s.%s", entry, r)]
+		if !ok {
+			continue
+		}
+		opts.groupFiles = nil
+		names := make([]string, 0, len(opts.FileGroups))
+		for name := range opts.FileGroups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			g, ok := bm.FileGroups[name]
+			if !ok {
+				return fmt.Errorf("unknown file group %v for repo %v", name, r)
+			}
+			for _, f := range opts.FileGroups[name] {
+				f = strings.TrimSpace(environment.GetVar(f))
+				if f == "" {
+					continue
+				}
+				f = filepath.ToSlash(filepath.Clean(f))
+				if f == "." || !isRelativePath(f) {
+					return fmt.Errorf("invalid file %v in file group %v for repo %v", f, name, r)
+				}
+				local := g.localName(opts.destName(f))
+				opts.groupFiles = append(opts.groupFiles, groupFile{group: g, file: f, name: local})
+				// the files of a merged group get concatenated, which
+				// makes no sense for binary files
+				if g.Merge != "" && opts.IsBinary(f) {
+					return fmt.Errorf("file %v in merged file group %v can not be binary", f, name)
+				}
+				if len(g.files) == 0 || g.Merge == "" {
+					g.files = append(g.files, filepath.Join(bm.DestPath, local))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fileGroupNames returns the names of the file groups of the manager, sorted.
+func (bm *Manager) fileGroupNames() []string {
+	names := make([]string, 0, len(bm.FileGroups))
+	for name := range bm.FileGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fileGroupReloader returns the reloader of the manager, with the reloaders
+// of the file groups added to it. The changed files which belong to a group
+// with a reloader are reloaded with it, the other files with the reloader of
+// the manager.
+func (bm *Manager) fileGroupReloader(reloader reloaders.Reloader) reloaders.Reloader {
+	var groups []reloaders.ReloaderGroup
+
+	for _, name := range bm.fileGroupNames() {
+		g := bm.FileGroups[name]
+		if g.Reloader == nil || len(g.files) == 0 {
+			continue
+		}
+		// the patterns match the whole dest path of the files, so that a
+		// file of the group is never mistaken for another file of the
+		// same name
+		var files []string
+		for _, f := range g.files {
+			files = append(files, strings.TrimPrefix(filepath.ToSlash(f), "/"))
+		}
+		groups = append(groups, reloaders.ReloaderGroup{Name: name, Files: files, Reloader: g.Reloader})
+	}
+	return reloaders.WithGroups(bm.Name, reloader, groups)
+}
+
+// fileGroup returns the file group the file, staged under the name relative
+// to the dest-path, belongs to, or nil when it does not belong to a group.
+func (bm *Manager) fileGroup(name string) *FileGroup {
+	for _, opts := range bm.ManagerOpts {
+		for _, f := range opts.groupFiles {
+			if f.name == name {
+				return f.group
+			}
+		}
+	}
+	return nil
+}
+
+// hasFileGroupValidators returns whether any of the file groups of the
+// manager has validators.
+func (bm *Manager) hasFileGroupValidators() bool {
+	for _, g := range bm.FileGroups {
+		if len(g.Validators) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrimaryConfig returns whether the manager has a primary config file,
+// which it does not when its repos only have file groups.
+func hasPrimaryConfig(opts map[string]*ManagerOpts) bool {
+	for _, o := range opts {
+		if len(o.PrimaryConfig) > 0 || len(o.FileGroups) == 0 {
+			return true
+		}
+	}
+	return len(opts) == 0
+}
+
+// groupFileGroup returns the file group the file of the repo belongs to, or
+// nil when it does not belong to a group.
+func (bmo *ManagerOpts) groupFileGroup(file string) *FileGroup {
+	for _, f := range bmo.groupFiles {
+		if f.file == file {
+			return f.group
+		}
+	}
+	return nil
+}
+
+// LocalName returns the name the downloaded file is staged under, which is
+// its path relative to the dest-path of the manager. The files of a merged
+// file group are staged under their own name until they are merged.
+func (bmo *ManagerOpts) LocalName(file string) string {
+	if g := bmo.groupFileGroup(file); g != nil && g.Merge != "" {
+		return file
+	}
+	return bmo.destName(file)
+}
+
+// destName returns the path, relative to the dest-path of the manager, the
+// file is installed to. It is the path of the file in the repo, unless the
+// file belongs to a file group, or has a manager.file-destinations entry.
+func (bmo *ManagerOpts) destName(file string) string {
+	for _, f := range bmo.groupFiles {
+		if f.file == file {
+			return f.name
+		}
+	}
+	if d, ok := bmo.FileDestinations[filepath.Clean(file)]; ok {
+		return d
+	}
+	return file
+}
+
+// mergeFileGroups merges the downloaded files of each merged file group, in
+// the order of the repos and of the files in the repos, into a single staged
+// file. A group whose files have not all been downloaded and validated is
+// left alone, since nothing gets copied then anyway.
+func (bm *Manager) mergeFileGroups(c *ConfigChanEvent) {
+	for _, name := range bm.fileGroupNames() {
+		g := bm.FileGroups[name]
+		if g.Merge == "" {
+			continue
+		}
+		var (
+			members []groupFile
+			repos   []string
+			tmps    []string
+		)
+		complete := true
+		for _, r := range bm.Repos {
+			opts, ok := bm.ManagerOpts[fmt.Sprintf("%s.%s", bm.Name, r)]
+			if !ok {
+				continue
+			}
+			for _, f := range opts.groupFiles {
+				if f.group != g {
+					continue
+				}
+				rfe, ok := c.Repo[opts.Repo]
+				// optional files which are not upstream are left out
+				if ok && rfe.Success[f.file] && rfe.Error[f.file] == errFileNotFound {
+					continue
+				}
+				if !ok || !rfe.Success[f.file] || rfe.TmpFile[f.file] == "" {
+					complete = false
+					continue
+				}
+				members = append(members, f)
+				repos = append(repos, opts.Repo)
+				tmps = append(tmps, rfe.TmpFile[f.file])
+			}
+		}
+		if !complete || len(members) == 0 {
+			continue
+		}
+
+		merged := g.localName("")
+		out, err := tempFile(os.TempDir(), "bcmsfile")
+		if err == nil {
+			err = concatFiles(out, tmps)
+		}
+		if err != nil {
+			log.Errorf("Manager::mergeFileGroups()[count=%v][manager=%v]: could not merge file group %v. err=%v", cmHandlerCounter, bm.Name, name, err.Error())
+			c.SetFailure(repos[0], merged, err)
+			continue
+		}
+		for i, f := range members {
+			delete(c.Repo[repos[i]].TmpFile, f.file)
+			removeTempFile(tmps[i])
+		}
+		c.SetSuccess(repos[0], merged, nil)
+		c.SetTmpFile(repos[0], merged, out.Name())
+	}
+}
+
+// concatFiles writes the files, in order, into out and closes it. out is
+// removed when they could not be written.
+func concatFiles(out *os.File, files []string) error {
+	var err error
+	for _, f := range files {
+		var in *os.File
+		if in, err = os.Open(f); err != nil {
+			break
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			break
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		removeTempFile(out.Name())
+	}
+	return err
+}
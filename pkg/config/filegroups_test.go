@@ -0,0 +1,116 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/adobe/butler/pkg/reloaders"
+
+	. "gopkg.in/check.v1"
+)
+
+func fileGroupsTestConfig(src string, dst string, replacements ...string) []byte {
+	s := fmt.Sprintf(`[globals]
+  config-managers = ["test-handler"]
+  scheduler-interval = 300
+  exit-on-config-failure = "false"
+  [test-handler]
+    repos = ["localhost"]
+    dest-path = "%s"
+    primary-config-name = "prometheus.yml"
+    disable-markers = "true"
+    [test-handler.file-groups.rules]
+      dest-path = "rules"
+      content-type = "text"
+      [test-handler.file-groups.rules.validator]
+        method = "exec"
+        [test-handler.file-groups.rules.validator.exec]
+          command = "/bin/true"
+      [test-handler.file-groups.rules.reloader]
+        method = "exec"
+        [test-handler.file-groups.rules.reloader.exec]
+          command = "/bin/true"
+    [test-handler.file-groups.alerts]
+      merge = "alerts.yml"
+      content-type = "text"
+    [test-handler.localhost]
+      method = "file"
+      repo-path = "%s"
+      [test-handler.localhost.file-groups]
+        rules = ["a.yml", "team/b.yml"]
+        alerts = ["c.yml", "d.yml"]
+`, dst, src)
+	return wrapConfig(strings.NewReplacer(replacements...).Replace(s))
+}
+
+func (s *ConfigTestSuite) TestFileGroups(c *C) {
+	src, err := ioutil.TempDir("/tmp", "bgroupsrc")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("/tmp", "bgroupdst")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dst)
+	c.Assert(os.MkdirAll(src+"/team", 0755), IsNil)
+	for f, data := range map[string]string{"a.yml": "a\n", "team/b.yml": "b\n", "c.yml": "c\n", "d.yml": "d\n"} {
+		c.Assert(ioutil.WriteFile(src+"/"+f, []byte(data), 0644), IsNil)
+	}
+
+	config := fileGroupsTestConfig(src, dst)
+	c.Assert(CheckConfig("butler.toml", config, "", true), IsNil)
+	settings := NewConfigSettings()
+	c.Assert(settings.parseConfig(config, "toml", nil, nil), IsNil)
+	m := settings.Managers["test-handler"]
+	opts := m.ManagerOpts["test-handler.localhost"]
+	c.Assert(opts.GetAdditionalRemoteConfigFiles(), DeepEquals, []string{"c.yml", "d.yml", "a.yml", "team/b.yml"})
+	c.Assert(opts.GetAdditionalLocalConfigFiles(), DeepEquals, []string{dst + "/alerts.yml", dst + "/rules/a.yml", dst + "/rules/team/b.yml"})
+	c.Assert(opts.GetContentType("a.yml"), Equals, "text")
+	c.Assert(settings.GetAllConfigLocalPaths("test-handler"), HasLen, 3)
+	c.Assert(m.FileGroups["rules"].Validators, HasLen, 1)
+
+	// the files of the rules group are reloaded with its own reloader
+	r, ok := m.Reloader.(reloaders.GroupReloader)
+	c.Assert(ok, Equals, true)
+	c.Assert(r.Opts.Default, IsNil)
+	c.Assert(r.Opts.Groups, HasLen, 1)
+	c.Assert(r.Opts.Groups[0].Match(dst+"/rules/team/b.yml"), Equals, true)
+	c.Assert(r.Opts.Groups[0].Match(dst+"/alerts.yml"), Equals, false)
+
+	// the files are installed underneath the dest-path of their group, and
+	// the files of a merged group are merged in order
+	ch := make(chan ChanEvent, 1)
+	c.Assert(m.DownloadAdditionalConfigFiles(context.Background(), ch), IsNil)
+	additional := <-ch
+	c.Assert(additional.CanCopyFiles(), Equals, true)
+	c.Assert(m.ValidateStagedFiles(nil, additional), IsNil)
+	c.Assert(additional.CopyAdditionalConfigFiles(m.DestPath), Equals, true)
+	additional.CleanTmpFiles()
+	for f, data := range map[string]string{"rules/a.yml": "a\n", "rules/team/b.yml": "b\n", "alerts.yml": "c\nd\n"} {
+		got, err := ioutil.ReadFile(dst + "/" + f)
+		c.Assert(err, IsNil)
+		c.Assert(string(got), Equals, data)
+	}
+	_, err = os.Stat(dst + "/c.yml")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// the repos need either a primary-config or file-groups
+	c.Assert(CheckConfig("butler.toml", fileGroupsTestConfig(src, dst, "[test-handler.localhost.file-groups]", "[test-handler.localhost.other]"), "", false), ErrorMatches, "(?s).*no manager.primary-config or manager.file-groups defined.*")
+	c.Assert(CheckConfig("butler.toml", fileGroupsTestConfig(src, dst, "alerts = [", "other = ["), "", false), ErrorMatches, "(?s).*unknown file group other for repo localhost.*")
+	c.Assert(CheckConfig("butler.toml", fileGroupsTestConfig(src, dst, `dest-path = "rules"`, `dest-path = "../rules"`), "", false), ErrorMatches, "(?s).*invalid file-groups.rules.dest-path.*")
+	c.Assert(CheckConfig("butler.toml", fileGroupsTestConfig(src, dst, "merge = \"alerts.yml\"\n      content-type = \"text\"", "merge = \"alerts.yml\"\n      content-type = \"binary\""), "", false), ErrorMatches, "(?s).*file-groups.alerts can not be merged.*")
+	c.Assert(CheckConfig("butler.toml", fileGroupsTestConfig(src, dst, "merge =", "merged ="), "", true), ErrorMatches, "(?s).*unknown key test-handler.file-groups.alerts.merged.*")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ConfigFormats are the formats the butler configuration can be
+	// written in.
+	ConfigFormats = []string{"toml", "yaml", "json"}
+)
+
+// ConfigFormat returns the format of a butler configuration: the one the
+// extension of its name says, or else the one its content looks like. JSON
+// starts with a brace, and TOML is tried before YAML. Anything else is taken
+// to be TOML, so that its parse error is the familiar one.
+func ConfigFormat(name string, config []byte) string {
+	switch path.Ext(strings.ToLower(name)) {
+	case ".toml":
+		return "toml"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+
+	data := stripConfigHeaderFooter(config)
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return "json"
+	}
+	if _, err := toml.LoadBytes(data); err == nil {
+		return "toml"
+	}
+	var v map[string]interface{}
+	if err := yaml.Unmarshal(data, &v); err == nil && len(v) > 0 {
+		return "yaml"
+	}
+	return "toml"
+}
+
+func isValidConfigFormat(format string) bool {
+	for _, f := range ConfigFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// stripConfigHeaderFooter returns the butler configuration without its header
+// and footer lines, which are comments in TOML and YAML, but not in JSON.
+func stripConfigHeaderFooter(config []byte) []byte {
+	var res []byte
+	for _, line := range bytes.SplitAfter(config, []byte("\n")) {
+		if !checkButlerHeaderFooter(bytes.TrimRight(line, "\r\n"), butlerHeader, butlerFooter) {
+			res = append(res, line...)
+		}
+	}
+	return res
+}
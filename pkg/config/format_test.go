@@ -0,0 +1,138 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+var TestConfigCompleteEnvironmentYAML = []byte(`globals:
+  config-managers: ["test-handler"]
+  scheduler-interval: 300
+  exit-on-config-failure: "false"
+  status-file: "/var/tmp/butler.status"
+test-handler:
+  repos: ["localhost"]
+  clean-files: "true"
+  mustache-subs: ["foo=env:MSUB"]
+  enable-cache: "false"
+  cache-path: "/opt/cache/prometheus"
+  dest-path: "/opt/prometheus"
+  primary-config-name: "prometheus.yml"
+  localhost:
+    method: "http"
+    repo-path: "/butler/configs"
+    primary-config: ["test.yml"]
+    additional-config: ["test-add.yml"]
+    http:
+      retries: "5"
+      retry-wait-min: "5"
+      retry-wait-max: "10"
+      timeout: "10"
+  reloader:
+    method: "http"
+    http:
+      host: "env:RELOADER_HOST"
+      port: "9090"
+      uri: "/-/reload"
+      method: "post"
+      payload: "{}"
+      content-type: "application/json"
+      # retry info and timeouts
+      retries: "5"
+      retry-wait-min: "5"
+      retry-wait-max: "10"
+      timeout: "10"
+`)
+
+var TestConfigCompleteEnvironmentJSON = []byte(`{
+  "globals": {
+    "config-managers": ["test-handler"],
+    "scheduler-interval": 300,
+    "exit-on-config-failure": "false",
+    "status-file": "/var/tmp/butler.status"
+  },
+  "test-handler": {
+    "repos": ["localhost"],
+    "clean-files": "true",
+    "mustache-subs": ["foo=env:MSUB"],
+    "enable-cache": "false",
+    "cache-path": "/opt/cache/prometheus",
+    "dest-path": "/opt/prometheus",
+    "primary-config-name": "prometheus.yml",
+    "localhost": {
+      "method": "http",
+      "repo-path": "/butler/configs",
+      "primary-config": ["test.yml"],
+      "additional-config": ["test-add.yml"],
+      "http": {"retries": "5", "retry-wait-min": "5", "retry-wait-max": "10", "timeout": "10"}
+    },
+    "reloader": {
+      "method": "http",
+      "http": {
+        "host": "env:RELOADER_HOST",
+        "port": "9090",
+        "uri": "/-/reload",
+        "method": "post",
+        "payload": "{}",
+        "content-type": "application/json",
+        "retries": "5",
+        "retry-wait-min": "5",
+        "retry-wait-max": "10",
+        "timeout": "10"
+      }
+    }
+  }
+}
+`)
+
+func (s *ConfigTestSuite) TestConfigFormat(c *C) {
+	wrap := func(config []byte) []byte {
+		return append(append([]byte("#butlerstart\n"), config...), []byte("#butlerend\n")...)
+	}
+	// the extension wins over the content
+	c.Assert(ConfigFormat("/etc/butler/butler.toml", TestConfigCompleteEnvironmentYAML), Equals, "toml")
+	c.Assert(ConfigFormat("/etc/butler/butler.yaml", TestConfigCompleteEnvironment), Equals, "yaml")
+	c.Assert(ConfigFormat("/etc/butler/butler.YML", nil), Equals, "yaml")
+	c.Assert(ConfigFormat("/etc/butler/butler.json", nil), Equals, "json")
+
+	c.Assert(ConfigFormat("/butler/config", wrap(TestConfigCompleteEnvironment)), Equals, "toml")
+	c.Assert(ConfigFormat("/butler/config", wrap(TestConfigCompleteEnvironmentYAML)), Equals, "yaml")
+	c.Assert(ConfigFormat("/butler/config", wrap(TestConfigCompleteEnvironmentJSON)), Equals, "json")
+	c.Assert(ConfigFormat("", []byte("[globals")), Equals, "toml")
+}
+
+func (s *ConfigTestSuite) TestParseConfigFormats(c *C) {
+	wrap := func(config []byte) []byte {
+		return append(append([]byte("#butlerstart\n"), config...), []byte("#butlerend\n")...)
+	}
+	expected := NewConfigSettings()
+	c.Assert(expected.ParseConfig(wrap(TestConfigCompleteEnvironment)), IsNil)
+	// the managers hold http clients, whose retry policies are funcs, so
+	// they are compared by their encoding
+	expectedManagers, _ := json.Marshal(expected.Managers)
+
+	for _, config := range [][]byte{TestConfigCompleteEnvironmentYAML, TestConfigCompleteEnvironmentJSON} {
+		settings := NewConfigSettings()
+		c.Assert(settings.ParseConfig(wrap(config)), IsNil)
+		c.Assert(settings.Globals, DeepEquals, expected.Globals)
+		managers, _ := json.Marshal(settings.Managers)
+		c.Assert(string(managers), Equals, string(expectedManagers))
+	}
+
+	c.Assert(CheckConfig("butler.json", wrap(TestConfigCompleteEnvironmentJSON), "", false), IsNil)
+	c.Assert(CheckConfig("butler.json", wrap(TestConfigCompleteEnvironmentYAML), "", false), NotNil)
+	c.Assert(NewConfigSettings().ParseConfigFormat(TestConfigCompleteEnvironment, "hcl"), ErrorMatches, "unknown butler configuration format hcl")
+}
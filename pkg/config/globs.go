@@ -0,0 +1,113 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// isGlob returns true if the additional-config entry is a pattern, rather
+// than a file.
+func isGlob(file string) bool {
+	return strings.ContainsAny(file, "*?[")
+}
+
+// globDir returns the directory to list for the pattern, which is made of its
+// leading path elements without any wildcards.
+func globDir(pattern string) string {
+	var dir []string
+	for _, p := range strings.Split(pattern, "/") {
+		if isGlob(p) {
+			break
+		}
+		dir = append(dir, p)
+	}
+	return strings.Join(dir, "/")
+}
+
+// RefreshGlobs lists the files matching the additional-config patterns of the
+// repository, and makes them part of the additional config files of the
+// manager until the next refresh. A pattern matching nothing is not an error,
+// since the files may not have been added upstream yet.
+func (bmo *ManagerOpts) RefreshGlobs() error {
+	var globbed []string
+
+	if len(bmo.AdditionalGlobs) == 0 {
+		return nil
+	}
+
+	lister, ok := bmo.Opts.(methods.Lister)
+	if !ok {
+		bmo.GlobbedConfig = nil
+		return fmt.Errorf("repository method %v does not support additional-config patterns", bmo.Method)
+	}
+
+	known := make(map[string]bool)
+	for _, f := range bmo.AdditionalConfig {
+		known[f] = true
+	}
+	for _, f := range bmo.PrimaryConfig {
+		known[f] = true
+	}
+	for _, f := range bmo.groupFiles {
+		known[f.file] = true
+	}
+
+	listed := make(map[string][]string)
+	for _, pattern := range bmo.AdditionalGlobs {
+		dir := globDir(pattern)
+		files, ok := listed[dir]
+		if !ok {
+			u, err := bmo.RemoteURL(strings.TrimSuffix(fmt.Sprintf("%s/%s", bmo.baseRemotePath, dir), "/"))
+			if err != nil {
+				bmo.GlobbedConfig = nil
+				return err
+			}
+			files, err = lister.List(u)
+			if err != nil {
+				bmo.GlobbedConfig = nil
+				return fmt.Errorf("could not list additional-config pattern %v. err=%v", pattern, err.Error())
+			}
+			listed[dir] = files
+		}
+		matched := 0
+		for _, f := range files {
+			name := f
+			if dir != "" {
+				name = path.Join(dir, f)
+			}
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+			matched++
+			if known[name] {
+				continue
+			}
+			known[name] = true
+			globbed = append(globbed, name)
+		}
+		if matched == 0 {
+			log.Warnf("ManagerOpts::RefreshGlobs()[count=%v][manager=%v]: additional-config pattern %v does not match any file.", cmHandlerCounter, bmo.parentManager, pattern)
+		}
+	}
+	sort.Strings(globbed)
+	bmo.GlobbedConfig = globbed
+	return nil
+}
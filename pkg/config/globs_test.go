@@ -0,0 +1,59 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestGlobs(c *C) {
+	src, err := ioutil.TempDir("/tmp", "bglobsrc")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(src)
+
+	c.Assert(os.MkdirAll(src+"/rules/team", 0755), IsNil)
+	for _, f := range []string{"/rules/a.rules", "/rules/b.rules", "/rules/c.yml", "/rules/team/d.rules", "/top.rules"} {
+		c.Assert(ioutil.WriteFile(src+f, []byte("x"), 0644), IsNil)
+	}
+
+	c.Assert(isGlob("rules/*.rules"), Equals, true)
+	c.Assert(isGlob("rules/a.rules"), Equals, false)
+	c.Assert(globDir("rules/*/x.rules"), Equals, "rules")
+	c.Assert(globDir("*.rules"), Equals, "")
+
+	method, err := methods.NewFileMethod(nil, nil)
+	c.Assert(err, IsNil)
+	opts := &ManagerOpts{Method: "file", Repo: "localhost", Opts: method, AdditionalConfig: []string{"rules/a.rules"},
+		AdditionalGlobs: []string{"rules/*.rules", "rules/*/*.rules", "*.rules", "rules/*.json"}}
+	opts.SetBasePaths("file://localhost"+src, "/opt/dest")
+	c.Assert(opts.RefreshGlobs(), IsNil)
+	// the files which are configured explicitly are not repeated
+	c.Assert(opts.GlobbedConfig, DeepEquals, []string{"rules/b.rules", "rules/team/d.rules", "top.rules"})
+	c.Assert(opts.GetAdditionalRemoteConfigFiles(), DeepEquals, []string{"rules/a.rules", "rules/b.rules", "rules/team/d.rules", "top.rules"})
+	c.Assert(opts.GetAdditionalLocalConfigFiles(), DeepEquals, []string{"/opt/dest/rules/b.rules", "/opt/dest/rules/team/d.rules", "/opt/dest/top.rules"})
+
+	// new files are picked up on the next refresh
+	c.Assert(ioutil.WriteFile(src+"/rules/e.rules", []byte("x"), 0644), IsNil)
+	c.Assert(opts.RefreshGlobs(), IsNil)
+	c.Assert(opts.GlobbedConfig, DeepEquals, []string{"rules/b.rules", "rules/e.rules", "rules/team/d.rules", "top.rules"})
+
+	// methods which can not list do not support patterns
+	opts.Opts = nil
+	c.Assert(opts.RefreshGlobs(), ErrorMatches, ".*does not support additional-config patterns")
+	c.Assert(opts.GlobbedConfig, IsNil)
+}
@@ -0,0 +1,1102 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/logging"
+	"github.com/adobe/butler/internal/metrics"
+	"github.com/adobe/butler/internal/redact"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/internal/tracing"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ButlerConfig struct {
+	url                *url.URL
+	Client             *ConfigClient
+	Config             *ConfigSettings
+	FirstRun           bool
+	LogLevel           log.Level
+	Interval           int
+	Timeout            int
+	RawConfig          []byte
+	Scheduler          *scheduler.Scheduler
+	InsecureSkipVerify bool
+	MethodOpts         methods.MethodOpts
+	// skipReload copies the configuration files into place without
+	// reloading the managers, see Fetch.
+	skipReload bool
+	// defaults is the path of the local defaults which the butler
+	// configuration overlays, if any.
+	defaults string
+	// strict parses the butler configuration strictly, see
+	// ConfigSettings.Strict.
+	strict bool
+	// readiness tracks the start up of butler, see Ready.
+	readiness readiness
+	// bootstrap is the path of the copy of the last butler configuration
+	// which was parsed, if any, and bootstrapped whether butler runs on it.
+	bootstrap    string
+	bootstrapped bool
+	// methodOptions is the path of the options of the method of the butler
+	// configuration, if any, see newConfigMethod.
+	methodOptions string
+	// repoWatch are the watches of the repos of the managers, once butler
+	// watches them, see WatchRepos.
+	repoWatch *repoWatches
+}
+
+// The names of the scheduler jobs which retrieve the butler configuration,
+// run the configuration management, and report it.
+const (
+	ConfigJob        = "butler-config"
+	CMHandlerJob     = "cm-handler"
+	ManagerJobPrefix = "manager:"
+	ReportJob        = "report"
+)
+
+var (
+	handlerCounter   = 0
+	cmHandlerCounter = 0
+	// cmHandlerLock serializes RunCMHandler runs with the admin operations
+	// which touch the manager files, such as Rollback.
+	cmHandlerLock sync.Mutex
+	// handlerLock serializes the retrievals of the butler configuration,
+	// which are scheduled, and triggered by changes to a watched file or by
+	// a SIGHUP.
+	handlerLock sync.Mutex
+)
+
+func (bc *ButlerConfig) SetScheme(s string) error {
+	var (
+		res error
+	)
+	scheme := strings.ToLower(s)
+	if !IsValidScheme(scheme) {
+		errMsg := fmt.Sprintf("%s is an invalid scheme", scheme)
+		log.Errorf("Config::SetScheme(): %s is an invalid scheme", scheme)
+		res = errors.New(errMsg)
+	} else {
+		log.Debugf("Config::SetScheme(): setting bc.Scheme=%s", scheme)
+		bc.url.Scheme = scheme
+	}
+	return res
+}
+
+func (bc *ButlerConfig) Scheme() string {
+	return bc.url.Scheme
+}
+
+func (bc *ButlerConfig) SetPath(p string) error {
+	newPath := filepath.Clean(p)
+	log.Debugf("Config::SetPath(): setting bc.Path=%s", newPath)
+	bc.url.Path = newPath
+	return nil
+}
+
+func (bc *ButlerConfig) SetMethodOpts(opts methods.MethodOpts) error {
+	bc.MethodOpts = opts
+	return nil
+}
+
+func (bc *ButlerConfig) Path() string {
+	return bc.url.Path
+}
+
+func (bc *ButlerConfig) Host() string {
+	return bc.url.Host
+}
+
+func (bc *ButlerConfig) URL() *url.URL {
+	return bc.url
+}
+
+func (bc *ButlerConfig) SetURL(u *url.URL) {
+	bc.url = u
+}
+
+func (bc *ButlerConfig) Opts() methods.MethodOpts {
+	return bc.MethodOpts
+}
+
+func (bc *ButlerConfig) SetInterval(t int) error {
+	log.Debugf("Config::SetInterval(): setting bc.Interval=%v", t)
+	bc.Interval = t
+	return nil
+}
+
+func (bc *ButlerConfig) GetCMInterval() int {
+	return bc.Config.Globals.SchedulerInterval
+}
+
+func (bc *ButlerConfig) SetCMInterval(i int) error {
+	bc.Config.Globals.SchedulerInterval = i
+	return nil
+}
+
+func (bc *ButlerConfig) GetInterval() int {
+	return bc.Interval
+}
+
+func (bc *ButlerConfig) SetTimeout(t int) error {
+	log.Debugf("Config::SetTimeout(): setting bc.Timeout=%v", t)
+	bc.Timeout = t
+	return nil
+}
+
+func (bc *ButlerConfig) SetLogLevel(level log.Level) {
+	log.SetLevel(level)
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	bc.LogLevel = level
+	log.Debugf("Config::SetLogLevel(): setting log level to %s", level)
+}
+
+func (bc *ButlerConfig) GetLogLevel() log.Level {
+	return bc.LogLevel
+}
+
+func (bc *ButlerConfig) Init() error {
+	log.Infof("Config::Init(): initializing butler config.")
+	var err error
+
+	client, err := NewConfigClient(bc)
+	if err != nil {
+		log.Errorf("Config::Init(): could not initialize butler config. err=%s", err.Error())
+		return err
+	}
+
+	bc.Client = client
+	bc.Config = NewConfigSettings()
+	bc.Config.Strict = bc.strict
+
+	log.Infof("Config::Init(): butler config initialized.")
+	return nil
+}
+
+func (bc *ButlerConfig) Handler() (err error) {
+	handlerLock.Lock()
+	defer handlerLock.Unlock()
+	// butler starts up on the bootstrap copy of the butler configuration
+	// when it cannot retrieve it
+	defer func() {
+		if re, ok := err.(*RunError); ok && re.Stage == StageDownload && bc.RawConfig == nil && bc.bootstrap != "" {
+			if berr := bc.loadBootstrap(); berr != nil {
+				log.Errorf("ButlerConfig::Handler(): Cannot load the bootstrap butler configuration. err=%s", berr.Error())
+				return
+			}
+			err = nil
+		}
+	}()
+	log.Infof("ButlerConfig::Handler()[count=%v]: entering.", handlerCounter)
+	_, span := tracing.Start(context.Background(), "butler.config", tracing.String("butler.config.url", RedactURL(bc.URL().String())))
+	defer func() { span.End(err) }()
+	response, err := bc.Client.Get(bc.URL())
+
+	if err != nil {
+		log.Errorf("ButlerConfig::Handler()[count=%v]: Cannot retrieve butler configuration. err=%s", handlerCounter, err.Error())
+		log.Errorf("ButlerConfig::Handler()[count=%v]: done.", handlerCounter)
+		handlerCounter++
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		return &RunError{Stage: StageDownload, Err: err}
+	}
+	defer response.GetResponseBody().Close()
+
+	if response.GetResponseStatusCode() != 200 {
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		log.Errorf("ButlerConfig::Handler()[count=%v]: Did not receive 200 response code for %s. code=%d", handlerCounter, bc.URL().String(), response.GetResponseStatusCode())
+		log.Errorf("ButlerConfig::Handler()[count=%v] done.", handlerCounter)
+		handlerCounter++
+		errMsg := fmt.Sprintf("Did not receive 200 response code for %s. code=%d", bc.URL().String(), response.GetResponseStatusCode())
+		return &RunError{Stage: StageDownload, Err: errors.New(errMsg)}
+	}
+
+	body, err := ioutil.ReadAll(response.GetResponseBody())
+	if err != nil {
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		log.Errorf("ButlerConfig::Handler()[count=%v]: Could not read response body for %s. err=%s", handlerCounter, bc.URL().String(), err)
+		log.Errorf("ButlerConfig::Handler()[count=%v] done.", handlerCounter)
+		handlerCounter++
+		errMsg := fmt.Sprintf("Could not read response body for %s. err=%s", bc.URL().String(), err)
+		return &RunError{Stage: StageDownload, Err: errors.New(errMsg)}
+	}
+
+	err = ValidateConfig(NewValidateOpts().WithData(body).WithFileName(bc.Path()).WithManager("butler-config"))
+	if err != nil {
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		return &RunError{Stage: StageValidation, Err: err}
+	}
+
+	// The butler configuration may overlay local defaults, which are read
+	// again on every run.
+	defaults, err := readDefaults(bc.defaults)
+	if err != nil {
+		log.Errorf("ButlerConfig::Handler()[count=%v]: Cannot read butler configuration defaults. err=%s", handlerCounter, err.Error())
+		handlerCounter++
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		return &RunError{Stage: StageDownload, Err: err}
+	}
+	sources := []configFragment{{Name: bc.Path(), Data: body}}
+	if defaults != nil {
+		sources = append(sources, *defaults)
+	}
+	config, format, err := overlayConfig(defaults, body, ConfigFormat(bc.Path(), body))
+	if err != nil {
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		return &RunError{Stage: StageValidation, Err: err}
+	}
+
+	var dir string
+	if bc.Scheme() == "file" {
+		dir = filepath.Dir(filepath.Clean(bc.Host() + bc.Path()))
+	}
+	fragments, err := includeFragments(config, format, dir, bc.Client)
+	if err != nil {
+		log.Errorf("ButlerConfig::Handler()[count=%v]: Cannot retrieve butler configuration includes. err=%s", handlerCounter, err.Error())
+		handlerCounter++
+		metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+		// an include which could be retrieved, but is invalid, keeps its
+		// validation stage
+		if runErr, ok := err.(*RunError); ok {
+			return runErr
+		}
+		return &RunError{Stage: StageDownload, Err: err}
+	}
+	raw := rawConfig(config, fragments)
+	span.SetAttributes(tracing.String("butler.config.version", contentVersion(raw)))
+
+	if bc.RawConfig == nil {
+		err := bc.Config.parseConfig(config, format, fragments, sources)
+		if err != nil {
+			if bc.Config.Globals.ExitOnFailure {
+				log.Fatal(err)
+			} else {
+				metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+				return &RunError{Stage: StageValidation, Err: err}
+			}
+		} else {
+			log.Debugf("ButlerConfig::Handler()[count=%v]: bc.RawConfig is nil. Filling it up.", handlerCounter)
+			bc.RawConfig = raw
+			bc.saveBootstrap(config, format, fragments, sources)
+		}
+	}
+
+	if !bytes.Equal(bc.RawConfig, raw) {
+		err := bc.Config.parseConfig(config, format, fragments, sources)
+		if err != nil {
+			if bc.Config.Globals.ExitOnFailure {
+				log.Fatal(err)
+			} else {
+				metrics.SetButlerContactVal(metrics.FAILURE, bc.Host(), bc.Path())
+				return &RunError{Stage: StageValidation, Err: err}
+			}
+		} else {
+			log.Infof("ButlerConfig::Handler()[count=%v]: butler config has changed. updating.", handlerCounter)
+			bc.RawConfig = raw
+			bc.saveBootstrap(config, format, fragments, sources)
+		}
+	} else {
+		if !bc.FirstRun {
+			log.Infof("ButlerConfig::Handler()[count=%v]: butler config unchanged.", handlerCounter)
+		}
+	}
+
+	if bc.FirstRun {
+		bc.FirstRun = false
+		bc.readiness.set(&bc.readiness.loaded)
+	}
+	if bc.bootstrapped {
+		log.Infof("ButlerConfig::Handler()[count=%v]: retrieved the butler configuration, no longer running on the bootstrap copy.", handlerCounter)
+		bc.bootstrapped = false
+		metrics.SetButlerConfigBootstrapVal(metrics.FAILURE, bc.Host(), bc.Path())
+	}
+	// The scheduling of the managers, the watches of their repos, and the
+	// logging, may have changed in the butler configuration. There is no
+	// scheduler yet on the initial run.
+	bc.UpdateSchedules()
+	bc.UpdateRepoWatches()
+	bc.UpdateLogging()
+	metrics.SetButlerContactVal(metrics.SUCCESS, bc.Host(), bc.Path())
+	log.Infof("ButlerConfig::Handler()[count=%v]: done.", handlerCounter)
+	handlerCounter++
+	return nil
+}
+
+func (bc *ButlerConfig) SetScheduler(s *scheduler.Scheduler) error {
+	log.Debugf("Config::SetScheduler(): entering")
+	bc.Scheduler = s
+	return nil
+}
+
+// UpdateSchedules brings the configuration management jobs of the scheduler
+// in line with the butler configuration. The managers which have a schedule
+// of their own run on it, and the others on the globals schedule. The
+// managers are reported every globals.report-interval, when there is a
+// globals.report-url.
+func (bc *ButlerConfig) UpdateSchedules() {
+	if bc.Scheduler == nil {
+		return
+	}
+	sched := bc.Config.Globals.Schedule
+	if sched == nil {
+		sched = scheduler.Every(time.Duration(bc.GetCMInterval()) * time.Second)
+	}
+	if bc.Scheduler.Add(CMHandlerJob, sched, bc.runScheduledCMHandler) {
+		log.Infof("Config::UpdateSchedules(): running configuration management %v", sched)
+	}
+
+	jobs := make(map[string]bool)
+	for name, m := range bc.GetManagers() {
+		if m.Schedule == nil {
+			continue
+		}
+		job := ManagerJobPrefix + name
+		jobs[job] = true
+		only := map[string]bool{name: true}
+		if bc.Scheduler.Add(job, m.Schedule, func(ctx context.Context) { bc.runCMHandler(ctx, only) }) {
+			log.Infof("Config::UpdateSchedules()[manager=%v]: running configuration management %v", name, m.Schedule)
+		}
+	}
+	for _, job := range bc.Scheduler.Jobs() {
+		if strings.HasPrefix(job, ManagerJobPrefix) && !jobs[job] {
+			bc.Scheduler.Remove(job)
+		}
+	}
+
+	g := bc.Config.Globals
+	if g.ReportURL == "" {
+		bc.Scheduler.Remove(ReportJob)
+		return
+	}
+	report := scheduler.Every(time.Duration(g.ReportInterval) * time.Second)
+	if bc.Scheduler.Add(ReportJob, report, func(ctx context.Context) { bc.runReport(ctx, g) }) {
+		log.Infof("Config::UpdateSchedules(): reporting the managers %v", report)
+	}
+}
+
+// UpdateLogging logs in the globals.log-format, when there is one, at the
+// globals.log-levels of the components, and to the globals.log-file and
+// globals.log-syslog besides stderr. The globals.redact patterns are masked
+// out of the logs, and diffs, from then on.
+func (bc *ButlerConfig) UpdateLogging() {
+	g := bc.Config.Globals
+	err := redact.SetPatterns(g.Redact)
+	if err != nil {
+		log.Errorf("Config::UpdateLogging(): could not update the redact patterns. err=%v", err.Error())
+	}
+	levels, err := logging.ParseLevels(g.LogLevels)
+	if err == nil {
+		err = logging.Update(g.LogFormat, levels)
+	}
+	if err == nil {
+		outputs := logging.OutputOpts{Syslog: g.LogSyslog}
+		if g.LogFile != "" {
+			outputs.File = g.LogFile
+			outputs.FileMaxSize = int64(g.LogFileMaxSize) * 1024 * 1024
+			outputs.FileMaxAge = time.Duration(g.LogFileMaxAge) * time.Hour
+			outputs.FileMaxBackups = g.LogFileMaxBackups
+		}
+		err = logging.SetOutputs(outputs)
+	}
+	if err != nil {
+		log.Errorf("Config::UpdateLogging(): could not update the logging. err=%v", err.Error())
+	}
+}
+
+// runScheduledCMHandler runs the configuration management of the managers
+// which run on the globals schedule.
+func (bc *ButlerConfig) runScheduledCMHandler(ctx context.Context) {
+	only := make(map[string]bool)
+	for name, m := range bc.GetManagers() {
+		if m.Schedule == nil {
+			only[name] = true
+		}
+	}
+	if len(only) > 0 {
+		bc.runCMHandler(ctx, only)
+	}
+}
+
+func (bc *ButlerConfig) RunCMHandler() error {
+	bc.runCMHandler(context.Background(), nil)
+	return nil
+}
+
+// RunManager runs the configuration management of a single manager right
+// away, instead of waiting for the next scheduled run. The run is serialized
+// with the scheduled runs, and bypasses the breaker of the manager, and the
+// canary managers which hold back its changes.
+func (bc *ButlerConfig) RunManager(name string) error {
+	if bc.GetManager(name) == nil {
+		return fmt.Errorf("unknown manager %v", name)
+	}
+	if GetManagerPaused(bc.GetStatusFile(), name) != nil {
+		return fmt.Errorf("manager %v is paused", name)
+	}
+	bc.runCMHandler(withForceRun(context.Background()), map[string]bool{name: true})
+	return nil
+}
+
+// runCMHandler runs the configuration management of the managers in only,
+// or of every manager when only is nil. Once ctx is cancelled no further
+// managers are processed, but the managers whose files have already been
+// copied are still reloaded. A butler which is not the leader among those
+// which share the destination does not process any manager, and one which
+// loses the lead during the run stops copying files. The managers are run
+// after the managers they depend on, and are skipped when one of those
+// failed. Up to the globals parallel-managers managers are processed at a
+// time. It returns the managers which failed.
+func (bc *ButlerConfig) runCMHandler(ctx context.Context, only map[string]bool) []*RunError {
+	var (
+		ReloadManager []string
+		failed        []*RunError
+		ran           []string
+	)
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+	ctx, span := tracing.Start(ctx, "butler.run", tracing.Int("butler.run.count", cmHandlerCounter))
+	// the lines logged during the run carry its id, which is its trace id
+	// when it is traced
+	runID := span.TraceIDString()
+	if runID == "" {
+		runID = logging.NewRunID()
+	}
+	logging.SetRunID(runID)
+	defer logging.SetRunID("")
+	log.Infof("Config::RunCMHandler()[count=%v]: entering.", cmHandlerCounter)
+	// only the leader among the butlers which share the destination copies
+	// files and reloads the managers
+	token, leads := leading(ctx)
+	if !leads {
+		log.Infof("Config::RunCMHandler()[count=%v]: not the leader, skipping.", cmHandlerCounter)
+		bc.readiness.set(&bc.readiness.attempted)
+		cmHandlerCounter++
+		return failed
+	}
+	// the managers which list the same url download it once per run
+	startSharedDownloads()
+	defer endSharedDownloads()
+	// the span of each manager ends along with the run, once the manager has
+	// been reloaded
+	spans := make(map[string]*tracing.Span)
+	defer func() {
+		for name, s := range spans {
+			s.End(RunErrors(failed).For(name))
+		}
+		if len(failed) > 0 {
+			span.End(RunErrors(failed))
+		} else {
+			span.End(nil)
+		}
+	}()
+
+	// the managers whose directories could not be created are skipped
+	var broken RunErrors
+	if err := bc.CheckPaths(); err != nil {
+		broken, _ = err.(RunErrors)
+	}
+
+	results := bc.runManagers(ctx, runOrder(bc.GetManagers()), only, func(m *Manager, failed RunErrors, ran []string) *managerRun {
+		return bc.processManager(ctx, m, token, broken, blockingDependency(m, failed, ran, false))
+	})
+	for _, r := range results {
+		if r.span != nil {
+			spans[r.manager.Name] = r.span
+		}
+		if r.ran {
+			ran = append(ran, r.manager.Name)
+		}
+		if r.reload {
+			ReloadManager = append(ReloadManager, r.manager.Name)
+		}
+		failed = append(failed, r.failed...)
+	}
+
+	if len(ReloadManager) == 0 {
+		log.Infof("Config::RunCMHandler()[count=%v]: CM files unchanged.", cmHandlerCounter)
+		// We are going to run through the managers and ensure that the status file
+		// is in an OK state for the manager. If it is not, then we will attempt a reload
+		for _, m := range runOrder(bc.GetManagers()) {
+			if ctx.Err() != nil {
+				break
+			}
+			if only != nil && !only[m.Name] {
+				continue
+			}
+			if GetManagerPaused(bc.GetStatusFile(), m.Name) != nil {
+				continue
+			}
+			if _, open := m.BreakerEnd(time.Now()); open && !isForceRun(ctx) {
+				continue
+			}
+			metrics.SetButlerRepoInSync(metrics.SUCCESS, m.Name)
+			if _, blocked := m.BlackoutEnd(time.Now()); blocked {
+				continue
+			}
+			if bc.skipReload {
+				continue
+			}
+			if _, ok := pendingReloads[m.Name]; ok {
+				log.Debugf("Config::RunCMHandler()[count=%v][manager=%v]: reload is pending, not checking the manager status.", cmHandlerCounter, m.Name)
+				continue
+			}
+			if !GetManagerStatus(bc.GetStatusFile(), m.Name) {
+				log.Debugf("Config::RunCMHandler()[count=%v]: Could not find manager status. Going to reload to get in sync.", cmHandlerCounter)
+				if dep := blockingDependency(m, failed, ran, true); dep != "" {
+					log.Warnf("Config::RunCMHandler()[count=%v][manager=%v]: dependency %v has not reloaded, not reloading.", cmHandlerCounter, m.Name, dep)
+					continue
+				}
+				release, err := acquireReloadSlot(m.Name)
+				if err != nil {
+					log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: not reloading. err=%v", cmHandlerCounter, m.Name, err.Error())
+					failed = append(failed, &RunError{Manager: m.Name, Stage: StageReload, Err: err})
+					continue
+				}
+				err = m.Reload()
+				if err != nil {
+					switch e := err.(type) {
+					case *reloaders.ReloaderError:
+						// an http timeout is 1
+						log.Debugf("Config::RunCMHandler()[count=%v]: e.Code=%#v, m.ManagerTimeoutOk=%#v", cmHandlerCounter, e.Code, m.ManagerTimeoutOk)
+						if e.Code == 1 && m.ManagerTimeoutOk == true {
+							// we really don't care about here
+							// let's make sure we at least delete our metrics
+							metrics.DeleteButlerReloadVal(m.Name)
+						} else {
+							log.Errorf("Config::RunCMHandler()[count=%v]: err=%#v", cmHandlerCounter, err)
+							if err := bc.recordStatus(m.Name, StatusFailed, "", e); err != nil {
+								log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, m.Name, bc.GetStatusFile(), err.Error())
+							}
+							metrics.SetButlerReloadVal(metrics.FAILURE, m.Name)
+							failed = append(failed, &RunError{Manager: m.Name, Stage: StageReload, Err: e})
+							bc.RestoreAndReload(m)
+						}
+					}
+				} else {
+					if err := bc.recordStatus(m.Name, StatusOK, m.ConfigVersion(), nil); err != nil {
+						log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, m.Name, bc.GetStatusFile(), err.Error())
+						failed = append(failed, &RunError{Manager: m.Name, Stage: StageReload, Err: fmt.Errorf("could not write to %v. err=%v", bc.GetStatusFile(), err.Error())})
+					}
+					metrics.SetButlerReloadVal(metrics.SUCCESS, m.Name)
+					m.RollbackAttempts = 0
+					if m.EnableCache {
+						m.CacheConfigs(bc.Config.GetAllConfigLocalPaths(m.Name))
+					}
+				}
+				release()
+			}
+		}
+	} else if bc.skipReload {
+		for _, m := range ReloadManager {
+			log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: CM files changed, not reloading.", cmHandlerCounter, m)
+			// the manager is reloaded by the next run which does reload
+			if err := bc.recordStatus(m, StatusPending, "", nil); err != nil {
+				log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, m, bc.GetStatusFile(), err.Error())
+			}
+		}
+	} else {
+		log.Debugf("Config::RunCMHandler()[count=%v]: CM files changed... reloading.", cmHandlerCounter)
+		for _, m := range ReloadManager {
+			log.Debugf("Config::RunCMHandler()[count=%v]: m=%#v", cmHandlerCounter, m)
+			if dep := blockingDependency(bc.GetManager(m), failed, ran, true); dep != "" {
+				// the manager is reloaded by the first run after the
+				// dependency has reloaded
+				log.Warnf("Config::RunCMHandler()[count=%v][manager=%v]: dependency %v has not reloaded, not reloading.", cmHandlerCounter, m, dep)
+				if err := bc.recordStatus(m, StatusPending, "", nil); err != nil {
+					log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, m, bc.GetStatusFile(), err.Error())
+				}
+				if RunErrors(failed).For(dep) != nil {
+					failed = append(failed, &RunError{Manager: m, Stage: StageDependency, Err: fmt.Errorf("dependency %v failed", dep)})
+				}
+				continue
+			}
+			if err := bc.scheduleReload(bc.GetManager(m)); err != nil {
+				failed = append(failed, &RunError{Manager: m, Stage: StageReload, Err: err})
+			}
+		}
+	}
+	for _, name := range ran {
+		recordRun(name, RunErrors(failed).For(name))
+		if m := bc.GetManager(name); m != nil {
+			bc.updateBreaker(m)
+			metrics.SetButlerConfigVersion(name, m.ConfigVersion())
+			bc.saveState(m)
+		}
+	}
+	bc.checkStale(time.Now())
+	bc.readiness.set(&bc.readiness.attempted)
+	log.Infof("Config::RunCMHandler()[count=%v]: done.", cmHandlerCounter)
+	cmHandlerCounter++
+	return failed
+}
+
+// processManager downloads, validates and copies the files of the manager,
+// unless it is skipped, for runCMHandler. dep is the dependency which holds
+// the manager back, if any.
+func (bc *ButlerConfig) processManager(ctx context.Context, m *Manager, token uint64, broken RunErrors, dep string) *managerRun {
+	res := &managerRun{manager: m}
+	if state := GetManagerPaused(bc.GetStatusFile(), m.Name); state != nil {
+		log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: paused since %v by %v, skipping.", cmHandlerCounter, m.Name, state.Since.Format(time.RFC3339), state.Actor)
+		metrics.SetButlerPausedVal(metrics.SUCCESS, m.Name)
+		return res
+	}
+	metrics.SetButlerPausedVal(metrics.FAILURE, m.Name)
+	if end, open := m.BreakerEnd(time.Now()); open && !isForceRun(ctx) {
+		log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: breaker open until %v, skipping.", cmHandlerCounter, m.Name, end.Format(time.RFC3339))
+		return res
+	}
+	if dep != "" {
+		log.Warnf("Config::RunCMHandler()[count=%v][manager=%v]: dependency %v failed, skipping.", cmHandlerCounter, m.Name, dep)
+		res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageDependency, Err: fmt.Errorf("dependency %v failed", dep)})
+		res.ran = true
+		return res
+	}
+	if err := broken.For(m.Name); err != nil {
+		log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: skipping. err=%v", cmHandlerCounter, m.Name, err.Error())
+		res.failed = append(res.failed, err.(RunErrors)...)
+		res.ran = true
+		return res
+	}
+	mctx, mspan := tracing.Start(ctx, "butler.manager", tracing.String("butler.manager", m.Name))
+	res.span = mspan
+	m.traceCtx = mctx
+	c1 := make(chan ChanEvent)
+	c2 := make(chan ChanEvent)
+	go m.DownloadPrimaryConfigFiles(mctx, c1)
+	go m.DownloadAdditionalConfigFiles(mctx, c2)
+	PrimaryChan, AdditionalChan := <-c1, <-c2
+	if ctx.Err() != nil {
+		log.Warnf("Config::RunCMHandler()[count=%v][manager=%v]: cancelled while downloading, not copying files.", cmHandlerCounter, m.Name)
+		PrimaryChan.CleanTmpFiles()
+		AdditionalChan.CleanTmpFiles()
+		res.stop = true
+		return res
+	}
+	res.ran = true
+	if PrimaryChan.Fetched() && AdditionalChan.Fetched() {
+		metrics.SetButlerLastFetchSuccess(m.Name)
+	}
+
+	if PrimaryChan.CanCopyFiles() && AdditionalChan.CanCopyFiles() {
+		log.Debugf("Config::RunCMHandler()[count=%v]: successfully retrieved files. processing...", cmHandlerCounter)
+		if err := m.ValidateStagedFiles(PrimaryChan, AdditionalChan); err != nil {
+			log.Errorf("Config::RunCMHandler()[count=%v]: validation failed for manager %v, not copying files. err=%v", cmHandlerCounter, m.Name, err.Error())
+			events.Emit(events.New(events.TypeValidation, m.Name).WithError(err))
+			metrics.SetButlerRemoteRepoSanity(metrics.FAILURE, m.Name)
+			res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageValidation, Err: err})
+			PrimaryChan.CleanTmpFiles()
+			AdditionalChan.CleanTmpFiles()
+			m.LastRun = time.Now()
+			return res
+		}
+		if end, blocked := m.BlackoutEnd(time.Now()); blocked {
+			log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: in a blackout window until %v, not copying files.", cmHandlerCounter, m.Name, end.Format(time.RFC3339))
+			metrics.SetButlerBlackoutVal(metrics.SUCCESS, m.Name)
+			metrics.SetButlerRemoteRepoUp(metrics.SUCCESS, m.Name)
+			metrics.SetButlerRemoteRepoSanity(metrics.SUCCESS, m.Name)
+			PrimaryChan.CleanTmpFiles()
+			AdditionalChan.CleanTmpFiles()
+			m.LastRun = time.Now()
+			return res
+		}
+		metrics.SetButlerBlackoutVal(metrics.FAILURE, m.Name)
+		if !isForceRun(ctx) && bc.holdForCanary(m) {
+			metrics.SetButlerRemoteRepoUp(metrics.SUCCESS, m.Name)
+			metrics.SetButlerRemoteRepoSanity(metrics.SUCCESS, m.Name)
+			PrimaryChan.CleanTmpFiles()
+			AdditionalChan.CleanTmpFiles()
+			m.LastRun = time.Now()
+			return res
+		}
+		if !stillLeading(token) {
+			// another butler may have taken over, and copied newer
+			// files, since the run started
+			log.Warnf("Config::RunCMHandler()[count=%v][manager=%v]: no longer the leader, not copying files.", cmHandlerCounter, m.Name)
+			PrimaryChan.CleanTmpFiles()
+			AdditionalChan.CleanTmpFiles()
+			res.ran = false
+			res.stop = true
+			return res
+		}
+		if m.Hooks.PreCopy != "" {
+			err := m.RunPreCopyHook(PrimaryChan, AdditionalChan)
+			if err != nil {
+				log.Errorf("Config::RunCMHandler()[count=%v]: pre-copy hook failed for manager %v, not copying files. err=%v", cmHandlerCounter, m.Name, err.Error())
+				res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageValidation, Err: err})
+				PrimaryChan.CleanTmpFiles()
+				AdditionalChan.CleanTmpFiles()
+				m.LastRun = time.Now()
+				return res
+			}
+		}
+		start := time.Now()
+		unlock, err := m.LockCopy()
+		if err != nil {
+			log.Errorf("Config::RunCMHandler()[count=%v][manager=%v]: not copying files. err=%v", cmHandlerCounter, m.Name, err.Error())
+			res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageReload, Err: err})
+			PrimaryChan.CleanTmpFiles()
+			AdditionalChan.CleanTmpFiles()
+			m.LastRun = time.Now()
+			return res
+		}
+		_, cspan := tracing.Start(m.traceCtx, "butler.copy", tracing.String("butler.manager", m.Name))
+		p := PrimaryChan.CopyPrimaryConfigFiles(m.ManagerOpts)
+		a := AdditionalChan.CopyAdditionalConfigFiles(m.DestPath)
+		PrimaryChan.CleanTmpFiles()
+		AdditionalChan.CleanTmpFiles()
+		m.ChangedFiles = append(PrimaryChan.GetChangedFiles(), AdditionalChan.GetChangedFiles()...)
+		deleted := m.ReconcileSyncDirs()
+		unlock()
+		metrics.SetButlerCopyDuration(m.Name, time.Since(start))
+		cspan.SetAttributes(tracing.Int("butler.changed_files", len(m.ChangedFiles)), tracing.Int("butler.deleted_files", deleted))
+		cspan.End(nil)
+		if p || a || deleted > 0 {
+			if m.Canary {
+				recordCanaryChange(m.Name, time.Now())
+			}
+			pAdded, pChanged := PrimaryChan.GetChangeCounts()
+			aAdded, aChanged := AdditionalChan.GetChangeCounts()
+			log.Infof("Config::RunCMHandler()[count=%v][manager=%v]: files added=%v changed=%v deleted=%v", cmHandlerCounter, m.Name, pAdded+aAdded, pChanged+aChanged, deleted)
+			metrics.SetButlerSyncFilesVal(m.Name, pAdded+aAdded, pChanged+aChanged, deleted)
+			events.Emit(events.New(events.TypeChange, m.Name).WithVersion(m.ConfigVersion()).WithMessage(fmt.Sprintf("files added=%v changed=%v deleted=%v", pAdded+aAdded, pChanged+aChanged, deleted)))
+			m.RunHook(HookPostCopy, m.ChangedFiles)
+
+			if err := m.ValidateDestFiles(); err != nil {
+				log.Errorf("Config::RunCMHandler()[count=%v]: post-copy validation failed for manager %v, not reloading. err=%v", cmHandlerCounter, m.Name, err.Error())
+				events.Emit(events.New(events.TypeValidation, m.Name).WithError(err))
+				metrics.SetButlerRemoteRepoSanity(metrics.FAILURE, m.Name)
+				res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageValidation, Err: err})
+				if m.EnableCache && m.GoodCache {
+					m.RestoreCachedConfigs(bc.Config.GetAllConfigLocalPaths(m.Name))
+				} else {
+					log.Warnf("Config::RunCMHandler()[count=%v]: no known good cache for manager %v, unable to restore previous files.", cmHandlerCounter, m.Name)
+				}
+				m.LastRun = time.Now()
+				return res
+			}
+			res.reload = true
+		}
+		metrics.SetButlerRemoteRepoUp(metrics.SUCCESS, m.Name)
+		metrics.SetButlerRemoteRepoSanity(metrics.SUCCESS, m.Name)
+	} else {
+		log.Debugf("Config::RunCMHandler()[count=%v]: cannot copy files. cleaning up...", cmHandlerCounter)
+		// Failure statistics for RemoteRepoUp and RemoteRepoSanity
+		// happen in DownloadPrimaryConfigFiles // DownloadAdditionalConfigFiles
+		if PrimaryChan.Invalid() || AdditionalChan.Invalid() {
+			res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageValidation, Err: errors.New("could not render or validate the configuration files")})
+		} else {
+			res.failed = append(res.failed, &RunError{Manager: m.Name, Stage: StageDownload, Err: errors.New("could not download the configuration files")})
+		}
+		PrimaryChan.CleanTmpFiles()
+		AdditionalChan.CleanTmpFiles()
+	}
+	m.LastRun = time.Now()
+	return res
+}
+
+// reloadManager reloads the manager after its files have changed, and
+// records the result in the status file. A failed reload restores the known
+// good configuration. When the reloads are coordinated across the fleet, the
+// reload first waits for a rollout slot, and the manager is left pending when
+// none frees up in time. It returns the error of a failed reload, or of a
+// failure to record the successful one.
+func (bc *ButlerConfig) reloadManager(mgr *Manager) error {
+	release, err := acquireReloadSlot(mgr.Name)
+	if err != nil {
+		// the manager is reloaded by the next run which gets a slot
+		log.Errorf("Config::reloadManager()[count=%v][manager=%v]: not reloading. err=%v", cmHandlerCounter, mgr.Name, err.Error())
+		if serr := bc.recordStatus(mgr.Name, StatusPending, "", nil); serr != nil {
+			log.Errorf("Config::reloadManager()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, mgr.Name, bc.GetStatusFile(), serr.Error())
+		}
+		return err
+	}
+	defer release()
+
+	err = mgr.Reload()
+	if err != nil {
+		switch e := err.(type) {
+		case *reloaders.ReloaderError:
+			log.Debugf("Config::reloadManager()[count=%v]: e.Code=%#v, mgr.ManagerTimeoutOk=%#v", cmHandlerCounter, e.Code, mgr.ManagerTimeoutOk)
+			if e.Code == 1 && mgr.ManagerTimeoutOk == true {
+				// we really don't care about here, but
+				// let's make sure we at least delete our metrics
+				metrics.DeleteButlerReloadVal(mgr.Name)
+				return nil
+			} else {
+				log.Errorf("Config::reloadManager()[count=%v]: Could not reload manager \"%v\" err=%#v", cmHandlerCounter, mgr.Name, err)
+				if serr := bc.recordStatus(mgr.Name, StatusFailed, "", err); serr != nil {
+					log.Errorf("Config::reloadManager()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, mgr.Name, bc.GetStatusFile(), serr.Error())
+				}
+				metrics.SetButlerReloadVal(metrics.FAILURE, mgr.Name)
+				bc.RestoreAndReload(mgr)
+			}
+		}
+		return err
+	}
+	metrics.SetButlerReloadVal(metrics.SUCCESS, mgr.Name)
+	mgr.RollbackAttempts = 0
+	if mgr.EnableCache {
+		mgr.CacheConfigs(bc.Config.GetAllConfigLocalPaths(mgr.Name))
+	}
+	if err = bc.recordStatus(mgr.Name, StatusOK, mgr.ConfigVersion(), nil); err != nil {
+		log.Errorf("Config::reloadManager()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, mgr.Name, bc.GetStatusFile(), err.Error())
+		return fmt.Errorf("could not write to %v. err=%v", bc.GetStatusFile(), err.Error())
+	}
+	return nil
+}
+
+// RestoreAndReload restores the known good configuration for the manager from
+// the cache after a failed reload. When reload-on-restore is enabled, the
+// manager is then reloaded with the restored files, up to max-rollback-attempts
+// consecutive times without a successful reload of new files. It returns true
+// if the manager was reloaded with the restored files.
+func (bc *ButlerConfig) RestoreAndReload(mgr *Manager) bool {
+	if !mgr.EnableCache || !mgr.GoodCache {
+		return false
+	}
+	mgr.RestoreCachedConfigs(bc.Config.GetAllConfigLocalPaths(mgr.Name))
+	// the release and the destination get the restored files too, even when
+	// they are not reloaded, the same as the dest-path
+	if err := mgr.Release(); err != nil {
+		log.Errorf("Config::RestoreAndReload()[count=%v][manager=%v]: could not release restored configuration. err=%v", cmHandlerCounter, mgr.Name, err.Error())
+	}
+	if err := mgr.Publish(); err != nil {
+		log.Errorf("Config::RestoreAndReload()[count=%v][manager=%v]: could not publish restored configuration. err=%v", cmHandlerCounter, mgr.Name, err.Error())
+	}
+
+	if !mgr.ReloadOnRestore {
+		return false
+	}
+	if mgr.RollbackAttempts >= mgr.MaxRollbacks {
+		log.Errorf("Config::RestoreAndReload()[count=%v][manager=%v]: reached %v rollback attempts, not reloading restored configuration.", cmHandlerCounter, mgr.Name, mgr.RollbackAttempts)
+		metrics.SetButlerKnownGoodReloadVal(metrics.FAILURE, mgr.Name)
+		return false
+	}
+	mgr.RollbackAttempts++
+
+	log.Warnf("Config::RestoreAndReload()[count=%v][manager=%v]: reloading restored configuration (attempt %v of %v).", cmHandlerCounter, mgr.Name, mgr.RollbackAttempts, mgr.MaxRollbacks)
+	if err := mgr.Reload(); err != nil {
+		log.Errorf("Config::RestoreAndReload()[count=%v][manager=%v]: could not reload restored configuration. err=%v", cmHandlerCounter, mgr.Name, err.Error())
+		metrics.SetButlerKnownGoodReloadVal(metrics.FAILURE, mgr.Name)
+		return false
+	}
+
+	if err := bc.recordStatus(mgr.Name, StatusRestored, mgr.ConfigVersion(), nil); err != nil {
+		log.Errorf("Config::RestoreAndReload()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, mgr.Name, bc.GetStatusFile(), err.Error())
+	}
+	metrics.SetButlerReloadVal(metrics.SUCCESS, mgr.Name)
+	metrics.SetButlerKnownGoodReloadVal(metrics.SUCCESS, mgr.Name)
+	log.Infof("Config::RestoreAndReload()[count=%v][manager=%v]: manager is OK with the restored configuration.", cmHandlerCounter, mgr.Name)
+	return true
+}
+
+// Rollback forces the manager back to the retained snapshot id, or to the
+// latest snapshot when id is empty, and reloads the manager. It is meant for
+// incident response when a valid, but wrong, configuration has shipped. The
+// restored files stay in place until the next run which finds the upstream
+// files differ from them. The actor is who asked for the rollback, and is
+// recorded in the emitted rollback event.
+func (bc *ButlerConfig) Rollback(name string, id string, actor string) (*Snapshot, error) {
+	snap, err := bc.rollback(name, id)
+	e := events.New(events.TypeRollback, name).WithActor(actor).WithError(err)
+	if snap != nil {
+		e = e.WithSnapshot(snap.ID)
+	}
+	events.Emit(e)
+	return snap, err
+}
+
+func (bc *ButlerConfig) rollback(name string, id string) (*Snapshot, error) {
+	var (
+		err  error
+		snap *Snapshot
+	)
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	mgr := bc.GetManager(name)
+	if mgr == nil {
+		return nil, fmt.Errorf("unknown manager %v", name)
+	}
+	if mgr.Snapshots == nil {
+		return nil, fmt.Errorf("caching is not enabled for manager %v", name)
+	}
+	if _, ok := leading(context.Background()); !ok {
+		return nil, errors.New("not the leader among the butlers which share the destination")
+	}
+
+	if id == "" {
+		snap, err = mgr.Snapshots.Latest()
+	} else {
+		snap, err = mgr.Snapshots.Get(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("no snapshots retained for manager %v", name)
+	}
+
+	log.Warnf("Config::Rollback()[count=%v][manager=%v]: rolling back to snapshot %v.", cmHandlerCounter, name, snap.ID)
+	if err = mgr.RestoreSnapshot(snap.ID); err != nil {
+		return snap, err
+	}
+
+	if err = mgr.Reload(); err != nil {
+		log.Errorf("Config::Rollback()[count=%v][manager=%v]: could not reload manager after rollback. err=%v", cmHandlerCounter, name, err.Error())
+		if serr := bc.recordStatus(name, StatusFailed, "", err); serr != nil {
+			log.Errorf("Config::Rollback()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, name, bc.GetStatusFile(), serr.Error())
+		}
+		metrics.SetButlerReloadVal(metrics.FAILURE, name)
+		metrics.SetButlerKnownGoodReloadVal(metrics.FAILURE, name)
+		return snap, err
+	}
+
+	if err = bc.recordStatus(name, StatusRestored, mgr.ConfigVersion(), nil); err != nil {
+		log.Errorf("Config::Rollback()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, name, bc.GetStatusFile(), err.Error())
+	}
+	metrics.SetButlerReloadVal(metrics.SUCCESS, name)
+	metrics.SetButlerKnownGoodReloadVal(metrics.SUCCESS, name)
+	mgr.RollbackAttempts = 0
+	bc.saveState(mgr)
+	log.Infof("Config::Rollback()[count=%v][manager=%v]: manager is OK with snapshot %v.", cmHandlerCounter, name, snap.ID)
+	return snap, nil
+}
+
+// Pause stops butler from managing the files of the manager, eg: during an
+// incident, until it is resumed. The pause is kept in the status file, so the
+// manager stays paused across restarts. A deferred reload of the manager is
+// dropped, and the manager is reloaded when it is resumed instead. The actor
+// is who asked for the pause, and is recorded in the emitted pause event.
+func (bc *ButlerConfig) Pause(name string, reason string, actor string) (*PauseState, error) {
+	state, err := bc.pause(name, reason, actor)
+	events.Emit(events.New(events.TypePause, name).WithActor(actor).WithMessage(reason).WithError(err))
+	return state, err
+}
+
+func (bc *ButlerConfig) pause(name string, reason string, actor string) (*PauseState, error) {
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	if bc.GetManager(name) == nil {
+		return nil, fmt.Errorf("unknown manager %v", name)
+	}
+	if state := GetManagerPaused(bc.GetStatusFile(), name); state != nil {
+		return state, nil
+	}
+
+	state := &PauseState{Since: time.Now(), Actor: actor, Reason: reason}
+	if err := SetManagerPaused(bc.GetStatusFile(), name, state); err != nil {
+		return nil, err
+	}
+	if p, ok := pendingReloads[name]; ok {
+		p.timer.Stop()
+		delete(pendingReloads, name)
+		if err := bc.recordStatus(name, StatusPending, "", nil); err != nil {
+			log.Errorf("Config::Pause()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, name, bc.GetStatusFile(), err.Error())
+		}
+	}
+	metrics.SetButlerPausedVal(metrics.SUCCESS, name)
+	log.Warnf("Config::Pause()[count=%v][manager=%v]: manager paused by %v. reason=%v", cmHandlerCounter, name, actor, reason)
+	return state, nil
+}
+
+// Resume lets butler manage the files of a paused manager again, from its
+// next run on. The actor is who asked for the resume, and is recorded in the
+// emitted resume event.
+func (bc *ButlerConfig) Resume(name string, actor string) error {
+	err := bc.resume(name, actor)
+	events.Emit(events.New(events.TypeResume, name).WithActor(actor).WithError(err))
+	return err
+}
+
+func (bc *ButlerConfig) resume(name string, actor string) error {
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	if bc.GetManager(name) == nil {
+		return fmt.Errorf("unknown manager %v", name)
+	}
+	if GetManagerPaused(bc.GetStatusFile(), name) == nil {
+		return nil
+	}
+
+	if err := SetManagerPaused(bc.GetStatusFile(), name, nil); err != nil {
+		return err
+	}
+	metrics.SetButlerPausedVal(metrics.FAILURE, name)
+	log.Warnf("Config::Resume()[count=%v][manager=%v]: manager resumed by %v.", cmHandlerCounter, name, actor)
+	return nil
+}
+
+func (bc *ButlerConfig) GetManagers() map[string]*Manager {
+	return bc.Config.Managers
+}
+
+func (bc *ButlerConfig) GetManager(m string) *Manager {
+	return bc.Config.Managers[m]
+}
+
+func (bc *ButlerConfig) GetStatusFile() string {
+	return bc.Config.Globals.StatusFile
+}
+
+// CheckPaths creates the missing directories of the files of the managers. It
+// returns RunErrors for the managers whose directories could not be created.
+func (bc *ButlerConfig) CheckPaths() error {
+	var failed RunErrors
+	log.Debugf("Config::CheckPaths(): entering")
+	for _, m := range bc.Config.Managers {
+		for _, f := range m.GetAllLocalPaths() {
+			dir := filepath.Dir(f)
+			if _, err := os.Stat(dir); err != nil {
+				err = handleFailure(FailureMkdir, func() error { return os.MkdirAll(dir, 0755) })
+				if err != nil {
+					log.Errorf("Config::CheckPaths()[manager=%v]: could not create directory \"%s\". err=%s", m.Name, dir, err.Error())
+					failed = append(failed, &RunError{Manager: m.Name, Stage: StageDownload, Err: fmt.Errorf("could not create directory %v. err=%v", dir, err.Error())})
+					break
+				}
+				log.Infof("Config::CheckPaths(): Created directory \"%s\"", dir)
+				log.Debugf("Config::CheckPaths(): setting m.ReloadManager=true")
+				m.ReloadManager = true
+			}
+		}
+
+		if m.CleanFiles {
+			err := filepath.Walk(m.DestPath, m.PathCleanup)
+			if err != nil {
+				log.Debugf("Config::CheckPaths(): got err for filepath. setting m.ReloadManager=true")
+				m.ReloadManager = true
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
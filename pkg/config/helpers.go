@@ -0,0 +1,1881 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/healthchecks"
+	"github.com/adobe/butler/internal/metrics"
+	"github.com/adobe/butler/internal/redact"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/internal/validators"
+	"github.com/adobe/butler/pkg/destinations"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	"github.com/Jeffail/gabs"
+	"github.com/go-ini/ini"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/hashicorp/hcl"
+	// until i get my pr merged
+	//"github.com/hoisie/mustache"
+	"github.com/mslocrian/mustache"
+	"github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+func IsValidScheme(s string) bool {
+	var (
+		Found = false
+	)
+	for _, i := range ValidSchemes {
+		if strings.ToLower(s) == i {
+			Found = true
+		}
+
+	}
+	return Found || methods.IsPlugin(s)
+}
+
+// RedactURL returns the url with any user credentials stripped, and the
+// secrets of its query masked, so that it can be logged or sent along with
+// events.
+func RedactURL(u string) string {
+	return redact.URL(u)
+}
+
+// ValidateConfig takes a pointer to an os.File object. It scans over the
+// file and ensures that it begins with the proper header, and ends with the
+// proper footer. If it does not begin or end with the proper header/footer,
+// then an error is returned. If the file passes the checks, a nil is returned.
+func ValidateConfig(opts *ValidateOpts) error {
+	var (
+		err               error
+		data              []byte
+		file              *bytes.Reader
+		contentTypeSwitch string
+	)
+
+	log.Debugf("ValidateConfig()[count=%v][manager=%v]: checking content-type=%v FileName=%v", cmHandlerCounter, opts.Manager, opts.ContentType, opts.FileName)
+	f := opts.Data
+	switch t := f.(type) {
+	case *os.File:
+		newf := f.(*os.File)
+
+		fd, err := os.Open(newf.Name())
+		if err != nil {
+			log.Errorf("ValidateConfig()[count=%v][manager=%v]: caught error on open err=%#v", cmHandlerCounter, opts.Manager, err.Error())
+			return err
+		}
+		defer fd.Close()
+
+		fi, err := fd.Stat()
+		if err != nil {
+			log.Errorf("ValidateConfig()[count=%v][manager=%v]: caught error on stat err=%#v", cmHandlerCounter, opts.Manager, err.Error())
+			return err
+		}
+
+		data = make([]byte, fi.Size())
+		_, err = fd.Read(data)
+		if err != nil {
+			log.Errorf("ValidateConfig()[count=%v][manager=%v]: caught error on fd.Read() err=%#v", cmHandlerCounter, opts.Manager, err.Error())
+			return err
+		}
+
+		file = bytes.NewReader(data)
+	case []byte:
+		data = f.([]byte)
+		file = bytes.NewReader(data)
+	default:
+		return fmt.Errorf("ValidateConfig()[count=%v][manager=%v]: unknown file type %s for %s", cmHandlerCounter, opts.Manager, t, f)
+	}
+
+	if opts.ContentType == "auto" {
+		contentTypeSwitch = getFileExtension(opts.FileName)
+	} else {
+		contentTypeSwitch = opts.ContentType
+	}
+
+	if err = checkSize(data, opts, contentTypeSwitch == "binary"); err != nil {
+		log.Errorf("ValidateConfig()[count=%v][manager=%v]: returning err=%v for content-type=%v and FileName=%v", cmHandlerCounter, opts.Manager, err.Error(), opts.ContentType, opts.FileName)
+		return err
+	}
+
+	// binary files are copied as is, so there is nothing to validate or sanitize
+	if contentTypeSwitch == "binary" {
+		return nil
+	}
+
+	switch contentTypeSwitch {
+	case "text":
+		err = runTextValidate(file, opts.Manager, opts.Header, opts.Footer)
+	case "json":
+		err = runJSONValidate(file, opts.Manager)
+	case "yaml":
+		err = runYamlValidate(file, opts.Manager, opts.Header, opts.Footer)
+	case "toml":
+		err = runTomlValidate(file, opts.Manager)
+	case "hcl":
+		err = runHclValidate(file, opts.Manager)
+	case "ini":
+		err = runIniValidate(file, opts.Manager)
+	case "xml":
+		err = runXMLValidate(file, opts.Manager)
+	default:
+		err = fmt.Errorf("unknown content type %s", opts.ContentType)
+	}
+
+	if err != nil {
+		log.Errorf("ValidateConfig()[count=%v][manager=%v]: returning err=%v for content-type=%v and FileName=%v", cmHandlerCounter, opts.Manager, err.Error(), opts.ContentType, opts.FileName)
+		return err
+	}
+
+	// let's rewrite a sanitized temporary config file
+	err = removeButlerHeaderFooter(opts.Data, opts.Header, opts.Footer)
+	if err != nil {
+		log.Errorf("ValidateConfig()[count=%v][manager=%v]: returning err=%v for content-type=%v and FileName=%v", cmHandlerCounter, opts.Manager, err.Error(), opts.ContentType, opts.FileName)
+	}
+	return err
+}
+
+// checkSize returns an error if the contents of the file, without the header
+// and footer markers, are smaller than the min-size, or are empty, or only
+// whitespace, while the file must not be empty. An upstream which publishes
+// empty files would otherwise blow away everything installed from them.
+func checkSize(data []byte, opts *ValidateOpts, binary bool) error {
+	if opts.MinSize <= 0 && !opts.NotEmpty {
+		return nil
+	}
+	content := data
+	if !binary {
+		content, _ = stripMarkers(bytes.NewReader(data), opts.Header, opts.Footer)
+	}
+	if opts.NotEmpty && (len(content) == 0 || (!binary && len(bytes.TrimSpace(content)) == 0)) {
+		return fmt.Errorf("%v is empty, but must not be empty", opts.FileName)
+	}
+	if int64(len(content)) < opts.MinSize {
+		return fmt.Errorf("%v is %v bytes, which is less than its min-size of %v bytes", opts.FileName, len(content), opts.MinSize)
+	}
+	return nil
+}
+
+// checkButlerHeaderFooter returns true if the line is either the header or
+// the footer marker. An empty marker never matches.
+func checkButlerHeaderFooter(in []byte, header string, footer string) bool {
+	line := string(in)
+	if header != "" && line == header {
+		return true
+	}
+	if footer != "" && line == footer {
+		return true
+	}
+	return false
+}
+
+func removeButlerHeaderFooter(file interface{}, header string, footer string) error {
+	var (
+		err       error
+		in        *os.File
+		out       *os.File
+		newSource []byte
+	)
+
+	switch f := file.(type) {
+	case *os.File:
+		in, err = os.Open(f.Name())
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			var line []byte
+			line = scanner.Bytes()
+			if !checkButlerHeaderFooter(line, header, footer) {
+				newSource = append(newSource, line...)
+				newSource = append(newSource, []byte("\n")...)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			in.Close()
+			return err
+		}
+		in.Close()
+
+		out, err = os.OpenFile(f.Name(), os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, bytes.NewReader(newSource))
+		out.Sync()
+		cerr := out.Close()
+		if err != nil {
+			return err
+		}
+		return cerr
+	default:
+		return nil
+	}
+}
+
+// runTextValidate checks that the data begins with the header marker and ends
+// with the footer marker. If both markers are empty, marker checking has been
+// disabled for the manager, and there is nothing to check.
+func runTextValidate(f *bytes.Reader, m string, header string, footer string) error {
+	var (
+		//err error
+		configLine    string
+		isFirstLine   bool
+		isValidHeader bool
+		isValidFooter bool
+		scanner       *bufio.Scanner
+	)
+	if header == "" && footer == "" {
+		return nil
+	}
+
+	isFirstLine = true
+	isValidHeader = true
+	isValidFooter = true
+	scanner = bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		configLine = scanner.Text()
+		// Check that the header is valid
+		if isFirstLine {
+			if header != "" && configLine != header {
+				isValidHeader = false
+			}
+			isFirstLine = false
+		}
+	}
+	// Check that the footer is valid
+	if footer != "" && configLine != footer {
+		isValidFooter = false
+	}
+
+	if !isValidHeader && !isValidFooter {
+		return fmt.Errorf("runTextValidate()[count=%v][manager=%v]: Invalid butler header and footer", cmHandlerCounter, m)
+	} else if !isValidHeader {
+		return fmt.Errorf("runTextValidate()[count=%v][manager=%v]: Invalid butler header", cmHandlerCounter, m)
+	} else if !isValidFooter {
+		return fmt.Errorf("runTextValidate()[count=%v][manager=%v]: Invalid butler footer", cmHandlerCounter, m)
+	} else {
+		return nil
+	}
+}
+
+func runJSONValidate(f *bytes.Reader, m string) error {
+	var (
+		err  error
+		data []byte
+	)
+
+	data, err = ioutil.ReadAll(f)
+	if err != nil {
+		msg := fmt.Sprintf("runJSONValidate()[count=%v][manager=%v], could not read data from bytes.Reader. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	_, err = gabs.ParseJSON(data)
+	if err != nil {
+		msg := fmt.Sprintf("runJSONValidate()[count=%v][manager=%v], could not Unmarshal json data into interface. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func runYamlValidate(f *bytes.Reader, m string, header string, footer string) error {
+	var (
+		err  error
+		data []byte
+		v    interface{}
+	)
+
+	data, err = ioutil.ReadAll(f)
+	if err != nil {
+		msg := fmt.Sprintf("runYamlValidate()[count=%v][manager=%v]: could not read data from bytes.Reader. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	err = yaml.Unmarshal(data, &v)
+	if err != nil {
+		msg := fmt.Sprintf("runYamlValidate()[count=%v][manager=%v]: could not Unmarshal yaml data into interface. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	err = runTextValidate(bytes.NewReader(data), m, header, footer)
+	if err != nil {
+		msg := fmt.Sprintf("runYamlValidate()[count=%v][manager=%v]: could not verify butler header/footer for yaml data. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// The toml, hcl, ini and xml validators only check that the data parses. Unlike
+// the text and yaml validators, they do not require the butler header/footer,
+// though it is still stripped if present.
+func runTomlValidate(f *bytes.Reader, m string) error {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		msg := fmt.Sprintf("runTomlValidate()[count=%v][manager=%v]: could not read data from bytes.Reader. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	_, err = toml.LoadBytes(data)
+	if err != nil {
+		msg := fmt.Sprintf("runTomlValidate()[count=%v][manager=%v]: could not parse toml data. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func runHclValidate(f *bytes.Reader, m string) error {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		msg := fmt.Sprintf("runHclValidate()[count=%v][manager=%v]: could not read data from bytes.Reader. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	_, err = hcl.ParseBytes(data)
+	if err != nil {
+		msg := fmt.Sprintf("runHclValidate()[count=%v][manager=%v]: could not parse hcl data. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func runIniValidate(f *bytes.Reader, m string) error {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		msg := fmt.Sprintf("runIniValidate()[count=%v][manager=%v]: could not read data from bytes.Reader. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+
+	_, err = ini.Load(data)
+	if err != nil {
+		msg := fmt.Sprintf("runIniValidate()[count=%v][manager=%v]: could not parse ini data. err=%v", cmHandlerCounter, m, err.Error())
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func runXMLValidate(f *bytes.Reader, m string) error {
+	var root bool
+
+	d := xml.NewDecoder(f)
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			msg := fmt.Sprintf("runXMLValidate()[count=%v][manager=%v]: could not parse xml data. err=%v", cmHandlerCounter, m, err.Error())
+			return errors.New(msg)
+		}
+		if _, ok := t.(xml.StartElement); ok {
+			root = true
+		}
+	}
+
+	if !root {
+		msg := fmt.Sprintf("runXMLValidate()[count=%v][manager=%v]: could not parse xml data. err=no root element", cmHandlerCounter, m)
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func getFileExtension(file string) string {
+	var result string
+	file = strings.ToLower(file)
+	if strings.HasSuffix(file, "json") {
+		result = "json"
+	} else if strings.HasSuffix(file, "yaml") {
+		result = "yaml"
+	} else if strings.HasSuffix(file, "yml") {
+		result = "yaml"
+	} else if strings.HasSuffix(file, ".toml") {
+		result = "toml"
+	} else if strings.HasSuffix(file, ".hcl") || strings.HasSuffix(file, ".tf") {
+		result = "hcl"
+	} else if strings.HasSuffix(file, ".ini") {
+		result = "ini"
+	} else if strings.HasSuffix(file, ".xml") {
+		result = "xml"
+	} else {
+		result = "text"
+	}
+	return result
+}
+
+// ParseContentTypes parses the manager.content-types "file=type" pairs into a
+// map of per file content-type overrides.
+func ParseContentTypes(pairs []string) (map[string]string, error) {
+	types := make(map[string]string)
+
+	for _, p := range pairs {
+		p = strings.TrimSpace(environment.GetVar(p))
+		if p == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(p, "=")
+		if len(keyvalpairs) != 2 {
+			msg := fmt.Sprintf("invalid manager.content-types entry \"%s\"", p)
+			return types, errors.New(msg)
+		}
+		key := filepath.Clean(strings.TrimSpace(keyvalpairs[0]))
+		val := strings.ToLower(strings.TrimSpace(keyvalpairs[1]))
+		if !IsValidContentType(val) {
+			msg := fmt.Sprintf("unknown manager.content-types type=%v for %v", val, key)
+			return types, errors.New(msg)
+		}
+		types[key] = val
+	}
+	return types, nil
+}
+
+func IsValidContentType(t string) bool {
+	for _, i := range ValidContentTypes {
+		if strings.ToLower(t) == i {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseMustacheSubs(pairs []string) (map[string]string, error) {
+	var (
+		subs map[string]string
+	)
+	subs = make(map[string]string)
+
+	for _, p := range pairs {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(p, "=")
+		if len(keyvalpairs) != 2 {
+			log.Warnf("helpers.ParseMustacheSubs(): invalid key value pair \"%s\"... ignoring.", keyvalpairs)
+			continue
+		}
+		key := strings.TrimSpace(keyvalpairs[0])
+		val := environment.GetVar(strings.TrimSpace(keyvalpairs[1]))
+		subs[key] = val
+	}
+	return subs, nil
+}
+
+func ValidateMustacheSubs(Subs map[string]string) bool {
+	var (
+		subEntries map[string]bool
+	)
+	subEntries = make(map[string]bool)
+
+	// range over the subs and see if the keys match the required list of substitution keys
+	for k := range Subs {
+		if _, ok := subEntries[k]; ok {
+			subEntries[k] = true
+		}
+	}
+
+	// If any of the sub keys are false, then something is missing
+	for _, v := range subEntries {
+		if v == false {
+			return false
+		}
+	}
+	return true
+}
+
+// RenderConfigMustache takes a pointer to an os.File object. It reads the file
+// attempts to parse the mustache
+func RenderConfigMustache(f *os.File, subs map[string]string) error {
+	tmpl, err := mustache.ParseFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	out := tmpl.Render(subs)
+
+	f, err = os.OpenFile(f.Name(), os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write([]byte(out))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CompareAndCopy copies the source to the dest, without the butler header and
+// footer, and returns true if it did. The source is compared without them as
+// well, so that a file which upstream re-publishes as is is not copied again,
+// and does not make for a reload. Such no-op copies are counted by the
+// butler_localconfig_copy_noop_total metric.
+func CompareAndCopy(source string, dest string, m string, opts InstallOpts) bool {
+	data, err := stripButlerHeaderFooter(source)
+	if err != nil {
+		metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(dest))
+		log.Errorf("helpers.CompareAndCopy()[count=%v][manager=%v]: could not read source=%v. err=%v", cmHandlerCounter, m, source, err.Error())
+		return false
+	}
+	equal, err := compareChecksum(data, dest)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("helpers.CompareAndCopy()[count=%v][manager=%v]: caught error from compare. source=%v dest=%v err=%#v", cmHandlerCounter, m, source, dest, err)
+	}
+	if equal {
+		log.Debugf("helpers.CompareAndCopy()[count=%v][manager=%v]: \"%s\" is identical to the installed file. Skipping.", cmHandlerCounter, m, dest)
+		metrics.IncButlerCopyNoop(m)
+		applyUnchangedFilePerms(dest, m, opts)
+		syncFileCopies(dest, m, opts)
+		return false
+	}
+
+	log.Infof("helpers.CompareAndCopy()[count=%v][manager=%v]: Found difference in \"%s.\"  Updating.", cmHandlerCounter, m, dest)
+	err = InstallFile(bytes.NewReader(data), dest, opts)
+	if err != nil {
+		metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(dest))
+		log.Errorf("helpers.CompareAndCopy()[count=%v][manager=%v]: could not copy source=%v to dest=%v. err=%#v", cmHandlerCounter, m, source, dest, err)
+		return false
+	}
+	metrics.SetButlerWriteVal(metrics.SUCCESS, metrics.GetStatsLabel(dest))
+	return true
+}
+
+// CompareAndCopyBinary is the CompareAndCopy for binary files. The files are
+// compared by size, and then by sha256 checksum, and the source is copied
+// as is, without any header/footer stripping.
+func CompareAndCopyBinary(source string, dest string, m string, opts InstallOpts) bool {
+	equal, err := compareFileChecksums(source, dest)
+	if err != nil {
+		log.Debugf("helpers.CompareAndCopyBinary()[count=%v][manager=%v]: caught error from compare. source=%v dest=%v err=%#v", cmHandlerCounter, m, source, dest, err)
+	}
+	if equal {
+		log.Debugf("helpers.CompareAndCopyBinary()[count=%v][manager=%v]: \"%s\" is identical to the installed file. Skipping.", cmHandlerCounter, m, dest)
+		metrics.IncButlerCopyNoop(m)
+		applyUnchangedFilePerms(dest, m, opts)
+		syncFileCopies(dest, m, opts)
+		return false
+	}
+
+	log.Infof("helpers.CompareAndCopyBinary()[count=%v][manager=%v]: Found difference in \"%s.\"  Updating.", cmHandlerCounter, m, dest)
+	err = CopyBinaryFile(source, dest, opts)
+	if err != nil {
+		metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(dest))
+		log.Errorf("helpers.CompareAndCopyBinary()[count=%v][manager=%v]: could not copy source=%v to dest=%v. err=%#v", cmHandlerCounter, m, source, dest, err)
+		return false
+	}
+	metrics.SetButlerWriteVal(metrics.SUCCESS, metrics.GetStatsLabel(dest))
+	return true
+}
+
+// applyUnchangedFilePerms makes sure a file which has not changed still has
+// the configured permissions and extended attributes, in case they were
+// changed since it was copied.
+func applyUnchangedFilePerms(dest string, m string, opts InstallOpts) {
+	if opts.Perms != (FilePerms{}) {
+		if err := ApplyFilePerms(dest, opts.Perms); err != nil {
+			metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(dest))
+			log.Errorf("helpers.applyUnchangedFilePerms()[count=%v][manager=%v]: could not set permissions on %v. err=%v", cmHandlerCounter, m, dest, err.Error())
+		}
+	}
+	opts.PreserveXattrs = false
+	if err := applyXattrs(dest, "", opts); err != nil {
+		metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(dest))
+		log.Errorf("helpers.applyUnchangedFilePerms()[count=%v][manager=%v]: %v", cmHandlerCounter, m, err.Error())
+	}
+}
+
+// syncFileCopies makes sure the copies of a file which has not changed are
+// the same as the file, in case they were added since it was copied, or were
+// changed or removed since.
+func syncFileCopies(dest string, m string, opts InstallOpts) {
+	for _, c := range opts.Copies {
+		if equal, _ := compareFileChecksums(dest, c); equal {
+			applyUnchangedFilePerms(c, m, opts)
+			continue
+		}
+		log.Infof("helpers.syncFileCopies()[count=%v][manager=%v]: Found difference in copy \"%s.\"  Updating.", cmHandlerCounter, m, c)
+		o := opts
+		o.Copies = nil
+		err := os.MkdirAll(filepath.Dir(c), 0755)
+		if err == nil {
+			err = CopyBinaryFile(dest, c, o)
+		}
+		if err != nil {
+			metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(c))
+			log.Errorf("helpers.syncFileCopies()[count=%v][manager=%v]: could not copy %v to %v. err=%v", cmHandlerCounter, m, dest, c, err.Error())
+			continue
+		}
+		metrics.SetButlerWriteVal(metrics.SUCCESS, metrics.GetStatsLabel(c))
+	}
+}
+
+func compareFileChecksums(source string, dest string) (bool, error) {
+	sfi, err := os.Stat(source)
+	if err != nil {
+		return false, err
+	}
+	dfi, err := os.Stat(dest)
+	if err != nil {
+		return false, err
+	}
+	if sfi.Size() != dfi.Size() {
+		return false, nil
+	}
+
+	ssum, err := fileChecksum(source)
+	if err != nil {
+		return false, err
+	}
+	dsum, err := fileChecksum(dest)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ssum, dsum), nil
+}
+
+// compareChecksum returns true if the file has the same sha256 checksum as the
+// data.
+func compareChecksum(data []byte, file string) (bool, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() != int64(len(data)) {
+		return false, nil
+	}
+	sum, err := fileChecksum(file)
+	if err != nil {
+		return false, err
+	}
+	dsum := sha256.Sum256(data)
+	return bytes.Equal(dsum[:], sum), nil
+}
+
+func fileChecksum(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// CopyBinaryFile copies the src path string to the dst path string, byte for
+// byte. If there is an error, an error is returned, otherwise nil is returned.
+func CopyBinaryFile(src string, dst string, opts InstallOpts) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return InstallFile(in, dst, opts)
+}
+
+// CopyFile copies the src path string to the dst path string. If there is an
+// error, an error is returned, otherwise nil is returned.
+func CopyFile(src string, dst string, opts InstallOpts) error {
+	newSource, err := stripButlerHeaderFooter(src)
+	if err != nil {
+		return err
+	}
+	return InstallFile(bytes.NewReader(newSource), dst, opts)
+}
+
+// stripButlerHeaderFooter returns the contents of the file without the butler
+// header and footer lines, as it is copied into place.
+func stripButlerHeaderFooter(src string) ([]byte, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return stripMarkers(in, butlerHeader, butlerFooter)
+}
+
+// stripMarkers returns the contents of the reader without the header and
+// footer lines.
+func stripMarkers(in io.Reader, header string, footer string) ([]byte, error) {
+	var (
+		newSource []byte
+	)
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var line []byte
+		line = scanner.Bytes()
+		if !checkButlerHeaderFooter(line, header, footer) {
+			newSource = append(newSource, line...)
+			newSource = append(newSource, []byte("\n")...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newSource, nil
+}
+
+// InstallFile writes the contents of the reader to dst. The data is written
+// to a temporary file in the same directory as dst, which is then renamed
+// into place, so that readers of dst never observe a partially written file.
+// Unless set in the opts, the mode of an existing dst is preserved, and new
+// files are created 0644. When running as root the owner and group of an
+// existing dst are preserved as well. The copies of the opts get the data
+// too, and are all written before any of the files is renamed into place,
+// so that a copy which cannot be written leaves every file as it was.
+func InstallFile(r io.Reader, dst string, opts InstallOpts) error {
+	if len(opts.Copies) == 0 {
+		tmp, err := stageFile(r, dst, opts)
+		if err != nil {
+			return err
+		}
+		return renameFiles([]string{tmp}, []string{dst}, opts)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dsts := append([]string{dst}, opts.Copies...)
+	var tmps []string
+	for _, d := range dsts {
+		var tmp string
+		err := os.MkdirAll(filepath.Dir(d), 0755)
+		if err == nil {
+			tmp, err = stageFile(bytes.NewReader(data), d, opts)
+		}
+		if err != nil {
+			for _, t := range tmps {
+				removeTempFile(t)
+			}
+			return fmt.Errorf("could not write %v. err=%v", d, err.Error())
+		}
+		tmps = append(tmps, tmp)
+	}
+	return renameFiles(tmps, dsts, opts)
+}
+
+// renameFiles renames the staged temporary files into place, and removes
+// those which are left when one of them cannot be renamed.
+func renameFiles(tmps []string, dsts []string, opts InstallOpts) error {
+	for i, t := range tmps {
+		if err := os.Rename(t, dsts[i]); err != nil {
+			for _, t := range tmps[i:] {
+				removeTempFile(t)
+			}
+			return err
+		}
+		forgetTempFile(t)
+	}
+	if opts.Restorecon != "" {
+		for _, d := range dsts {
+			if err := restorecon(opts.Restorecon, d); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.SyncDir {
+		for _, d := range dsts {
+			if err := syncDir(filepath.Dir(d)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stageFile writes the contents of the reader to a temporary file in the same
+// directory as dst, with the permissions dst is installed with, and returns
+// the name of the temporary file, which is left for the caller to rename.
+func stageFile(r io.Reader, dst string, opts InstallOpts) (string, error) {
+	var (
+		mode  os.FileMode = 0644
+		perms             = opts.Perms
+	)
+
+	if fi, err := os.Stat(dst); err == nil {
+		mode = fi.Mode().Perm()
+		if uid, gid, ok := fileOwner(fi); ok && os.Geteuid() == 0 {
+			owner := FilePerms{Owner: fmt.Sprintf("%d", uid), Uid: uid, Group: fmt.Sprintf("%d", gid), Gid: gid}
+			perms = owner.Merge(perms)
+		}
+	}
+	if perms.Mode == 0 {
+		perms.Mode = mode
+	}
+
+	tmp, err := tempFile(filepath.Dir(dst), fmt.Sprintf(".%s.butler-", filepath.Base(dst)))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, r)
+	if err == nil && opts.Fsync {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = ApplyFilePerms(tmp.Name(), perms)
+	}
+	if err == nil {
+		err = applyXattrs(tmp.Name(), dst, opts)
+	}
+	if err != nil {
+		removeTempFile(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// ApplyFilePerms sets the mode, owner and group of the file, where they differ
+// from the perms. Changing the owner generally requires butler to run as
+// root, so a failed chown returns an error saying as much.
+func ApplyFilePerms(file string, perms FilePerms) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	uid, gid := -1, -1
+	if perms.Owner != "" {
+		uid = perms.Uid
+	}
+	if perms.Group != "" {
+		gid = perms.Gid
+	}
+	if fuid, fgid, ok := fileOwner(fi); ok {
+		if uid == fuid {
+			uid = -1
+		}
+		if gid == fgid {
+			gid = -1
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err = os.Chown(file, uid, gid); err != nil {
+			if os.Geteuid() != 0 {
+				return fmt.Errorf("could not set owner=%v group=%v on %v, butler must run as root to change file ownership. err=%v", perms.Owner, perms.Group, file, err.Error())
+			}
+			return err
+		}
+	}
+
+	// chown may clear the setuid/setgid bits, so the mode is set afterwards
+	if perms.Mode != 0 && (uid != -1 || gid != -1 || fi.Mode().Perm() != perms.Mode.Perm()) {
+		if err = os.Chmod(file, perms.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseFilePerms parses the mode, owner and group settings of a file. The mode
+// is in octal, and the owner and group may be either names or numeric ids.
+// Empty values leave the corresponding file attribute unchanged.
+func ParseFilePerms(mode string, owner string, group string) (FilePerms, error) {
+	var perms FilePerms
+
+	if mode = strings.TrimSpace(environment.GetVar(mode)); mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m == 0 || m > 07777 {
+			return perms, fmt.Errorf("invalid mode=%v, must be an octal file mode, eg: 0644", mode)
+		}
+		perms.Mode = os.FileMode(m)
+	}
+
+	owner = strings.TrimSpace(environment.GetVar(owner))
+	group = strings.TrimSpace(environment.GetVar(group))
+	if !fileOwnership && (owner != "" || group != "") {
+		return perms, errors.New("file owner and group are not supported on this platform")
+	}
+
+	if owner != "" {
+		uid, err := strconv.Atoi(owner)
+		if err != nil {
+			u, lerr := user.Lookup(owner)
+			if lerr != nil {
+				return perms, fmt.Errorf("invalid owner=%v. err=%v", owner, lerr.Error())
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+		perms.Owner, perms.Uid = owner, uid
+	}
+
+	if group != "" {
+		gid, err := strconv.Atoi(group)
+		if err != nil {
+			g, lerr := user.LookupGroup(group)
+			if lerr != nil {
+				return perms, fmt.Errorf("invalid group=%v. err=%v", group, lerr.Error())
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+		perms.Group, perms.Gid = group, gid
+	}
+	return perms, nil
+}
+
+// ParseFilePermissions parses the manager.file-permissions entries, which are
+// in the form "file=mode:owner:group". The owner and group may be left out,
+// and any of the values may be left empty, eg: "alerts.yml=::prometheus".
+func ParseFilePermissions(entries []string) (map[string]FilePerms, error) {
+	res := make(map[string]FilePerms)
+
+	for _, e := range entries {
+		e = strings.TrimSpace(environment.GetVar(e))
+		if e == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(e, "=")
+		if len(keyvalpairs) != 2 {
+			msg := fmt.Sprintf("invalid manager.file-permissions entry \"%s\"", e)
+			return res, errors.New(msg)
+		}
+		vals := strings.Split(keyvalpairs[1], ":")
+		if len(vals) > 3 {
+			msg := fmt.Sprintf("invalid manager.file-permissions entry \"%s\"", e)
+			return res, errors.New(msg)
+		}
+		for len(vals) < 3 {
+			vals = append(vals, "")
+		}
+		key := filepath.Clean(strings.TrimSpace(keyvalpairs[0]))
+		perms, err := ParseFilePerms(vals[0], vals[1], vals[2])
+		if err != nil {
+			return res, fmt.Errorf("invalid manager.file-permissions entry for %v. %v", key, err.Error())
+		}
+		res[key] = perms
+	}
+	return res, nil
+}
+
+// ParseFileCopies parses the manager.file-copies entries, which are in the
+// form "file=path[,path...]". The paths are absolute, and the file is
+// installed to each of them along with its path in the dest-path.
+func ParseFileCopies(entries []string) (map[string][]string, error) {
+	res := make(map[string][]string)
+
+	for _, e := range entries {
+		e = strings.TrimSpace(environment.GetVar(e))
+		if e == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(e, "=")
+		if len(keyvalpairs) != 2 || strings.TrimSpace(keyvalpairs[0]) == "" {
+			msg := fmt.Sprintf("invalid manager.file-copies entry \"%s\"", e)
+			return res, errors.New(msg)
+		}
+		key := filepath.Clean(strings.TrimSpace(keyvalpairs[0]))
+		for _, p := range strings.Split(keyvalpairs[1], ",") {
+			p = strings.TrimSpace(p)
+			if !filepath.IsAbs(p) {
+				return res, fmt.Errorf("invalid manager.file-copies entry for %v. %v is not an absolute path", key, p)
+			}
+			res[key] = append(res[key], filepath.Clean(p))
+		}
+	}
+	return res, nil
+}
+
+// ParseMinSizes parses the manager.min-size entries, which are in the form
+// "file=bytes". The file may be a glob pattern, which is matched against the
+// configured file name, or its base name.
+func ParseMinSizes(entries []string) (map[string]int64, error) {
+	res := make(map[string]int64)
+
+	for _, e := range entries {
+		e = strings.TrimSpace(environment.GetVar(e))
+		if e == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(e, "=")
+		if len(keyvalpairs) != 2 || strings.TrimSpace(keyvalpairs[0]) == "" {
+			msg := fmt.Sprintf("invalid manager.min-size entry \"%s\"", e)
+			return res, errors.New(msg)
+		}
+		key := strings.TrimSpace(keyvalpairs[0])
+		if _, err := path.Match(key, ""); err != nil {
+			return res, fmt.Errorf("invalid manager.min-size pattern %v. err=%v", key, err.Error())
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(keyvalpairs[1]), 10, 64)
+		if err != nil || n < 0 {
+			return res, fmt.Errorf("invalid manager.min-size entry for %v. %v is not a number of bytes", key, keyvalpairs[1])
+		}
+		res[key] = n
+	}
+	return res, nil
+}
+
+// destinationPlaceholder matches the placeholders of the
+// manager.file-destinations paths, eg: %hostname% or %env.REGION%.
+var destinationPlaceholder = regexp.MustCompile(`%([A-Za-z0-9_.]+)%`)
+
+// ParseFileDestinations parses the manager.file-destinations entries, which
+// are in the form "file=path". The file is installed to the path, relative to
+// the dest-path, instead of its own path. The path may use the %manager%,
+// %repo%, %hostname%, %file% (the base name of the file) and %env.<variable>%
+// placeholders.
+func ParseFileDestinations(entries []string, manager string, repo string) (map[string]string, error) {
+	res := make(map[string]string)
+	dests := make(map[string]string)
+
+	for _, e := range entries {
+		e = strings.TrimSpace(environment.GetVar(e))
+		if e == "" {
+			continue
+		}
+		keyvalpairs := strings.Split(e, "=")
+		if len(keyvalpairs) != 2 || strings.TrimSpace(keyvalpairs[0]) == "" || strings.TrimSpace(keyvalpairs[1]) == "" {
+			msg := fmt.Sprintf("invalid manager.file-destinations entry \"%s\"", e)
+			return res, errors.New(msg)
+		}
+		key := filepath.Clean(strings.TrimSpace(keyvalpairs[0]))
+		dest, err := expandDestination(strings.TrimSpace(keyvalpairs[1]), key, manager, repo)
+		if err != nil {
+			return res, fmt.Errorf("invalid manager.file-destinations entry for %v. %v", key, err.Error())
+		}
+		dest = filepath.Clean(dest)
+		if dest == "." || !isRelativePath(dest) {
+			return res, fmt.Errorf("invalid manager.file-destinations entry for %v. %v is not within the dest-path", key, dest)
+		}
+		if other, ok := dests[dest]; ok {
+			return res, fmt.Errorf("invalid manager.file-destinations entry for %v. %v is the destination of %v as well", key, dest, other)
+		}
+		dests[dest] = key
+		res[key] = dest
+	}
+	return res, nil
+}
+
+// expandDestination replaces the placeholders of the destination path of the
+// file.
+func expandDestination(dest string, file string, manager string, repo string) (string, error) {
+	var err error
+	res := destinationPlaceholder.ReplaceAllStringFunc(dest, func(p string) string {
+		name := p[1 : len(p)-1]
+		switch {
+		case name == "manager":
+			return manager
+		case name == "repo":
+			return repo
+		case name == "file":
+			return filepath.Base(file)
+		case name == "hostname":
+			host, herr := os.Hostname()
+			if herr != nil {
+				err = fmt.Errorf("could not get the hostname. err=%v", herr.Error())
+			}
+			return host
+		case strings.HasPrefix(name, "env."):
+			return os.Getenv(name[len("env."):])
+		}
+		err = fmt.Errorf("unknown placeholder %v", p)
+		return p
+	})
+	return res, err
+}
+
+// MatchPatterns returns true if the slash separated name, or its base name,
+// matches any of the glob patterns.
+func MatchPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func GetManagerOpts(entry string, bc *ConfigSettings) (*ManagerOpts, error) {
+	var (
+		err     error
+		MgrOpts ManagerOpts
+	)
+	err = viper.UnmarshalKey(entry, &MgrOpts)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+
+	MgrOpts.ContentType = environment.GetVar(MgrOpts.ContentType)
+	if MgrOpts.ContentType == "" {
+		MgrOpts.ContentType = "auto"
+	}
+	if !IsValidContentType(MgrOpts.ContentType) {
+		msg := fmt.Sprintf("unknown manager.content-type=%v", MgrOpts.ContentType)
+		return &ManagerOpts{}, errors.New(msg)
+	}
+	MgrOpts.ContentType = strings.ToLower(MgrOpts.ContentType)
+
+	MgrOpts.ContentTypes, err = ParseContentTypes(MgrOpts.ContentTypesArray)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+
+	MgrOpts.FilePermissions, err = ParseFilePermissions(MgrOpts.FilePermissionsArray)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+
+	MgrOpts.FileCopies, err = ParseFileCopies(MgrOpts.FileCopiesArray)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+
+	MgrOpts.MinSizes, err = ParseMinSizes(MgrOpts.MinSizeArray)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+
+	for i := range MgrOpts.OptionalConfig {
+		MgrOpts.OptionalConfig[i] = strings.TrimSpace(environment.GetVar(MgrOpts.OptionalConfig[i]))
+		if _, err := path.Match(MgrOpts.OptionalConfig[i], ""); err != nil {
+			msg := fmt.Sprintf("invalid manager.optional-config pattern \"%s\"", MgrOpts.OptionalConfig[i])
+			return &ManagerOpts{}, errors.New(msg)
+		}
+	}
+
+	for i := range MgrOpts.MustNotBeEmpty {
+		MgrOpts.MustNotBeEmpty[i] = strings.TrimSpace(environment.GetVar(MgrOpts.MustNotBeEmpty[i]))
+		if _, err := path.Match(MgrOpts.MustNotBeEmpty[i], ""); err != nil {
+			msg := fmt.Sprintf("invalid manager.must-not-be-empty pattern \"%s\"", MgrOpts.MustNotBeEmpty[i])
+			return &ManagerOpts{}, errors.New(msg)
+		}
+	}
+
+	MgrOpts.RepoPath = filepath.Clean(environment.GetVar(MgrOpts.RepoPath))
+
+	// This means that repo path was == "" and then filepath.Clean sets it to ".".
+	// We don't want that!
+	if MgrOpts.RepoPath == "." {
+		MgrOpts.RepoPath = ""
+	}
+
+	if !IsValidScheme(MgrOpts.Method) {
+		msg := fmt.Sprintf("unknown manager.method=%v", MgrOpts.Method)
+		return &ManagerOpts{}, errors.New(msg)
+	}
+
+	for i := range MgrOpts.PrimaryConfig {
+		MgrOpts.PrimaryConfig[i] = filepath.Clean(environment.GetVar(MgrOpts.PrimaryConfig[i]))
+	}
+
+	var additionalConfig []string
+	for i := range MgrOpts.AdditionalConfig {
+		cfg := strings.TrimSpace(environment.GetVar(MgrOpts.AdditionalConfig[i]))
+		if cfg == "" {
+			continue
+		} else if isGlob(cfg) {
+			// the patterns are expanded on every run, see RefreshGlobs
+			if _, err := path.Match(cfg, ""); err != nil {
+				msg := fmt.Sprintf("invalid manager.additional-config pattern \"%s\"", MgrOpts.AdditionalConfig[i])
+				return &ManagerOpts{}, errors.New(msg)
+			}
+			MgrOpts.AdditionalGlobs = append(MgrOpts.AdditionalGlobs, cfg)
+		} else {
+			additionalConfig = append(additionalConfig, cfg)
+		}
+	}
+	MgrOpts.AdditionalConfig = additionalConfig
+
+	var syncDirs []string
+	for i := range MgrOpts.SyncDirs {
+		dir := strings.TrimSpace(environment.GetVar(MgrOpts.SyncDirs[i]))
+		if dir == "" {
+			continue
+		}
+		dir = filepath.ToSlash(filepath.Clean(dir))
+		// a sync-dir gets mirrored, including deletes, underneath the
+		// dest-path, so it can neither be the dest-path itself nor escape it
+		if dir == "." || filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+			msg := fmt.Sprintf("invalid manager.sync-dirs entry \"%s\"", MgrOpts.SyncDirs[i])
+			return &ManagerOpts{}, errors.New(msg)
+		}
+		syncDirs = append(syncDirs, dir)
+	}
+	MgrOpts.SyncDirs = syncDirs
+
+	for i := range MgrOpts.SyncExclude {
+		MgrOpts.SyncExclude[i] = strings.TrimSpace(environment.GetVar(MgrOpts.SyncExclude[i]))
+		if _, err := filepath.Match(MgrOpts.SyncExclude[i], ""); err != nil {
+			msg := fmt.Sprintf("invalid manager.sync-exclude pattern \"%s\"", MgrOpts.SyncExclude[i])
+			return &ManagerOpts{}, errors.New(msg)
+		}
+	}
+
+	repoSplit := strings.Split(entry, ".")
+	MgrOpts.Repo = strings.Join(repoSplit[1:], ".")
+
+	MgrOpts.FileDestinations, err = ParseFileDestinations(MgrOpts.FileDestinationsArray, repoSplit[0], MgrOpts.Repo)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+	// the primary config files get merged into the primary-config-name
+	for _, p := range MgrOpts.PrimaryConfig {
+		if _, ok := MgrOpts.FileDestinations[p]; ok {
+			msg := fmt.Sprintf("manager.file-destinations entry for %v, which is a primary-config", p)
+			return &ManagerOpts{}, errors.New(msg)
+		}
+	}
+
+	if len(MgrOpts.PrimaryConfig) < 1 && len(MgrOpts.FileGroups) < 1 {
+		return &ManagerOpts{}, errors.New("no manager.primary-config or manager.file-groups defined")
+	}
+
+	// the primary config files get merged together, which makes no sense for binary files
+	for _, p := range MgrOpts.PrimaryConfig {
+		if isGlob(p) {
+			msg := fmt.Sprintf("manager.primary-config %v can not be a pattern", p)
+			return &ManagerOpts{}, errors.New(msg)
+		}
+		if MgrOpts.IsBinary(p) {
+			msg := fmt.Sprintf("manager.primary-config %v can not be binary", p)
+			return &ManagerOpts{}, errors.New(msg)
+		}
+	}
+
+	managerNameSlice := strings.Split(entry, ".")
+	var managerName string
+	if len(managerNameSlice) >= 1 {
+		managerName = managerNameSlice[0]
+
+	} else {
+		// shouldn't get this, but hey.
+		managerName = "unconfigured"
+	}
+
+	methodOpts := fmt.Sprintf("%s.%s", entry, MgrOpts.Method)
+	mopts, err := methods.New(&managerName, MgrOpts.Method, &methodOpts)
+	if err != nil {
+		return &ManagerOpts{}, err
+	}
+	MgrOpts.Opts = mopts
+
+	return &MgrOpts, nil
+}
+
+func GetConfigManager(entry string, bc *ConfigSettings) error {
+	var (
+		err error
+		Mgr Manager
+	)
+
+	Mgr.Name = entry
+	Mgr.ReloadManager = false
+	Mgr.GoodCache = false
+
+	err = viper.UnmarshalKey(entry, &Mgr)
+	if err != nil {
+		return err
+	}
+
+	if len(Mgr.Repos) < 1 {
+		msg := fmt.Sprintf("No repos configured for manager %s", entry)
+		return errors.New(msg)
+	}
+
+	envCleanFiles := strings.ToLower(environment.GetVar(Mgr.CfgCleanFiles))
+	if envCleanFiles == "true" {
+		Mgr.CleanFiles = true
+	} else if envCleanFiles == "false" {
+		Mgr.CleanFiles = false
+	} else {
+		Mgr.CleanFiles = false
+	}
+
+	for _, patterns := range [][]string{Mgr.CleanFilesInclude, Mgr.CleanFilesExclude} {
+		for i := range patterns {
+			patterns[i] = strings.TrimSpace(environment.GetVar(patterns[i]))
+			if _, err := path.Match(patterns[i], ""); err != nil {
+				msg := fmt.Sprintf("Invalid clean-files pattern \"%s\" for manager %s", patterns[i], entry)
+				return errors.New(msg)
+			}
+		}
+	}
+
+	envEnableCache := strings.ToLower(environment.GetVar(Mgr.CfgEnableCache))
+	if envEnableCache == "true" {
+		Mgr.EnableCache = true
+	} else {
+		Mgr.EnableCache = false
+	}
+
+	envDisableMarkers := strings.ToLower(environment.GetVar(Mgr.CfgDisableMarkers))
+	if envDisableMarkers == "true" {
+		Mgr.DisableMarkers = true
+	} else {
+		Mgr.DisableMarkers = false
+	}
+
+	Mgr.HeaderMarker = strings.TrimSpace(environment.GetVar(Mgr.HeaderMarker))
+	if Mgr.HeaderMarker == "" {
+		Mgr.HeaderMarker = butlerHeader
+	}
+	Mgr.FooterMarker = strings.TrimSpace(environment.GetVar(Mgr.FooterMarker))
+	if Mgr.FooterMarker == "" {
+		Mgr.FooterMarker = butlerFooter
+	}
+
+	envReloadOnRestore := strings.ToLower(environment.GetVar(Mgr.CfgReloadOnRestore))
+	if envReloadOnRestore == "true" {
+		Mgr.ReloadOnRestore = true
+	} else {
+		Mgr.ReloadOnRestore = false
+	}
+
+	Mgr.MaxRollbacks = DefaultMaxRollbacks
+	if envMaxRollbacks := strings.TrimSpace(environment.GetVar(Mgr.CfgMaxRollbacks)); envMaxRollbacks != "" {
+		Mgr.MaxRollbacks, err = strconv.Atoi(envMaxRollbacks)
+		if err != nil || Mgr.MaxRollbacks < 0 {
+			msg := fmt.Sprintf("Invalid max-rollback-attempts=%v for manager %s", envMaxRollbacks, entry)
+			return errors.New(msg)
+		}
+	}
+
+	Mgr.SchedulerCron = strings.TrimSpace(environment.GetVar(Mgr.SchedulerCron))
+	if Mgr.SchedulerCron != "" {
+		Mgr.Schedule, err = scheduler.Parse(Mgr.SchedulerCron)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid scheduler-cron=%v for manager %s. err=%v", Mgr.SchedulerCron, entry, err.Error())
+			return errors.New(msg)
+		}
+	} else if strings.TrimSpace(Mgr.CfgSchedulerInterval) != "" {
+		interval, err := parseNonNegativeInt(Mgr.CfgSchedulerInterval)
+		if err != nil || interval == 0 {
+			msg := fmt.Sprintf("Invalid scheduler-interval=%v for manager %s", Mgr.CfgSchedulerInterval, entry)
+			return errors.New(msg)
+		}
+		Mgr.Schedule = scheduler.Every(time.Duration(interval) * time.Second)
+	}
+	// the splay of the globals schedule applies to the schedule of the
+	// manager, unless it has a splay of its own
+	if strings.TrimSpace(Mgr.CfgSchedulerSplay) != "" {
+		Mgr.SchedulerSplay, err = parseNonNegativeInt(Mgr.CfgSchedulerSplay)
+		if err != nil || Mgr.Schedule == nil {
+			msg := fmt.Sprintf("Invalid scheduler-splay=%v for manager %s, it needs a scheduler-interval or scheduler-cron", Mgr.CfgSchedulerSplay, entry)
+			return errors.New(msg)
+		}
+	} else if Mgr.Schedule != nil {
+		Mgr.SchedulerSplay = bc.Globals.SchedulerSplay
+	}
+	if Mgr.Schedule != nil {
+		Mgr.Schedule = scheduler.WithSplay(Mgr.Schedule, time.Duration(Mgr.SchedulerSplay)*time.Second)
+	}
+
+	Mgr.ReloadDebounce, err = parseNonNegativeInt(Mgr.CfgReloadDebounce)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid reload-debounce=%v for manager %s", Mgr.CfgReloadDebounce, entry)
+		return errors.New(msg)
+	}
+	Mgr.ReloadMinInterval, err = parseNonNegativeInt(Mgr.CfgReloadMinInterval)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid reload-min-interval=%v for manager %s", Mgr.CfgReloadMinInterval, entry)
+		return errors.New(msg)
+	}
+
+	Mgr.ReloadRetries, err = parseNonNegativeInt(Mgr.CfgReloadRetries)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid reload-retries=%v for manager %s", Mgr.CfgReloadRetries, entry)
+		return errors.New(msg)
+	}
+	Mgr.ReloadRetryWaitMin = DefaultReloadRetryWaitMin
+	if strings.TrimSpace(Mgr.CfgReloadRetryWaitMin) != "" {
+		Mgr.ReloadRetryWaitMin, err = parseNonNegativeInt(Mgr.CfgReloadRetryWaitMin)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid reload-retry-wait-min=%v for manager %s", Mgr.CfgReloadRetryWaitMin, entry)
+			return errors.New(msg)
+		}
+	}
+	Mgr.ReloadRetryWaitMax = DefaultReloadRetryWaitMax
+	if strings.TrimSpace(Mgr.CfgReloadRetryWaitMax) != "" {
+		Mgr.ReloadRetryWaitMax, err = parseNonNegativeInt(Mgr.CfgReloadRetryWaitMax)
+		if err != nil || Mgr.ReloadRetryWaitMax < Mgr.ReloadRetryWaitMin {
+			msg := fmt.Sprintf("Invalid reload-retry-wait-max=%v for manager %s", Mgr.CfgReloadRetryWaitMax, entry)
+			return errors.New(msg)
+		}
+	}
+
+	Mgr.BreakerThreshold, err = parseNonNegativeInt(Mgr.CfgBreakerThreshold)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid breaker-threshold=%v for manager %s", Mgr.CfgBreakerThreshold, entry)
+		return errors.New(msg)
+	}
+	Mgr.BreakerInterval = DefaultBreakerInterval
+	if strings.TrimSpace(Mgr.CfgBreakerInterval) != "" {
+		Mgr.BreakerInterval, err = parseNonNegativeInt(Mgr.CfgBreakerInterval)
+		if err != nil || Mgr.BreakerInterval == 0 {
+			msg := fmt.Sprintf("Invalid breaker-interval=%v for manager %s", Mgr.CfgBreakerInterval, entry)
+			return errors.New(msg)
+		}
+	}
+
+	Mgr.StaleThreshold, err = parseNonNegativeInt(Mgr.CfgStaleThreshold)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid stale-threshold=%v for manager %s", Mgr.CfgStaleThreshold, entry)
+		return errors.New(msg)
+	}
+
+	envCanary := strings.ToLower(environment.GetVar(Mgr.CfgCanary))
+	if envCanary == "true" {
+		Mgr.Canary = true
+	} else {
+		Mgr.Canary = false
+	}
+	Mgr.CanarySoak = DefaultCanarySoak
+	if strings.TrimSpace(Mgr.CfgCanarySoak) != "" {
+		Mgr.CanarySoak, err = parseNonNegativeInt(Mgr.CfgCanarySoak)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid canary-soak=%v for manager %s", Mgr.CfgCanarySoak, entry)
+			return errors.New(msg)
+		}
+	}
+
+	for i := range Mgr.DependsOn {
+		Mgr.DependsOn[i] = strings.TrimSpace(environment.GetVar(Mgr.DependsOn[i]))
+	}
+
+	Mgr.WebhookRepo = strings.Trim(strings.TrimSpace(environment.GetVar(Mgr.WebhookRepo)), "/")
+	Mgr.WebhookBranch = strings.TrimSpace(environment.GetVar(Mgr.WebhookBranch))
+	if Mgr.WebhookRepo == "" && (Mgr.WebhookBranch != "" || len(Mgr.WebhookPaths) > 0) {
+		msg := fmt.Sprintf("webhook-branch and webhook-paths require a webhook-repo for manager %s", entry)
+		return errors.New(msg)
+	}
+
+	Mgr.BlackoutWindows, err = ParseBlackoutWindows(Mgr.BlackoutWindowsArray)
+	if err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	Mgr.HostSelector, err = ParseHostSelectors(Mgr.HostSelectorArray)
+	if err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	if err = Mgr.Hooks.Init(); err != nil {
+		msg := fmt.Sprintf("Invalid hooks timeout=%v for manager %s", Mgr.Hooks.CfgTimeout, entry)
+		return errors.New(msg)
+	}
+
+	Mgr.Perms, err = ParseFilePerms(Mgr.CfgMode, Mgr.CfgOwner, Mgr.CfgGroup)
+	if err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	// files are fsync'd unless explicitly disabled
+	envFsync := strings.ToLower(environment.GetVar(Mgr.CfgFsync))
+	if envFsync == "false" {
+		Mgr.Fsync = false
+	} else {
+		Mgr.Fsync = true
+	}
+
+	envSyncDir := strings.ToLower(environment.GetVar(Mgr.CfgSyncDir))
+	if envSyncDir == "true" {
+		Mgr.SyncDir = true
+	} else {
+		Mgr.SyncDir = false
+	}
+
+	envManagerTimeoutOk := strings.ToLower(environment.GetVar(Mgr.CfgManagerTimeoutOk))
+	if envManagerTimeoutOk == "true" {
+		Mgr.ManagerTimeoutOk = true
+	} else {
+		Mgr.ManagerTimeoutOk = false
+	}
+
+	Mgr.CachePath = filepath.Clean(environment.GetVar(Mgr.CachePath))
+	if Mgr.EnableCache && (Mgr.CachePath == "" || Mgr.CachePath == ".") {
+		msg := fmt.Sprintf("Caching Enabled but manager.cache-path is unset for manager %s", entry)
+		return errors.New(msg)
+	}
+
+	Mgr.CacheRetention = DefaultCacheRetention
+	if envCacheRetention := strings.TrimSpace(environment.GetVar(Mgr.CfgCacheRetention)); envCacheRetention != "" {
+		Mgr.CacheRetention, err = strconv.Atoi(envCacheRetention)
+		if err != nil || Mgr.CacheRetention < 1 {
+			msg := fmt.Sprintf("Invalid cache-retention=%v for manager %s", envCacheRetention, entry)
+			return errors.New(msg)
+		}
+	}
+
+	if Mgr.EnableCache {
+		// snapshots are kept per manager, in case managers share a cache-path
+		Mgr.Snapshots = NewSnapshotStore(entry, filepath.Join(Mgr.CachePath, entry), Mgr.CacheRetention)
+		if snap, _ := Mgr.Snapshots.Latest(); snap != nil {
+			log.Infof("helpers.GetConfigManager()[count=%v][manager=%v]: found known good snapshot %v in cache.", cmHandlerCounter, entry, snap.ID)
+			Mgr.GoodCache = true
+		}
+	}
+
+	// the rollback attempts carry over to the re-created manager, and across
+	// restarts of butler
+	if state := GetManagerState(bc.Globals.StatusFile, entry); state != nil {
+		Mgr.RollbackAttempts = state.RollbackAttempts
+	}
+
+	Mgr.DiffRetention = DefaultDiffRetention
+	if envDiffRetention := strings.TrimSpace(environment.GetVar(Mgr.CfgDiffRetention)); envDiffRetention != "" {
+		Mgr.DiffRetention, err = strconv.Atoi(envDiffRetention)
+		if err != nil || Mgr.DiffRetention < 0 {
+			msg := fmt.Sprintf("Invalid diff-retention=%v for manager %s", envDiffRetention, entry)
+			return errors.New(msg)
+		}
+	}
+
+	// diffs are logged unless explicitly disabled
+	envLogDiffs := strings.ToLower(environment.GetVar(Mgr.CfgLogDiffs))
+	if envLogDiffs == "false" {
+		Mgr.LogDiffs = false
+	} else {
+		Mgr.LogDiffs = true
+	}
+
+	for i := range Mgr.DiffMask {
+		Mgr.DiffMask[i] = environment.GetVar(Mgr.DiffMask[i])
+	}
+
+	// a diff-retention of 0 disables diffs altogether
+	if Mgr.DiffRetention > 0 {
+		Mgr.Diffs, err = NewDiffStore(entry, Mgr.DiffRetention, Mgr.LogDiffs, Mgr.DiffMask)
+		if err != nil {
+			msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+			return errors.New(msg)
+		}
+	}
+
+	Mgr.DestPath = filepath.Clean(environment.GetVar(Mgr.DestPath))
+	Mgr.PrimaryConfigName = filepath.Clean(environment.GetVar(Mgr.PrimaryConfigName))
+	if Mgr.DestPath == "" {
+		msg := fmt.Sprintf("No dest-path configured for manager %s", entry)
+		return errors.New(msg)
+	}
+
+	if err = Mgr.initReleases(); err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	if err = Mgr.initCopyLock(); err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	if err = Mgr.initXattrs(); err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	Mgr.ManagerOpts = make(map[string]*ManagerOpts)
+	for _, m := range Mgr.Repos {
+		if bc.Managers == nil {
+			bc.Managers = make(map[string]*Manager)
+		}
+		bc.Managers[entry] = &Mgr
+		mopts := fmt.Sprintf("%s.%s", entry, m)
+		opts, err := GetManagerOpts(mopts, bc)
+		if err != nil {
+			return err
+		}
+		bc.Managers[entry].ManagerOpts[mopts] = opts
+	}
+
+	if err = Mgr.initFileGroups(entry); err != nil {
+		msg := fmt.Sprintf("%v for manager %s", err.Error(), entry)
+		return errors.New(msg)
+	}
+
+	reloader, err := reloaders.New(entry)
+	if err != nil {
+		log.Warnf("helpers.GetConfigManager()[count=%v][manager=%v]: %v.", cmHandlerCounter, entry, err.Error())
+		reloader = nil
+	}
+	// the files of the file groups with a reloader are reloaded with it
+	reloader = Mgr.fileGroupReloader(reloader)
+	if reloader == nil {
+		// If we've got no reloader for this manager, then there is no need to cache
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: No reloader has been defined for manager. Setting EnableCache to false", cmHandlerCounter, entry)
+		Mgr.EnableCache = false
+	}
+
+	Mgr.Validators, err = validators.New(entry)
+	if err != nil {
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: could not get validators. err=%s", cmHandlerCounter, entry, err.Error())
+		return err
+	}
+
+	Mgr.PostValidators, err = validators.NewPost(entry)
+	if err != nil {
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: could not get post-validators. err=%s", cmHandlerCounter, entry, err.Error())
+		return err
+	}
+
+	Mgr.HealthCheck, err = healthchecks.New(entry)
+	if err != nil {
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: could not get health check. err=%s", cmHandlerCounter, entry, err.Error())
+		return err
+	}
+
+	Mgr.Destination, err = destinations.New(entry)
+	if err != nil {
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: could not get destination. err=%s", cmHandlerCounter, entry, err.Error())
+		return err
+	}
+
+	Mgr.MustacheSubs, err = ParseMustacheSubs(Mgr.MustacheSubsArray)
+	if err != nil {
+		log.Debugf("helpers.GetConfigManager()[count=%v][manager=%v]: could not get mustache subs. err=%s", cmHandlerCounter, entry, err.Error())
+		return err
+	}
+	m := bc.Managers[entry]
+	m.Reloader = reloader
+	bc.Managers[entry] = m
+	return nil
+}
+
+func ParseConfig(config []byte) error {
+	var (
+		//handlers []string
+		Config  ConfigSettings
+		Globals ConfigGlobals
+	)
+	// The  configuration is in TOML format
+	viper.SetConfigType("toml")
+
+	// We grab the config from a remote repo so it's in []byte format. let's see
+	// if we can process it.
+	err := viper.ReadConfig(bytes.NewBuffer(config))
+	if err != nil {
+		return err
+	}
+
+	Config = ConfigSettings{}
+
+	// Let's start piecing together the globals
+	err = viper.UnmarshalKey("globals", &Globals)
+	if err != nil {
+		log.Fatalf("Unable to decode into struct, %v", err)
+	}
+	Config.Globals = Globals
+
+	// Let's grab some of the global settings
+	if Config.Globals.SchedulerInterval == 0 {
+		Config.Globals.SchedulerInterval = ConfigSchedulerInterval
+	}
+
+	log.Debugf("ParseConfig(): globals.config-managers=%#v", Config.Globals.Managers)
+	log.Debugf("ParseConfig(): len(globals.config-managers)=%v", len(Config.Globals.Managers))
+
+	// If there are no entries for config-managers, then the Unmarshal will create an empty array
+	if len(Config.Globals.Managers) < 1 {
+		if Config.Globals.ExitOnFailure {
+			log.Fatalf("ParseConfig(): globals.config-managers has no entries! exiting...")
+		} else {
+			log.Debugf("ParseConfig(): globals.config-managers has no entries!")
+			return errors.New("globals.config-managers has no entries. Nothing to do")
+		}
+	}
+
+	Config.Managers = make(map[string]*Manager)
+	// Now let's start processing the managers. This is going
+	for _, entry := range Config.Globals.Managers {
+		if !viper.IsSet(entry) {
+			if Config.Globals.ExitOnFailure {
+				log.Fatalf("ParseConfig(): %v is not in the configuration as a manager! exiting...", entry)
+			} else {
+				log.Debugf("ParseConfig(): %v is not in the configuration as a manager", entry)
+				msg := fmt.Sprintf("Cannot find manager for %s", entry)
+				return errors.New(msg)
+			}
+		} else {
+			err = GetConfigManager(entry, &Config)
+			if err != nil {
+				if Config.Globals.ExitOnFailure {
+					log.Fatalf("ParseConfig(): could not retrieve config options for %v. err=%v", entry, err.Error())
+				} else {
+					log.Debugf("ParseConfig(): could not retrieve config options for %v. err=%v", entry, err.Error())
+					msg := fmt.Sprintf("could not retrieve config options for %v. err=%v", entry, err.Error())
+					return errors.New(msg)
+				}
+			}
+		}
+	}
+
+	log.Debugf("Config.Managers=%#v", Config.Managers)
+	return nil
+}
+
+func NewButlerConfig(opts *ButlerConfigOpts) (*ButlerConfig, error) {
+	var (
+		cfg ButlerConfig
+	)
+	cfg.FirstRun = true
+	cfg.InsecureSkipVerify = opts.InsecureSkipVerify
+	cfg.url = opts.URL
+	cfg.defaults = opts.Defaults
+	cfg.strict = opts.Strict
+	cfg.bootstrap = opts.Bootstrap
+	cfg.methodOptions = opts.MethodOptions
+
+	if !IsValidScheme(cfg.Scheme()) {
+		return &cfg, fmt.Errorf("%v is not a supported scheme.", cfg.Scheme())
+	} else {
+		return &cfg, nil
+	}
+}
+
+func NewConfigChanEvent() *ConfigChanEvent {
+	var (
+		c ConfigChanEvent
+	)
+	c = ConfigChanEvent{}
+	c.Repo = make(map[string]*RepoFileEvent)
+	c.Install = NewInstallOpts()
+	return &c
+}
+
+func NewConfigClient(bc *ButlerConfig) (*ConfigClient, error) {
+	var c ConfigClient
+	if bc.methodOptions != "" {
+		method, err := newConfigMethod(bc.methodOptions, bc.URL())
+		if err != nil {
+			log.Errorf("Config::Init(): could not initialize butler config method. err=%s", err.Error())
+			return &ConfigClient{}, err
+		}
+		c.Scheme = bc.Scheme()
+		c.Method = method
+		return &c, nil
+	}
+	opts := bc.MethodOpts
+	method, err := methods.New(nil, opts.GetScheme(), nil)
+	// we can skip this check if it's blob.
+	// should figure out a better way for this
+	if (err != nil) && (opts.GetScheme() != "blob") {
+		if err.Error() == "Generic method handler is not very useful" {
+			log.Errorf("Config::Init(): could not initialize butler config (check if using valid scheme). err=%s", err.Error())
+			return &ConfigClient{}, fmt.Errorf("\"%s\" is an invalid config retrieval method.", bc.Scheme())
+
+		} else {
+			log.Errorf("Config::Init(): could not initialize butler config. err=%s", err.Error())
+			return &ConfigClient{}, err
+		}
+	}
+	log.Warnf("ButlerConfig::Init() Above \"NewHttpMethod(): could not convert\" warnings may be safely disregarded.")
+	switch opts.GetScheme() {
+	case "http", "https":
+		o := opts.(methods.HTTPMethodOpts)
+		m := method.(methods.HTTPMethod)
+		m.AuthType = o.HTTPAuthType
+		m.AuthToken = o.HTTPAuthToken
+		m.InsecureSkipVerify = bc.InsecureSkipVerify
+		c.Scheme = o.GetScheme()
+		c.HTTPClient = retryablehttp.NewClient()
+		c.HTTPClient.Logger.SetFlags(0)
+		c.HTTPClient.Logger.SetOutput(ioutil.Discard)
+		c.SetTimeout(o.Timeout)
+		c.SetRetryMax(o.Retries)
+		c.SetRetryWaitMax(o.RetryWaitMax)
+		c.SetRetryWaitMin(o.RetryWaitMin)
+		c.Method = m
+	case "s3":
+		o := opts.(methods.S3MethodOpts)
+		c.Scheme = o.GetScheme()
+		c.Method, err = methods.NewS3MethodWithOpts(o)
+		if err != nil {
+			return &ConfigClient{}, err
+		}
+	case "file":
+		o := opts.(methods.FileMethodOpts)
+		c.Scheme = o.GetScheme()
+		c.Method, err = methods.NewFileMethodWithURL(bc.URL())
+		if err != nil {
+			return &ConfigClient{}, err
+		}
+	case "blob":
+		o := opts.(methods.BlobMethodOpts)
+		c.Scheme = o.GetScheme()
+		c.Method, err = methods.NewBlobMethodWithAccountAndKey(o.AccountName, o.AccountKey)
+		if err != nil {
+			return &ConfigClient{}, err
+		}
+	case "etcd":
+		o := opts.(methods.EtcdMethodOpts)
+		c.Scheme = o.GetScheme()
+		c.Method, err = methods.NewEtcdMethodWithEndpoints(o.Endpoints, bc.InsecureSkipVerify)
+		if err != nil {
+			return &ConfigClient{}, err
+		}
+	default:
+		if methods.IsPlugin(opts.GetScheme()) {
+			c.Scheme = opts.GetScheme()
+			c.Method = method
+			break
+		}
+		errMsg := fmt.Sprintf("Unsupported butler config scheme: %s", opts.GetScheme())
+		return &ConfigClient{}, errors.New(errMsg)
+	}
+	return &c, nil
+}
+
+func NewConfigSettings() *ConfigSettings {
+	return &ConfigSettings{}
+}
+
+// parseNonNegativeInt parses an optional, non-negative, integer option, such
+// as a number of seconds. It is 0 when the option is not set.
+func parseNonNegativeInt(opt string) (int, error) {
+	val := strings.TrimSpace(environment.GetVar(opt))
+	if val == "" {
+		return 0, nil
+	}
+	res, err := strconv.Atoi(val)
+	if err != nil || res < 0 {
+		return 0, errors.New("invalid non-negative integer")
+	}
+	return res, nil
+}
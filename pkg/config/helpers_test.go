@@ -0,0 +1,521 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/validators"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestIsValidScheme(c *C) {
+	var t bool
+	for _, scheme := range ValidSchemes {
+		t = IsValidScheme(scheme)
+		c.Assert(t, Equals, true)
+	}
+	t = IsValidScheme("asdsadf")
+	c.Assert(t, Equals, false)
+}
+
+func (s *ConfigTestSuite) TestrunTextValidate(c *C) {
+	var testTextConfigGood = []byte(`#butlerstart
+some text
+some more text
+#butlerend`)
+	var testTextConfigBad1 = []byte(`some text
+some more text
+#butlerend`)
+	var testTextConfigBad2 = []byte(`#butlerstart
+some text
+some more text`)
+	var testTextConfigBad3 = []byte(`some text
+some more text`)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigGood), "test-manager", butlerHeader, butlerFooter), IsNil)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigBad1), "test-manager", butlerHeader, butlerFooter), NotNil)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigBad2), "test-manager", butlerHeader, butlerFooter), NotNil)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigBad3), "test-manager", butlerHeader, butlerFooter), NotNil)
+}
+
+func (s *ConfigTestSuite) TestrunJsonValidate(c *C) {
+	var testJSONConfigGood = []byte(`{"foo": "bar", "baz": ["one", "two", "three"] }`)
+	var testJSONConfigBad = []byte(`{"foo": "bar", ["one", "two", "three"] }`)
+	c.Assert(runJSONValidate(bytes.NewReader(testJSONConfigGood), "test-manager"), IsNil)
+	c.Assert(runJSONValidate(bytes.NewReader(testJSONConfigBad), "test-manager"), NotNil)
+}
+
+func (s *ConfigTestSuite) TestrunYamlValidate(c *C) {
+	var testYamlConfigGood = []byte(`#butlerstart
+modules:
+  http_200x:
+    prober: http
+    http:
+  icmp:
+    prober:icmp
+#butlerend`)
+	var testYamlConfigBad1 = []byte(`modules:
+  http_200x:
+    prober: http
+    http:
+  icmp:
+    prober:icmp
+#butlerend`)
+	var testYamlConfigBad2 = []byte(`modules:
+http_200x:
+    prober: http
+    http:
+  icmp:
+    prober:icmp`)
+	c.Assert(runYamlValidate(bytes.NewReader(testYamlConfigGood), "test-manager", butlerHeader, butlerFooter), IsNil)
+	c.Assert(runYamlValidate(bytes.NewReader(testYamlConfigBad1), "test-manager", butlerHeader, butlerFooter), NotNil)
+	c.Assert(runYamlValidate(bytes.NewReader(testYamlConfigBad2), "test-manager", butlerHeader, butlerFooter), NotNil)
+}
+
+func (s *ConfigTestSuite) TestgetFileExtension(c *C) {
+	c.Assert(getFileExtension("foo.yaml"), Equals, "yaml")
+	c.Assert(getFileExtension("foo.yml"), Equals, "yaml")
+	c.Assert(getFileExtension("foo.json"), Equals, "json")
+	c.Assert(getFileExtension("foo.toml"), Equals, "toml")
+	c.Assert(getFileExtension("foo.hcl"), Equals, "hcl")
+	c.Assert(getFileExtension("foo.ini"), Equals, "ini")
+	c.Assert(getFileExtension("foo.xml"), Equals, "xml")
+	c.Assert(getFileExtension("foo.asdfasdf"), Equals, "text")
+}
+
+func (s *ConfigTestSuite) TestrunTomlHclIniXMLValidate(c *C) {
+	c.Assert(runTomlValidate(bytes.NewReader([]byte("[foo]\nbar = \"baz\"\n")), "test-manager"), IsNil)
+	c.Assert(runTomlValidate(bytes.NewReader([]byte("[foo\nbar = baz\n")), "test-manager"), NotNil)
+	c.Assert(runHclValidate(bytes.NewReader([]byte("foo \"bar\" {\n  baz = 1\n}\n")), "test-manager"), IsNil)
+	c.Assert(runHclValidate(bytes.NewReader([]byte("foo \"bar\" {\n  baz = \n")), "test-manager"), NotNil)
+	c.Assert(runIniValidate(bytes.NewReader([]byte("[foo]\nbar = baz\n")), "test-manager"), IsNil)
+	c.Assert(runIniValidate(bytes.NewReader([]byte("[foo\nbar = baz\n")), "test-manager"), NotNil)
+	c.Assert(runXMLValidate(bytes.NewReader([]byte("<foo><bar>baz</bar></foo>")), "test-manager"), IsNil)
+	c.Assert(runXMLValidate(bytes.NewReader([]byte("<foo><bar>baz</foo>")), "test-manager"), NotNil)
+	c.Assert(runXMLValidate(bytes.NewReader([]byte("")), "test-manager"), NotNil)
+}
+
+func (s *ConfigTestSuite) TestParseContentTypes(c *C) {
+	types, err := ParseContentTypes([]string{"alerts/foo.json=JSON", " bar.conf = ini "})
+	c.Assert(err, IsNil)
+	c.Assert(types["alerts/foo.json"], Equals, "json")
+	c.Assert(types["bar.conf"], Equals, "ini")
+	_, err = ParseContentTypes([]string{"foo.json"})
+	c.Assert(err, NotNil)
+	_, err = ParseContentTypes([]string{"foo.json=bogus"})
+	c.Assert(err, NotNil)
+
+	opts := ManagerOpts{ContentType: "auto", ContentTypes: types}
+	c.Assert(opts.GetContentType("alerts/foo.json"), Equals, "json")
+	c.Assert(opts.GetContentType("other/bar.conf"), Equals, "ini")
+	c.Assert(opts.GetContentType("prometheus.yml"), Equals, "auto")
+}
+
+func (s *ConfigTestSuite) TestcheckButlerHeaderFooter(c *C) {
+	c.Assert(checkButlerHeaderFooter([]byte(butlerHeader), butlerHeader, butlerFooter), Equals, true)
+	c.Assert(checkButlerHeaderFooter([]byte(butlerFooter), butlerHeader, butlerFooter), Equals, true)
+	c.Assert(checkButlerHeaderFooter([]byte("asdfawsdf"), butlerHeader, butlerFooter), Equals, false)
+	c.Assert(checkButlerHeaderFooter([]byte(""), "", ""), Equals, false)
+	c.Assert(checkButlerHeaderFooter([]byte("// start"), "// start", "// end"), Equals, true)
+}
+
+func (s *ConfigTestSuite) TestCustomMarkers(c *C) {
+	var testTextConfigGood = []byte(`// start
+some text
+// end`)
+	var testTextConfigNoMarkers = []byte(`some text`)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigGood), "test-manager", "// start", "// end"), IsNil)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigGood), "test-manager", butlerHeader, butlerFooter), NotNil)
+	c.Assert(runTextValidate(bytes.NewReader(testTextConfigNoMarkers), "test-manager", "", ""), IsNil)
+	c.Assert(runYamlValidate(bytes.NewReader([]byte("foo: bar")), "test-manager", "", ""), IsNil)
+
+	mgr := Manager{HeaderMarker: "// start", FooterMarker: "// end"}
+	header, footer := mgr.GetMarkers()
+	c.Assert(header, Equals, "// start")
+	c.Assert(footer, Equals, "// end")
+	mgr.DisableMarkers = true
+	header, footer = mgr.GetMarkers()
+	c.Assert(header, Equals, "")
+	c.Assert(footer, Equals, "")
+}
+
+func (s *ConfigTestSuite) TestCompareAndCopyBinary(c *C) {
+	// not newline terminated, and contains a butler header, both of which
+	// would be mangled by CopyFile
+	data := []byte("\x00\x01#butlerstart\n\xff\xfe")
+	src, err := ioutil.TempFile("/tmp", "bbinary")
+	c.Assert(err, IsNil)
+	src.Write(data)
+	src.Close()
+	defer os.Remove(src.Name())
+	dst := src.Name() + ".dst"
+	defer os.Remove(dst)
+
+	c.Assert(CompareAndCopyBinary(src.Name(), dst, "test-manager", NewInstallOpts()), Equals, true)
+	out, err := ioutil.ReadFile(dst)
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, data)
+	c.Assert(CompareAndCopyBinary(src.Name(), dst, "test-manager", NewInstallOpts()), Equals, false)
+
+	opts := ManagerOpts{ContentType: "auto", ContentTypes: map[string]string{"GeoIP.mmdb": "binary"}}
+	c.Assert(opts.IsBinary("geo/GeoIP.mmdb"), Equals, true)
+	c.Assert(opts.IsBinary("prometheus.yml"), Equals, false)
+	c.Assert(ValidateConfig(NewValidateOpts().WithContentType("binary").WithFileName("GeoIP.mmdb").WithData(data)), IsNil)
+}
+
+func (s *ConfigTestSuite) TestInstallFile(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "binstall")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	dst := dir + "/prometheus.yml"
+
+	// new files are created 0644
+	c.Assert(InstallFile(bytes.NewReader([]byte("foo: bar\n")), dst, NewInstallOpts()), IsNil)
+	fi, err := os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0644))
+
+	// existing files keep their mode, and are replaced rather than rewritten
+	c.Assert(os.Chmod(dst, 0600), IsNil)
+	c.Assert(InstallFile(bytes.NewReader([]byte("foo: baz\n")), dst, InstallOpts{Fsync: true, SyncDir: true}), IsNil)
+	nfi, err := os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(nfi.Mode().Perm(), Equals, os.FileMode(0600))
+	c.Assert(os.SameFile(fi, nfi), Equals, false)
+	out, err := ioutil.ReadFile(dst)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "foo: baz\n")
+
+	// no temporary files are left behind
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(len(files), Equals, 1)
+
+	c.Assert(InstallFile(bytes.NewReader([]byte("foo: bar\n")), dir+"/nonexistent/prometheus.yml", NewInstallOpts()), NotNil)
+}
+
+func (s *ConfigTestSuite) TestParseFilePerms(c *C) {
+	perms, err := ParseFilePerms("", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(perms, Equals, FilePerms{})
+
+	perms, err = ParseFilePerms("0640", "0", "0")
+	c.Assert(err, IsNil)
+	c.Assert(perms, Equals, FilePerms{Mode: 0640, Owner: "0", Group: "0", Uid: 0, Gid: 0})
+
+	_, err = ParseFilePerms("0999", "", "")
+	c.Assert(err, NotNil)
+	_, err = ParseFilePerms("", "nonexistent-butler-user", "")
+	c.Assert(err, NotNil)
+	_, err = ParseFilePerms("", "", "nonexistent-butler-group")
+	c.Assert(err, NotNil)
+
+	files, err := ParseFilePermissions([]string{"alerts/commonalerts.yml=0600", "prometheus.yml=::0"})
+	c.Assert(err, IsNil)
+	c.Assert(files["alerts/commonalerts.yml"], Equals, FilePerms{Mode: 0600})
+	c.Assert(files["prometheus.yml"], Equals, FilePerms{Group: "0"})
+	_, err = ParseFilePermissions([]string{"prometheus.yml"})
+	c.Assert(err, NotNil)
+	_, err = ParseFilePermissions([]string{"prometheus.yml=0644:0:0:0"})
+	c.Assert(err, NotNil)
+
+	opts := InstallOpts{Perms: FilePerms{Mode: 0644, Owner: "0", Uid: 0}, FilePerms: files}
+	c.Assert(opts.ForFile("alerts/commonalerts.yml").Perms, Equals, FilePerms{Mode: 0600, Owner: "0", Uid: 0})
+	c.Assert(opts.ForFile("tenant.yml").Perms, Equals, opts.Perms)
+}
+
+func (s *ConfigTestSuite) TestInstallFilePerms(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "binstall")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	dst := dir + "/prometheus.yml"
+
+	uid, gid := fmt.Sprintf("%d", os.Getuid()), fmt.Sprintf("%d", os.Getgid())
+	perms, err := ParseFilePerms("0640", uid, gid)
+	c.Assert(err, IsNil)
+	opts := NewInstallOpts()
+	opts.Perms = perms
+	c.Assert(InstallFile(bytes.NewReader([]byte("foo: bar\n")), dst, opts), IsNil)
+	fi, err := os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0640))
+
+	// permissions are restored on files which have not changed
+	c.Assert(os.Chmod(dst, 0600), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/src.yml", []byte("foo: bar\n"), 0644), IsNil)
+	c.Assert(CompareAndCopy(dir+"/src.yml", dst, "test-manager", opts), Equals, false)
+	fi, err = os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0640))
+}
+
+func (s *ConfigTestSuite) TestInstallFileCopies(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "binstall")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	dst := dir + "/nginx.conf"
+
+	copies, err := ParseFileCopies([]string{"nginx.conf=" + dir + "/conf.d/nginx.conf, " + dir + "/audit/nginx.conf"})
+	c.Assert(err, IsNil)
+	c.Assert(copies["nginx.conf"], DeepEquals, []string{dir + "/conf.d/nginx.conf", dir + "/audit/nginx.conf"})
+	_, err = ParseFileCopies([]string{"nginx.conf=conf.d/nginx.conf"})
+	c.Assert(err, NotNil)
+	_, err = ParseFileCopies([]string{"nginx.conf"})
+	c.Assert(err, NotNil)
+
+	opts := NewInstallOpts()
+	opts.FileCopies = copies
+	c.Assert(opts.ForFile("tenant.conf").Copies, IsNil)
+	c.Assert(InstallFile(bytes.NewReader([]byte("events {}\n")), dst, opts.ForFile("nginx.conf")), IsNil)
+	for _, f := range []string{dst, dir + "/conf.d/nginx.conf", dir + "/audit/nginx.conf"} {
+		out, err := ioutil.ReadFile(f)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, "events {}\n")
+	}
+
+	// a copy which cannot be written leaves every file as it was
+	c.Assert(ioutil.WriteFile(dir+"/blocked", nil, 0644), IsNil)
+	opts.FileCopies["nginx.conf"] = append(opts.FileCopies["nginx.conf"], dir+"/blocked/nginx.conf")
+	c.Assert(InstallFile(bytes.NewReader([]byte("http {}\n")), dst, opts.ForFile("nginx.conf")), NotNil)
+	out, err := ioutil.ReadFile(dst)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "events {}\n")
+	files, err := ioutil.ReadDir(dir + "/conf.d")
+	c.Assert(err, IsNil)
+	c.Assert(len(files), Equals, 1)
+
+	// the copies of a file which has not changed are kept in sync with it
+	opts.FileCopies = copies
+	opts.FileCopies["nginx.conf"] = opts.FileCopies["nginx.conf"][:2]
+	c.Assert(os.Remove(dir+"/audit/nginx.conf"), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/src.conf", []byte("events {}\n"), 0644), IsNil)
+	c.Assert(CompareAndCopy(dir+"/src.conf", dst, "test-manager", opts.ForFile("nginx.conf")), Equals, false)
+	out, err = ioutil.ReadFile(dir + "/audit/nginx.conf")
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "events {}\n")
+}
+
+func (s *ConfigTestSuite) TestCompareAndCopyIdentical(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "binstall")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	dst := dir + "/prometheus.yml"
+	src := dir + "/src.yml"
+
+	c.Assert(ioutil.WriteFile(src, []byte("#butlerstart\nfoo: bar\n#butlerend\n"), 0644), IsNil)
+	c.Assert(CompareAndCopy(src, dst, "test-manager", NewInstallOpts()), Equals, true)
+	out, err := ioutil.ReadFile(dst)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "foo: bar\n")
+
+	// a file which is re-published as is is not copied again
+	fi, err := os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(CompareAndCopy(src, dst, "test-manager", NewInstallOpts()), Equals, false)
+	fi2, err := os.Stat(dst)
+	c.Assert(err, IsNil)
+	c.Assert(os.SameFile(fi, fi2), Equals, true)
+
+	c.Assert(ioutil.WriteFile(src, []byte("#butlerstart\nfoo: baz\n#butlerend\n"), 0644), IsNil)
+	c.Assert(CompareAndCopy(src, dst, "test-manager", NewInstallOpts()), Equals, true)
+}
+
+func (s *ConfigTestSuite) TestParseFileDestinations(c *C) {
+	host, err := os.Hostname()
+	c.Assert(err, IsNil)
+	c.Assert(os.Setenv("BUTLER_TEST_REGION", "us"), IsNil)
+	defer os.Unsetenv("BUTLER_TEST_REGION")
+
+	dests, err := ParseFileDestinations([]string{"prometheus-prod-us.yml=prometheus.yml", "rules/%env.BUTLER_TEST_REGION%.yml=%manager%/%repo%/%hostname%-%file%"}, "prometheus", "repo1")
+	c.Assert(err, IsNil)
+	c.Assert(dests, DeepEquals, map[string]string{"prometheus-prod-us.yml": "prometheus.yml", "rules/%env.BUTLER_TEST_REGION%.yml": "prometheus/repo1/" + host + "-%env.BUTLER_TEST_REGION%.yml"})
+	dests, err = ParseFileDestinations([]string{"rules.yml=rules-%env.BUTLER_TEST_REGION%.yml"}, "prometheus", "repo1")
+	c.Assert(err, IsNil)
+	c.Assert(dests["rules.yml"], Equals, "rules-us.yml")
+
+	_, err = ParseFileDestinations([]string{"rules.yml"}, "prometheus", "repo1")
+	c.Assert(err, ErrorMatches, "invalid manager.file-destinations entry .*")
+	_, err = ParseFileDestinations([]string{"rules.yml=../rules.yml"}, "prometheus", "repo1")
+	c.Assert(err, ErrorMatches, ".* is not within the dest-path")
+	_, err = ParseFileDestinations([]string{"rules.yml=%region%.yml"}, "prometheus", "repo1")
+	c.Assert(err, ErrorMatches, ".*unknown placeholder %region%")
+	_, err = ParseFileDestinations([]string{"a.yml=rules.yml", "b.yml=rules.yml"}, "prometheus", "repo1")
+	c.Assert(err, ErrorMatches, ".*rules.yml is the destination of a.yml as well")
+
+	// the renamed files are installed to their destination
+	config := strictTestConfig(`additional-config = ["test-add.yml"]`, "additional-config = [\"test-add.yml\"]\n      file-destinations = [\"test-add.yml=%manager%.yml\"]")
+	c.Assert(CheckConfig("butler.toml", config, "", true), IsNil)
+	config = wrapConfig(strings.Replace(string(TestConfigCompleteEnvironment), `additional-config = ["test-add.yml"]`, "additional-config = [\"test-add.yml\"]\n      file-destinations = [\"test-add.yml=%manager%.yml\"]", 1))
+	settings := NewConfigSettings()
+	c.Assert(settings.parseConfig(config, "toml", nil, nil), IsNil)
+	opts := settings.Managers["test-handler"].ManagerOpts["test-handler.localhost"]
+	c.Assert(opts.GetAdditionalLocalConfigFiles(), DeepEquals, []string{"/opt/prometheus/test-handler.yml"})
+	c.Assert(opts.LocalName("test-add.yml"), Equals, "test-handler.yml")
+	c.Assert(CheckConfig("butler.toml", strictTestConfig(`additional-config = ["test-add.yml"]`, `file-destinations = ["test.yml=other.yml"]`), "", false), ErrorMatches, ".*file-destinations entry for test.yml, which is a primary-config.*")
+}
+
+func (s *ConfigTestSuite) TestPathCleanupProtected(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bclean")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/rules.d", 0755), IsNil)
+	for _, f := range []string{"/prometheus.yml", "/rules.d/local-team.yml", "/rules.d/stale.yml", "/notes.txt"} {
+		c.Assert(ioutil.WriteFile(dir+f, []byte("x"), 0644), IsNil)
+	}
+
+	opts := &ManagerOpts{PrimaryConfigsFullLocalPaths: []string{dir + "/prometheus.yml"}}
+	mgr := &Manager{Name: "test-manager", DestPath: dir, ManagerOpts: map[string]*ManagerOpts{"test-manager.repo": opts},
+		CleanFilesInclude: []string{"*.yml"}, CleanFilesExclude: []string{"*.d/local-*.yml"}}
+	c.Assert(mgr.IsCleanable(dir+"/rules.d/local-team.yml"), Equals, false)
+	c.Assert(mgr.IsCleanable(dir+"/notes.txt"), Equals, false)
+	c.Assert(mgr.IsCleanable(dir+"/rules.d/stale.yml"), Equals, true)
+
+	// PathCleanup stops the walk on each deleted file, so walk until it settles
+	for filepath.Walk(dir, mgr.PathCleanup) != nil {
+	}
+	for f, exists := range map[string]bool{"/prometheus.yml": true, "/rules.d/local-team.yml": true, "/rules.d/stale.yml": false, "/notes.txt": true} {
+		_, err = os.Stat(dir + f)
+		c.Assert(err == nil, Equals, exists, Commentf("file=%v", f))
+	}
+}
+
+func (s *ConfigTestSuite) TestValidateDestFiles(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bdest")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("foo: bar\n"), 0644), IsNil)
+
+	v, err := validators.NewExecValidator("test-manager", "exec", []byte(`{"command": "test -s %file%", "timeout": "5"}`))
+	c.Assert(err, IsNil)
+	mgr := Manager{Name: "test-manager", DestPath: dir, PrimaryConfigName: "prometheus.yml", PostValidators: []validators.Validator{v}}
+	mgr.ManagerOpts = map[string]*ManagerOpts{"test-manager.repo": {}}
+	c.Assert(mgr.ValidateDestFiles(), IsNil)
+
+	mgr.ManagerOpts["test-manager.repo"].AdditionalConfig = []string{"alerts/missing.yml"}
+	c.Assert(mgr.ValidateDestFiles(), NotNil)
+}
+
+func (s *ConfigTestSuite) TestRestoreAndReload(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bdest")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("good\n"), 0644), IsNil)
+
+	mgr := &Manager{Name: "rollback-manager", DestPath: dir, PrimaryConfigName: "prometheus.yml", EnableCache: true, ReloadOnRestore: true, MaxRollbacks: 2}
+	mgr.ManagerOpts = map[string]*ManagerOpts{}
+	mgr.Snapshots = NewSnapshotStore(mgr.Name, dir+"/cache", 2)
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{mgr.Name: mgr}}}
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+
+	// no known good cache, nothing to restore
+	c.Assert(bc.RestoreAndReload(mgr), Equals, false)
+
+	c.Assert(mgr.CacheConfigs(bc.Config.GetAllConfigLocalPaths(mgr.Name)), IsNil)
+	c.Assert(mgr.GoodCache, Equals, true)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("bad\n"), 0644), IsNil)
+
+	c.Assert(bc.RestoreAndReload(mgr), Equals, true)
+	out, err := ioutil.ReadFile(dir + "/prometheus.yml")
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "good\n")
+	c.Assert(GetManagerStatus(bc.GetStatusFile(), mgr.Name), Equals, true)
+
+	c.Assert(bc.RestoreAndReload(mgr), Equals, true)
+	// capped at max-rollback-attempts
+	c.Assert(bc.RestoreAndReload(mgr), Equals, false)
+	c.Assert(mgr.RollbackAttempts, Equals, 2)
+}
+
+// flakyReloader fails the first failures reloads.
+type flakyReloader struct {
+	reloads  *int
+	failures int
+	code     int
+}
+
+func (r flakyReloader) Reload() error {
+	*r.reloads++
+	if *r.reloads <= r.failures {
+		return reloaders.NewReloaderError().WithMessage("flaky").WithCode(r.code)
+	}
+	return nil
+}
+func (r flakyReloader) GetMethod() string                           { return "flaky" }
+func (r flakyReloader) GetOpts() reloaders.ReloaderOpts             { return nil }
+func (r flakyReloader) SetOpts(reloaders.ReloaderOpts) bool         { return true }
+func (r flakyReloader) SetCounter(int) reloaders.Reloader           { return r }
+func (r flakyReloader) SetChangedFiles([]string) reloaders.Reloader { return r }
+
+func (s *ConfigTestSuite) TestReloadRetries(c *C) {
+	reloads := 0
+	mgr := &Manager{Name: "retry-manager", Reloader: flakyReloader{reloads: &reloads, failures: 2, code: 503}}
+	defer delete(lastReloads, mgr.Name)
+
+	// no retries by default
+	c.Assert(mgr.Reload(), NotNil)
+	c.Assert(reloads, Equals, 1)
+
+	reloads = 0
+	mgr.ReloadRetries = 2
+	c.Assert(mgr.Reload(), IsNil)
+	c.Assert(reloads, Equals, 3)
+
+	// a timeout which is ok for the manager is not retried
+	reloads = 0
+	mgr.ManagerTimeoutOk = true
+	mgr.Reloader = flakyReloader{reloads: &reloads, failures: 1, code: 1}
+	c.Assert(mgr.Reload(), NotNil)
+	c.Assert(reloads, Equals, 1)
+
+	mgr.ReloadRetryWaitMin = 1
+	mgr.ReloadRetryWaitMax = 5
+	c.Assert(mgr.ReloadRetryWait(1), Equals, time.Second)
+	c.Assert(mgr.ReloadRetryWait(2), Equals, 2*time.Second)
+	c.Assert(mgr.ReloadRetryWait(3), Equals, 4*time.Second)
+	c.Assert(mgr.ReloadRetryWait(4), Equals, 5*time.Second)
+}
+
+func (s *ConfigTestSuite) TestSizeLimits(c *C) {
+	sizes, err := ParseMinSizes([]string{"rules/*.yml=20", "node.yml = 40", ""})
+	c.Assert(err, IsNil)
+	c.Assert(sizes, DeepEquals, map[string]int64{"rules/*.yml": 20, "node.yml": 40})
+	_, err = ParseMinSizes([]string{"rules/*.yml=big"})
+	c.Assert(err, NotNil)
+	_, err = ParseMinSizes([]string{"rules/[.yml=1"})
+	c.Assert(err, NotNil)
+
+	opts := &ManagerOpts{MinSizes: sizes, MustNotBeEmpty: []string{"rules/*"}}
+	n, notEmpty := opts.GetSizeLimits("rules/node.yml")
+	c.Assert(n, Equals, int64(40))
+	c.Assert(notEmpty, Equals, true)
+	n, notEmpty = opts.GetSizeLimits("alerts.yml")
+	c.Assert(n, Equals, int64(0))
+	c.Assert(notEmpty, Equals, false)
+
+	// the header and footer do not count towards the size
+	empty := []byte("#butlerstart\n  \n#butlerend\n")
+	c.Assert(ValidateConfig(NewValidateOpts().WithData(empty).WithFileName("rules/node.yml")), IsNil)
+	c.Assert(ValidateConfig(NewValidateOpts().WithData(empty).WithFileName("rules/node.yml").WithSizeLimits(0, true)), ErrorMatches, ".*must not be empty")
+	small := []byte("#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(ValidateConfig(NewValidateOpts().WithData(small).WithFileName("rules/node.yml").WithSizeLimits(10, true)), ErrorMatches, ".* 9 bytes.*min-size of 10 bytes")
+	c.Assert(ValidateConfig(NewValidateOpts().WithData(small).WithFileName("rules/node.yml").WithSizeLimits(9, true)), IsNil)
+	c.Assert(ValidateConfig(NewValidateOpts().WithContentType("binary").WithData([]byte{}).WithFileName("GeoIP.mmdb").WithSizeLimits(0, true)), NotNil)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The hooks which can be configured for a manager.
+const (
+	HookPreCopy    = "pre-copy"
+	HookPostCopy   = "post-copy"
+	HookPreReload  = "pre-reload"
+	HookPostReload = "post-reload"
+)
+
+// maxHookOutput is how much of the hook output is kept in the hook error.
+const maxHookOutput = 512
+
+// Hooks are the user commands which are run around the copy and the reload
+// of a manager. Like the exec reloader, each command is split on whitespace
+// and run directly, not through a shell. A failed pre-copy hook blocks the
+// copy, and a failed pre-reload hook fails the reload, while the failure of a
+// post hook is only logged.
+type Hooks struct {
+	PreCopy    string `mapstructure:"pre-copy" json:"pre-copy,omitempty"`
+	PostCopy   string `mapstructure:"post-copy" json:"post-copy,omitempty"`
+	PreReload  string `mapstructure:"pre-reload" json:"pre-reload,omitempty"`
+	PostReload string `mapstructure:"post-reload" json:"post-reload,omitempty"`
+	CfgTimeout string `mapstructure:"timeout" json:"-"`
+	Timeout    int    `json:"timeout"`
+}
+
+// Init resolves the hook commands and timeout from the environment.
+func (h *Hooks) Init() error {
+	var err error
+	h.PreCopy = strings.TrimSpace(environment.GetVar(h.PreCopy))
+	h.PostCopy = strings.TrimSpace(environment.GetVar(h.PostCopy))
+	h.PreReload = strings.TrimSpace(environment.GetVar(h.PreReload))
+	h.PostReload = strings.TrimSpace(environment.GetVar(h.PostReload))
+	h.Timeout, err = parseNonNegativeInt(h.CfgTimeout)
+	if err != nil {
+		return err
+	}
+	if h.Timeout == 0 {
+		h.Timeout = DefaultHookTimeout
+	}
+	return nil
+}
+
+// Get returns the command of the hook, which is empty when the hook is not
+// configured.
+func (h Hooks) Get(hook string) string {
+	switch hook {
+	case HookPreCopy:
+		return h.PreCopy
+	case HookPostCopy:
+		return h.PostCopy
+	case HookPreReload:
+		return h.PreReload
+	case HookPostReload:
+		return h.PostReload
+	}
+	return ""
+}
+
+// RunHook runs the command of the hook, if configured, with the butler
+// environment plus BUTLER_HOOK, BUTLER_MANAGER, BUTLER_DEST_PATH and the space
+// separated BUTLER_CHANGED_FILES, along with any extra KEY=VALUE variables.
+func (bm *Manager) RunHook(hook string, files []string, extra ...string) error {
+	command := bm.Hooks.Get(hook)
+	if command == "" {
+		return nil
+	}
+	args := strings.Fields(command)
+	timeout := time.Duration(bm.Hooks.Timeout) * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("BUTLER_HOOK=%s", hook),
+		fmt.Sprintf("BUTLER_MANAGER=%s", bm.Name),
+		fmt.Sprintf("BUTLER_DEST_PATH=%s", bm.DestPath),
+		fmt.Sprintf("BUTLER_CHANGED_FILES=%s", strings.Join(files, " ")))
+	cmd.Env = append(cmd.Env, extra...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	log.Debugf("Manager::RunHook()[count=%v][manager=%v]: running %v hook %v", cmHandlerCounter, bm.Name, hook, args)
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%v hook timed out after %v", hook, timeout)
+	} else if err != nil {
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxHookOutput {
+			output = "..." + output[len(output)-maxHookOutput:]
+		}
+		err = fmt.Errorf("%v hook failed: %v: %v", hook, err.Error(), output)
+	}
+	if err != nil {
+		log.Errorf("Manager::RunHook()[count=%v][manager=%v]: %v", cmHandlerCounter, bm.Name, err.Error())
+		events.Emit(events.New(events.TypeHook, bm.Name).WithMessage(hook).WithError(err))
+		return err
+	}
+	log.Debugf("Manager::RunHook()[count=%v][manager=%v]: %v hook output=%q", cmHandlerCounter, bm.Name, hook, strings.TrimSpace(out.String()))
+	return nil
+}
+
+// RunPreCopyHook runs the pre-copy hook with the staged files which the copy
+// is going to change. The hook is not run when nothing is going to change.
+func (bm *Manager) RunPreCopyHook(primary ChanEvent, additional ChanEvent) error {
+	files, err := bm.StagedChanges(primary, additional)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return bm.RunHook(HookPreCopy, files)
+}
+
+// StagedChanges returns the dest paths of the staged primary (merged) and
+// additional config files which differ from the files in dest-path, ie: the
+// files which the copy is going to change.
+func (bm *Manager) StagedChanges(primary ChanEvent, additional ChanEvent) ([]string, error) {
+	var res []string
+
+	var staged []TmpFile
+	if hasPrimaryConfig(bm.ManagerOpts) {
+		if err := primary.MergePrimaryConfigFiles(bm.ManagerOpts); err != nil {
+			return nil, err
+		}
+		staged = append(staged, TmpFile{Name: bm.PrimaryConfigName, File: primary.GetMergedConfigFile()})
+	}
+	staged = append(staged, additional.GetTmpFileMap()...)
+	for _, f := range staged {
+		dest := filepath.Join(bm.DestPath, f.Name)
+		if equal, _ := compareFileChecksums(f.File, dest); !equal {
+			res = append(res, dest)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestRunHook(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bhooks")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(ioutil.WriteFile(dir+"/hook.sh", []byte("#!/bin/sh\nenv > $1\n"), 0755), IsNil)
+
+	mgr := &Manager{Name: "hook-manager", DestPath: dir}
+	mgr.Hooks.PostCopy = dir + "/hook.sh " + dir + "/env"
+	c.Assert(mgr.Hooks.Init(), IsNil)
+	c.Assert(mgr.Hooks.Timeout, Equals, DefaultHookTimeout)
+
+	// hooks which are not configured are a no-op
+	c.Assert(mgr.RunHook(HookPreCopy, nil), IsNil)
+
+	c.Assert(mgr.RunHook(HookPostCopy, []string{dir + "/a.yml", dir + "/b.yml"}, "EXTRA=1"), IsNil)
+	out, err := ioutil.ReadFile(dir + "/env")
+	c.Assert(err, IsNil)
+	for _, e := range []string{"BUTLER_HOOK=post-copy", "BUTLER_MANAGER=hook-manager", "BUTLER_DEST_PATH=" + dir, "BUTLER_CHANGED_FILES=" + dir + "/a.yml " + dir + "/b.yml", "EXTRA=1"} {
+		c.Assert(strings.Contains(string(out), e+"\n"), Equals, true, Commentf("missing %v", e))
+	}
+
+	mgr.Hooks.PostCopy = "false"
+	c.Assert(mgr.RunHook(HookPostCopy, nil), NotNil)
+	mgr.Hooks.PostCopy = "sleep 5"
+	mgr.Hooks.Timeout = 1
+	c.Assert(mgr.RunHook(HookPostCopy, nil), ErrorMatches, ".*timed out.*")
+}
+
+func (s *ConfigTestSuite) TestPreReloadHook(c *C) {
+	reloads := 0
+	mgr := &Manager{Name: "hook-manager", Reloader: flakyReloader{reloads: &reloads}}
+	mgr.Hooks.PreReload = "false"
+	c.Assert(mgr.Hooks.Init(), IsNil)
+	defer delete(lastReloads, mgr.Name)
+
+	// a failed pre-reload hook fails the reload, without reloading
+	c.Assert(mgr.Reload(), NotNil)
+	c.Assert(reloads, Equals, 0)
+
+	mgr.Hooks.PreReload = "true"
+	c.Assert(mgr.Reload(), IsNil)
+	c.Assert(reloads, Equals, 1)
+}
+
+func (s *ConfigTestSuite) TestStagedChanges(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bstaged")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/staged", 0755), IsNil)
+	c.Assert(os.MkdirAll(dir+"/dest", 0755), IsNil)
+	for f, data := range map[string]string{"staged/a.yml": "a", "staged/b.yml": "b", "staged/prometheus.yml": "p", "dest/a.yml": "a", "dest/b.yml": "old", "dest/prometheus.yml": "p"} {
+		c.Assert(ioutil.WriteFile(dir+"/"+f, []byte(data), 0644), IsNil)
+	}
+
+	mgr := &Manager{Name: "staged-manager", DestPath: dir + "/dest", PrimaryConfigName: "prometheus.yml"}
+	mgr.ManagerOpts = map[string]*ManagerOpts{"staged-manager.repo": {PrimaryConfig: []string{"primary.yml"}}}
+
+	primary := NewConfigChanEvent()
+	primary.TmpFile, err = os.Create(dir + "/staged/merged")
+	c.Assert(err, IsNil)
+	primary.Repo["repo"] = &RepoFileEvent{TmpFile: map[string]string{"primary.yml": dir + "/staged/prometheus.yml"}, Binary: map[string]bool{}}
+	additional := NewConfigChanEvent()
+	additional.Repo["repo"] = &RepoFileEvent{TmpFile: map[string]string{"a.yml": dir + "/staged/a.yml", "b.yml": dir + "/staged/b.yml"}, Binary: map[string]bool{}}
+
+	files, err := mgr.StagedChanges(primary, additional)
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, []string{dir + "/dest/b.yml"})
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/kubernetes"
+	"github.com/adobe/butler/internal/metadata"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// hostLabelTimeout is the timeout of the requests for the kubernetes
+	// node labels of the host.
+	hostLabelTimeout = 5 * time.Second
+)
+
+var (
+	// ec2MetadataEndpoint and kubernetesServiceAccountDir are variables so
+	// that the tests can point them elsewhere.
+	ec2MetadataEndpoint         = metadata.EC2Endpoint
+	kubernetesServiceAccountDir = kubernetes.DefaultServiceAccountDir
+)
+
+// HostSelector is a condition on a label of the host, eg: "hostname=~^prom-"
+// or "ec2.Role=prometheus". The label is the hostname, "env.<variable>" for
+// an environment variable, "ec2.<tag>" for a tag of the EC2 instance or
+// "k8s.<label>" for a label of the kubernetes node. The operator is one of
+// "=", "!=", "=~" and "!~", the last two matching a regular expression. A
+// label the host does not have is empty.
+type HostSelector struct {
+	Spec   string `json:"spec"`
+	Label  string `json:"-"`
+	Op     string `json:"-"`
+	Value  string `json:"-"`
+	regexp *regexp.Regexp
+}
+
+// ParseHostSelectors parses the host-selector of a manager.
+func ParseHostSelectors(entries []string) ([]HostSelector, error) {
+	var res []HostSelector
+	for _, e := range entries {
+		s, err := ParseHostSelector(environment.GetVar(e))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// ParseHostSelector parses a "<label><operator><value>" host selector.
+func ParseHostSelector(spec string) (HostSelector, error) {
+	var res HostSelector
+	res.Spec = strings.TrimSpace(spec)
+	i := strings.IndexAny(res.Spec, "=!")
+	if i < 1 {
+		return res, fmt.Errorf("invalid host selector %q, expected \"<label><operator><value>\"", spec)
+	}
+	res.Label = strings.TrimSpace(res.Spec[:i])
+	rest := res.Spec[i:]
+	for _, op := range []string{"!=", "!~", "=~", "="} {
+		if strings.HasPrefix(rest, op) {
+			res.Op = op
+			break
+		}
+	}
+	if res.Op == "" {
+		return res, fmt.Errorf("invalid operator in host selector %q, expected one of =, !=, =~ and !~", spec)
+	}
+	res.Value = strings.TrimSpace(rest[len(res.Op):])
+
+	switch {
+	case res.Label == "hostname":
+	case strings.HasPrefix(res.Label, "env.") && len(res.Label) > len("env."):
+	case strings.HasPrefix(res.Label, "ec2.") && len(res.Label) > len("ec2."):
+	case strings.HasPrefix(res.Label, "k8s.") && len(res.Label) > len("k8s."):
+	default:
+		return res, fmt.Errorf("invalid label %v in host selector %q, expected hostname, env.<variable>, ec2.<tag> or k8s.<label>", res.Label, spec)
+	}
+
+	if res.Op == "=~" || res.Op == "!~" {
+		re, err := regexp.Compile(res.Value)
+		if err != nil {
+			return res, fmt.Errorf("invalid regular expression in host selector %q. err=%v", spec, err.Error())
+		}
+		res.regexp = re
+	}
+	return res, nil
+}
+
+// Matches returns whether the value of the label of the selector matches it.
+func (s HostSelector) Matches(value string) bool {
+	switch s.Op {
+	case "=":
+		return value == s.Value
+	case "!=":
+		return value != s.Value
+	case "=~":
+		return s.regexp.MatchString(value)
+	case "!~":
+		return !s.regexp.MatchString(value)
+	}
+	return false
+}
+
+// hostLabels looks up the labels of the host. The ec2 tags and the
+// kubernetes node labels are only requested once, so it is meant to be used
+// for a single parse of the butler config.
+type hostLabels struct {
+	ec2  *metadata.EC2
+	node map[string]string
+}
+
+func newHostLabels() *hostLabels {
+	return &hostLabels{ec2: metadata.NewEC2(ec2MetadataEndpoint)}
+}
+
+// Get returns the value of the label.
+func (h *hostLabels) Get(label string) (string, error) {
+	switch {
+	case label == "hostname":
+		return os.Hostname()
+	case strings.HasPrefix(label, "env."):
+		return os.Getenv(label[len("env."):]), nil
+	case strings.HasPrefix(label, "ec2."):
+		return h.ec2.Get(fmt.Sprintf("tags.%s", label[len("ec2."):]))
+	case strings.HasPrefix(label, "k8s."):
+		if h.node == nil {
+			node, err := h.nodeLabels()
+			if err != nil {
+				return "", err
+			}
+			h.node = node
+		}
+		return h.node[label[len("k8s."):]], nil
+	}
+	return "", fmt.Errorf("unknown host label %v", label)
+}
+
+// Match returns whether the host matches every one of the selectors.
+func (h *hostLabels) Match(selectors []HostSelector) (bool, error) {
+	for _, s := range selectors {
+		value, err := h.Get(s.Label)
+		if err != nil {
+			return false, err
+		}
+		if !s.Matches(value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nodeLabels returns the labels of the kubernetes node butler runs on,
+// which is given by the NODE_NAME environment variable, eg: from the
+// spec.nodeName field of the pod.
+func (h *hostLabels) nodeLabels() (map[string]string, error) {
+	node := os.Getenv("NODE_NAME")
+	if node == "" {
+		return nil, errors.New("no NODE_NAME environment variable for the k8s labels of the host")
+	}
+	client, err := kubernetes.NewClient(kubernetes.Config{ServiceAccountDir: kubernetesServiceAccountDir, Timeout: hostLabelTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("could not get kubernetes node %v. err=%v", node, err.Error())
+	}
+	var res struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := client.Do("GET", fmt.Sprintf("/api/v1/nodes/%s", node), nil, &res); err != nil {
+		return nil, fmt.Errorf("could not get kubernetes node %v. err=%v", node, err.Error())
+	}
+	if res.Metadata.Labels == nil {
+		res.Metadata.Labels = make(map[string]string)
+	}
+	return res.Metadata.Labels, nil
+}
+
+// selectManagers removes the managers whose host-selector does not match the
+// host from managers, and drops the dependencies of the other managers on
+// them.
+func selectManagers(managers map[string]*Manager, labels *hostLabels) error {
+	for name, m := range managers {
+		if len(m.HostSelector) == 0 {
+			continue
+		}
+		ok, err := labels.Match(m.HostSelector)
+		if err != nil {
+			return fmt.Errorf("%v for manager %s", err.Error(), name)
+		}
+		if !ok {
+			log.Infof("Config::selectManagers()[manager=%v]: host-selector does not match this host, not managing the manager.", name)
+			delete(managers, name)
+		}
+	}
+	for _, m := range managers {
+		var deps []string
+		for _, dep := range m.DependsOn {
+			if _, ok := managers[dep]; ok || dep == m.Name {
+				deps = append(deps, dep)
+			}
+		}
+		m.DependsOn = deps
+	}
+	return nil
+}
+
+// instanceMetadata is the globals.instance-metadata the meta: variables are
+// looked up for.
+var instanceMetadata string
+
+// setInstanceMetadata sets the provider of the meta: variables to the
+// instance metadata service of the cloud, or unsets it when cloud is empty.
+// The provider is only replaced when the cloud changes, so that the metadata
+// is not requested again on every butler config change. A configuration
+// which is checked gets the keys themselves as values, since it is usually
+// checked away from the instances.
+func setInstanceMetadata(cloud string, check bool) error {
+	if cloud == "" {
+		if !check {
+			environment.SetMetadata(nil)
+			instanceMetadata = cloud
+		}
+		return nil
+	}
+	p, err := metadata.New(cloud)
+	if err != nil {
+		return err
+	}
+	if check {
+		environment.SetMetadata(metadata.Placeholder{})
+		instanceMetadata = ""
+		return nil
+	}
+	if cloud == instanceMetadata {
+		return nil
+	}
+	if _, err := p.Get("instance-id"); err != nil {
+		return err
+	}
+	environment.SetMetadata(p)
+	instanceMetadata = cloud
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/adobe/butler/internal/environment"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestParseHostSelector(c *C) {
+	for _, spec := range []string{"hostname=~^prom-", "env.ROLE=prometheus", "ec2.Role!=canary", "k8s.topology.kubernetes.io/zone!~us-east-1[ab]", "env.EMPTY="} {
+		_, err := ParseHostSelector(spec)
+		c.Assert(err, IsNil, Commentf("spec %v", spec))
+	}
+	for _, spec := range []string{"", "hostname", "=prom", "host=prom", "env.=x", "ec2.Role~x", "hostname=~prom-("} {
+		_, err := ParseHostSelector(spec)
+		c.Assert(err, NotNil, Commentf("spec %v", spec))
+	}
+
+	sel, err := ParseHostSelector("hostname=~^prom-")
+	c.Assert(err, IsNil)
+	c.Assert(sel.Label, Equals, "hostname")
+	c.Assert(sel.Matches("prom-01"), Equals, true)
+	c.Assert(sel.Matches("web-01"), Equals, false)
+	sel, err = ParseHostSelector("ec2.Role != canary")
+	c.Assert(err, IsNil)
+	c.Assert(sel.Label, Equals, "ec2.Role")
+	c.Assert(sel.Matches("canary"), Equals, false)
+	c.Assert(sel.Matches(""), Equals, true)
+}
+
+func (s *ConfigTestSuite) TestSelectManagers(c *C) {
+	os.Setenv("BUTLER_HOST_ROLE", "prometheus")
+	defer os.Unsetenv("BUTLER_HOST_ROLE")
+
+	var requests int
+	ec2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("imds-token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/tags/instance/Role":
+			requests++
+			w.Write([]byte("prometheus"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ec2.Close()
+
+	k8s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/nodes/node-1" || r.Header.Get("Authorization") != "Bearer k8s-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"metadata": {"labels": {"node-role": "monitoring"}}}`))
+	}))
+	defer k8s.Close()
+	dir := c.MkDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: k8s.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(dir+"/ca.crt", ca, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/token", []byte("k8s-token\n"), 0644), IsNil)
+	host, port, _ := net.SplitHostPort(k8s.Listener.Addr().String())
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+	os.Setenv("NODE_NAME", "node-1")
+	defer os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+	defer os.Unsetenv("NODE_NAME")
+
+	endpoint, saDir := ec2MetadataEndpoint, kubernetesServiceAccountDir
+	ec2MetadataEndpoint, kubernetesServiceAccountDir = ec2.URL, dir
+	defer func() { ec2MetadataEndpoint, kubernetesServiceAccountDir = endpoint, saDir }()
+
+	selectors := func(specs ...string) []HostSelector {
+		res, err := ParseHostSelectors(specs)
+		c.Assert(err, IsNil)
+		return res
+	}
+	managers := map[string]*Manager{
+		"hosts-all":        {Name: "hosts-all"},
+		"hosts-prometheus": {Name: "hosts-prometheus", HostSelector: selectors("env.BUTLER_HOST_ROLE=prometheus", "ec2.Role=prometheus", "k8s.node-role=monitoring")},
+		"hosts-web":        {Name: "hosts-web", HostSelector: selectors("ec2.Role=web")},
+		"hosts-untagged":   {Name: "hosts-untagged", HostSelector: selectors("ec2.Team!~.")},
+		"hosts-dependent":  {Name: "hosts-dependent", DependsOn: []string{"hosts-web", "hosts-prometheus"}},
+	}
+	c.Assert(selectManagers(managers, newHostLabels()), IsNil)
+	c.Assert(managers, HasLen, 4)
+	c.Assert(managers["hosts-web"], IsNil)
+	c.Assert(managers["hosts-untagged"], NotNil)
+	c.Assert(managers["hosts-dependent"].DependsOn, DeepEquals, []string{"hosts-prometheus"})
+	// the tags are only requested once per parse
+	c.Assert(requests, Equals, 1)
+
+	// a label which cannot be looked up fails the selection
+	os.Unsetenv("NODE_NAME")
+	managers = map[string]*Manager{"hosts-k8s": {Name: "hosts-k8s", HostSelector: selectors("k8s.node-role=monitoring")}}
+	c.Assert(selectManagers(managers, newHostLabels()), ErrorMatches, ".*NODE_NAME.* for manager hosts-k8s")
+}
+
+func (s *ConfigTestSuite) TestSetInstanceMetadata(c *C) {
+	defer setInstanceMetadata("", false)
+
+	c.Assert(setInstanceMetadata("openstack", false), ErrorMatches, "unknown instance metadata cloud openstack.*")
+	c.Assert(setInstanceMetadata("ec2", true), IsNil)
+	c.Assert(environment.GetVar("/etc/prometheus/${meta:availability-zone}"), Equals, "/etc/prometheus/availability-zone")
+	c.Assert(instanceMetadata, Equals, "")
+
+	c.Assert(setInstanceMetadata("", false), IsNil)
+	c.Assert(environment.GetVar("meta:region"), Equals, "")
+}
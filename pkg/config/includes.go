@@ -0,0 +1,193 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// configFragment is a piece of the butler configuration which is included by
+// the globals.include of the butler configuration, eg: the managers of one
+// team.
+type configFragment struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// configIncludes returns the globals.include entries of the butler
+// configuration.
+func configIncludes(config []byte, format string) ([]string, error) {
+	if !isValidConfigFormat(format) {
+		return nil, fmt.Errorf("unknown butler configuration format %v", format)
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewBuffer(stripConfigHeaderFooter(config))); err != nil {
+		return nil, err
+	}
+	return v.GetStringSlice("globals.include"), nil
+}
+
+// includeFragments retrieves the fragments the butler configuration includes.
+// An include without a scheme, or with the file scheme, is a glob of local
+// files, relative to dir when it is not absolute, and may match no file at
+// all. Any other include is a url which is retrieved with the client, and
+// must be of its scheme. A nil client only allows local includes. Every
+// fragment must have the butler header and footer. The errors are RunErrors,
+// which tell whether a fragment could not be retrieved or is invalid.
+func includeFragments(config []byte, format string, dir string, client *ConfigClient) ([]configFragment, error) {
+	includes, err := configIncludes(config, format)
+	if err != nil {
+		return nil, &RunError{Stage: StageValidation, Err: err}
+	}
+
+	var fragments []configFragment
+	for _, include := range includes {
+		var found []configFragment
+		if !strings.Contains(include, "://") || strings.HasPrefix(include, "file://") {
+			found, err = globFragments(strings.TrimPrefix(include, "file://"), dir)
+		} else {
+			found, err = getFragment(include, client)
+		}
+		if err != nil {
+			return nil, &RunError{Stage: StageDownload, Err: fmt.Errorf("could not include %v. err=%v", include, err.Error())}
+		}
+		for _, f := range found {
+			err := ValidateConfig(NewValidateOpts().WithData(f.Data).WithFileName(f.Name).WithManager("butler-config"))
+			if err != nil {
+				return nil, &RunError{Stage: StageValidation, Err: fmt.Errorf("invalid include %v. err=%v", f.Name, err.Error())}
+			}
+		}
+		fragments = append(fragments, found...)
+	}
+	return fragments, nil
+}
+
+func globFragments(pattern string, dir string) ([]configFragment, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragments []configFragment
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, configFragment{Name: f, Data: data})
+	}
+	return fragments, nil
+}
+
+func getFragment(include string, client *ConfigClient) ([]configFragment, error) {
+	u, err := url.Parse(include)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errors.New("only local files can be included here")
+	}
+	if u.Scheme != client.Scheme {
+		return nil, fmt.Errorf("only local files and %v urls can be included", client.Scheme)
+	}
+
+	response, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer response.GetResponseBody().Close()
+	if response.GetResponseStatusCode() != 200 {
+		return nil, fmt.Errorf("did not receive 200 response code. code=%d", response.GetResponseStatusCode())
+	}
+	data, err := ioutil.ReadAll(response.GetResponseBody())
+	if err != nil {
+		return nil, err
+	}
+	return []configFragment{{Name: include, Data: data}}, nil
+}
+
+// mergeFragments merges the managers of the fragments into the butler
+// configuration which has been read by viper. A fragment may only list its
+// managers in its globals.config-managers, and may not define anything
+// which is already defined. It returns the managers the fragments list.
+func mergeFragments(fragments []configFragment) ([]string, error) {
+	var managers []string
+	for _, f := range fragments {
+		format := ConfigFormat(f.Name, f.Data)
+		data := stripConfigHeaderFooter(f.Data)
+
+		v := viper.New()
+		v.SetConfigType(format)
+		if err := v.ReadConfig(bytes.NewBuffer(data)); err != nil {
+			return nil, fmt.Errorf("could not parse include %v. err=%v", f.Name, err.Error())
+		}
+		for _, key := range v.AllKeys() {
+			if strings.HasPrefix(key, "globals.") {
+				if key != "globals.config-managers" {
+					return nil, fmt.Errorf("include %v may not set %v", f.Name, key)
+				}
+				continue
+			}
+			if top := strings.SplitN(key, ".", 2)[0]; viper.IsSet(top) {
+				return nil, fmt.Errorf("include %v defines %v, which is already defined", f.Name, top)
+			}
+		}
+		managers = append(managers, v.GetStringSlice("globals.config-managers")...)
+
+		viper.SetConfigType(format)
+		if err := viper.MergeConfig(bytes.NewBuffer(data)); err != nil {
+			return nil, fmt.Errorf("could not merge include %v. err=%v", f.Name, err.Error())
+		}
+	}
+	return managers, nil
+}
+
+// appendManagers appends the managers which are not in the list yet.
+func appendManagers(list []string, managers ...string) []string {
+	for _, m := range managers {
+		found := false
+		for _, l := range list {
+			if l == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// rawConfig returns the butler configuration along with its fragments, so
+// that a change to any of them is noticed.
+func rawConfig(config []byte, fragments []configFragment) []byte {
+	raw := append([]byte{}, config...)
+	for _, f := range fragments {
+		raw = append(raw, []byte("\n#include "+f.Name+"\n")...)
+		raw = append(raw, f.Data...)
+	}
+	return raw
+}
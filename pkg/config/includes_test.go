@@ -0,0 +1,126 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+// includeTestConfig returns a butler configuration which includes the
+// fragments, and fragments which define the managers.
+func includeTestConfig(includes string) []byte {
+	return wrapConfig(strings.Replace(string(TestConfigCompleteEnvironment), "[globals]\n", "[globals]\n  include = ["+includes+"]\n", 1))
+}
+
+func includeTestTomlFragment(manager string) []byte {
+	s := string(TestConfigCompleteEnvironment)
+	stanza := strings.Replace(s[strings.Index(s, "  [test-handler]"):], "test-handler", manager, -1)
+	return wrapConfig("[globals]\n  config-managers = [\"" + manager + "\"]\n" + stanza)
+}
+
+func includeTestYamlFragment(manager string) []byte {
+	s := string(TestConfigCompleteEnvironmentYAML)
+	stanza := strings.Replace(s[strings.Index(s, "test-handler:"):], "test-handler", manager, -1)
+	return wrapConfig("globals:\n  config-managers: [\"" + manager + "\"]\n" + stanza)
+}
+
+func wrapConfig(config string) []byte {
+	return []byte("#butlerstart\n" + config + "#butlerend\n")
+}
+
+func managerNames(c *ConfigSettings) []string {
+	var names []string
+	for name := range c.Managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *ConfigTestSuite) TestIncludes(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "binclude")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.Mkdir(dir+"/conf.d", 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-a.toml", includeTestTomlFragment("team-a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-b.yaml", includeTestYamlFragment("team-b"), 0644), IsNil)
+
+	// relative includes are relative to the butler configuration, and an
+	// include which matches nothing is fine
+	config := includeTestConfig(`"conf.d/*.toml", "` + dir + `/conf.d/*.yaml", "conf.d/*.json"`)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, "", false), IsNil)
+	fragments, err := includeFragments(config, "toml", dir, nil)
+	c.Assert(err, IsNil)
+	c.Assert(fragments, HasLen, 2)
+	settings := NewConfigSettings()
+	c.Assert(settings.parseConfig(config, "toml", fragments, nil), IsNil)
+	c.Assert(managerNames(settings), DeepEquals, []string{"team-a", "team-b", "test-handler"})
+	c.Assert(settings.Managers["team-b"].DestPath, Equals, "/opt/prometheus")
+
+	// a fragment may neither redefine a manager, nor set the globals
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-c.toml", includeTestTomlFragment("test-handler"), 0644), IsNil)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, "", false), ErrorMatches, "include .*/conf.d/team-c.toml defines test-handler, which is already defined")
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-c.toml", wrapConfig("[globals]\n  scheduler-interval = 10\n"), 0644), IsNil)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, "", false), ErrorMatches, "include .*/conf.d/team-c.toml may not set globals.scheduler-interval")
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-c.toml", []byte("[globals]\n"), 0644), IsNil)
+	_, err = includeFragments(config, "toml", dir, nil)
+	c.Assert(err, ErrorMatches, "invalid include .*/conf.d/team-c.toml.*")
+	c.Assert(err.(*RunError).Stage, Equals, StageValidation)
+	c.Assert(os.Remove(dir+"/conf.d/team-c.toml"), IsNil)
+
+	_, err = includeFragments(includeTestConfig(`"http://localhost/team-c.toml"`), "toml", dir, nil)
+	c.Assert(err, ErrorMatches, "could not include http://localhost/team-c.toml. err=only local files can be included here")
+	c.Assert(err.(*RunError).Stage, Equals, StageDownload)
+	_, err = includeFragments(includeTestConfig(`"http://localhost/team-c.toml"`), "toml", dir, &ConfigClient{Scheme: "s3"})
+	c.Assert(err, ErrorMatches, "could not include http://localhost/team-c.toml. err=only local files and s3 urls can be included")
+
+	// a change to a fragment alone is picked up by the handler
+	c.Assert(ioutil.WriteFile(dir+"/butler.toml", config, 0644), IsNil)
+	u, err := url.Parse("file://" + dir + "/butler.toml")
+	c.Assert(err, IsNil)
+	bc, err := NewButlerConfig(&ButlerConfigOpts{LogLevel: log.DebugLevel, URL: u})
+	c.Assert(err, IsNil)
+	bc.SetMethodOpts(methods.FileMethodOpts{Scheme: "file"})
+	c.Assert(bc.Init(), IsNil)
+	c.Assert(bc.Handler(), IsNil)
+	c.Assert(managerNames(bc.Config), DeepEquals, []string{"team-a", "team-b", "test-handler"})
+	c.Assert(os.Remove(dir+"/conf.d/team-b.yaml"), IsNil)
+	c.Assert(bc.Handler(), IsNil)
+	c.Assert(managerNames(bc.Config), DeepEquals, []string{"team-a", "test-handler"})
+
+	// the handler fails at the stage of the include which failed, so that
+	// -once exits with the matching code
+	c.Assert(ioutil.WriteFile(dir+"/butler.toml", includeTestConfig(`"conf.d/*.toml", "http://localhost/team-c.toml"`), 0644), IsNil)
+	err = bc.Handler()
+	c.Assert(err, ErrorMatches, "could not include http://localhost/team-c.toml.*")
+	runErr, ok := err.(*RunError)
+	c.Assert(ok, Equals, true)
+	c.Assert(runErr.Stage, Equals, StageDownload)
+
+	c.Assert(ioutil.WriteFile(dir+"/butler.toml", config, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/conf.d/team-c.toml", []byte("[globals]\n"), 0644), IsNil)
+	err = bc.Handler()
+	c.Assert(err, ErrorMatches, "invalid include .*/conf.d/team-c.toml.*")
+	runErr, ok = err.(*RunError)
+	c.Assert(ok, Equals, true)
+	c.Assert(runErr.Stage, Equals, StageValidation)
+}
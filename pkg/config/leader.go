@@ -0,0 +1,151 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/leader"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// LeaderKey is the section of the butler config the leader election is
+// configured in.
+const LeaderKey = "leader"
+
+var (
+	// elector elects the butler which copies the files and reloads the
+	// managers, among those which share their destination. There is no
+	// election without a leader section, and every butler leads.
+	elector *leader.Elector
+	// electorSettings are the settings of the leader section the elector
+	// was set up from, so that it is only replaced when they change.
+	electorSettings string
+	electorLock     sync.Mutex
+)
+
+// newElector returns the Elector of the leader section of the butler
+// configuration, along with its settings, or nil when there is none. The
+// section has the method of the lock, the options of the method under its
+// name, and optionally the ttl, in seconds, and the id of this butler.
+func newElector() (*leader.Elector, string, error) {
+	var result map[string]interface{}
+
+	if !viper.IsSet(LeaderKey) {
+		return nil, "", nil
+	}
+	if err := viper.UnmarshalKey(LeaderKey, &result); err != nil {
+		return nil, "", err
+	}
+	settings, err := json.Marshal(result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	method, _ := result["method"].(string)
+	if method == "" {
+		return nil, "", errors.New("no leader method has been defined")
+	}
+	entry, err := json.Marshal(result[method])
+	if err != nil {
+		return nil, "", err
+	}
+	lock, err := leader.NewLock(method, entry)
+	if err != nil {
+		return nil, "", fmt.Errorf("leader %v: %v", method, err.Error())
+	}
+
+	ttl := leader.DefaultTTL
+	if v := strings.TrimSpace(environment.GetVar(fmt.Sprintf("%v", result["ttl"]))); result["ttl"] != nil && v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			return nil, "", fmt.Errorf("invalid leader ttl %v", v)
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+	var id string
+	if result["id"] != nil {
+		id = environment.GetVar(fmt.Sprintf("%v", result["id"]))
+	}
+	return leader.NewElector(lock, id, ttl), string(settings), nil
+}
+
+// setElector replaces the elector, unless its settings are the same, and
+// starts campaigning. The previous elector gives up the lock.
+func setElector(e *leader.Elector, settings string) {
+	electorLock.Lock()
+	defer electorLock.Unlock()
+	if settings == electorSettings {
+		return
+	}
+	if elector != nil {
+		if err := elector.Stop(); err != nil {
+			log.Errorf("Config::setElector(): could not release the leader lock. err=%v", err.Error())
+		}
+	}
+	elector, electorSettings = e, settings
+	if elector != nil {
+		log.Infof("Config::setElector(): campaigning for the leader lock as %v.", elector.ID())
+		elector.Start()
+	}
+}
+
+// leading returns the fencing token of this butler, and whether it is the
+// leader. A butler which is not the leader campaigns right away, rather than
+// wait for the next campaign, eg: on the first run.
+func leading(ctx context.Context) (uint64, bool) {
+	electorLock.Lock()
+	e := elector
+	electorLock.Unlock()
+	if e == nil {
+		return 0, true
+	}
+	token, ok := e.Leader()
+	if !ok {
+		var err error
+		if ok, err = e.Campaign(ctx); err != nil {
+			log.Errorf("Config::leading(): could not campaign for the leader lock. err=%v", err.Error())
+		}
+		token, ok = e.Leader()
+	}
+	if ok {
+		metrics.SetButlerLeaderVal(metrics.SUCCESS, e.ID())
+	} else {
+		metrics.SetButlerLeaderVal(metrics.FAILURE, e.ID())
+	}
+	return token, ok
+}
+
+// stillLeading returns whether this butler is still the leader with the
+// fencing token, ie: whether it has kept the lock since it got the token.
+func stillLeading(token uint64) bool {
+	electorLock.Lock()
+	e := elector
+	electorLock.Unlock()
+	if e == nil {
+		return true
+	}
+	t, ok := e.Leader()
+	return ok && t == token
+}
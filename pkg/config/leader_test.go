@@ -0,0 +1,72 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe/butler/internal/leader"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestLeader(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bleader")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	defer setElector(nil, "")
+
+	// without a leader section every butler leads
+	token, ok := leading(context.Background())
+	c.Assert(ok, Equals, true)
+	c.Assert(stillLeading(token), Equals, true)
+
+	newLock := func() leader.Lock {
+		lock, err := leader.NewLock("file", []byte(fmt.Sprintf(`{"path": %q}`, filepath.Join(dir, "leader.lock"))))
+		c.Assert(err, IsNil)
+		return lock
+	}
+	setElector(leader.NewElector(newLock(), "butler-a", time.Minute), "a")
+	token, ok = leading(context.Background())
+	c.Assert(ok, Equals, true)
+	c.Assert(stillLeading(token), Equals, true)
+
+	// another butler sharing the destination does not lead
+	other := leader.NewElector(newLock(), "butler-b", time.Minute)
+	ok, err = other.Campaign(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	// until the leader gives up the lock, after which the token of the
+	// former leader is fenced off
+	setElector(nil, "")
+	ok, err = other.Campaign(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+	setElector(leader.NewElector(newLock(), "butler-a", time.Minute), "a")
+	_, ok = leading(context.Background())
+	c.Assert(ok, Equals, false)
+	c.Assert(stillLeading(token), Equals, false)
+	c.Assert(other.Stop(), IsNil)
+
+	// the leader section is checked along with the configuration
+	config := strictTestConfig(`method = "file"`, `method = "nfs"`)
+	c.Assert(CheckConfig("butler.toml", config, "", false), ErrorMatches, ".*leader nfs: .*")
+	config = strictTestConfig(`ttl = "30"`, `ttl = "-1"`)
+	c.Assert(CheckConfig("butler.toml", config, "", false), ErrorMatches, ".*invalid leader ttl -1.*")
+}
@@ -0,0 +1,1074 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/healthchecks"
+	"github.com/adobe/butler/internal/metrics"
+	"github.com/adobe/butler/internal/scheduler"
+	"github.com/adobe/butler/internal/tracing"
+	"github.com/adobe/butler/internal/validators"
+	"github.com/adobe/butler/pkg/destinations"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Manager struct {
+	Name                  string                      `json:"name"`
+	Repos                 []string                    `mapstructure:"repos" json:"repos"`
+	CfgCleanFiles         string                      `mapstructure:"clean-files" json:"-"`
+	CleanFiles            bool                        `json:"clean-files"`
+	CleanFilesInclude     []string                    `mapstructure:"clean-files-include" json:"clean-files-include,omitempty"`
+	CleanFilesExclude     []string                    `mapstructure:"clean-files-exclude" json:"clean-files-exclude,omitempty"`
+	GoodCache             bool                        `json:"good-cache"`
+	LastRun               time.Time                   `json:"last-run"`
+	MustacheSubsArray     []string                    `mapstructure:"mustache-subs" json:"-"`
+	MustacheSubs          map[string]string           `json:"mustache-subs"`
+	CfgEnableCache        string                      `mapstructure:"enable-cache" json:"-"`
+	EnableCache           bool                        `json:"enable-cache"`
+	CachePath             string                      `mapstructure:"cache-path" json:"cache-path"`
+	CfgCacheRetention     string                      `mapstructure:"cache-retention" json:"-"`
+	CacheRetention        int                         `json:"cache-retention"`
+	Snapshots             *SnapshotStore              `mapstructure:"-" json:"-"`
+	CfgDiffRetention      string                      `mapstructure:"diff-retention" json:"-"`
+	DiffRetention         int                         `json:"diff-retention"`
+	CfgLogDiffs           string                      `mapstructure:"log-diffs" json:"-"`
+	LogDiffs              bool                        `json:"log-diffs"`
+	DiffMask              []string                    `mapstructure:"diff-mask" json:"diff-mask,omitempty"`
+	Diffs                 *DiffStore                  `mapstructure:"-" json:"-"`
+	DestPath              string                      `mapstructure:"dest-path" json:"dest-path"`
+	ReleaseLink           string                      `mapstructure:"release-link" json:"release-link,omitempty"`
+	ReleasePath           string                      `mapstructure:"release-path" json:"release-path,omitempty"`
+	CfgReleaseRetention   string                      `mapstructure:"release-retention" json:"-"`
+	ReleaseRetention      int                         `json:"release-retention,omitempty"`
+	CopyLock              string                      `mapstructure:"copy-lock" json:"copy-lock,omitempty"`
+	CopyLockMethod        string                      `mapstructure:"copy-lock-method" json:"copy-lock-method,omitempty"`
+	CfgCopyLockTimeout    string                      `mapstructure:"copy-lock-timeout" json:"-"`
+	CopyLockTimeout       int                         `json:"copy-lock-timeout,omitempty"`
+	PrimaryConfigName     string                      `mapstructure:"primary-config-name" json:"primary-config-name"`
+	HeaderMarker          string                      `mapstructure:"header-marker" json:"header-marker"`
+	FooterMarker          string                      `mapstructure:"footer-marker" json:"footer-marker"`
+	CfgDisableMarkers     string                      `mapstructure:"disable-markers" json:"-"`
+	DisableMarkers        bool                        `json:"disable-markers"`
+	CfgReloadOnRestore    string                      `mapstructure:"reload-on-restore" json:"-"`
+	ReloadOnRestore       bool                        `json:"reload-on-restore"`
+	CfgMaxRollbacks       string                      `mapstructure:"max-rollback-attempts" json:"-"`
+	MaxRollbacks          int                         `json:"max-rollback-attempts"`
+	RollbackAttempts      int                         `json:"rollback-attempts"`
+	CfgMode               string                      `mapstructure:"mode" json:"-"`
+	CfgOwner              string                      `mapstructure:"owner" json:"-"`
+	CfgGroup              string                      `mapstructure:"group" json:"-"`
+	Perms                 FilePerms                   `json:"perms"`
+	SELinuxContext        string                      `mapstructure:"selinux-context" json:"selinux-context,omitempty"`
+	XattrsArray           []string                    `mapstructure:"xattrs" json:"-"`
+	Xattrs                map[string]string           `json:"xattrs,omitempty"`
+	CfgPreserveXattrs     string                      `mapstructure:"preserve-xattrs" json:"-"`
+	PreserveXattrs        bool                        `json:"preserve-xattrs"`
+	CfgRestorecon         string                      `mapstructure:"restorecon" json:"-"`
+	Restorecon            string                      `json:"restorecon,omitempty"`
+	CfgFsync              string                      `mapstructure:"fsync" json:"-"`
+	Fsync                 bool                        `json:"fsync"`
+	CfgSyncDir            string                      `mapstructure:"sync-dir" json:"-"`
+	SyncDir               bool                        `json:"sync-dir"`
+	CfgManagerTimeoutOk   string                      `mapstructure:"manager-timeout-ok" json:"-"`
+	ManagerTimeoutOk      bool                        `json:"manager-timeout-ok"`
+	CfgSchedulerInterval  string                      `mapstructure:"scheduler-interval" json:"-"`
+	SchedulerCron         string                      `mapstructure:"scheduler-cron" json:"scheduler-cron,omitempty"`
+	CfgSchedulerSplay     string                      `mapstructure:"scheduler-splay" json:"-"`
+	SchedulerSplay        int                         `json:"scheduler-splay,omitempty"`
+	Schedule              scheduler.Schedule          `mapstructure:"-" json:"-"`
+	CfgReloadDebounce     string                      `mapstructure:"reload-debounce" json:"-"`
+	ReloadDebounce        int                         `json:"reload-debounce"`
+	CfgReloadMinInterval  string                      `mapstructure:"reload-min-interval" json:"-"`
+	ReloadMinInterval     int                         `json:"reload-min-interval"`
+	CfgReloadRetries      string                      `mapstructure:"reload-retries" json:"-"`
+	ReloadRetries         int                         `json:"reload-retries"`
+	CfgReloadRetryWaitMin string                      `mapstructure:"reload-retry-wait-min" json:"-"`
+	ReloadRetryWaitMin    int                         `json:"reload-retry-wait-min"`
+	CfgReloadRetryWaitMax string                      `mapstructure:"reload-retry-wait-max" json:"-"`
+	ReloadRetryWaitMax    int                         `json:"reload-retry-wait-max"`
+	CfgBreakerThreshold   string                      `mapstructure:"breaker-threshold" json:"-"`
+	BreakerThreshold      int                         `json:"breaker-threshold"`
+	CfgBreakerInterval    string                      `mapstructure:"breaker-interval" json:"-"`
+	BreakerInterval       int                         `json:"breaker-interval"`
+	CfgStaleThreshold     string                      `mapstructure:"stale-threshold" json:"-"`
+	StaleThreshold        int                         `json:"stale-threshold"`
+	CfgCanary             string                      `mapstructure:"canary" json:"-"`
+	Canary                bool                        `json:"canary"`
+	CfgCanarySoak         string                      `mapstructure:"canary-soak" json:"-"`
+	CanarySoak            int                         `json:"canary-soak"`
+	DependsOn             []string                    `mapstructure:"depends-on" json:"depends-on,omitempty"`
+	WebhookRepo           string                      `mapstructure:"webhook-repo" json:"webhook-repo,omitempty"`
+	WebhookBranch         string                      `mapstructure:"webhook-branch" json:"webhook-branch,omitempty"`
+	WebhookPaths          []string                    `mapstructure:"webhook-paths" json:"webhook-paths,omitempty"`
+	ManagerOpts           map[string]*ManagerOpts     `json:"opts"`
+	FileGroups            map[string]*FileGroup       `mapstructure:"file-groups" json:"file-groups,omitempty"`
+	Reloader              reloaders.Reloader          `mapstructure:"-" json:"reloader,omitempty"`
+	Destination           destinations.Destination    `mapstructure:"-" json:"destination,omitempty"`
+	Validators            []validators.Validator      `mapstructure:"-" json:"validators,omitempty"`
+	PostValidators        []validators.Validator      `mapstructure:"-" json:"post-validators,omitempty"`
+	Hooks                 Hooks                       `mapstructure:"hooks" json:"hooks"`
+	BlackoutWindowsArray  []string                    `mapstructure:"blackout-windows" json:"-"`
+	BlackoutWindows       []BlackoutWindow            `json:"blackout-windows,omitempty"`
+	HostSelectorArray     []string                    `mapstructure:"host-selector" json:"-"`
+	HostSelector          []HostSelector              `json:"host-selector,omitempty"`
+	HealthCheck           *healthchecks.HealthChecker `mapstructure:"-" json:"health-check,omitempty"`
+	ReloadManager         bool                        `json:"-"`
+	ChangedFiles          []string                    `mapstructure:"-" json:"-"`
+	// traceCtx carries the span of the last run of the manager, the parent
+	// of the spans of its validation and reload. It is only used under the
+	// cmHandlerLock.
+	traceCtx context.Context
+}
+
+// traceContext returns the context which carries the span of the last run of
+// the manager.
+func (bm *Manager) traceContext() context.Context {
+	if bm.traceCtx == nil {
+		return context.Background()
+	}
+	return bm.traceCtx
+}
+
+type ManagerOpts struct {
+	Method                          string               `mapstructure:"method" json:"method"`
+	RepoPath                        string               `mapstructure:"repo-path" json:"repo-path"`
+	Repo                            string               `json:"repo"`
+	PrimaryConfig                   []string             `mapstructure:"primary-config" json:"primary-config"`
+	AdditionalConfig                []string             `mapstructure:"additional-config" json:"additional-config"`
+	PrimaryConfigsFullURLs          []string             `json:"-"`
+	AdditionalConfigsFullURLs       []string             `json:"-"`
+	PrimaryConfigsFullLocalPaths    []string             `json:"-"`
+	AdditionalConfigsFullLocalPaths []string             `json:"-"`
+	ContentType                     string               `mapstructure:"content-type" json:"content-type"`
+	ContentTypesArray               []string             `mapstructure:"content-types" json:"-"`
+	ContentTypes                    map[string]string    `json:"content-types,omitempty"`
+	FilePermissionsArray            []string             `mapstructure:"file-permissions" json:"-"`
+	FilePermissions                 map[string]FilePerms `json:"file-permissions,omitempty"`
+	FileCopiesArray                 []string             `mapstructure:"file-copies" json:"-"`
+	FileCopies                      map[string][]string  `json:"file-copies,omitempty"`
+	FileDestinationsArray           []string             `mapstructure:"file-destinations" json:"-"`
+	FileDestinations                map[string]string    `json:"file-destinations,omitempty"`
+	SyncDirs                        []string             `mapstructure:"sync-dirs" json:"sync-dirs,omitempty"`
+	SyncExclude                     []string             `mapstructure:"sync-exclude" json:"sync-exclude,omitempty"`
+	SyncedConfig                    []string             `json:"synced-config,omitempty"`
+	AdditionalGlobs                 []string             `json:"additional-globs,omitempty"`
+	GlobbedConfig                   []string             `json:"globbed-config,omitempty"`
+	FileGroups                      map[string][]string  `mapstructure:"file-groups" json:"file-groups,omitempty"`
+	OptionalConfig                  []string             `mapstructure:"optional-config" json:"optional-config,omitempty"`
+	MinSizeArray                    []string             `mapstructure:"min-size" json:"-"`
+	MinSizes                        map[string]int64     `json:"min-size,omitempty"`
+	MustNotBeEmpty                  []string             `mapstructure:"must-not-be-empty" json:"must-not-be-empty,omitempty"`
+	Opts                            methods.Method       `json:"opts"`
+	groupFiles                      []groupFile
+	parentManager                   string
+	baseRemotePath                  string
+	destPath                        string
+	downloadCache                   string
+	responseCache                   string
+	responseCacheTTL                time.Duration
+}
+
+func (bm *Manager) Reload() error {
+	log.Debugf("Manager::Reload(): reloading %s manager...", bm.Name)
+	if err := bm.Release(); err != nil {
+		log.Errorf("Manager::Reload()[count=%v][manager=%v]: could not install the release. err=%v", cmHandlerCounter, bm.Name, err.Error())
+		bm.ChangedFiles = nil
+		err = reloaders.NewReloaderError().WithMessage(fmt.Sprintf("could not install the release. %v", err.Error())).WithCode(2)
+		recordReload(bm.Name, err)
+		events.Emit(events.New(events.TypeReload, bm.Name).WithVersion(bm.ConfigVersion()).WithError(err))
+		return err
+	}
+	if err := bm.Publish(); err != nil {
+		log.Errorf("Manager::Reload()[count=%v][manager=%v]: could not publish to the %v destination. err=%v", cmHandlerCounter, bm.Name, bm.Destination.GetMethod(), err.Error())
+		bm.ChangedFiles = nil
+		err = reloaders.NewReloaderError().WithMessage(fmt.Sprintf("could not publish to the %v destination. %v", bm.Destination.GetMethod(), err.Error())).WithCode(2)
+		recordReload(bm.Name, err)
+		events.Emit(events.New(events.TypeReload, bm.Name).WithVersion(bm.ConfigVersion()).WithError(err))
+		return err
+	}
+	if bm.Reloader == nil {
+		log.Warnf("Manager::Reload(): No reloader defined for %s manager. Moving on...", bm.Name)
+		return nil
+	} else {
+		lastReloads[bm.Name] = time.Now()
+		_, span := tracing.Start(bm.traceContext(), "butler.reload", tracing.String("butler.manager", bm.Name), tracing.Int("butler.changed_files", len(bm.ChangedFiles)))
+		if err := bm.RunHook(HookPreReload, bm.ChangedFiles); err != nil {
+			bm.ChangedFiles = nil
+			err = reloaders.NewReloaderError().WithMessage(err.Error()).WithCode(2)
+			span.End(err)
+			recordReload(bm.Name, err)
+			events.Emit(events.New(events.TypeReload, bm.Name).WithVersion(bm.ConfigVersion()).WithError(err))
+			return err
+		}
+		reloader := bm.Reloader.SetCounter(cmHandlerCounter).SetChangedFiles(bm.ChangedFiles)
+		start := time.Now()
+		err := reloader.Reload()
+		for attempt := 1; err != nil && attempt <= bm.ReloadRetries && !bm.IsTimeoutOk(err); attempt++ {
+			wait := bm.ReloadRetryWait(attempt)
+			log.Warnf("Manager::Reload()[count=%v][manager=%v]: reload failed, retrying in %v (attempt %v of %v). err=%v", cmHandlerCounter, bm.Name, wait, attempt, bm.ReloadRetries, err.Error())
+			metrics.SetButlerReloaderRetry(metrics.SUCCESS, bm.Name)
+			time.Sleep(wait)
+			err = reloader.Reload()
+		}
+		if err == nil && bm.HealthCheck != nil {
+			err = bm.CheckHealth()
+		}
+		metrics.SetButlerReloadDuration(bm.Name, time.Since(start))
+		bm.RunHook(HookPostReload, bm.ChangedFiles, fmt.Sprintf("BUTLER_RELOAD_SUCCESS=%v", err == nil))
+		// the files are only handed to the reload they triggered
+		bm.ChangedFiles = nil
+		span.End(err)
+		recordReload(bm.Name, err)
+		if err == nil {
+			metrics.SetButlerLastReloadSuccess(bm.Name)
+		}
+		metrics.SetButlerConfigVersion(bm.Name, bm.ConfigVersion())
+		events.Emit(events.New(events.TypeReload, bm.Name).WithVersion(bm.ConfigVersion()).WithError(err))
+		return err
+	}
+}
+
+// Publish writes the files of the manager, as they are in its dest-path, to
+// its destination, when it has one.
+func (bm *Manager) Publish() error {
+	if bm.Destination == nil {
+		return nil
+	}
+	files, err := bm.destFiles()
+	if err != nil {
+		return err
+	}
+	return bm.Destination.Publish(files)
+}
+
+// destFiles returns the files of the manager, as they are in its dest-path,
+// keyed by their slash separated path relative to the dest-path. The files
+// which are not there are left out.
+func (bm *Manager) destFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var paths []string
+	if hasPrimaryConfig(bm.ManagerOpts) {
+		paths = append(paths, filepath.Join(bm.DestPath, bm.PrimaryConfigName))
+	}
+	for _, o := range bm.ManagerOpts {
+		paths = append(paths, o.GetAdditionalLocalConfigFiles()...)
+	}
+	for _, p := range paths {
+		rel, err := filepath.Rel(bm.DestPath, p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%v is not within the dest-path %v", p, bm.DestPath)
+		}
+		if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.ToSlash(rel)] = data
+	}
+	return files, nil
+}
+
+// IsTimeoutOk returns whether the reload error is a timeout which is ignored
+// because of manager-timeout-ok.
+func (bm *Manager) IsTimeoutOk(err error) bool {
+	e, ok := err.(*reloaders.ReloaderError)
+	return ok && e.Code == 1 && bm.ManagerTimeoutOk
+}
+
+// ReloadRetryWait returns how long to wait before the retry attempt of a
+// failed reload. The wait doubles with every attempt, from
+// reload-retry-wait-min up to reload-retry-wait-max.
+func (bm *Manager) ReloadRetryWait(attempt int) time.Duration {
+	wait := time.Duration(bm.ReloadRetryWaitMin) * time.Second
+	max := time.Duration(bm.ReloadRetryWaitMax) * time.Second
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// CheckHealth waits for the manager to pass its health check after a reload.
+// A manager which does not become healthy is a failed reload, so that the
+// known good configuration is restored.
+func (bm *Manager) CheckHealth() error {
+	err := bm.HealthCheck.Wait(cmHandlerCounter)
+	events.Emit(events.New(events.TypeHealth, bm.Name).WithVersion(bm.ConfigVersion()).WithError(err))
+	if err != nil {
+		metrics.SetButlerHealthCheckVal(metrics.FAILURE, bm.Name)
+		return reloaders.NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+	metrics.SetButlerHealthCheckVal(metrics.SUCCESS, bm.Name)
+	return nil
+}
+
+// GetInstallOpts returns the options used to install the manager files into
+// the dest-path.
+func (bm *Manager) GetInstallOpts() InstallOpts {
+	opts := InstallOpts{Fsync: bm.Fsync, SyncDir: bm.SyncDir, Perms: bm.Perms, FilePerms: make(map[string]FilePerms), FileCopies: make(map[string][]string),
+		Xattrs: bm.Xattrs, PreserveXattrs: bm.PreserveXattrs, Restorecon: bm.Restorecon}
+	for _, o := range bm.ManagerOpts {
+		for f, p := range o.FilePermissions {
+			opts.FilePerms[f] = p
+		}
+		for f, c := range o.FileCopies {
+			opts.FileCopies[f] = append(opts.FileCopies[f], c...)
+		}
+	}
+	return opts
+}
+
+// GetMarkers returns the header and footer markers the manager config files
+// are validated against. Both are empty if marker checking is disabled.
+func (bm *Manager) GetMarkers() (string, string) {
+	if bm.DisableMarkers {
+		return "", ""
+	}
+	return bm.HeaderMarker, bm.FooterMarker
+}
+
+// ValidateStagedFiles runs each of the manager validators against the staged
+// primary (merged) and additional config files, and the validators of the file
+// groups against the files of the group. The files are validated before
+// they are copied into place, so any error returned here must block both the
+// copy and the reload.
+func (bm *Manager) ValidateStagedFiles(primary ChanEvent, additional ChanEvent) (err error) {
+	if len(bm.Validators) == 0 && !bm.hasFileGroupValidators() {
+		return nil
+	}
+	_, span := tracing.Start(bm.traceContext(), "butler.validate", tracing.String("butler.manager", bm.Name), tracing.String("butler.stage", "pre-copy"))
+	defer func(start time.Time) {
+		metrics.SetButlerValidationDuration(bm.Name, "pre-copy", time.Since(start))
+		span.End(err)
+	}(time.Now())
+
+	var staged []TmpFile
+	if hasPrimaryConfig(bm.ManagerOpts) {
+		err = primary.MergePrimaryConfigFiles(bm.ManagerOpts)
+		if err != nil {
+			return err
+		}
+		staged = append(staged, TmpFile{Name: bm.PrimaryConfigName, File: primary.GetMergedConfigFile()})
+	}
+	staged = append(staged, additional.GetTmpFileMap()...)
+
+	for _, v := range bm.Validators {
+		for _, f := range staged {
+			log.Debugf("Manager::ValidateStagedFiles()[count=%v][manager=%v]: validating %v with %v validator", cmHandlerCounter, bm.Name, f.Name, v.GetMethod())
+			if err := v.SetCounter(cmHandlerCounter).Validate(f.File, f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range staged {
+		g := bm.fileGroup(f.Name)
+		if g == nil {
+			continue
+		}
+		for _, v := range g.Validators {
+			log.Debugf("Manager::ValidateStagedFiles()[count=%v][manager=%v]: validating %v with %v validator of file group %v", cmHandlerCounter, bm.Name, f.Name, v.GetMethod(), g.Name)
+			if err := v.SetCounter(cmHandlerCounter).Validate(f.File, f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateDestFiles runs each of the manager post-validators against the
+// config files in dest-path, after they have been copied into place, but
+// before the manager is reloaded.
+func (bm *Manager) ValidateDestFiles() (err error) {
+	if len(bm.PostValidators) == 0 {
+		return nil
+	}
+	_, span := tracing.Start(bm.traceContext(), "butler.validate", tracing.String("butler.manager", bm.Name), tracing.String("butler.stage", "post-copy"))
+	defer func(start time.Time) {
+		metrics.SetButlerValidationDuration(bm.Name, "post-copy", time.Since(start))
+		span.End(err)
+	}(time.Now())
+
+	var dest []TmpFile
+	if hasPrimaryConfig(bm.ManagerOpts) {
+		dest = append(dest, TmpFile{Name: bm.PrimaryConfigName, File: filepath.Join(bm.DestPath, bm.PrimaryConfigName)})
+	}
+	seen := make(map[string]bool)
+	for _, opts := range bm.ManagerOpts {
+		for _, f := range opts.GetAdditionalRemoteConfigFiles() {
+			// the files of a merged file group share the merged file
+			name := opts.destName(f)
+			// optional files which were not upstream were not installed
+			if _, err := os.Stat(filepath.Join(bm.DestPath, name)); os.IsNotExist(err) && opts.IsOptional(f) {
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				dest = append(dest, TmpFile{Name: name, File: filepath.Join(bm.DestPath, name)})
+			}
+		}
+	}
+
+	for _, v := range bm.PostValidators {
+		for _, f := range dest {
+			log.Debugf("Manager::ValidateDestFiles()[count=%v][manager=%v]: validating %v with %v post-validator", cmHandlerCounter, bm.Name, f.File, v.GetMethod())
+			if err := v.SetCounter(cmHandlerCounter).Validate(f.File, f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bm *Manager) DownloadPrimaryConfigFiles(ctx context.Context, c chan ChanEvent) error {
+	var (
+		Chan              *ConfigChanEvent
+		PrimaryConfigName string
+	)
+
+	Chan = NewConfigChanEvent()
+	Chan.Manager = bm.Name
+	Chan.Install = bm.GetInstallOpts()
+	Chan.Diffs = bm.Diffs
+	PrimaryConfigName = filepath.Join(bm.DestPath, bm.PrimaryConfigName)
+	Chan.ConfigFile = &PrimaryConfigName
+
+	// Create a temporary file for the merged prometheus configurations.
+	var tmpFile *os.File
+	err := handleFailure(FailureTempFile, func() (err error) {
+		tmpFile, err = tempFile(os.TempDir(), "bcmsfile")
+		return err
+	})
+	if err != nil {
+		log.Errorf("Manager::DownloadPrimaryConfigFiles()[count=%v][manager=%v]: Could not create temporary file. err=%s", cmHandlerCounter, bm.Name, err.Error())
+		for _, opts := range bm.ManagerOpts {
+			for _, f := range opts.GetPrimaryRemoteConfigFiles() {
+				Chan.SetFailure(opts.Repo, f, err)
+			}
+		}
+		c <- Chan
+		return err
+	}
+	Chan.TmpFile = tmpFile
+
+	// Process the prometheus.yml configuration files
+	// We are going to iterate through each of the potential managers configured
+	for _, opts := range bm.ManagerOpts {
+		for i, u := range opts.GetPrimaryConfigURLs() {
+			log.Debugf("Manager::DownloadPrimaryConfigFiles(): i=%v, u=%v", i, u)
+			log.Debugf("Manager::DownloadPrimaryConfigFiles(): f=%s", opts.GetPrimaryRemoteConfigFiles()[i])
+			if ctx.Err() != nil {
+				Chan.SetFailure(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], ctx.Err())
+				continue
+			}
+			start := time.Now()
+			f := opts.DownloadConfigFile(ctx, u)
+			metrics.SetButlerDownloadVal(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], time.Since(start), downloadedBytes(f))
+			if f == nil {
+				metrics.SetButlerContactVal(metrics.FAILURE, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+
+				// Set this metrics global as failure here, since we aren't sure whether or not it was a parse error or
+				// download error in RunCMHandler()
+				metrics.SetButlerRemoteRepoUp(metrics.FAILURE, bm.Name)
+
+				log.Debugf("Manager::DownloadPrimaryConfigFiles(): download for %s is nil.", u)
+				Chan.SetFailure(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], errors.New("could not download file"))
+				events.Emit(events.New(events.TypeFetch, bm.Name).WithFile(opts.GetPrimaryRemoteConfigFiles()[i]).WithSource(RedactURL(u)).WithError(errors.New("could not download file")))
+				continue
+			} else {
+				metrics.SetButlerContactVal(metrics.SUCCESS, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				events.Emit(events.New(events.TypeFetch, bm.Name).WithFile(opts.GetPrimaryRemoteConfigFiles()[i]).WithSource(RedactURL(u)))
+				Chan.SetSuccess(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], nil)
+			}
+			Chan.SetTmpFile(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], f.Name())
+
+			// For the prometheus.yml we have to do some mustache replacement on downloaded file
+			// We are doing this before the header/footer check because YAML parsing doesn't like
+			// the mustache entries... so we shuffled this around.
+			if err := RenderConfigMustache(f, bm.MustacheSubs); err != nil {
+				log.Errorf("%s for %s.", err.Error(), u)
+				metrics.SetButlerRenderVal(metrics.FAILURE, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				metrics.SetButlerConfigVal(metrics.FAILURE, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				log.Debugf("Manager::DownloadPrimaryConfigFiles(): render for %s is nil.", opts.GetPrimaryRemoteConfigFiles()[i])
+				Chan.SetFailure(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], errRenderFile)
+				events.Emit(events.New(events.TypeValidation, bm.Name).WithFile(opts.GetPrimaryRemoteConfigFiles()[i]).WithSource(RedactURL(u)).WithError(err))
+				continue
+			} else {
+				// metrics
+				metrics.SetButlerRenderVal(metrics.SUCCESS, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				metrics.SetButlerConfigVal(metrics.SUCCESS, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				Chan.SetSuccess(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], nil)
+			}
+
+			// Let's ensure that the files starts with #butlerstart and
+			// ends with #butlerend. If they do not, then we will assume
+			// we did not get a correct configuration, or that there is an
+			// issue with the upstream
+			filename := opts.GetPrimaryRemoteConfigFiles()[i]
+			_, span := tracing.Start(ctx, "butler.validate", tracing.String("butler.manager", bm.Name), tracing.String("butler.repo", opts.Repo), tracing.String("butler.file", filename))
+			err := ValidateConfig(NewValidateOpts().WithContentType(opts.GetContentType(filename)).WithFileName(filename).WithData(f).WithManager(bm.Name).WithMarkers(bm.GetMarkers()).WithSizeLimits(opts.GetSizeLimits(filename)))
+			span.End(err)
+			if err != nil {
+				log.Errorf("%s for %s.", err.Error(), u)
+				metrics.SetButlerConfigVal(metrics.FAILURE, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+
+				// Set this metrics global as failure here, since we aren't sure whether or not it was a parse error or
+				// download error in RunCMHandler()
+				metrics.SetButlerRemoteRepoSanity(metrics.FAILURE, bm.Name)
+
+				Chan.SetFailure(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], errValidateFile)
+				events.Emit(events.New(events.TypeValidation, bm.Name).WithFile(filename).WithSource(RedactURL(u)).WithError(err))
+				continue
+			} else {
+				metrics.SetButlerConfigVal(metrics.SUCCESS, opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i])
+				Chan.SetSuccess(opts.Repo, opts.GetPrimaryRemoteConfigFiles()[i], nil)
+			}
+		}
+	}
+
+	// Update the channel
+	c <- Chan
+
+	return nil
+}
+
+func (bm *Manager) DownloadAdditionalConfigFiles(ctx context.Context, c chan ChanEvent) error {
+	var (
+		Chan       *ConfigChanEvent
+		IsModified bool
+	)
+
+	Chan = NewConfigChanEvent()
+	Chan.Manager = bm.Name
+	Chan.Install = bm.GetInstallOpts()
+	Chan.Diffs = bm.Diffs
+	IsModified = false
+	_ = IsModified
+
+	// Process the additional configuration files
+	for _, opts := range bm.ManagerOpts {
+		if err := opts.RefreshGlobs(); err != nil {
+			log.Errorf("Manager::DownloadAdditionalConfigFiles()[count=%v][manager=%v]: %v", cmHandlerCounter, bm.Name, err.Error())
+			metrics.SetButlerRemoteRepoUp(metrics.FAILURE, bm.Name)
+			Chan.SetFailure(opts.Repo, "additional-config", err)
+			events.Emit(events.New(events.TypeFetch, bm.Name).WithSource(RedactURL(opts.baseRemotePath)).WithError(err))
+			continue
+		}
+		if err := opts.RefreshSyncDirs(); err != nil {
+			log.Errorf("Manager::DownloadAdditionalConfigFiles()[count=%v][manager=%v]: %v", cmHandlerCounter, bm.Name, err.Error())
+			metrics.SetButlerRemoteRepoUp(metrics.FAILURE, bm.Name)
+			Chan.SetFailure(opts.Repo, "sync-dirs", err)
+			events.Emit(events.New(events.TypeFetch, bm.Name).WithSource(RedactURL(opts.baseRemotePath)).WithError(err))
+			continue
+		}
+		for i, u := range opts.GetAdditionalConfigURLs() {
+			log.Debugf("Manager::DownloadAdditionalConfigFiles(): i=%v, u=%v", i, u)
+			// the files of the file groups are staged under their path
+			// relative to the dest-path
+			name := opts.LocalName(opts.GetAdditionalRemoteConfigFiles()[i])
+			if ctx.Err() != nil {
+				Chan.SetFailure(opts.Repo, name, ctx.Err())
+				continue
+			}
+			start := time.Now()
+			f, err := opts.downloadConfigFile(ctx, u)
+			metrics.SetButlerDownloadVal(opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i], time.Since(start), downloadedBytes(f))
+			// an optional file which is not upstream is left out, and the
+			// manager carries on without it
+			optional := opts.IsOptional(opts.GetAdditionalRemoteConfigFiles()[i])
+			if optional && (f != nil || err == errFileNotFound) {
+				metrics.SetButlerOptionalFileVal(f != nil, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+			}
+			if f == nil && optional && err == errFileNotFound {
+				log.Infof("Manager::DownloadAdditionalConfigFiles()[count=%v][manager=%v]: optional file %v is not upstream. skipping.", cmHandlerCounter, bm.Name, opts.GetAdditionalRemoteConfigFiles()[i])
+				Chan.SetSuccess(opts.Repo, name, errFileNotFound)
+				events.Emit(events.New(events.TypeFetch, bm.Name).WithFile(opts.GetAdditionalRemoteConfigFiles()[i]).WithSource(RedactURL(u)).WithError(errFileNotFound))
+				continue
+			}
+			if f == nil {
+				log.Debugf("Manager::DownloadAdditionalConfigFiles(): download for %s is nil.", u)
+				metrics.SetButlerContactVal(metrics.FAILURE, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+
+				// Set this metrics global as failure here, since we aren't sure whether or not it was a parse error or
+				// download error in RunCMHandler()
+				metrics.SetButlerRemoteRepoUp(metrics.FAILURE, bm.Name)
+
+				Chan.SetFailure(opts.Repo, name, errors.New("could not download file"))
+				events.Emit(events.New(events.TypeFetch, bm.Name).WithFile(opts.GetAdditionalRemoteConfigFiles()[i]).WithSource(RedactURL(u)).WithError(errors.New("could not download file")))
+				continue
+			} else {
+				metrics.SetButlerContactVal(metrics.SUCCESS, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				events.Emit(events.New(events.TypeFetch, bm.Name).WithFile(opts.GetAdditionalRemoteConfigFiles()[i]).WithSource(RedactURL(u)))
+				Chan.SetSuccess(opts.Repo, name, nil)
+				Chan.SetTmpFile(opts.Repo, name, f.Name())
+			}
+
+			// Binary files are neither rendered nor validated, they are only
+			// compared by size and checksum when they are copied into place.
+			filename := opts.GetAdditionalRemoteConfigFiles()[i]
+			if opts.IsBinary(filename) {
+				log.Debugf("Manager::DownloadAdditionalConfigFiles(): %s is binary, skipping render and validation.", filename)
+				// only the size of binary files is checked
+				if err := ValidateConfig(NewValidateOpts().WithContentType("binary").WithFileName(filename).WithData(f).WithManager(bm.Name).WithSizeLimits(opts.GetSizeLimits(filename))); err != nil {
+					metrics.SetButlerConfigVal(metrics.FAILURE, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+					metrics.SetButlerRemoteRepoSanity(metrics.FAILURE, bm.Name)
+					Chan.SetFailure(opts.Repo, name, errValidateFile)
+					events.Emit(events.New(events.TypeValidation, bm.Name).WithFile(filename).WithSource(RedactURL(u)).WithError(err))
+					continue
+				}
+				Chan.SetBinary(opts.Repo, name)
+				continue
+			}
+
+			// Let's process some mustache ...
+			// NOTE: We USED to do this only for the primary configuration. Unsure how this will
+			// affect the additional configurations. we can remove this if there are adverse
+			// effects.
+			// We are doing this before the header/footer check because YAML parsing doesn't like
+			// the mustache entries... so we shuffled this around.
+			if err := RenderConfigMustache(f, bm.MustacheSubs); err != nil {
+				metrics.SetButlerRenderVal(metrics.FAILURE, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				metrics.SetButlerConfigVal(metrics.FAILURE, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				Chan.SetFailure(opts.Repo, name, errRenderFile)
+				events.Emit(events.New(events.TypeValidation, bm.Name).WithFile(filename).WithSource(RedactURL(u)).WithError(err))
+				continue
+			} else {
+				metrics.SetButlerRenderVal(metrics.SUCCESS, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				metrics.SetButlerConfigVal(metrics.SUCCESS, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				Chan.SetSuccess(opts.Repo, name, nil)
+			}
+
+			// Let's ensure that the files starts with #butlerstart and
+			// ends with #butlerend. IF they do not, then we will assume
+			// we did not get a correct configuration, or that there is an
+			// issue with the upstream
+			_, span := tracing.Start(ctx, "butler.validate", tracing.String("butler.manager", bm.Name), tracing.String("butler.repo", opts.Repo), tracing.String("butler.file", filename))
+			err = ValidateConfig(NewValidateOpts().WithContentType(opts.GetContentType(filename)).WithFileName(filename).WithData(f).WithManager(bm.Name).WithMarkers(bm.GetMarkers()).WithSizeLimits(opts.GetSizeLimits(filename)))
+			span.End(err)
+			if err != nil {
+				metrics.SetButlerConfigVal(metrics.FAILURE, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+
+				// Set this metrics global as failure here, since we aren't sure whether or not it was a parse error or
+				// download error in RunCMHandler()
+				metrics.SetButlerRemoteRepoSanity(metrics.FAILURE, bm.Name)
+
+				Chan.SetFailure(opts.Repo, name, errValidateFile)
+				events.Emit(events.New(events.TypeValidation, bm.Name).WithFile(filename).WithSource(RedactURL(u)).WithError(err))
+				continue
+			} else {
+				metrics.SetButlerConfigVal(metrics.SUCCESS, opts.Repo, opts.GetAdditionalRemoteConfigFiles()[i])
+				Chan.SetSuccess(opts.Repo, name, nil)
+			}
+		}
+	}
+
+	// the files of the merged file groups are staged as the merged file
+	bm.mergeFileGroups(Chan)
+
+	// Update the channel
+	c <- Chan
+	return nil
+}
+
+// PathCleanup
+func (bm *Manager) PathCleanup(path string, f os.FileInfo, err error) error {
+	var (
+		Found bool
+	)
+	Found = false
+
+	// We don't have to do anything with a directory
+	if f.Mode().IsDir() {
+		log.Debugf("Manager::PathCleanup(): %s is a directory... returning nil", f.Name())
+		return nil
+	}
+
+	for _, file := range bm.GetAllLocalPaths() {
+		if path == file {
+			Found = true
+		}
+	}
+
+	if !Found {
+		if !bm.IsCleanable(path) {
+			log.Debugf("Manager::PathCleanup(): Found unknown file \"%s\", but it is protected. not deleting.", path)
+			return nil
+		}
+		message := fmt.Sprintf("Found unknown file \"%s\". deleting...", path)
+		log.Debugf("Manager::PathCleanup(): Found unknown file \"%s\". deleting...", path)
+		if err := os.Remove(path); err == nil {
+			metrics.SetButlerCleanVal(bm.Name, metrics.GetStatsLabel(path))
+			events.Emit(events.New(events.TypeDelete, bm.Name).WithFile(path))
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+// IsCleanable returns true if clean-files is allowed to delete the file. When
+// clean-files-include is set, only the files matching it are deleted, and
+// files matching clean-files-exclude are never deleted. The patterns are
+// matched against the path relative to the dest-path, and the base name.
+func (bm *Manager) IsCleanable(file string) bool {
+	rel, err := filepath.Rel(bm.DestPath, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if len(bm.CleanFilesInclude) > 0 && !MatchPatterns(bm.CleanFilesInclude, rel) {
+		return false
+	}
+	return !MatchPatterns(bm.CleanFilesExclude, rel)
+}
+
+func (bm *Manager) GetAllLocalPaths() []string {
+	var result []string
+
+	for _, opt := range bm.ManagerOpts {
+		for _, f := range opt.PrimaryConfigsFullLocalPaths {
+			result = append(result, f)
+		}
+		for _, f := range opt.GetAdditionalLocalConfigFiles() {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func (bmo *ManagerOpts) AppendPrimaryConfigURL(c string) error {
+	log.Debugf("ManagerOpts::AppendPrimaryConfigURL(): adding %s to PrimaryConfigsURLs...", c)
+	bmo.PrimaryConfigsFullURLs = append(bmo.PrimaryConfigsFullURLs, c)
+	return nil
+}
+
+func (bmo *ManagerOpts) AppendPrimaryConfigFile(c string) error {
+	log.Debugf("ManagerOpts::AppendPrimaryConfigFile(): adding %s to PrimaryConfigsFullLocalPaths...", c)
+	bmo.PrimaryConfigsFullLocalPaths = append(bmo.PrimaryConfigsFullLocalPaths, c)
+	return nil
+}
+
+func (bmo *ManagerOpts) AppendAdditionalConfigURL(c string) error {
+	log.Debugf("ManagerOpts::AppendAdditionalConfigURL(): adding %s to AdditionalConfigsURLs...", c)
+	bmo.AdditionalConfigsFullURLs = append(bmo.AdditionalConfigsFullURLs, c)
+	return nil
+}
+
+func (bmo *ManagerOpts) AppendAdditionalConfigFile(c string) error {
+	log.Debugf("ManagerOpts::AppendAdditionalConfigFile(): adding %s to AdditionalConfigsFullLocalPaths...", c)
+	bmo.AdditionalConfigsFullLocalPaths = append(bmo.AdditionalConfigsFullLocalPaths, c)
+	return nil
+}
+
+func (bmo *ManagerOpts) SetParentManager(c string) error {
+	bmo.parentManager = c
+	return nil
+}
+
+// SetDownloadCache sets the directory the downloaded files are cached in,
+// so that they are only downloaded again once they have changed.
+func (bmo *ManagerOpts) SetDownloadCache(dir string) error {
+	bmo.downloadCache = dir
+	return nil
+}
+
+// SetBasePaths sets the remote path the repository files are retrieved
+// from, and the local path they are installed to.
+func (bmo *ManagerOpts) SetBasePaths(remote string, local string) error {
+	bmo.baseRemotePath = remote
+	bmo.destPath = local
+	return nil
+}
+
+func (bmo *ManagerOpts) GetPrimaryConfigURLs() []string {
+	return bmo.PrimaryConfigsFullURLs
+}
+
+func (bmo *ManagerOpts) GetPrimaryLocalConfigFiles() []string {
+	return bmo.PrimaryConfigsFullLocalPaths
+}
+
+func (bmo *ManagerOpts) GetPrimaryRemoteConfigFiles() []string {
+	return bmo.PrimaryConfig
+}
+
+// GetAdditionalConfigURLs returns the URLs of the additional config files,
+// followed by those of the files of the file groups, of the files matching
+// the additional-config patterns, and of the files found in the sync-dirs.
+func (bmo *ManagerOpts) GetAdditionalConfigURLs() []string {
+	if len(bmo.groupFiles) == 0 && len(bmo.GlobbedConfig) == 0 && len(bmo.SyncedConfig) == 0 {
+		return bmo.AdditionalConfigsFullURLs
+	}
+	result := append([]string{}, bmo.AdditionalConfigsFullURLs...)
+	for _, f := range bmo.groupFiles {
+		result = append(result, fmt.Sprintf("%s/%s", bmo.baseRemotePath, f.file))
+	}
+	for _, f := range bmo.GlobbedConfig {
+		result = append(result, fmt.Sprintf("%s/%s", bmo.baseRemotePath, f))
+	}
+	for _, f := range bmo.SyncedConfig {
+		result = append(result, fmt.Sprintf("%s/%s", bmo.baseRemotePath, f))
+	}
+	return result
+}
+
+// GetAdditionalLocalConfigFiles returns the local paths of the additional
+// config files, followed by those of the files of the file groups, where the
+// files of a merged group share one path, of the files matching the
+// additional-config patterns, and of the files found in the sync-dirs.
+func (bmo *ManagerOpts) GetAdditionalLocalConfigFiles() []string {
+	if len(bmo.groupFiles) == 0 && len(bmo.GlobbedConfig) == 0 && len(bmo.SyncedConfig) == 0 {
+		return bmo.AdditionalConfigsFullLocalPaths
+	}
+	result := append([]string{}, bmo.AdditionalConfigsFullLocalPaths...)
+	seen := make(map[string]bool)
+	for _, f := range bmo.groupFiles {
+		if !seen[f.name] {
+			seen[f.name] = true
+			result = append(result, filepath.Join(bmo.destPath, f.name))
+		}
+	}
+	for _, f := range bmo.GlobbedConfig {
+		result = append(result, filepath.Join(bmo.destPath, bmo.destName(f)))
+	}
+	for _, f := range bmo.SyncedConfig {
+		result = append(result, filepath.Join(bmo.destPath, bmo.destName(f)))
+	}
+	return result
+}
+
+// GetAdditionalRemoteConfigFiles returns the repo paths of the additional
+// config files, followed by those of the files of the file groups, of the
+// files matching the additional-config patterns, and of the files found in
+// the sync-dirs.
+func (bmo *ManagerOpts) GetAdditionalRemoteConfigFiles() []string {
+	if len(bmo.groupFiles) == 0 && len(bmo.GlobbedConfig) == 0 && len(bmo.SyncedConfig) == 0 {
+		return bmo.AdditionalConfig
+	}
+	result := append([]string{}, bmo.AdditionalConfig...)
+	for _, f := range bmo.groupFiles {
+		result = append(result, f.file)
+	}
+	result = append(result, bmo.GlobbedConfig...)
+	return append(result, bmo.SyncedConfig...)
+}
+
+// GetContentType returns the content-type to validate the file with. A
+// manager.content-types entry for the file takes precedence over the
+// content-type of its file group, which takes precedence over the
+// manager.content-type.
+func (bmo *ManagerOpts) GetContentType(file string) string {
+	if t, ok := bmo.ContentTypes[filepath.Clean(file)]; ok {
+		return t
+	}
+	if t, ok := bmo.ContentTypes[filepath.Base(file)]; ok {
+		return t
+	}
+	if g := bmo.groupFileGroup(filepath.ToSlash(filepath.Clean(file))); g != nil && g.ContentType != "" {
+		return g.ContentType
+	}
+	return bmo.ContentType
+}
+
+// IsOptional returns true if the file matches one of the
+// manager.optional-config patterns. An optional file which is not upstream is
+// left out, rather than failing the run of the manager.
+func (bmo *ManagerOpts) IsOptional(file string) bool {
+	return MatchPatterns(bmo.OptionalConfig, file)
+}
+
+// GetSizeLimits returns the min-size of the file, which is the largest of the
+// manager.min-size entries matching it, and whether the file matches one of
+// the manager.must-not-be-empty patterns.
+func (bmo *ManagerOpts) GetSizeLimits(file string) (int64, bool) {
+	var minSize int64
+	for p, n := range bmo.MinSizes {
+		if n > minSize && MatchPatterns([]string{p}, file) {
+			minSize = n
+		}
+	}
+	return minSize, MatchPatterns(bmo.MustNotBeEmpty, file)
+}
+
+// IsBinary returns true if the file has the binary content-type.
+func (bmo *ManagerOpts) IsBinary(file string) bool {
+	return bmo.GetContentType(file) == "binary"
+}
+
+// RemoteURL returns the *url.URL which is handed to the repository method for
+// the full remote path of a file.
+func (bmo *ManagerOpts) RemoteURL(file string) (*url.URL, error) {
+	if (bmo.Method == "file") || (bmo.Method == "s3") {
+		// the file argument for the Get()'ing configs are passed in like:
+		// file://repo/full/path/to/file. We need to strip out file:// and
+		// repo to get the actual path on the filesystem. So that is what
+		// we are doing here.
+		file = fmt.Sprintf("/%s", strings.Join(strings.Split(strings.Split(file, "://")[1], "/")[1:], "/"))
+	}
+
+	if bmo.Method == "blob" {
+		// the file argument for the Get()'ing configs are passed in like:
+		// blob://storageaccount/container/file. We need to strip out blob://
+		file = strings.Split(file, "://")[1]
+	}
+
+	return url.Parse(file)
+}
+
+// Really need to come up with a better method for this. The download is given
+// up on once ctx is done.
+func (bmo *ManagerOpts) DownloadConfigFile(ctx context.Context, file string) *os.File {
+	f, _ := bmo.downloadConfigFile(ctx, file)
+	return f
+}
+
+// downloadedBytes returns the size of the file returned by
+// DownloadConfigFile, 0 for a failed download.
+func downloadedBytes(f *os.File) int64 {
+	if f == nil {
+		return 0
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// fetchConfigFile fetches the file from the repository to a temporary file.
+// It returns errFileNotFound along with the nil file when the repository does
+// not have the file.
+func (bmo *ManagerOpts) fetchConfigFile(ctx context.Context, file string) (*os.File, error) {
+	if IsValidScheme(bmo.Method) {
+		var tmpFile *os.File
+		err := handleFailure(FailureTempFile, func() (err error) {
+			tmpFile, err = tempFile(os.TempDir(), "bcmsfile")
+			return err
+		})
+		if err != nil {
+			log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: could not create temporary file. err=%v", cmHandlerCounter, bmo.parentManager, err)
+			return nil, err
+		}
+		_, span := tracing.Start(ctx, "butler.download", tracing.String("butler.manager", bmo.parentManager), tracing.String("butler.repo", bmo.Repo), tracing.String("butler.url", RedactURL(file)))
+
+		url, err := bmo.RemoteURL(file)
+		if err != nil {
+			tmpFile.Close()
+			removeTempFile(tmpFile.Name())
+			log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not parse file %s to *url.URL, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+			span.End(err)
+			return nil, err
+		}
+		// a file which a manager has fetched less than the
+		// response-cache-ttl ago is not fetched again
+		if n, ok := bmo.copyCachedResponse(file, tmpFile); ok {
+			tmpFile.Close()
+			log.Debugf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: using cached response for %s.", cmHandlerCounter, bmo.parentManager, file)
+			metrics.IncButlerResponseCacheHit(bmo.Repo)
+			span.SetAttributes(tracing.Bool("butler.response_cache", true), tracing.Int("butler.bytes", int(n)))
+			span.End(nil)
+			return tmpFile, nil
+		}
+		// a file which is unchanged since it was cached is not downloaded
+		// again
+		cached := bmo.cachedDownload(file)
+		var validators methods.Validators
+		if cached != nil {
+			validators = cached.Validators
+		}
+		response, err := methods.GetIfModified(ctx, bmo.Opts, url, validators)
+
+		if err != nil {
+			tmpFile.Close()
+			removeTempFile(tmpFile.Name())
+			log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not download from %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+			span.End(err)
+			if response != nil && response.GetResponseStatusCode() == http.StatusNotFound {
+				return nil, errFileNotFound
+			}
+			return nil, err
+		}
+		defer response.GetResponseBody().Close()
+		defer tmpFile.Close()
+
+		if response.GetResponseStatusCode() == http.StatusNotModified && cached != nil {
+			n, err := bmo.copyCachedDownload(file, tmpFile)
+			if err != nil {
+				tmpFile.Close()
+				removeTempFile(tmpFile.Name())
+				log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not copy cached %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+				span.End(err)
+				return nil, err
+			}
+			log.Debugf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: %s not modified, using cached copy.", cmHandlerCounter, bmo.parentManager, file)
+			if err := bmo.cacheResponse(file, tmpFile.Name(), cached.ETag); err != nil {
+				log.Warnf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not cache the response for %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+			}
+			span.SetAttributes(tracing.Int("butler.status_code", response.GetResponseStatusCode()), tracing.Int("butler.bytes", int(n)))
+			span.End(nil)
+			return tmpFile, nil
+		}
+
+		if response.GetResponseStatusCode() != 200 {
+			tmpFile.Close()
+			removeTempFile(tmpFile.Name())
+			log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Did not receive 200 response code for %s. code=%v", cmHandlerCounter, bmo.parentManager, file, response.GetResponseStatusCode())
+			span.SetAttributes(tracing.Int("butler.status_code", response.GetResponseStatusCode()))
+			err := fmt.Errorf("did not receive 200 response code. code=%v", response.GetResponseStatusCode())
+			span.End(err)
+			if response.GetResponseStatusCode() == http.StatusNotFound {
+				return nil, errFileNotFound
+			}
+			return nil, err
+		}
+
+		n, err := io.Copy(tmpFile, response.GetResponseBody())
+		if err != nil {
+			tmpFile.Close()
+			removeTempFile(tmpFile.Name())
+			log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not copy to %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+			span.End(err)
+			return nil, err
+		}
+		if err := bmo.cacheDownload(file, tmpFile.Name(), response.GetResponseValidators()); err != nil {
+			log.Warnf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not cache %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+		}
+		if err := bmo.cacheResponse(file, tmpFile.Name(), response.GetResponseValidators().ETag); err != nil {
+			log.Warnf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not cache the response for %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+		}
+		span.SetAttributes(tracing.Int("butler.bytes", int(n)))
+		span.End(nil)
+		return tmpFile, nil
+	} else {
+		return nil, fmt.Errorf("unknown method %v", bmo.Method)
+	}
+}
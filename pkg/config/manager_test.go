@@ -0,0 +1,137 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/adobe/butler/pkg/destinations"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	. "gopkg.in/check.v1"
+)
+
+// testDestination keeps the files which are published to it.
+type testDestination struct {
+	files map[string][]byte
+	err   error
+}
+
+func (d *testDestination) Publish(files map[string][]byte) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.files = files
+	return nil
+}
+
+func (d *testDestination) GetMethod() string {
+	return "test"
+}
+
+func (d *testDestination) GetOpts() destinations.DestinationOpts {
+	return nil
+}
+
+func (s *ConfigTestSuite) TestManagerPublish(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(dir+"/rules", 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("global: {}\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/rules/alerts.yml", []byte("groups: []\n"), 0644), IsNil)
+
+	d := &testDestination{}
+	m := &Manager{
+		Name:              "publish-manager",
+		DestPath:          dir,
+		PrimaryConfigName: "prometheus.yml",
+		Destination:       d,
+		ManagerOpts: map[string]*ManagerOpts{
+			"publish-manager.repo": {AdditionalConfigsFullLocalPaths: []string{dir + "/rules/alerts.yml", dir + "/rules/missing.yml"}},
+		},
+	}
+	c.Assert(m.Publish(), IsNil)
+	c.Assert(d.files, DeepEquals, map[string][]byte{"prometheus.yml": []byte("global: {}\n"), "rules/alerts.yml": []byte("groups: []\n")})
+
+	// a manager whose files cannot be published fails its reload
+	d.err = errors.New("forbidden")
+	m.ChangedFiles = []string{"prometheus.yml"}
+	err := m.Reload()
+	c.Assert(err, FitsTypeOf, &reloaders.ReloaderError{})
+	c.Assert(err, ErrorMatches, ".*could not publish to the test destination. forbidden.*")
+	c.Assert(m.ChangedFiles, IsNil)
+
+	m.Destination = nil
+	c.Assert(m.Publish(), IsNil)
+}
+
+func (s *ConfigTestSuite) TestOptionalConfig(c *C) {
+	src, err := ioutil.TempDir("/tmp", "boptsrc")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("/tmp", "boptdst")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dst)
+	c.Assert(ioutil.WriteFile(src+"/a.yml", []byte("a\n"), 0644), IsNil)
+
+	config := wrapConfig(fmt.Sprintf(`[globals]
+  config-managers = ["test-handler"]
+  scheduler-interval = 300
+  exit-on-config-failure = "false"
+  [test-handler]
+    repos = ["localhost"]
+    dest-path = "%s"
+    primary-config-name = "prometheus.yml"
+    disable-markers = "true"
+    [test-handler.localhost]
+      method = "file"
+      repo-path = "%s"
+      primary-config = ["a.yml"]
+      additional-config = ["b.yml", "extra/c.yml"]
+      optional-config = ["extra/*"]
+`, dst, src))
+	settings := NewConfigSettings()
+	c.Assert(settings.parseConfig(config, "toml", nil, nil), IsNil)
+	m := settings.Managers["test-handler"]
+	opts := m.ManagerOpts["test-handler.localhost"]
+	c.Assert(opts.IsOptional("extra/c.yml"), Equals, true)
+	c.Assert(opts.IsOptional("b.yml"), Equals, false)
+
+	// a required file which is not upstream blocks the copy
+	ch := make(chan ChanEvent, 1)
+	c.Assert(m.DownloadAdditionalConfigFiles(context.Background(), ch), IsNil)
+	additional := <-ch
+	c.Assert(additional.CanCopyFiles(), Equals, false)
+	additional.CleanTmpFiles()
+
+	// an optional file which is not upstream is left out
+	c.Assert(ioutil.WriteFile(src+"/b.yml", []byte("b\n"), 0644), IsNil)
+	c.Assert(m.DownloadAdditionalConfigFiles(context.Background(), ch), IsNil)
+	additional = <-ch
+	c.Assert(additional.CanCopyFiles(), Equals, true)
+	c.Assert(additional.GetTmpFileMap(), HasLen, 1)
+	c.Assert(additional.CopyAdditionalConfigFiles(m.DestPath), Equals, true)
+	additional.CleanTmpFiles()
+	_, err = os.Stat(dst + "/extra/c.yml")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// any other failure of an optional file still blocks the copy
+	c.Assert(os.MkdirAll(src+"/extra/c.yml", 0755), IsNil)
+	c.Assert(m.DownloadAdditionalConfigFiles(context.Background(), ch), IsNil)
+	additional = <-ch
+	c.Assert(additional.CanCopyFiles(), Equals, false)
+	additional.CleanTmpFiles()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	"github.com/spf13/viper"
+)
+
+// configMethodManager is the manager which the method of the butler
+// configuration is set up for, when it is set up with method options.
+const configMethodManager = "butler-config"
+
+// newConfigMethod returns the method which retrieves the butler configuration
+// at u, set up with the method options in the file at path, rather than with
+// the command line options. The file is in the form of the options of the
+// method of a repo, under the method, eg:
+//
+//	[s3]
+//	  region = "us-west-2"
+//	  access-key-id = "env:AWS_ACCESS_KEY_ID"
+//
+// so that every option of the repo methods, eg: the retries and the
+// authentication of http, or a plugin method, is available. The bucket of s3,
+// and the storage-account-name of blob, default to the host of u.
+func newConfigMethod(path string, u *url.URL) (methods.Method, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read method options %v err=%v", path, err.Error())
+	}
+	settings, err := configSettings(data, ConfigFormat(path, data))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse method options %v err=%v", path, err.Error())
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	opts, ok := settings[scheme].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no %v method options in %v", scheme, path)
+	}
+	switch scheme {
+	case "s3":
+		if _, ok := opts["bucket"]; !ok {
+			opts["bucket"] = u.Host
+		}
+	case "blob":
+		if _, ok := opts["storage-account-name"]; !ok {
+			opts["storage-account-name"] = u.Host
+		}
+	}
+
+	// the methods are set up from the options of the butler configuration,
+	// which the next butler configuration that is parsed replaces
+	data, err = json.Marshal(map[string]interface{}{configMethodManager: map[string]interface{}{scheme: opts}})
+	if err != nil {
+		return nil, fmt.Errorf("could not parse method options %v err=%v", path, err.Error())
+	}
+	viper.SetConfigType("json")
+	if err = viper.ReadConfig(bytes.NewBuffer(data)); err != nil {
+		return nil, fmt.Errorf("could not parse method options %v err=%v", path, err.Error())
+	}
+	manager, entry := configMethodManager, configMethodManager+"."+scheme
+	return methods.New(&manager, scheme, &entry)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestNewConfigMethod(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bmethodopts")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := dir + "/method.toml"
+	c.Assert(ioutil.WriteFile(path, []byte(`[https]
+  retries = "2"
+  timeout = "3"
+  auth-type = "token-key"
+  auth-user = "butler"
+  auth-token = "secret"
+[s3]
+  region = "us-west-2"
+  access-key-id = "id"
+  secret-access-key = "key"
+`), 0644), IsNil)
+
+	// the options are those of the method of a repo
+	u, _ := url.Parse("https://configs.domain.com/butler.toml")
+	m, err := newConfigMethod(path, u)
+	c.Assert(err, IsNil)
+	h := m.(methods.HTTPMethod)
+	c.Assert(h.Retries, Equals, "2")
+	c.Assert(h.Timeout, Equals, "3")
+	c.Assert(h.AuthType, Equals, "token-key")
+	c.Assert(h.AuthToken, Equals, "secret")
+
+	// the bucket defaults to the host
+	u, _ = url.Parse("s3://butler-configs/butler.toml")
+	m, err = newConfigMethod(path, u)
+	c.Assert(err, IsNil)
+	c.Assert(m.(methods.S3Method).Bucket, Equals, "butler-configs")
+	c.Assert(m.(methods.S3Method).Region, Equals, "us-west-2")
+
+	bc, err := NewButlerConfig(&ButlerConfigOpts{URL: u, MethodOptions: path})
+	c.Assert(err, IsNil)
+	client, err := NewConfigClient(bc)
+	c.Assert(err, IsNil)
+	c.Assert(client.Scheme, Equals, "s3")
+	c.Assert(client.Method.(methods.S3Method).Bucket, Equals, "butler-configs")
+
+	u, _ = url.Parse("etcd://host/butler.toml")
+	_, err = newConfigMethod(path, u)
+	c.Assert(err, ErrorMatches, "no etcd method options in .*method.toml")
+	_, err = newConfigMethod(dir+"/nonexistent.toml", u)
+	c.Assert(err, ErrorMatches, "could not read method options .*nonexistent.toml err=.*")
+}
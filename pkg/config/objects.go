@@ -0,0 +1,305 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/scheduler"
+)
+
+// InstallOpts are the options used when installing a file into its
+// destination. Files are always written to a temporary file in the
+// destination directory and renamed into place. Fsync syncs the file to disk
+// before the rename, and SyncDir syncs the destination directory after it.
+// Perms are applied to every installed file, and FilePerms, keyed by the file
+// name relative to the dest-path, override them per file. Copies are the
+// other paths the file is installed to along with its destination, and
+// FileCopies are the Copies of each file, keyed the same as FilePerms.
+// Xattrs are the extended attributes set on every installed file, eg: its
+// SELinux context, after those of the file being replaced when
+// PreserveXattrs is set, and Restorecon is the restorecon command which is
+// run on every installed file, if any.
+type InstallOpts struct {
+	Fsync          bool
+	SyncDir        bool
+	Perms          FilePerms
+	FilePerms      map[string]FilePerms
+	Copies         []string
+	FileCopies     map[string][]string
+	Xattrs         map[string]string
+	PreserveXattrs bool
+	Restorecon     string
+}
+
+// NewInstallOpts returns the default InstallOpts.
+func NewInstallOpts() InstallOpts {
+	return InstallOpts{Fsync: true}
+}
+
+// ForFile returns the InstallOpts with the permissions and the copies for
+// the named file.
+func (o InstallOpts) ForFile(name string) InstallOpts {
+	p, ok := o.FilePerms[filepath.Clean(name)]
+	if !ok {
+		p, ok = o.FilePerms[filepath.Base(name)]
+	}
+	if ok {
+		o.Perms = o.Perms.Merge(p)
+	}
+	c, ok := o.FileCopies[filepath.Clean(name)]
+	if !ok {
+		c = o.FileCopies[filepath.Base(name)]
+	}
+	o.Copies = c
+	return o
+}
+
+// FilePerms are the mode, owner and group of an installed file. A zero Mode
+// keeps the mode of the file being replaced, and an empty Owner or Group
+// leaves the owner or group unchanged. Uid and Gid are the ids the Owner and
+// Group resolve to.
+type FilePerms struct {
+	Mode  os.FileMode `json:"mode,omitempty"`
+	Owner string      `json:"owner,omitempty"`
+	Group string      `json:"group,omitempty"`
+	Uid   int         `json:"-"`
+	Gid   int         `json:"-"`
+}
+
+// Merge returns the FilePerms with any of the values set in o overriding
+// those of p.
+func (p FilePerms) Merge(o FilePerms) FilePerms {
+	if o.Mode != 0 {
+		p.Mode = o.Mode
+	}
+	if o.Owner != "" {
+		p.Owner, p.Uid = o.Owner, o.Uid
+	}
+	if o.Group != "" {
+		p.Group, p.Gid = o.Group, o.Gid
+	}
+	return p
+}
+
+type TmpFile struct {
+	Name   string
+	File   string
+	Binary bool
+}
+
+type RepoFileEvent struct {
+	Success map[string]bool
+	Error   map[string]error
+	TmpFile map[string]string
+	Binary  map[string]bool
+}
+
+func (r *RepoFileEvent) SetSuccess(file string, err error) error {
+	r.Success[file] = true
+	r.Error[file] = err
+	return nil
+}
+
+func (r *RepoFileEvent) SetFailure(file string, err error) error {
+	r.Success[file] = false
+	r.Error[file] = err
+	return nil
+}
+
+func (r *RepoFileEvent) SetTmpFile(file string, tmpfile string) error {
+	r.TmpFile[file] = tmpfile
+	return nil
+}
+
+func (r *RepoFileEvent) SetBinary(file string) error {
+	if r.Binary == nil {
+		r.Binary = make(map[string]bool)
+	}
+	r.Binary[file] = true
+	return nil
+}
+
+type ConfigFileMap struct {
+	TmpFile string
+	Success bool
+}
+
+type ConfigSettings struct {
+	Managers map[string]*Manager `json:"managers"`
+	Globals  ConfigGlobals       `json:"globals"`
+	// Strict rejects the unknown keys, the missing required keys, and the
+	// values of the wrong type, of the configuration, which are otherwise
+	// ignored or converted, eg: a misspelled retry-wiat.
+	Strict bool `json:"-"`
+	// check is set by CheckConfig, which parses the configuration without
+	// touching the event sinks and notifiers, and without ever exiting.
+	check bool
+}
+
+func (b *ConfigSettings) GetAllConfigLocalPaths(mgr string) []string {
+	var result []string
+	if _, ok := b.Managers[mgr]; !ok {
+		return result
+	}
+
+	mopts := b.Managers[mgr]
+	if hasPrimaryConfig(mopts.ManagerOpts) {
+		result = append(result, filepath.Join(mopts.DestPath, mopts.PrimaryConfigName))
+	}
+	for _, o := range mopts.ManagerOpts {
+		for _, f := range o.GetAdditionalLocalConfigFiles() {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+type ConfigGlobals struct {
+	Managers             []string           `mapstructure:"config-managers" json:"-"`
+	Include              []string           `mapstructure:"include" json:"include,omitempty"`
+	SchedulerInterval    int                `json:"scheduler-interval"`
+	CfgEnableHTTPLog     string             `mapstructure:"enable-http-log" json:"-"`
+	EnableHTTPLog        bool               `json:"enable-http-log"`
+	CfgSchedulerInterval string             `mapstructure:"scheduler-interval" json:"-"`
+	CfgSchedulerCron     string             `mapstructure:"scheduler-cron" json:"-"`
+	SchedulerCron        string             `json:"scheduler-cron,omitempty"`
+	CfgSchedulerSplay    string             `mapstructure:"scheduler-splay" json:"-"`
+	SchedulerSplay       int                `json:"scheduler-splay"`
+	CfgSchedulerStall    string             `mapstructure:"scheduler-stall-timeout" json:"-"`
+	SchedulerStall       int                `json:"scheduler-stall-timeout"`
+	Schedule             scheduler.Schedule `json:"-"`
+	CfgParallelManagers  string             `mapstructure:"parallel-managers" json:"-"`
+	ParallelManagers     int                `json:"parallel-managers"`
+	CfgInstanceMetadata  string             `mapstructure:"instance-metadata" json:"-"`
+	InstanceMetadata     string             `json:"instance-metadata,omitempty"`
+	CfgExitOnFailure     string             `mapstructure:"exit-on-config-failure" json:"-"`
+	ExitOnFailure        bool               `json:"exit-on-failure"`
+	CfgFailurePolicy     string             `mapstructure:"failure-policy" json:"-"`
+	FailurePolicy        string             `json:"failure-policy"`
+	CfgStatusFile        string             `mapstructure:"status-file" json:"-"`
+	StatusFile           string             `json:"status-file"`
+	CfgDownloadCachePath string             `mapstructure:"download-cache-path" json:"-"`
+	DownloadCachePath    string             `json:"download-cache-path"`
+	CfgResponseCacheTTL  string             `mapstructure:"response-cache-ttl" json:"-"`
+	ResponseCacheTTL     int                `json:"response-cache-ttl"`
+	CfgHTTPProto         string             `mapstructure:"http-proto" json:"-"`
+	HTTPProto            string             `json:"http-proto"`
+	CfgHTTPPort          string             `mapstructure:"http-port" json:"-"`
+	HTTPPort             int                `json:"http-port"`
+	CfgHTTPTLSCert       string             `mapstructure:"http-tls-cert" json:"-"`
+	HTTPTLSCert          string             `json:"http-tls-cert"`
+	CfgHTTPTLSKey        string             `mapstructure:"http-tls-key" json:"-"`
+	HTTPTLSKey           string             `json:"http-tls-key"`
+	CfgWebhookSecret     string             `mapstructure:"webhook-secret" json:"-"`
+	WebhookSecret        string             `json:"-"`
+	CfgAuditLog          string             `mapstructure:"audit-log" json:"-"`
+	AuditLog             string             `json:"audit-log"`
+	CfgAuditURL          string             `mapstructure:"audit-url" json:"-"`
+	AuditURL             string             `json:"audit-url"`
+	CfgReportURL         string             `mapstructure:"report-url" json:"-"`
+	ReportURL            string             `json:"report-url,omitempty"`
+	CfgReportInterval    string             `mapstructure:"report-interval" json:"-"`
+	ReportInterval       int                `json:"report-interval,omitempty"`
+	CfgReportAuthType    string             `mapstructure:"report-auth-type" json:"-"`
+	ReportAuthType       string             `json:"report-auth-type,omitempty"`
+	CfgReportAuthUser    string             `mapstructure:"report-auth-user" json:"-"`
+	ReportAuthUser       string             `json:"report-auth-user,omitempty"`
+	CfgReportAuthToken   string             `mapstructure:"report-auth-token" json:"-"`
+	ReportAuthToken      string             `json:"-"`
+	CfgLogFormat         string             `mapstructure:"log-format" json:"-"`
+	LogFormat            string             `json:"log-format,omitempty"`
+	CfgLogLevels         map[string]string  `mapstructure:"log-levels" json:"-"`
+	LogLevels            map[string]string  `json:"log-levels,omitempty"`
+	CfgLogFile           string             `mapstructure:"log-file" json:"-"`
+	LogFile              string             `json:"log-file,omitempty"`
+	CfgLogFileMaxSize    string             `mapstructure:"log-file-max-size" json:"-"`
+	LogFileMaxSize       int                `json:"log-file-max-size,omitempty"`
+	CfgLogFileMaxAge     string             `mapstructure:"log-file-max-age" json:"-"`
+	LogFileMaxAge        int                `json:"log-file-max-age,omitempty"`
+	CfgLogFileMaxBackups string             `mapstructure:"log-file-max-backups" json:"-"`
+	LogFileMaxBackups    int                `json:"log-file-max-backups,omitempty"`
+	CfgLogSyslog         string             `mapstructure:"log-syslog" json:"-"`
+	LogSyslog            string             `json:"log-syslog,omitempty"`
+	Redact               []string           `mapstructure:"redact" json:"-"`
+}
+
+// EventSinks returns the sinks which the events butler emits are sent to.
+func (g *ConfigGlobals) EventSinks() ([]events.Sink, error) {
+	var res []events.Sink
+
+	if g.AuditLog != "" {
+		a, err := events.NewAuditLog(g.AuditLog)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, a)
+	}
+	if g.AuditURL != "" {
+		res = append(res, events.NewHTTPSink(g.AuditURL, events.DefaultHTTPTimeout))
+	}
+	return res, nil
+}
+
+type ValidateOpts struct {
+	ContentType string
+	Data        interface{}
+	FileName    string
+	Manager     string
+	Header      string
+	Footer      string
+	MinSize     int64
+	NotEmpty    bool
+}
+
+func NewValidateOpts() *ValidateOpts {
+	return &ValidateOpts{ContentType: "text", Header: butlerHeader, Footer: butlerFooter}
+}
+
+func (o *ValidateOpts) WithContentType(t string) *ValidateOpts {
+	o.ContentType = t
+	return o
+}
+
+func (o *ValidateOpts) WithData(d interface{}) *ValidateOpts {
+	o.Data = d
+	return o
+}
+
+func (o *ValidateOpts) WithFileName(f string) *ValidateOpts {
+	o.FileName = f
+	return o
+}
+
+func (o *ValidateOpts) WithManager(m string) *ValidateOpts {
+	o.Manager = m
+	return o
+}
+
+// WithMarkers sets the header and footer markers to validate against. Empty
+// markers disable the marker checks.
+func (o *ValidateOpts) WithMarkers(header string, footer string) *ValidateOpts {
+	o.Header = header
+	o.Footer = footer
+	return o
+}
+
+// WithSizeLimits sets the minimum size of the file, without the markers, and
+// whether the file must not be empty, or only whitespace.
+func (o *ValidateOpts) WithSizeLimits(minSize int64, notEmpty bool) *ValidateOpts {
+	o.MinSize = minSize
+	o.NotEmpty = notEmpty
+	return o
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RunStage is the stage of a configuration management run at which it failed.
+type RunStage int
+
+const (
+	// StageDependency is a manager which was skipped because a manager it
+	// depends on failed. It comes before the other stages, so that the
+	// failure of the dependency decides the exit code.
+	StageDependency RunStage = iota + 1
+	// StageDownload is the retrieval of the configuration files.
+	StageDownload
+	// StageValidation is the rendering and validation of the configuration
+	// files.
+	StageValidation
+	// StageReload is the reload of the manager.
+	StageReload
+)
+
+func (s RunStage) String() string {
+	switch s {
+	case StageDependency:
+		return "dependency"
+	case StageDownload:
+		return "download"
+	case StageValidation:
+		return "validation"
+	case StageReload:
+		return "reload"
+	}
+	return fmt.Sprintf("stage %d", int(s))
+}
+
+// RunError is the failure of a manager at a stage of a configuration
+// management run. Manager is empty for the butler configuration itself.
+type RunError struct {
+	Manager string
+	Stage   RunStage
+	Err     error
+}
+
+func (e *RunError) Error() string {
+	return e.Err.Error()
+}
+
+// RunErrors are the failures of the managers of a configuration management
+// run.
+type RunErrors []*RunError
+
+func (e RunErrors) Error() string {
+	var res []string
+	for _, err := range e {
+		res = append(res, fmt.Sprintf("%v failed for manager %v: %v", err.Stage, err.Manager, err.Err))
+	}
+	return strings.Join(res, "; ")
+}
+
+// For returns the failures of the manager, or nil when it did not fail.
+func (e RunErrors) For(manager string) error {
+	var res RunErrors
+	for _, err := range e {
+		if err.Manager == manager {
+			res = append(res, err)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// Stage returns the latest stage at which any of the managers failed.
+func (e RunErrors) Stage() RunStage {
+	var res RunStage
+	for _, err := range e {
+		if err.Stage > res {
+			res = err.Stage
+		}
+	}
+	return res
+}
+
+// RunOnce retrieves the butler configuration and runs the configuration
+// management of every manager once. Reloads are not deferred by the
+// reload-debounce or reload-min-interval of the managers. It returns a
+// *RunError when the butler configuration could not be retrieved, and
+// RunErrors when any of the managers failed.
+func (bc *ButlerConfig) RunOnce() error {
+	if err := bc.Handler(); err != nil {
+		return err
+	}
+	failed := bc.runCMHandler(context.Background(), nil)
+	failed = append(failed, bc.runPendingReloads()...)
+	if len(failed) > 0 {
+		return RunErrors(failed)
+	}
+	return nil
+}
+
+// Fetch retrieves the butler configuration, and the configuration files of
+// every manager, and copies them into place like RunOnce, but without
+// reloading the managers. The managers whose files changed are reloaded by
+// the next run of butler. It returns errors like RunOnce.
+func (bc *ButlerConfig) Fetch() error {
+	bc.skipReload = true
+	defer func() { bc.skipReload = false }()
+
+	if err := bc.Handler(); err != nil {
+		return err
+	}
+	if failed := bc.runCMHandler(context.Background(), nil); len(failed) > 0 {
+		return RunErrors(failed)
+	}
+	return nil
+}
+
+// runPendingReloads runs the deferred reloads right away, except for those of
+// the managers in a blackout window, or whose dependencies have not reloaded.
+func (bc *ButlerConfig) runPendingReloads() []*RunError {
+	var (
+		failed []*RunError
+	)
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+
+	// the dependencies are reloaded before the managers which depend on them
+	for _, mgr := range runOrder(bc.GetManagers()) {
+		name := mgr.Name
+		p, ok := pendingReloads[name]
+		if !ok {
+			continue
+		}
+		if end, blocked := mgr.BlackoutEnd(time.Now()); blocked {
+			log.Infof("Config::runPendingReloads()[manager=%v]: in a blackout window until %v, not reloading.", name, end.Format(time.RFC3339))
+			continue
+		}
+		if dep := blockingDependency(mgr, failed, nil, true); dep != "" {
+			log.Warnf("Config::runPendingReloads()[manager=%v]: dependency %v has not reloaded, not reloading.", name, dep)
+			if RunErrors(failed).For(dep) != nil {
+				failed = append(failed, &RunError{Manager: name, Stage: StageDependency, Err: fmt.Errorf("dependency %v failed", dep)})
+			}
+			continue
+		}
+		p.timer.Stop()
+		delete(pendingReloads, name)
+		mgr.ChangedFiles = p.files
+		if err := bc.reloadManager(mgr); err != nil {
+			failed = append(failed, &RunError{Manager: name, Stage: StageReload, Err: err})
+		}
+	}
+	return failed
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestRunErrors(c *C) {
+	errs := RunErrors{
+		{Manager: "a", Stage: StageDownload, Err: errors.New("no route to host")},
+		{Manager: "b", Stage: StageValidation, Err: errors.New("bad yaml")},
+	}
+	c.Assert(errs.Stage(), Equals, StageValidation)
+	c.Assert(errs.Error(), Equals, "download failed for manager a: no route to host; validation failed for manager b: bad yaml")
+	c.Assert(RunErrors{}.Stage(), Equals, RunStage(0))
+}
+
+func (s *ConfigTestSuite) TestRunOnceNotFound(c *C) {
+	TestHTTPCase = 1
+	defer func() { TestHTTPCase = 0 }()
+	u, err := url.Parse(s.TestServer.URL)
+	c.Assert(err, IsNil)
+	bc, err := NewButlerConfig(&ButlerConfigOpts{LogLevel: log.DebugLevel, URL: u})
+	c.Assert(err, IsNil)
+	bc.SetMethodOpts(methods.HTTPMethodOpts{Scheme: u.Scheme})
+	c.Assert(bc.Init(), IsNil)
+
+	err = bc.RunOnce()
+	c.Assert(err, FitsTypeOf, &RunError{})
+	c.Assert(err.(*RunError).Stage, Equals, StageDownload)
+	c.Assert(err.Error(), Matches, "Did not receive 200.*404")
+}
+
+func (s *ConfigTestSuite) TestRunPendingReloads(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bonce")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var reloads [][]string
+	mgr := &Manager{Name: "once-manager", ReloadDebounce: 60, Reloader: countingReloader{reloads: &reloads}}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{mgr.Name: mgr}}}
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+
+	// the debounced reload runs right away instead of in a minute
+	cmHandlerLock.Lock()
+	mgr.ChangedFiles = []string{"/a.yml"}
+	c.Assert(bc.scheduleReload(mgr), IsNil)
+	c.Assert(len(reloads), Equals, 0)
+	cmHandlerLock.Unlock()
+
+	c.Assert(bc.runPendingReloads(), HasLen, 0)
+	c.Assert(reloads, DeepEquals, [][]string{{"/a.yml"}})
+	_, pending := pendingReloads[mgr.Name]
+	c.Assert(pending, Equals, false)
+	c.Assert(GetManagerStatus(bc.GetStatusFile(), mgr.Name), Equals, true)
+	delete(lastReloads, mgr.Name)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+)
+
+// readDefaults reads the local defaults which the butler configuration
+// overlays. There are none when the path is empty.
+func readDefaults(path string) (*configFragment, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read defaults %v. err=%v", path, err.Error())
+	}
+	return &configFragment{Name: path, Data: data}, nil
+}
+
+// overlayConfig overlays the butler configuration on the defaults, and
+// returns the result along with its format. The tables, or maps, are merged
+// key by key, any other value of the butler configuration replaces that of
+// the defaults, which is how lists such as globals.config-managers are
+// replaced rather than appended to. The butler header and footer are
+// optional in the defaults. Without defaults the configuration is returned
+// as it is.
+func overlayConfig(defaults *configFragment, config []byte, format string) ([]byte, string, error) {
+	if defaults == nil {
+		return config, format, nil
+	}
+	base, err := configSettings(defaults.Data, ConfigFormat(defaults.Name, defaults.Data))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not parse defaults %v. err=%v", defaults.Name, err.Error())
+	}
+	overlay, err := configSettings(config, format)
+	if err != nil {
+		return nil, "", err
+	}
+	mergeSettings(base, overlay)
+
+	// The formats of the defaults and of the butler configuration may
+	// differ, so the result is handed on as json.
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "json", nil
+}
+
+func configSettings(config []byte, format string) (map[string]interface{}, error) {
+	if !isValidConfigFormat(format) {
+		return nil, fmt.Errorf("unknown butler configuration format %v", format)
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewBuffer(stripConfigHeaderFooter(config))); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+// mergeSettings merges src into dst, see overlayConfig.
+func mergeSettings(dst, src map[string]interface{}) {
+	for k, sv := range src {
+		sm, ok := sv.(map[string]interface{})
+		if dm, isMap := dst[k].(map[string]interface{}); ok && isMap {
+			mergeSettings(dm, sm)
+			continue
+		}
+		dst[k] = sv
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestOverlayConfig(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "boverlay")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	defaultsPath := dir + "/defaults.yaml"
+	c.Assert(ioutil.WriteFile(defaultsPath, TestConfigCompleteEnvironmentYAML, 0644), IsNil)
+
+	// the butler configuration only carries what differs from the defaults
+	config := wrapConfig(`[globals]
+  scheduler-interval = 60
+[test-handler]
+  dest-path = "/opt/other"
+  [test-handler.localhost]
+    primary-config = ["other.yml"]
+`)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, "", false), NotNil)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, defaultsPath, false), IsNil)
+
+	defaults, err := readDefaults(defaultsPath)
+	c.Assert(err, IsNil)
+	merged, format, err := overlayConfig(defaults, config, "toml")
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, "json")
+	settings := NewConfigSettings()
+	c.Assert(settings.parseConfig(merged, format, nil, nil), IsNil)
+	c.Assert(settings.Globals.SchedulerInterval, Equals, 60)
+	c.Assert(settings.Globals.StatusFile, Equals, "/var/tmp/butler.status")
+	c.Assert(managerNames(settings), DeepEquals, []string{"test-handler"})
+	m := settings.Managers["test-handler"]
+	c.Assert(m.DestPath, Equals, "/opt/other")
+	c.Assert(m.PrimaryConfigName, Equals, "prometheus.yml")
+	opts := m.ManagerOpts["test-handler.localhost"]
+	c.Assert(opts, NotNil)
+	c.Assert(opts.PrimaryConfig, DeepEquals, []string{"other.yml"})
+	c.Assert(opts.AdditionalConfig, DeepEquals, []string{"test-add.yml"})
+
+	// lists replace those of the defaults
+	merged, _, err = overlayConfig(defaults, wrapConfig("[globals]\n  config-managers = []\n"), "toml")
+	c.Assert(err, IsNil)
+	c.Assert(settings.parseConfig(merged, "json", nil, nil), ErrorMatches, "(?s).*config-managers.*")
+
+	// without defaults, the butler configuration is left alone
+	same, format, err := overlayConfig(nil, config, "toml")
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, "toml")
+	c.Assert(same, DeepEquals, config)
+
+	c.Assert(CheckConfig(dir+"/butler.toml", config, dir+"/missing.yaml", false), ErrorMatches, "could not read defaults .*")
+	c.Assert(ioutil.WriteFile(defaultsPath, []byte("globals: ["), 0644), IsNil)
+	c.Assert(CheckConfig(dir+"/butler.toml", config, defaultsPath, false), ErrorMatches, "could not parse defaults .*")
+}
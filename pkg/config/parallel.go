@@ -0,0 +1,135 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adobe/butler/internal/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// managerRun is the outcome of the processing of a manager in a run.
+type managerRun struct {
+	manager *Manager
+	// ran is whether the run of the manager counts, ie: is recorded
+	ran bool
+	// reload is whether the files of the manager changed, so that it is to
+	// be reloaded
+	reload bool
+	failed []*RunError
+	// stop is whether no further managers are to be processed
+	stop bool
+	span *tracing.Span
+}
+
+// runManagers processes the managers in only, or every manager when only is
+// nil, in the order they are given in, up to parallel-managers at a time.
+// A manager starts once the managers it depends on are done, and once the
+// canary managers are done when it is not one of them, so that fn sees their
+// outcome. fn is given the failures, and the managers which ran, so far.
+// Once ctx is cancelled, or a manager stops the run, no further managers are
+// started. It returns the outcome of the managers which were started, in the
+// order they are given in.
+func (bc *ButlerConfig) runManagers(ctx context.Context, managers []*Manager, only map[string]bool, fn func(m *Manager, failed RunErrors, ran []string) *managerRun) []*managerRun {
+	var (
+		mutex   sync.Mutex
+		cond    = sync.NewCond(&mutex)
+		queue   []*Manager
+		started = make(map[string]bool)
+		done    = make(map[string]bool)
+		results = make(map[string]*managerRun)
+		failed  RunErrors
+		ran     []string
+		running int
+		stop    bool
+	)
+	parallel := bc.Config.Globals.ParallelManagers
+	if parallel < 1 {
+		parallel = 1
+	}
+	for _, m := range managers {
+		if only == nil || only[m.Name] {
+			queue = append(queue, m)
+		}
+	}
+	// ready returns whether the i-th manager waits for no other manager of
+	// the run. A manager only waits for the managers before it, which the
+	// run order puts there, and not for those which are not part of the run.
+	ready := func(i int) bool {
+		m := queue[i]
+		for _, o := range queue[:i] {
+			if !done[o.Name] && (containsString(m.DependsOn, o.Name) || o.Canary && !m.Canary) {
+				return false
+			}
+		}
+		return true
+	}
+
+	mutex.Lock()
+	for len(started) < len(queue) {
+		var next *Manager
+		for !stop && ctx.Err() == nil {
+			if running < parallel {
+				for i, m := range queue {
+					if !started[m.Name] && ready(i) {
+						next = m
+						break
+					}
+				}
+			}
+			if next != nil {
+				break
+			}
+			cond.Wait()
+		}
+		if next == nil {
+			if ctx.Err() != nil {
+				log.Warnf("Config::RunCMHandler()[count=%v]: cancelled, not processing the remaining managers.", cmHandlerCounter)
+			}
+			break
+		}
+		started[next.Name] = true
+		running++
+		next.ChangedFiles = nil
+		bc.restoreState(next)
+		go func(m *Manager, failedSoFar RunErrors, ranSoFar []string) {
+			r := fn(m, failedSoFar, ranSoFar)
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[m.Name] = r
+			done[m.Name] = true
+			running--
+			failed = append(failed, r.failed...)
+			if r.ran {
+				ran = append(ran, m.Name)
+			}
+			stop = stop || r.stop
+			cond.Broadcast()
+		}(next, append(RunErrors{}, failed...), append([]string{}, ran...))
+	}
+	for running > 0 {
+		cond.Wait()
+	}
+	mutex.Unlock()
+
+	var res []*managerRun
+	for _, m := range queue {
+		if r, ok := results[m.Name]; ok {
+			res = append(res, r)
+		}
+	}
+	return res
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestRunManagers(c *C) {
+	rules := &Manager{Name: "parallel-rules"}
+	alertmanager := &Manager{Name: "parallel-alertmanager", DependsOn: []string{"parallel-rules"}}
+	canary := &Manager{Name: "parallel-canary", Canary: true}
+	a := &Manager{Name: "parallel-a"}
+	b := &Manager{Name: "parallel-b"}
+	managers := map[string]*Manager{rules.Name: rules, alertmanager.Name: alertmanager, canary.Name: canary, a.Name: a, b.Name: b}
+	bc := &ButlerConfig{Config: &ConfigSettings{
+		Managers: managers,
+		Globals:  ConfigGlobals{StatusFile: c.MkDir() + "/butler.status", ParallelManagers: 2},
+	}}
+
+	var (
+		mutex    sync.Mutex
+		running  int
+		most     int
+		finished = make(map[string]time.Time)
+		started  = make(map[string]time.Time)
+	)
+	fn := func(m *Manager, failed RunErrors, ran []string) *managerRun {
+		mutex.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		started[m.Name] = time.Now()
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		running--
+		finished[m.Name] = time.Now()
+		mutex.Unlock()
+		return &managerRun{manager: m, ran: true}
+	}
+
+	res := bc.runManagers(context.Background(), runOrder(managers), nil, fn)
+	c.Assert(res, HasLen, 5)
+	c.Assert(most, Equals, 2)
+	// the canary goes first, and the dependencies before their dependents
+	for _, m := range []*Manager{rules, alertmanager, a, b} {
+		c.Assert(started[m.Name].Before(finished[canary.Name]), Equals, false)
+	}
+	c.Assert(started[alertmanager.Name].Before(finished[rules.Name]), Equals, false)
+
+	// the managers are run one at a time by default
+	most = 0
+	bc.Config.Globals.ParallelManagers = 0
+	res = bc.runManagers(context.Background(), runOrder(managers), map[string]bool{a.Name: true, b.Name: true}, fn)
+	c.Assert(res, HasLen, 2)
+	c.Assert(most, Equals, 1)
+
+	// a manager which stops the run keeps the others from starting
+	res = bc.runManagers(context.Background(), runOrder(managers), nil, func(m *Manager, failed RunErrors, ran []string) *managerRun {
+		return &managerRun{manager: m, stop: true}
+	})
+	c.Assert(res, HasLen, 1)
+	c.Assert(res[0].manager, Equals, canary)
+}
@@ -0,0 +1,28 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+)
+
+// fileOwnership is whether the files may be given an owner and a group. The
+// files on windows are owned by SIDs, and their access is set with ACLs,
+// which butler leaves to the parent directory to inherit.
+const fileOwnership = false
+
+// fileOwner returns the uid and gid of the file, which windows files have
+// none of.
+func fileOwner(fi os.FileInfo) (int, int, bool) {
+	return -1, -1, false
+}
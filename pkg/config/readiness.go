@@ -0,0 +1,75 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readiness records when butler first retrieved and parsed the butler
+// configuration, and when it first attempted to run the configuration
+// management of its managers.
+type readiness struct {
+	sync.Mutex
+	loaded    time.Time
+	attempted time.Time
+}
+
+func (r *readiness) set(t *time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	if t.IsZero() {
+		*t = time.Now()
+	}
+}
+
+// Alive returns an error when butler no longer runs on schedule, eg: while
+// it shuts down, or when its scheduler is wedged, with runs overdue by more
+// than the globals.scheduler-stall-timeout. Butler is alive while it starts
+// up, before it has a scheduler.
+func (bc *ButlerConfig) Alive() error {
+	if bc.Scheduler == nil {
+		return nil
+	}
+	if !bc.Scheduler.Running() {
+		return errors.New("the scheduler is not running")
+	}
+	if bc.Config != nil && bc.Config.Globals.SchedulerStall > 0 {
+		if jobs := bc.Scheduler.Overdue(time.Duration(bc.Config.Globals.SchedulerStall) * time.Second); len(jobs) > 0 {
+			return fmt.Errorf("the scheduler is wedged, the runs of %v are overdue", strings.Join(jobs, ", "))
+		}
+	}
+	return nil
+}
+
+// Ready returns an error until butler has retrieved and parsed the butler
+// configuration, and has attempted to run the configuration management of
+// its managers, whether or not the run succeeded. It also returns the error
+// of Alive.
+func (bc *ButlerConfig) Ready() error {
+	bc.readiness.Lock()
+	loaded, attempted := bc.readiness.loaded, bc.readiness.attempted
+	bc.readiness.Unlock()
+
+	switch {
+	case loaded.IsZero():
+		return errors.New("the butler configuration has not been retrieved yet")
+	case attempted.IsZero():
+		return errors.New("the configuration management has not run yet")
+	}
+	return bc.Alive()
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/adobe/butler/internal/scheduler"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestReadiness(c *C) {
+	bc := &ButlerConfig{}
+	c.Assert(bc.Alive(), IsNil)
+	c.Assert(bc.Ready(), ErrorMatches, "the butler configuration has not been retrieved yet")
+
+	bc.readiness.set(&bc.readiness.loaded)
+	c.Assert(bc.Ready(), ErrorMatches, "the configuration management has not run yet")
+
+	bc.readiness.set(&bc.readiness.attempted)
+	attempted := bc.readiness.attempted
+	c.Assert(bc.Ready(), IsNil)
+	// the first attempt sticks
+	bc.readiness.set(&bc.readiness.attempted)
+	c.Assert(bc.readiness.attempted, Equals, attempted)
+
+	sched := scheduler.NewScheduler()
+	bc.SetScheduler(sched)
+	c.Assert(bc.Alive(), ErrorMatches, "the scheduler is not running")
+	c.Assert(bc.Ready(), ErrorMatches, "the scheduler is not running")
+	sched.Start()
+	c.Assert(bc.Alive(), IsNil)
+	c.Assert(bc.Ready(), IsNil)
+	sched.Stop()
+	c.Assert(bc.Alive(), ErrorMatches, "the scheduler is not running")
+}
+
+func (s *ConfigTestSuite) TestAliveWedged(c *C) {
+	release := make(chan bool)
+	sched := scheduler.NewScheduler()
+	sched.Add(CMHandlerJob, scheduler.Every(10*time.Millisecond), func(ctx context.Context) {
+		<-release
+	})
+	bc := &ButlerConfig{Config: &ConfigSettings{Globals: ConfigGlobals{SchedulerStall: 1}}}
+	bc.SetScheduler(sched)
+	sched.Start()
+	defer sched.Stop()
+	c.Assert(bc.Alive(), IsNil)
+
+	time.Sleep(1100 * time.Millisecond)
+	c.Assert(bc.Alive(), ErrorMatches, "the scheduler is wedged, the runs of cm-handler are overdue")
+	// a stall-timeout of 0 disables the check
+	bc.Config.Globals.SchedulerStall = 0
+	c.Assert(bc.Alive(), IsNil)
+	close(release)
+}
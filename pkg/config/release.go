@@ -0,0 +1,285 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultReleaseRetention is the number of releases that are kept per
+	// manager when manager.release-retention is not set.
+	DefaultReleaseRetention = 5
+)
+
+// releaseTimeFormat names the releases after the time they were made, so
+// that they sort from the oldest to the newest.
+const releaseTimeFormat = "20060102T150405Z"
+
+// initReleases checks the release options of the manager. The releases are
+// kept next to the release-link by default, and neither of them may be
+// within the dest-path, whose files butler cleans.
+func (bm *Manager) initReleases() error {
+	var err error
+
+	bm.ReleaseLink = strings.TrimSpace(environment.GetVar(bm.ReleaseLink))
+	bm.ReleasePath = strings.TrimSpace(environment.GetVar(bm.ReleasePath))
+	bm.ReleaseRetention = DefaultReleaseRetention
+	if r := strings.TrimSpace(environment.GetVar(bm.CfgReleaseRetention)); r != "" {
+		bm.ReleaseRetention, err = strconv.Atoi(r)
+		if err != nil || bm.ReleaseRetention < 1 {
+			return fmt.Errorf("Invalid release-retention=%v", r)
+		}
+	}
+	if bm.ReleaseLink == "" {
+		if bm.ReleasePath != "" {
+			return errors.New("release-path is set without a release-link")
+		}
+		return nil
+	}
+
+	bm.ReleaseLink = filepath.Clean(bm.ReleaseLink)
+	if bm.ReleasePath == "" {
+		bm.ReleasePath = filepath.Join(filepath.Dir(bm.ReleaseLink), "releases")
+	}
+	bm.ReleasePath = filepath.Clean(bm.ReleasePath)
+	for _, p := range []string{bm.ReleaseLink, bm.ReleasePath} {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("Invalid release path %v, must be absolute", p)
+		}
+		if rel, err := filepath.Rel(bm.DestPath, p); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("Invalid release path %v, must not be within the dest-path", p)
+		}
+	}
+	return nil
+}
+
+// Release makes the files of the manager, as they are in its dest-path, the
+// live release, when the manager has a release-link. The releases are the
+// directories of the release-path, and the live one is the one the link
+// points to. A retained release which has the same files is linked again,
+// eg: once they are restored, otherwise the files are written to a new
+// release, and the link is flipped to it. The releases beyond the retention
+// are then removed, but for the live one.
+func (bm *Manager) Release() error {
+	if bm.ReleaseLink == "" {
+		return nil
+	}
+	files, err := bm.destFiles()
+	if err != nil {
+		return err
+	}
+	releases, err := bm.Releases()
+	if err != nil {
+		return err
+	}
+	live := bm.LiveRelease()
+
+	for i := len(releases) - 1; i >= 0; i-- {
+		if !bm.isRelease(releases[i], files) {
+			continue
+		}
+		if releases[i] == live {
+			return nil
+		}
+		log.Warnf("Manager::Release()[count=%v][manager=%v]: linking %v to release %v again.", cmHandlerCounter, bm.Name, bm.ReleaseLink, releases[i])
+		return bm.linkRelease(releases[i])
+	}
+
+	name, err := bm.writeRelease(files)
+	if err != nil {
+		return err
+	}
+	if err = bm.linkRelease(name); err != nil {
+		os.RemoveAll(filepath.Join(bm.ReleasePath, name))
+		return err
+	}
+	log.Infof("Manager::Release()[count=%v][manager=%v]: linked %v to new release %v.", cmHandlerCounter, bm.Name, bm.ReleaseLink, name)
+	bm.pruneReleases(append(releases, name), name)
+	return nil
+}
+
+// Releases returns the names of the releases of the manager, from the oldest
+// to the newest.
+func (bm *Manager) Releases() ([]string, error) {
+	entries, err := ioutil.ReadDir(bm.ReleasePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		// the releases which are still being written are hidden
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			res = append(res, e.Name())
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// LiveRelease returns the name of the release the release-link points to, or
+// an empty string when it points to none.
+func (bm *Manager) LiveRelease() string {
+	target, err := os.Readlink(bm.ReleaseLink)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(bm.ReleaseLink), target)
+	}
+	if filepath.Dir(filepath.Clean(target)) != bm.ReleasePath {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// isRelease returns whether the release holds exactly the files.
+func (bm *Manager) isRelease(name string, files map[string][]byte) bool {
+	root := filepath.Join(bm.ReleasePath, name)
+	found := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		data, ok := files[filepath.ToSlash(rel)]
+		if !ok {
+			return fmt.Errorf("%v is not a file of the manager", rel)
+		}
+		cur, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(cur, data) {
+			return fmt.Errorf("%v has changed", rel)
+		}
+		found++
+		return nil
+	})
+	return err == nil && found == len(files)
+}
+
+// writeRelease writes the files to a new release, with the permissions of the
+// files in the dest-path, and returns its name. The release is written to a
+// hidden directory, which is renamed once all the files are there.
+func (bm *Manager) writeRelease(files map[string][]byte) (string, error) {
+	if err := os.MkdirAll(bm.ReleasePath, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC().Format(releaseTimeFormat)
+	tmp, err := ioutil.TempDir(bm.ReleasePath, fmt.Sprintf(".%s.butler-", now))
+	if err != nil {
+		return "", err
+	}
+	if err = os.Chmod(tmp, 0755); err == nil {
+		err = bm.writeReleaseFiles(tmp, files)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	name := now
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(bm.ReleasePath, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s.%d", now, i)
+	}
+	if err = os.Rename(tmp, filepath.Join(bm.ReleasePath, name)); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if bm.SyncDir {
+		if err = syncDir(bm.ReleasePath); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+func (bm *Manager) writeReleaseFiles(dir string, files map[string][]byte) error {
+	for rel, data := range files {
+		perms := FilePerms{Mode: 0644}
+		if fi, err := os.Stat(filepath.Join(bm.DestPath, rel)); err == nil {
+			perms.Mode = fi.Mode().Perm()
+			if uid, gid, ok := fileOwner(fi); ok && os.Geteuid() == 0 {
+				perms = perms.Merge(FilePerms{Owner: fmt.Sprintf("%d", uid), Uid: uid, Group: fmt.Sprintf("%d", gid), Gid: gid})
+			}
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := InstallFile(bytes.NewReader(data), dst, InstallOpts{Fsync: bm.Fsync, Perms: perms, Xattrs: bm.Xattrs, Restorecon: bm.Restorecon}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkRelease atomically points the release-link to the release, by renaming
+// a new link over it.
+func (bm *Manager) linkRelease(name string) error {
+	dir := filepath.Dir(bm.ReleaseLink)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, fmt.Sprintf(".%s.butler-%d", filepath.Base(bm.ReleaseLink), time.Now().UnixNano()))
+	if err := os.Symlink(filepath.Join(bm.ReleasePath, name), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, bm.ReleaseLink); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not link %v to release %v. err=%v", bm.ReleaseLink, name, err.Error())
+	}
+	if bm.SyncDir {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// pruneReleases removes the oldest releases beyond the retention, but for the
+// live one, and the releases which were left half written.
+func (bm *Manager) pruneReleases(releases []string, live string) {
+	if stale, err := filepath.Glob(filepath.Join(bm.ReleasePath, ".*.butler-*")); err == nil {
+		for _, s := range stale {
+			os.RemoveAll(s)
+		}
+	}
+	for i := 0; i < len(releases)-bm.ReleaseRetention; i++ {
+		if releases[i] == live {
+			continue
+		}
+		log.Debugf("Manager::pruneReleases()[count=%v][manager=%v]: removing release %v", cmHandlerCounter, bm.Name, releases[i])
+		if err := os.RemoveAll(filepath.Join(bm.ReleasePath, releases[i])); err != nil {
+			log.Warnf("Manager::pruneReleases()[count=%v][manager=%v]: could not remove release %v. err=%v", cmHandlerCounter, bm.Name, releases[i], err.Error())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestInitReleases(c *C) {
+	mgr := &Manager{DestPath: "/etc/nginx/butler"}
+	c.Assert(mgr.initReleases(), IsNil)
+	c.Assert(mgr.ReleaseRetention, Equals, DefaultReleaseRetention)
+
+	mgr = &Manager{DestPath: "/etc/nginx/butler", ReleaseLink: "/etc/nginx/current"}
+	c.Assert(mgr.initReleases(), IsNil)
+	c.Assert(mgr.ReleasePath, Equals, "/etc/nginx/releases")
+
+	for _, m := range []*Manager{
+		{DestPath: "/etc/nginx/butler", ReleasePath: "/etc/nginx/releases"},
+		{DestPath: "/etc/nginx/butler", ReleaseLink: "current"},
+		{DestPath: "/etc/nginx/butler", ReleaseLink: "/etc/nginx/butler/current"},
+		{DestPath: "/etc/nginx/butler", ReleaseLink: "/etc/nginx/current", ReleasePath: "/etc/nginx/butler/releases"},
+		{DestPath: "/etc/nginx/butler", ReleaseLink: "/etc/nginx/current", CfgReleaseRetention: "0"},
+	} {
+		c.Assert(m.initReleases(), NotNil, Commentf("manager %#v", m))
+	}
+}
+
+func (s *ConfigTestSuite) TestRelease(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "brelease")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/butler/conf.d", 0755), IsNil)
+
+	opts := &ManagerOpts{AdditionalConfigsFullLocalPaths: []string{dir + "/butler/conf.d/default.conf"}}
+	mgr := &Manager{Name: "nginx", DestPath: dir + "/butler", PrimaryConfigName: "nginx.conf", ReleaseLink: dir + "/current", CfgReleaseRetention: "2",
+		ManagerOpts: map[string]*ManagerOpts{"nginx.repo": opts}}
+	c.Assert(mgr.initReleases(), IsNil)
+
+	// no release-link, no releases
+	c.Assert((&Manager{}).Release(), IsNil)
+
+	write := func(data string) {
+		c.Assert(ioutil.WriteFile(dir+"/butler/nginx.conf", []byte(data), 0640), IsNil)
+		c.Assert(ioutil.WriteFile(dir+"/butler/conf.d/default.conf", []byte("server {}\n"), 0644), IsNil)
+	}
+	write("events {}\n")
+	c.Assert(mgr.Release(), IsNil)
+	releases, err := mgr.Releases()
+	c.Assert(err, IsNil)
+	c.Assert(releases, HasLen, 1)
+	c.Assert(mgr.LiveRelease(), Equals, releases[0])
+	out, err := ioutil.ReadFile(dir + "/current/conf.d/default.conf")
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "server {}\n")
+	fi, err := os.Stat(dir + "/current/nginx.conf")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0640))
+
+	// the same files make no new release
+	c.Assert(mgr.Release(), IsNil)
+	releases, _ = mgr.Releases()
+	c.Assert(releases, HasLen, 1)
+
+	write("events { worker_connections 512; }\n")
+	c.Assert(mgr.Release(), IsNil)
+	releases, _ = mgr.Releases()
+	c.Assert(releases, HasLen, 2)
+	c.Assert(mgr.LiveRelease(), Equals, releases[1])
+	out, _ = ioutil.ReadFile(dir + "/current/nginx.conf")
+	c.Assert(string(out), Equals, "events { worker_connections 512; }\n")
+
+	// restored files link the release which has them again
+	write("events {}\n")
+	c.Assert(mgr.Release(), IsNil)
+	c.Assert(mgr.LiveRelease(), Equals, releases[0])
+	out, _ = ioutil.ReadFile(dir + "/current/nginx.conf")
+	c.Assert(string(out), Equals, "events {}\n")
+
+	// the oldest releases beyond the retention are removed, but the live one
+	c.Assert(ioutil.WriteFile(dir+"/butler/nginx.conf", []byte("events { worker_connections 1024; }\n"), 0640), IsNil)
+	c.Assert(mgr.Release(), IsNil)
+	releases, _ = mgr.Releases()
+	c.Assert(releases, HasLen, 2)
+	c.Assert(mgr.LiveRelease(), Equals, releases[1])
+	link, err := os.Readlink(dir + "/current")
+	c.Assert(err, IsNil)
+	c.Assert(link, Equals, filepath.Join(dir, "releases", releases[1]))
+
+	// a link which is not a symlink is not replaced
+	c.Assert(os.Remove(dir+"/current"), IsNil)
+	c.Assert(os.MkdirAll(dir+"/current/x", 0755), IsNil)
+	c.Assert(mgr.Release(), NotNil)
+}
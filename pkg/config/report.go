@@ -0,0 +1,187 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/metrics"
+
+	"github.com/hashicorp/go-retryablehttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// The options of the requests which send the reports to the
+// globals.report-url.
+var (
+	ReportTimeout      = 10 * time.Second
+	ReportRetries      = 3
+	ReportRetryWaitMin = 1 * time.Second
+	ReportRetryWaitMax = 10 * time.Second
+)
+
+// Report is the state of the managers of this host which butler POSTs, as
+// JSON, to the globals.report-url, so that a fleet dashboard can tell which
+// hosts have converged on which version of the configuration.
+type Report struct {
+	Host          string                    `json:"host"`
+	Time          time.Time                 `json:"time"`
+	ConfigURL     string                    `json:"config-url"`
+	ConfigVersion string                    `json:"config-version"`
+	Bootstrapped  bool                      `json:"bootstrapped,omitempty"`
+	Managers      map[string]*ManagerReport `json:"managers"`
+}
+
+// ManagerReport is the state of a manager in a Report. ConfigVersion is the
+// content address of the installed files of the manager, and Files their
+// sha256 sums.
+type ManagerReport struct {
+	Status              string            `json:"status,omitempty"`
+	ConfigVersion       string            `json:"config-version"`
+	Files               map[string]string `json:"files"`
+	LastRun             time.Time         `json:"last-run"`
+	LastSuccess         time.Time         `json:"last-success"`
+	LastError           string            `json:"last-error,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive-failures"`
+	Paused              bool              `json:"paused,omitempty"`
+	BreakerOpen         bool              `json:"breaker-open,omitempty"`
+}
+
+// parseReportOpts parses the globals.report-* options, once the
+// globals.report-url is known to be set. The errors leave the url and the
+// token out, since they are secrets.
+func parseReportOpts(g *ConfigGlobals) error {
+	u, err := url.Parse(g.ReportURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("invalid globals.report-url, it must be a http or https url")
+	}
+
+	g.ReportInterval = DefaultReportInterval
+	if strings.TrimSpace(g.CfgReportInterval) != "" {
+		g.ReportInterval, err = parseNonNegativeInt(g.CfgReportInterval)
+		if err != nil || g.ReportInterval == 0 {
+			return fmt.Errorf("invalid globals.report-interval %v", g.CfgReportInterval)
+		}
+	}
+
+	g.ReportAuthType = strings.ToLower(strings.TrimSpace(environment.GetVar(g.CfgReportAuthType)))
+	g.ReportAuthUser = environment.GetVar(g.CfgReportAuthUser)
+	g.ReportAuthToken = environment.GetVar(g.CfgReportAuthToken)
+	switch g.ReportAuthType {
+	case "":
+	case "bearer":
+		if g.ReportAuthToken == "" {
+			return fmt.Errorf("globals.report-auth-type %v requires globals.report-auth-token", g.ReportAuthType)
+		}
+	case "basic", "token-key":
+		if g.ReportAuthUser == "" || g.ReportAuthToken == "" {
+			return fmt.Errorf("globals.report-auth-type %v requires globals.report-auth-user and globals.report-auth-token", g.ReportAuthType)
+		}
+	default:
+		return fmt.Errorf("invalid globals.report-auth-type %v, it must be basic, bearer or token-key", g.ReportAuthType)
+	}
+	return nil
+}
+
+// Report returns the state of the managers of this host.
+func (bc *ButlerConfig) Report() *Report {
+	status := bc.Status()
+	res := &Report{
+		Time:          time.Now(),
+		ConfigURL:     status.ConfigURL,
+		ConfigVersion: status.ConfigVersion,
+		Bootstrapped:  status.Bootstrapped,
+		Managers:      make(map[string]*ManagerReport),
+	}
+	res.Host, _ = os.Hostname()
+	for name, m := range status.Managers {
+		res.Managers[name] = &ManagerReport{
+			Status:              m.Status,
+			ConfigVersion:       m.ConfigVersion,
+			Files:               m.Files,
+			LastRun:             m.LastRun,
+			LastSuccess:         m.LastSuccess,
+			LastError:           m.LastError,
+			ConsecutiveFailures: m.ConsecutiveFailures,
+			Paused:              m.Paused != nil,
+			BreakerOpen:         m.BreakerOpenUntil != nil && res.Time.Before(*m.BreakerOpenUntil),
+		}
+	}
+	return res
+}
+
+// sendReport POSTs the Report of this host to the globals.report-url of g,
+// retrying with backoff.
+func (bc *ButlerConfig) sendReport(ctx context.Context, g ConfigGlobals) error {
+	data, err := json.Marshal(bc.Report())
+	if err != nil {
+		return err
+	}
+
+	req, err := retryablehttp.NewRequest("POST", g.ReportURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.New("invalid globals.report-url")
+	}
+	req.Request = req.Request.WithContext(ctx)
+	host := req.URL.Host
+	req.Header.Set("Content-Type", "application/json")
+	switch g.ReportAuthType {
+	case "basic":
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(g.ReportAuthUser+":"+g.ReportAuthToken)))
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+g.ReportAuthToken)
+	case "token-key":
+		req.Header.Set("Authorization", fmt.Sprintf("Token token=%s, key=%s", g.ReportAuthToken, g.ReportAuthUser))
+	}
+
+	client := retryablehttp.NewClient()
+	client.Logger.SetFlags(0)
+	client.Logger.SetOutput(ioutil.Discard)
+	client.HTTPClient.Timeout = ReportTimeout
+	client.RetryMax = ReportRetries
+	client.RetryWaitMin = ReportRetryWaitMin
+	client.RetryWaitMax = ReportRetryWaitMax
+	resp, err := client.Do(req)
+	if err != nil {
+		metrics.SetButlerReportVal(metrics.FAILURE, host)
+		return fmt.Errorf("request to %v failed after %v attempts", host, client.RetryMax+1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		metrics.SetButlerReportVal(metrics.FAILURE, host)
+		return fmt.Errorf("unexpected response %v from %v", resp.Status, host)
+	}
+	metrics.SetButlerReportVal(metrics.SUCCESS, host)
+	return nil
+}
+
+// runReport is the scheduler job which reports the state of the managers to
+// the globals.report-url of g.
+func (bc *ButlerConfig) runReport(ctx context.Context, g ConfigGlobals) {
+	if err := bc.sendReport(ctx, g); err != nil {
+		log.Errorf("Config::runReport(): could not send the report. err=%v", err.Error())
+		return
+	}
+	log.Debugf("Config::runReport(): sent the report.")
+}
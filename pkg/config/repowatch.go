@@ -0,0 +1,209 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RepoWatchRetry is how long butler waits to watch a repo again, after its
+// watch failed.
+var RepoWatchRetry = 30 * time.Second
+
+// repoWatches are the watches of the repos of the managers, by the WatchID of
+// their method, see methods.Watcher.
+type repoWatches struct {
+	sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	watches map[string]context.CancelFunc
+	// run runs the managers whose repo changed.
+	run func(ctx context.Context, only map[string]bool)
+}
+
+// WatchRepos watches the repos of the managers whose method is set up to be
+// told of their changes, eg: the file method, or the s3 method with an
+// sqs-queue-url, and runs
+// the managers whose files changed right away, on top of their schedule. The
+// watches are kept in line with the butler configuration as it changes, until
+// butler shuts down.
+func (bc *ButlerConfig) WatchRepos() {
+	ctx, cancel := context.WithCancel(context.Background())
+	bc.repoWatch = &repoWatches{
+		ctx:     ctx,
+		cancel:  cancel,
+		watches: make(map[string]context.CancelFunc),
+		run: func(ctx context.Context, only map[string]bool) {
+			bc.runCMHandler(ctx, only)
+		},
+	}
+	bc.UpdateRepoWatches()
+}
+
+// UpdateRepoWatches starts the watches of the repos which are new in the
+// butler configuration, and stops those which are no longer in it. It does
+// nothing before WatchRepos.
+func (bc *ButlerConfig) UpdateRepoWatches() {
+	w := bc.repoWatch
+	if w == nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.ctx.Err() != nil {
+		return
+	}
+	want := bc.repoWatchers()
+	for id, cancel := range w.watches {
+		if _, ok := want[id]; !ok {
+			log.Infof("Config::UpdateRepoWatches(): no longer watching %v.", id)
+			cancel()
+			delete(w.watches, id)
+		}
+	}
+	for id, r := range want {
+		if _, ok := w.watches[id]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(w.ctx)
+		w.watches[id] = cancel
+		go bc.watchRepo(ctx, id, r)
+	}
+}
+
+// stopRepoWatches stops watching the repos, and the runs they started.
+func (bc *ButlerConfig) stopRepoWatches() {
+	if w := bc.repoWatch; w != nil {
+		w.Lock()
+		w.cancel()
+		w.watches = make(map[string]context.CancelFunc)
+		w.Unlock()
+	}
+}
+
+// watchedRepo is a repo whose method is set up to watch it.
+type watchedRepo struct {
+	watcher methods.Watcher
+	url     *url.URL
+}
+
+// watchID returns what the method of the repo watches for it, or nothing when
+// the method does not watch.
+func (bmo *ManagerOpts) watchID() (string, watchedRepo) {
+	w, ok := bmo.Opts.(methods.Watcher)
+	if !ok {
+		return "", watchedRepo{}
+	}
+	u, err := bmo.RemoteURL(bmo.baseRemotePath)
+	if err != nil {
+		return "", watchedRepo{}
+	}
+	return w.WatchID(u), watchedRepo{watcher: w, url: u}
+}
+
+// repoWatchers returns the repos of the managers whose method is set up to
+// watch, by what their method watches.
+func (bc *ButlerConfig) repoWatchers() map[string]watchedRepo {
+	res := make(map[string]watchedRepo)
+	for _, m := range bc.GetManagers() {
+		for _, o := range m.ManagerOpts {
+			if id, r := o.watchID(); id != "" {
+				res[id] = r
+			}
+		}
+	}
+	return res
+}
+
+// watchRepo watches the repo until ctx is done, watching it again
+// RepoWatchRetry after a failure. In the meantime, the managers only run on
+// their schedule.
+func (bc *ButlerConfig) watchRepo(ctx context.Context, id string, r watchedRepo) {
+	log.Infof("Config::WatchRepos(): watching %v.", id)
+	for {
+		err := r.watcher.Watch(ctx, r.url, func(paths []string) { bc.repoChanged(ctx, id, paths) })
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = context.Canceled
+		}
+		log.Errorf("Config::WatchRepos(): could not watch %v, watching it again in %v. err=%v", id, RepoWatchRetry, err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RepoWatchRetry):
+		}
+	}
+}
+
+// repoChanged runs the managers whose files are among the paths which changed
+// in the repo watched as id, and are not paused.
+func (bc *ButlerConfig) repoChanged(ctx context.Context, id string, paths []string) {
+	only := make(map[string]bool)
+	for _, name := range bc.watchedManagers(id, paths) {
+		if GetManagerPaused(bc.GetStatusFile(), name) != nil {
+			log.Infof("Config::WatchRepos()[manager=%v]: %v changed, but the manager is paused.", name, id)
+			continue
+		}
+		log.Infof("Config::WatchRepos()[manager=%v]: %v changed, running the manager.", name, id)
+		only[name] = true
+	}
+	if len(only) > 0 && ctx.Err() == nil {
+		bc.repoWatch.run(ctx, only)
+	}
+}
+
+// watchedManagers returns the managers which have a repo watched as id, under
+// whose repo-path one of the paths is.
+func (bc *ButlerConfig) watchedManagers(id string, paths []string) []string {
+	var res []string
+	for name, m := range bc.GetManagers() {
+		for _, o := range m.ManagerOpts {
+			if wid, _ := o.watchID(); wid != id {
+				continue
+			}
+			if o.watches(paths) {
+				res = append(res, name)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// watches returns true when one of the paths is under the repo-path of the
+// repo.
+func (bmo *ManagerOpts) watches(paths []string) bool {
+	u, err := bmo.RemoteURL(bmo.baseRemotePath)
+	if err != nil {
+		return false
+	}
+	prefix := strings.TrimSuffix(u.Path, "/")
+	for _, p := range paths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
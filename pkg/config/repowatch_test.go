@@ -0,0 +1,113 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+// testWatcher is a repo method which is told of the changes of the repo
+// through its changes channel.
+type testWatcher struct {
+	id      string
+	changes chan []string
+	stopped chan bool
+}
+
+func (w *testWatcher) Get(u *url.URL) (*methods.Response, error) {
+	return &methods.Response{}, nil
+}
+
+func (w *testWatcher) WatchID(repo *url.URL) string {
+	return w.id
+}
+
+func (w *testWatcher) Watch(ctx context.Context, repo *url.URL, changed func(paths []string)) error {
+	defer func() { w.stopped <- true }()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case paths := <-w.changes:
+			changed(paths)
+		}
+	}
+}
+
+func (s *ConfigTestSuite) TestWatchRepos(c *C) {
+	queue := &testWatcher{id: "s3:queue", changes: make(chan []string), stopped: make(chan bool, 1)}
+	other := &testWatcher{id: "s3:other", changes: make(chan []string), stopped: make(chan bool, 1)}
+	repo := func(w methods.Method, path string) map[string]*ManagerOpts {
+		o := &ManagerOpts{Method: "s3", Opts: w}
+		o.SetBasePaths("s3://repo/"+path, "")
+		return map[string]*ManagerOpts{"repo": o}
+	}
+	bc := &ButlerConfig{Config: NewConfigSettings()}
+	bc.Config.Globals.StatusFile = filepath.Join(c.MkDir(), "butler.status")
+	bc.Config.Managers = map[string]*Manager{
+		"prometheus":   {Name: "prometheus", ManagerOpts: repo(queue, "prometheus")},
+		"alertmanager": {Name: "alertmanager", ManagerOpts: repo(queue, "alertmanager/")},
+		"everything":   {Name: "everything", ManagerOpts: repo(queue, "")},
+		"elsewhere":    {Name: "elsewhere", ManagerOpts: repo(other, "prometheus")},
+		"polled":       {Name: "polled", ManagerOpts: repo(&methods.FileMethod{}, "prometheus")},
+	}
+
+	c.Assert(bc.watchedManagers("s3:queue", []string{"/prometheus/prometheus.yml"}), DeepEquals, []string{"everything", "prometheus"})
+	c.Assert(bc.watchedManagers("s3:queue", []string{"/prometheus-old/prometheus.yml", "/alertmanager/alertmanager.yml"}), DeepEquals, []string{"alertmanager", "everything"})
+	c.Assert(bc.watchedManagers("s3:other", []string{"/prometheus/rules/alerts.yml"}), DeepEquals, []string{"elsewhere"})
+	c.Assert(bc.watchedManagers("s3:unknown", []string{"/prometheus/prometheus.yml"}), HasLen, 0)
+
+	// nothing is watched before WatchRepos
+	bc.UpdateRepoWatches()
+	c.Assert(bc.repoWatch, IsNil)
+
+	runs := make(chan map[string]bool, 1)
+	bc.WatchRepos()
+	bc.repoWatch.run = func(ctx context.Context, only map[string]bool) { runs <- only }
+	c.Assert(bc.repoWatch.watches, HasLen, 2)
+
+	c.Assert(SetManagerPaused(bc.GetStatusFile(), "everything", &PauseState{Reason: "maintenance"}), IsNil)
+	queue.changes <- []string{"/prometheus/prometheus.yml"}
+	select {
+	case only := <-runs:
+		c.Assert(only, DeepEquals, map[string]bool{"prometheus": true})
+	case <-time.After(5 * time.Second):
+		c.Fatal("the manager did not run")
+	}
+
+	// the watches follow the butler configuration
+	delete(bc.Config.Managers, "elsewhere")
+	bc.UpdateRepoWatches()
+	select {
+	case <-other.stopped:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the watch did not stop")
+	}
+	c.Assert(bc.repoWatch.watches, HasLen, 1)
+
+	bc.stopRepoWatches()
+	select {
+	case <-queue.stopped:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the watch did not stop")
+	}
+	bc.UpdateRepoWatches()
+	c.Assert(bc.repoWatch.watches, HasLen, 0)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// responseCacheDir is the sub directory of the download-cache-path which the
+// responses shared by the managers are cached in.
+const responseCacheDir = ".responses"
+
+// responseCacheEntry is kept next to the cached copy of a response, which is
+// named after the url, the method options and the ETag of the response.
+type responseCacheEntry struct {
+	ETag    string    `json:"etag,omitempty"`
+	Fetched time.Time `json:"fetched"`
+	Sum     string    `json:"sum"`
+}
+
+// responseCacheLock serializes the managers, which download their files
+// concurrently, using the response cache.
+var responseCacheLock sync.Mutex
+
+// SetResponseCache sets the directory the responses of the http(s) and s3
+// repositories are cached in, and how long a cached response is used for,
+// without contacting the repository, by any manager which downloads the same
+// url. A ttl of 0 disables the response cache.
+func (bmo *ManagerOpts) SetResponseCache(dir string, ttl time.Duration) error {
+	bmo.responseCache = dir
+	bmo.responseCacheTTL = ttl
+	return nil
+}
+
+func (bmo *ManagerOpts) cachesResponses() bool {
+	if bmo.responseCache == "" || bmo.responseCacheTTL <= 0 {
+		return false
+	}
+	switch strings.ToLower(bmo.Method) {
+	case "http", "https", "s3":
+		return true
+	}
+	return false
+}
+
+// requestKey returns what identifies the request of the file: its url along
+// with the method and its options, eg: the credentials or the host-header,
+// which may change what the repository returns, so that a manager is never
+// handed what was fetched with the options of another.
+func (bmo *ManagerOpts) requestKey(file string) string {
+	return methodOptionsKey(bmo.Method, bmo.Opts) + "\n" + file
+}
+
+// methodOptionsKey returns a hash of the method and of the values of the
+// exported options of m. The clients, and the other pointers, of m are left
+// out, as they differ between managers which have the same options.
+func methodOptionsKey(method string, m methods.Method) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%T\n", strings.ToLower(method), m)
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanInterface() {
+				continue
+			}
+			switch f.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+				continue
+			}
+			fmt.Fprintf(h, "%s=%v\n", v.Type().Field(i).Name, f.Interface())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (bmo *ManagerOpts) responseEntryPath(file string) string {
+	return filepath.Join(bmo.responseCache, downloadKey(bmo.requestKey(file))+".json")
+}
+
+func (bmo *ManagerOpts) responseDataPath(file string, etag string) string {
+	return filepath.Join(bmo.responseCache, downloadKey(bmo.requestKey(file)+"\n"+etag))
+}
+
+func (bmo *ManagerOpts) responseEntry(file string) *responseCacheEntry {
+	data, err := ioutil.ReadFile(bmo.responseEntryPath(file))
+	if err != nil {
+		return nil
+	}
+	var res responseCacheEntry
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil
+	}
+	return &res
+}
+
+// copyCachedResponse copies the cached response for the file to dst when it
+// was fetched less than the response cache ttl ago, and its copy is intact.
+// It returns false, with dst left empty, otherwise.
+func (bmo *ManagerOpts) copyCachedResponse(file string, dst *os.File) (int64, bool) {
+	if !bmo.cachesResponses() {
+		return 0, false
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+
+	entry := bmo.responseEntry(file)
+	if entry == nil || time.Since(entry.Fetched) >= bmo.responseCacheTTL {
+		return 0, false
+	}
+	data := bmo.responseDataPath(file, entry.ETag)
+	sum, err := fileChecksum(data)
+	if err != nil || hex.EncodeToString(sum) != entry.Sum {
+		log.Debugf("ManagerOpts::copyCachedResponse()[count=%v][manager=%v]: cached response for %v is missing or modified.", cmHandlerCounter, bmo.parentManager, RedactURL(file))
+		return 0, false
+	}
+	f, err := os.Open(data)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	n, err := io.Copy(dst, f)
+	if err != nil {
+		dst.Truncate(0)
+		dst.Seek(0, io.SeekStart)
+		return 0, false
+	}
+	return n, true
+}
+
+// cacheResponse keeps a copy of the file downloaded to src in the response
+// cache, in place of the earlier response for the url.
+func (bmo *ManagerOpts) cacheResponse(file string, src string, etag string) error {
+	if !bmo.cachesResponses() {
+		return nil
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+
+	// the files may carry secrets
+	if err := os.MkdirAll(bmo.responseCache, 0700); err != nil {
+		return err
+	}
+	data := bmo.responseDataPath(file, etag)
+	opts := NewInstallOpts()
+	opts.Perms.Mode = 0600
+	if err := CopyBinaryFile(src, data, opts); err != nil {
+		return err
+	}
+	sum, err := fileChecksum(data)
+	if err != nil {
+		return err
+	}
+	if old := bmo.responseEntry(file); old != nil && old.ETag != etag {
+		os.Remove(bmo.responseDataPath(file, old.ETag))
+	}
+	entry, err := json.Marshal(responseCacheEntry{ETag: etag, Fetched: time.Now(), Sum: hex.EncodeToString(sum)})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bmo.responseEntryPath(file), entry, 0600)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestResponseCache(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bresponses")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var gets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("#butlerstart\nfoo: bar\n#butlerend\n"))
+	}))
+	defer server.Close()
+	file := server.URL + "/prometheus.yml"
+
+	// the managers share the responses
+	newOpts := func(manager string) *ManagerOpts {
+		method, err := methods.NewHTTPMethod(nil, nil)
+		c.Assert(err, IsNil)
+		opts := &ManagerOpts{Method: "http", Repo: "localhost", Opts: method}
+		opts.SetParentManager(manager)
+		opts.SetResponseCache(filepath.Join(dir, responseCacheDir), time.Minute)
+		return opts
+	}
+	read := func(opts *ManagerOpts) string {
+		f := opts.DownloadConfigFile(context.Background(), file)
+		c.Assert(f, NotNil)
+		defer os.Remove(f.Name())
+		data, err := ioutil.ReadFile(f.Name())
+		c.Assert(err, IsNil)
+		return string(data)
+	}
+	prometheus, alertmanager := newOpts("prometheus"), newOpts("alertmanager")
+
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(read(alertmanager), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 1)
+
+	// but not with the managers which have other method options, eg: other
+	// credentials
+	blackbox := newOpts("blackbox")
+	h := blackbox.Opts.(methods.HTTPMethod)
+	h.AuthUser, h.AuthToken = "blackbox", "secret"
+	blackbox.Opts = h
+	c.Assert(read(blackbox), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 2)
+
+	fi, err := os.Stat(prometheus.responseDataPath(file, `"v1"`))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0600))
+
+	// a modified cached copy is not used
+	c.Assert(ioutil.WriteFile(prometheus.responseDataPath(file, `"v1"`), []byte("modified"), 0600), IsNil)
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 3)
+
+	// nor is an expired response
+	entry := prometheus.responseEntry(file)
+	c.Assert(entry, NotNil)
+	entry.Fetched = time.Now().Add(-2 * time.Minute)
+	data, err := json.Marshal(entry)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(prometheus.responseEntryPath(file), data, 0600), IsNil)
+	c.Assert(read(alertmanager), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 4)
+
+	// a ttl of 0 disables the response cache
+	prometheus.SetResponseCache(filepath.Join(dir, responseCacheDir), 0)
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 5)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/leader"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// RolloutKey is the section of the butler config the coordination of
+	// the reloads across a fleet is configured in.
+	RolloutKey = "rollout"
+	// DefaultRolloutTTL is how long, in seconds, a reload holds its slot
+	// without renewing it.
+	DefaultRolloutTTL = 300
+	// DefaultRolloutWait is how long, in seconds, a reload waits for a slot.
+	DefaultRolloutWait = 600
+)
+
+// rolloutSettings are the settings of the rollout section, which let at most
+// maxUnavailable butlers of a fleet reload a manager at a time.
+type rolloutSettings struct {
+	method         string
+	entry          []byte
+	maxUnavailable int
+	ttl            time.Duration
+	wait           time.Duration
+	id             string
+	settings       string
+}
+
+var (
+	// rollout coordinates the reloads, or is nil when every butler reloads
+	// right away. The semaphores of the managers are set up on their first
+	// reload.
+	rollout           *rolloutSettings
+	rolloutSemaphores = make(map[string]*leader.Semaphore)
+	rolloutLock       sync.Mutex
+)
+
+// rolloutSeconds returns the option of the rollout section in seconds, or the
+// default when it is not set.
+func rolloutSeconds(result map[string]interface{}, key string, def int) (time.Duration, error) {
+	v := strings.TrimSpace(environment.GetVar(fmt.Sprintf("%v", result[key])))
+	if result[key] == nil || v == "" {
+		return time.Duration(def) * time.Second, nil
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		return 0, fmt.Errorf("invalid rollout %v %v", key, v)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// newRollout returns the settings of the rollout section of the butler
+// configuration, or nil when there is none. The section has the method of
+// the lock, the options of the method under its name, the max-unavailable
+// butlers which reload a manager at a time, the ttl and the wait, in seconds,
+// and optionally the id of this butler.
+func newRollout() (*rolloutSettings, error) {
+	var result map[string]interface{}
+
+	if !viper.IsSet(RolloutKey) {
+		return nil, nil
+	}
+	if err := viper.UnmarshalKey(RolloutKey, &result); err != nil {
+		return nil, err
+	}
+	settings, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rolloutSettings{maxUnavailable: 1, settings: string(settings)}
+	r.method, _ = result["method"].(string)
+	if r.method == "" {
+		return nil, errors.New("no rollout method has been defined")
+	}
+	if r.entry, err = json.Marshal(result[r.method]); err != nil {
+		return nil, err
+	}
+	if v := strings.TrimSpace(environment.GetVar(fmt.Sprintf("%v", result["max-unavailable"]))); result["max-unavailable"] != nil && v != "" {
+		if r.maxUnavailable, err = strconv.Atoi(v); err != nil || r.maxUnavailable < 1 {
+			return nil, fmt.Errorf("invalid rollout max-unavailable %v", v)
+		}
+	}
+	if r.ttl, err = rolloutSeconds(result, "ttl", DefaultRolloutTTL); err != nil {
+		return nil, err
+	}
+	if r.wait, err = rolloutSeconds(result, "wait", DefaultRolloutWait); err != nil {
+		return nil, err
+	}
+	if result["id"] != nil {
+		r.id = environment.GetVar(fmt.Sprintf("%v", result["id"]))
+	}
+	// catch the invalid options of the method along with the configuration,
+	// rather than on the first reload
+	if _, err = leader.NewSemaphore(r.method, r.entry, "check", r.maxUnavailable, r.id, r.ttl); err != nil {
+		return nil, fmt.Errorf("rollout %v: %v", r.method, err.Error())
+	}
+	return r, nil
+}
+
+// setRollout replaces the rollout settings, unless they are the same.
+func setRollout(r *rolloutSettings) {
+	rolloutLock.Lock()
+	defer rolloutLock.Unlock()
+	if r == nil && rollout == nil || r != nil && rollout != nil && r.settings == rollout.settings {
+		return
+	}
+	rollout = r
+	rolloutSemaphores = make(map[string]*leader.Semaphore)
+}
+
+// acquireReloadSlot waits for a slot to reload the manager in, when the
+// reloads are coordinated across the fleet, and returns the function which
+// gives the slot up once the manager has reloaded, and passed its health
+// check. It returns an error when no slot frees up in time.
+func acquireReloadSlot(name string) (func(), error) {
+	rolloutLock.Lock()
+	r := rollout
+	sem, ok := rolloutSemaphores[name]
+	if r != nil && !ok {
+		var err error
+		if sem, err = leader.NewSemaphore(r.method, r.entry, name, r.maxUnavailable, r.id, r.ttl); err != nil {
+			rolloutLock.Unlock()
+			return nil, err
+		}
+		rolloutSemaphores[name] = sem
+	}
+	rolloutLock.Unlock()
+	if r == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), r.wait)
+	defer cancel()
+	hold, err := sem.Acquire(ctx)
+	metrics.SetButlerRolloutWait(name, time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("could not get a rollout slot in %v. %v", r.wait, err.Error())
+	}
+	log.Infof("Config::acquireReloadSlot()[manager=%v]: got a rollout slot after %v.", name, time.Since(start))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.ttl/3)
+		defer cancel()
+		if err := hold.Release(ctx); err != nil {
+			log.Errorf("Config::acquireReloadSlot()[manager=%v]: could not release the rollout slot. err=%v", name, err.Error())
+		}
+	}, nil
+}
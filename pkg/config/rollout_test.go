@@ -0,0 +1,78 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe/butler/internal/leader"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestRollout(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "brollout")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	defer setRollout(nil)
+	poll := leader.SemaphorePoll
+	leader.SemaphorePoll = 10 * time.Millisecond
+	defer func() { leader.SemaphorePoll = poll }()
+
+	// without a rollout section every butler reloads right away
+	release, err := acquireReloadSlot("rollout-manager")
+	c.Assert(err, IsNil)
+	release()
+
+	setRollout(&rolloutSettings{
+		method:         "file",
+		entry:          []byte(fmt.Sprintf(`{"path": %q}`, filepath.Join(dir, "rollout.lock"))),
+		maxUnavailable: 1,
+		ttl:            time.Minute,
+		wait:           50 * time.Millisecond,
+		id:             "butler-a",
+		settings:       "a",
+	})
+	release, err = acquireReloadSlot("rollout-manager")
+	c.Assert(err, IsNil)
+
+	// the slots are per manager
+	releaseOther, err := acquireReloadSlot("other-manager")
+	c.Assert(err, IsNil)
+	releaseOther()
+	release()
+
+	// a butler waits for the slot another butler holds, and gives up after
+	// the wait
+	other, err := leader.NewSemaphore("file", rollout.entry, "rollout-manager", 1, "butler-b", time.Minute)
+	c.Assert(err, IsNil)
+	hold, err := other.Acquire(context.Background())
+	c.Assert(err, IsNil)
+	_, err = acquireReloadSlot("rollout-manager")
+	c.Assert(err, ErrorMatches, "could not get a rollout slot in 50ms. no free slot")
+	c.Assert(hold.Release(context.Background()), IsNil)
+	release, err = acquireReloadSlot("rollout-manager")
+	c.Assert(err, IsNil)
+	release()
+
+	// the rollout section is checked along with the configuration
+	config := strictTestConfig(`max-unavailable = "2"`, `max-unavailable = "0"`)
+	c.Assert(CheckConfig("butler.toml", config, "", false), ErrorMatches, ".*invalid rollout max-unavailable 0.*")
+	config = strictTestConfig(`key = "butler/rollout"`, ``)
+	c.Assert(CheckConfig("butler.toml", config, "", false), ErrorMatches, ".*rollout consul: no key defined for the consul lock.*")
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// RunStatus is the outcome of the latest runs of a manager.
+type RunStatus struct {
+	LastRun     time.Time     `json:"last-run"`
+	LastSuccess time.Time     `json:"last-success"`
+	LastError   string        `json:"last-error,omitempty"`
+	LastReload  *ReloadStatus `json:"last-reload,omitempty"`
+	// ConsecutiveFailedRuns counts the runs which failed since the last
+	// successful one. The breaker of the manager is open until
+	// BreakerOpenUntil, when it is set.
+	ConsecutiveFailedRuns int        `json:"consecutive-failed-runs"`
+	BreakerOpenUntil      *time.Time `json:"breaker-open-until,omitempty"`
+	// CanaryChanged is when a canary manager last copied changed files,
+	// which the other managers hold theirs back for until it has soaked,
+	// and CanaryPromoted whether they have been let through since.
+	CanaryChanged  *time.Time `json:"canary-changed,omitempty"`
+	CanaryPromoted bool       `json:"canary-promoted,omitempty"`
+	// StaleSince is when the last successful run became older than the
+	// stale-threshold of the manager, while it is.
+	StaleSince *time.Time `json:"stale-since,omitempty"`
+}
+
+// ReloadStatus is the outcome of the latest reload of a manager.
+type ReloadStatus struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ManagerStatus is the state of a manager which the /v1/status endpoint
+// reports.
+type ManagerStatus struct {
+	RunStatus
+	Schedule      string            `json:"schedule"`
+	NextRun       *time.Time        `json:"next-run,omitempty"`
+	ConfigVersion string            `json:"config-version"`
+	Files         map[string]string `json:"files"`
+	Paused        *PauseState       `json:"paused,omitempty"`
+	// Status, ConsecutiveFailures and History come from the StatusRecord
+	// of the manager in the status file.
+	Status              string        `json:"status,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive-failures"`
+	History             []StatusEvent `json:"history,omitempty"`
+}
+
+// ButlerStatus is the state of butler which the /v1/status endpoint
+// reports. ConfigVersion is the content address of the butler configuration,
+// along with its includes, which butler runs on. Bootstrapped is set while it
+// is the bootstrap copy of the butler configuration.
+type ButlerStatus struct {
+	ConfigURL        string                    `json:"config-url"`
+	ConfigVersion    string                    `json:"config-version"`
+	Bootstrapped     bool                      `json:"bootstrapped,omitempty"`
+	RetrieveInterval int                       `json:"retrieve-interval"`
+	Schedule         string                    `json:"schedule"`
+	NextRetrieve     *time.Time                `json:"next-retrieve,omitempty"`
+	Managers         map[string]*ManagerStatus `json:"managers"`
+}
+
+var (
+	// runStatuses are keyed by manager name, like lastReloads, so that they
+	// survive the managers being re-created on a butler config change.
+	runStatuses   = make(map[string]*RunStatus)
+	runStatusLock sync.Mutex
+)
+
+// recordRun records the outcome of a run of the manager, which failed when
+// err is not nil.
+func recordRun(name string, err error) {
+	runStatusLock.Lock()
+	defer runStatusLock.Unlock()
+	s := runStatus(name)
+	s.LastRun = time.Now()
+	s.LastError = ""
+	if err != nil {
+		s.LastError = err.Error()
+		s.ConsecutiveFailedRuns++
+		return
+	}
+	s.LastSuccess = s.LastRun
+	s.ConsecutiveFailedRuns = 0
+}
+
+// recordReload records the outcome of a reload of the manager.
+func recordReload(name string, err error) {
+	runStatusLock.Lock()
+	defer runStatusLock.Unlock()
+	r := &ReloadStatus{Time: time.Now(), Success: err == nil}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	runStatus(name).LastReload = r
+}
+
+func runStatus(name string) *RunStatus {
+	s, ok := runStatuses[name]
+	if !ok {
+		s = &RunStatus{}
+		runStatuses[name] = s
+	}
+	return s
+}
+
+// GetRunStatus returns the outcome of the latest runs of the manager.
+func GetRunStatus(name string) RunStatus {
+	runStatusLock.Lock()
+	defer runStatusLock.Unlock()
+	s := *runStatus(name)
+	if s.LastReload != nil {
+		r := *s.LastReload
+		s.LastReload = &r
+	}
+	if s.BreakerOpenUntil != nil {
+		t := *s.BreakerOpenUntil
+		s.BreakerOpenUntil = &t
+	}
+	if s.CanaryChanged != nil {
+		t := *s.CanaryChanged
+		s.CanaryChanged = &t
+	}
+	if s.StaleSince != nil {
+		t := *s.StaleSince
+		s.StaleSince = &t
+	}
+	return s
+}
+
+// Status returns the state of butler and of each of its managers.
+func (bc *ButlerConfig) Status() *ButlerStatus {
+	res := &ButlerStatus{
+		ConfigURL:        RedactURL(bc.URL().String()),
+		ConfigVersion:    contentVersion(bc.RawConfig),
+		Bootstrapped:     bc.bootstrapped,
+		RetrieveInterval: bc.Interval,
+		Managers:         make(map[string]*ManagerStatus),
+	}
+	res.Schedule, res.NextRetrieve = bc.jobSchedule(ConfigJob)
+
+	for name, m := range bc.GetManagers() {
+		files := m.fileSums()
+		s := &ManagerStatus{
+			RunStatus:     GetRunStatus(name),
+			ConfigVersion: snapshotID(files),
+			Files:         files,
+			Paused:        GetManagerPaused(bc.GetStatusFile(), name),
+		}
+		if r := GetManagerStatusRecord(bc.GetStatusFile(), name); r != nil {
+			s.Status = r.Status
+			s.ConsecutiveFailures = r.ConsecutiveFailures
+			s.History = r.History
+		}
+		if m.Schedule != nil {
+			s.Schedule, s.NextRun = bc.jobSchedule(ManagerJobPrefix + name)
+		} else {
+			s.Schedule, s.NextRun = bc.jobSchedule(CMHandlerJob)
+		}
+		res.Managers[name] = s
+	}
+	return res
+}
+
+// jobSchedule returns the schedule of the scheduler job, and when it runs
+// next. There is no schedule before butler runs on schedule, eg: with -once.
+func (bc *ButlerConfig) jobSchedule(job string) (string, *time.Time) {
+	if bc.Scheduler == nil {
+		return "", nil
+	}
+	var res string
+	if schedule, ok := bc.Scheduler.Schedule(job); ok {
+		res = schedule.String()
+	}
+	next, ok := bc.Scheduler.NextRun(job)
+	if !ok {
+		return res, nil
+	}
+	return res, &next
+}
+
+// contentVersion returns the content address of the data, in the same form
+// as the snapshot ids, or nothing when there is no data.
+func contentVersion(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+)
+
+// ConfigSchemaDraft is the JSON Schema draft which ConfigSchema follows.
+const ConfigSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// ConfigSchema returns a JSON Schema of the butler configuration, whatever
+// its format, eg: for CI pipelines to lint butler configurations before they
+// are deployed. It is generated from the options butler decodes the butler
+// configuration into, the same which the strict parsing checks the butler
+// configuration against, see ConfigSettings.Strict. Any option may be taken
+// from the environment, eg: "env:RETRIES", so the options which are numbers
+// or booleans take strings as well. The methods, and reloaders, of the
+// loaded plugins take any options.
+func ConfigSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema":     ConfigSchemaDraft,
+		"title":       "butler configuration",
+		"description": "The globals, the notify, leader and rollout sections, and the managers listed in globals.config-managers.",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"globals": withRequired(structSchema(reflect.TypeOf(ConfigGlobals{}), "mapstructure"), strictRequiredGlobals),
+			"notify":  methodsSchema(strictNotifiers, nil, nil),
+			"leader": methodsSchema(strictLeaders, map[string]interface{}{
+				"ttl": scalarSchema(),
+				"id":  scalarSchema(),
+			}, nil),
+			"rollout": methodsSchema(strictLeaders, map[string]interface{}{
+				"max-unavailable": scalarSchema(),
+				"ttl":             scalarSchema(),
+				"wait":            scalarSchema(),
+				"id":              scalarSchema(),
+			}, nil),
+		},
+		"required":             strictRequiredSettings,
+		"additionalProperties": map[string]interface{}{"$ref": "#/definitions/manager"},
+		"definitions": map[string]interface{}{
+			"manager": managerSchema(),
+			"repo":    repoSchema(),
+		},
+	}
+}
+
+// managerSchema returns the schema of a manager, whose other keys are its
+// repos.
+func managerSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(Manager{}), "mapstructure")
+	props := schema["properties"].(map[string]interface{})
+	continueOnError := map[string]interface{}{
+		"continue-on-error": valueOrListSchema(scalarSchema()),
+	}
+	props["reloader"] = methodsSchema(strictReloaders, continueOnError, reloaders.Plugins())
+	group := methodsSchema(strictReloaders, continueOnError, reloaders.Plugins())
+	group["properties"].(map[string]interface{})["files"] = valueOrListSchema(scalarSchema())
+	props["reloader-groups"] = map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": group,
+	}
+	props["validator"] = methodsSchema(strictValidators, nil, nil)
+	props["post-validator"] = methodsSchema(strictValidators, nil, nil)
+	props["health-check"] = methodsSchema(strictHealthChecks, map[string]interface{}{
+		"timeout":  scalarSchema(),
+		"interval": scalarSchema(),
+	}, nil)
+	props["destination"] = methodsSchema(strictDestinations, nil, nil)
+	fileGroup := structSchema(reflect.TypeOf(FileGroup{}), "mapstructure")
+	fileGroup["properties"].(map[string]interface{})["reloader"] = methodsSchema(strictReloaders, continueOnError, reloaders.Plugins())
+	fileGroup["properties"].(map[string]interface{})["validator"] = methodsSchema(strictValidators, nil, nil)
+	props["file-groups"] = map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": fileGroup,
+	}
+	schema["additionalProperties"] = map[string]interface{}{"$ref": "#/definitions/repo"}
+	return withRequired(schema, strictRequiredManager)
+}
+
+// repoSchema returns the schema of a repo of a manager, which has the
+// options of its method under the name of the method, and either a
+// primary-config or file-groups.
+func repoSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(ManagerOpts{}), "mapstructure")
+	props := schema["properties"].(map[string]interface{})
+	props["method"] = map[string]interface{}{
+		"type": "string",
+		"enum": schemaMethods(strictRepoMethods, methods.Plugins()),
+	}
+	for method, opts := range strictRepoMethods {
+		props[method] = structSchema(reflect.TypeOf(opts), "mapstructure")
+	}
+	for _, method := range methods.Plugins() {
+		props[method] = map[string]interface{}{"type": "object"}
+	}
+	schema["anyOf"] = []interface{}{
+		map[string]interface{}{"required": []string{"primary-config"}},
+		map[string]interface{}{"required": []string{"file-groups"}},
+	}
+	return withRequired(schema, strictRequiredRepo)
+}
+
+// methodsSchema returns the schema of a section which has the options of
+// each of its methods under the name of the method, along with the extra
+// options of the section. The options of the plugins are up to them.
+func methodsSchema(opts map[string]interface{}, extra map[string]interface{}, plugins []string) map[string]interface{} {
+	method := map[string]interface{}{
+		"type": "string",
+		"enum": schemaMethods(opts, plugins),
+	}
+	props := map[string]interface{}{
+		"method": valueOrListSchema(method),
+	}
+	for k, v := range extra {
+		props[k] = v
+	}
+	for m, o := range opts {
+		props[m] = structSchema(reflect.TypeOf(o), "json")
+	}
+	for _, m := range plugins {
+		props[m] = map[string]interface{}{"type": "object"}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             []string{"method"},
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema returns the schema of the values of the type, whose keys are
+// named by the tag when it is a struct.
+func typeSchema(t reflect.Type, tag string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, tag)
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), tag),
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), tag),
+		}
+	}
+	return scalarSchema()
+}
+
+func structSchema(t reflect.Type, tag string) map[string]interface{} {
+	props := make(map[string]interface{})
+	for k, ft := range structKeys(t, tag) {
+		props[k] = typeSchema(ft, tag)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func scalarSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": []string{"string", "number", "boolean"},
+	}
+}
+
+func valueOrListSchema(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			items,
+			map[string]interface{}{"type": "array", "items": items},
+		},
+	}
+}
+
+func withRequired(schema map[string]interface{}, required []string) map[string]interface{} {
+	schema["required"] = required
+	return schema
+}
+
+func schemaMethods(opts map[string]interface{}, plugins []string) []string {
+	res := append([]string{}, plugins...)
+	for m := range opts {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
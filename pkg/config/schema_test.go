@@ -0,0 +1,82 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+// schemaUnknown returns the keys of the value which the schema does not
+// describe. The anyOf schemas, eg: of the methods, are not looked into.
+func schemaUnknown(root map[string]interface{}, schema map[string]interface{}, path string, v interface{}) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = root["definitions"].(map[string]interface{})[ref[len("#/definitions/"):]].(map[string]interface{})
+	}
+	m, ok := asTable(v)
+	if !ok {
+		return nil
+	}
+	var unknown []string
+	props, _ := schema["properties"].(map[string]interface{})
+	for k, e := range m {
+		if p, ok := props[k].(map[string]interface{}); ok {
+			unknown = append(unknown, schemaUnknown(root, p, path+k+".", e)...)
+		} else if ap, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			unknown = append(unknown, schemaUnknown(root, ap, path+k+".", e)...)
+		} else {
+			unknown = append(unknown, path+k)
+		}
+	}
+	return unknown
+}
+
+func (s *ConfigTestSuite) TestConfigSchema(c *C) {
+	schema := ConfigSchema()
+	_, err := json.Marshal(schema)
+	c.Assert(err, IsNil)
+	c.Assert(schema["$schema"], Equals, ConfigSchemaDraft)
+	c.Assert(schema["required"], DeepEquals, []string{"globals"})
+
+	definitions := schema["definitions"].(map[string]interface{})
+	repo := definitions["repo"].(map[string]interface{})
+	c.Assert(repo["required"], DeepEquals, []string{"method"})
+	c.Assert(repo["anyOf"], HasLen, 2)
+	c.Assert(repo["properties"].(map[string]interface{})["method"], DeepEquals, map[string]interface{}{
+		"type": "string",
+		"enum": []string{"blob", "etcd", "file", "http", "https", "s3"},
+	})
+	http := repo["properties"].(map[string]interface{})["http"].(map[string]interface{})
+	c.Assert(http["properties"].(map[string]interface{})["retry-wait-min"], NotNil)
+	c.Assert(http["properties"].(map[string]interface{})["host"], NotNil)
+	c.Assert(http["additionalProperties"], Equals, false)
+
+	manager := definitions["manager"].(map[string]interface{})
+	props := manager["properties"].(map[string]interface{})
+	c.Assert(props["repos"], DeepEquals, map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": []string{"string", "number", "boolean"}},
+	})
+	reloader := props["reloader"].(map[string]interface{})
+	c.Assert(reloader["required"], DeepEquals, []string{"method"})
+	c.Assert(reloader["properties"].(map[string]interface{})["kubernetes"], NotNil)
+
+	// the schema describes whatever the strict parsing accepts
+	c.Assert(CheckConfig("butler.toml", strictTestConfig(), "", true), IsNil)
+	c.Assert(schemaUnknown(schema, schema, "", viper.AllSettings()), HasLen, 0)
+	c.Assert(schemaUnknown(schema, schema, "", map[string]interface{}{
+		"test-handler": map[string]interface{}{"reloader": map[string]interface{}{"http": map[string]interface{}{"retry-wiat-min": "5"}}},
+	}), DeepEquals, []string{"test-handler.reloader.http.retry-wiat-min"})
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sharedDownload is the download of a url which the managers which list the
+// same url share during a run. done is closed once the body has been copied
+// to file, or the download has failed with err.
+type sharedDownload struct {
+	done chan struct{}
+	file string
+	err  error
+	// cancelled is set when the download failed because the context of the
+	// manager which downloaded it was done, which is none of the business of
+	// the other managers.
+	cancelled bool
+}
+
+var (
+	// sharedDownloads are keyed by the requestKey of the url, and are only
+	// set for the length of a run, so that the managers which list the same
+	// url, with the same method options, download it once per run.
+	sharedDownloads     map[string]*sharedDownload
+	sharedDownloadsLock sync.Mutex
+)
+
+// startSharedDownloads starts sharing the downloads between the managers. It
+// is protected by cmHandlerLock.
+func startSharedDownloads() {
+	sharedDownloadsLock.Lock()
+	defer sharedDownloadsLock.Unlock()
+	sharedDownloads = make(map[string]*sharedDownload)
+}
+
+// endSharedDownloads stops sharing the downloads, and removes the copies of
+// their bodies. It is protected by cmHandlerLock.
+func endSharedDownloads() {
+	sharedDownloadsLock.Lock()
+	downloads := sharedDownloads
+	sharedDownloads = nil
+	sharedDownloadsLock.Unlock()
+	for _, d := range downloads {
+		<-d.done
+		if d.file != "" {
+			removeTempFile(d.file)
+		}
+	}
+}
+
+// downloadConfigFile downloads the file to a temporary file. It returns
+// errFileNotFound along with the nil file when the repository does not have
+// the file. During a run, a url which another manager with the same method
+// options has downloaded, or is downloading, is not downloaded again, and
+// the outcome of that download is shared instead, unless it was cut short by
+// the context of that manager.
+func (bmo *ManagerOpts) downloadConfigFile(ctx context.Context, file string) (*os.File, error) {
+	sharedDownloadsLock.Lock()
+	if sharedDownloads == nil {
+		sharedDownloadsLock.Unlock()
+		return bmo.fetchConfigFile(ctx, file)
+	}
+	key := bmo.requestKey(file)
+	d, ok := sharedDownloads[key]
+	if !ok {
+		d = &sharedDownload{done: make(chan struct{})}
+		sharedDownloads[key] = d
+	}
+	sharedDownloadsLock.Unlock()
+
+	if !ok {
+		f, err := bmo.fetchConfigFile(ctx, file)
+		d.err = err
+		d.cancelled = err != nil && ctx.Err() != nil
+		if err == nil {
+			if err := shareDownload(d, f); err != nil {
+				log.Warnf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not share download of %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+			}
+		}
+		close(d.done)
+		return f, err
+	}
+
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if d.cancelled || (d.err == nil && d.file == "") {
+		return bmo.fetchConfigFile(ctx, file)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	log.Debugf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: %s already downloaded during the run, using the shared copy.", cmHandlerCounter, bmo.parentManager, file)
+	f, err := copySharedDownload(d)
+	if err != nil {
+		log.Errorf("ManagerOpts::DownloadConfigFile()[count=%v][manager=%v]: Could not copy shared download of %s, err=%s", cmHandlerCounter, bmo.parentManager, file, err.Error())
+		return nil, err
+	}
+	metrics.IncButlerSharedDownload(bmo.Repo)
+	return f, nil
+}
+
+// shareDownload keeps a copy of the downloaded file f for the managers which
+// download the same url later on during the run. Those download the url
+// themselves when it could not be kept.
+func shareDownload(d *sharedDownload, f *os.File) error {
+	shared, err := tempFile(os.TempDir(), "bcmsshared")
+	if err != nil {
+		return err
+	}
+	defer shared.Close()
+	src, err := os.Open(f.Name())
+	if err == nil {
+		defer src.Close()
+		_, err = io.Copy(shared, src)
+	}
+	if err != nil {
+		removeTempFile(shared.Name())
+		return err
+	}
+	d.file = shared.Name()
+	return nil
+}
+
+// copySharedDownload copies the shared download to a temporary file of its
+// own, which the manager installs, or removes, as it would a download.
+func copySharedDownload(d *sharedDownload) (*os.File, error) {
+	src, err := os.Open(d.file)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	f, err := tempFile(os.TempDir(), "bcmsfile")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, src); err != nil {
+		removeTempFile(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestSharedDownloads(c *C) {
+	var gets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if r.URL.Path != "/prometheus.yml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("#butlerstart\nfoo: bar\n#butlerend\n"))
+	}))
+	defer server.Close()
+	file := server.URL + "/prometheus.yml"
+
+	newOpts := func(manager string) *ManagerOpts {
+		method, err := methods.NewHTTPMethod(nil, nil)
+		c.Assert(err, IsNil)
+		opts := &ManagerOpts{Method: "http", Repo: "localhost", Opts: method}
+		opts.SetParentManager(manager)
+		return opts
+	}
+	read := func(opts *ManagerOpts) string {
+		f, err := opts.downloadConfigFile(context.Background(), file)
+		c.Assert(err, IsNil)
+		defer os.Remove(f.Name())
+		data, err := ioutil.ReadFile(f.Name())
+		c.Assert(err, IsNil)
+		return string(data)
+	}
+	prometheus, alertmanager := newOpts("prometheus"), newOpts("alertmanager")
+
+	// the managers which list the same url download it once per run
+	startSharedDownloads()
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(read(alertmanager), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 1)
+
+	// along with the files which are missing
+	_, err := prometheus.downloadConfigFile(context.Background(), server.URL+"/missing.yml")
+	c.Assert(err, Equals, errFileNotFound)
+	_, err = alertmanager.downloadConfigFile(context.Background(), server.URL+"/missing.yml")
+	c.Assert(err, Equals, errFileNotFound)
+	c.Assert(gets, Equals, 2)
+
+	// but not with the managers which have other method options, eg: another
+	// Host header
+	blackbox := newOpts("blackbox")
+	h := blackbox.Opts.(methods.HTTPMethod)
+	h.HostHeader = "blackbox.domain.com"
+	blackbox.Opts = h
+	c.Assert(read(blackbox), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 3)
+
+	// nor a download cut short by the context of the manager which made it
+	cancelled := server.URL + "/prometheus.yml?cancelled"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = prometheus.downloadConfigFile(ctx, cancelled)
+	c.Assert(err, NotNil)
+	f, err := alertmanager.downloadConfigFile(context.Background(), cancelled)
+	c.Assert(err, IsNil)
+	os.Remove(f.Name())
+	c.Assert(gets, Equals, 4)
+
+	// the shared copies are removed along with the run
+	shared := sharedDownloads[prometheus.requestKey(file)].file
+	endSharedDownloads()
+	_, err = os.Stat(shared)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	c.Assert(read(prometheus), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 5)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tempFiles are the temporary files butler has created while downloading and
+// copying configuration files, and not removed yet. They are removed on
+// shutdown when a run does not finish in time.
+var tempFiles = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// tempFile creates a temporary file the way ioutil.TempFile does, and keeps
+// track of it until it is removed, or forgotten.
+func tempFile(dir string, pattern string) (*os.File, error) {
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	tempFiles.Lock()
+	tempFiles.names[f.Name()] = true
+	tempFiles.Unlock()
+	return f, nil
+}
+
+// forgetTempFile stops keeping track of a temporary file, eg: once it has been
+// renamed into place.
+func forgetTempFile(name string) {
+	tempFiles.Lock()
+	delete(tempFiles.names, name)
+	tempFiles.Unlock()
+}
+
+// removeTempFile removes a temporary file.
+func removeTempFile(name string) error {
+	forgetTempFile(name)
+	return os.Remove(name)
+}
+
+// removeTempFiles removes the temporary files which have not been removed
+// yet. It returns how many it removed.
+func removeTempFiles() int {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	removed := 0
+	for name := range tempFiles.names {
+		if err := os.Remove(name); err == nil {
+			removed++
+		}
+		delete(tempFiles.names, name)
+	}
+	return removed
+}
+
+// Shutdown stops the scheduler, and the watches of the repos, which cancels
+// the runs in flight, and waits up to timeout for them, and for the runs
+// started from the admin endpoints, to finish. A cancelled run does not copy
+// the files of the managers it has not got to yet, but still reloads, or
+// rolls back, those it has copied. Shutdown then gives up the leader lock,
+// sends the events which are still queued, and, when a run did not finish in
+// time, removes its temporary files. It returns an error when butler could
+// not shut down cleanly in time.
+func (bc *ButlerConfig) Shutdown(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	done := make(chan bool)
+	bc.stopRepoWatches()
+	go func() {
+		if bc.Scheduler != nil {
+			bc.Scheduler.Stop()
+		}
+		cmHandlerLock.Lock()
+		cmHandlerLock.Unlock()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Infof("ButlerConfig::Shutdown(): runs finished.")
+		// Give up the leader lock so another butler takes over right away.
+		// With runs still in flight it is left to expire instead.
+		setElector(nil, "")
+	case <-time.After(timeout):
+		err = fmt.Errorf("runs still in flight after %v", timeout)
+		log.Errorf("ButlerConfig::Shutdown(): %v, removed %v temporary files.", err.Error(), removeTempFiles())
+	}
+
+	if e := events.Close(time.Until(deadline)); e != nil {
+		log.Errorf("ButlerConfig::Shutdown(): %v", e.Error())
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
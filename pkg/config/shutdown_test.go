@@ -0,0 +1,75 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/adobe/butler/internal/scheduler"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestShutdown(c *C) {
+	// a run which is in flight is cancelled, and waited for
+	started := make(chan bool)
+	cancelled := make(chan bool, 1)
+	sched := scheduler.NewScheduler()
+	sched.Add("testing", scheduler.Every(10*time.Millisecond), func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- true
+	})
+	bc := &ButlerConfig{Scheduler: sched}
+	sched.Start()
+	<-started
+	c.Assert(bc.Shutdown(time.Second), IsNil)
+	c.Assert(<-cancelled, Equals, true)
+
+	// a run which does not finish in time is given up on, and the
+	// temporary files are removed
+	tmp, err := tempFile("/tmp", "bcmsfile")
+	c.Assert(err, IsNil)
+	tmp.Close()
+	started = make(chan bool)
+	sched = scheduler.NewScheduler()
+	sched.Add("testing", scheduler.Every(10*time.Millisecond), func(ctx context.Context) {
+		close(started)
+		time.Sleep(time.Second)
+	})
+	bc = &ButlerConfig{Scheduler: sched}
+	sched.Start()
+	<-started
+	c.Assert(bc.Shutdown(100*time.Millisecond), ErrorMatches, "runs still in flight after 100ms")
+	_, err = os.Stat(tmp.Name())
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ConfigTestSuite) TestTempFiles(c *C) {
+	tmp, err := tempFile("/tmp", "bcmsfile")
+	c.Assert(err, IsNil)
+	tmp.Close()
+	c.Assert(removeTempFile(tmp.Name()), IsNil)
+
+	// a forgotten file is left alone
+	tmp, err = tempFile("/tmp", "bcmsfile")
+	c.Assert(err, IsNil)
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	forgetTempFile(tmp.Name())
+	removeTempFiles()
+	_, err = os.Stat(tmp.Name())
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,374 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultCacheRetention is the number of snapshots that are kept per
+	// manager when manager.cache-retention is not set.
+	DefaultCacheRetention = 5
+)
+
+// Snapshot is a known good set of configuration files for a manager. Files
+// maps the local path of each file to the sha256 of its contents, which is
+// also the name of the object in the snapshot store.
+type Snapshot struct {
+	ID      string            `json:"id"`
+	Created time.Time         `json:"created"`
+	Files   map[string]string `json:"files"`
+}
+
+// SnapshotStore is an on disk, content addressed store of the last Retention
+// known good configuration sets for a manager. The layout is:
+//
+//	<path>/objects/<sha256>      file contents
+//	<path>/snapshots/<id>.json   snapshot manifests
+type SnapshotStore struct {
+	Manager   string `json:"-"`
+	Path      string `json:"path"`
+	Retention int    `json:"retention"`
+}
+
+func NewSnapshotStore(manager string, path string, retention int) *SnapshotStore {
+	return &SnapshotStore{Manager: manager, Path: path, Retention: retention}
+}
+
+func (s *SnapshotStore) objectPath(sum string) string {
+	return filepath.Join(s.Path, "objects", sum)
+}
+
+func (s *SnapshotStore) snapshotPath(id string) string {
+	return filepath.Join(s.Path, "snapshots", fmt.Sprintf("%s.json", id))
+}
+
+// Save stores the files as a new snapshot, and prunes the snapshots beyond
+// the retention. If the files are identical to an already retained snapshot,
+// that snapshot becomes the latest instead.
+func (s *SnapshotStore) Save(files []string) (*Snapshot, error) {
+	for _, d := range []string{"objects", "snapshots"} {
+		if err := os.MkdirAll(filepath.Join(s.Path, d), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	snap := &Snapshot{Created: time.Now(), Files: make(map[string]string)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		hexSum := hex.EncodeToString(sum[:])
+		if _, err := os.Stat(s.objectPath(hexSum)); err != nil {
+			if err := InstallFile(bytes.NewReader(data), s.objectPath(hexSum), NewInstallOpts()); err != nil {
+				return nil, err
+			}
+		}
+		snap.Files[file] = hexSum
+	}
+	snap.ID = snapshotID(snap.Files)
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := InstallFile(bytes.NewReader(data), s.snapshotPath(snap.ID), NewInstallOpts()); err != nil {
+		return nil, err
+	}
+
+	if err := s.Prune(); err != nil {
+		log.Warnf("SnapshotStore::Save()[count=%v][manager=%v]: could not prune snapshots. err=%v", cmHandlerCounter, s.Manager, err.Error())
+	}
+	return snap, nil
+}
+
+// snapshotID returns the content address of the snapshot, which is derived
+// from the sorted file paths and their sums.
+func snapshotID(files map[string]string) string {
+	var keys []string
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s %s\n", files[k], k)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// ConfigVersion returns the content address of the manager config files as
+// they are on disk, in the same form as the snapshot ids. Files which do not
+// exist are left out.
+func (bm *Manager) ConfigVersion() string {
+	return snapshotID(bm.fileSums())
+}
+
+// fileSums returns the sha256 sums of the manager config files as they are on
+// disk, by path. Files which do not exist are left out.
+func (bm *Manager) fileSums() map[string]string {
+	files := make(map[string]string)
+	for _, file := range bm.GetAllLocalPaths() {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		files[file] = hex.EncodeToString(sum[:])
+	}
+	return files
+}
+
+// List returns the retained snapshots, newest first.
+func (s *SnapshotStore) List() ([]*Snapshot, error) {
+	var res []*Snapshot
+
+	entries, err := ioutil.ReadDir(filepath.Join(s.Path, "snapshots"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.Path, "snapshots", e.Name()))
+		if err != nil {
+			return res, err
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			log.Warnf("SnapshotStore::List()[count=%v][manager=%v]: skipping unreadable snapshot %v. err=%v", cmHandlerCounter, s.Manager, e.Name(), err.Error())
+			continue
+		}
+		res = append(res, &snap)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.After(res[j].Created) })
+	return res, nil
+}
+
+// Latest returns the most recent snapshot, or nil if there are none.
+func (s *SnapshotStore) Latest() (*Snapshot, error) {
+	snaps, err := s.List()
+	if err != nil || len(snaps) == 0 {
+		return nil, err
+	}
+	return snaps[0], nil
+}
+
+// Get returns the snapshot with the id. A unique prefix of the id is accepted.
+func (s *SnapshotStore) Get(id string) (*Snapshot, error) {
+	var found *Snapshot
+
+	if id == "" {
+		return nil, errors.New("no snapshot id provided")
+	}
+
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if strings.HasPrefix(snap.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("snapshot id %v is ambiguous", id)
+			}
+			found = snap
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown snapshot %v for manager %v", id, s.Manager)
+	}
+	return found, nil
+}
+
+// Restore writes the files of the snapshot back to their local paths.
+func (s *SnapshotStore) Restore(snap *Snapshot) error {
+	var paths []string
+	for file := range snap.Files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+
+	for _, file := range paths {
+		data, err := ioutil.ReadFile(s.objectPath(snap.Files[file]))
+		if err != nil {
+			return fmt.Errorf("could not read %v from snapshot %v. err=%v", file, snap.ID, err.Error())
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := InstallFile(bytes.NewReader(data), file, NewInstallOpts()); err != nil {
+			return fmt.Errorf("could not restore %v from snapshot %v. err=%v", file, snap.ID, err.Error())
+		}
+		log.Warnf("SnapshotStore::Restore()[count=%v][manager=%v]: Wrote %d bytes for %s.", cmHandlerCounter, s.Manager, len(data), file)
+	}
+	return nil
+}
+
+// Prune removes the snapshots beyond the retention, and any objects which
+// are no longer referenced by a retained snapshot.
+func (s *SnapshotStore) Prune() error {
+	snaps, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	retention := s.Retention
+	if retention < 1 {
+		retention = 1
+	}
+
+	referenced := make(map[string]bool)
+	for i, snap := range snaps {
+		if i >= retention {
+			log.Debugf("SnapshotStore::Prune()[count=%v][manager=%v]: removing snapshot %v", cmHandlerCounter, s.Manager, snap.ID)
+			os.Remove(s.snapshotPath(snap.ID))
+			continue
+		}
+		for _, sum := range snap.Files {
+			referenced[sum] = true
+		}
+	}
+
+	objects, err := ioutil.ReadDir(filepath.Join(s.Path, "objects"))
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if !referenced[o.Name()] {
+			os.Remove(s.objectPath(o.Name()))
+		}
+	}
+	return nil
+}
+
+// CacheConfigs stores the files as the newest known good snapshot for the
+// manager. It returns an error on the event of error
+func (bm *Manager) CacheConfigs(files []string) error {
+	log.Infof("Manager::CacheConfigs()[count=%v][manager=%v]: Storing known good configurations to cache.", cmHandlerCounter, bm.Name)
+	if bm.Snapshots == nil {
+		msg := fmt.Sprintf("Manager::CacheConfigs()[count=%v][manager=%v]: No snapshot store configured.", cmHandlerCounter, bm.Name)
+		return errors.New(msg)
+	}
+
+	snap, err := bm.Snapshots.Save(files)
+	if err != nil {
+		msg := fmt.Sprintf("Manager::CacheConfigs()[count=%v][manager=%v]: Could not store snapshot. err=%s", cmHandlerCounter, bm.Name, err.Error())
+		log.Error(msg)
+		metrics.SetButlerKnownGoodCachedVal(metrics.FAILURE, bm.Name)
+		return errors.New(msg)
+	}
+	bm.GoodCache = true
+	log.Infof("Manager::CacheConfigs()[count=%v][manager=%v]: Done storing known good configurations to cache as snapshot %v.", cmHandlerCounter, bm.Name, snap.ID)
+	metrics.SetButlerKnownGoodCachedVal(metrics.SUCCESS, bm.Name)
+	metrics.SetButlerKnownGoodRestoredVal(metrics.FAILURE, bm.Name)
+	return nil
+}
+
+// RestoreCachedConfigs restores the latest known good snapshot back to the
+// filesystem. If there is no known good snapshot and clean-files is enabled,
+// then the files are removed instead.
+func (bm *Manager) RestoreCachedConfigs(files []string) error {
+	var snap *Snapshot
+
+	if bm.Snapshots != nil {
+		snap, _ = bm.Snapshots.Latest()
+	}
+
+	// If we do not have a good configuration cache, then there's nothing for us to do.
+	if snap == nil {
+		if bm.CleanFiles {
+			unlock, err := bm.LockCopy()
+			if err != nil {
+				log.Errorf("Manager::RestoreCachedConfigs()[count=%v][manager=%v]: not cleaning configuration. err=%v", cmHandlerCounter, bm.Name, err.Error())
+				return err
+			}
+			defer unlock()
+			log.Infof("Manager::RestoreCachedConfigs()[count=%v][manager=%v]: No current known good configurations in cache. Cleaning configuration...", cmHandlerCounter, bm.Name)
+			for _, file := range files {
+				log.Warnf("Manager::RestoreCachedConfigs()[count=%v][manager=%v]: Removing bad configuration file %s.", cmHandlerCounter, bm.Name, file)
+				os.Remove(file)
+			}
+			log.Infof("Manager::RestoreCachedConfigs()[count=%v][manager=%v]: Done cleaning broken configuration. Returning...", cmHandlerCounter, bm.Name)
+		}
+		metrics.SetButlerKnownGoodCachedVal(metrics.FAILURE, bm.Name)
+		metrics.SetButlerKnownGoodRestoredVal(metrics.FAILURE, bm.Name)
+		return nil
+	}
+	return bm.RestoreSnapshot(snap.ID)
+}
+
+// RestoreSnapshot restores any retained snapshot of the manager back to the
+// filesystem.
+func (bm *Manager) RestoreSnapshot(id string) error {
+	if bm.Snapshots == nil {
+		return fmt.Errorf("caching is not enabled for manager %v", bm.Name)
+	}
+
+	snap, err := bm.Snapshots.Get(id)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := bm.LockCopy()
+	if err != nil {
+		log.Errorf("Manager::RestoreSnapshot()[count=%v][manager=%v]: not restoring snapshot %v. err=%v", cmHandlerCounter, bm.Name, snap.ID, err.Error())
+		return err
+	}
+	defer unlock()
+
+	log.Warnf("Manager::RestoreSnapshot()[count=%v][manager=%v]: Restoring known good configurations from snapshot %v.", cmHandlerCounter, bm.Name, snap.ID)
+	if err := bm.Snapshots.Restore(snap); err != nil {
+		log.Errorf("Manager::RestoreSnapshot()[count=%v][manager=%v]: %v", cmHandlerCounter, bm.Name, err.Error())
+		metrics.SetButlerKnownGoodRestoredVal(metrics.FAILURE, bm.Name)
+		events.Emit(events.New(events.TypeRestore, bm.Name).WithSnapshot(snap.ID).WithError(err))
+		return err
+	}
+	// the copies of the files are restored along with them
+	install := bm.GetInstallOpts()
+	for file := range snap.Files {
+		if rel, err := filepath.Rel(bm.DestPath, file); err == nil {
+			syncFileCopies(file, bm.Name, install.ForFile(rel))
+		}
+	}
+	events.Emit(events.New(events.TypeRestore, bm.Name).WithSnapshot(snap.ID))
+	log.Warnf("Manager::RestoreSnapshot()[count=%v][manager=%v]: Done restoring known good configurations from snapshot %v.", cmHandlerCounter, bm.Name, snap.ID)
+	metrics.SetButlerKnownGoodCachedVal(metrics.FAILURE, bm.Name)
+	metrics.SetButlerKnownGoodRestoredVal(metrics.SUCCESS, bm.Name)
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestSnapshotStore(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bsnapshot")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	file := dir + "/prometheus.yml"
+	store := NewSnapshotStore("test-manager", dir+"/cache", 2)
+
+	snap, err := store.Latest()
+	c.Assert(err, IsNil)
+	c.Assert(snap, IsNil)
+
+	var ids []string
+	for _, data := range []string{"one\n", "two\n", "three\n"} {
+		c.Assert(ioutil.WriteFile(file, []byte(data), 0644), IsNil)
+		snap, err := store.Save([]string{file})
+		c.Assert(err, IsNil)
+		ids = append(ids, snap.ID)
+	}
+
+	// only the last two are retained, newest first
+	snaps, err := store.List()
+	c.Assert(err, IsNil)
+	c.Assert(len(snaps), Equals, 2)
+	c.Assert(snaps[0].ID, Equals, ids[2])
+	c.Assert(snaps[1].ID, Equals, ids[1])
+	_, err = store.Get(ids[0])
+	c.Assert(err, NotNil)
+	objects, err := ioutil.ReadDir(dir + "/cache/objects")
+	c.Assert(err, IsNil)
+	c.Assert(len(objects), Equals, 2)
+
+	// restore an older snapshot by id prefix
+	snap, err = store.Get(ids[1][:6])
+	c.Assert(err, IsNil)
+	c.Assert(store.Restore(snap), IsNil)
+	out, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "two\n")
+
+	// saving identical content re-uses the same snapshot id
+	again, err := store.Save([]string{file})
+	c.Assert(err, IsNil)
+	c.Assert(again.ID, Equals, ids[1])
+	latest, err := store.Latest()
+	c.Assert(err, IsNil)
+	c.Assert(latest.ID, Equals, ids[1])
+}
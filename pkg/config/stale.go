@@ -0,0 +1,85 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// butlerStarted is what the age of the config files of the managers which
+// have not had a successful run yet is measured from.
+var butlerStarted = time.Now()
+
+// ConfigAge returns how long ago at t the last successful run of the manager
+// was, or butler started when the manager has not had one, and whether that
+// is past its stale-threshold.
+func (bm *Manager) ConfigAge(t time.Time) (time.Duration, bool) {
+	since := GetRunStatus(bm.Name).LastSuccess
+	if since.IsZero() {
+		since = butlerStarted
+	}
+	age := t.Sub(since)
+	return age, bm.StaleThreshold > 0 && age > time.Duration(bm.StaleThreshold)*time.Second
+}
+
+// checkStale flags the managers whose last successful run is older than their
+// stale-threshold, so that a host running potentially stale config files is
+// noticed whatever the reason, eg: runs which keep failing, however
+// gracefully, a breaker which is open, or a manager which is paused. Becoming
+// stale, and no longer being stale, emits a stale event.
+func (bc *ButlerConfig) checkStale(t time.Time) {
+	if bc.Config == nil {
+		return
+	}
+	for _, m := range bc.Config.Managers {
+		age, stale := m.ConfigAge(t)
+		metrics.SetButlerConfigAge(m.Name, age)
+
+		runStatusLock.Lock()
+		s := runStatus(m.Name)
+		wasStale := s.StaleSince != nil
+		switch {
+		case stale && !wasStale:
+			since := t
+			s.StaleSince = &since
+		case !stale:
+			s.StaleSince = nil
+		}
+		runStatusLock.Unlock()
+
+		if !stale {
+			metrics.SetButlerStaleVal(metrics.FAILURE, m.Name)
+			if wasStale {
+				log.Infof("Config::checkStale()[count=%v][manager=%v]: config files are no longer stale.", cmHandlerCounter, m.Name)
+				events.Emit(events.New(events.TypeStale, m.Name).WithMessage("config files are no longer stale"))
+			}
+			continue
+		}
+		metrics.SetButlerStaleVal(metrics.SUCCESS, m.Name)
+		if !wasStale {
+			msg := fmt.Sprintf("config files are stale, the last successful run was %v ago", age.Truncate(time.Second))
+			if GetRunStatus(m.Name).LastSuccess.IsZero() {
+				msg = fmt.Sprintf("config files are stale, there was no successful run since butler started %v ago", age.Truncate(time.Second))
+			}
+			log.Warnf("Config::checkStale()[count=%v][manager=%v]: %v.", cmHandlerCounter, m.Name, msg)
+			events.Emit(events.New(events.TypeStale, m.Name).WithMessage(msg).WithError(errors.New(msg)))
+		}
+	}
+}
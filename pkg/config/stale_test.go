@@ -0,0 +1,63 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestStale(c *C) {
+	m := &Manager{Name: "stale-manager", StaleThreshold: 60}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{m.Name: m}}}
+	defer func() {
+		runStatusLock.Lock()
+		delete(runStatuses, m.Name)
+		runStatusLock.Unlock()
+	}()
+
+	// without a successful run the age is measured from when butler started
+	age, stale := m.ConfigAge(butlerStarted.Add(30 * time.Second))
+	c.Assert(age, Equals, 30*time.Second)
+	c.Assert(stale, Equals, false)
+	_, stale = m.ConfigAge(butlerStarted.Add(2 * time.Minute))
+	c.Assert(stale, Equals, true)
+
+	recordRun(m.Name, nil)
+	success := GetRunStatus(m.Name).LastSuccess
+	bc.checkStale(success.Add(30 * time.Second))
+	c.Assert(GetRunStatus(m.Name).StaleSince, IsNil)
+
+	// failed runs do not reset the age, so the config files become stale
+	recordRun(m.Name, errors.New("download failed"))
+	t := success.Add(2 * time.Minute)
+	bc.checkStale(t)
+	c.Assert(GetRunStatus(m.Name).StaleSince, NotNil)
+	c.Assert(GetRunStatus(m.Name).StaleSince.Equal(t), Equals, true)
+
+	// and stay stale since then
+	bc.checkStale(t.Add(time.Minute))
+	c.Assert(GetRunStatus(m.Name).StaleSince.Equal(t), Equals, true)
+
+	// until the next successful run
+	recordRun(m.Name, nil)
+	bc.checkStale(GetRunStatus(m.Name).LastSuccess)
+	c.Assert(GetRunStatus(m.Name).StaleSince, IsNil)
+
+	// a stale-threshold of 0 never flags them
+	m.StaleThreshold = 0
+	bc.checkStale(time.Now().Add(24 * time.Hour))
+	c.Assert(GetRunStatus(m.Name).StaleSince, IsNil)
+}
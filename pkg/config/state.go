@@ -0,0 +1,196 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ManagerState is the state of a manager which is kept in the status file, so
+// that a restarted butler carries on where it left off: the outcome of its
+// latest runs and reload, its rollback attempts, and the validators of its
+// downloaded files, which spare downloading unchanged files again.
+type ManagerState struct {
+	Run              *RunStatus                `json:"run,omitempty"`
+	LastReload       *time.Time                `json:"last-reload,omitempty"`
+	RollbackAttempts int                       `json:"rollback-attempts,omitempty"`
+	Downloads        map[string]*DownloadState `json:"downloads,omitempty"`
+}
+
+// DownloadState is made of the cache validators of the latest download of a
+// file, and the sha256 of the copy of the file in the download cache.
+type DownloadState struct {
+	methods.Validators
+	Sum string `json:"sum"`
+}
+
+var (
+	// downloadStates are keyed by manager name, and then by the downloadKey
+	// of the url. The files of the managers are downloaded concurrently.
+	downloadStates    = make(map[string]map[string]*DownloadState)
+	downloadStateLock sync.Mutex
+
+	// restoredStates are the managers whose state has been restored from the
+	// status file. It is protected by cmHandlerLock.
+	restoredStates = make(map[string]bool)
+)
+
+// downloadKey returns the key of the url in the download cache. The url is
+// hashed, as it may carry credentials.
+func downloadKey(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+func (bmo *ManagerOpts) downloadCachePath(file string) string {
+	return filepath.Join(bmo.downloadCache, downloadKey(file))
+}
+
+// cachedDownload returns the state of the latest download of the file, as
+// long as its copy in the download cache is intact.
+func (bmo *ManagerOpts) cachedDownload(file string) *DownloadState {
+	if bmo.downloadCache == "" {
+		return nil
+	}
+	downloadStateLock.Lock()
+	state := downloadStates[bmo.parentManager][downloadKey(file)]
+	downloadStateLock.Unlock()
+	if state == nil {
+		return nil
+	}
+	sum, err := fileChecksum(bmo.downloadCachePath(file))
+	if err != nil || hex.EncodeToString(sum) != state.Sum {
+		log.Debugf("ManagerOpts::cachedDownload()[count=%v][manager=%v]: cached copy of %v is missing or modified.", cmHandlerCounter, bmo.parentManager, RedactURL(file))
+		return nil
+	}
+	return state
+}
+
+// cacheDownload keeps a copy of the downloaded file in the download cache,
+// along with its validators. A file which came without validators cannot be
+// downloaded conditionally, and is not cached.
+func (bmo *ManagerOpts) cacheDownload(file string, src string, v methods.Validators) error {
+	if bmo.downloadCache == "" {
+		return nil
+	}
+	key := downloadKey(file)
+	if v.IsZero() {
+		downloadStateLock.Lock()
+		delete(downloadStates[bmo.parentManager], key)
+		downloadStateLock.Unlock()
+		os.Remove(bmo.downloadCachePath(file))
+		return nil
+	}
+
+	// the files may carry secrets
+	if err := os.MkdirAll(bmo.downloadCache, 0700); err != nil {
+		return err
+	}
+	opts := NewInstallOpts()
+	opts.Perms.Mode = 0600
+	if err := CopyBinaryFile(src, bmo.downloadCachePath(file), opts); err != nil {
+		return err
+	}
+	sum, err := fileChecksum(bmo.downloadCachePath(file))
+	if err != nil {
+		return err
+	}
+
+	downloadStateLock.Lock()
+	defer downloadStateLock.Unlock()
+	if downloadStates[bmo.parentManager] == nil {
+		downloadStates[bmo.parentManager] = make(map[string]*DownloadState)
+	}
+	downloadStates[bmo.parentManager][key] = &DownloadState{Validators: v, Sum: hex.EncodeToString(sum)}
+	return nil
+}
+
+// copyCachedDownload copies the cached copy of the file to dst.
+func (bmo *ManagerOpts) copyCachedDownload(file string, dst io.Writer) (int64, error) {
+	f, err := os.Open(bmo.downloadCachePath(file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(dst, f)
+}
+
+// managerState returns the state of the manager which is to be kept in the
+// status file. It is protected by cmHandlerLock.
+func managerState(m *Manager) *ManagerState {
+	res := &ManagerState{RollbackAttempts: m.RollbackAttempts}
+	if run := GetRunStatus(m.Name); !run.LastRun.IsZero() || run.LastReload != nil {
+		res.Run = &run
+	}
+	if last, ok := lastReloads[m.Name]; ok {
+		res.LastReload = &last
+	}
+
+	downloadStateLock.Lock()
+	defer downloadStateLock.Unlock()
+	if len(downloadStates[m.Name]) > 0 {
+		res.Downloads = make(map[string]*DownloadState)
+		for k, v := range downloadStates[m.Name] {
+			d := *v
+			res.Downloads[k] = &d
+		}
+	}
+	return res
+}
+
+// saveState keeps the state of the manager in the status file.
+func (bc *ButlerConfig) saveState(m *Manager) {
+	if err := SetManagerState(bc.GetStatusFile(), m.Name, managerState(m)); err != nil {
+		log.Errorf("Config::saveState()[count=%v][manager=%v]: could not write to %v err=%v", cmHandlerCounter, m.Name, bc.GetStatusFile(), err.Error())
+	}
+}
+
+// restoreState restores the state of the manager from the status file before
+// its first run, eg: after butler has been restarted. The rollback attempts
+// are restored along with the manager. It is protected by cmHandlerLock.
+func (bc *ButlerConfig) restoreState(m *Manager) {
+	if restoredStates[m.Name] {
+		return
+	}
+	restoredStates[m.Name] = true
+	state := GetManagerState(bc.GetStatusFile(), m.Name)
+	if state == nil {
+		return
+	}
+	log.Debugf("Config::restoreState()[count=%v][manager=%v]: restoring state from %v.", cmHandlerCounter, m.Name, bc.GetStatusFile())
+
+	runStatusLock.Lock()
+	if _, ok := runStatuses[m.Name]; !ok && state.Run != nil {
+		s := *state.Run
+		runStatuses[m.Name] = &s
+	}
+	runStatusLock.Unlock()
+	if _, ok := lastReloads[m.Name]; !ok && state.LastReload != nil {
+		lastReloads[m.Name] = *state.LastReload
+	}
+	downloadStateLock.Lock()
+	if _, ok := downloadStates[m.Name]; !ok && state.Downloads != nil {
+		downloadStates[m.Name] = state.Downloads
+	}
+	downloadStateLock.Unlock()
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestDownloadCache(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bdownloads")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var gets, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("#butlerstart\nfoo: bar\n#butlerend\n"))
+	}))
+	defer server.Close()
+
+	method, err := methods.NewHTTPMethod(nil, nil)
+	c.Assert(err, IsNil)
+	opts := &ManagerOpts{Method: "http", Repo: "localhost", Opts: method}
+	opts.SetParentManager("download-manager")
+	opts.SetDownloadCache(dir)
+	defer func() { delete(downloadStates, "download-manager") }()
+	file := server.URL + "/prometheus.yml"
+
+	read := func() string {
+		f := opts.DownloadConfigFile(context.Background(), file)
+		c.Assert(f, NotNil)
+		defer os.Remove(f.Name())
+		data, err := ioutil.ReadFile(f.Name())
+		c.Assert(err, IsNil)
+		return string(data)
+	}
+
+	// the file is only downloaded again once it has changed
+	c.Assert(read(), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(read(), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(gets, Equals, 2)
+	c.Assert(notModified, Equals, 1)
+
+	// a modified cached copy is not used
+	c.Assert(ioutil.WriteFile(opts.downloadCachePath(file), []byte("modified"), 0600), IsNil)
+	c.Assert(read(), Equals, "#butlerstart\nfoo: bar\n#butlerend\n")
+	c.Assert(notModified, Equals, 1)
+
+	fi, err := os.Stat(opts.downloadCachePath(file))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0600))
+}
+
+func (s *ConfigTestSuite) TestManagerState(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bstate")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	mgr := &Manager{Name: "state-manager", RollbackAttempts: 2}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{mgr.Name: mgr}}}
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	c.Assert(SetManagerStatus(bc.GetStatusFile(), mgr.Name, true), IsNil)
+	c.Assert(GetManagerState(bc.GetStatusFile(), mgr.Name), IsNil)
+
+	cmHandlerLock.Lock()
+	defer cmHandlerLock.Unlock()
+	reloaded := time.Now().Add(-time.Minute)
+	lastReloads[mgr.Name] = reloaded
+	recordRun(mgr.Name, errors.New("could not download file"))
+	downloadStates[mgr.Name] = map[string]*DownloadState{downloadKey("http://localhost/a.yml"): {Validators: methods.Validators{ETag: `"v1"`}, Sum: "abc"}}
+	bc.saveState(mgr)
+
+	// the state is kept alongside the status of the manager
+	c.Assert(GetManagerStatus(bc.GetStatusFile(), mgr.Name), Equals, true)
+	state := GetManagerState(bc.GetStatusFile(), mgr.Name)
+	c.Assert(state, NotNil)
+	c.Assert(state.RollbackAttempts, Equals, 2)
+	c.Assert(state.Run.LastError, Equals, "could not download file")
+
+	// a restarted butler picks up where it left off
+	delete(lastReloads, mgr.Name)
+	delete(runStatuses, mgr.Name)
+	delete(downloadStates, mgr.Name)
+	delete(restoredStates, mgr.Name)
+	defer func() {
+		delete(lastReloads, mgr.Name)
+		delete(runStatuses, mgr.Name)
+		delete(downloadStates, mgr.Name)
+		delete(restoredStates, mgr.Name)
+	}()
+	bc.restoreState(mgr)
+	c.Assert(lastReloads[mgr.Name].Equal(reloaded), Equals, true)
+	c.Assert(GetRunStatus(mgr.Name).LastError, Equals, "could not download file")
+	c.Assert(downloadStates[mgr.Name][downloadKey("http://localhost/a.yml")].ETag, Equals, `"v1"`)
+
+	// and only restores it once
+	recordRun(mgr.Name, nil)
+	bc.restoreState(mgr)
+	c.Assert(GetRunStatus(mgr.Name).LastError, Equals, "")
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusFileVersion is the version of the format of the status file. The
+// first format only had the manager map, which is still written for the
+// readers of the status file which predate the structured status records.
+const StatusFileVersion = 2
+
+// The status of a manager in its StatusRecord.
+const (
+	// StatusOK is the status of a manager which runs on its current files.
+	StatusOK = "ok"
+	// StatusRestored is the status of a manager which runs on known good
+	// files which have been restored from a snapshot, after a failed reload
+	// or by a rollback.
+	StatusRestored = "restored"
+	// StatusPending is the status of a manager which is due a reload, eg:
+	// the reload has been deferred, or the manager has been paused.
+	StatusPending = "pending"
+	// StatusFailed is the status of a manager whose latest reload failed.
+	StatusFailed = "failed"
+)
+
+var (
+	// DefaultStatusHistory is the number of status changes which are kept
+	// in the StatusRecord of each manager.
+	DefaultStatusHistory = 10
+)
+
+type Status struct {
+	Version  int                      `json:"version,omitempty"`
+	Manager  map[string]bool          `json:"manager"`
+	Managers map[string]*StatusRecord `json:"managers,omitempty"`
+	Paused   map[string]*PauseState   `json:"paused,omitempty"`
+	State    map[string]*ManagerState `json:"state,omitempty"`
+}
+
+// StatusRecord is the status of a manager which is kept in the status file:
+// whether it runs on its current files, when that last changed, the error of
+// its latest failed reload, the content address of the files it last
+// reloaded successfully (see Snapshots), and how many reloads in a row have
+// failed. History holds the latest changes of the status, oldest first.
+type StatusRecord struct {
+	Status              string        `json:"status"`
+	Updated             time.Time     `json:"updated"`
+	LastSuccess         *time.Time    `json:"last-success,omitempty"`
+	LastFailure         *time.Time    `json:"last-failure,omitempty"`
+	LastError           string        `json:"last-error,omitempty"`
+	ConfigVersion       string        `json:"config-version,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive-failures"`
+	History             []StatusEvent `json:"history,omitempty"`
+}
+
+// StatusEvent is a change of the status of a manager.
+type StatusEvent struct {
+	Time          time.Time `json:"time"`
+	Status        string    `json:"status"`
+	ConfigVersion string    `json:"config-version,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// statusFileLock serializes the updates of the status file, which are read,
+// modified and written back.
+var statusFileLock sync.Mutex
+
+// PauseState records that a manager has been paused through the admin
+// endpoint, and by whom. It is kept in the status file so that the manager
+// stays paused across restarts of butler.
+type PauseState struct {
+	Since  time.Time `json:"since"`
+	Actor  string    `json:"actor,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func ReadManagerStatusFile(statusFile string) (*Status, error) {
+	var (
+		status Status
+	)
+
+	out, err := ioutil.ReadFile(statusFile)
+	if err != nil {
+		return &status, err
+	}
+
+	err = json.Unmarshal(out, &status)
+	if err != nil {
+		return &status, err
+	}
+
+	// a status file of the first format only has the manager map
+	for name, ok := range status.Manager {
+		if _, found := status.Managers[name]; found {
+			continue
+		}
+		if status.Managers == nil {
+			status.Managers = make(map[string]*StatusRecord)
+		}
+		r := &StatusRecord{Status: StatusPending}
+		if ok {
+			r.Status = StatusOK
+		}
+		status.Managers[name] = r
+	}
+	return &status, nil
+}
+
+func WriteManagerStatusFile(statusFile string, status Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(statusFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetManagerStatus(statusFile string, manager string) bool {
+	status, err := ReadManagerStatusFile(statusFile)
+	if err != nil {
+		log.Debugf("GetManagerStatus(): could not read manager %v, returning false", statusFile)
+		return false
+	}
+
+	if val, ok := status.Manager[manager]; ok {
+		log.Debugf("GetManagerStatus(): found key for %v, returning %v", manager, val)
+		return val
+	} else {
+		log.Debugf("GetManagerStatus(): could not find key entry for %v, returning false", manager)
+		return false
+	}
+}
+
+// SetManagerStatus records the manager as running on its current files, or
+// as due a reload when state is false.
+func SetManagerStatus(statusFile string, manager string, state bool) error {
+	if state {
+		return RecordManagerStatus(statusFile, manager, StatusOK, "", nil)
+	}
+	return RecordManagerStatus(statusFile, manager, StatusPending, "", nil)
+}
+
+// RecordManagerStatus records the status of the manager in the status file.
+// version is the content address of the files the manager runs on, which is
+// left as is when empty, and err is the error of a failed reload.
+func RecordManagerStatus(statusFile string, manager string, state string, version string, err error) error {
+	statusFileLock.Lock()
+	defer statusFileLock.Unlock()
+	status, rerr := ReadManagerStatusFile(statusFile)
+	if (rerr != nil) || (status.Manager == nil) {
+		status.Manager = make(map[string]bool)
+	}
+	if status.Managers == nil {
+		status.Managers = make(map[string]*StatusRecord)
+	}
+	status.Version = StatusFileVersion
+	status.Manager[manager] = state == StatusOK || state == StatusRestored
+
+	r, ok := status.Managers[manager]
+	if !ok {
+		r = &StatusRecord{}
+		status.Managers[manager] = r
+	}
+	if version == "" {
+		version = r.ConfigVersion
+	}
+	now := time.Now()
+	event := StatusEvent{Time: now, Status: state, ConfigVersion: version}
+	changed := r.Status != state || r.ConfigVersion != version
+	r.Status = state
+	r.Updated = now
+	r.ConfigVersion = version
+	switch state {
+	case StatusOK:
+		r.LastSuccess = &now
+		r.ConsecutiveFailures = 0
+	case StatusFailed:
+		r.LastFailure = &now
+		r.ConsecutiveFailures++
+		if err != nil {
+			r.LastError = err.Error()
+			event.Error = r.LastError
+		}
+		changed = true
+	}
+	if changed {
+		r.History = append(r.History, event)
+		if len(r.History) > DefaultStatusHistory {
+			r.History = r.History[len(r.History)-DefaultStatusHistory:]
+		}
+	}
+
+	return WriteManagerStatusFile(statusFile, *status)
+}
+
+// GetManagerStatusRecord returns the status record of the manager, or nil
+// when the status file has none.
+func GetManagerStatusRecord(statusFile string, manager string) *StatusRecord {
+	status, err := ReadManagerStatusFile(statusFile)
+	if err != nil {
+		log.Debugf("GetManagerStatusRecord(): could not read manager %v, returning nil", statusFile)
+		return nil
+	}
+	return status.Managers[manager]
+}
+
+// GetManagerPaused returns the pause state of the manager, or nil when the
+// manager is not paused.
+func GetManagerPaused(statusFile string, manager string) *PauseState {
+	status, err := ReadManagerStatusFile(statusFile)
+	if err != nil {
+		log.Debugf("GetManagerPaused(): could not read manager %v, returning nil", statusFile)
+		return nil
+	}
+	return status.Paused[manager]
+}
+
+// SetManagerPaused pauses the manager with the pause state, or resumes it when
+// state is nil.
+func SetManagerPaused(statusFile string, manager string, state *PauseState) error {
+	statusFileLock.Lock()
+	defer statusFileLock.Unlock()
+	status, err := ReadManagerStatusFile(statusFile)
+	if (err != nil) || (status.Manager == nil) {
+		status.Manager = make(map[string]bool)
+	}
+	if status.Paused == nil {
+		status.Paused = make(map[string]*PauseState)
+	}
+
+	if state == nil {
+		delete(status.Paused, manager)
+	} else {
+		status.Paused[manager] = state
+	}
+
+	return WriteManagerStatusFile(statusFile, *status)
+}
+
+// GetManagerState returns the state of the manager which was kept in the
+// status file, or nil when there is none.
+func GetManagerState(statusFile string, manager string) *ManagerState {
+	status, err := ReadManagerStatusFile(statusFile)
+	if err != nil {
+		log.Debugf("GetManagerState(): could not read manager %v, returning nil", statusFile)
+		return nil
+	}
+	return status.State[manager]
+}
+
+// SetManagerState keeps the state of the manager in the status file.
+func SetManagerState(statusFile string, manager string, state *ManagerState) error {
+	statusFileLock.Lock()
+	defer statusFileLock.Unlock()
+	status, err := ReadManagerStatusFile(statusFile)
+	if (err != nil) || (status.Manager == nil) {
+		status.Manager = make(map[string]bool)
+	}
+	if status.State == nil {
+		status.State = make(map[string]*ManagerState)
+	}
+	status.State[manager] = state
+
+	return WriteManagerStatusFile(statusFile, *status)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestPauseResume(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bpause")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var reloads [][]string
+	mgr := &Manager{Name: "pause-manager", ReloadDebounce: 60, Reloader: countingReloader{reloads: &reloads}}
+	bc := &ButlerConfig{Config: &ConfigSettings{Managers: map[string]*Manager{mgr.Name: mgr}}}
+	bc.Config.Globals.StatusFile = dir + "/butler.status"
+	c.Assert(SetManagerStatus(bc.GetStatusFile(), mgr.Name, true), IsNil)
+
+	_, err = bc.Pause("unknown", "", "testing")
+	c.Assert(err, NotNil)
+	c.Assert(bc.Resume("unknown", "testing"), NotNil)
+
+	// a pending reload is dropped, and happens on the first run after the
+	// manager is resumed instead
+	cmHandlerLock.Lock()
+	mgr.ChangedFiles = []string{"/a.yml"}
+	bc.scheduleReload(mgr)
+	cmHandlerLock.Unlock()
+
+	state, err := bc.Pause(mgr.Name, "INC-1234", "testing")
+	c.Assert(err, IsNil)
+	c.Assert(state.Reason, Equals, "INC-1234")
+	c.Assert(state.Actor, Equals, "testing")
+	_, pending := pendingReloads[mgr.Name]
+	c.Assert(pending, Equals, false)
+	c.Assert(GetManagerStatus(bc.GetStatusFile(), mgr.Name), Equals, false)
+
+	// the pause is kept in the status file, and pausing again keeps it as is
+	paused := GetManagerPaused(bc.GetStatusFile(), mgr.Name)
+	c.Assert(paused, NotNil)
+	c.Assert(paused.Since.Equal(state.Since), Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	again, err := bc.Pause(mgr.Name, "other", "testing")
+	c.Assert(err, IsNil)
+	c.Assert(again.Reason, Equals, "INC-1234")
+
+	c.Assert(bc.Resume(mgr.Name, "testing"), IsNil)
+	c.Assert(GetManagerPaused(bc.GetStatusFile(), mgr.Name), IsNil)
+	c.Assert(bc.Resume(mgr.Name, "testing"), IsNil)
+	c.Assert(len(reloads), Equals, 0)
+}
+
+func (s *ConfigTestSuite) TestRecordManagerStatus(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bstatus")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	statusFile := dir + "/butler.status"
+
+	// a status file of the first format is upgraded as it is read
+	c.Assert(ioutil.WriteFile(statusFile, []byte(`{"manager":{"prometheus":true,"alertmanager":false}}`), 0644), IsNil)
+	c.Assert(GetManagerStatusRecord(statusFile, "prometheus").Status, Equals, StatusOK)
+	c.Assert(GetManagerStatusRecord(statusFile, "alertmanager").Status, Equals, StatusPending)
+
+	c.Assert(RecordManagerStatus(statusFile, "prometheus", StatusFailed, "", errors.New("reload failed")), IsNil)
+	c.Assert(RecordManagerStatus(statusFile, "prometheus", StatusFailed, "", errors.New("reload failed again")), IsNil)
+	c.Assert(RecordManagerStatus(statusFile, "prometheus", StatusRestored, "abc", nil), IsNil)
+	r := GetManagerStatusRecord(statusFile, "prometheus")
+	c.Assert(r.Status, Equals, StatusRestored)
+	c.Assert(r.ConsecutiveFailures, Equals, 2)
+	c.Assert(r.LastError, Equals, "reload failed again")
+	c.Assert(r.ConfigVersion, Equals, "abc")
+	c.Assert(r.LastFailure, NotNil)
+	c.Assert(len(r.History), Equals, 3)
+
+	// the manager map is still written for the existing readers
+	c.Assert(GetManagerStatus(statusFile, "prometheus"), Equals, true)
+	c.Assert(SetManagerStatus(statusFile, "prometheus", false), IsNil)
+	c.Assert(GetManagerStatus(statusFile, "prometheus"), Equals, false)
+	data, err := ioutil.ReadFile(statusFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `\{"version":2,"manager":\{"alertmanager":false,"prometheus":false\},"managers":.*`)
+
+	// a success resets the failures, and the history is capped
+	for i := 0; i < DefaultStatusHistory; i++ {
+		c.Assert(RecordManagerStatus(statusFile, "prometheus", StatusOK, fmt.Sprintf("v%d", i), nil), IsNil)
+	}
+	r = GetManagerStatusRecord(statusFile, "prometheus")
+	c.Assert(r.ConsecutiveFailures, Equals, 0)
+	c.Assert(r.LastSuccess, NotNil)
+	c.Assert(r.ConfigVersion, Equals, fmt.Sprintf("v%d", DefaultStatusHistory-1))
+	c.Assert(len(r.History), Equals, DefaultStatusHistory)
+	c.Assert(r.History[0].ConfigVersion, Equals, "v0")
+}
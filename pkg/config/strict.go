@@ -0,0 +1,521 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/healthchecks"
+	"github.com/adobe/butler/internal/leader"
+	"github.com/adobe/butler/internal/validators"
+	"github.com/adobe/butler/pkg/destinations"
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	"github.com/pelletier/go-toml"
+)
+
+// The options of each method of the sections which pick their options by
+// method, which the strict parsing checks the keys of. The options of the
+// repository methods are decoded by viper, the others from json.
+var (
+	strictRepoMethods = map[string]interface{}{
+		"http":  methods.HTTPMethod{},
+		"https": methods.HTTPMethod{},
+		"s3":    methods.S3Method{},
+		"blob":  methods.BlobMethod{},
+		"etcd":  methods.EtcdMethod{},
+		"file":  methods.FileMethod{},
+	}
+	strictReloaders = map[string]interface{}{
+		"http":            reloaders.HTTPReloaderOpts{},
+		"https":           reloaders.HTTPReloaderOpts{},
+		"exec":            reloaders.ExecReloaderOpts{},
+		"signal":          reloaders.SignalReloaderOpts{},
+		"systemd":         reloaders.SystemdReloaderOpts{},
+		"windows-service": reloaders.WindowsServiceReloaderOpts{},
+		"docker":          reloaders.DockerReloaderOpts{},
+		"kubernetes":      reloaders.KubernetesReloaderOpts{},
+	}
+	strictValidators = map[string]interface{}{
+		"exec":             validators.ExecValidatorOpts{},
+		"prometheus-rules": validators.PrometheusValidatorOpts{},
+		"alertmanager":     validators.PrometheusValidatorOpts{},
+	}
+	strictHealthChecks = map[string]interface{}{
+		"http":  healthchecks.HTTPHealthCheckOpts{},
+		"https": healthchecks.HTTPHealthCheckOpts{},
+		"exec":  healthchecks.ExecHealthCheckOpts{},
+	}
+	strictNotifiers = map[string]interface{}{
+		"webhook":   events.WebhookNotifierOpts{},
+		"slack":     events.SlackNotifierOpts{},
+		"pagerduty": events.PagerDutyNotifierOpts{},
+		"sns":       events.SNSNotifierOpts{},
+		"sqs":       events.SQSNotifierOpts{},
+	}
+	strictDestinations = map[string]interface{}{
+		"kubernetes": destinations.KubernetesDestinationOpts{},
+		"consul":     destinations.ConsulDestinationOpts{},
+	}
+	strictLeaders = map[string]interface{}{
+		"file":   leader.FileLockOpts{},
+		"etcd":   leader.EtcdLockOpts{},
+		"consul": leader.ConsulLockOpts{},
+	}
+)
+
+// The keys which the tables of the butler configuration must have, besides
+// the method of the sections which pick their options by method. A repo also
+// needs a primary-config, unless it has file-groups.
+var (
+	strictRequiredGlobals  = []string{"config-managers"}
+	strictRequiredManager  = []string{"repos", "dest-path"}
+	strictRequiredRepo     = []string{"method"}
+	strictRequiredSettings = []string{"globals"}
+)
+
+// strictProblem is something the strict parsing rejects, at the path of the
+// key it is about.
+type strictProblem struct {
+	path    []string
+	message string
+	// where the problem is, the line is 0 when it could not be located
+	source    int
+	line, col int
+}
+
+// strictChecker checks the settings of a butler configuration, as read by
+// viper, against the options butler knows of. Unlike the parsing, which
+// ignores the keys it does not know, eg: a misspelled retry-wiat, and turns a
+// single value into a list, it rejects unknown keys, missing required keys,
+// and values of the wrong type. The sources are the documents the butler
+// configuration has been put together from, which tell where each problem is.
+type strictChecker struct {
+	sources  []configFragment
+	problems []strictProblem
+}
+
+// checkStrict checks the settings of the butler configuration, whose managers
+// are listed, and returns an error which lists every problem along with its
+// line and column.
+func checkStrict(settings map[string]interface{}, managers []string, sources []configFragment) error {
+	s := &strictChecker{sources: sources}
+	s.checkSettings(settings, managers)
+	if len(s.problems) == 0 {
+		return nil
+	}
+
+	// the problems are listed in the order of the sources, then of their
+	// positions, and last come those which could not be located
+	for i := range s.problems {
+		s.locate(&s.problems[i])
+	}
+	sort.SliceStable(s.problems, func(i, j int) bool {
+		a, b := s.problems[i], s.problems[j]
+		if (a.line == 0) != (b.line == 0) {
+			return a.line != 0
+		}
+		if a.source != b.source {
+			return a.source < b.source
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.col < b.col
+	})
+
+	var msgs []string
+	for _, p := range s.problems {
+		switch {
+		case p.line == 0:
+			msgs = append(msgs, p.message)
+		case s.sources[p.source].Name == "":
+			msgs = append(msgs, fmt.Sprintf("line %d, column %d: %v", p.line, p.col, p.message))
+		default:
+			msgs = append(msgs, fmt.Sprintf("%v line %d, column %d: %v", s.sources[p.source].Name, p.line, p.col, p.message))
+		}
+	}
+	return fmt.Errorf("strict parsing failed: %v", strings.Join(msgs, "; "))
+}
+
+func (s *strictChecker) problem(path []string, format string, args ...interface{}) {
+	s.problems = append(s.problems, strictProblem{path: path, message: fmt.Sprintf(format, args...)})
+}
+
+func (s *strictChecker) unknown(path []string) {
+	s.problem(path, "unknown key %v", strings.Join(path, "."))
+}
+
+func (s *strictChecker) checkSettings(settings map[string]interface{}, managers []string) {
+	for _, k := range strictRequiredSettings {
+		if _, ok := settings[k]; !ok {
+			s.problem(nil, "missing required key %v", k)
+		}
+	}
+	for _, k := range sortedKeys(settings) {
+		path := []string{k}
+		switch {
+		case k == "globals":
+			if s.checkValue(path, settings[k], reflect.TypeOf(ConfigGlobals{}), "mapstructure") {
+				s.required(path, settings[k], strictRequiredGlobals...)
+			}
+		case k == "notify":
+			s.checkMethods(path, settings[k], strictNotifiers)
+		case k == "leader":
+			s.checkMethods(path, settings[k], strictLeaders, "ttl", "id")
+		case k == "rollout":
+			s.checkMethods(path, settings[k], strictLeaders, "max-unavailable", "ttl", "wait", "id")
+		case containsString(managers, k):
+			s.checkManager(path, settings[k])
+		default:
+			s.problem(path, "unknown key %v, which is not one of the globals.config-managers", k)
+		}
+	}
+}
+
+func (s *strictChecker) checkManager(path []string, v interface{}) {
+	m, ok := s.table(path, v)
+	if !ok {
+		return
+	}
+	keys := structKeys(reflect.TypeOf(Manager{}), "mapstructure")
+	repos := stringValues(m["repos"])
+	for _, k := range sortedKeys(m) {
+		kpath := appendPath(path, k)
+		switch {
+		// the file groups have reloader and validator sections, which
+		// are not part of the FileGroup
+		case k == "file-groups":
+			if groups, ok := s.table(kpath, m[k]); ok {
+				for _, g := range sortedKeys(groups) {
+					s.checkFileGroup(appendPath(kpath, g), groups[g])
+				}
+			}
+		case keys[k] != nil:
+			s.checkValue(kpath, m[k], keys[k], "mapstructure")
+		case containsString(repos, k):
+			s.checkRepo(kpath, m[k])
+		case k == "reloader":
+			s.checkMethods(kpath, m[k], strictReloaders, "continue-on-error")
+		case k == "reloader-groups":
+			if groups, ok := s.table(kpath, m[k]); ok {
+				for _, g := range sortedKeys(groups) {
+					s.checkMethods(appendPath(kpath, g), groups[g], strictReloaders, "files", "continue-on-error")
+				}
+			}
+		case k == "validator" || k == "post-validator":
+			s.checkMethods(kpath, m[k], strictValidators)
+		case k == "health-check":
+			s.checkMethods(kpath, m[k], strictHealthChecks, "timeout", "interval")
+		case k == "destination":
+			s.checkMethods(kpath, m[k], strictDestinations)
+		default:
+			s.unknown(kpath)
+		}
+	}
+	s.required(path, m, strictRequiredManager...)
+}
+
+func (s *strictChecker) checkRepo(path []string, v interface{}) {
+	m, ok := s.table(path, v)
+	if !ok {
+		return
+	}
+	keys := structKeys(reflect.TypeOf(ManagerOpts{}), "mapstructure")
+	method := fmt.Sprintf("%v", m["method"])
+	for _, k := range sortedKeys(m) {
+		kpath := appendPath(path, k)
+		switch {
+		case keys[k] != nil:
+			s.checkValue(kpath, m[k], keys[k], "mapstructure")
+		case k == method && strictRepoMethods[k] != nil:
+			s.checkValue(kpath, m[k], reflect.TypeOf(strictRepoMethods[k]), "mapstructure")
+		case k == method && methods.IsPlugin(k):
+			// the options of a plugin are up to the plugin
+			s.table(kpath, m[k])
+		default:
+			s.unknown(kpath)
+		}
+	}
+	s.required(path, m, strictRequiredRepo...)
+	if _, ok := m["file-groups"]; !ok {
+		s.required(path, m, "primary-config")
+	}
+}
+
+// checkFileGroup checks a file group of a manager, which has its own
+// reloader and validator sections.
+func (s *strictChecker) checkFileGroup(path []string, v interface{}) {
+	m, ok := s.table(path, v)
+	if !ok {
+		return
+	}
+	keys := structKeys(reflect.TypeOf(FileGroup{}), "mapstructure")
+	for _, k := range sortedKeys(m) {
+		kpath := appendPath(path, k)
+		switch {
+		case keys[k] != nil:
+			s.checkValue(kpath, m[k], keys[k], "mapstructure")
+		case k == "reloader":
+			s.checkMethods(kpath, m[k], strictReloaders, "continue-on-error")
+		case k == "validator":
+			s.checkMethods(kpath, m[k], strictValidators)
+		default:
+			s.unknown(kpath)
+		}
+	}
+}
+
+// checkMethods checks a section which has the options of each of its methods
+// under the name of the method, such as a reloader. The extra keys are the
+// other options of the section.
+func (s *strictChecker) checkMethods(path []string, v interface{}, opts map[string]interface{}, extra ...string) {
+	m, ok := s.table(path, v)
+	if !ok {
+		return
+	}
+	if _, isTable := asTable(m["method"]); isTable {
+		s.problem(appendPath(path, "method"), "%v should be a value or a list, not a table", strings.Join(appendPath(path, "method"), "."))
+	}
+	methods := stringValues(m["method"])
+	for _, k := range sortedKeys(m) {
+		kpath := appendPath(path, k)
+		switch {
+		case k == "method" || containsString(extra, k):
+		case containsString(methods, k):
+			// the parsing rejects the methods it does not know
+			if t, ok := opts[k]; ok {
+				s.checkValue(kpath, m[k], reflect.TypeOf(t), "json")
+			}
+		default:
+			s.unknown(kpath)
+		}
+	}
+	s.required(path, m, "method")
+}
+
+// checkValue checks the value against the type of the field it is decoded
+// into, whose keys are named by the tag, and returns false when it is of the
+// wrong kind altogether.
+func (s *strictChecker) checkValue(path []string, v interface{}, t reflect.Type, tag string) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := strings.Join(path, ".")
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := s.table(path, v)
+		if !ok {
+			return false
+		}
+		keys := structKeys(t, tag)
+		for _, k := range sortedKeys(m) {
+			if keys[k] == nil {
+				s.unknown(appendPath(path, k))
+				continue
+			}
+			s.checkValue(appendPath(path, k), m[k], keys[k], tag)
+		}
+	case reflect.Map:
+		m, ok := s.table(path, v)
+		if !ok {
+			return false
+		}
+		for _, k := range sortedKeys(m) {
+			s.checkValue(appendPath(path, k), m[k], t.Elem(), tag)
+		}
+	case reflect.Slice, reflect.Array:
+		l, ok := v.([]interface{})
+		if !ok {
+			s.problem(path, "%v should be a list, not a %v", name, valueKind(v))
+			return false
+		}
+		for i, e := range l {
+			s.checkValue(appendPath(path, fmt.Sprintf("%d", i)), e, t.Elem(), tag)
+		}
+	default:
+		if kind := valueKind(v); kind != "value" {
+			s.problem(path, "%v should be a value, not a %v", name, kind)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *strictChecker) table(path []string, v interface{}) (map[string]interface{}, bool) {
+	m, ok := asTable(v)
+	if !ok {
+		s.problem(path, "%v should be a table, not a %v", strings.Join(path, "."), valueKind(v))
+	}
+	return m, ok
+}
+
+func (s *strictChecker) required(path []string, v interface{}, keys ...string) {
+	m, _ := asTable(v)
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			s.problem(path, "%v is missing the required key %v", strings.Join(path, "."), k)
+		}
+	}
+}
+
+// locate sets where the key of the problem is, in the first of the sources
+// which has it, or else where the nearest of the tables it is in is.
+func (s *strictChecker) locate(p *strictProblem) {
+	for path := p.path; len(path) > 0; path = path[:len(path)-1] {
+		for i, src := range s.sources {
+			if line, col := keyPosition(src, path); line != 0 {
+				p.source, p.line, p.col = i, line, col
+				return
+			}
+		}
+	}
+}
+
+// keyPosition returns the line and column of the key in the source, or 0
+// when it is not there. The keys of a toml source are looked up in its tree,
+// those of the other formats are searched for, key after key.
+func keyPosition(src configFragment, path []string) (int, int) {
+	if ConfigFormat(src.Name, src.Data) == "toml" {
+		tree, err := toml.LoadBytes(src.Data)
+		if err != nil {
+			return 0, 0
+		}
+		for i, k := range path {
+			var found string
+			for _, key := range tree.Keys() {
+				if strings.EqualFold(key, k) {
+					found = key
+					break
+				}
+			}
+			if found == "" {
+				return 0, 0
+			}
+			if i == len(path)-1 {
+				pos := tree.GetPositionPath([]string{found})
+				return pos.Line, pos.Col
+			}
+			sub, ok := tree.GetPath([]string{found}).(*toml.Tree)
+			if !ok {
+				return 0, 0
+			}
+			tree = sub
+		}
+		return 0, 0
+	}
+
+	offset := 0
+	for _, k := range path {
+		re := regexp.MustCompile(`(?im)(?:^|[\s{,])["']?(` + regexp.QuoteMeta(k) + `)["']?\s*:`)
+		loc := re.FindSubmatchIndex(src.Data[offset:])
+		if loc == nil {
+			return 0, 0
+		}
+		offset += loc[2]
+	}
+	line := bytes.Count(src.Data[:offset], []byte("\n")) + 1
+	col := offset - bytes.LastIndex(src.Data[:offset], []byte("\n"))
+	return line, col
+}
+
+// structKeys returns the types of the options of the struct by their keys,
+// which are named by the tag. The fields which are not tagged are not
+// options, and the fields of the embedded structs are those of the struct.
+func structKeys(t reflect.Type, tag string) map[string]reflect.Type {
+	keys := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, ft := range structKeys(f.Type, tag) {
+				keys[k] = ft
+			}
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		keys[name] = f.Type
+	}
+	return keys
+}
+
+func asTable(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{})
+		for k, e := range m {
+			res[fmt.Sprintf("%v", k)] = e
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+func valueKind(v interface{}) string {
+	if _, ok := asTable(v); ok {
+		return "table"
+	}
+	if _, ok := v.([]interface{}); ok {
+		return "list"
+	}
+	return "value"
+}
+
+// stringValues returns a single value, or the values of a list, as strings.
+func stringValues(v interface{}) []string {
+	var res []string
+	switch l := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, e := range l {
+			res = append(res, fmt.Sprintf("%v", e))
+		}
+	default:
+		res = append(res, fmt.Sprintf("%v", l))
+	}
+	return res
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/adobe/butler/pkg/methods"
+	"github.com/adobe/butler/pkg/reloaders"
+
+	. "gopkg.in/check.v1"
+)
+
+// strictTestConfig returns the complete butler configuration, with the
+// optional sections of a manager, and with the replacements made.
+func strictTestConfig(replacements ...string) []byte {
+	s := string(TestConfigCompleteEnvironment) + `    [test-handler.hooks]
+      pre-copy = "/bin/true"
+    [test-handler.validator]
+      method = "exec"
+      [test-handler.validator.exec]
+        command = "/bin/true"
+    [test-handler.health-check]
+      method = "http"
+      timeout = "10"
+      [test-handler.health-check.http]
+        url = "http://localhost:9090/-/healthy"
+[notify]
+  method = "webhook"
+  [notify.webhook]
+    urls = ["http://localhost/hook"]
+[leader]
+  method = "file"
+  ttl = "30"
+  [leader.file]
+    path = "/var/lib/butler/leader.lock"
+[rollout]
+  method = "consul"
+  max-unavailable = "2"
+  [rollout.consul]
+    key = "butler/rollout"
+`
+	s = strings.NewReplacer(replacements...).Replace(s)
+	return wrapConfig(s)
+}
+
+func (s *ConfigTestSuite) TestStrict(c *C) {
+	c.Assert(CheckConfig("butler.toml", strictTestConfig(), "", true), IsNil)
+	c.Assert(CheckConfig("butler.yaml", wrapConfig(string(TestConfigCompleteEnvironmentYAML)), "", true), IsNil)
+	c.Assert(CheckConfig("butler.json", wrapConfig(string(TestConfigCompleteEnvironmentJSON)), "", true), IsNil)
+
+	// a misspelled option is ignored, unless the parsing is strict
+	config := strictTestConfig(`retry-wait-min = "5"`, `retry-wiat-min = "5"`)
+	c.Assert(CheckConfig("butler.toml", config, "", false), IsNil)
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.toml line 22, column 9: unknown key test-handler.localhost.http.retry-wiat-min; "+
+		"butler.toml line 36, column 9: unknown key test-handler.reloader.http.retry-wiat-min")
+
+	config = strictTestConfig(`url = "http`, `uri = "http`, `pre-copy`, `precopy`, `[notify]`, "[notify]\n  methods = \"slack\"")
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.toml line 40, column 7: unknown key test-handler.hooks.precopy; "+
+		"butler.toml line 49, column 9: unknown key test-handler.health-check.http.uri; "+
+		"butler.toml line 51, column 3: unknown key notify.methods")
+
+	// missing required keys are reported at their table
+	config = strictTestConfig(`primary-config = ["test.yml"]`, ``, "[test-handler.reloader]\n      method = \"http\"", "[test-handler.reloader]")
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.toml line 15, column 5: test-handler.localhost is missing the required key primary-config; "+
+		"butler.toml line 25, column 5: test-handler.reloader is missing the required key method; "+
+		"butler.toml line 26, column 7: unknown key test-handler.reloader.http")
+
+	// a single value is not a list, nor a list a value
+	config = strictTestConfig(`repos = ["localhost"]`, `repos = "localhost"`, `dest-path = "/opt/prometheus"`, `dest-path = ["/opt/prometheus"]`)
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.toml line 8, column 5: test-handler.repos should be a list, not a value; "+
+		"butler.toml line 13, column 5: test-handler.dest-path should be a value, not a list")
+
+	// a manager which is not listed is most likely a mistake
+	config = strictTestConfig(`config-managers = ["test-handler"]`, `config-managers = ["test-hanlder", "test-handler"]`)
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "(?s).*Cannot find manager for test-hanlder.*")
+	config = wrapConfig(string(TestConfigCompleteEnvironment) + "[test-handler2]\n  repos = []\n")
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.toml line 39, column 1: unknown key test-handler2, which is not one of the globals.config-managers")
+
+	// the keys of the other formats are searched for
+	config = wrapConfig(strings.Replace(string(TestConfigCompleteEnvironmentYAML), "  reloader:", "  reloder:", 1))
+	c.Assert(CheckConfig("butler.yaml", config, "", true), ErrorMatches, "strict parsing failed: "+
+		"butler.yaml line 25, column 3: unknown key test-handler.reloder")
+	settings := NewConfigSettings()
+	settings.Strict = true
+	config = []byte(strings.Replace(string(TestConfigCompleteEnvironmentJSON), `"timeout"`, `"timout"`, 1))
+	c.Assert(settings.ParseConfig(config), ErrorMatches, "strict parsing failed: line [0-9]+, column [0-9]+: unknown key test-handler.localhost.http.timout")
+}
+
+func (s *ConfigTestSuite) TestStrictPlugins(c *C) {
+	config := strictTestConfig("method = \"http\"\n      repo-path", "method = \"vault\"\n      repo-path",
+		"[test-handler.localhost.http]", "[test-handler.localhost.vault]",
+		"[test-handler.reloader]\n      method = \"http\"", "[test-handler.reloader]\n      method = \"nomad\"",
+		"[test-handler.reloader.http]", "[test-handler.reloader.nomad]")
+	c.Assert(CheckConfig("butler.toml", config, "", false), ErrorMatches, "(?s).*unknown manager.method=vault.*")
+	c.Assert(CheckConfig("butler.toml", config, "", true), ErrorMatches, "strict parsing failed: butler.toml line 20, column 7: unknown key test-handler.localhost.vault")
+
+	// the options of the plugins are up to the plugins
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "butler-method-vault"), []byte("#!/bin/sh\ncat\n"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "butler-reloader-nomad"), []byte("#!/bin/sh\ncat\n"), 0755), IsNil)
+	_, err := methods.LoadPlugins(dir)
+	c.Assert(err, IsNil)
+	_, err = reloaders.LoadPlugins(dir)
+	c.Assert(err, IsNil)
+	c.Assert(CheckConfig("butler.toml", config, "", true), IsNil)
+	c.Assert(schemaMethods(strictRepoMethods, methods.Plugins()), DeepEquals, []string{"blob", "etcd", "file", "http", "https", "s3", "vault"})
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adobe/butler/internal/events"
+	"github.com/adobe/butler/internal/metrics"
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RefreshSyncDirs lists the files underneath the sync-dirs of the repository,
+// and makes them part of the additional config files of the manager until
+// the next refresh. A sync-dir which can not be listed, or comes back empty,
+// is an error, since the files which are no longer upstream get deleted.
+func (bmo *ManagerOpts) RefreshSyncDirs() error {
+	var synced []string
+
+	if len(bmo.SyncDirs) == 0 {
+		return nil
+	}
+
+	lister, ok := bmo.Opts.(methods.Lister)
+	if !ok {
+		bmo.SyncedConfig = nil
+		return fmt.Errorf("repository method %v does not support sync-dirs", bmo.Method)
+	}
+
+	known := make(map[string]bool)
+	for _, f := range bmo.AdditionalConfig {
+		known[f] = true
+	}
+	for _, f := range bmo.PrimaryConfig {
+		known[f] = true
+	}
+	for _, f := range bmo.groupFiles {
+		known[f.file] = true
+	}
+	for _, f := range bmo.GlobbedConfig {
+		known[f] = true
+	}
+
+	for _, dir := range bmo.SyncDirs {
+		u, err := bmo.RemoteURL(fmt.Sprintf("%s/%s", bmo.baseRemotePath, dir))
+		if err != nil {
+			bmo.SyncedConfig = nil
+			return err
+		}
+		files, err := lister.List(u)
+		if err != nil {
+			bmo.SyncedConfig = nil
+			return fmt.Errorf("could not list sync-dir %v. err=%v", dir, err.Error())
+		}
+		if len(files) == 0 {
+			bmo.SyncedConfig = nil
+			return fmt.Errorf("sync-dir %v is empty upstream, refusing to sync it", dir)
+		}
+		for _, f := range files {
+			name := path.Join(dir, f)
+			if known[name] {
+				continue
+			}
+			known[name] = true
+			synced = append(synced, name)
+		}
+	}
+	sort.Strings(synced)
+	bmo.SyncedConfig = synced
+	return nil
+}
+
+// IsSyncExcluded returns true if the file, relative to the dest-path, matches
+// one of the sync-exclude patterns.
+func (bmo *ManagerOpts) IsSyncExcluded(name string) bool {
+	return MatchPatterns(bmo.SyncExclude, name)
+}
+
+// ReconcileSyncDirs removes the files underneath the local sync-dirs of the
+// manager which are no longer present upstream. Files which match the
+// sync-exclude patterns, or which are configured otherwise for the manager,
+// are never removed. It returns the number of files removed, which are also
+// added to the ChangedFiles of the manager.
+func (bm *Manager) ReconcileSyncDirs() int {
+	deleted := 0
+
+	known := make(map[string]bool)
+	for _, f := range bm.GetAllLocalPaths() {
+		known[filepath.Clean(f)] = true
+	}
+
+	for _, opts := range bm.ManagerOpts {
+		for _, dir := range opts.SyncDirs {
+			root := filepath.Join(bm.DestPath, dir)
+			filepath.Walk(root, func(file string, f os.FileInfo, err error) error {
+				if err != nil || !f.Mode().IsRegular() {
+					return nil
+				}
+				if known[file] {
+					return nil
+				}
+				rel, err := filepath.Rel(bm.DestPath, file)
+				if err != nil {
+					return nil
+				}
+				rel = filepath.ToSlash(rel)
+				// files still being installed, see InstallFile
+				if strings.HasPrefix(f.Name(), ".") && strings.Contains(f.Name(), ".butler-") {
+					return nil
+				}
+				if opts.IsSyncExcluded(rel) {
+					log.Debugf("Manager::ReconcileSyncDirs()[count=%v][manager=%v]: %v is excluded from sync, not removing.", cmHandlerCounter, bm.Name, file)
+					return nil
+				}
+				log.Infof("Manager::ReconcileSyncDirs()[count=%v][manager=%v]: %v is no longer upstream. removing.", cmHandlerCounter, bm.Name, file)
+				old, _ := ioutil.ReadFile(file)
+				if err := os.Remove(file); err != nil {
+					log.Errorf("Manager::ReconcileSyncDirs()[count=%v][manager=%v]: could not remove %v. err=%v", cmHandlerCounter, bm.Name, file, err.Error())
+					metrics.SetButlerWriteVal(metrics.FAILURE, metrics.GetStatsLabel(file))
+					return nil
+				}
+				e := events.New(events.TypeDelete, bm.Name).WithFile(file)
+				if d := bm.Diffs.Record(rel, old, nil, opts.IsBinary(rel)); d != nil {
+					e = e.WithHash(d.Hash)
+				}
+				events.Emit(e)
+				bm.ChangedFiles = append(bm.ChangedFiles, file)
+				deleted++
+				return nil
+			})
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestSyncDirs(c *C) {
+	src, err := ioutil.TempDir("/tmp", "bsyncsrc")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("/tmp", "bsyncdst")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dst)
+
+	c.Assert(os.MkdirAll(src+"/rules/team", 0755), IsNil)
+	c.Assert(ioutil.WriteFile(src+"/rules/a.yml", []byte("a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(src+"/rules/team/b.yml", []byte("b"), 0644), IsNil)
+	c.Assert(os.MkdirAll(src+"/empty", 0755), IsNil)
+
+	method, err := methods.NewFileMethod(nil, nil)
+	c.Assert(err, IsNil)
+	opts := &ManagerOpts{Method: "file", Repo: "localhost", Opts: method, SyncDirs: []string{"rules"}, SyncExclude: []string{"local-*.yml"}}
+	opts.SetBasePaths("file://localhost"+src, dst)
+	c.Assert(opts.RefreshSyncDirs(), IsNil)
+	c.Assert(opts.SyncedConfig, DeepEquals, []string{"rules/a.yml", "rules/team/b.yml"})
+	c.Assert(opts.GetAdditionalConfigURLs(), DeepEquals, []string{"file://localhost" + src + "/rules/a.yml", "file://localhost" + src + "/rules/team/b.yml"})
+	c.Assert(opts.GetAdditionalLocalConfigFiles(), DeepEquals, []string{dst + "/rules/a.yml", dst + "/rules/team/b.yml"})
+
+	// files which are no longer upstream are removed, unless excluded
+	c.Assert(os.MkdirAll(dst+"/rules/team", 0755), IsNil)
+	for _, f := range []string{"/rules/a.yml", "/rules/team/b.yml", "/rules/stale.yml", "/rules/local-override.yml", "/other.yml"} {
+		c.Assert(ioutil.WriteFile(dst+f, []byte("x"), 0644), IsNil)
+	}
+	mgr := &Manager{Name: "test-manager", DestPath: dst, ManagerOpts: map[string]*ManagerOpts{"test-manager.localhost": opts}}
+	c.Assert(mgr.ReconcileSyncDirs(), Equals, 1)
+	c.Assert(mgr.ChangedFiles, DeepEquals, []string{dst + "/rules/stale.yml"})
+	_, err = os.Stat(dst + "/rules/stale.yml")
+	c.Assert(os.IsNotExist(err), Equals, true)
+	for _, f := range []string{"/rules/a.yml", "/rules/team/b.yml", "/rules/local-override.yml", "/other.yml"} {
+		_, err = os.Stat(dst + f)
+		c.Assert(err, IsNil)
+	}
+
+	// an empty upstream directory is refused, rather than deleting everything
+	opts.SyncDirs = []string{"empty"}
+	c.Assert(opts.RefreshSyncDirs(), NotNil)
+	c.Assert(len(opts.SyncedConfig), Equals, 0)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ConfigWatchDelay is how long a watched butler configuration has to be
+	// left alone after a change before it is read, so that a file which is
+	// still being written is not read half way.
+	ConfigWatchDelay = 250 * time.Millisecond
+)
+
+// WatchConfig watches a file:// butler configuration, and reads it with the
+// Handler as soon as it changes, in addition to its scheduled retrieval. The
+// directory of the file is watched, so that a file which is replaced rather
+// than written to, eg: by an editor or a configuration management tool, is
+// picked up too. It returns a function which stops watching, and waits for a
+// read which is already under way.
+func (bc *ButlerConfig) WatchConfig() (func(), error) {
+	if bc.Scheme() != "file" {
+		return nil, fmt.Errorf("cannot watch a %v butler configuration", bc.Scheme())
+	}
+	path := filepath.Clean(bc.Host() + bc.Path())
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	log.Infof("ButlerConfig::WatchConfig(): watching %v for changes.", path)
+
+	var (
+		mu      sync.Mutex
+		stopped bool
+		reads   sync.WaitGroup
+	)
+	done := make(chan bool)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(e.Name) != path || e.Op == fsnotify.Chmod {
+					continue
+				}
+				log.Debugf("ButlerConfig::WatchConfig(): %v", e)
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(ConfigWatchDelay, func() {
+					mu.Lock()
+					if stopped {
+						mu.Unlock()
+						return
+					}
+					reads.Add(1)
+					mu.Unlock()
+					defer reads.Done()
+					log.Infof("ButlerConfig::WatchConfig(): %v changed, reading the butler configuration.", path)
+					bc.Handler()
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("ButlerConfig::WatchConfig(): error watching %v. err=%v", path, err.Error())
+			case <-done:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			stopped = true
+			mu.Unlock()
+			close(done)
+			watcher.Close()
+			reads.Wait()
+		})
+	}, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/pkg/methods"
+
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestWatchConfig(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bwatch")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	write := func(interval string) {
+		cfg := strings.Replace(string(TestConfigCompleteEnvironment), "scheduler-interval = 300", "scheduler-interval = "+interval, 1)
+		// the file is replaced, the way editors and configuration
+		// management tools do
+		c.Assert(ioutil.WriteFile(dir+"/butler.toml.tmp", []byte("#butlerstart\n"+cfg+"#butlerend\n"), 0644), IsNil)
+		c.Assert(os.Rename(dir+"/butler.toml.tmp", dir+"/butler.toml"), IsNil)
+	}
+	write("300")
+
+	u, err := url.Parse("file://" + dir + "/butler.toml")
+	c.Assert(err, IsNil)
+	bc, err := NewButlerConfig(&ButlerConfigOpts{LogLevel: log.DebugLevel, URL: u})
+	c.Assert(err, IsNil)
+	bc.SetMethodOpts(methods.FileMethodOpts{Scheme: "file"})
+	c.Assert(bc.Init(), IsNil)
+	c.Assert(bc.Handler(), IsNil)
+	c.Assert(bc.GetCMInterval(), Equals, 300)
+
+	// the interval is read under the handler lock, as the watch updates it
+	// from its own goroutine
+	interval := func() int {
+		handlerLock.Lock()
+		defer handlerLock.Unlock()
+		return bc.GetCMInterval()
+	}
+
+	stop, err := bc.WatchConfig()
+	c.Assert(err, IsNil)
+	defer stop()
+
+	write("60")
+	for i := 0; i < 50 && interval() != 60; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.Assert(interval(), Equals, 60)
+
+	// nothing is read once the watch is stopped
+	stop()
+	write("120")
+	time.Sleep(2 * ConfigWatchDelay)
+	c.Assert(interval(), Equals, 60)
+
+	bc.SetScheme("http")
+	_, err = bc.WatchConfig()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrWebhookUnauthorized is returned for a webhook which is not signed with
+// the globals.webhook-secret.
+var ErrWebhookUnauthorized = errors.New("the webhook is not signed with the webhook-secret")
+
+// Push is a push to a branch of a git repo, as told by a GitHub or GitLab
+// webhook.
+type Push struct {
+	// Repo is the full name of the repo, eg: "monitoring/configs".
+	Repo string `json:"repo"`
+	// Branch is the branch which was pushed to, and DefaultBranch the
+	// default branch of the repo.
+	Branch        string `json:"branch"`
+	DefaultBranch string `json:"default-branch,omitempty"`
+	// Paths are the files which the pushed commits added, modified or
+	// removed. They are unknown, nil, when the push has no commits, eg: a
+	// branch which was reset.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// pushPayload holds the parts of the GitHub and GitLab push payloads which
+// butler needs. GitHub names the repo in repository, and GitLab in project.
+type pushPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		DefaultBranch     string `json:"default_branch"`
+	} `json:"project"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
+
+// ParsePush verifies the webhook with the secret, and returns the push it
+// tells of. GitHub webhooks must carry the X-Hub-Signature-256 HMAC of the
+// body, and GitLab webhooks the secret as their X-Gitlab-Token. The webhooks
+// of other events, eg: the GitHub ping, and the pushes of tags, return no
+// push.
+func ParsePush(header http.Header, body []byte, secret string) (*Push, error) {
+	if secret == "" {
+		return nil, ErrWebhookUnauthorized
+	}
+	var event string
+	switch {
+	case header.Get("X-GitHub-Event") != "":
+		sig := header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(sig, "sha256=") {
+			return nil, ErrWebhookUnauthorized
+		}
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+		if err != nil {
+			return nil, ErrWebhookUnauthorized
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return nil, ErrWebhookUnauthorized
+		}
+		event = header.Get("X-GitHub-Event")
+		if event != "push" {
+			return nil, nil
+		}
+	case header.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return nil, ErrWebhookUnauthorized
+		}
+		event = header.Get("X-Gitlab-Event")
+		if event != "Push Hook" {
+			return nil, nil
+		}
+	default:
+		return nil, ErrWebhookUnauthorized
+	}
+
+	var p pushPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("invalid %v payload. err=%v", event, err.Error())
+	}
+	if !strings.HasPrefix(p.Ref, "refs/heads/") {
+		return nil, nil
+	}
+	res := &Push{
+		Repo:          p.Repository.FullName,
+		Branch:        strings.TrimPrefix(p.Ref, "refs/heads/"),
+		DefaultBranch: p.Repository.DefaultBranch,
+	}
+	if p.Project.PathWithNamespace != "" {
+		res.Repo = p.Project.PathWithNamespace
+		res.DefaultBranch = p.Project.DefaultBranch
+	}
+	if res.Repo == "" {
+		return nil, fmt.Errorf("invalid %v payload, it names no repo", event)
+	}
+	seen := make(map[string]bool)
+	for _, c := range p.Commits {
+		for _, files := range [][]string{c.Added, c.Modified, c.Removed} {
+			for _, f := range files {
+				if !seen[f] {
+					seen[f] = true
+					res.Paths = append(res.Paths, f)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// PushedManagers returns the managers whose webhook-repo the push is to, on
+// their webhook-branch, the default branch of the repo by default, and which
+// have one of their webhook-paths among the pushed files. A push whose files
+// are unknown runs every manager of the branch.
+func (bc *ButlerConfig) PushedManagers(p *Push) []string {
+	var res []string
+	for name, m := range bc.GetManagers() {
+		if m.WebhookRepo == "" || !strings.EqualFold(m.WebhookRepo, p.Repo) {
+			continue
+		}
+		branch := m.WebhookBranch
+		if branch == "" {
+			branch = p.DefaultBranch
+		}
+		if branch != p.Branch {
+			continue
+		}
+		if len(m.WebhookPaths) > 0 && p.Paths != nil && !pushedPath(m.WebhookPaths, p.Paths) {
+			continue
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// pushedPath returns true when one of the paths is, or is underneath, one of
+// the prefixes.
+func pushedPath(prefixes []string, paths []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		for _, p := range paths {
+			if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RunPushed runs the managers which the push is to, and which are not
+// paused, in the background, and returns them.
+func (bc *ButlerConfig) RunPushed(p *Push) []string {
+	var res []string
+	only := make(map[string]bool)
+	for _, name := range bc.PushedManagers(p) {
+		if GetManagerPaused(bc.GetStatusFile(), name) != nil {
+			log.Infof("Config::RunPushed()[manager=%v]: %v was pushed to %v, but the manager is paused.", name, p.Repo, p.Branch)
+			continue
+		}
+		log.Infof("Config::RunPushed()[manager=%v]: %v was pushed to %v, running the manager.", name, p.Repo, p.Branch)
+		only[name] = true
+		res = append(res, name)
+	}
+	if len(only) > 0 {
+		go bc.runCMHandler(context.Background(), only)
+	}
+	return res
+}
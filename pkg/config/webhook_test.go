@@ -0,0 +1,96 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+)
+
+func githubWebhook(event string, body []byte, secret string) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	h := make(http.Header)
+	h.Set("X-GitHub-Event", event)
+	h.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return h
+}
+
+func (s *ConfigTestSuite) TestParsePush(c *C) {
+	github := []byte(`{"ref":"refs/heads/main","repository":{"full_name":"monitoring/configs","default_branch":"main"},
+		"commits":[{"added":["prometheus/rules/new.yml"],"modified":["prometheus/prometheus.yml"],"removed":[]},{"modified":["prometheus/prometheus.yml"],"removed":["README.md"]}]}`)
+	p, err := ParsePush(githubWebhook("push", github, "s3cr3t"), github, "s3cr3t")
+	c.Assert(err, IsNil)
+	c.Assert(*p, DeepEquals, Push{Repo: "monitoring/configs", Branch: "main", DefaultBranch: "main", Paths: []string{"prometheus/rules/new.yml", "prometheus/prometheus.yml", "README.md"}})
+
+	_, err = ParsePush(githubWebhook("push", github, "guess"), github, "s3cr3t")
+	c.Assert(err, Equals, ErrWebhookUnauthorized)
+	h := githubWebhook("push", github, "s3cr3t")
+	h.Del("X-Hub-Signature-256")
+	h.Set("X-Hub-Signature", "sha1=0000")
+	_, err = ParsePush(h, github, "s3cr3t")
+	c.Assert(err, Equals, ErrWebhookUnauthorized)
+	// without a secret no webhook is accepted
+	_, err = ParsePush(githubWebhook("push", github, ""), github, "")
+	c.Assert(err, Equals, ErrWebhookUnauthorized)
+	_, err = ParsePush(make(http.Header), github, "s3cr3t")
+	c.Assert(err, Equals, ErrWebhookUnauthorized)
+
+	// other events and tags are not pushes to a branch
+	p, err = ParsePush(githubWebhook("ping", []byte("{}"), "s3cr3t"), []byte("{}"), "s3cr3t")
+	c.Assert(err, IsNil)
+	c.Assert(p, IsNil)
+	tag := []byte(`{"ref":"refs/tags/v1.0.0","repository":{"full_name":"monitoring/configs"}}`)
+	p, err = ParsePush(githubWebhook("push", tag, "s3cr3t"), tag, "s3cr3t")
+	c.Assert(err, IsNil)
+	c.Assert(p, IsNil)
+	_, err = ParsePush(githubWebhook("push", []byte("{"), "s3cr3t"), []byte("{"), "s3cr3t")
+	c.Assert(err, ErrorMatches, "invalid push payload. err=.*")
+
+	gitlab := []byte(`{"object_kind":"push","ref":"refs/heads/release","project":{"path_with_namespace":"Monitoring/Configs","default_branch":"main"},"commits":[]}`)
+	h = make(http.Header)
+	h.Set("X-Gitlab-Event", "Push Hook")
+	h.Set("X-Gitlab-Token", "s3cr3t")
+	p, err = ParsePush(h, gitlab, "s3cr3t")
+	c.Assert(err, IsNil)
+	c.Assert(*p, DeepEquals, Push{Repo: "Monitoring/Configs", Branch: "release", DefaultBranch: "main"})
+	h.Set("X-Gitlab-Token", "guess")
+	_, err = ParsePush(h, gitlab, "s3cr3t")
+	c.Assert(err, Equals, ErrWebhookUnauthorized)
+}
+
+func (s *ConfigTestSuite) TestPushedManagers(c *C) {
+	bc := &ButlerConfig{Config: NewConfigSettings()}
+	bc.Config.Managers = map[string]*Manager{
+		"prometheus":   {Name: "prometheus", WebhookRepo: "monitoring/configs", WebhookPaths: []string{"prometheus/"}},
+		"alertmanager": {Name: "alertmanager", WebhookRepo: "monitoring/configs", WebhookPaths: []string{"alertmanager"}},
+		"staging":      {Name: "staging", WebhookRepo: "monitoring/configs", WebhookBranch: "staging"},
+		"everything":   {Name: "everything", WebhookRepo: "monitoring/configs"},
+		"polled":       {Name: "polled"},
+	}
+	push := &Push{Repo: "monitoring/configs", Branch: "main", DefaultBranch: "main", Paths: []string{"prometheus/prometheus.yml"}}
+	c.Assert(bc.PushedManagers(push), DeepEquals, []string{"everything", "prometheus"})
+	push.Paths = []string{"alertmanager-old/alertmanager.yml", "alertmanager"}
+	c.Assert(bc.PushedManagers(push), DeepEquals, []string{"alertmanager", "everything"})
+	// a push whose files are unknown runs every manager of the branch
+	push.Paths = nil
+	c.Assert(bc.PushedManagers(push), DeepEquals, []string{"alertmanager", "everything", "prometheus"})
+	push.Branch = "staging"
+	c.Assert(bc.PushedManagers(push), DeepEquals, []string{"staging"})
+	push.Repo = "monitoring/other"
+	c.Assert(bc.PushedManagers(push), HasLen, 0)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/adobe/butler/internal/environment"
+)
+
+// selinuxXattr is the extended attribute which holds the SELinux context of
+// a file.
+const selinuxXattr = "security.selinux"
+
+// initXattrs checks the extended attribute options of the manager. The
+// selinux-context is the security.selinux attribute, which overrides one set
+// in the xattrs. The restorecon command is looked up in the PATH.
+func (bm *Manager) initXattrs() error {
+	var err error
+
+	bm.Xattrs, err = ParseXattrs(bm.XattrsArray)
+	if err != nil {
+		return err
+	}
+	if !xattrsSupported && (len(bm.Xattrs) > 0 || strings.TrimSpace(environment.GetVar(bm.SELinuxContext)) != "" ||
+		strings.ToLower(environment.GetVar(bm.CfgPreserveXattrs)) == "true" || strings.ToLower(environment.GetVar(bm.CfgRestorecon)) == "true") {
+		return errors.New("extended attributes are not supported on this platform")
+	}
+	if ctx := strings.TrimSpace(environment.GetVar(bm.SELinuxContext)); ctx != "" {
+		if len(strings.Split(ctx, ":")) < 3 {
+			return fmt.Errorf("Invalid selinux-context=%v, must be user:role:type[:level]", ctx)
+		}
+		bm.SELinuxContext = ctx
+		bm.Xattrs[selinuxXattr] = ctx
+	}
+	bm.PreserveXattrs = strings.ToLower(environment.GetVar(bm.CfgPreserveXattrs)) == "true"
+	bm.Restorecon = ""
+	if strings.ToLower(environment.GetVar(bm.CfgRestorecon)) == "true" {
+		if bm.Restorecon, err = exec.LookPath("restorecon"); err != nil {
+			return fmt.Errorf("restorecon is enabled, but could not be found. err=%v", err.Error())
+		}
+	}
+	return nil
+}
+
+// ParseXattrs parses the manager.xattrs entries, which are in the form
+// "name=value", eg: "user.owner=team-a". The names must be namespaced.
+func ParseXattrs(entries []string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	for _, e := range entries {
+		e = strings.TrimSpace(environment.GetVar(e))
+		if e == "" {
+			continue
+		}
+		keyvalpairs := strings.SplitN(e, "=", 2)
+		name := strings.TrimSpace(keyvalpairs[0])
+		if len(keyvalpairs) != 2 || !strings.Contains(name, ".") {
+			return res, fmt.Errorf("invalid manager.xattrs entry \"%s\"", e)
+		}
+		res[name] = keyvalpairs[1]
+	}
+	return res, nil
+}
+
+// applyXattrs sets the extended attributes of a file which is installed to
+// dst: the attributes of the existing dst when they are preserved, and then
+// the configured ones, where they differ from those of the file.
+func applyXattrs(file string, dst string, opts InstallOpts) error {
+	if !opts.PreserveXattrs && len(opts.Xattrs) == 0 {
+		return nil
+	}
+	attrs := make(map[string][]byte)
+	if opts.PreserveXattrs && dst != "" {
+		// a dst which does not exist has nothing to preserve
+		cur, err := listXattrs(dst)
+		if err != nil && err != syscall.ENOENT {
+			return fmt.Errorf("could not read the extended attributes of %v. err=%v", dst, err.Error())
+		}
+		for k, v := range cur {
+			attrs[k] = v
+		}
+	}
+	for k, v := range opts.Xattrs {
+		attrs[k] = []byte(v)
+	}
+
+	cur, err := listXattrs(file)
+	if err != nil {
+		return fmt.Errorf("could not read the extended attributes of %v. err=%v", file, err.Error())
+	}
+	for k, v := range attrs {
+		// the kernel may or may not terminate the values it returns
+		if c, ok := cur[k]; ok && bytes.Equal(bytes.TrimRight(c, "\x00"), bytes.TrimRight(v, "\x00")) {
+			continue
+		}
+		if err := setXattr(file, k, v); err != nil {
+			return fmt.Errorf("could not set the %v extended attribute of %v. err=%v", k, file, err.Error())
+		}
+	}
+	return nil
+}
+
+// restorecon resets the SELinux context of the file to the default of its
+// path, with the restorecon command.
+func restorecon(cmd string, file string) error {
+	out, err := exec.Command(cmd, file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("restorecon %v failed. err=%v output=%v", file, err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// xattrsSupported is whether the files may be given extended attributes.
+const xattrsSupported = true
+
+// listXattrs returns the extended attributes of the file, by name.
+func listXattrs(file string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	size, err := syscall.Listxattr(file, nil)
+	if err != nil || size == 0 {
+		return res, err
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(file, buf); err != nil {
+		return res, err
+	}
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		vsize, err := syscall.Getxattr(file, string(name), nil)
+		if err != nil {
+			return res, err
+		}
+		value := make([]byte, vsize)
+		if vsize, err = syscall.Getxattr(file, string(name), value); err != nil {
+			return res, err
+		}
+		res[string(name)] = value[:vsize]
+	}
+	return res, nil
+}
+func setXattr(file string, name string, value []byte) error {
+	return syscall.Setxattr(file, name, value, 0)
+}
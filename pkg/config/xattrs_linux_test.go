@@ -0,0 +1,66 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ConfigTestSuite) TestInitXattrs(c *C) {
+	mgr := &Manager{XattrsArray: []string{"user.team=observability", "user.note=a=b"}, SELinuxContext: "system_u:object_r:httpd_config_t:s0"}
+	c.Assert(mgr.initXattrs(), IsNil)
+	c.Assert(mgr.Xattrs, DeepEquals, map[string]string{"user.team": "observability", "user.note": "a=b", "security.selinux": "system_u:object_r:httpd_config_t:s0"})
+
+	for _, m := range []*Manager{
+		{XattrsArray: []string{"team=observability"}},
+		{XattrsArray: []string{"user.team"}},
+		{SELinuxContext: "httpd_config_t"},
+	} {
+		c.Assert(m.initXattrs(), NotNil, Commentf("manager %#v", m))
+	}
+}
+
+func (s *ConfigTestSuite) TestInstallFileXattrs(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bxattrs")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	dst := dir + "/nginx.conf"
+	c.Assert(ioutil.WriteFile(dst, []byte("events {}\n"), 0644), IsNil)
+	if err := syscall.Setxattr(dst, "user.origin", []byte("puppet"), 0); err != nil {
+		c.Skip("the filesystem does not support user extended attributes")
+	}
+
+	// the attributes of the replaced file are preserved, and the configured
+	// ones are set
+	opts := NewInstallOpts()
+	opts.PreserveXattrs = true
+	opts.Xattrs = map[string]string{"user.team": "observability"}
+	c.Assert(InstallFile(bytes.NewReader([]byte("http {}\n")), dst, opts), IsNil)
+	attrs, err := listXattrs(dst)
+	c.Assert(err, IsNil)
+	c.Assert(string(attrs["user.origin"]), Equals, "puppet")
+	c.Assert(string(attrs["user.team"]), Equals, "observability")
+
+	// the configured attributes are set again on files which have not changed
+	c.Assert(syscall.Removexattr(dst, "user.team"), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/src.conf", []byte("http {}\n"), 0644), IsNil)
+	c.Assert(CompareAndCopy(dir+"/src.conf", dst, "test-manager", opts), Equals, false)
+	attrs, err = listXattrs(dst)
+	c.Assert(err, IsNil)
+	c.Assert(string(attrs["user.team"]), Equals, "observability")
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+)
+
+// xattrsSupported is whether the files may be given extended attributes,
+// which butler only sets on linux.
+const xattrsSupported = false
+
+var errNoXattrs = errors.New("extended attributes are not supported on this platform")
+
+func listXattrs(file string) (map[string][]byte, error) {
+	return nil, errNoXattrs
+}
+
+func setXattr(file string, name string, value []byte) error {
+	return errNoXattrs
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package destinations
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConsulAddress = "http://127.0.0.1:8500"
+	defaultConsulTimeout = 30
+
+	// consulValueLimit is the largest value consul takes.
+	consulValueLimit = 512 * 1024
+
+	// consulTxnLimit is the most operations of a consul transaction.
+	consulTxnLimit = 64
+)
+
+// ConsulDestination writes the files of the manager under a prefix of the
+// consul KV store, through the consul HTTP API, eg: for consul-template to
+// pick them up. Each file is the key of its path, relative to the dest-path,
+// under the prefix, and the keys under the prefix which are not files of the
+// manager are deleted, unless prune is "false". The changes are written in
+// consul transactions, so that the consumers see them all at once, as long
+// as they are no more than 64.
+type ConsulDestination struct {
+	Manager string                `json:"-"`
+	Method  string                `json:"method"`
+	Opts    ConsulDestinationOpts `json:"opts"`
+	client  *http.Client
+}
+
+type ConsulDestinationOpts struct {
+	Address            string `json:"address"`
+	Prefix             string `json:"prefix"`
+	Token              string `json:"token"`
+	Prune              string `json:"prune"`
+	InsecureSkipVerify string `json:"insecure-skip-verify"`
+	Timeout            string `json:"timeout"`
+	prune              bool
+}
+
+func NewConsulDestination(manager string, method string, entry []byte) (*ConsulDestination, error) {
+	var opts ConsulDestinationOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+	opts.Address = strings.TrimSuffix(strings.TrimSpace(environment.GetVar(opts.Address)), "/")
+	if opts.Address == "" {
+		opts.Address = defaultConsulAddress
+	}
+	if u, err := url.Parse(opts.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid consul destination address %v", opts.Address)
+	}
+	opts.Prefix = strings.Trim(strings.TrimSpace(environment.GetVar(opts.Prefix)), "/")
+	if opts.Prefix == "" {
+		return nil, errors.New("no prefix defined for consul destination")
+	}
+	opts.Token = environment.GetVar(opts.Token)
+	opts.prune = strings.ToLower(environment.GetVar(opts.Prune)) != "false"
+
+	timeout := defaultConsulTimeout
+	if t := strings.TrimSpace(environment.GetVar(opts.Timeout)); t != "" {
+		var err error
+		if timeout, err = strconv.Atoi(t); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid consul destination timeout %v", opts.Timeout)
+		}
+	}
+	insecure := strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"
+	return &ConsulDestination{
+		Manager: manager,
+		Method:  method,
+		Opts:    opts,
+		client: &http.Client{
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+		},
+	}, nil
+}
+
+// consulPair is a key of the consul KV store, as consul returns it.
+type consulPair struct {
+	Key         string `json:"Key"`
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+// consulTxnOp is an operation of a consul transaction on a key.
+type consulTxnOp struct {
+	KV struct {
+		Verb  string `json:"Verb"`
+		Key   string `json:"Key"`
+		Value string `json:"Value,omitempty"`
+		Index uint64 `json:"Index,omitempty"`
+	} `json:"KV"`
+}
+
+// do sends a request to the consul HTTP API, and decodes its JSON response
+// into res, if any. It returns the status code of the response.
+func (d *ConsulDestination) do(method string, path string, body interface{}, res interface{}) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, d.Opts.Address+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if d.Opts.Token != "" {
+		req.Header.Set("X-Consul-Token", d.Opts.Token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("unexpected response %v from consul. %v", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if res == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(res)
+}
+
+func (d *ConsulDestination) Publish(files map[string][]byte) error {
+	o := d.Opts
+	var pairs []consulPair
+	code, err := d.do("GET", fmt.Sprintf("/v1/kv/%s/?recurse=true", o.Prefix), nil, &pairs)
+	if err != nil && code != http.StatusNotFound {
+		return fmt.Errorf("could not get the keys under %v. err=%v", o.Prefix, err.Error())
+	}
+	current := make(map[string]consulPair)
+	for _, p := range pairs {
+		current[p.Key] = p
+	}
+
+	// the keys are checked against the index they were read at, so that a
+	// concurrent change of them fails the transaction, which is tried again
+	// by the next reload
+	var ops []consulTxnOp
+	for path, content := range files {
+		if len(content) > consulValueLimit {
+			return fmt.Errorf("%v is %v bytes, more than the %v bytes of a consul value", path, len(content), consulValueLimit)
+		}
+		key := fmt.Sprintf("%s/%s", o.Prefix, strings.TrimPrefix(path, "/"))
+		p, ok := current[key]
+		if ok && bytes.Equal(p.Value, content) {
+			continue
+		}
+		var op consulTxnOp
+		op.KV.Verb = "cas"
+		op.KV.Key = key
+		op.KV.Value = base64.StdEncoding.EncodeToString(content)
+		op.KV.Index = p.ModifyIndex
+		ops = append(ops, op)
+	}
+	if o.prune {
+		for key, p := range current {
+			rel := strings.TrimPrefix(key, o.Prefix+"/")
+			if _, ok := files[rel]; ok || strings.HasSuffix(key, "/") {
+				continue
+			}
+			var op consulTxnOp
+			op.KV.Verb = "delete-cas"
+			op.KV.Key = key
+			op.KV.Index = p.ModifyIndex
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		log.Debugf("ConsulDestination::Publish()[manager=%v]: the keys under %v are up to date.", d.Manager, o.Prefix)
+		return nil
+	}
+
+	for i := 0; i < len(ops); i += consulTxnLimit {
+		end := i + consulTxnLimit
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if _, err := d.do("PUT", "/v1/txn", ops[i:end], nil); err != nil {
+			return fmt.Errorf("could not write the keys under %v. err=%v", o.Prefix, err.Error())
+		}
+	}
+	log.Infof("ConsulDestination::Publish()[manager=%v]: wrote %v changes under %v.", d.Manager, len(ops), o.Prefix)
+	return nil
+}
+
+func (d *ConsulDestination) GetMethod() string {
+	return d.Method
+}
+
+func (d *ConsulDestination) GetOpts() DestinationOpts {
+	return d.Opts
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+// Package destinations publishes the files of a manager somewhere other than
+// its dest-path, eg: into a kubernetes ConfigMap or under a consul KV
+// prefix, for the services which do not share a filesystem with butler. The
+// dest-path is still where butler keeps its own copy of the files, which are
+// validated, cached and diffed there as usual, and the destination gets them
+// before every reload.
+package destinations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Destination publishes the files of a manager. The files are keyed by
+// their path relative to the dest-path of the manager.
+type Destination interface {
+	Publish(files map[string][]byte) error
+	GetMethod() string
+	GetOpts() DestinationOpts
+}
+
+type DestinationOpts interface {
+}
+
+// New returns the Destination of the manager, or nil when the manager has
+// none, and its files are only in its dest-path.
+func New(entry string) (Destination, error) {
+	var (
+		err    error
+		result map[string]interface{}
+	)
+
+	key := fmt.Sprintf("%s.destination", entry)
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+
+	err = viper.UnmarshalKey(key, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// destination is defined, but there's no method
+	if result == nil || result["method"] == nil {
+		return nil, errors.New("no destination method has been defined for manager")
+	}
+
+	method := fmt.Sprintf("%v", result["method"])
+	if _, ok := result[method]; !ok {
+		return nil, fmt.Errorf("no destination configuration has been defined for method %v", method)
+	}
+	jsonRes, err := json.Marshal(result[method])
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "kubernetes":
+		return NewKubernetesDestination(entry, method, jsonRes)
+	case "consul":
+		return NewConsulDestination(entry, method, jsonRes)
+	default:
+		return nil, fmt.Errorf("unknown destination method %v", method)
+	}
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package destinations
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DestinationsTestSuite struct {
+}
+
+var _ = Suite(&DestinationsTestSuite{})
+
+// fakeAPIServer keeps the objects which are written through it, by path.
+type fakeAPIServer struct {
+	mutex   sync.Mutex
+	objects map[string]map[string]interface{}
+	writes  []string
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.Method {
+	case "GET":
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+	case "POST", "PUT":
+		var obj map[string]interface{}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &obj)
+		path := r.URL.Path
+		if r.Method == "POST" {
+			path += "/" + obj["metadata"].(map[string]interface{})["name"].(string)
+		} else if obj["metadata"].(map[string]interface{})["resourceVersion"] != "1" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		obj["metadata"].(map[string]interface{})["resourceVersion"] = "1"
+		f.objects[path] = obj
+		f.writes = append(f.writes, r.Method+" "+path)
+	}
+}
+
+func newTestDestination(c *C, server *httptest.Server, kind string) *KubernetesDestination {
+	entry, _ := json.Marshal(map[string]string{"kind": kind, "name": "prometheus", "namespace": "monitoring", "api-server": server.URL, "token-file": "/nonexistent"})
+	d, err := NewKubernetesDestination("prometheus", "kubernetes", entry)
+	c.Assert(err, IsNil)
+	return d
+}
+
+func (s *DestinationsTestSuite) TestNewKubernetesDestination(c *C) {
+	for _, entry := range []string{
+		`{"name": "prometheus", "kind": "deployment", "api-server": "http://localhost", "namespace": "default"}`,
+		`{"kind": "configmap", "api-server": "http://localhost", "namespace": "default"}`,
+		`{"name": "prometheus", "api-server": "http://localhost", "namespace": "default", "timeout": "soon"}`,
+	} {
+		_, err := NewKubernetesDestination("prometheus", "kubernetes", []byte(entry))
+		c.Assert(err, NotNil, Commentf("entry %v", entry))
+	}
+	d, err := NewKubernetesDestination("prometheus", "kubernetes", []byte(`{"name": "prometheus", "api-server": "http://localhost", "namespace": "default"}`))
+	c.Assert(err, IsNil)
+	c.Assert(d.GetOpts().(KubernetesDestinationOpts).Kind, Equals, "configmap")
+	c.Assert(d.GetMethod(), Equals, "kubernetes")
+}
+
+func (s *DestinationsTestSuite) TestKubernetesPublish(c *C) {
+	api := &fakeAPIServer{objects: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	d := newTestDestination(c, server, "configmap")
+	path := "/api/v1/namespaces/monitoring/configmaps/prometheus"
+
+	files := map[string][]byte{"prometheus.yml": []byte("global: {}\n"), "rules/alerts.yml": []byte("groups: []\n"), "geo.db": {0xff, 0xfe}}
+	c.Assert(d.Publish(files), IsNil)
+	c.Assert(api.writes, DeepEquals, []string{"POST " + path})
+	obj := api.objects[path]
+	c.Assert(obj["data"], DeepEquals, map[string]interface{}{"prometheus.yml": "global: {}\n", "rules__alerts.yml": "groups: []\n"})
+	c.Assert(obj["binaryData"], DeepEquals, map[string]interface{}{"geo.db": "//4="})
+	c.Assert(obj["metadata"].(map[string]interface{})["labels"], DeepEquals, map[string]interface{}{"app.kubernetes.io/managed-by": "butler"})
+
+	// the same files are not written again
+	c.Assert(d.Publish(files), IsNil)
+	c.Assert(api.writes, HasLen, 1)
+
+	// the object is replaced by the files, keeping its resourceVersion
+	c.Assert(d.Publish(map[string][]byte{"prometheus.yml": []byte("global: {scrape_interval: 30s}\n")}), IsNil)
+	c.Assert(api.writes, DeepEquals, []string{"POST " + path, "PUT " + path})
+	obj = api.objects[path]
+	c.Assert(obj["data"], DeepEquals, map[string]interface{}{"prometheus.yml": "global: {scrape_interval: 30s}\n"})
+	c.Assert(obj["binaryData"], IsNil)
+
+	// a concurrent change of the object fails the update
+	api.objects[path]["metadata"].(map[string]interface{})["resourceVersion"] = "2"
+	c.Assert(d.Publish(files), ErrorMatches, "could not update configmap monitoring/prometheus. err=http_code=409.*")
+
+	c.Assert(d.Publish(map[string][]byte{"rules/a.yml": nil, "rules__a.yml": nil}), ErrorMatches, ".* are both written to the rules__a.yml key")
+	c.Assert(d.Publish(map[string][]byte{"prometheus rules.yml": nil}), ErrorMatches, "prometheus rules.yml is not a valid configmap key")
+	c.Assert(d.Publish(map[string][]byte{"big": []byte(strings.Repeat("x", kubernetesObjectLimit+1))}), ErrorMatches, "the files are .* bytes, more than the .* bytes a configmap holds")
+}
+
+func (s *DestinationsTestSuite) TestKubernetesPublishSecret(c *C) {
+	api := &fakeAPIServer{objects: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	d := newTestDestination(c, server, "secret")
+
+	c.Assert(d.Publish(map[string][]byte{"alertmanager.yml": []byte("route: {}\n")}), IsNil)
+	obj := api.objects["/api/v1/namespaces/monitoring/secrets/prometheus"]
+	c.Assert(obj["kind"], Equals, "Secret")
+	c.Assert(obj["type"], Equals, "Opaque")
+	c.Assert(obj["data"], DeepEquals, map[string]interface{}{"alertmanager.yml": "cm91dGU6IHt9Cg=="})
+}
+
+// fakeConsul keeps the keys which are written through its transactions.
+type fakeConsul struct {
+	mutex sync.Mutex
+	keys  map[string]consulPair
+	index uint64
+	txns  int
+	// race changes the keys right after they are read
+	race bool
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		var pairs []consulPair
+		for k, p := range f.keys {
+			if strings.HasPrefix(k, prefix) {
+				pairs = append(pairs, p)
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(pairs)
+		if f.race {
+			for k, p := range f.keys {
+				f.index++
+				p.ModifyIndex = f.index
+				f.keys[k] = p
+			}
+		}
+	case r.Method == "PUT" && r.URL.Path == "/v1/txn":
+		var ops []consulTxnOp
+		json.NewDecoder(r.Body).Decode(&ops)
+		for _, op := range ops {
+			if f.keys[op.KV.Key].ModifyIndex != op.KV.Index {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		f.txns++
+		for _, op := range ops {
+			if op.KV.Verb == "delete-cas" {
+				delete(f.keys, op.KV.Key)
+				continue
+			}
+			f.index++
+			value, _ := base64.StdEncoding.DecodeString(op.KV.Value)
+			f.keys[op.KV.Key] = consulPair{Key: op.KV.Key, Value: value, ModifyIndex: f.index}
+		}
+	}
+}
+
+func (s *DestinationsTestSuite) TestNewConsulDestination(c *C) {
+	for _, entry := range []string{
+		`{"address": "http://localhost:8500"}`,
+		`{"address": "localhost:8500", "prefix": "prometheus"}`,
+		`{"prefix": "prometheus", "timeout": "0"}`,
+	} {
+		_, err := NewConsulDestination("prometheus", "consul", []byte(entry))
+		c.Assert(err, NotNil, Commentf("entry %v", entry))
+	}
+	d, err := NewConsulDestination("prometheus", "consul", []byte(`{"prefix": "/config/prometheus/"}`))
+	c.Assert(err, IsNil)
+	c.Assert(d.GetOpts().(ConsulDestinationOpts).Address, Equals, "http://127.0.0.1:8500")
+	c.Assert(d.GetOpts().(ConsulDestinationOpts).Prefix, Equals, "config/prometheus")
+	c.Assert(d.GetMethod(), Equals, "consul")
+}
+
+func (s *DestinationsTestSuite) TestConsulPublish(c *C) {
+	consul := &fakeConsul{keys: make(map[string]consulPair)}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	d, err := NewConsulDestination("prometheus", "consul", []byte(`{"address": "`+server.URL+`", "prefix": "config/prometheus"}`))
+	c.Assert(err, IsNil)
+
+	files := map[string][]byte{"prometheus.yml": []byte("global: {}\n"), "rules/alerts.yml": []byte("groups: []\n")}
+	c.Assert(d.Publish(files), IsNil)
+	c.Assert(consul.txns, Equals, 1)
+	c.Assert(string(consul.keys["config/prometheus/prometheus.yml"].Value), Equals, "global: {}\n")
+	c.Assert(string(consul.keys["config/prometheus/rules/alerts.yml"].Value), Equals, "groups: []\n")
+
+	// the same files are not written again
+	c.Assert(d.Publish(files), IsNil)
+	c.Assert(consul.txns, Equals, 1)
+
+	// the keys which are not files are deleted, but not those of other prefixes
+	consul.keys["config/prometheus-rules/x.yml"] = consulPair{Key: "config/prometheus-rules/x.yml"}
+	c.Assert(d.Publish(map[string][]byte{"prometheus.yml": []byte("global: {scrape_interval: 30s}\n")}), IsNil)
+	c.Assert(consul.txns, Equals, 2)
+	c.Assert(consul.keys, HasLen, 2)
+	c.Assert(string(consul.keys["config/prometheus/prometheus.yml"].Value), Equals, "global: {scrape_interval: 30s}\n")
+
+	// a concurrent change of a key fails the transaction
+	consul.race = true
+	c.Assert(d.Publish(files), ErrorMatches, "could not write the keys under config/prometheus. err=unexpected response 409 .*")
+	c.Assert(consul.txns, Equals, 2)
+	consul.race = false
+
+	c.Assert(d.Publish(map[string][]byte{"big": []byte(strings.Repeat("x", consulValueLimit+1))}), ErrorMatches, "big is .* bytes, more than the .* bytes of a consul value")
+}
+
+func (s *DestinationsTestSuite) TestConsulPublishNoPrune(c *C) {
+	consul := &fakeConsul{keys: map[string]consulPair{"config/prometheus/old.yml": {Key: "config/prometheus/old.yml", ModifyIndex: 1}}, index: 1}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	d, err := NewConsulDestination("prometheus", "consul", []byte(`{"address": "`+server.URL+`", "prefix": "config/prometheus", "prune": "false"}`))
+	c.Assert(err, IsNil)
+
+	c.Assert(d.Publish(map[string][]byte{"prometheus.yml": []byte("global: {}\n")}), IsNil)
+	c.Assert(consul.keys, HasLen, 2)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package destinations
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKubernetesKind = "configmap"
+
+	// kubernetesObjectLimit is the most data a ConfigMap or a Secret holds.
+	kubernetesObjectLimit = 1024 * 1024
+
+	// kubernetesManagedByLabel is set on the objects butler creates.
+	kubernetesManagedByLabel = "app.kubernetes.io/managed-by"
+)
+
+// kubernetesKinds maps the kinds the destination writes to their core/v1
+// resources and kinds.
+var kubernetesKinds = map[string][2]string{
+	"configmap": {"configmaps", "ConfigMap"},
+	"secret":    {"secrets", "Secret"},
+}
+
+// kubernetesKey matches the keys a ConfigMap or a Secret takes.
+var kubernetesKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// KubernetesDestination writes the files of the manager into a ConfigMap or
+// a Secret through the kubernetes API, for the in-cluster services which do
+// not mount a path of the host. Each file is a key of the object, and the
+// object only has the files of the manager. The kubernetes reloader then
+// rolls the workloads which use the object.
+type KubernetesDestination struct {
+	Manager string                    `json:"-"`
+	Method  string                    `json:"method"`
+	Opts    KubernetesDestinationOpts `json:"opts"`
+	client  *kubernetes.Client
+}
+
+type KubernetesDestinationOpts struct {
+	Kind               string `json:"kind"`
+	Name               string `json:"name"`
+	Namespace          string `json:"namespace"`
+	APIServer          string `json:"api-server"`
+	TokenFile          string `json:"token-file"`
+	CAFile             string `json:"ca-file"`
+	InsecureSkipVerify string `json:"insecure-skip-verify"`
+	Timeout            string `json:"timeout"`
+}
+
+func NewKubernetesDestination(manager string, method string, entry []byte) (*KubernetesDestination, error) {
+	var opts KubernetesDestinationOpts
+
+	if err := json.Unmarshal(entry, &opts); err != nil {
+		return nil, err
+	}
+
+	opts.Kind = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Kind)))
+	if opts.Kind == "" {
+		opts.Kind = defaultKubernetesKind
+	}
+	if _, ok := kubernetesKinds[opts.Kind]; !ok {
+		return nil, fmt.Errorf("invalid kubernetes destination kind %v", opts.Kind)
+	}
+	opts.Name = strings.TrimSpace(environment.GetVar(opts.Name))
+	if opts.Name == "" {
+		return nil, errors.New("no name defined for kubernetes destination")
+	}
+
+	opts.APIServer = strings.TrimSpace(environment.GetVar(opts.APIServer))
+	opts.TokenFile = strings.TrimSpace(environment.GetVar(opts.TokenFile))
+	opts.CAFile = strings.TrimSpace(environment.GetVar(opts.CAFile))
+	config := kubernetes.Config{
+		APIServer:          opts.APIServer,
+		TokenFile:          opts.TokenFile,
+		CAFile:             opts.CAFile,
+		InsecureSkipVerify: strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true",
+	}
+	if timeout := strings.TrimSpace(environment.GetVar(opts.Timeout)); timeout != "" {
+		t, err := strconv.Atoi(timeout)
+		if err != nil || t <= 0 {
+			return nil, fmt.Errorf("invalid kubernetes destination timeout %v", opts.Timeout)
+		}
+		config.Timeout = time.Duration(t) * time.Second
+	}
+	client, err := kubernetes.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes destination: %v", err.Error())
+	}
+
+	opts.Namespace = strings.TrimSpace(environment.GetVar(opts.Namespace))
+	if opts.Namespace == "" {
+		if opts.Namespace, err = client.Namespace(); err != nil {
+			return nil, fmt.Errorf("kubernetes destination: %v", err.Error())
+		}
+	}
+
+	return &KubernetesDestination{Manager: manager, Method: method, Opts: opts, client: client}, nil
+}
+
+// KubernetesKey returns the key of the object which a file, by its path
+// relative to the dest-path, is written to. The files in subdirectories have
+// the slashes of their path replaced by "__", since the keys are flat.
+func KubernetesKey(path string) string {
+	return strings.Replace(strings.TrimPrefix(path, "/"), "/", "__", -1)
+}
+
+// data returns the data of the object for the files, and the binary data of
+// a ConfigMap, for the files which are not UTF-8.
+func (k *KubernetesDestination) data(files map[string][]byte) (map[string]string, map[string]string, error) {
+	var (
+		size   int
+		data   = make(map[string]string)
+		binary = make(map[string]string)
+		paths  = make(map[string]string)
+	)
+	for path, content := range files {
+		key := KubernetesKey(path)
+		if !kubernetesKey.MatchString(key) {
+			return nil, nil, fmt.Errorf("%v is not a valid %v key", key, k.Opts.Kind)
+		}
+		if other, ok := paths[key]; ok {
+			return nil, nil, fmt.Errorf("%v and %v are both written to the %v key", other, path, key)
+		}
+		paths[key] = path
+		size += len(content)
+
+		switch {
+		case k.Opts.Kind == "secret":
+			data[key] = base64.StdEncoding.EncodeToString(content)
+		case utf8.Valid(content):
+			data[key] = string(content)
+		default:
+			binary[key] = base64.StdEncoding.EncodeToString(content)
+		}
+	}
+	if size > kubernetesObjectLimit {
+		return nil, nil, fmt.Errorf("the files are %v bytes, more than the %v bytes a %v holds", size, kubernetesObjectLimit, k.Opts.Kind)
+	}
+	return data, binary, nil
+}
+
+// sameData returns whether the data of an object, as decoded from JSON, is
+// the data.
+func sameData(v interface{}, data map[string]string) bool {
+	m, _ := v.(map[string]interface{})
+	if len(m) != len(data) {
+		return false
+	}
+	for k, v := range m {
+		if s, ok := v.(string); !ok || data[k] != s {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *KubernetesDestination) Publish(files map[string][]byte) error {
+	o := k.Opts
+	data, binary, err := k.data(files)
+	if err != nil {
+		return err
+	}
+	resource, kind := kubernetesKinds[o.Kind][0], kubernetesKinds[o.Kind][1]
+	path := fmt.Sprintf("/api/v1/namespaces/%s/%s", o.Namespace, resource)
+
+	var obj map[string]interface{}
+	err = k.client.Do("GET", fmt.Sprintf("%s/%s", path, o.Name), nil, &obj)
+	if kubernetes.IsNotFound(err) {
+		obj = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      o.Name,
+				"namespace": o.Namespace,
+				"labels":    map[string]string{kubernetesManagedByLabel: "butler"},
+			},
+			"data": data,
+		}
+		if len(binary) > 0 {
+			obj["binaryData"] = binary
+		}
+		if o.Kind == "secret" {
+			obj["type"] = "Opaque"
+		}
+		if err := k.client.Do("POST", path, obj, nil); err != nil {
+			return fmt.Errorf("could not create %v %v/%v. err=%v", o.Kind, o.Namespace, o.Name, err.Error())
+		}
+		log.Infof("KubernetesDestination::Publish()[manager=%v]: created %v %v/%v with %v.", k.Manager, o.Kind, o.Namespace, o.Name, keys(data, binary))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get %v %v/%v. err=%v", o.Kind, o.Namespace, o.Name, err.Error())
+	}
+
+	if sameData(obj["data"], data) && sameData(obj["binaryData"], binary) {
+		log.Debugf("KubernetesDestination::Publish()[manager=%v]: %v %v/%v is up to date.", k.Manager, o.Kind, o.Namespace, o.Name)
+		return nil
+	}
+	// the object keeps its resourceVersion, so that a concurrent change of
+	// it fails the update, which is tried again by the next reload
+	obj["data"] = data
+	delete(obj, "binaryData")
+	delete(obj, "stringData")
+	if len(binary) > 0 {
+		obj["binaryData"] = binary
+	}
+	if err := k.client.Do("PUT", fmt.Sprintf("%s/%s", path, o.Name), obj, nil); err != nil {
+		return fmt.Errorf("could not update %v %v/%v. err=%v", o.Kind, o.Namespace, o.Name, err.Error())
+	}
+	log.Infof("KubernetesDestination::Publish()[manager=%v]: updated %v %v/%v with %v.", k.Manager, o.Kind, o.Namespace, o.Name, keys(data, binary))
+	return nil
+}
+
+// keys returns the sorted keys of the data, for the logs.
+func keys(data ...map[string]string) []string {
+	var res []string
+	for _, d := range data {
+		for k := range d {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (k *KubernetesDestination) GetMethod() string {
+	return k.Method
+}
+
+func (k *KubernetesDestination) GetOpts() DestinationOpts {
+	return k.Opts
+}
@@ -126,6 +126,10 @@ func (b BlobMethod) Get(u *url.URL) (*Response, error) {
 	blob := cnt.GetBlobReference(blobFile)
 	r, err := blob.Get(nil)
 	if err != nil {
+		// eg: 404 for a blob which does not exist
+		if e, ok := err.(storage.AzureStorageServiceError); ok && e.StatusCode != 0 {
+			return &Response{statusCode: e.StatusCode}, err
+		}
 		return &Response{statusCode: 504}, err
 	}
 	res.body = r
@@ -133,6 +137,39 @@ func (b BlobMethod) Get(u *url.URL) (*Response, error) {
 	return &res, nil
 }
 
+// List returns the blobs underneath the container path.
+func (b BlobMethod) List(u *url.URL) ([]string, error) {
+	var res []string
+
+	pathSplit := strings.Split(u.Path, "/")
+	if len(pathSplit) < 2 {
+		return nil, errors.New("improper length for blob storage account/path")
+	}
+
+	container := pathSplit[1]
+	prefix := strings.Join(pathSplit[2:], "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	cnt := b.BlobClient.GetContainerReference(container)
+	params := storage.ListBlobsParameters{Prefix: prefix}
+	for {
+		resp, err := cnt.ListBlobs(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs {
+			res = append(res, strings.TrimPrefix(blob.Name, prefix))
+		}
+		if resp.NextMarker == "" {
+			break
+		}
+		params.Marker = resp.NextMarker
+	}
+	return res, nil
+}
+
 func (b *BlobMethod) SetStorageAccount(a string) {
 	b.StorageAccount = environment.GetVar(a)
 }
@@ -0,0 +1,147 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// IPPreferenceAny connects over whichever of ipv4 and ipv6 answers
+	// first, trying both in parallel, the happy eyeballs way.
+	IPPreferenceAny  = "any"
+	IPPreferenceIPv4 = "ipv4"
+	IPPreferenceIPv6 = "ipv6"
+)
+
+// DialContext dials the outbound connections of a method.
+type DialContext func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// NewDialContext returns the dialer of the outbound connections of a method,
+// which binds them to the source address, either an ip address or the name
+// of a network interface, and connects over the ip version of the
+// preference. It returns nil when neither is set, for the default dialer of
+// the method.
+func NewDialContext(source string, preference string) (DialContext, error) {
+	source = strings.TrimSpace(source)
+	preference = strings.ToLower(strings.TrimSpace(preference))
+	switch preference {
+	case "", IPPreferenceAny, IPPreferenceIPv4, IPPreferenceIPv6:
+	default:
+		return nil, fmt.Errorf("invalid ip-preference %v", preference)
+	}
+	if source == "" && (preference == "" || preference == IPPreferenceAny) {
+		return nil, nil
+	}
+
+	// the address of an interface is looked up on each dial, as it may
+	// change while butler runs
+	if source != "" {
+		if ip := net.ParseIP(source); ip != nil {
+			if !ipMatches(ip, preference) {
+				return nil, fmt.Errorf("source-address %v is not an %v address", source, preference)
+			}
+		} else if _, err := interfaceAddress(source, preference); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		d := &net.Dialer{}
+		if source != "" {
+			ip := net.ParseIP(source)
+			if ip == nil {
+				var err error
+				if ip, err = interfaceAddress(source, preference); err != nil {
+					return nil, err
+				}
+			}
+			// only the addresses of the same ip version as the source
+			// address are dialed
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+		if network == "tcp" {
+			switch preference {
+			case IPPreferenceIPv4:
+				network = "tcp4"
+			case IPPreferenceIPv6:
+				network = "tcp6"
+			}
+		}
+		return d.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// ipMatches returns true when the ip is of the ip version of the preference.
+func ipMatches(ip net.IP, preference string) bool {
+	switch preference {
+	case IPPreferenceIPv4:
+		return ip.To4() != nil
+	case IPPreferenceIPv6:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// interfaceAddress returns the first address of the network interface which
+// is of the ip version of the preference. The link local addresses are not
+// used.
+func interfaceAddress(name string, preference string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source-address %v err=%v", name, err.Error())
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the addresses of source-address %v err=%v", name, err.Error())
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && ipMatches(n.IP, preference) && !n.IP.IsLinkLocalUnicast() {
+			return n.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("source-address %v has no usable address", name)
+}
+
+// connectTo returns a dialer which connects to the address, a host with an
+// optional port, whatever the address it is asked for, eg: to reach an
+// origin server behind a shared anycast address. The Host header and the tls
+// server name are still those of the url. The port of the url is kept when
+// the address has none. The connection is made with dial, or the default
+// dialer when it is nil.
+func connectTo(address string, dial DialContext) (DialContext, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = strings.Trim(address, "[]"), ""
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return nil, fmt.Errorf("invalid connect-to %v", address)
+	}
+	if _, err := strconv.Atoi(port); port != "" && err != nil {
+		return nil, fmt.Errorf("invalid connect-to %v", address)
+	}
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		p := port
+		if p == "" {
+			_, p, _ = net.SplitHostPort(addr)
+		}
+		return dial(ctx, network, net.JoinHostPort(host, p))
+	}, nil
+}
@@ -17,6 +17,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -37,6 +38,7 @@ type EtcdMethod struct {
 	InsecureSkipVerify    bool           `json:"insecure-skip-verify"`
 	KeysAPI               client.KeysAPI `json:"-"`
 	Manager               *string        `json:"-"`
+	WatchPrefix           string         `mapstructure:"watch-prefix" json:"watch-prefix,omitempty"`
 }
 
 type EtcdMethodOpts struct {
@@ -75,6 +77,10 @@ func NewEtcdMethod(manager *string, entry *string) (Method, error) {
 		result.Endpoints = strings.Split(endpointsString, ",")
 
 		result.InsecureSkipVerify = strings.ToLower(environment.GetVar(result.CfgInsecureSkipVerify)) == "true"
+		result.WatchPrefix = environment.GetVar(result.WatchPrefix)
+		if result.WatchPrefix != "" && !strings.HasPrefix(result.WatchPrefix, "/") {
+			return EtcdMethod{}, fmt.Errorf("invalid etcd watch-prefix %v, which is not an absolute key", result.WatchPrefix)
+		}
 		cfg := client.Config{
 			Endpoints: result.Endpoints,
 			Transport: getTransport(result.InsecureSkipVerify),
@@ -118,13 +124,18 @@ func NewEtcdMethodWithEndpoints(endpoints []string, insecureSkipVerify bool) (Me
 }
 
 func (e EtcdMethod) Get(u *url.URL) (*Response, error) {
+	return e.GetWithContext(context.Background(), u)
+}
+
+// GetWithContext gets the key, and gives up once ctx is done.
+func (e EtcdMethod) GetWithContext(ctx context.Context, u *url.URL) (*Response, error) {
 	var (
 		err      error
 		response Response
 	)
 	// get path key's value
 	log.Debugf("Getting file at %v", u)
-	resp, err := GetEtcdKey(context.Background(), e, u.Path, nil)
+	resp, err := GetEtcdKey(ctx, e, u.Path, nil)
 	if err != nil {
 		log.Warnf("Error getting key %s from etcd at %s", u.Path, e.Endpoints)
 		return &Response{statusCode: 404}, err
@@ -135,6 +146,98 @@ func (e EtcdMethod) Get(u *url.URL) (*Response, error) {
 	return &response, nil
 }
 
+// List returns the keys underneath the directory, recursively.
+func (e EtcdMethod) List(u *url.URL) ([]string, error) {
+	var res []string
+
+	resp, err := GetEtcdKey(context.Background(), e, u.Path, &client.GetOptions{Recursive: true})
+	if err != nil {
+		log.Warnf("Error listing directory %s from etcd at %s", u.Path, e.Endpoints)
+		return nil, err
+	}
+	if !resp.Node.Dir {
+		return nil, fmt.Errorf("etcd key %s is not a directory", u.Path)
+	}
+
+	prefix := strings.TrimSuffix(resp.Node.Key, "/") + "/"
+	var walk func(client.Nodes)
+	walk = func(nodes client.Nodes) {
+		for _, n := range nodes {
+			if n.Dir {
+				walk(n.Nodes)
+				continue
+			}
+			res = append(res, strings.TrimPrefix(n.Key, prefix))
+		}
+	}
+	walk(resp.Node.Nodes)
+	return res, nil
+}
+
+// WatchID returns the endpoints and watch-prefix of the method, or nothing
+// when there is no watch-prefix. The watch-prefix is shared by the repos
+// underneath it.
+func (e EtcdMethod) WatchID(repo *url.URL) string {
+	if e.WatchPrefix == "" {
+		return ""
+	}
+	return fmt.Sprintf("etcd:%v%v", strings.Join(e.Endpoints, ","), e.WatchPrefix)
+}
+
+// Watch waits on the changes of the keys underneath the watch-prefix, and
+// calls changed with the keys which were set, or removed. The changes which
+// follow one another within WatchDelay are handed on together. When etcd
+// no longer has the history of the changes since the last one, the watch
+// carries on from the current index, the scheduled runs picking up what was
+// missed. It returns once ctx is done, or etcd cannot be watched.
+func (e EtcdMethod) Watch(ctx context.Context, repo *url.URL, changed func(paths []string)) error {
+	if e.WatchPrefix == "" {
+		return errors.New("no watch-prefix to watch")
+	}
+	w := e.KeysAPI.Watcher(e.WatchPrefix, &client.WatcherOptions{Recursive: true})
+	next := func(ctx context.Context) (*client.Response, error) {
+		for {
+			resp, err := w.Next(ctx)
+			if cerr, ok := err.(client.Error); ok && cerr.Code == client.ErrorCodeEventIndexCleared {
+				log.Warnf("EtcdMethod::Watch(): the changes of %v since the last one are gone, watching from index %v", e.WatchPrefix, cerr.Index)
+				w = e.KeysAPI.Watcher(e.WatchPrefix, &client.WatcherOptions{Recursive: true, AfterIndex: cerr.Index})
+				continue
+			}
+			return resp, err
+		}
+	}
+	for {
+		resp, err := next(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("EtcdMethod::Watch(): could not watch %v err=%v", e.WatchPrefix, err.Error())
+		}
+		paths := []string{resp.Node.Key}
+		seen := map[string]bool{resp.Node.Key: true}
+		// the watcher carries on from the last change it returned, so the
+		// wait for the following changes loses none
+		wctx, cancel := context.WithTimeout(ctx, WatchDelay)
+		for {
+			resp, err := next(wctx)
+			if err != nil {
+				break
+			}
+			if !seen[resp.Node.Key] {
+				seen[resp.Node.Key] = true
+				paths = append(paths, resp.Node.Key)
+			}
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Debugf("EtcdMethod::Watch(): prefix=%v, changed=%v", e.WatchPrefix, paths)
+		changed(paths)
+	}
+}
+
 func GetEtcdKey(ctx context.Context, e EtcdMethod, key string, opts *client.GetOptions) (*client.Response, error) {
 	return e.KeysAPI.Get(ctx, key, opts)
 }
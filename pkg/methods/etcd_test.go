@@ -235,3 +235,65 @@ func (s *EtcdTestSuite) TestGetFail(c *C) {
 	c.Assert(resp2.GetResponseStatusCode(), Equals, 404)
 	c.Assert(resp2.GetResponseBody(), IsNil)
 }
+
+// testEtcdKeys is a KeysAPI whose watchers return the changes sent to it, or
+// the errors.
+type testEtcdKeys struct {
+	client.KeysAPI
+	changes  chan interface{}
+	watchers []client.WatcherOptions
+}
+
+func (k *testEtcdKeys) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	k.watchers = append(k.watchers, *opts)
+	return k
+}
+
+func (k *testEtcdKeys) Next(ctx context.Context) (*client.Response, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case c := <-k.changes:
+		if err, ok := c.(error); ok {
+			return nil, err
+		}
+		return &client.Response{Node: &client.Node{Key: c.(string)}}, nil
+	}
+}
+
+func (s *EtcdTestSuite) TestWatch(c *C) {
+	keys := &testEtcdKeys{changes: make(chan interface{})}
+	e := EtcdMethod{Endpoints: []string{"http://127.0.0.1:2379"}, KeysAPI: keys, WatchPrefix: "/butler"}
+	c.Assert(e.WatchID(nil), Equals, "etcd:http://127.0.0.1:2379/butler")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string)
+	done := make(chan error)
+	go func() {
+		done <- e.Watch(ctx, nil, func(paths []string) { changes <- paths })
+	}()
+
+	// the changes which follow one another are handed on together
+	keys.changes <- "/butler/prometheus/prometheus.yml"
+	keys.changes <- client.Error{Code: client.ErrorCodeEventIndexCleared, Index: 42}
+	keys.changes <- "/butler/prometheus/alerts.yml"
+	keys.changes <- "/butler/prometheus/prometheus.yml"
+	c.Assert(<-changes, DeepEquals, []string{"/butler/prometheus/prometheus.yml", "/butler/prometheus/alerts.yml"})
+	c.Assert(keys.watchers, DeepEquals, []client.WatcherOptions{{Recursive: true}, {Recursive: true, AfterIndex: 42}})
+
+	keys.changes <- "/butler/alertmanager/alertmanager.yml"
+	c.Assert(<-changes, DeepEquals, []string{"/butler/alertmanager/alertmanager.yml"})
+
+	cancel()
+	c.Assert(<-done, Equals, context.Canceled)
+
+	// the watch gives up on other errors
+	go func() {
+		done <- e.Watch(context.Background(), nil, func(paths []string) {})
+	}()
+	keys.changes <- client.Error{Code: client.ErrorCodeKeyNotFound, Message: "Key not found"}
+	c.Assert(<-done, ErrorMatches, "EtcdMethod::Watch\\(\\): could not watch /butler err=.*Key not found.*")
+
+	c.Assert(EtcdMethod{}.WatchID(nil), Equals, "")
+	c.Assert(EtcdMethod{}.Watch(context.Background(), nil, func([]string) {}), ErrorMatches, "no watch-prefix to watch")
+}
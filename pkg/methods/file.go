@@ -0,0 +1,214 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type FileMethod struct {
+	URL      *url.URL `json:"-"`
+	Path     string   `mapstructure:"path" json:"path"`
+	CfgWatch string   `mapstructure:"watch" json:"-"`
+	Watched  bool     `json:"watch"`
+}
+
+type FileMethodOpts struct {
+	Scheme string
+}
+
+func NewFileMethod(manager *string, entry *string) (Method, error) {
+	var (
+		err    error
+		result FileMethod
+		u      *url.URL
+	)
+
+	u = &url.URL{}
+	if (manager != nil) && (entry != nil) {
+		err = viper.UnmarshalKey(*entry, &result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if environment.GetVar(result.Path) != "" {
+		u.Path = environment.GetVar(result.Path)
+	}
+	result.Path = u.Path
+	result.URL = u
+	// the repos are watched unless explicitly disabled
+	result.Watched = strings.ToLower(environment.GetVar(result.CfgWatch)) != "false"
+	return result, err
+}
+
+func NewFileMethodWithURL(u *url.URL) (Method, error) {
+	var (
+		err    error
+		result FileMethod
+	)
+
+	result.URL = u
+	result.Path = u.Path
+	return result, err
+}
+
+func (f FileMethod) Get(u *url.URL) (*Response, error) {
+	var (
+		err      error
+		fileData []byte
+		response Response
+	)
+	fileData, err = ioutil.ReadFile(fmt.Sprintf("%s%s", u.Host, u.Path))
+
+	if err != nil {
+		// 504 is hokey, but we need some bogus code. A missing file is a
+		// 404 though, so that optional files can be told apart.
+		code := 504
+		if os.IsNotExist(err) {
+			code = 404
+		}
+		return &Response{statusCode: code}, fmt.Errorf("FileMethod.Get(): caught error read file err=%v", err.Error())
+	}
+
+	response.statusCode = 200
+	response.body = ioutil.NopCloser(bytes.NewReader(fileData))
+	return &response, nil
+}
+
+// List returns the regular files underneath the directory, recursively.
+func (f FileMethod) List(u *url.URL) ([]string, error) {
+	var res []string
+
+	dir := fmt.Sprintf("%s%s", u.Host, u.Path)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("FileMethod.List(): caught error listing directory err=%v", err.Error())
+	}
+	return res, nil
+}
+
+// WatchID returns the directory of the repo, or nothing when the method does
+// not watch.
+func (f FileMethod) WatchID(repo *url.URL) string {
+	if !f.Watched || repo == nil {
+		return ""
+	}
+	return "file:" + filepath.Clean(repo.Host+repo.Path)
+}
+
+// Watch watches the directory of the repo, and its subdirectories, and calls
+// changed with the files which were written, created, removed or renamed. The
+// changes which follow one another within WatchDelay are handed on together,
+// so that a file which is written in several goes, or a tree which is synced,
+// eg: by rsync, is handed on once. It returns once ctx is done, or the
+// directory cannot be watched.
+func (f FileMethod) Watch(ctx context.Context, repo *url.URL, changed func(paths []string)) error {
+	dir := filepath.Clean(repo.Host + repo.Path)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("FileMethod.Watch(): could not watch %v err=%v", dir, err.Error())
+	}
+	defer watcher.Close()
+	add := func(root string) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return watcher.Add(path)
+			}
+			return nil
+		})
+	}
+	if err := add(dir); err != nil {
+		return fmt.Errorf("FileMethod.Watch(): could not watch %v err=%v", dir, err.Error())
+	}
+
+	var (
+		paths []string
+		seen  = make(map[string]bool)
+		delay <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("FileMethod.Watch(): stopped watching %v", dir)
+			}
+			if e.Op == fsnotify.Chmod {
+				continue
+			}
+			// the new directories are watched too
+			if e.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(e.Name); err == nil && fi.IsDir() {
+					if err := add(e.Name); err != nil {
+						return fmt.Errorf("FileMethod.Watch(): could not watch %v err=%v", e.Name, err.Error())
+					}
+				}
+			}
+			path := filepath.ToSlash(strings.TrimPrefix(e.Name, repo.Host))
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+			if delay == nil {
+				delay = time.After(WatchDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("FileMethod.Watch(): stopped watching %v", dir)
+			}
+			return fmt.Errorf("FileMethod.Watch(): error watching %v err=%v", dir, err.Error())
+		case <-delay:
+			log.Debugf("FileMethod.Watch(): dir=%v, changed=%v", dir, paths)
+			changed(paths)
+			paths = nil
+			seen = make(map[string]bool)
+			delay = nil
+		}
+	}
+}
+
+func (o FileMethodOpts) GetScheme() string {
+	return o.Scheme
+}
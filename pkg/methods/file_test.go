@@ -14,10 +14,13 @@ package methods
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"sort"
 	"testing"
+	"time"
 
 	//log "github.com/sirupsen/logrus"
 	"github.com/bouk/monkey"
@@ -173,9 +176,76 @@ func (s *FileTestSuite) TestGetFail(c *C) {
 	c.Assert(err1, NotNil)
 	c.Assert(err2, NotNil)
 
-	c.Assert(resp1.GetResponseStatusCode(), Equals, 504)
+	// the file does not exist
+	c.Assert(resp1.GetResponseStatusCode(), Equals, 404)
 	c.Assert(resp1.GetResponseBody(), IsNil)
 
-	c.Assert(resp2.GetResponseStatusCode(), Equals, 504)
+	c.Assert(resp2.GetResponseStatusCode(), Equals, 404)
 	c.Assert(resp2.GetResponseBody(), IsNil)
 }
+
+func (s *FileTestSuite) TestList(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bfilelist")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/alerts/team", 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/alerts/a.yml", []byte("a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/alerts/team/b.yml", []byte("b"), 0644), IsNil)
+
+	u, err := url.Parse(dir + "/alerts")
+	c.Assert(err, IsNil)
+	method, err := NewFileMethodWithURL(u)
+	c.Assert(err, IsNil)
+	files, err := method.(Lister).List(u)
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, []string{"a.yml", "team/b.yml"})
+
+	u, err = url.Parse(dir + "/nonexistent")
+	c.Assert(err, IsNil)
+	_, err = method.(Lister).List(u)
+	c.Assert(err, NotNil)
+}
+
+func (s *FileTestSuite) TestWatch(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "bfilewatch")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(dir+"/alerts", 0755), IsNil)
+
+	u, err := url.Parse("file://" + dir)
+	c.Assert(err, IsNil)
+	f := FileMethod{Watched: true}
+	c.Assert(f.WatchID(u), Equals, "file:"+dir)
+	c.Assert(FileMethod{}.WatchID(u), Equals, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string)
+	done := make(chan error)
+	go func() {
+		done <- f.Watch(ctx, u, func(paths []string) { changes <- paths })
+	}()
+	// give the watch the time to be set up
+	time.Sleep(100 * time.Millisecond)
+
+	// the changes which follow one another are handed on together
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/alerts/a.yml", []byte("a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(dir+"/prometheus.yml", []byte("b"), 0644), IsNil)
+	paths := <-changes
+	sort.Strings(paths)
+	c.Assert(paths, DeepEquals, []string{dir + "/alerts/a.yml", dir + "/prometheus.yml"})
+
+	// the new directories are watched too
+	c.Assert(os.Mkdir(dir+"/rules", 0755), IsNil)
+	c.Assert(<-changes, DeepEquals, []string{dir + "/rules"})
+	c.Assert(ioutil.WriteFile(dir+"/rules/r.yml", []byte("r"), 0644), IsNil)
+	c.Assert(<-changes, DeepEquals, []string{dir + "/rules/r.yml"})
+
+	cancel()
+	c.Assert(<-done, Equals, context.Canceled)
+
+	// the watch fails on a missing directory
+	u, err = url.Parse("file://" + dir + "/nonexistent")
+	c.Assert(err, IsNil)
+	c.Assert(f.Watch(context.Background(), u, func([]string) {}), ErrorMatches, "FileMethod.Watch\\(\\): could not watch .*nonexistent err=.*")
+}
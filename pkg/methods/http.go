@@ -13,16 +13,19 @@ governing permissions and limitations under the License.
 package methods
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -36,6 +39,7 @@ import (
 )
 
 const (
+	maxIndexDepth       = 16
 	defaultRetryWaitMin = 5
 	defaultRetryWaitMax = 15
 	defaultRetries      = 5
@@ -45,7 +49,7 @@ const (
 type HTTPMethod struct {
 	Client                *retryablehttp.Client `json:"-"`
 	Manager               *string               `json:"-"`
-	Host                  string                `mapstruecture:"host" json:"host,omitempty"`
+	Host                  string                `mapstructure:"host" json:"host,omitempty"`
 	Retries               string                `mapstructure:"retries" json:"retries"`
 	RetryWaitMax          string                `mapstructure:"retry-wait-max" json:"retry-wait-max"`
 	RetryWaitMin          string                `mapstructure:"retry-wait-min" json:"retry-wait-min"`
@@ -55,6 +59,11 @@ type HTTPMethod struct {
 	AuthUser              string                `mapstructure:"auth-user" json:"auth-user,omitempty"`
 	CfgInsecureSkipVerify string                `mapstructure:"insecure-skip-verify" json:"-"`
 	InsecureSkipVerify    bool                  `json:"insecure-skip-verify"`
+	SourceAddress         string                `mapstructure:"source-address" json:"source-address,omitempty"`
+	IPPreference          string                `mapstructure:"ip-preference" json:"ip-preference,omitempty"`
+	ConnectTo             string                `mapstructure:"connect-to" json:"connect-to,omitempty"`
+	HostHeader            string                `mapstructure:"host-header" json:"host-header,omitempty"`
+	TLSServerName         string                `mapstructure:"tls-server-name" json:"tls-server-name,omitempty"`
 }
 
 type HTTPMethodOpts struct {
@@ -105,9 +114,25 @@ func NewHTTPMethod(manager *string, entry *string) (Method, error) {
 		newRetryWaitMin = defaultRetryWaitMin
 	}
 
+	result.SourceAddress = environment.GetVar(result.SourceAddress)
+	result.IPPreference = strings.ToLower(environment.GetVar(result.IPPreference))
+	dial, err := NewDialContext(result.SourceAddress, result.IPPreference)
+	if err != nil {
+		return HTTPMethod{}, err
+	}
+	result.ConnectTo = strings.TrimSpace(environment.GetVar(result.ConnectTo))
+	if result.ConnectTo != "" {
+		if dial, err = connectTo(result.ConnectTo, dial); err != nil {
+			return HTTPMethod{}, err
+		}
+	}
+	result.HostHeader = strings.TrimSpace(environment.GetVar(result.HostHeader))
+	result.TLSServerName = strings.TrimSpace(environment.GetVar(result.TLSServerName))
+
 	result.InsecureSkipVerify = strings.ToLower(environment.GetVar(result.CfgInsecureSkipVerify)) == "true"
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: result.InsecureSkipVerify},
+		DialContext:     dial,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: result.InsecureSkipVerify, ServerName: result.TLSServerName},
 	}
 
 	result.Client = retryablehttp.NewClient()
@@ -124,6 +149,22 @@ func NewHTTPMethod(manager *string, entry *string) (Method, error) {
 }
 
 func (h HTTPMethod) Get(u *url.URL) (*Response, error) {
+	return h.GetWithContext(context.Background(), u)
+}
+
+// GetWithContext gets the url, and gives up on the request, and its retries,
+// once ctx is done.
+func (h HTTPMethod) GetWithContext(ctx context.Context, u *url.URL) (*Response, error) {
+	return h.get(ctx, u, Validators{})
+}
+
+// GetIfModified gets the url with If-None-Match and If-Modified-Since set from
+// the validators, so that an unchanged file is not downloaded again.
+func (h HTTPMethod) GetIfModified(ctx context.Context, u *url.URL, v Validators) (*Response, error) {
+	return h.get(ctx, u, v)
+}
+
+func (h HTTPMethod) get(ctx context.Context, u *url.URL, v Validators) (*Response, error) {
 	var (
 		err       error
 		r         *http.Response
@@ -143,6 +184,16 @@ func (h HTTPMethod) Get(u *url.URL) (*Response, error) {
 	if err != nil {
 		return &Response{}, err
 	}
+	req.Request = req.Request.WithContext(ctx)
+	if h.HostHeader != "" {
+		req.Host = h.HostHeader
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
 
 	if h.AuthUser != "" && h.AuthToken != "" {
 		authType = strings.ToLower(environment.GetVar(h.AuthType))
@@ -172,6 +223,7 @@ func (h HTTPMethod) Get(u *url.URL) (*Response, error) {
 		} else {
 			res.body = r.Body
 			res.statusCode = r.StatusCode
+			res.validators = responseValidators(r)
 			return &res, err
 		}
 	case "token-key":
@@ -183,8 +235,10 @@ func (h HTTPMethod) Get(u *url.URL) (*Response, error) {
 	// h.Client.HTTPClient.Transport is a http.RoundTripper? Have to fudge some items.
 	// This check has to happen when you specify -tls.insecure-skip-verify on command line
 	if (h.InsecureSkipVerify == true) && (h.Client.HTTPClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify == false) {
+		t := h.Client.HTTPClient.Transport.(*http.Transport)
 		h.Client.HTTPClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify},
+			DialContext:     t.DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify, ServerName: t.TLSClientConfig.ServerName},
 		}
 	}
 
@@ -194,12 +248,90 @@ func (h HTTPMethod) Get(u *url.URL) (*Response, error) {
 	}
 	res.body = r.Body
 	res.statusCode = r.StatusCode
+	res.validators = responseValidators(r)
 	return &res, err
 }
 
+// indexLink matches the links of an index page, as served by the autoindex of
+// nginx or apache, or by python's http.server.
+var indexLink = regexp.MustCompile(`(?i)href\s*=\s*"([^"]*)"`)
+
+// List returns the files linked from the index page of the directory, and,
+// recursively, from the index pages of its subdirectories, which are the
+// links ending in a slash. Only the links underneath the directory are
+// followed.
+func (h HTTPMethod) List(u *url.URL) ([]string, error) {
+	var res []string
+
+	seen := make(map[string]bool)
+	if err := h.list(u, "", 0, seen, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h HTTPMethod) list(u *url.URL, prefix string, depth int, seen map[string]bool, res *[]string) error {
+	if depth > maxIndexDepth {
+		return fmt.Errorf("HTTPMethod::List(): index pages are nested too deep at %v", prefix)
+	}
+
+	dir := *u
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path = dir.Path + "/"
+	}
+	dir.RawPath = ""
+	r, err := h.get(context.Background(), &dir, Validators{})
+	if err != nil {
+		return fmt.Errorf("HTTPMethod::List(): caught error for index page err=%v", err.Error())
+	}
+	defer r.body.Close()
+	if r.statusCode != http.StatusOK {
+		return fmt.Errorf("HTTPMethod::List(): caught status code %v for index page %v", r.statusCode, dir.Path)
+	}
+	page, err := ioutil.ReadAll(r.body)
+	if err != nil {
+		return fmt.Errorf("HTTPMethod::List(): caught error reading index page err=%v", err.Error())
+	}
+
+	for _, m := range indexLink.FindAllStringSubmatch(string(page), -1) {
+		link, err := dir.Parse(html.UnescapeString(m[1]))
+		if err != nil || link.RawQuery != "" || (link.Host != "" && link.Host != dir.Host) {
+			continue
+		}
+		// the sort links, and the parent directory, are not files
+		if !strings.HasPrefix(link.Path, dir.Path) || link.Path == dir.Path {
+			continue
+		}
+		name := prefix + strings.TrimPrefix(link.Path, dir.Path)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if strings.HasSuffix(name, "/") {
+			sub := dir
+			sub.Path = link.Path
+			if err := h.list(&sub, name, depth+1, seen, res); err != nil {
+				return err
+			}
+			continue
+		}
+		*res = append(*res, name)
+	}
+	return nil
+}
+
+// responseValidators returns the cache validators of the response.
+func responseValidators(r *http.Response) Validators {
+	return Validators{ETag: r.Header.Get("ETag"), LastModified: r.Header.Get("Last-Modified")}
+}
+
 func (h *HTTPMethod) MethodRetryPolicy(resp *http.Response, err error) (bool, error) {
 	// This is actually the default RetryPolicy from the go-retryablehttp library. The only
 	// change is the metrics monitor. We want to keep track of all the reload failures.
+	// A cancelled request is not retried.
+	if opErr, ok := err.(*url.Error); ok && (opErr.Err == context.Canceled || opErr.Err == context.DeadlineExceeded) {
+		return false, err
+	}
 	if (err != nil) && (h.Manager != nil) {
 		opErr := err.(*url.Error)
 		metrics.SetButlerContactRetryVal(metrics.SUCCESS, *h.Manager, metrics.GetStatsLabel(opErr.URL))
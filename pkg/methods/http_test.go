@@ -0,0 +1,307 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&HTTPTestSuite{})
+
+type HTTPTestSuite struct {
+}
+
+func (s *HTTPTestSuite) TestgetBasicAuthorization(c *C) {
+	username := "testing"
+	password := "testing"
+	result := "Basic dGVzdGluZzp0ZXN0aW5n"
+	r := getBasicAuthorization(username, password)
+	c.Assert(r, Equals, result)
+}
+
+func (s *HTTPTestSuite) TestgetMD5(c *C) {
+	result := "e2c50ded5d3990bdabeb4b44c4411f18"
+	res := getMD5("hiya")
+	c.Assert(result, Equals, res)
+}
+
+func (s *HTTPTestSuite) TestgetCnonce(c *C) {
+	c.Assert(len(getCnonce()), Equals, 16)
+}
+
+func (s *HTTPTestSuite) TestgetDigestAuthorization(c *C) {
+	resp := &http.Response{}
+	header := http.Header{}
+	header.Add("Date", "Mon, 04 Jun 2018 14:33:09 GMT")
+	header.Add("Content-Type", "text/html")
+	header.Add("Www-Authenticate", `Digest algorithm="MD5", qop="auth", realm="testing", nonce="5b25940d5b154da5"`)
+	resp.Header = header
+	parts := digestDigestParts(resp)
+	res := getDigestAuthorization(parts)
+	c.Assert(res, Matches, `.*realm="testing", nonce="5b25940d5b154da5".*qop="auth".*`)
+}
+
+func (s *HTTPTestSuite) TestdigestDigestParts(c *C) {
+	resp := &http.Response{}
+	header := http.Header{}
+	header.Add("Date", "Mon, 04 Jun 2018 14:33:09 GMT")
+	header.Add("Content-Type", "text/html")
+	header.Add("Www-Authenticate", `Digest algorithm="MD5", qop="auth", realm="testing", nonce="5b25940d5b154da5"`)
+	resp.Header = header
+	res := digestDigestParts(resp)
+	c.Assert(res["realm"], Equals, "testing")
+	c.Assert(res["qop"], Equals, "auth")
+	c.Assert(res["nonce"], Equals, "5b25940d5b154da5")
+	c.Assert(len(res), Equals, 3)
+}
+
+func (s *HTTPTestSuite) TestGetWithContext(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	h := HTTPMethod{Client: retryablehttp.NewClient()}
+	h.Client.RetryMax = 3
+	h.Client.RetryWaitMin = time.Second
+	h.Client.CheckRetry = h.MethodRetryPolicy
+	u, _ := url.Parse(server.URL + "/butler.toml")
+
+	// the request is given up on, and is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := GetWithContext(ctx, h, u)
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+
+	// nothing is got once ctx is done
+	_, err = GetWithContext(ctx, FileMethod{}, u)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *HTTPTestSuite) TestGetIfModified(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	h := HTTPMethod{Client: retryablehttp.NewClient()}
+	u, _ := url.Parse(server.URL + "/butler.toml")
+
+	// without validators the file is always got
+	res, err := GetIfModified(context.Background(), h, u, Validators{})
+	c.Assert(err, IsNil)
+	c.Assert(res.GetResponseStatusCode(), Equals, http.StatusOK)
+	res.GetResponseBody().Close()
+	v := res.GetResponseValidators()
+	c.Assert(v.ETag, Equals, `"v1"`)
+	c.Assert(v.LastModified, Equals, "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	res, err = GetIfModified(context.Background(), h, u, v)
+	c.Assert(err, IsNil)
+	c.Assert(res.GetResponseStatusCode(), Equals, http.StatusNotModified)
+	res.GetResponseBody().Close()
+
+	res, err = GetIfModified(context.Background(), h, u, Validators{ETag: `"v0"`})
+	c.Assert(err, IsNil)
+	c.Assert(res.GetResponseStatusCode(), Equals, http.StatusOK)
+	res.GetResponseBody().Close()
+}
+
+func (s *HTTPTestSuite) TestList(c *C) {
+	pages := map[string]string{
+		"/rules/": `<a href="../">../</a><a href="?C=N;O=D">Name</a>
+<a href="a.rules">a.rules</a> <a href="b.rules">b.rules</a> <a href="a.rules">a.rules</a>
+<a href="sub/">sub/</a> <a href="/other/c.rules">c.rules</a>`,
+		"/rules/sub/": `<a href="/rules/">Parent Directory</a> <a HREF="c%20d.rules">c d.rules</a>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	h := HTTPMethod{Client: retryablehttp.NewClient()}
+	u, _ := url.Parse(server.URL + "/rules")
+	files, err := h.List(u)
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, []string{"a.rules", "b.rules", "sub/c d.rules"})
+
+	// a directory without an index page can not be listed
+	u, _ = url.Parse(server.URL + "/missing")
+	_, err = h.List(u)
+	c.Assert(err, ErrorMatches, ".*status code 404.*")
+}
+
+func (s *HTTPTestSuite) TestDialContext(c *C) {
+	dial, err := NewDialContext("", "")
+	c.Assert(err, IsNil)
+	c.Assert(dial, IsNil)
+	_, err = NewDialContext("", "ipv5")
+	c.Assert(err, ErrorMatches, "invalid ip-preference ipv5")
+	_, err = NewDialContext("127.0.0.1", "ipv6")
+	c.Assert(err, ErrorMatches, "source-address 127.0.0.1 is not an ipv6 address")
+	_, err = NewDialContext("butler-missing0", "")
+	c.Assert(err, ErrorMatches, "invalid source-address butler-missing0.*")
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		c.Skip("ipv6 is not available")
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	get := func(source string, preference string) (string, error) {
+		dial, err := NewDialContext(source, preference)
+		c.Assert(err, IsNil)
+		client := &http.Client{Transport: &http.Transport{DialContext: dial}}
+		r, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		return string(body), err
+	}
+
+	// the connections are bound to the source address
+	remote, err := get("::1", "ipv6")
+	c.Assert(err, IsNil)
+	c.Assert(remote, Matches, `\[::1\]:.*`)
+	ifaces, err := net.Interfaces()
+	c.Assert(err, IsNil)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			remote, err = get(iface.Name, "ipv6")
+			c.Assert(err, IsNil)
+			c.Assert(remote, Matches, `\[::1\]:.*`)
+		}
+	}
+
+	// and only made over the ip version of the preference
+	_, err = get("", "ipv4")
+	c.Assert(err, NotNil)
+	_, err = get("127.0.0.1", "")
+	c.Assert(err, NotNil)
+}
+
+func (s *HTTPTestSuite) TestSetResolver(c *C) {
+	servers, err := ParseDNSServers([]string{"10.0.0.2", " [fd00::2]:5353", "fd00::3", ""})
+	c.Assert(err, IsNil)
+	c.Assert(servers, DeepEquals, []string{"10.0.0.2:53", "[fd00::2]:5353", "[fd00::3]:53"})
+	_, err = ParseDNSServers([]string{"dns.domain.com"})
+	c.Assert(err, ErrorMatches, "invalid dns server dns.domain.com")
+
+	// a dns server which never answers
+	l, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	queries := make(chan struct{}, 16)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			if _, _, err := l.ReadFrom(buf); err != nil {
+				return
+			}
+			queries <- struct{}{}
+		}
+	}()
+
+	resolver := net.DefaultResolver
+	defer func() { net.DefaultResolver = resolver }()
+	c.Assert(SetResolver([]string{l.LocalAddr().String()}, time.Second), IsNil)
+
+	// the queries go to the dns servers, and time out
+	start := time.Now()
+	_, err = net.LookupHost("repo.butler.invalid")
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(start) < 15*time.Second, Equals, true)
+	c.Assert(len(queries) > 0, Equals, true)
+}
+
+func (s *HTTPTestSuite) TestConnectTo(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	get := func(options string) string {
+		viper.SetConfigType("toml")
+		c.Assert(viper.ReadConfig(bytes.NewBufferString("[test-manager.repo.https]\n"+options)), IsNil)
+		manager, entry := "test-manager", "test-manager.repo.https"
+		method, err := NewHTTPMethod(&manager, &entry)
+		c.Assert(err, IsNil)
+		u, _ := url.Parse("https://origin.domain.com:" + port + "/prometheus.yml")
+		r, err := method.Get(u)
+		c.Assert(err, IsNil)
+		defer r.GetResponseBody().Close()
+		body, err := ioutil.ReadAll(r.GetResponseBody())
+		c.Assert(err, IsNil)
+		return string(body)
+	}
+
+	// the connections go to the connect-to address, with the Host header and
+	// the server name of the url
+	c.Assert(get(`insecure-skip-verify = "true"
+connect-to = "127.0.0.1"`), Equals, "origin.domain.com:"+port+" origin.domain.com")
+
+	// unless they are overridden
+	c.Assert(get(`insecure-skip-verify = "true"
+connect-to = "127.0.0.1:`+port+`"
+host-header = "a.domain.com"
+tls-server-name = "b.domain.com"`), Equals, "a.domain.com b.domain.com")
+
+	// the server name is verified against the certificate
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBufferString("[test-manager.repo.https]\nconnect-to = \"127.0.0.1\"\nretries = \"1\"\nretry-wait-min = \"1\"\nretry-wait-max = \"1\"\n")), IsNil)
+	manager, entry := "test-manager", "test-manager.repo.https"
+	method, err := NewHTTPMethod(&manager, &entry)
+	c.Assert(err, IsNil)
+	u, _ := url.Parse("https://origin.domain.com:" + port + "/prometheus.yml")
+	_, err = method.Get(u)
+	c.Assert(err, NotNil)
+
+	_, err = connectTo("http://origin.domain.com", nil)
+	c.Assert(err, ErrorMatches, "invalid connect-to .*")
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	//log "github.com/sirupsen/logrus"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Method interface {
+	Get(*url.URL) (*Response, error)
+}
+
+// Lister is implemented by the methods which are able to enumerate the files
+// underneath a remote directory, or prefix. List returns the paths of the
+// files relative to the directory, using forward slashes.
+type Lister interface {
+	List(*url.URL) ([]string, error)
+}
+
+// ContextMethod is implemented by the methods whose Get can be cancelled, eg:
+// when butler shuts down in the middle of a download.
+type ContextMethod interface {
+	GetWithContext(context.Context, *url.URL) (*Response, error)
+}
+
+// GetWithContext gets the url with the method, and gives up once ctx is done.
+// The methods which cannot be cancelled are only checked before the get.
+func GetWithContext(ctx context.Context, m Method, u *url.URL) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return &Response{}, err
+	}
+	if cm, ok := m.(ContextMethod); ok {
+		return cm.GetWithContext(ctx, u)
+	}
+	return m.Get(u)
+}
+
+// Validators are the cache validators which were returned along with a file,
+// and which let a later get of the file find out whether it has changed.
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last-modified,omitempty"`
+}
+
+// IsZero returns true when there are no validators.
+func (v Validators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// ConditionalMethod is implemented by the methods which are able to get a
+// file only when it has changed since it was returned with the validators.
+// An unchanged file is returned as http.StatusNotModified, without a body.
+type ConditionalMethod interface {
+	GetIfModified(context.Context, *url.URL, Validators) (*Response, error)
+}
+
+// GetIfModified gets the url with the method, unless it is unchanged since it
+// was returned with the validators. The methods which cannot get files
+// conditionally always get the file.
+func GetIfModified(ctx context.Context, m Method, u *url.URL, v Validators) (*Response, error) {
+	if cm, ok := m.(ConditionalMethod); ok && !v.IsZero() {
+		if err := ctx.Err(); err != nil {
+			return &Response{}, err
+		}
+		return cm.GetIfModified(ctx, u, v)
+	}
+	return GetWithContext(ctx, m, u)
+}
+
+// Watcher is implemented by the methods which are able to be told of the
+// changes to the repo, eg: through S3 event notifications, rather than only
+// finding out when the manager runs. The repo is the url the method gets for
+// the repo-path of the manager. WatchID identifies what the method watches
+// for the repo, so that the managers which share it share a single watch, and
+// is empty when the method is not set up to watch. Watch calls changed with
+// the paths of the files which changed, in the form of the paths which the
+// method gets, and returns once ctx is done, or it cannot watch any longer.
+type Watcher interface {
+	WatchID(repo *url.URL) string
+	Watch(ctx context.Context, repo *url.URL, changed func(paths []string)) error
+}
+
+// WatchDelay is how long a watch waits for the changes which follow a
+// change, eg: when several files are written one after the other, so that
+// they are handed on together.
+var WatchDelay = 250 * time.Millisecond
+
+type MethodOpts interface {
+	GetScheme() string
+}
+
+type Response struct {
+	body       io.ReadCloser
+	statusCode int
+	validators Validators
+}
+
+func (r Response) GetResponseBody() io.ReadCloser {
+	return r.body
+}
+
+func (r Response) GetResponseStatusCode() int {
+	return r.statusCode
+}
+
+// GetResponseValidators returns the cache validators of the file, if the
+// method returned any.
+func (r Response) GetResponseValidators() Validators {
+	return r.validators
+}
+
+func New(manager *string, method string, entry *string) (Method, error) {
+	method = strings.ToLower(method)
+	switch method {
+	case "http", "https":
+		return NewHTTPMethod(manager, entry)
+	case "s3":
+		return NewS3Method(manager, entry)
+	case "file":
+		return NewFileMethod(manager, entry)
+	case "blob":
+		return NewBlobMethod(manager, entry)
+	case "etcd":
+		return NewEtcdMethod(manager, entry)
+	default:
+		if path, ok := pluginMethods.Path(method); ok {
+			return NewPluginMethod(manager, method, path, entry)
+		}
+		return NewGenericMethod(manager, entry)
+	}
+}
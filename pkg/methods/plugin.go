@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/adobe/butler/internal/plugins"
+
+	"github.com/spf13/viper"
+)
+
+// defaultPluginTimeout is how long a method plugin may take to get, or list,
+// the files.
+const defaultPluginTimeout = 60 * time.Second
+
+// pluginMethods are the method plugins, which can not replace the methods
+// built into butler.
+var pluginMethods = plugins.NewRegistry(plugins.MethodPrefix, "http", "https", "s3", "file", "blob", "etcd")
+
+// LoadPlugins registers the method plugins in the dir, which are named
+// butler-method-<method>, see package plugins. It returns the methods it
+// registered.
+func LoadPlugins(dir string) ([]string, error) {
+	return pluginMethods.Load(dir)
+}
+
+// IsPlugin returns whether the method is provided by a plugin.
+func IsPlugin(method string) bool {
+	_, ok := pluginMethods.Path(method)
+	return ok
+}
+
+// Plugins returns the methods which are provided by plugins.
+func Plugins() []string {
+	return pluginMethods.Names()
+}
+
+// PluginMethod retrieves the files with a method plugin. The get operation
+// writes the file to stdout, and the list operation writes a JSON list of the
+// files underneath the directory, relative to it.
+type PluginMethod struct {
+	Manager string                 `json:"-"`
+	Method  string                 `json:"method"`
+	Path    string                 `json:"-"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// PluginMethodOpts are the options of the method plugin which retrieves the
+// butler configuration.
+type PluginMethodOpts struct {
+	Scheme string
+}
+
+func (o PluginMethodOpts) GetScheme() string {
+	return o.Scheme
+}
+
+// PluginMethodRequest is written to the stdin of a method plugin. Options
+// are the options of the method in the repo of the manager.
+type PluginMethodRequest struct {
+	Manager string                 `json:"manager"`
+	URL     string                 `json:"url"`
+	Options map[string]interface{} `json:"options"`
+}
+
+func NewPluginMethod(manager *string, method string, path string, entry *string) (Method, error) {
+	result := PluginMethod{Method: method, Path: path}
+	if manager != nil {
+		result.Manager = *manager
+	}
+	if entry != nil {
+		if err := viper.UnmarshalKey(*entry, &result.Options); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (p PluginMethod) Get(u *url.URL) (*Response, error) {
+	return p.GetWithContext(context.Background(), u)
+}
+
+func (p PluginMethod) GetWithContext(ctx context.Context, u *url.URL) (*Response, error) {
+	out, err := p.run(ctx, "get", u)
+	if err != nil {
+		// 504 is hokey, but we need some bogus code.
+		return &Response{statusCode: 504}, fmt.Errorf("PluginMethod.Get(): caught error running plugin err=%v", err.Error())
+	}
+	return &Response{statusCode: 200, body: ioutil.NopCloser(bytes.NewReader(out))}, nil
+}
+
+func (p PluginMethod) List(u *url.URL) ([]string, error) {
+	var res []string
+	out, err := p.run(context.Background(), "list", u)
+	if err == nil {
+		err = json.Unmarshal(out, &res)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("PluginMethod.List(): caught error listing directory err=%v", err.Error())
+	}
+	return res, nil
+}
+
+func (p PluginMethod) run(ctx context.Context, op string, u *url.URL) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultPluginTimeout)
+	defer cancel()
+	return plugins.Run(ctx, p.Path, op, PluginMethodRequest{Manager: p.Manager, URL: u.String(), Options: p.Options})
+}
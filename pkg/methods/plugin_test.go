@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PluginTestSuite{})
+
+type PluginTestSuite struct {
+	dir string
+}
+
+// testMethodPlugin echoes its request on get, and lists two files.
+var testMethodPlugin = `#!/bin/sh
+case "$1" in
+get) cat ;;
+list) echo '["a.yml", "rules/b.yml"]' ;;
+*) echo "unknown operation $1" >&2; exit 3 ;;
+esac
+`
+
+var testPluginViperConfig = []byte(`[test-manager]
+  repos = ["repo"]
+  [test-manager.repo]
+    method = "vault"
+    [test-manager.repo.vault]
+      mount = "secret"
+`)
+
+func (s *PluginTestSuite) SetUpSuite(c *C) {
+	s.dir = c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "butler-method-vault"), []byte(testMethodPlugin), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "butler-method-broken"), []byte("#!/bin/sh\necho nope >&2\nexit 1\n"), 0755), IsNil)
+	// not executable
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "butler-method-readme"), []byte("docs"), 0644), IsNil)
+	// can not replace a built in method
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "butler-method-http"), []byte(testMethodPlugin), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "butler-reloader-vault"), []byte(testMethodPlugin), 0755), IsNil)
+
+	loaded, err := LoadPlugins(s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, DeepEquals, []string{"broken", "vault"})
+}
+
+func (s *PluginTestSuite) TestLoadPlugins(c *C) {
+	c.Assert(IsPlugin("vault"), Equals, true)
+	c.Assert(IsPlugin("VAULT"), Equals, true)
+	c.Assert(IsPlugin("http"), Equals, false)
+	c.Assert(IsPlugin("readme"), Equals, false)
+	c.Assert(Plugins(), DeepEquals, []string{"broken", "vault"})
+
+	_, err := LoadPlugins(filepath.Join(s.dir, "missing"))
+	c.Assert(err, ErrorMatches, "could not read plugins directory .*")
+}
+
+func (s *PluginTestSuite) TestPluginMethodGet(c *C) {
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBuffer(testPluginViperConfig)), IsNil)
+
+	manager := "test-manager"
+	entry := "test-manager.repo.vault"
+	m, err := New(&manager, "vault", &entry)
+	c.Assert(err, IsNil)
+	c.Assert(m, FitsTypeOf, PluginMethod{})
+
+	u, _ := url.Parse("vault://repo/configs/prometheus.yml")
+	res, err := m.Get(u)
+	c.Assert(err, IsNil)
+	c.Assert(res.GetResponseStatusCode(), Equals, 200)
+	body, err := ioutil.ReadAll(res.GetResponseBody())
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `{"manager":"test-manager","url":"vault://repo/configs/prometheus.yml","options":{"mount":"secret"}}`)
+
+	files, err := m.(Lister).List(u)
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, []string{"a.yml", "rules/b.yml"})
+}
+
+func (s *PluginTestSuite) TestPluginMethodFailure(c *C) {
+	m, err := New(nil, "broken", nil)
+	c.Assert(err, IsNil)
+
+	u, _ := url.Parse("broken://repo/prometheus.yml")
+	res, err := m.Get(u)
+	c.Assert(res.GetResponseStatusCode(), Equals, 504)
+	c.Assert(err, ErrorMatches, "PluginMethod.Get\\(\\): .*plugin butler-method-broken get failed: exit status 1: nope")
+
+	os.Remove(filepath.Join(s.dir, "butler-method-broken"))
+	_, err = m.Get(u)
+	c.Assert(err, NotNil)
+}
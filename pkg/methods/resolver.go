@@ -0,0 +1,114 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultDNSTimeout is the timeout of each query to the dns servers of
+	// SetResolver.
+	DefaultDNSTimeout = 5 * time.Second
+	defaultDNSPort    = "53"
+)
+
+// ParseDNSServers returns the addresses of the dns servers, which are ip
+// addresses with an optional port, eg: 10.0.0.2 or [fd00::2]:5353.
+func ParseDNSServers(servers []string) ([]string, error) {
+	var res []string
+	for _, s := range servers {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			host, port = strings.Trim(s, "[]"), defaultDNSPort
+		}
+		if net.ParseIP(host) == nil || port == "" {
+			return nil, fmt.Errorf("invalid dns server %v", s)
+		}
+		res = append(res, net.JoinHostPort(host, port))
+	}
+	return res, nil
+}
+
+// SetResolver has the host names butler connects to, eg: of the butler
+// configuration, the repos and the notifiers, resolved by the dns servers
+// rather than those of /etc/resolv.conf, eg: when they are only known to an
+// internal resolver the host does not use. Each query goes to the next
+// server, so that a query which times out is retried on another one, and is
+// given up on after timeout. No servers leaves the resolver of the system.
+func SetResolver(servers []string, timeout time.Duration) error {
+	addrs, err := ParseDNSServers(servers)
+	if err != nil || len(addrs) == 0 {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultDNSTimeout
+	}
+
+	var next uint32
+	dialer := &net.Dialer{Timeout: timeout}
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			server := addrs[int(atomic.AddUint32(&next, 1)-1)%len(addrs)]
+			c, err := dialer.DialContext(ctx, network, server)
+			if err != nil {
+				return nil, err
+			}
+			end := time.Now().Add(timeout)
+			c.SetDeadline(end)
+			if u, ok := c.(*net.UDPConn); ok {
+				return &dnsUDPConn{UDPConn: u, end: end}, nil
+			}
+			return &dnsConn{Conn: c, end: end}, nil
+		},
+	}
+	return nil
+}
+
+// dnsConn and dnsUDPConn keep the resolver, which sets the deadline of the
+// queries from /etc/resolv.conf, from extending them past the timeout. The
+// resolver tells the udp connections apart by their being net.PacketConn.
+type dnsConn struct {
+	net.Conn
+	end time.Time
+}
+
+func (c *dnsConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(earliest(t, c.end))
+}
+
+type dnsUDPConn struct {
+	*net.UDPConn
+	end time.Time
+}
+
+func (c *dnsUDPConn) SetDeadline(t time.Time) error {
+	return c.UDPConn.SetDeadline(earliest(t, c.end))
+}
+
+func earliest(t time.Time, end time.Time) time.Time {
+	if t.IsZero() || t.After(end) {
+		return end
+	}
+	return t
+}
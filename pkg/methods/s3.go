@@ -14,16 +14,20 @@ package methods
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 
 	"github.com/adobe/butler/internal/environment"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -40,6 +44,10 @@ type S3Method struct {
 	Region          string                `mapstructure:"region" json:"region"`
 	SecretAccessKey string                `mapstructure:"secret-access-key" json:"-"`
 	SessionToken    string                `mapstructure:"session-token" json:"-"`
+	SQSQueueURL     string                `mapstructure:"sqs-queue-url" json:"sqs-queue-url,omitempty"`
+	SourceAddress   string                `mapstructure:"source-address" json:"source-address,omitempty"`
+	IPPreference    string                `mapstructure:"ip-preference" json:"ip-preference,omitempty"`
+	sqs             *client.Client
 }
 
 type S3MethodOpts struct {
@@ -88,18 +96,37 @@ func NewS3Method(manager *string, entry *string) (Method, error) {
 		result.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
 	}
 
-	sess, err := session.NewSession(&aws.Config{
+	result.SourceAddress = environment.GetVar(result.SourceAddress)
+	result.IPPreference = strings.ToLower(environment.GetVar(result.IPPreference))
+	dial, err := NewDialContext(result.SourceAddress, result.IPPreference)
+	if err != nil {
+		return S3Method{}, err
+	}
+
+	cfg := &aws.Config{
 		Region: aws.String(result.Region),
 		Credentials: credentials.NewStaticCredentials(result.AccessKeyID,
 			result.SecretAccessKey,
 			result.SessionToken),
-	})
+	}
+	if dial != nil {
+		cfg.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DialContext: dial}}
+	}
+	sess, err := session.NewSession(cfg)
 	if err != nil {
 		return S3Method{}, errors.New("could not start s3 session")
 	}
 
 	downloader := s3manager.NewDownloader(sess)
 
+	result.SQSQueueURL = environment.GetVar(result.SQSQueueURL)
+	if result.SQSQueueURL != "" {
+		if u, err := url.Parse(result.SQSQueueURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return S3Method{}, fmt.Errorf("invalid s3 sqs-queue-url %v", result.SQSQueueURL)
+		}
+		result.sqs = newSQSClient(sess)
+	}
+
 	result.Downloader = downloader
 	result.Manager = manager
 
@@ -128,17 +155,22 @@ func NewS3MethodWithOpts(opts S3MethodOpts) (Method, error) {
 }
 
 func (s S3Method) Get(u *url.URL) (*Response, error) {
+	return s.GetWithContext(context.Background(), u)
+}
+
+// GetWithContext gets the key, and gives up on the download once ctx is done.
+func (s S3Method) GetWithContext(ctx context.Context, u *url.URL) (*Response, error) {
 	var (
 		response Response
 	)
 
-	tmpFile, err := ioutil.TempFile("/tmp", "s3pcmsfile")
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "s3pcmsfile")
 	if err != nil {
 		return &Response{}, fmt.Errorf("S3Method::Get(): could not create temp file err=%v", err)
 	}
 
 	log.Debugf("S3Method::Get(): going to download s3 region=%v, bucket=%v, key=%v", s.Region, s.Bucket, u.Path)
-	_, err = s.Downloader.Download(tmpFile,
+	_, err = s.Downloader.DownloadWithContext(ctx, tmpFile,
 		&s3.GetObjectInput{
 			Bucket: aws.String(s.Bucket),
 			Key:    aws.String(u.Path),
@@ -146,9 +178,9 @@ func (s S3Method) Get(u *url.URL) (*Response, error) {
 	if err != nil {
 		var code int
 		if e, ok := err.(awserr.RequestFailure); ok {
+			// eg: 404 for a key which does not exist
 			code = e.StatusCode()
-		}
-		if e, ok := err.(awserr.Error); ok {
+		} else if e, ok := err.(awserr.Error); ok {
 			err2 := e.OrigErr()
 			if err2 != nil {
 				err = err2
@@ -181,6 +213,36 @@ func (s S3Method) Get(u *url.URL) (*Response, error) {
 	return &response, nil
 }
 
+// List returns the keys underneath the prefix.
+func (s S3Method) List(u *url.URL) ([]string, error) {
+	var res []string
+
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	log.Debugf("S3Method::List(): going to list s3 region=%v, bucket=%v, prefix=%v", s.Region, s.Bucket, prefix)
+	err := s.Downloader.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			key := strings.TrimPrefix(aws.StringValue(o.Key), prefix)
+			// skip the "directory" placeholder objects
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+			res = append(res, key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S3Method::List(): caught error for list err=%v", err.Error())
+	}
+	return res, nil
+}
+
 func (o S3MethodOpts) GetScheme() string {
 	return o.Scheme
 }
@@ -0,0 +1,230 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sqsAPIVersion = "2012-11-05"
+
+	// sqsWaitTime is how long, in seconds, a receive waits for the S3 event
+	// notifications to arrive, the longest SQS allows.
+	sqsWaitTime = 20
+	// sqsMaxMessages is the most messages SQS returns at once.
+	sqsMaxMessages = 10
+)
+
+type sqsReceiveMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	MaxNumberOfMessages *int64  `type:"integer"`
+	QueueUrl            *string `type:"string" required:"true"`
+	WaitTimeSeconds     *int64  `type:"integer"`
+}
+
+type sqsMessage struct {
+	_ struct{} `type:"structure"`
+
+	Body          *string `type:"string"`
+	MessageId     *string `type:"string"`
+	ReceiptHandle *string `type:"string"`
+}
+
+type sqsReceiveMessageOutput struct {
+	_ struct{} `type:"structure"`
+
+	Messages []*sqsMessage `locationNameList:"Message" type:"list" flattened:"true"`
+}
+
+type sqsDeleteMessageInput struct {
+	_ struct{} `type:"structure"`
+
+	QueueUrl      *string `type:"string" required:"true"`
+	ReceiptHandle *string `type:"string" required:"true"`
+}
+
+type sqsDeleteMessageOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// s3Event is an S3 event notification, as S3 sends it to SQS, or wrapped in
+// the Message of an SNS notification, when the events are fanned out to a
+// queue per host through SNS.
+type s3Event struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+	Event   string `json:"Event"`
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// newSQSClient returns a client for the SQS query protocol, with the region
+// and credentials of the S3 session. The watch only needs to receive and
+// delete messages, so butler talks to SQS through the query protocol
+// handlers rather than pulling in the full service package.
+func newSQSClient(sess *session.Session) *client.Client {
+	c := sess.ClientConfig("sqs")
+	signingName := c.SigningName
+	if signingName == "" {
+		signingName = "sqs"
+	}
+	svc := client.New(*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "sqs",
+			SigningName:   signingName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    sqsAPIVersion,
+		},
+		c.Handlers,
+	)
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return svc
+}
+
+// WatchID returns the sqs-queue-url, which receives the S3 event
+// notifications of the bucket, or nothing when there is none. The queue is
+// shared by the repos of the bucket.
+func (s S3Method) WatchID(repo *url.URL) string {
+	if s.SQSQueueURL == "" {
+		return ""
+	}
+	return "s3:" + s.SQSQueueURL
+}
+
+// Watch receives the S3 event notifications of the bucket from the
+// sqs-queue-url, and calls changed with the paths of the objects which were
+// created or removed. The messages are deleted from the queue once changed
+// returns, or right away when they are not S3 events of the bucket. It
+// returns once ctx is done, or the queue cannot be received from.
+func (s S3Method) Watch(ctx context.Context, repo *url.URL, changed func(paths []string)) error {
+	if s.sqs == nil {
+		return errors.New("no sqs-queue-url to watch")
+	}
+	for ctx.Err() == nil {
+		out := &sqsReceiveMessageOutput{}
+		err := s.sqsCall(ctx, "ReceiveMessage", &sqsReceiveMessageInput{
+			MaxNumberOfMessages: aws.Int64(sqsMaxMessages),
+			QueueUrl:            aws.String(s.SQSQueueURL),
+			WaitTimeSeconds:     aws.Int64(sqsWaitTime),
+		}, out)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("S3Method::Watch(): could not receive from %v err=%v", s.SQSQueueURL, err.Error())
+		}
+
+		var paths []string
+		seen := make(map[string]bool)
+		for _, m := range out.Messages {
+			keys, err := s3EventKeys([]byte(aws.StringValue(m.Body)), s.Bucket)
+			if err != nil {
+				log.Warnf("S3Method::Watch(): skipping message %v of %v, which is not an S3 event notification. err=%v", aws.StringValue(m.MessageId), s.SQSQueueURL, err.Error())
+			}
+			for _, k := range keys {
+				if !seen[k] {
+					seen[k] = true
+					paths = append(paths, k)
+				}
+			}
+		}
+		if len(paths) > 0 {
+			log.Debugf("S3Method::Watch(): bucket=%v, changed=%v", s.Bucket, paths)
+			changed(paths)
+		}
+		// the messages are deleted even when the run fails, the scheduled
+		// runs retry it
+		for _, m := range out.Messages {
+			err := s.sqsCall(context.Background(), "DeleteMessage", &sqsDeleteMessageInput{
+				QueueUrl:      aws.String(s.SQSQueueURL),
+				ReceiptHandle: m.ReceiptHandle,
+			}, &sqsDeleteMessageOutput{})
+			if err != nil {
+				log.Warnf("S3Method::Watch(): could not delete message %v from %v. err=%v", aws.StringValue(m.MessageId), s.SQSQueueURL, err.Error())
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// sqsCall runs the query protocol action, until ctx is done.
+func (s S3Method) sqsCall(ctx context.Context, action string, input interface{}, output interface{}) error {
+	req := s.sqs.NewRequest(&request.Operation{Name: action, HTTPMethod: "POST", HTTPPath: "/"}, input, output)
+	req.SetContext(ctx)
+	return req.Send()
+}
+
+// s3EventKeys returns the paths, as the method gets them, of the objects of
+// the bucket which the ObjectCreated and ObjectRemoved records of the S3 event
+// notification are about. The s3:TestEvent which S3 sends when the
+// notifications are set up has none.
+func s3EventKeys(body []byte, bucket string) ([]string, error) {
+	var e s3Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	if e.Type == "Notification" {
+		if err := json.Unmarshal([]byte(e.Message), &e); err != nil {
+			return nil, err
+		}
+	}
+	if e.Records == nil && e.Event == "" {
+		return nil, errors.New("no records")
+	}
+	var res []string
+	for _, r := range e.Records {
+		if r.S3.Bucket.Name != bucket {
+			continue
+		}
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") && !strings.HasPrefix(r.EventName, "ObjectRemoved:") {
+			continue
+		}
+		// the keys are url encoded, with spaces as +
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, "/"+strings.TrimPrefix(key, "/"))
+	}
+	return res, nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package methods
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&S3EventsTestSuite{})
+
+type S3EventsTestSuite struct {
+}
+
+func s3EventBody(bucket string, event string, key string) string {
+	return fmt.Sprintf(`{"Records":[{"eventName":%q,"s3":{"bucket":{"name":%q},"object":{"key":%q}}}]}`, event, bucket, key)
+}
+
+func (s *S3EventsTestSuite) TestS3EventKeys(c *C) {
+	keys, err := s3EventKeys([]byte(s3EventBody("configs", "ObjectCreated:Put", "prometheus/alerts+rules%281%29.yml")), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"/prometheus/alerts rules(1).yml"})
+
+	keys, err = s3EventKeys([]byte(s3EventBody("configs", "ObjectRemoved:Delete", "prometheus/old.yml")), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"/prometheus/old.yml"})
+
+	// other buckets and other events are not changes
+	keys, err = s3EventKeys([]byte(s3EventBody("other", "ObjectCreated:Put", "prometheus/prometheus.yml")), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 0)
+	keys, err = s3EventKeys([]byte(s3EventBody("configs", "ObjectRestore:Completed", "prometheus/prometheus.yml")), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 0)
+	keys, err = s3EventKeys([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"configs"}`), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 0)
+
+	// fanned out through SNS
+	sns := fmt.Sprintf(`{"Type":"Notification","TopicArn":"arn:aws:sns:us-west-2:123456789012:configs","Message":%q}`, s3EventBody("configs", "ObjectCreated:Copy", "prometheus/prometheus.yml"))
+	keys, err = s3EventKeys([]byte(sns), "configs")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"/prometheus/prometheus.yml"})
+
+	_, err = s3EventKeys([]byte("not json"), "configs")
+	c.Assert(err, NotNil)
+	_, err = s3EventKeys([]byte(`{"foo":"bar"}`), "configs")
+	c.Assert(err, NotNil)
+}
+
+func (s *S3EventsTestSuite) TestWatch(c *C) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+		served  bool
+	)
+	bodies := []string{
+		s3EventBody("configs", "ObjectCreated:Put", "prometheus/prometheus.yml"),
+		s3EventBody("configs", "ObjectCreated:Put", "prometheus/prometheus.yml"),
+		s3EventBody("configs", "ObjectCreated:Put", "prometheus/alerts.yml"),
+		"garbage",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Form.Get("Action") {
+		case "ReceiveMessage":
+			c.Check(r.Form.Get("QueueUrl"), Equals, "https://sqs.us-west-2.amazonaws.com/123456789012/configs")
+			c.Check(r.Form.Get("WaitTimeSeconds"), Equals, "20")
+			fmt.Fprint(w, "<ReceiveMessageResponse><ReceiveMessageResult>")
+			if !served {
+				served = true
+				for i, b := range bodies {
+					fmt.Fprintf(w, "<Message><MessageId>%d</MessageId><ReceiptHandle>handle-%d</ReceiptHandle><Body>%s</Body></Message>", i, i, html.EscapeString(b))
+				}
+			}
+			fmt.Fprint(w, "</ReceiveMessageResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></ReceiveMessageResponse>")
+		case "DeleteMessage":
+			deleted = append(deleted, r.Form.Get("ReceiptHandle"))
+			fmt.Fprint(w, "<DeleteMessageResponse><ResponseMetadata><RequestId>2</RequestId></ResponseMetadata></DeleteMessageResponse>")
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	c.Assert(err, IsNil)
+	m := S3Method{Bucket: "configs", SQSQueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/configs", sqs: newSQSClient(sess)}
+	c.Assert(m.WatchID(nil), Equals, "s3:https://sqs.us-west-2.amazonaws.com/123456789012/configs")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string, 1)
+	done := make(chan error)
+	go func() {
+		done <- m.Watch(ctx, nil, func(paths []string) { changes <- paths })
+	}()
+	select {
+	case paths := <-changes:
+		c.Assert(paths, DeepEquals, []string{"/prometheus/prometheus.yml", "/prometheus/alerts.yml"})
+	case <-time.After(5 * time.Second):
+		c.Fatal("no changes")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		c.Assert(err, Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatal("the watch did not stop")
+	}
+	mu.Lock()
+	c.Assert(deleted, DeepEquals, []string{"handle-0", "handle-1", "handle-2", "handle-3"})
+	mu.Unlock()
+
+	// the s3 method does not watch without a queue
+	c.Assert(S3Method{Bucket: "configs"}.WatchID(nil), Equals, "")
+	c.Assert(S3Method{Bucket: "configs"}.Watch(context.Background(), nil, func([]string) {}), ErrorMatches, "no sqs-queue-url to watch")
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NewChainReloader returns a reloader which runs the reloaders of the methods
+// in order, eg: an exec reloader which checks the config, then an http
+// reloader. The continue-on-error option is either an array of the methods
+// whose failure is ignored, or "true" to ignore the failure of every method.
+func NewChainReloader(manager string, methods []string, result map[string]interface{}) (Reloader, error) {
+	var (
+		res ChainReloader
+	)
+
+	res.Manager = manager
+	res.Method = strings.Join(methods, ",")
+	res.Opts.ContinueOnError = make(map[string]bool)
+	switch c := result["continue-on-error"].(type) {
+	case nil:
+	case string:
+		if strings.ToLower(c) == "true" {
+			for _, m := range methods {
+				res.Opts.ContinueOnError[m] = true
+			}
+		}
+	case []interface{}:
+		for _, m := range c {
+			res.Opts.ContinueOnError[fmt.Sprintf("%v", m)] = true
+		}
+	default:
+		return res, fmt.Errorf("unknown reloader continue-on-error type %T", c)
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range methods {
+		// the options of a method live under its name, so a method can only
+		// be chained once
+		if seen[m] {
+			return res, fmt.Errorf("reloader method %v is defined more than once", m)
+		}
+		seen[m] = true
+		r, err := newReloader(manager, m, result)
+		if err != nil {
+			return res, fmt.Errorf("could not create %v reloader: %v", m, err.Error())
+		}
+		res.Opts.Reloaders = append(res.Opts.Reloaders, r)
+	}
+	return res, nil
+}
+
+// ChainReloader runs a list of reloaders in order. The chain stops at the
+// first reloader which fails, and its error is the error of the chain, unless
+// the method is in continue-on-error.
+type ChainReloader struct {
+	Manager string            `json:"-"`
+	Counter int               `json:"-"`
+	Method  string            `json:"method"`
+	Opts    ChainReloaderOpts `json:"opts"`
+}
+
+type ChainReloaderOpts struct {
+	Reloaders       []Reloader      `json:"reloaders"`
+	ContinueOnError map[string]bool `json:"continue-on-error,omitempty"`
+}
+
+func (c ChainReloader) Reload() error {
+	for i, r := range c.Opts.Reloaders {
+		log.Debugf("ChainReloader::Reload()[count=%v][manager=%v]: running %v reloader (%v of %v)", c.Counter, c.Manager, r.GetMethod(), i+1, len(c.Opts.Reloaders))
+		err := r.SetCounter(c.Counter).Reload()
+		if err == nil {
+			continue
+		}
+		if c.Opts.ContinueOnError[r.GetMethod()] {
+			log.Warnf("ChainReloader::Reload()[count=%v][manager=%v]: %v reloader failed, continuing. err=%v", c.Counter, c.Manager, r.GetMethod(), err.Error())
+			continue
+		}
+		log.Errorf("ChainReloader::Reload()[count=%v][manager=%v]: %v reloader failed, not running the rest of the chain. err=%v", c.Counter, c.Manager, r.GetMethod(), err.Error())
+		return err
+	}
+	return nil
+}
+
+func (c ChainReloader) GetMethod() string {
+	return c.Method
+}
+
+func (c ChainReloader) GetOpts() ReloaderOpts {
+	return c.Opts
+}
+
+func (c ChainReloader) SetOpts(opts ReloaderOpts) bool {
+	c.Opts = opts.(ChainReloaderOpts)
+	return true
+}
+
+func (c ChainReloader) SetCounter(i int) Reloader {
+	c.Counter = i
+	return c
+}
+
+func (c ChainReloader) SetChangedFiles(files []string) Reloader {
+	reloaders := make([]Reloader, len(c.Opts.Reloaders))
+	for i, r := range c.Opts.Reloaders {
+		reloaders[i] = r.SetChangedFiles(files)
+	}
+	c.Opts.Reloaders = reloaders
+	return c
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+type ChainTestSuite struct {
+	dir    string
+	log    string
+	server *httptest.Server
+	// status is the response of the http reloader
+	status int
+}
+
+var _ = Suite(&ChainTestSuite{})
+
+func (s *ChainTestSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.log = filepath.Join(s.dir, "steps")
+	s.status = http.StatusOK
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.step(c, "http")
+		w.WriteHeader(s.status)
+	}))
+}
+
+func (s *ChainTestSuite) TearDownTest(c *C) {
+	s.server.Close()
+	viper.Reset()
+}
+
+// step appends the step to the log of the steps which ran
+func (s *ChainTestSuite) step(c *C, step string) {
+	f, err := os.OpenFile(s.log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	fmt.Fprintln(f, step)
+}
+
+func (s *ChainTestSuite) steps(c *C) []string {
+	data, err := ioutil.ReadFile(s.log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	c.Assert(err, IsNil)
+	return strings.Fields(string(data))
+}
+
+// result returns the reloader options of the manager, with an exec reloader
+// which logs the changed files and exits with code, and an http reloader
+func (s *ChainTestSuite) result(c *C, methods []interface{}, code int) map[string]interface{} {
+	script := filepath.Join(s.dir, "exec.sh")
+	body := fmt.Sprintf("echo \"exec:$BUTLER_CHANGED_FILES\" >> %v\nexit %v\n", s.log, code)
+	c.Assert(ioutil.WriteFile(script, []byte(body), 0755), IsNil)
+	host, port, err := net.SplitHostPort(s.server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+	return map[string]interface{}{
+		"method": methods,
+		"exec":   map[string]interface{}{"command": fmt.Sprintf("sh %v", script), "timeout": "5"},
+		"http":   map[string]interface{}{"host": host, "port": port, "uri": "/-/reload", "method": "post", "timeout": "5"},
+	}
+}
+
+// fromOptions creates the reloader of the manager from its options
+func (s *ChainTestSuite) fromOptions(result map[string]interface{}) (Reloader, error) {
+	viper.Reset()
+	viper.Set("prometheus.reloader", result)
+	return New("prometheus")
+}
+
+func (s *ChainTestSuite) reloader(c *C, result map[string]interface{}) Reloader {
+	r, err := s.fromOptions(result)
+	c.Assert(err, IsNil)
+	_, ok := r.(ChainReloader)
+	c.Assert(ok, Equals, true)
+	return r.SetChangedFiles([]string{"prometheus.yml"})
+}
+
+func (s *ChainTestSuite) TestNewChainReloader(c *C) {
+	r := s.reloader(c, s.result(c, []interface{}{"exec", "http"}, 0))
+	c.Assert(r.GetMethod(), Equals, "exec,http")
+
+	result := s.result(c, []interface{}{"exec", "http", "exec"}, 0)
+	_, err := s.fromOptions(result)
+	c.Assert(err, ErrorMatches, "reloader method exec is defined more than once")
+
+	result = s.result(c, []interface{}{"exec", "http"}, 0)
+	delete(result, "http")
+	_, err = s.fromOptions(result)
+	c.Assert(err, ErrorMatches, "could not create http reloader: no reloader configuration has been defined for manager")
+
+	result = s.result(c, []interface{}{"exec", "http"}, 0)
+	result["continue-on-error"] = 1
+	_, err = s.fromOptions(result)
+	c.Assert(err, ErrorMatches, "unknown reloader continue-on-error type int")
+}
+
+func (s *ChainTestSuite) TestReloadOrder(c *C) {
+	c.Assert(s.reloader(c, s.result(c, []interface{}{"exec", "http"}, 0)).Reload(), IsNil)
+	c.Assert(s.steps(c), DeepEquals, []string{"exec:prometheus.yml", "http"})
+
+	os.Remove(s.log)
+	c.Assert(s.reloader(c, s.result(c, []interface{}{"http", "exec"}, 0)).Reload(), IsNil)
+	c.Assert(s.steps(c), DeepEquals, []string{"http", "exec:prometheus.yml"})
+}
+
+func (s *ChainTestSuite) TestReloadStopsOnError(c *C) {
+	err := s.reloader(c, s.result(c, []interface{}{"exec", "http"}, 1)).Reload()
+	c.Assert(err, NotNil)
+	// the error of the chain is that of the reloader which failed
+	c.Assert(err.(*ReloaderError).Message, Matches, "command failed: exit status 1.*")
+	c.Assert(s.steps(c), DeepEquals, []string{"exec:prometheus.yml"})
+
+	os.Remove(s.log)
+	s.status = http.StatusInternalServerError
+	err = s.reloader(c, s.result(c, []interface{}{"http", "exec"}, 0)).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, http.StatusInternalServerError)
+	c.Assert(s.steps(c), DeepEquals, []string{"http"})
+}
+
+func (s *ChainTestSuite) TestReloadContinueOnError(c *C) {
+	result := s.result(c, []interface{}{"exec", "http"}, 1)
+	result["continue-on-error"] = []interface{}{"exec"}
+	c.Assert(s.reloader(c, result).Reload(), IsNil)
+	c.Assert(s.steps(c), DeepEquals, []string{"exec:prometheus.yml", "http"})
+
+	// only the methods in continue-on-error
+	os.Remove(s.log)
+	s.status = http.StatusInternalServerError
+	result = s.result(c, []interface{}{"http", "exec"}, 0)
+	result["continue-on-error"] = []interface{}{"exec"}
+	c.Assert(s.reloader(c, result).Reload(), NotNil)
+	c.Assert(s.steps(c), DeepEquals, []string{"http"})
+
+	// or every method
+	os.Remove(s.log)
+	result = s.result(c, []interface{}{"http", "exec"}, 1)
+	result["continue-on-error"] = "true"
+	c.Assert(s.reloader(c, result).Reload(), IsNil)
+	c.Assert(s.steps(c), DeepEquals, []string{"http", "exec:prometheus.yml"})
+}
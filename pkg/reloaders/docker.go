@@ -0,0 +1,291 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDockerHost       = "unix:///var/run/docker.sock"
+	defaultDockerAPIVersion = "v1.24"
+	defaultDockerAction     = "signal"
+	defaultDockerTimeout    = 30
+	defaultDockerStopWait   = 10
+)
+
+func NewDockerReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result DockerReloader
+		opts   DockerReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Container = strings.TrimSpace(environment.GetVar(opts.Container))
+	for i := range opts.Labels {
+		opts.Labels[i] = strings.TrimSpace(environment.GetVar(opts.Labels[i]))
+	}
+	if (opts.Container == "") == (len(opts.Labels) == 0) {
+		return result, errors.New("docker reloader needs exactly one of container or labels")
+	}
+
+	opts.Action = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Action)))
+	switch opts.Action {
+	case "":
+		opts.Action = defaultDockerAction
+	case "signal", "restart":
+	default:
+		return result, fmt.Errorf("invalid docker reloader action %v", opts.Action)
+	}
+
+	opts.Signal = strings.ToUpper(strings.TrimSpace(environment.GetVar(opts.Signal)))
+	if opts.Signal == "" {
+		opts.Signal = defaultSignal
+	}
+	if _, err := ParseSignal(opts.Signal); err != nil {
+		return result, err
+	}
+
+	opts.Host = strings.TrimSpace(environment.GetVar(opts.Host))
+	if opts.Host == "" {
+		opts.Host = os.Getenv("DOCKER_HOST")
+	}
+	if opts.Host == "" {
+		opts.Host = defaultDockerHost
+	}
+	opts.APIVersion = strings.TrimSpace(environment.GetVar(opts.APIVersion))
+	if opts.APIVersion == "" {
+		opts.APIVersion = defaultDockerAPIVersion
+	}
+	if !strings.HasPrefix(opts.APIVersion, "v") {
+		opts.APIVersion = "v" + opts.APIVersion
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout <= 0 {
+		log.Warnf("NewDockerReloader(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultDockerTimeout)
+		newTimeout = defaultDockerTimeout
+	}
+	opts.StopWait = strings.TrimSpace(environment.GetVar(opts.StopWait))
+	if opts.StopWait == "" {
+		opts.StopWait = strconv.Itoa(defaultDockerStopWait)
+	}
+	stopWait, err := strconv.Atoi(opts.StopWait)
+	if err != nil || stopWait < 0 {
+		return result, fmt.Errorf("invalid docker reloader stop-wait %v", opts.StopWait)
+	}
+
+	// a restart takes up to stop-wait before the container is killed
+	opts.Client, opts.baseURL, err = newDockerClient(opts.Host, time.Duration(newTimeout+stopWait)*time.Second)
+	if err != nil {
+		return result, err
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// newDockerClient returns the http client and base url which talk to the
+// docker daemon at host, either a unix:// socket or a tcp:// address.
+func newDockerClient(host string, timeout time.Duration) (*http.Client, string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid docker host %v", host)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &http.Client{Transport: transport, Timeout: timeout}, "http://docker", nil
+	case "tcp", "http":
+		return &http.Client{Timeout: timeout}, fmt.Sprintf("http://%s", u.Host), nil
+	case "https":
+		return &http.Client{Timeout: timeout}, fmt.Sprintf("https://%s", u.Host), nil
+	default:
+		return nil, "", fmt.Errorf("invalid docker host %v", host)
+	}
+}
+
+// DockerReloader reloads the manager by signalling, or restarting, its
+// container through the docker API. The containers are found by name, or by
+// their labels, in which case every running container with all the labels is
+// reloaded.
+type DockerReloader struct {
+	Manager string             `json:"-"`
+	Counter int                `json:"-"`
+	Method  string             `mapstructure:"method" json:"method"`
+	Opts    DockerReloaderOpts `json:"opts"`
+}
+
+type DockerReloaderOpts struct {
+	Client     *http.Client `json:"-"`
+	Container  string       `json:"container"`
+	Labels     []string     `json:"labels"`
+	Action     string       `json:"action"`
+	Signal     string       `json:"signal"`
+	StopWait   string       `json:"stop-wait"`
+	Host       string       `json:"host"`
+	APIVersion string       `json:"api-version"`
+	Timeout    string       `json:"timeout"`
+	baseURL    string
+}
+
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+}
+
+type dockerError struct {
+	Message string `json:"message"`
+}
+
+// do runs the docker API request, and decodes the response into out, if it
+// is not nil.
+func (o DockerReloaderOpts) do(method string, path string, query url.Values, out interface{}) error {
+	u := fmt.Sprintf("%s/%s%s", o.baseURL, o.APIVersion, path)
+	if len(query) > 0 {
+		u = fmt.Sprintf("%s?%s", u, query.Encode())
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e dockerError
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return fmt.Errorf("%v: %v", resp.Status, e.Message)
+		}
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	if out != nil {
+		return json.Unmarshal(body, out)
+	}
+	return nil
+}
+
+// containers returns the names or ids of the containers to reload.
+func (o DockerReloaderOpts) containers() ([]string, error) {
+	if o.Container != "" {
+		return []string{o.Container}, nil
+	}
+	filters, err := json.Marshal(map[string][]string{"label": o.Labels})
+	if err != nil {
+		return nil, err
+	}
+	var list []dockerContainer
+	if err := o.do("GET", "/containers/json", url.Values{"filters": []string{string(filters)}}, &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no running container has labels %v", o.Labels)
+	}
+	var res []string
+	for _, c := range list {
+		res = append(res, c.ID)
+	}
+	return res, nil
+}
+
+func (d DockerReloader) Reload() error {
+	o := d.GetOpts().(DockerReloaderOpts)
+	containers, err := o.containers()
+	if err != nil {
+		log.Errorf("DockerReloader::Reload()[count=%v][manager=%v]: could not find containers to reload. err=%v", d.Counter, d.Manager, err.Error())
+		return d.error(err, err.Error())
+	}
+
+	for _, c := range containers {
+		path := fmt.Sprintf("/containers/%s/kill", url.PathEscape(c))
+		query := url.Values{"signal": []string{o.Signal}}
+		if o.Action == "restart" {
+			path = fmt.Sprintf("/containers/%s/restart", url.PathEscape(c))
+			query = url.Values{"t": []string{o.StopWait}}
+		}
+		log.Debugf("DockerReloader::Reload()[count=%v][manager=%v]: %v'ing container %v", d.Counter, d.Manager, o.Action, c)
+		if err := o.do("POST", path, query, nil); err != nil {
+			log.Errorf("DockerReloader::Reload()[count=%v][manager=%v]: could not %v container %v. err=%v", d.Counter, d.Manager, o.Action, c, err.Error())
+			return d.error(err, fmt.Sprintf("could not %v container %v: %v", o.Action, c, err.Error()))
+		}
+	}
+
+	log.Infof("DockerReloader::Reload()[count=%v][manager=%v]: successfully %v'ed containers %v.", d.Counter, d.Manager, o.Action, containers)
+	return nil
+}
+
+// error returns the reloader error with the message, with the same code as
+// an http timeout when err is a timeout talking to the docker daemon, so
+// manager-timeout-ok applies.
+func (d DockerReloader) error(err error, msg string) error {
+	code := 2
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		code = 1
+	}
+	return NewReloaderError().WithMessage(msg).WithCode(code)
+}
+
+func (d DockerReloader) GetMethod() string {
+	return d.Method
+}
+func (d DockerReloader) GetOpts() ReloaderOpts {
+	return d.Opts
+}
+
+func (d DockerReloader) SetOpts(opts ReloaderOpts) bool {
+	d.Opts = opts.(DockerReloaderOpts)
+	return true
+}
+
+func (d DockerReloader) SetCounter(c int) Reloader {
+	d.Counter = c
+	return d
+}
+
+func (d DockerReloader) SetChangedFiles(files []string) Reloader {
+	return d
+}
@@ -0,0 +1,168 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type DockerTestSuite struct {
+	sync.Mutex
+	server   *httptest.Server
+	socket   string
+	requests []string
+	// containers are the running containers, with their labels
+	containers map[string][]string
+}
+
+var _ = Suite(&DockerTestSuite{})
+
+func (s *DockerTestSuite) SetUpTest(c *C) {
+	s.requests = nil
+	s.containers = map[string][]string{
+		"0123456789ab": {"app=prometheus", "env=prod"},
+		"ba9876543210": {"app=prometheus", "env=dev"},
+		"fedcba987654": {"app=alertmanager", "env=prod"},
+	}
+	s.server, s.socket = unixServer(c, c.MkDir(), http.HandlerFunc(s.serve))
+}
+
+func (s *DockerTestSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// serve is a docker daemon which lists the containers by label, and which
+// knows the containers only by id
+func (s *DockerTestSuite) serve(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests = append(s.requests, fmt.Sprintf("%v %v?%v", r.Method, r.URL.Path, r.URL.RawQuery))
+	s.Unlock()
+
+	if r.Method == "GET" && r.URL.Path == "/v1.24/containers/json" {
+		var filters map[string][]string
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		list := []dockerContainer{}
+		for _, id := range []string{"0123456789ab", "ba9876543210", "fedcba987654"} {
+			if hasLabels(s.containers[id], filters["label"]) {
+				list = append(list, dockerContainer{ID: id, Names: []string{"/" + id}})
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	// /v1.24/containers/<id>/<action>
+	parts := strings.Split(r.URL.Path, "/")
+	id := parts[3]
+	if _, ok := s.containers[id]; !ok || r.Method != "POST" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message": "No such container: %v"}`, id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func hasLabels(labels []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, l := range labels {
+			found = found || l == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *DockerTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewDockerReloader("prometheus", "docker", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *DockerTestSuite) TestNewDockerReloader(c *C) {
+	r := s.reloader(c, `{"container": "prometheus", "host": "tcp://127.0.0.1:2375", "api-version": "1.40"}`)
+	o := r.GetOpts().(DockerReloaderOpts)
+	c.Assert(o.Action, Equals, defaultDockerAction)
+	c.Assert(o.Signal, Equals, defaultSignal)
+	c.Assert(o.StopWait, Equals, "10")
+	c.Assert(o.APIVersion, Equals, "v1.40")
+	c.Assert(o.baseURL, Equals, "http://127.0.0.1:2375")
+
+	_, err := NewDockerReloader("prometheus", "docker", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "docker reloader needs exactly one of container or labels")
+	_, err = NewDockerReloader("prometheus", "docker", []byte(`{"container": "prometheus", "labels": ["app=prometheus"]}`))
+	c.Assert(err, ErrorMatches, "docker reloader needs exactly one of container or labels")
+	_, err = NewDockerReloader("prometheus", "docker", []byte(`{"container": "prometheus", "action": "stop"}`))
+	c.Assert(err, ErrorMatches, "invalid docker reloader action stop")
+	_, err = NewDockerReloader("prometheus", "docker", []byte(`{"container": "prometheus", "signal": "bogus"}`))
+	c.Assert(err, ErrorMatches, "unknown signal SIGBOGUS")
+	_, err = NewDockerReloader("prometheus", "docker", []byte(`{"container": "prometheus", "stop-wait": "-1"}`))
+	c.Assert(err, ErrorMatches, "invalid docker reloader stop-wait -1")
+	_, err = NewDockerReloader("prometheus", "docker", []byte(`{"container": "prometheus", "host": "ftp://docker"}`))
+	c.Assert(err, ErrorMatches, "invalid docker host ftp://docker")
+}
+
+func (s *DockerTestSuite) TestReloadContainer(c *C) {
+	r := s.reloader(c, fmt.Sprintf(`{"container": "0123456789ab", "host": "unix://%v"}`, s.socket))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, DeepEquals, []string{"POST /v1.24/containers/0123456789ab/kill?signal=SIGHUP"})
+}
+
+func (s *DockerTestSuite) TestReloadLabels(c *C) {
+	r := s.reloader(c, fmt.Sprintf(`{"labels": ["app=prometheus"], "signal": "usr1", "host": "unix://%v"}`, s.socket))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, HasLen, 3)
+	c.Assert(s.requests[0], Matches, `GET /v1.24/containers/json\?filters=.*app%3Dprometheus.*`)
+	c.Assert(s.requests[1:], DeepEquals, []string{
+		"POST /v1.24/containers/0123456789ab/kill?signal=USR1",
+		"POST /v1.24/containers/ba9876543210/kill?signal=USR1",
+	})
+
+	// every label must match
+	s.requests = nil
+	r = s.reloader(c, fmt.Sprintf(`{"labels": ["app=prometheus", "env=prod"], "host": "unix://%v"}`, s.socket))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests[1:], DeepEquals, []string{"POST /v1.24/containers/0123456789ab/kill?signal=SIGHUP"})
+
+	r = s.reloader(c, fmt.Sprintf(`{"labels": ["app=grafana"], "host": "unix://%v"}`, s.socket))
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "no running container has labels [app=grafana]")
+}
+
+func (s *DockerTestSuite) TestReloadRestart(c *C) {
+	r := s.reloader(c, fmt.Sprintf(`{"container": "fedcba987654", "action": "restart", "stop-wait": "5", "host": "unix://%v"}`, s.socket))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, DeepEquals, []string{"POST /v1.24/containers/fedcba987654/restart?t=5"})
+}
+
+func (s *DockerTestSuite) TestReloadFailed(c *C) {
+	r := s.reloader(c, fmt.Sprintf(`{"container": "prometheus", "host": "unix://%v"}`, s.socket))
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "could not signal container prometheus: 404 Not Found: No such container: prometheus")
+}
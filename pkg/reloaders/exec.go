@@ -0,0 +1,174 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultExecTimeout = 30
+
+	// maxExecOutput is how much of the command output is kept in the
+	// reloader error.
+	maxExecOutput = 512
+
+	// execWaitDelay is how long a killed command may hold on to its output
+	// before the reload gives up on it.
+	execWaitDelay = 5 * time.Second
+)
+
+func NewExecReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result ExecReloader
+		opts   ExecReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Command = strings.TrimSpace(environment.GetVar(opts.Command))
+	if opts.Command == "" {
+		return result, errors.New("no command defined for exec reloader")
+	}
+
+	opts.WorkingDir = environment.GetVar(opts.WorkingDir)
+	if opts.WorkingDir != "" {
+		if stat, err := os.Stat(opts.WorkingDir); err != nil || !stat.IsDir() {
+			return result, fmt.Errorf("exec reloader working-dir %v is not a directory", opts.WorkingDir)
+		}
+	}
+
+	for i, e := range opts.Env {
+		if !strings.Contains(e, "=") {
+			return result, fmt.Errorf("invalid exec reloader env %v, expected KEY=VALUE", e)
+		}
+		kv := strings.SplitN(e, "=", 2)
+		opts.Env[i] = fmt.Sprintf("%s=%s", kv[0], environment.GetVar(kv[1]))
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout <= 0 {
+		log.Warnf("NewExecReloader(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultExecTimeout)
+		newTimeout = defaultExecTimeout
+	}
+	opts.timeout = time.Duration(newTimeout) * time.Second
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+
+	return result, nil
+}
+
+// ExecReloader reloads the manager by running a command, eg: systemctl reload
+// nginx. Like the exec validator, the command is split on whitespace and run
+// directly, not through a shell, with the butler environment plus Env. The
+// manager name and the space separated files which changed are passed in
+// BUTLER_MANAGER and BUTLER_CHANGED_FILES. A command which exits non-zero has
+// failed, and one which runs past the timeout is killed, along with its
+// children.
+type ExecReloader struct {
+	Manager      string           `json:"-"`
+	Counter      int              `json:"-"`
+	ChangedFiles []string         `json:"-"`
+	Method       string           `mapstructure:"method" json:"method"`
+	Opts         ExecReloaderOpts `json:"opts"`
+}
+
+type ExecReloaderOpts struct {
+	Command    string   `json:"command"`
+	Env        []string `json:"env"`
+	Timeout    string   `json:"timeout"`
+	WorkingDir string   `json:"working-dir"`
+	timeout    time.Duration
+}
+
+func (e ExecReloader) Reload() error {
+	o := e.GetOpts().(ExecReloaderOpts)
+	args := strings.Fields(o.Command)
+	log.Debugf("ExecReloader::Reload()[count=%v][manager=%v]: reloading manager using %v", e.Counter, e.Manager, args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = o.WorkingDir
+	cmd.Env = append(os.Environ(), o.Env...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("BUTLER_MANAGER=%s", e.Manager), fmt.Sprintf("BUTLER_CHANGED_FILES=%s", strings.Join(e.ChangedFiles, " ")))
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = execWaitDelay
+	killProcessGroup(cmd)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Errorf("ExecReloader::Reload()[count=%v][manager=%v]: command timed out after %v", e.Counter, e.Manager, o.timeout)
+		// not the code of an http timeout, since a command which hangs has
+		// not reloaded the manager, and manager-timeout-ok must not apply
+		return NewReloaderError().WithMessage(fmt.Sprintf("command timed out after %v", o.timeout)).WithCode(2)
+	}
+	if err != nil {
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxExecOutput {
+			output = "..." + output[len(output)-maxExecOutput:]
+		}
+		log.Errorf("ExecReloader::Reload()[count=%v][manager=%v]: command failed. err=%v output=%q", e.Counter, e.Manager, err.Error(), output)
+		// the exit status is not used as the code, since a status of 1
+		// would be taken for an http timeout
+		return NewReloaderError().WithMessage(fmt.Sprintf("command failed: %v: %v", err.Error(), output)).WithCode(2)
+	}
+
+	log.Infof("ExecReloader::Reload()[count=%v][manager=%v]: successfully reloaded config.", e.Counter, e.Manager)
+	log.Debugf("ExecReloader::Reload()[count=%v][manager=%v]: output=%q", e.Counter, e.Manager, strings.TrimSpace(out.String()))
+	return nil
+}
+
+func (e ExecReloader) GetMethod() string {
+	return e.Method
+}
+func (e ExecReloader) GetOpts() ReloaderOpts {
+	return e.Opts
+}
+
+func (e ExecReloader) SetOpts(opts ReloaderOpts) bool {
+	e.Opts = opts.(ExecReloaderOpts)
+	return true
+}
+
+func (e ExecReloader) SetCounter(c int) Reloader {
+	e.Counter = c
+	return e
+}
+
+func (e ExecReloader) SetChangedFiles(files []string) Reloader {
+	e.ChangedFiles = files
+	return e
+}
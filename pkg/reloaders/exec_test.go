@@ -0,0 +1,114 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ExecTestSuite struct {
+	dir string
+}
+
+var _ = Suite(&ExecTestSuite{})
+
+func (s *ExecTestSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// script writes a shell script to the test directory, and returns the command
+// which runs it
+func (s *ExecTestSuite) script(c *C, name string, body string) string {
+	path := filepath.Join(s.dir, name)
+	err := ioutil.WriteFile(path, []byte(body), 0755)
+	c.Assert(err, IsNil)
+	return fmt.Sprintf("sh %v", path)
+}
+
+func (s *ExecTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewExecReloader("prometheus", "exec", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *ExecTestSuite) TestNewExecReloader(c *C) {
+	_, err := NewExecReloader("prometheus", "exec", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "no command defined for exec reloader")
+	_, err = NewExecReloader("prometheus", "exec", []byte(`{"command": "true", "working-dir": "/nonexistent"}`))
+	c.Assert(err, ErrorMatches, "exec reloader working-dir /nonexistent is not a directory")
+	_, err = NewExecReloader("prometheus", "exec", []byte(`{"command": "true", "env": ["FOO"]}`))
+	c.Assert(err, ErrorMatches, "invalid exec reloader env FOO, expected KEY=VALUE")
+
+	r := s.reloader(c, `{"command": "true", "timeout": "bogus"}`)
+	c.Assert(r.GetOpts().(ExecReloaderOpts).timeout.Seconds(), Equals, float64(defaultExecTimeout))
+}
+
+func (s *ExecTestSuite) TestReload(c *C) {
+	cmd := s.script(c, "ok.sh", "exit 0\n")
+	r := s.reloader(c, fmt.Sprintf(`{"command": "%v"}`, cmd))
+	c.Assert(r.Reload(), IsNil)
+}
+
+func (s *ExecTestSuite) TestReloadFailed(c *C) {
+	cmd := s.script(c, "fail.sh", "echo reload failed\nexit 2\n")
+	r := s.reloader(c, fmt.Sprintf(`{"command": "%v"}`, cmd))
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	e, ok := err.(*ReloaderError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, 2)
+	c.Assert(e.Message, Matches, "command failed: exit status 2: reload failed")
+}
+
+func (s *ExecTestSuite) TestReloadTimeout(c *C) {
+	// the sleep is a child of the shell, which holds on to the output of
+	// the command, so it has to be killed along with the shell
+	cmd := s.script(c, "hang.sh", "sleep 30\necho done\n")
+	r := s.reloader(c, fmt.Sprintf(`{"command": "%v", "timeout": "1"}`, cmd))
+	start := time.Now()
+	err := r.Reload()
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true, Commentf("the reload took %v", time.Since(start)))
+	c.Assert(err, NotNil)
+	e, ok := err.(*ReloaderError)
+	c.Assert(ok, Equals, true)
+	// a hung command has not reloaded the manager, so it must not have the
+	// code of an http timeout, which manager-timeout-ok lets through
+	c.Assert(e.Code, Not(Equals), 1)
+	c.Assert(e.Message, Equals, "command timed out after 1s")
+}
+
+func (s *ExecTestSuite) TestReloadEnvironment(c *C) {
+	out := filepath.Join(s.dir, "out")
+	wd := c.MkDir()
+	cmd := s.script(c, "env.sh", fmt.Sprintf("echo \"$(pwd)|$FOO|$BUTLER_MANAGER|$BUTLER_CHANGED_FILES\" > %v\n", out))
+	os.Setenv("BUTLER_TEST_FOO", "bar")
+	defer os.Unsetenv("BUTLER_TEST_FOO")
+	r := s.reloader(c, fmt.Sprintf(`{"command": "%v", "working-dir": "%v", "env": ["FOO=env:BUTLER_TEST_FOO"]}`, cmd, wd))
+	r = r.SetChangedFiles([]string{"/etc/prometheus/prometheus.yml", "/etc/prometheus/alerts/commonalerts.yml"})
+	c.Assert(r.Reload(), IsNil)
+
+	data, err := ioutil.ReadFile(out)
+	c.Assert(err, IsNil)
+	wd, _ = filepath.EvalSymlinks(wd)
+	c.Assert(strings.TrimSpace(string(data)), Equals, fmt.Sprintf("%v|bar|prometheus|/etc/prometheus/prometheus.yml /etc/prometheus/alerts/commonalerts.yml", wd))
+}
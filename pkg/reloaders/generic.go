@@ -52,3 +52,7 @@ func (r GenericReloader) SetOpts(opts ReloaderOpts) bool {
 func (r GenericReloader) SetCounter(c int) Reloader {
 	return r
 }
+
+func (r GenericReloader) SetChangedFiles(files []string) Reloader {
+	return r
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// NewGroupReloader returns a reloader which reloads the manager with the
+// reloader of the file groups the changed files belong to. The files which do
+// not belong to a group are reloaded with the default reloader, which may be
+// nil when every file belongs to a group.
+func NewGroupReloader(manager string, reloader Reloader, key string) (Reloader, error) {
+	var (
+		err    error
+		res    GroupReloader
+		result map[string]map[string]interface{}
+	)
+
+	err = viper.UnmarshalKey(key, &result)
+	if err != nil {
+		return res, err
+	}
+	if len(result) == 0 {
+		return res, errors.New("no reloader groups have been defined for manager")
+	}
+
+	res.Manager = manager
+	res.Method = "groups"
+	res.Opts.Default = reloader
+
+	names := make([]string, 0, len(result))
+	for name := range result {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g := ReloaderGroup{Name: name}
+		switch f := result[name]["files"].(type) {
+		case string:
+			g.Files = append(g.Files, f)
+		case []interface{}:
+			for _, i := range f {
+				g.Files = append(g.Files, fmt.Sprintf("%v", i))
+			}
+		}
+		if len(g.Files) == 0 {
+			return res, fmt.Errorf("no files have been defined for reloader group %v", name)
+		}
+		g.Reloader, err = newFromResult(manager, result[name])
+		if err != nil {
+			return res, fmt.Errorf("could not create reloader for group %v: %v", name, err.Error())
+		}
+		res.Opts.Groups = append(res.Opts.Groups, g)
+	}
+	return res, nil
+}
+
+// NewFileGroupReloader returns the reloader which has been configured for the
+// file group of the manager entry, under its file-groups section. It returns
+// nil when the file group has no reloader.
+func NewFileGroupReloader(manager string, group string) (Reloader, error) {
+	key := fmt.Sprintf("%s.file-groups.%s.reloader", manager, group)
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+	return newFromKey(manager, key)
+}
+
+// WithGroups returns the reloader with the groups added to it. The reloader
+// becomes the default reloader of a new group reloader, unless it is a group
+// reloader already.
+func WithGroups(manager string, reloader Reloader, groups []ReloaderGroup) Reloader {
+	if len(groups) == 0 {
+		return reloader
+	}
+	if r, ok := reloader.(GroupReloader); ok {
+		r.Opts.Groups = append(append([]ReloaderGroup{}, r.Opts.Groups...), groups...)
+		return r
+	}
+	res := GroupReloader{Manager: manager, Method: "groups"}
+	res.Opts.Default = reloader
+	res.Opts.Groups = groups
+	return res
+}
+
+// GroupReloader reloads the manager per group of files, eg: rules changes
+// with an http reload, and web config changes with a restart. When the files
+// which changed are not known, eg: after the known good configuration has
+// been restored, every reloader is run.
+type GroupReloader struct {
+	Manager      string            `json:"-"`
+	Counter      int               `json:"-"`
+	ChangedFiles []string          `json:"-"`
+	Method       string            `json:"method"`
+	Opts         GroupReloaderOpts `json:"opts"`
+}
+
+type GroupReloaderOpts struct {
+	Default Reloader        `json:"default,omitempty"`
+	Groups  []ReloaderGroup `json:"groups"`
+}
+
+// ReloaderGroup is a reloader for the files matching the Files patterns. A
+// pattern matches the dest path of the file, or any of its trailing path
+// components, so both "web.yml" and "rules/*.yml" match files underneath
+// the dest-path.
+type ReloaderGroup struct {
+	Name     string   `json:"name"`
+	Files    []string `json:"files"`
+	Reloader Reloader `json:"reloader"`
+}
+
+// Match returns whether the file belongs to the group.
+func (g ReloaderGroup) Match(file string) bool {
+	parts := strings.Split(strings.TrimPrefix(path.Clean(file), "/"), "/")
+	for _, p := range g.Files {
+		for i := range parts {
+			if ok, _ := path.Match(p, strings.Join(parts[i:], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r GroupReloader) Reload() error {
+	var (
+		run       []Reloader
+		ungrouped []string
+	)
+
+	matched := make(map[int][]string)
+	for _, f := range r.ChangedFiles {
+		grouped := false
+		for i, g := range r.Opts.Groups {
+			if g.Match(f) {
+				matched[i] = append(matched[i], f)
+				grouped = true
+			}
+		}
+		if !grouped {
+			ungrouped = append(ungrouped, f)
+		}
+	}
+
+	all := len(r.ChangedFiles) == 0
+	if r.Opts.Default != nil && (all || len(ungrouped) > 0) {
+		log.Debugf("GroupReloader::Reload()[count=%v][manager=%v]: reloading with the default reloader for %v", r.Counter, r.Manager, ungrouped)
+		run = append(run, r.Opts.Default.SetChangedFiles(ungrouped))
+	} else if len(ungrouped) > 0 {
+		log.Warnf("GroupReloader::Reload()[count=%v][manager=%v]: no reloader for %v, which are not in any reloader group", r.Counter, r.Manager, ungrouped)
+	}
+	for i, g := range r.Opts.Groups {
+		if all || len(matched[i]) > 0 {
+			log.Debugf("GroupReloader::Reload()[count=%v][manager=%v]: reloading with the %v group reloader for %v", r.Counter, r.Manager, g.Name, matched[i])
+			run = append(run, g.Reloader.SetChangedFiles(matched[i]))
+		}
+	}
+
+	for _, reloader := range run {
+		if err := reloader.SetCounter(r.Counter).Reload(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r GroupReloader) GetMethod() string {
+	return r.Method
+}
+
+func (r GroupReloader) GetOpts() ReloaderOpts {
+	return r.Opts
+}
+
+func (r GroupReloader) SetOpts(opts ReloaderOpts) bool {
+	r.Opts = opts.(GroupReloaderOpts)
+	return true
+}
+
+func (r GroupReloader) SetCounter(c int) Reloader {
+	r.Counter = c
+	return r
+}
+
+func (r GroupReloader) SetChangedFiles(files []string) Reloader {
+	r.ChangedFiles = files
+	return r
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	. "gopkg.in/check.v1"
+)
+
+// fakeReloader logs the files it is run with to the runs of its suite.
+type fakeReloader struct {
+	name  string
+	files []string
+	err   error
+	runs  *[]string
+}
+
+func (f fakeReloader) Reload() error {
+	*f.runs = append(*f.runs, fmt.Sprintf("%v:%v", f.name, strings.Join(f.files, ",")))
+	return f.err
+}
+
+func (f fakeReloader) GetMethod() string {
+	return f.name
+}
+
+func (f fakeReloader) GetOpts() ReloaderOpts {
+	return nil
+}
+
+func (f fakeReloader) SetOpts(opts ReloaderOpts) bool {
+	return true
+}
+
+func (f fakeReloader) SetCounter(c int) Reloader {
+	return f
+}
+
+func (f fakeReloader) SetChangedFiles(files []string) Reloader {
+	f.files = files
+	return f
+}
+
+type GroupTestSuite struct {
+	runs []string
+}
+
+var _ = Suite(&GroupTestSuite{})
+
+func (s *GroupTestSuite) SetUpTest(c *C) {
+	s.runs = nil
+}
+
+func (s *GroupTestSuite) fake(name string) fakeReloader {
+	return fakeReloader{name: name, runs: &s.runs}
+}
+
+// reloader returns a group reloader with a rules and a web group, in that
+// order, and the default reloader, if any
+func (s *GroupTestSuite) reloader(def Reloader) Reloader {
+	return GroupReloader{Manager: "prometheus", Method: "groups", Opts: GroupReloaderOpts{
+		Default: def,
+		Groups: []ReloaderGroup{
+			{Name: "rules", Files: []string{"rules/*.yml", "alerts.yml"}, Reloader: s.fake("rules")},
+			{Name: "web", Files: []string{"web.yml", "tls/*", "alerts.yml"}, Reloader: s.fake("web")},
+		},
+	}}
+}
+
+func (s *GroupTestSuite) TestMatch(c *C) {
+	g := ReloaderGroup{Name: "web", Files: []string{"web.yml", "tls/*"}}
+	tests := []struct {
+		file  string
+		match bool
+	}{
+		{"web.yml", true},
+		{"/etc/prometheus/web.yml", true},
+		{"/etc/prometheus/tls/server.crt", true},
+		{"tls/server.key", true},
+		{"/etc/prometheus/web.yml.bak", false},
+		{"/etc/prometheus/prometheus.yml", false},
+		// a pattern does not cross directories
+		{"/etc/prometheus/tls/old/server.crt", false},
+		{"/etc/prometheus//tls/../web.yml", true},
+	}
+	for _, t := range tests {
+		c.Assert(g.Match(t.file), Equals, t.match, Commentf("file=%v", t.file))
+	}
+}
+
+func (s *GroupTestSuite) TestReloadGroups(c *C) {
+	tests := []struct {
+		files []string
+		runs  []string
+	}{
+		// one group
+		{[]string{"/etc/prometheus/rules/node.yml", "/etc/prometheus/rules/k8s.yml"}, []string{"rules:/etc/prometheus/rules/node.yml,/etc/prometheus/rules/k8s.yml"}},
+		{[]string{"/etc/prometheus/tls/server.crt"}, []string{"web:/etc/prometheus/tls/server.crt"}},
+		// several groups, in the order of the groups
+		{[]string{"/etc/prometheus/web.yml", "/etc/prometheus/rules/node.yml"}, []string{"rules:/etc/prometheus/rules/node.yml", "web:/etc/prometheus/web.yml"}},
+		// a file in several groups is reloaded by each of them
+		{[]string{"/etc/prometheus/alerts.yml"}, []string{"rules:/etc/prometheus/alerts.yml", "web:/etc/prometheus/alerts.yml"}},
+		// the files in no group are reloaded with the default reloader
+		{[]string{"/etc/prometheus/prometheus.yml"}, []string{"default:/etc/prometheus/prometheus.yml"}},
+		{[]string{"/etc/prometheus/prometheus.yml", "/etc/prometheus/web.yml"}, []string{"default:/etc/prometheus/prometheus.yml", "web:/etc/prometheus/web.yml"}},
+		// when the files are not known, every reloader is run
+		{nil, []string{"default:", "rules:", "web:"}},
+	}
+	for _, t := range tests {
+		s.runs = nil
+		r := s.reloader(s.fake("default")).SetChangedFiles(t.files)
+		c.Assert(r.Reload(), IsNil)
+		c.Assert(s.runs, DeepEquals, t.runs, Commentf("files=%v", t.files))
+	}
+}
+
+func (s *GroupTestSuite) TestReloadNoDefault(c *C) {
+	// the files in no group are not reloaded without a default reloader
+	r := s.reloader(nil).SetChangedFiles([]string{"/etc/prometheus/prometheus.yml"})
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.runs, HasLen, 0)
+
+	r = s.reloader(nil).SetChangedFiles([]string{"/etc/prometheus/prometheus.yml", "/etc/prometheus/web.yml"})
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.runs, DeepEquals, []string{"web:/etc/prometheus/web.yml"})
+
+	s.runs = nil
+	c.Assert(s.reloader(nil).Reload(), IsNil)
+	c.Assert(s.runs, DeepEquals, []string{"rules:", "web:"})
+}
+
+func (s *GroupTestSuite) TestReloadStopsOnError(c *C) {
+	def := s.fake("default")
+	def.err = errors.New("reload failed")
+	r := s.reloader(def).SetChangedFiles([]string{"/etc/prometheus/prometheus.yml", "/etc/prometheus/web.yml"})
+	c.Assert(r.Reload(), ErrorMatches, "reload failed")
+	c.Assert(s.runs, DeepEquals, []string{"default:/etc/prometheus/prometheus.yml"})
+}
+
+func (s *GroupTestSuite) TestNewGroupReloader(c *C) {
+	config := `[prometheus.reloader]
+  method = "exec"
+  [prometheus.reloader.exec]
+    command = "true"
+[prometheus.reloader-groups.web]
+  files = "web.yml"
+  method = "exec"
+  [prometheus.reloader-groups.web.exec]
+    command = "true"
+[prometheus.reloader-groups.rules]
+  files = ["rules/*.yml", "alerts.yml"]
+  method = "exec"
+  [prometheus.reloader-groups.rules.exec]
+    command = "true"
+`
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBufferString(config)), IsNil)
+	r, err := New("prometheus")
+	c.Assert(err, IsNil)
+	o := r.GetOpts().(GroupReloaderOpts)
+	c.Assert(o.Default.GetMethod(), Equals, "exec")
+	c.Assert(o.Groups, HasLen, 2)
+	c.Assert(o.Groups[0].Name, Equals, "rules")
+	c.Assert(o.Groups[0].Files, DeepEquals, []string{"rules/*.yml", "alerts.yml"})
+	c.Assert(o.Groups[1].Name, Equals, "web")
+	c.Assert(o.Groups[1].Files, DeepEquals, []string{"web.yml"})
+
+	// the default reloader is optional
+	viper.Reset()
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBufferString(config[strings.Index(config, "[prometheus.reloader-groups.web]"):])), IsNil)
+	r, err = New("prometheus")
+	c.Assert(err, IsNil)
+	c.Assert(r.GetOpts().(GroupReloaderOpts).Default, IsNil)
+
+	// but a group needs files
+	viper.Reset()
+	viper.SetConfigType("toml")
+	c.Assert(viper.ReadConfig(bytes.NewBufferString(strings.Replace(config, `files = "web.yml"`, "", 1))), IsNil)
+	_, err = New("prometheus")
+	c.Assert(err, ErrorMatches, "no files have been defined for reloader group web")
+}
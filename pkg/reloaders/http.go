@@ -0,0 +1,439 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/metrics"
+
+	"github.com/Jeffail/gabs"
+	"github.com/hashicorp/go-retryablehttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHTTPMethod = "POST"
+
+	// unixSocketPrefix marks a host which is a unix domain socket.
+	unixSocketPrefix = "unix://"
+
+	// maxResponseBody is how much of the response is checked against the
+	// success-body and success-json-path options.
+	maxResponseBody = 1 << 20
+)
+
+var (
+	defaultSuccessCodes = []string{"200"}
+	successCodeRe       = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+)
+
+func NewHTTPReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err                error
+		result             HTTPReloader
+		opts               HTTPReloaderOpts
+		insecureSkipVerify bool
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout == 0 {
+		log.Warnf("NewHttpReloader(): could not convert %v to integer for timeout, defaulting to 0. This is probably undesired.", opts.Timeout)
+	}
+
+	newRetries, _ := strconv.Atoi(environment.GetVar(opts.Retries))
+	if newRetries == 0 {
+		log.Warnf("NewHttpReloader(): could not convert %v to integer for retries, defaulting to 0. This is probably undesired.", opts.Retries)
+	}
+
+	newRetryWaitMax, _ := strconv.Atoi(environment.GetVar(opts.RetryWaitMax))
+	if newRetryWaitMax == 0 {
+		log.Warnf("NewHttpReloader(): could not convert %v to integer for retry-wait-max, defaulting to 0. This is probably undesired.", opts.RetryWaitMax)
+	}
+
+	newRetryWaitMin, _ := strconv.Atoi(environment.GetVar(opts.RetryWaitMin))
+	if newRetryWaitMin == 0 {
+		log.Warnf("NewHttpReloader(): could not convert %v to integer for retry-wait-min, defaulting to 0. This is probably undesired.", opts.RetryWaitMin)
+	}
+
+	// ignore cert errors if defined
+	insecureSkipVerify = strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"
+	tlsConfig, err := opts.GetTLSConfig(insecureSkipVerify)
+	if err != nil {
+		return result, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+
+	// Let's populate some environment variables
+	opts.Host = environment.GetVar(opts.Host)
+	if socket := opts.GetSocket(); socket != "" {
+		// local admin sockets which are not exposed on tcp, eg: the haproxy
+		// dataplane api
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	}
+
+	opts.Client = retryablehttp.NewClient()
+	opts.Client.Logger.SetFlags(0)
+	opts.Client.Logger.SetOutput(ioutil.Discard)
+	opts.Client.HTTPClient.Timeout = time.Duration(newTimeout) * time.Second
+	opts.Client.HTTPClient.Transport = transport
+	opts.Client.RetryMax = newRetries
+	opts.Client.RetryWaitMax = time.Duration(newRetryWaitMax) * time.Second
+	opts.Client.RetryWaitMin = time.Duration(newRetryWaitMin) * time.Second
+
+	opts.ContentType = environment.GetVar(opts.ContentType)
+	// we cannot do ints yet!
+	//opts.Port
+	opts.URI = environment.GetVar(opts.URI)
+	opts.Method = strings.ToUpper(strings.TrimSpace(environment.GetVar(opts.Method)))
+	if opts.Method == "" {
+		opts.Method = defaultHTTPMethod
+	}
+	opts.Payload = environment.GetVar(opts.Payload)
+	for k, v := range opts.Headers {
+		opts.Headers[k] = environment.GetVar(v)
+	}
+	opts.payload, err = template.New(manager).Funcs(payloadFuncs).Parse(opts.Payload)
+	if err != nil {
+		return result, fmt.Errorf("could not parse http reloader payload. err=%v", err.Error())
+	}
+
+	if len(opts.SuccessCodes) == 0 {
+		opts.SuccessCodes = defaultSuccessCodes
+	}
+	for i, c := range opts.SuccessCodes {
+		opts.SuccessCodes[i] = strings.ToLower(environment.GetVar(c))
+		if !successCodeRe.MatchString(opts.SuccessCodes[i]) {
+			return result, fmt.Errorf("invalid http reloader success-codes %v, expected eg: 200 or 2xx", c)
+		}
+	}
+	opts.SuccessBody = environment.GetVar(opts.SuccessBody)
+	if opts.SuccessBody != "" {
+		opts.successBody, err = regexp.Compile(opts.SuccessBody)
+		if err != nil {
+			return result, fmt.Errorf("could not compile http reloader success-body %v. err=%v", opts.SuccessBody, err.Error())
+		}
+	}
+	opts.SuccessJSONPath = strings.TrimPrefix(environment.GetVar(opts.SuccessJSONPath), "$.")
+	opts.SuccessJSONValue = environment.GetVar(opts.SuccessJSONValue)
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+
+	//log.Debugf("NewHttpReloader(): opts=%#v", opts)
+	return result, err
+}
+
+type HTTPReloader struct {
+	Manager      string           `json:"-"`
+	Counter      int              `json:"-"`
+	ChangedFiles []string         `json:"-"`
+	Method       string           `mapstructure:"method" json:"method"`
+	Opts         HTTPReloaderOpts `json:"opts"`
+}
+
+type HTTPReloaderOpts struct {
+	Client             *retryablehttp.Client `json:"-"`
+	ContentType        string                `json:"content-type"`
+	Headers            map[string]string     `json:"headers"`
+	Host               string                `json:"host"`
+	InsecureSkipVerify string                `json:"insecure-skip-verify"`
+	Port               string                `mapstructure:"port" json:"port"`
+	URI                string                `json:"uri"`
+	Method             string                `json:"method"`
+	Payload            string                `json:"payload"`
+	Retries            string                `json:"retries"`
+	RetryWaitMax       string                `json:"retry-wait-max"`
+	RetryWaitMin       string                `json:"retry-wait-min"`
+	SuccessCodes       []string              `json:"success-codes"`
+	SuccessBody        string                `json:"success-body"`
+	SuccessJSONPath    string                `json:"success-json-path"`
+	SuccessJSONValue   string                `json:"success-json-value"`
+	Timeout            string                `json:"timeout"`
+	TLSCA              string                `json:"tls-ca"`
+	TLSCert            string                `json:"tls-cert"`
+	TLSKey             string                `json:"tls-key"`
+	TLSServerName      string                `json:"tls-server-name"`
+	payload            *template.Template
+	successBody        *regexp.Regexp
+}
+
+// payloadFuncs are the functions available to the payload template, so
+// that the changed files can be sent as eg: {"files": {{ json .Files }}}.
+var payloadFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+}
+
+// PayloadData is what the http reloader payload template is rendered with.
+type PayloadData struct {
+	Manager string
+	Counter int
+	Files   []string
+}
+
+// GetPayload renders the payload template for a reload.
+func (h HTTPReloader) GetPayload() (string, error) {
+	o := h.GetOpts().(HTTPReloaderOpts)
+	if o.payload == nil {
+		return o.Payload, nil
+	}
+	files := h.ChangedFiles
+	if files == nil {
+		files = []string{}
+	}
+	var buf bytes.Buffer
+	err := o.payload.Execute(&buf, PayloadData{Manager: h.Manager, Counter: h.Counter, Files: files})
+	return buf.String(), err
+}
+
+func (h *HTTPReloaderOpts) GetClient() *retryablehttp.Client {
+	return h.Client
+}
+
+// GetTLSConfig returns the tls config for https reloads. The CA bundle in
+// tls-ca replaces the system roots, tls-server-name overrides the name the
+// server certificate is verified against, and sent in SNI, and tls-cert and
+// tls-key are the client certificate for servers which require mTLS. The
+// client certificate is read on every handshake, so that it can be rotated
+// without restarting butler.
+func (h *HTTPReloaderOpts) GetTLSConfig(insecureSkipVerify bool) (*tls.Config, error) {
+	h.TLSCA = environment.GetVar(h.TLSCA)
+	h.TLSCert = environment.GetVar(h.TLSCert)
+	h.TLSKey = environment.GetVar(h.TLSKey)
+	h.TLSServerName = environment.GetVar(h.TLSServerName)
+
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify, ServerName: h.TLSServerName}
+	if h.TLSCA != "" {
+		ca, err := ioutil.ReadFile(h.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read http reloader tls-ca %v", h.TLSCA)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in http reloader tls-ca %v", h.TLSCA)
+		}
+	}
+	if (h.TLSCert == "") != (h.TLSKey == "") {
+		return nil, errors.New("http reloader needs both tls-cert and tls-key for a client certificate")
+	}
+	if h.TLSCert != "" {
+		// fail early on a bad certificate, rather than on every reload
+		if _, err := tls.LoadX509KeyPair(h.TLSCert, h.TLSKey); err != nil {
+			return nil, fmt.Errorf("could not load http reloader tls-cert %v. err=%v", h.TLSCert, err.Error())
+		}
+		cert, key := h.TLSCert, h.TLSKey
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c, err := tls.LoadX509KeyPair(cert, key)
+			if err != nil {
+				return nil, err
+			}
+			return &c, nil
+		}
+	}
+	return config, nil
+}
+
+// IsSuccessCode returns whether the status code is one of the success-codes,
+// which are either exact codes or classes, eg: 2xx.
+func (h HTTPReloaderOpts) IsSuccessCode(code int) bool {
+	status := strconv.Itoa(code)
+	for _, c := range h.SuccessCodes {
+		if c == status || (strings.HasSuffix(c, "xx") && c[0] == status[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckResponseBody checks the response body against the success-body regex
+// and the success-json-path option. The value at the dotted json path, eg:
+// data.status, must equal success-json-value, or merely exist when no value
+// is configured.
+func (h HTTPReloaderOpts) CheckResponseBody(body []byte) error {
+	if h.successBody != nil && !h.successBody.Match(body) {
+		return fmt.Errorf("response body does not match %v", h.SuccessBody)
+	}
+	if h.SuccessJSONPath == "" {
+		return nil
+	}
+	parsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return fmt.Errorf("could not parse response body as json. err=%v", err.Error())
+	}
+	if !parsed.ExistsP(h.SuccessJSONPath) {
+		return fmt.Errorf("response body has no %v", h.SuccessJSONPath)
+	}
+	value := parsed.Path(h.SuccessJSONPath).Data()
+	if h.SuccessJSONValue != "" && fmt.Sprintf("%v", value) != h.SuccessJSONValue {
+		return fmt.Errorf("response body %v is %v, expected %v", h.SuccessJSONPath, value, h.SuccessJSONValue)
+	}
+	return nil
+}
+
+// GetSocket returns the path to the unix domain socket when the host is a
+// unix:// target, eg: unix:///var/run/haproxy.sock, and an empty string
+// otherwise.
+func (h HTTPReloaderOpts) GetSocket() string {
+	if strings.HasPrefix(h.Host, unixSocketPrefix) {
+		return strings.TrimPrefix(h.Host, unixSocketPrefix)
+	}
+	return ""
+}
+
+func (h HTTPReloader) Reload() error {
+	var (
+		err  error
+		req  *retryablehttp.Request
+		resp *http.Response
+	)
+
+	log.Debugf("HTTPReloader::Reload()[count=%v][manager=%v]: reloading manager using http", h.Counter, h.Manager)
+	o := h.GetOpts().(HTTPReloaderOpts)
+	c := o.GetClient()
+	// Set the reloader retry policy
+	c.CheckRetry = h.ReloaderRetryPolicy
+	var reloadURL string
+	if o.GetSocket() != "" {
+		// the host and port are only used in the Host header over a socket
+		reloadURL = fmt.Sprintf("%s://localhost%s", h.Method, o.URI)
+	} else {
+		newPort, _ := strconv.Atoi(environment.GetVar(o.Port))
+		if newPort == 0 {
+			log.Warnf("HTTPReloader::Reload()[count=%v][manager=%v]: could not convert %v to integer for port, defaulting to 0. This is probably undesired.", h.Counter, h.Manager, o.Port)
+		}
+		reloadURL = fmt.Sprintf("%s://%s:%d%s", h.Method, o.Host, newPort, o.URI)
+	}
+
+	switch o.Method {
+	case "GET", "HEAD":
+		req, err = retryablehttp.NewRequest(o.Method, reloadURL, nil)
+	default:
+		var payload string
+		payload, err = h.GetPayload()
+		if err != nil {
+			log.Errorf("HTTPReloader::Reload()[count=%v][manager=%v]: could not render payload. err=%v", h.Counter, h.Manager, err.Error())
+			return NewReloaderError().WithMessage(fmt.Sprintf("could not render payload: %v", err.Error())).WithCode(2)
+		}
+		req, err = retryablehttp.NewRequest(o.Method, reloadURL, strings.NewReader(payload))
+		if err == nil && o.ContentType != "" {
+			req.Header.Set("Content-Type", o.ContentType)
+		}
+	}
+	if err == nil {
+		for k, v := range o.Headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("HTTPReloader::Reload()[count=%v][manager=%v]: err=%v", h.Counter, h.Manager, err.Error())
+		log.Errorf(msg)
+		return NewReloaderError().WithMessage(err.Error()).WithCode(1)
+	}
+
+	log.Debugf("HTTPReloader::Reload()[count=%v][manager=%v]: %v'ing up!", h.Counter, h.Manager, o.Method)
+	resp, err = c.Do(req)
+	if err != nil {
+		msg := fmt.Sprintf("HTTPReloader::Reload()[count=%v][manager=%v]: err=%v", h.Counter, h.Manager, err.Error())
+		log.Errorf(msg)
+		return NewReloaderError().WithMessage(err.Error()).WithCode(1)
+	}
+	defer resp.Body.Close()
+	if !o.IsSuccessCode(resp.StatusCode) {
+		msg := fmt.Sprintf("HTTPReloader::Reload()[count=%v][manager=%v]: received bad response from server. http_code=%d", h.Counter, h.Manager, int(resp.StatusCode))
+		log.Errorf(msg)
+		// at this point we should raise an error
+		return NewReloaderError().WithMessage("received bad response from server").WithCode(resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err == nil {
+		err = o.CheckResponseBody(body)
+	}
+	if err != nil {
+		log.Errorf("HTTPReloader::Reload()[count=%v][manager=%v]: reload was not successful. http_code=%d err=%v", h.Counter, h.Manager, int(resp.StatusCode), err.Error())
+		// not the status code, which is a success code
+		return NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+	log.Infof("HTTPReloader::Reload()[count=%v][manager=%v]: successfully reloaded config. http_code=%d", h.Counter, h.Manager, int(resp.StatusCode))
+
+	return nil
+}
+
+func (h *HTTPReloader) ReloaderRetryPolicy(resp *http.Response, err error) (bool, error) {
+	if err != nil {
+		metrics.SetButlerReloaderRetry(metrics.SUCCESS, h.Manager)
+		return true, err
+	}
+
+	// Here is our policy override. By default it looks for
+	// res.StatusCode >= 500 ...
+	if resp.StatusCode == 0 || resp.StatusCode >= 600 {
+		metrics.SetButlerReloaderRetry(metrics.SUCCESS, h.Manager)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (h HTTPReloader) GetMethod() string {
+	return h.Method
+}
+func (h HTTPReloader) GetOpts() ReloaderOpts {
+	return h.Opts
+}
+
+func (h HTTPReloader) SetOpts(opts ReloaderOpts) bool {
+	h.Opts = opts.(HTTPReloaderOpts)
+	return true
+}
+
+func (h HTTPReloader) SetCounter(c int) Reloader {
+	h.Counter = c
+	return h
+}
+
+func (h HTTPReloader) SetChangedFiles(files []string) Reloader {
+	h.ChangedFiles = files
+	return h
+}
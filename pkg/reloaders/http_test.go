@@ -0,0 +1,422 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// unixServer serves the handler over a unix socket in dir, and returns the
+// server along with the path of the socket.
+func unixServer(c *C, dir string, handler http.Handler) (*httptest.Server, string) {
+	socket := filepath.Join(dir, "server.sock")
+	l, err := net.Listen("unix", socket)
+	c.Assert(err, IsNil)
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = l
+	server.Start()
+	return server, socket
+}
+
+type HTTPTestSuite struct {
+	// requests are the method, path and host of the requests to the server
+	requests []string
+}
+
+var _ = Suite(&HTTPTestSuite{})
+
+func (s *HTTPTestSuite) SetUpTest(c *C) {
+	s.requests = nil
+}
+
+func (s *HTTPTestSuite) handler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, fmt.Sprintf("%v %v %v", r.Method, r.URL.Path, r.Host))
+		w.WriteHeader(status)
+	})
+}
+
+func (s *HTTPTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewHTTPReloader("prometheus", "http", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *HTTPTestSuite) TestReloadSocket(c *C) {
+	server, socket := unixServer(c, c.MkDir(), s.handler(http.StatusOK))
+	defer server.Close()
+
+	r := s.reloader(c, fmt.Sprintf(`{"host": "unix://%v", "uri": "/-/reload", "method": "post", "timeout": "5"}`, socket))
+	c.Assert(r.GetOpts().(HTTPReloaderOpts).GetSocket(), Equals, socket)
+	c.Assert(r.Reload(), IsNil)
+	// the port is not used over a socket, and the host is localhost
+	c.Assert(s.requests, DeepEquals, []string{"POST /-/reload localhost"})
+
+	// the reload fails once the socket is gone
+	server.Close()
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 1)
+	c.Assert(err.(*ReloaderError).Message, Matches, "POST http://localhost/-/reload giving up.*")
+}
+
+func (s *HTTPTestSuite) TestReloadPayload(c *C) {
+	var (
+		methods []string
+		bodies  []string
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		methods = append(methods, r.Method)
+		bodies = append(bodies, string(body))
+		headers = append(headers, r.Header)
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	os.Setenv("BUTLER_TEST_RELOAD_AUTH", "Bearer reload-token")
+	defer os.Unsetenv("BUTLER_TEST_RELOAD_AUTH")
+	r := s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "uri": "/reload", "method": "put", "timeout": "5", "content-type": "application/json",
+		"payload": "{\"manager\": \"{{ .Manager }}\", \"count\": {{ .Counter }}, \"files\": {{ json .Files }}, \"list\": \"{{ join .Files \",\" }}\"}",
+		"headers": {"Authorization": "env:BUTLER_TEST_RELOAD_AUTH", "X-Reloaded-By": "butler"}}`, host, port))
+	r = r.SetCounter(3).SetChangedFiles([]string{"/etc/prometheus/prometheus.yml", "/etc/prometheus/alerts.yml"})
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(methods, DeepEquals, []string{"PUT"})
+	c.Assert(bodies[0], Equals, `{"manager": "prometheus", "count": 3, "files": ["/etc/prometheus/prometheus.yml","/etc/prometheus/alerts.yml"], "list": "/etc/prometheus/prometheus.yml,/etc/prometheus/alerts.yml"}`)
+	c.Assert(headers[0].Get("Content-Type"), Equals, "application/json")
+	c.Assert(headers[0].Get("Authorization"), Equals, "Bearer reload-token")
+	c.Assert(headers[0].Get("X-Reloaded-By"), Equals, "butler")
+
+	// no files are rendered as an empty list, not null
+	r = r.SetChangedFiles(nil)
+	payload, err := r.(HTTPReloader).GetPayload()
+	c.Assert(err, IsNil)
+	c.Assert(payload, Equals, `{"manager": "prometheus", "count": 3, "files": [], "list": ""}`)
+
+	// GET and HEAD send no payload, but the headers still
+	r = s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "uri": "/reload", "method": "get", "timeout": "5", "payload": "reload", "headers": {"X-Reloaded-By": "butler"}}`, host, port))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(methods[1], Equals, "GET")
+	c.Assert(bodies[1], Equals, "")
+	c.Assert(headers[1].Get("X-Reloaded-By"), Equals, "butler")
+
+	// a payload which does not render fails the reload
+	r = s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "uri": "/reload", "method": "post", "timeout": "5", "payload": "{{ index .Files 5 }}"}`, host, port))
+	err = r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Matches, "could not render payload: .*")
+	c.Assert(methods, HasLen, 2)
+
+	_, err = NewHTTPReloader("prometheus", "http", []byte(`{"host": "localhost", "payload": "{{ .Files"}`))
+	c.Assert(err, ErrorMatches, "could not parse http reloader payload.*")
+}
+
+func (s *HTTPTestSuite) TestReloadDefaultMethod(c *C) {
+	server := httptest.NewServer(s.handler(http.StatusOK))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	r := s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "uri": "/-/reload", "timeout": "5"}`, host, port))
+	c.Assert(r.GetOpts().(HTTPReloaderOpts).Method, Equals, "POST")
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, DeepEquals, []string{fmt.Sprintf("POST /-/reload %v", server.Listener.Addr().String())})
+}
+
+func (s *HTTPTestSuite) TestIsSuccessCode(c *C) {
+	tests := []struct {
+		codes   []string
+		code    int
+		success bool
+	}{
+		{nil, 200, true},
+		{nil, 204, false},
+		{[]string{"200", "202"}, 202, true},
+		{[]string{"200", "202"}, 201, false},
+		{[]string{"2xx"}, 200, true},
+		{[]string{"2xx"}, 299, true},
+		{[]string{"2XX"}, 204, true},
+		{[]string{"2xx"}, 302, false},
+		{[]string{"2xx", "3xx"}, 302, true},
+		{[]string{"2xx", "404"}, 404, true},
+		{[]string{"2xx", "404"}, 500, false},
+	}
+	for _, t := range tests {
+		entry, _ := json.Marshal(map[string]interface{}{"host": "localhost", "success-codes": t.codes})
+		r := s.reloader(c, string(entry))
+		c.Assert(r.GetOpts().(HTTPReloaderOpts).IsSuccessCode(t.code), Equals, t.success, Commentf("codes=%v code=%v", t.codes, t.code))
+	}
+
+	for _, code := range []string{"20", "2000", "600", "2x", "xx", "abc"} {
+		_, err := NewHTTPReloader("prometheus", "http", []byte(fmt.Sprintf(`{"host": "localhost", "success-codes": ["%v"]}`, code)))
+		c.Assert(err, ErrorMatches, fmt.Sprintf("invalid http reloader success-codes %v, expected eg: 200 or 2xx", code))
+	}
+}
+
+func (s *HTTPTestSuite) TestCheckResponseBody(c *C) {
+	tests := []struct {
+		opts string
+		body string
+		err  string
+	}{
+		// no checks
+		{``, `anything`, ``},
+		{`"success-body": "^OK$"`, `OK`, ``},
+		{`"success-body": "^OK$"`, `NOT OK`, `response body does not match \^OK\$`},
+		{`"success-body": "reload(ed)? successful"`, `config reloaded successful`, ``},
+		// the path merely exists
+		{`"success-json-path": "status"`, `{"status": "error"}`, ``},
+		{`"success-json-path": "$.data.status", "success-json-value": "success"`, `{"data": {"status": "success"}}`, ``},
+		{`"success-json-path": "data.status", "success-json-value": "success"`, `{"data": {"status": "error"}}`, `response body data.status is error, expected success`},
+		{`"success-json-path": "data.reloaded", "success-json-value": "true"`, `{"data": {"reloaded": true}}`, ``},
+		{`"success-json-path": "data.count", "success-json-value": "3"`, `{"data": {"count": 3}}`, ``},
+		{`"success-json-path": "data.status"`, `{"data": {}}`, `response body has no data.status`},
+		{`"success-json-path": "data.status"`, `{"status": "success"}`, `response body has no data.status`},
+		{`"success-json-path": "status"`, `status: success`, `could not parse response body as json.*`},
+		// both checks
+		{`"success-body": "success", "success-json-path": "status", "success-json-value": "success"`, `{"status": "success"}`, ``},
+		{`"success-body": "^OK", "success-json-path": "status"`, `{"status": "success"}`, `response body does not match .*`},
+	}
+	for _, t := range tests {
+		entry := `{"host": "localhost"}`
+		if t.opts != "" {
+			entry = fmt.Sprintf(`{"host": "localhost", %v}`, t.opts)
+		}
+		r := s.reloader(c, entry)
+		err := r.GetOpts().(HTTPReloaderOpts).CheckResponseBody([]byte(t.body))
+		if t.err == "" {
+			c.Assert(err, IsNil, Commentf("opts=%v body=%v", t.opts, t.body))
+		} else {
+			c.Assert(err, ErrorMatches, t.err, Commentf("opts=%v body=%v", t.opts, t.body))
+		}
+	}
+
+	// a regex which does not compile fails the reloader
+	_, err := NewHTTPReloader("prometheus", "http", []byte(`{"host": "localhost", "success-body": "reload(ed"}`))
+	c.Assert(err, ErrorMatches, `could not compile http reloader success-body reload\(ed.*`)
+}
+
+func (s *HTTPTestSuite) TestReloadResponseBody(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a success code, with a failure in the body
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status": "error", "error": "bad config"}`))
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	r := s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "timeout": "5", "success-codes": ["2xx"]}`, host, port))
+	c.Assert(r.Reload(), IsNil)
+
+	r = s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "timeout": "5", "success-codes": ["200"]}`, host, port))
+	err = r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, http.StatusAccepted)
+
+	r = s.reloader(c, fmt.Sprintf(`{"host": "%v", "port": "%v", "timeout": "5", "success-codes": ["2xx"], "success-json-path": "status", "success-json-value": "success"}`, host, port))
+	err = r.Reload()
+	c.Assert(err, NotNil)
+	// not the status code, which is a success code
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "response body status is error, expected success")
+}
+
+func (s *HTTPTestSuite) TestGetSocket(c *C) {
+	c.Assert(HTTPReloaderOpts{Host: "unix:///var/run/haproxy.sock"}.GetSocket(), Equals, "/var/run/haproxy.sock")
+	c.Assert(HTTPReloaderOpts{Host: "localhost"}.GetSocket(), Equals, "")
+	c.Assert(HTTPReloaderOpts{Host: "unix.domain.com"}.GetSocket(), Equals, "")
+}
+
+// testCA signs the server and client certificates of the tls tests.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(c *C) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "butler test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+// issue returns the pem encoded certificate and key for the name, which is
+// a dns name of the certificate too.
+func (ca *testCA) issue(c *C, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	c.Assert(err, IsNil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// tlsServer starts a server with a certificate for prometheus.domain.com
+// only, which requires a client certificate signed by the ca, and records
+// the common name of the client certificate of every request.
+func (s *HTTPTestSuite) tlsServer(c *C, ca *testCA) *httptest.Server {
+	certPEM, keyPEM := ca.issue(c, "prometheus.domain.com", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	c.Assert(err, IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	// a handshake on every request, so that a rotated client certificate
+	// is seen
+	server.Config.SetKeepAlivesEnabled(false)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+func (s *HTTPTestSuite) TestGetTLSConfig(c *C) {
+	dir := c.MkDir()
+	ca := newTestCA(c)
+	server := s.tlsServer(c, ca)
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	c.Assert(ioutil.WriteFile(caFile, ca.pem(), 0644), IsNil)
+	issueClient := func(name string) {
+		cert, key := ca.issue(c, name, x509.ExtKeyUsageClientAuth)
+		c.Assert(ioutil.WriteFile(certFile, cert, 0644), IsNil)
+		c.Assert(ioutil.WriteFile(keyFile, key, 0600), IsNil)
+	}
+	issueClient("butler-1")
+
+	reloader := func(opts string) Reloader {
+		r, err := NewHTTPReloader("prometheus", "https", []byte(fmt.Sprintf(`{"host": "127.0.0.1", "port": "%v", "uri": "/-/reload", "method": "post", "timeout": "5", %v}`, port, opts)))
+		c.Assert(err, IsNil)
+		return r
+	}
+	failed := func(r Reloader) {
+		err := r.Reload()
+		c.Assert(err, NotNil)
+		c.Assert(err.(*ReloaderError).Code, Equals, 1)
+	}
+
+	// the server certificate is not signed by the system roots
+	failed(reloader(fmt.Sprintf(`"tls-server-name": "prometheus.domain.com", "tls-cert": "%v", "tls-key": "%v"`, certFile, keyFile)))
+	// nor is it for 127.0.0.1
+	failed(reloader(fmt.Sprintf(`"tls-ca": "%v", "tls-cert": "%v", "tls-key": "%v"`, caFile, certFile, keyFile)))
+	// and the server requires a client certificate
+	failed(reloader(fmt.Sprintf(`"tls-ca": "%v", "tls-server-name": "prometheus.domain.com"`, caFile)))
+	c.Assert(s.requests, HasLen, 0)
+
+	r := reloader(fmt.Sprintf(`"tls-ca": "%v", "tls-server-name": "prometheus.domain.com", "tls-cert": "%v", "tls-key": "%v"`, caFile, certFile, keyFile))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, DeepEquals, []string{"butler-1"})
+
+	// the client certificate is read again on the next handshake
+	issueClient("butler-2")
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(s.requests, DeepEquals, []string{"butler-1", "butler-2"})
+}
+
+func (s *HTTPTestSuite) TestGetTLSConfigErrors(c *C) {
+	dir := c.MkDir()
+	ca := newTestCA(c)
+	cert, key := ca.issue(c, "butler", x509.ExtKeyUsageClientAuth)
+	certFile, keyFile, garbage := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"), filepath.Join(dir, "garbage.pem")
+	c.Assert(ioutil.WriteFile(certFile, cert, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, key, 0600), IsNil)
+	c.Assert(ioutil.WriteFile(garbage, []byte("not a certificate\n"), 0644), IsNil)
+
+	o := HTTPReloaderOpts{TLSCert: certFile}
+	_, err := o.GetTLSConfig(false)
+	c.Assert(err, ErrorMatches, "http reloader needs both tls-cert and tls-key for a client certificate")
+	o = HTTPReloaderOpts{TLSKey: keyFile}
+	_, err = o.GetTLSConfig(false)
+	c.Assert(err, ErrorMatches, "http reloader needs both tls-cert and tls-key for a client certificate")
+	o = HTTPReloaderOpts{TLSCert: garbage, TLSKey: keyFile}
+	_, err = o.GetTLSConfig(false)
+	c.Assert(err, ErrorMatches, "could not load http reloader tls-cert .*")
+	o = HTTPReloaderOpts{TLSCA: filepath.Join(dir, "missing.pem")}
+	_, err = o.GetTLSConfig(false)
+	c.Assert(err, ErrorMatches, "could not read http reloader tls-ca .*")
+	o = HTTPReloaderOpts{TLSCA: garbage}
+	_, err = o.GetTLSConfig(false)
+	c.Assert(err, ErrorMatches, "no certificates found in http reloader tls-ca .*")
+
+	// NewHTTPReloader fails the same way
+	_, err = NewHTTPReloader("prometheus", "https", []byte(fmt.Sprintf(`{"host": "127.0.0.1", "tls-cert": "%v"}`, certFile)))
+	c.Assert(err, ErrorMatches, "http reloader needs both tls-cert and tls-key for a client certificate")
+
+	o = HTTPReloaderOpts{TLSServerName: "prometheus.domain.com", TLSCert: certFile, TLSKey: keyFile}
+	config, err := o.GetTLSConfig(true)
+	c.Assert(err, IsNil)
+	c.Assert(config.ServerName, Equals, "prometheus.domain.com")
+	c.Assert(config.InsecureSkipVerify, Equals, true)
+	c.Assert(config.GetClientCertificate, NotNil)
+}
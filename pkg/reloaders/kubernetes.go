@@ -0,0 +1,264 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKubernetesKind       = "deployment"
+	defaultKubernetesAction     = "restart"
+	defaultKubernetesAnnotation = "butler.adobe.com/reloaded-at"
+	defaultKubernetesTimeout    = 30
+	kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// kubernetesRestartAnnotation is the pod template annotation kubectl
+	// rollout restart sets.
+	kubernetesRestartAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// kubernetesResources maps the kinds the reloader patches to their apps/v1
+// resources.
+var kubernetesResources = map[string]string{
+	"deployment":  "deployments",
+	"statefulset": "statefulsets",
+	"daemonset":   "daemonsets",
+}
+
+func NewKubernetesReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result KubernetesReloader
+		opts   KubernetesReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Kind = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Kind)))
+	if opts.Kind == "" {
+		opts.Kind = defaultKubernetesKind
+	}
+	if _, ok := kubernetesResources[opts.Kind]; !ok {
+		return result, fmt.Errorf("invalid kubernetes reloader kind %v", opts.Kind)
+	}
+	opts.Name = strings.TrimSpace(environment.GetVar(opts.Name))
+	if opts.Name == "" {
+		return result, errors.New("no name defined for kubernetes reloader")
+	}
+
+	opts.Action = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Action)))
+	switch opts.Action {
+	case "":
+		opts.Action = defaultKubernetesAction
+	case "restart", "annotate":
+	default:
+		return result, fmt.Errorf("invalid kubernetes reloader action %v", opts.Action)
+	}
+	opts.Annotation = strings.TrimSpace(environment.GetVar(opts.Annotation))
+	if opts.Annotation == "" {
+		opts.Annotation = defaultKubernetesAnnotation
+	}
+
+	opts.Namespace = strings.TrimSpace(environment.GetVar(opts.Namespace))
+	if opts.Namespace == "" {
+		ns, err := ioutil.ReadFile(fmt.Sprintf("%s/namespace", kubernetesServiceAccountDir))
+		if err != nil {
+			return result, errors.New("no namespace defined for kubernetes reloader, and not running in a cluster")
+		}
+		opts.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	opts.APIServer = strings.TrimSpace(environment.GetVar(opts.APIServer))
+	if opts.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return result, errors.New("no api-server defined for kubernetes reloader, and not running in a cluster")
+		}
+		opts.APIServer = fmt.Sprintf("https://%s", net.JoinHostPort(host, port))
+	}
+	opts.APIServer = strings.TrimRight(opts.APIServer, "/")
+
+	opts.TokenFile = strings.TrimSpace(environment.GetVar(opts.TokenFile))
+	if opts.TokenFile == "" {
+		opts.TokenFile = fmt.Sprintf("%s/token", kubernetesServiceAccountDir)
+	}
+	opts.CAFile = strings.TrimSpace(environment.GetVar(opts.CAFile))
+	if opts.CAFile == "" {
+		opts.CAFile = fmt.Sprintf("%s/ca.crt", kubernetesServiceAccountDir)
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout <= 0 {
+		log.Warnf("NewKubernetesReloader(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultKubernetesTimeout)
+		newTimeout = defaultKubernetesTimeout
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: strings.ToLower(environment.GetVar(opts.InsecureSkipVerify)) == "true"}
+	if !tlsConfig.InsecureSkipVerify && strings.HasPrefix(opts.APIServer, "https://") {
+		ca, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return result, fmt.Errorf("could not read kubernetes reloader ca-file %v", opts.CAFile)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return result, fmt.Errorf("no certificates found in kubernetes reloader ca-file %v", opts.CAFile)
+		}
+	}
+	opts.Client = &http.Client{
+		Timeout:   time.Duration(newTimeout) * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// KubernetesReloader reloads the manager by patching its Deployment,
+// StatefulSet or DaemonSet through the kubernetes API, for the setups where
+// butler writes the files into a volume which is shared with the pods. The
+// "restart" action sets the pod template annotation kubectl rollout restart
+// sets, so the pods are rolled. The "annotate" action sets the annotation
+// on the workload itself, for a controller which watches for it.
+type KubernetesReloader struct {
+	Manager string                 `json:"-"`
+	Counter int                    `json:"-"`
+	Method  string                 `mapstructure:"method" json:"method"`
+	Opts    KubernetesReloaderOpts `json:"opts"`
+}
+
+type KubernetesReloaderOpts struct {
+	Client             *http.Client `json:"-"`
+	Kind               string       `json:"kind"`
+	Name               string       `json:"name"`
+	Namespace          string       `json:"namespace"`
+	Action             string       `json:"action"`
+	Annotation         string       `json:"annotation"`
+	APIServer          string       `json:"api-server"`
+	TokenFile          string       `json:"token-file"`
+	CAFile             string       `json:"ca-file"`
+	InsecureSkipVerify string       `json:"insecure-skip-verify"`
+	Timeout            string       `json:"timeout"`
+}
+
+// patch returns the strategic merge patch for the action.
+func (o KubernetesReloaderOpts) patch(now time.Time) ([]byte, error) {
+	value := now.UTC().Format(time.RFC3339)
+	if o.Action == "restart" {
+		return json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"annotations": map[string]string{kubernetesRestartAnnotation: value},
+					},
+				},
+			},
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{o.Annotation: value},
+		},
+	})
+}
+
+func (k KubernetesReloader) Reload() error {
+	o := k.GetOpts().(KubernetesReloaderOpts)
+	u := fmt.Sprintf("%s/apis/apps/v1/namespaces/%s/%s/%s", o.APIServer, o.Namespace, kubernetesResources[o.Kind], o.Name)
+
+	data, err := o.patch(time.Now())
+	if err != nil {
+		return NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+	req, err := http.NewRequest("PATCH", u, bytes.NewReader(data))
+	if err != nil {
+		return NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+	req.Header.Set("Content-Type", "application/strategic-merge-patch+json")
+	req.Header.Set("Accept", "application/json")
+	// the token is read on every reload, since it is rotated
+	if token, err := ioutil.ReadFile(o.TokenFile); err == nil {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))))
+	} else {
+		log.Warnf("KubernetesReloader::Reload()[count=%v][manager=%v]: could not read token-file %v. err=%v", k.Counter, k.Manager, o.TokenFile, err.Error())
+	}
+
+	log.Debugf("KubernetesReloader::Reload()[count=%v][manager=%v]: %v'ing %v %v/%v", k.Counter, k.Manager, o.Action, o.Kind, o.Namespace, o.Name)
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		log.Errorf("KubernetesReloader::Reload()[count=%v][manager=%v]: err=%v", k.Counter, k.Manager, err.Error())
+		code := 2
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			// the same code as an http timeout, so manager-timeout-ok applies
+			code = 1
+		}
+		return NewReloaderError().WithMessage(err.Error()).WithCode(code)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(body, &status) != nil || status.Message == "" {
+			status.Message = resp.Status
+		}
+		log.Errorf("KubernetesReloader::Reload()[count=%v][manager=%v]: could not patch %v %v/%v. http_code=%d message=%v", k.Counter, k.Manager, o.Kind, o.Namespace, o.Name, resp.StatusCode, status.Message)
+		return NewReloaderError().WithMessage(fmt.Sprintf("could not patch %v %v/%v: %v", o.Kind, o.Namespace, o.Name, status.Message)).WithCode(resp.StatusCode)
+	}
+
+	log.Infof("KubernetesReloader::Reload()[count=%v][manager=%v]: successfully %v'ed %v %v/%v.", k.Counter, k.Manager, o.Action, o.Kind, o.Namespace, o.Name)
+	return nil
+}
+
+func (k KubernetesReloader) GetMethod() string {
+	return k.Method
+}
+func (k KubernetesReloader) GetOpts() ReloaderOpts {
+	return k.Opts
+}
+
+func (k KubernetesReloader) SetOpts(opts ReloaderOpts) bool {
+	k.Opts = opts.(KubernetesReloaderOpts)
+	return true
+}
+
+func (k KubernetesReloader) SetCounter(c int) Reloader {
+	k.Counter = c
+	return k
+}
+
+func (k KubernetesReloader) SetChangedFiles(files []string) Reloader {
+	return k
+}
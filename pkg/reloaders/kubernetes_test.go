@@ -0,0 +1,137 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type KubernetesTestSuite struct {
+	server *httptest.Server
+	dir    string
+	// the requests to the api server
+	paths   []string
+	headers []http.Header
+	bodies  []map[string]interface{}
+	// status and message are the response of the api server
+	status  int
+	message string
+}
+
+var _ = Suite(&KubernetesTestSuite{})
+
+func (s *KubernetesTestSuite) SetUpTest(c *C) {
+	s.paths, s.headers, s.bodies = nil, nil, nil
+	s.status, s.message = http.StatusOK, ""
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		s.paths = append(s.paths, r.Method+" "+r.URL.Path)
+		s.headers = append(s.headers, r.Header)
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.status)
+		if s.message != "" {
+			fmt.Fprintf(w, `{"kind": "Status", "status": "Failure", "message": %q, "code": %d}`, s.message, s.status)
+		}
+	}))
+
+	s.dir = c.MkDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "ca.crt"), ca, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "token"), []byte("service-account-token\n"), 0644), IsNil)
+}
+
+func (s *KubernetesTestSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *KubernetesTestSuite) reloader(c *C, opts string) Reloader {
+	entry := fmt.Sprintf(`{"name": "prometheus", "namespace": "monitoring", "api-server": "%v", "ca-file": "%v", "token-file": "%v", %v}`,
+		s.server.URL, filepath.Join(s.dir, "ca.crt"), filepath.Join(s.dir, "token"), opts)
+	r, err := NewKubernetesReloader("prometheus", "kubernetes", []byte(entry))
+	c.Assert(err, IsNil)
+	return r
+}
+
+// annotation returns the annotation of the patch at path, eg: spec.template
+func annotation(c *C, body map[string]interface{}, path []string, name string) string {
+	for _, p := range path {
+		c.Assert(body[p], NotNil, Commentf("no %v in %v", p, body))
+		body = body[p].(map[string]interface{})
+	}
+	annotations := body["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	value, _ := annotations[name].(string)
+	return value
+}
+
+func (s *KubernetesTestSuite) TestNewKubernetesReloader(c *C) {
+	_, err := NewKubernetesReloader("prometheus", "kubernetes", []byte(`{"namespace": "monitoring", "api-server": "http://127.0.0.1:8001"}`))
+	c.Assert(err, ErrorMatches, "no name defined for kubernetes reloader")
+	_, err = NewKubernetesReloader("prometheus", "kubernetes", []byte(`{"name": "prometheus", "kind": "pod", "namespace": "monitoring", "api-server": "http://127.0.0.1:8001"}`))
+	c.Assert(err, ErrorMatches, "invalid kubernetes reloader kind pod")
+	_, err = NewKubernetesReloader("prometheus", "kubernetes", []byte(`{"name": "prometheus", "action": "delete", "namespace": "monitoring", "api-server": "http://127.0.0.1:8001"}`))
+	c.Assert(err, ErrorMatches, "invalid kubernetes reloader action delete")
+	_, err = NewKubernetesReloader("prometheus", "kubernetes", []byte(`{"name": "prometheus", "namespace": "monitoring", "api-server": "https://127.0.0.1:6443", "ca-file": "/nonexistent/ca.crt"}`))
+	c.Assert(err, ErrorMatches, "could not read kubernetes reloader ca-file /nonexistent/ca.crt")
+}
+
+func (s *KubernetesTestSuite) TestReloadRestart(c *C) {
+	before := time.Now().UTC().Truncate(time.Second)
+	r := s.reloader(c, `"kind": "StatefulSet"`)
+	c.Assert(r.Reload(), IsNil)
+
+	c.Assert(s.paths, DeepEquals, []string{"PATCH /apis/apps/v1/namespaces/monitoring/statefulsets/prometheus"})
+	c.Assert(s.headers[0].Get("Content-Type"), Equals, "application/strategic-merge-patch+json")
+	c.Assert(s.headers[0].Get("Authorization"), Equals, "Bearer service-account-token")
+
+	// the same patch as kubectl rollout restart, on the pod template only
+	c.Assert(s.bodies[0]["metadata"], IsNil)
+	value := annotation(c, s.bodies[0], []string{"spec", "template"}, kubernetesRestartAnnotation)
+	at, err := time.Parse(time.RFC3339, value)
+	c.Assert(err, IsNil)
+	c.Assert(at.Before(before), Equals, false)
+}
+
+func (s *KubernetesTestSuite) TestReloadAnnotate(c *C) {
+	r := s.reloader(c, `"kind": "daemonset", "action": "annotate", "annotation": "example.com/config"`)
+	c.Assert(r.Reload(), IsNil)
+
+	c.Assert(s.paths, DeepEquals, []string{"PATCH /apis/apps/v1/namespaces/monitoring/daemonsets/prometheus"})
+	c.Assert(s.bodies[0]["spec"], IsNil)
+	c.Assert(annotation(c, s.bodies[0], nil, "example.com/config"), Not(Equals), "")
+}
+
+func (s *KubernetesTestSuite) TestReloadFailed(c *C) {
+	s.status, s.message = http.StatusForbidden, `deployments.apps "prometheus" is forbidden`
+	err := s.reloader(c, `"kind": "deployment"`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, http.StatusForbidden)
+	c.Assert(err.(*ReloaderError).Message, Equals, `could not patch deployment monitoring/prometheus: deployments.apps "prometheus" is forbidden`)
+
+	// a response which is not a kubernetes status
+	s.status, s.message = http.StatusBadGateway, ""
+	err = s.reloader(c, `"kind": "deployment"`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, http.StatusBadGateway)
+	c.Assert(err.(*ReloaderError).Message, Equals, "could not patch deployment monitoring/prometheus: 502 Bad Gateway")
+}
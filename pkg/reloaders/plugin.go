@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adobe/butler/internal/plugins"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pluginReloaders are the reloader plugins, which can not replace the
+// reloaders built into butler.
+var pluginReloaders = plugins.NewRegistry(plugins.ReloaderPrefix, "http", "https", "exec", "signal", "systemd", "docker", "kubernetes")
+
+// LoadPlugins registers the reloader plugins in the dir, which are named
+// butler-reloader-<method>, see package plugins. It returns the methods it
+// registered.
+func LoadPlugins(dir string) ([]string, error) {
+	return pluginReloaders.Load(dir)
+}
+
+// Plugins returns the reloader methods which are provided by plugins.
+func Plugins() []string {
+	return pluginReloaders.Names()
+}
+
+func NewPluginReloader(manager string, method string, path string, entry []byte) (Reloader, error) {
+	result := PluginReloader{Manager: manager, Method: method, Path: path}
+	err := json.Unmarshal(entry, &result.Opts)
+	return result, err
+}
+
+// PluginReloader reloads the manager with a reloader plugin, whose reload
+// operation is given the manager, the files which changed and the options of
+// the reloader. Like the exec reloader, a plugin which fails, or runs past
+// the timeout, fails the reload.
+type PluginReloader struct {
+	Manager      string                 `json:"-"`
+	Counter      int                    `json:"-"`
+	ChangedFiles []string               `json:"-"`
+	Path         string                 `json:"-"`
+	Method       string                 `json:"method"`
+	Opts         map[string]interface{} `json:"opts"`
+}
+
+// PluginReloaderRequest is written to the stdin of a reloader plugin.
+type PluginReloaderRequest struct {
+	Manager      string                 `json:"manager"`
+	ChangedFiles []string               `json:"changed-files"`
+	Options      map[string]interface{} `json:"options"`
+}
+
+func (p PluginReloader) Reload() error {
+	timeout := defaultExecTimeout * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Debugf("PluginReloader::Reload()[count=%v][manager=%v]: reloading manager using %v", p.Counter, p.Manager, p.Path)
+	_, err := plugins.Run(ctx, p.Path, "reload", PluginReloaderRequest{Manager: p.Manager, ChangedFiles: p.ChangedFiles, Options: p.Opts})
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Errorf("PluginReloader::Reload()[count=%v][manager=%v]: plugin timed out after %v", p.Counter, p.Manager, timeout)
+		// the same code as an http timeout, so manager-timeout-ok applies
+		return NewReloaderError().WithMessage(fmt.Sprintf("plugin timed out after %v", timeout)).WithCode(1)
+	}
+	if err != nil {
+		log.Errorf("PluginReloader::Reload()[count=%v][manager=%v]: err=%v", p.Counter, p.Manager, err.Error())
+		return NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+
+	log.Infof("PluginReloader::Reload()[count=%v][manager=%v]: successfully reloaded config.", p.Counter, p.Manager)
+	return nil
+}
+
+func (p PluginReloader) GetMethod() string {
+	return p.Method
+}
+
+func (p PluginReloader) GetOpts() ReloaderOpts {
+	return p.Opts
+}
+
+func (p PluginReloader) SetOpts(opts ReloaderOpts) bool {
+	p.Opts = opts.(map[string]interface{})
+	return true
+}
+
+func (p PluginReloader) SetCounter(c int) Reloader {
+	p.Counter = c
+	return p
+}
+
+func (p PluginReloader) SetChangedFiles(files []string) Reloader {
+	p.ChangedFiles = files
+	return p
+}
@@ -27,24 +27,40 @@ type Reloader interface {
 	GetOpts() ReloaderOpts
 	SetOpts(ReloaderOpts) bool
 	SetCounter(int) Reloader
+	SetChangedFiles([]string) Reloader
 }
 
 type ReloaderOpts interface {
 }
 
 func New(entry string) (Reloader, error) {
+	reloader, err := newFromKey(entry, fmt.Sprintf("%s.reloader", entry))
+
+	groupsKey := fmt.Sprintf("%s.reloader-groups", entry)
+	if !viper.IsSet(groupsKey) {
+		return reloader, err
+	}
+	// the default reloader is optional when every file belongs to a group
+	if err != nil {
+		reloader = nil
+	}
+	return NewGroupReloader(entry, reloader, groupsKey)
+}
+
+func newFromKey(entry string, key string) (Reloader, error) {
 	var (
 		err    error
 		result map[string]interface{}
 	)
 
-	key := fmt.Sprintf("%s.reloader", entry)
-
 	err = viper.UnmarshalKey(key, &result)
 	if err != nil {
 		return NewGenericReloader(entry, "error", []byte(entry))
 	}
+	return newFromResult(entry, result)
+}
 
+func newFromResult(entry string, result map[string]interface{}) (Reloader, error) {
 	// No reloader has been defined. We'll assume that is OK
 	// but will let the upstream know and they can handle it
 	if result == nil {
@@ -56,7 +72,29 @@ func New(entry string) (Reloader, error) {
 		return NewGenericReloaderWithCustomError(entry, "error", errors.New("no reloader has been defined for manager"))
 	}
 
-	method := result["method"].(string)
+	// method can either be a single string, or an array of methods which
+	// are run in order
+	var methods []string
+	switch m := result["method"].(type) {
+	case string:
+		methods = append(methods, m)
+	case []interface{}:
+		for _, i := range m {
+			methods = append(methods, fmt.Sprintf("%v", i))
+		}
+	default:
+		return NewGenericReloaderWithCustomError(entry, "error", fmt.Errorf("unknown reloader method type %T", m))
+	}
+	if len(methods) == 0 {
+		return NewGenericReloaderWithCustomError(entry, "error", errors.New("no reloader has been defined for manager"))
+	}
+	if len(methods) == 1 {
+		return newReloader(entry, methods[0], result)
+	}
+	return NewChainReloader(entry, methods, result)
+}
+
+func newReloader(entry string, method string, result map[string]interface{}) (Reloader, error) {
 	jsonRes, err := json.Marshal(result[method])
 	if err != nil {
 		return NewGenericReloader(entry, method, []byte(entry))
@@ -70,7 +108,22 @@ func New(entry string) (Reloader, error) {
 	switch method {
 	case "http", "https":
 		return NewHTTPReloader(entry, method, jsonRes)
+	case "exec":
+		return NewExecReloader(entry, method, jsonRes)
+	case "signal":
+		return NewSignalReloader(entry, method, jsonRes)
+	case "systemd":
+		return NewSystemdReloader(entry, method, jsonRes)
+	case "windows-service":
+		return NewWindowsServiceReloader(entry, method, jsonRes)
+	case "docker":
+		return NewDockerReloader(entry, method, jsonRes)
+	case "kubernetes":
+		return NewKubernetesReloader(entry, method, jsonRes)
 	default:
+		if path, ok := pluginReloaders.Path(method); ok {
+			return NewPluginReloader(entry, method, path, jsonRes)
+		}
 		return NewGenericReloader(entry, method, jsonRes)
 	}
 }
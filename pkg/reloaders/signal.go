@@ -0,0 +1,205 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultSignal = "SIGHUP"
+
+// ParseSignal returns the signal for the name, eg: "SIGHUP", "hup" or "1".
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal %v", name)
+}
+
+func NewSignalReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result SignalReloader
+		opts   SignalReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Signal = strings.TrimSpace(environment.GetVar(opts.Signal))
+	if opts.Signal == "" {
+		opts.Signal = defaultSignal
+	}
+	opts.signal, err = ParseSignal(opts.Signal)
+	if err != nil {
+		return result, err
+	}
+
+	opts.PidFile = strings.TrimSpace(environment.GetVar(opts.PidFile))
+	opts.ProcessName = strings.TrimSpace(environment.GetVar(opts.ProcessName))
+	opts.SystemdUnit = strings.TrimSpace(environment.GetVar(opts.SystemdUnit))
+	targets := 0
+	for _, t := range []string{opts.PidFile, opts.ProcessName, opts.SystemdUnit} {
+		if t != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return result, errors.New("signal reloader needs exactly one of pid-file, process-name or systemd-unit")
+	}
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// SignalReloader reloads the manager by sending it a signal, SIGHUP by
+// default, for the daemons which reload on a signal and have no http reload
+// endpoint. The process is found by its pid file, its name, or the main pid
+// of its systemd unit.
+type SignalReloader struct {
+	Manager string             `json:"-"`
+	Counter int                `json:"-"`
+	Method  string             `mapstructure:"method" json:"method"`
+	Opts    SignalReloaderOpts `json:"opts"`
+}
+
+type SignalReloaderOpts struct {
+	Signal      string `json:"signal"`
+	PidFile     string `json:"pid-file"`
+	ProcessName string `json:"process-name"`
+	SystemdUnit string `json:"systemd-unit"`
+	signal      syscall.Signal
+}
+
+// pids returns the pids of the processes to signal.
+func (o SignalReloaderOpts) pids() ([]int, error) {
+	switch {
+	case o.PidFile != "":
+		data, err := ioutil.ReadFile(o.PidFile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid pid in %v", o.PidFile)
+		}
+		return []int{pid}, nil
+	case o.ProcessName != "":
+		return findProcesses(o.ProcessName)
+	default:
+		return systemdMainPID(o.SystemdUnit)
+	}
+}
+
+// findProcesses returns the pids of the processes whose name, or the base
+// name of whose executable, is name.
+func findProcesses(name string) ([]int, error) {
+	var res []int
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || pid == syscall.Getpid() {
+			continue
+		}
+		comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		cmdline, _ := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if strings.TrimSpace(string(comm)) == name || (argv0 != "" && filepath.Base(argv0) == name) {
+			res = append(res, pid)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no process named %v found", name)
+	}
+	return res, nil
+}
+
+// systemdMainPID returns the main pid of the systemd unit.
+func systemdMainPID(unit string) ([]int, error) {
+	out, err := exec.Command("systemctl", "show", "--property=MainPID", unit).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the main pid of unit %v. err=%v", unit, err.Error())
+	}
+	pid, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(string(out)), "MainPID="))
+	if err != nil || pid <= 0 {
+		return nil, fmt.Errorf("unit %v is not running", unit)
+	}
+	return []int{pid}, nil
+}
+
+func (s SignalReloader) Reload() error {
+	o := s.GetOpts().(SignalReloaderOpts)
+	pids, err := o.pids()
+	if err != nil {
+		log.Errorf("SignalReloader::Reload()[count=%v][manager=%v]: could not find process to signal. err=%v", s.Counter, s.Manager, err.Error())
+		return NewReloaderError().WithMessage(err.Error()).WithCode(2)
+	}
+
+	for _, pid := range pids {
+		log.Debugf("SignalReloader::Reload()[count=%v][manager=%v]: sending %v to pid %v", s.Counter, s.Manager, o.Signal, pid)
+		if err := sendSignal(pid, o.signal); err != nil {
+			log.Errorf("SignalReloader::Reload()[count=%v][manager=%v]: could not send %v to pid %v. err=%v", s.Counter, s.Manager, o.Signal, pid, err.Error())
+			return NewReloaderError().WithMessage(fmt.Sprintf("could not send %v to pid %v: %v", o.Signal, pid, err.Error())).WithCode(2)
+		}
+	}
+
+	log.Infof("SignalReloader::Reload()[count=%v][manager=%v]: successfully sent %v to pids %v.", s.Counter, s.Manager, o.Signal, pids)
+	return nil
+}
+
+func (s SignalReloader) GetMethod() string {
+	return s.Method
+}
+func (s SignalReloader) GetOpts() ReloaderOpts {
+	return s.Opts
+}
+
+func (s SignalReloader) SetOpts(opts ReloaderOpts) bool {
+	s.Opts = opts.(SignalReloaderOpts)
+	return true
+}
+
+func (s SignalReloader) SetCounter(c int) Reloader {
+	s.Counter = c
+	return s
+}
+
+func (s SignalReloader) SetChangedFiles(files []string) Reloader {
+	return s
+}
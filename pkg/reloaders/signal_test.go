@@ -0,0 +1,158 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+)
+
+type SignalTestSuite struct {
+	dir string
+}
+
+var _ = Suite(&SignalTestSuite{})
+
+func (s *SignalTestSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// start runs a sleep under the name, so that it can be found by its name,
+// and returns its command
+func (s *SignalTestSuite) start(c *C, name string) *exec.Cmd {
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		sleep, err := exec.LookPath("sleep")
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadFile(sleep)
+		c.Assert(err, IsNil)
+		c.Assert(ioutil.WriteFile(path, data, 0755), IsNil)
+	}
+	cmd := exec.Command(path, "30")
+	c.Assert(cmd.Start(), IsNil)
+	return cmd
+}
+
+// signaled returns the signal which ended the command
+func signaled(c *C, cmd *exec.Cmd) syscall.Signal {
+	err := cmd.Wait()
+	c.Assert(err, NotNil)
+	status, ok := err.(*exec.ExitError).Sys().(syscall.WaitStatus)
+	c.Assert(ok, Equals, true)
+	c.Assert(status.Signaled(), Equals, true)
+	return status.Signal()
+}
+
+func (s *SignalTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewSignalReloader("prometheus", "signal", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *SignalTestSuite) TestParseSignal(c *C) {
+	for _, name := range []string{"SIGHUP", "sighup", "hup", " HUP ", "1"} {
+		sig, err := ParseSignal(name)
+		c.Assert(err, IsNil)
+		c.Assert(sig, Equals, syscall.SIGHUP)
+	}
+	sig, err := ParseSignal("usr2")
+	c.Assert(err, IsNil)
+	c.Assert(sig, Equals, syscall.SIGUSR2)
+
+	_, err = ParseSignal("bogus")
+	c.Assert(err, ErrorMatches, "unknown signal SIGBOGUS")
+	_, err = ParseSignal("0")
+	c.Assert(err, ErrorMatches, "unknown signal SIG0")
+}
+
+func (s *SignalTestSuite) TestNewSignalReloader(c *C) {
+	r := s.reloader(c, `{"pid-file": "/var/run/prometheus.pid"}`)
+	c.Assert(r.GetOpts().(SignalReloaderOpts).signal, Equals, syscall.SIGHUP)
+
+	_, err := NewSignalReloader("prometheus", "signal", []byte(`{"signal": "bogus", "pid-file": "/var/run/prometheus.pid"}`))
+	c.Assert(err, ErrorMatches, "unknown signal SIGBOGUS")
+	_, err = NewSignalReloader("prometheus", "signal", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "signal reloader needs exactly one of pid-file, process-name or systemd-unit")
+	_, err = NewSignalReloader("prometheus", "signal", []byte(`{"pid-file": "/var/run/prometheus.pid", "process-name": "prometheus"}`))
+	c.Assert(err, ErrorMatches, "signal reloader needs exactly one of pid-file, process-name or systemd-unit")
+}
+
+func (s *SignalTestSuite) TestReloadPidFile(c *C) {
+	cmd := s.start(c, "butler-test-pid")
+	pidFile := filepath.Join(s.dir, "prometheus.pid")
+	c.Assert(ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%v\n", cmd.Process.Pid)), 0644), IsNil)
+
+	r := s.reloader(c, fmt.Sprintf(`{"signal": "SIGUSR1", "pid-file": "%v"}`, pidFile))
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(signaled(c, cmd), Equals, syscall.SIGUSR1)
+}
+
+func (s *SignalTestSuite) TestReloadBadPidFile(c *C) {
+	r := s.reloader(c, fmt.Sprintf(`{"pid-file": "%v"}`, filepath.Join(s.dir, "missing.pid")))
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Matches, ".*no such file or directory")
+
+	pidFile := filepath.Join(s.dir, "garbage.pid")
+	c.Assert(ioutil.WriteFile(pidFile, []byte("not a pid\n"), 0644), IsNil)
+	r = s.reloader(c, fmt.Sprintf(`{"pid-file": "%v"}`, pidFile))
+	err = r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Message, Equals, fmt.Sprintf("invalid pid in %v", pidFile))
+}
+
+func (s *SignalTestSuite) TestReloadProcessName(c *C) {
+	first := s.start(c, "butler-test-name")
+	second := s.start(c, "butler-test-name")
+
+	r := s.reloader(c, `{"signal": "term", "process-name": "butler-test-name"}`)
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(signaled(c, first), Equals, syscall.SIGTERM)
+	c.Assert(signaled(c, second), Equals, syscall.SIGTERM)
+
+	r = s.reloader(c, `{"process-name": "butler-test-none"}`)
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "no process named butler-test-none found")
+}
+
+func (s *SignalTestSuite) TestReloadSystemdUnit(c *C) {
+	cmd := s.start(c, "butler-test-unit")
+
+	// a systemctl which knows the main pid of prometheus.service only
+	systemctl := fmt.Sprintf("#!/bin/sh\nif [ \"$3\" = prometheus.service ]; then echo MainPID=%v; else echo MainPID=0; fi\n", cmd.Process.Pid)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "systemctl"), []byte(systemctl), 0755), IsNil)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", s.dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	r := s.reloader(c, `{"systemd-unit": "prometheus.service"}`)
+	c.Assert(r.Reload(), IsNil)
+	c.Assert(signaled(c, cmd), Equals, syscall.SIGHUP)
+
+	r = s.reloader(c, `{"systemd-unit": "alertmanager.service"}`)
+	err := r.Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Message, Equals, "unit alertmanager.service is not running")
+}
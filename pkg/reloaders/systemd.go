@@ -0,0 +1,210 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+	"github.com/adobe/butler/internal/metrics"
+
+	sdbus "github.com/coreos/go-systemd/dbus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSystemdAction  = "reload"
+	defaultSystemdMode    = "replace"
+	defaultSystemdTimeout = 60
+)
+
+// systemdConn is the part of the systemd D-Bus connection which the
+// reloader uses.
+type systemdConn interface {
+	ReloadUnit(name string, mode string, ch chan<- string) (int, error)
+	RestartUnit(name string, mode string, ch chan<- string) (int, error)
+	TryRestartUnit(name string, mode string, ch chan<- string) (int, error)
+	ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error)
+	GetUnitProperty(unit string, propertyName string) (*sdbus.Property, error)
+	Close()
+}
+
+// newSystemdConn connects to the user or the system instance of systemd.
+var newSystemdConn = func(userBus bool) (systemdConn, error) {
+	if userBus {
+		return sdbus.NewUserConnection()
+	}
+	return sdbus.NewSystemConnection()
+}
+
+func NewSystemdReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result SystemdReloader
+		opts   SystemdReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Unit = strings.TrimSpace(environment.GetVar(opts.Unit))
+	if opts.Unit == "" {
+		return result, errors.New("no unit defined for systemd reloader")
+	}
+
+	opts.Action = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Action)))
+	switch opts.Action {
+	case "":
+		opts.Action = defaultSystemdAction
+	case "reload", "restart", "try-restart", "reload-or-restart":
+	default:
+		return result, fmt.Errorf("invalid systemd reloader action %v", opts.Action)
+	}
+
+	opts.Mode = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Mode)))
+	switch opts.Mode {
+	case "":
+		opts.Mode = defaultSystemdMode
+	case "replace", "fail", "ignore-dependencies", "ignore-requirements":
+	default:
+		return result, fmt.Errorf("invalid systemd reloader mode %v", opts.Mode)
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout <= 0 {
+		log.Warnf("NewSystemdReloader(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultSystemdTimeout)
+		newTimeout = defaultSystemdTimeout
+	}
+	opts.timeout = time.Duration(newTimeout) * time.Second
+
+	opts.userBus = strings.ToLower(environment.GetVar(opts.UserBus)) == "true"
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// SystemdReloader reloads the manager by asking systemd, over D-Bus, to
+// reload or restart its unit, and waits for the systemd job to complete. The
+// ActiveState of the unit afterwards is reported in the
+// butler_manager_unit_state metric.
+type SystemdReloader struct {
+	Manager string              `json:"-"`
+	Counter int                 `json:"-"`
+	Method  string              `mapstructure:"method" json:"method"`
+	Opts    SystemdReloaderOpts `json:"opts"`
+}
+
+type SystemdReloaderOpts struct {
+	Unit    string `json:"unit"`
+	Action  string `json:"action"`
+	Mode    string `json:"mode"`
+	Timeout string `json:"timeout"`
+	UserBus string `json:"user-bus"`
+	timeout time.Duration
+	userBus bool
+}
+
+func (s SystemdReloader) Reload() error {
+	o := s.GetOpts().(SystemdReloaderOpts)
+	log.Debugf("SystemdReloader::Reload()[count=%v][manager=%v]: %v'ing unit %v", s.Counter, s.Manager, o.Action, o.Unit)
+
+	conn, err := newSystemdConn(o.userBus)
+	if err != nil {
+		log.Errorf("SystemdReloader::Reload()[count=%v][manager=%v]: could not connect to systemd. err=%v", s.Counter, s.Manager, err.Error())
+		return NewReloaderError().WithMessage(fmt.Sprintf("could not connect to systemd: %v", err.Error())).WithCode(2)
+	}
+	defer conn.Close()
+
+	// buffered, so that a job which completes after the timeout does not
+	// block the connection
+	done := make(chan string, 1)
+	switch o.Action {
+	case "restart":
+		_, err = conn.RestartUnit(o.Unit, o.Mode, done)
+	case "try-restart":
+		_, err = conn.TryRestartUnit(o.Unit, o.Mode, done)
+	case "reload-or-restart":
+		_, err = conn.ReloadOrRestartUnit(o.Unit, o.Mode, done)
+	default:
+		_, err = conn.ReloadUnit(o.Unit, o.Mode, done)
+	}
+	if err != nil {
+		log.Errorf("SystemdReloader::Reload()[count=%v][manager=%v]: could not %v unit %v. err=%v", s.Counter, s.Manager, o.Action, o.Unit, err.Error())
+		return NewReloaderError().WithMessage(fmt.Sprintf("could not %v unit %v: %v", o.Action, o.Unit, err.Error())).WithCode(2)
+	}
+
+	var res string
+	select {
+	case res = <-done:
+	case <-time.After(o.timeout):
+		log.Errorf("SystemdReloader::Reload()[count=%v][manager=%v]: %v of unit %v timed out after %v", s.Counter, s.Manager, o.Action, o.Unit, o.timeout)
+		s.setUnitState(conn, o.Unit)
+		// the same code as an http timeout, so manager-timeout-ok applies
+		return NewReloaderError().WithMessage(fmt.Sprintf("%v of unit %v timed out after %v", o.Action, o.Unit, o.timeout)).WithCode(1)
+	}
+
+	state := s.setUnitState(conn, o.Unit)
+	if res != "done" {
+		log.Errorf("SystemdReloader::Reload()[count=%v][manager=%v]: %v of unit %v did not complete. result=%v state=%v", s.Counter, s.Manager, o.Action, o.Unit, res, state)
+		return NewReloaderError().WithMessage(fmt.Sprintf("%v of unit %v did not complete: %v", o.Action, o.Unit, res)).WithCode(2)
+	}
+
+	log.Infof("SystemdReloader::Reload()[count=%v][manager=%v]: successfully %v'ed unit %v. state=%v", s.Counter, s.Manager, o.Action, o.Unit, state)
+	return nil
+}
+
+// setUnitState reports the ActiveState of the unit in the metrics, and
+// returns it.
+func (s SystemdReloader) setUnitState(conn systemdConn, unit string) string {
+	prop, err := conn.GetUnitProperty(unit, "ActiveState")
+	if err != nil {
+		log.Warnf("SystemdReloader::Reload()[count=%v][manager=%v]: could not get the state of unit %v. err=%v", s.Counter, s.Manager, unit, err.Error())
+		return "unknown"
+	}
+	state, ok := prop.Value.Value().(string)
+	if !ok {
+		return "unknown"
+	}
+	metrics.SetButlerUnitStateVal(s.Manager, unit, state)
+	return state
+}
+
+func (s SystemdReloader) GetMethod() string {
+	return s.Method
+}
+func (s SystemdReloader) GetOpts() ReloaderOpts {
+	return s.Opts
+}
+
+func (s SystemdReloader) SetOpts(opts ReloaderOpts) bool {
+	s.Opts = opts.(SystemdReloaderOpts)
+	return true
+}
+
+func (s SystemdReloader) SetCounter(c int) Reloader {
+	s.Counter = c
+	return s
+}
+
+func (s SystemdReloader) SetChangedFiles(files []string) Reloader {
+	return s
+}
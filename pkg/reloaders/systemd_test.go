@@ -0,0 +1,174 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"errors"
+	"time"
+
+	sdbus "github.com/coreos/go-systemd/dbus"
+	"github.com/godbus/dbus"
+	. "gopkg.in/check.v1"
+)
+
+// fakeSystemdConn completes the jobs with result, or never when result is
+// empty, and records the calls made.
+type fakeSystemdConn struct {
+	result string
+	err    error
+	state  string
+	calls  []string
+	closed bool
+}
+
+func (f *fakeSystemdConn) job(call string, name string, mode string, ch chan<- string) (int, error) {
+	f.calls = append(f.calls, call+" "+name+" "+mode)
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.result != "" {
+		ch <- f.result
+	}
+	return 1, nil
+}
+
+func (f *fakeSystemdConn) ReloadUnit(name string, mode string, ch chan<- string) (int, error) {
+	return f.job("ReloadUnit", name, mode, ch)
+}
+
+func (f *fakeSystemdConn) RestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return f.job("RestartUnit", name, mode, ch)
+}
+
+func (f *fakeSystemdConn) TryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return f.job("TryRestartUnit", name, mode, ch)
+}
+
+func (f *fakeSystemdConn) ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error) {
+	return f.job("ReloadOrRestartUnit", name, mode, ch)
+}
+
+func (f *fakeSystemdConn) GetUnitProperty(unit string, propertyName string) (*sdbus.Property, error) {
+	return &sdbus.Property{Name: propertyName, Value: dbus.MakeVariant(f.state)}, nil
+}
+
+func (f *fakeSystemdConn) Close() {
+	f.closed = true
+}
+
+type SystemdTestSuite struct {
+	conn    *fakeSystemdConn
+	newConn func(bool) (systemdConn, error)
+}
+
+var _ = Suite(&SystemdTestSuite{})
+
+func (s *SystemdTestSuite) SetUpTest(c *C) {
+	s.conn = &fakeSystemdConn{result: "done", state: "active"}
+	s.newConn = newSystemdConn
+	newSystemdConn = func(userBus bool) (systemdConn, error) {
+		return s.conn, nil
+	}
+}
+
+func (s *SystemdTestSuite) TearDownTest(c *C) {
+	newSystemdConn = s.newConn
+}
+
+func (s *SystemdTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewSystemdReloader("prometheus", "systemd", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *SystemdTestSuite) TestNewSystemdReloader(c *C) {
+	r := s.reloader(c, `{"unit": "prometheus.service"}`)
+	o := r.GetOpts().(SystemdReloaderOpts)
+	c.Assert(o.Action, Equals, defaultSystemdAction)
+	c.Assert(o.Mode, Equals, defaultSystemdMode)
+	c.Assert(o.timeout, Equals, defaultSystemdTimeout*time.Second)
+	c.Assert(o.userBus, Equals, false)
+
+	r = s.reloader(c, `{"unit": "prometheus.service", "action": "Reload-Or-Restart", "mode": "FAIL", "timeout": "5", "user-bus": "true"}`)
+	o = r.GetOpts().(SystemdReloaderOpts)
+	c.Assert(o.Action, Equals, "reload-or-restart")
+	c.Assert(o.Mode, Equals, "fail")
+	c.Assert(o.timeout, Equals, 5*time.Second)
+	c.Assert(o.userBus, Equals, true)
+
+	// a timeout which is not a positive number of seconds is the default
+	for _, timeout := range []string{"bogus", "0", "-5"} {
+		r = s.reloader(c, `{"unit": "prometheus.service", "timeout": "`+timeout+`"}`)
+		c.Assert(r.GetOpts().(SystemdReloaderOpts).timeout, Equals, defaultSystemdTimeout*time.Second)
+	}
+
+	_, err := NewSystemdReloader("prometheus", "systemd", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "no unit defined for systemd reloader")
+	_, err = NewSystemdReloader("prometheus", "systemd", []byte(`{"unit": "prometheus.service", "action": "stop"}`))
+	c.Assert(err, ErrorMatches, "invalid systemd reloader action stop")
+	_, err = NewSystemdReloader("prometheus", "systemd", []byte(`{"unit": "prometheus.service", "mode": "isolate"}`))
+	c.Assert(err, ErrorMatches, "invalid systemd reloader mode isolate")
+}
+
+func (s *SystemdTestSuite) TestReload(c *C) {
+	for action, call := range map[string]string{
+		"reload":            "ReloadUnit",
+		"restart":           "RestartUnit",
+		"try-restart":       "TryRestartUnit",
+		"reload-or-restart": "ReloadOrRestartUnit",
+	} {
+		s.conn.calls = nil
+		r := s.reloader(c, `{"unit": "prometheus.service", "action": "`+action+`", "mode": "fail"}`)
+		c.Assert(r.Reload(), IsNil)
+		c.Assert(s.conn.calls, DeepEquals, []string{call + " prometheus.service fail"})
+		c.Assert(s.conn.closed, Equals, true)
+	}
+}
+
+func (s *SystemdTestSuite) TestReloadJobFailed(c *C) {
+	for _, result := range []string{"failed", "canceled", "dependency", "skipped"} {
+		s.conn.result = result
+		s.conn.state = "failed"
+		err := s.reloader(c, `{"unit": "prometheus.service"}`).Reload()
+		c.Assert(err, NotNil)
+		c.Assert(err.(*ReloaderError).Code, Equals, 2)
+		c.Assert(err.(*ReloaderError).Message, Equals, "reload of unit prometheus.service did not complete: "+result)
+	}
+}
+
+func (s *SystemdTestSuite) TestReloadJobError(c *C) {
+	s.conn.err = errors.New("Unit prometheus.service not found.")
+	err := s.reloader(c, `{"unit": "prometheus.service", "action": "restart"}`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "could not restart unit prometheus.service: Unit prometheus.service not found.")
+}
+
+func (s *SystemdTestSuite) TestReloadJobTimeout(c *C) {
+	// the job never completes
+	s.conn.result = ""
+	err := s.reloader(c, `{"unit": "prometheus.service", "timeout": "1"}`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 1)
+	c.Assert(err.(*ReloaderError).Message, Equals, "reload of unit prometheus.service timed out after 1s")
+}
+
+func (s *SystemdTestSuite) TestReloadNoConnection(c *C) {
+	newSystemdConn = func(userBus bool) (systemdConn, error) {
+		return nil, errors.New("dial unix /var/run/dbus/system_bus_socket: connect: no such file or directory")
+	}
+	err := s.reloader(c, `{"unit": "prometheus.service"}`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Matches, "could not connect to systemd: .*")
+}
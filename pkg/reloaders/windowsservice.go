@@ -0,0 +1,146 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe/butler/internal/environment"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWindowsServiceAction  = "restart"
+	defaultWindowsServiceTimeout = 60
+)
+
+// errServiceTimeout is returned when the service does not reach the state it
+// is asked to within the timeout.
+var errServiceTimeout = errors.New("timed out")
+
+// restartWindowsService and paramChangeWindowsService are the calls to the
+// service control manager, which the tests replace.
+var (
+	restartWindowsService     = restartService
+	paramChangeWindowsService = paramChangeService
+)
+
+func NewWindowsServiceReloader(manager string, method string, entry []byte) (Reloader, error) {
+	var (
+		err    error
+		result WindowsServiceReloader
+		opts   WindowsServiceReloaderOpts
+	)
+
+	err = json.Unmarshal(entry, &opts)
+	if err != nil {
+		return result, err
+	}
+
+	opts.Service = strings.TrimSpace(environment.GetVar(opts.Service))
+	if opts.Service == "" {
+		return result, errors.New("no service defined for windows-service reloader")
+	}
+
+	opts.Action = strings.ToLower(strings.TrimSpace(environment.GetVar(opts.Action)))
+	switch opts.Action {
+	case "":
+		opts.Action = defaultWindowsServiceAction
+	case "restart", "paramchange":
+	default:
+		return result, fmt.Errorf("invalid windows-service reloader action %v", opts.Action)
+	}
+
+	newTimeout, _ := strconv.Atoi(environment.GetVar(opts.Timeout))
+	if newTimeout <= 0 {
+		log.Warnf("NewWindowsServiceReloader(): could not convert %v to integer for timeout, defaulting to %v.", opts.Timeout, defaultWindowsServiceTimeout)
+		newTimeout = defaultWindowsServiceTimeout
+	}
+	opts.timeout = time.Duration(newTimeout) * time.Second
+
+	result.Method = method
+	result.Opts = opts
+	result.Manager = manager
+	return result, nil
+}
+
+// WindowsServiceReloader reloads the manager by asking the Windows service
+// control manager to restart its service, as Restart-Service does, waiting
+// for the service to stop and then to run again. The paramchange action
+// instead tells the running service that its parameters have changed, for
+// the services which reload their configuration on it.
+type WindowsServiceReloader struct {
+	Manager string                     `json:"-"`
+	Counter int                        `json:"-"`
+	Method  string                     `mapstructure:"method" json:"method"`
+	Opts    WindowsServiceReloaderOpts `json:"opts"`
+}
+
+type WindowsServiceReloaderOpts struct {
+	Service string `json:"service"`
+	Action  string `json:"action"`
+	Timeout string `json:"timeout"`
+	timeout time.Duration
+}
+
+func (s WindowsServiceReloader) Reload() error {
+	o := s.GetOpts().(WindowsServiceReloaderOpts)
+	log.Debugf("WindowsServiceReloader::Reload()[count=%v][manager=%v]: %v'ing service %v", s.Counter, s.Manager, o.Action, o.Service)
+
+	var err error
+	if o.Action == "paramchange" {
+		err = paramChangeWindowsService(o.Service)
+	} else {
+		err = restartWindowsService(o.Service, o.timeout)
+	}
+	if err == errServiceTimeout {
+		log.Errorf("WindowsServiceReloader::Reload()[count=%v][manager=%v]: %v of service %v timed out after %v", s.Counter, s.Manager, o.Action, o.Service, o.timeout)
+		// the same code as an http timeout, so manager-timeout-ok applies
+		return NewReloaderError().WithMessage(fmt.Sprintf("%v of service %v timed out after %v", o.Action, o.Service, o.timeout)).WithCode(1)
+	}
+	if err != nil {
+		log.Errorf("WindowsServiceReloader::Reload()[count=%v][manager=%v]: could not %v service %v. err=%v", s.Counter, s.Manager, o.Action, o.Service, err.Error())
+		return NewReloaderError().WithMessage(fmt.Sprintf("could not %v service %v: %v", o.Action, o.Service, err.Error())).WithCode(2)
+	}
+
+	log.Infof("WindowsServiceReloader::Reload()[count=%v][manager=%v]: successfully %v'ed service %v.", s.Counter, s.Manager, o.Action, o.Service)
+	return nil
+}
+
+func (s WindowsServiceReloader) GetMethod() string {
+	return s.Method
+}
+
+func (s WindowsServiceReloader) GetOpts() ReloaderOpts {
+	return s.Opts
+}
+
+func (s WindowsServiceReloader) SetOpts(opts ReloaderOpts) bool {
+	s.Opts = opts.(WindowsServiceReloaderOpts)
+	return true
+}
+
+func (s WindowsServiceReloader) SetCounter(c int) Reloader {
+	s.Counter = c
+	return s
+}
+
+func (s WindowsServiceReloader) SetChangedFiles(files []string) Reloader {
+	return s
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type WindowsServiceTestSuite struct {
+	// err is returned by the service control manager calls, which are
+	// recorded in calls
+	err         error
+	calls       []string
+	restart     func(string, time.Duration) error
+	paramChange func(string) error
+}
+
+var _ = Suite(&WindowsServiceTestSuite{})
+
+func (s *WindowsServiceTestSuite) SetUpTest(c *C) {
+	s.err = nil
+	s.calls = nil
+	s.restart = restartWindowsService
+	s.paramChange = paramChangeWindowsService
+	restartWindowsService = func(name string, timeout time.Duration) error {
+		s.calls = append(s.calls, "restart "+name+" "+timeout.String())
+		return s.err
+	}
+	paramChangeWindowsService = func(name string) error {
+		s.calls = append(s.calls, "paramchange "+name)
+		return s.err
+	}
+}
+
+func (s *WindowsServiceTestSuite) TearDownTest(c *C) {
+	restartWindowsService = s.restart
+	paramChangeWindowsService = s.paramChange
+}
+
+func (s *WindowsServiceTestSuite) reloader(c *C, opts string) Reloader {
+	r, err := NewWindowsServiceReloader("prometheus", "windows-service", []byte(opts))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (s *WindowsServiceTestSuite) TestNewWindowsServiceReloader(c *C) {
+	r := s.reloader(c, `{"service": " prometheus "}`)
+	o := r.GetOpts().(WindowsServiceReloaderOpts)
+	c.Assert(o.Service, Equals, "prometheus")
+	c.Assert(o.Action, Equals, defaultWindowsServiceAction)
+	c.Assert(o.timeout, Equals, defaultWindowsServiceTimeout*time.Second)
+	c.Assert(r.GetMethod(), Equals, "windows-service")
+
+	r = s.reloader(c, `{"service": "prometheus", "action": "ParamChange", "timeout": "5"}`)
+	o = r.GetOpts().(WindowsServiceReloaderOpts)
+	c.Assert(o.Action, Equals, "paramchange")
+	c.Assert(o.timeout, Equals, 5*time.Second)
+
+	// a timeout which is not a positive number of seconds is the default
+	for _, timeout := range []string{"bogus", "0", "-5"} {
+		r = s.reloader(c, `{"service": "prometheus", "timeout": "`+timeout+`"}`)
+		c.Assert(r.GetOpts().(WindowsServiceReloaderOpts).timeout, Equals, defaultWindowsServiceTimeout*time.Second)
+	}
+
+	_, err := NewWindowsServiceReloader("prometheus", "windows-service", []byte(`{}`))
+	c.Assert(err, ErrorMatches, "no service defined for windows-service reloader")
+	_, err = NewWindowsServiceReloader("prometheus", "windows-service", []byte(`{"service": "prometheus", "action": "stop"}`))
+	c.Assert(err, ErrorMatches, "invalid windows-service reloader action stop")
+	_, err = NewWindowsServiceReloader("prometheus", "windows-service", []byte(`{"service": 1}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *WindowsServiceTestSuite) TestReload(c *C) {
+	c.Assert(s.reloader(c, `{"service": "prometheus", "timeout": "5"}`).Reload(), IsNil)
+	c.Assert(s.reloader(c, `{"service": "prometheus", "action": "paramchange"}`).Reload(), IsNil)
+	c.Assert(s.calls, DeepEquals, []string{"restart prometheus 5s", "paramchange prometheus"})
+}
+
+func (s *WindowsServiceTestSuite) TestReloadError(c *C) {
+	s.err = errors.New("The specified service does not exist as an installed service.")
+	err := s.reloader(c, `{"service": "prometheus"}`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 2)
+	c.Assert(err.(*ReloaderError).Message, Equals, "could not restart service prometheus: The specified service does not exist as an installed service.")
+}
+
+func (s *WindowsServiceTestSuite) TestReloadTimeout(c *C) {
+	s.err = errServiceTimeout
+	err := s.reloader(c, `{"service": "prometheus", "timeout": "1"}`).Reload()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*ReloaderError).Code, Equals, 1)
+	c.Assert(err.(*ReloaderError).Message, Equals, "restart of service prometheus timed out after 1s")
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2017 Adobe. All rights reserved.
+This file is licensed to you under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License. You may obtain a copy
+of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software distributed under
+the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+OF ANY KIND, either express or implied. See the License for the specific language
+governing permissions and limitations under the License.
+*/
+
+package reloaders
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	scManagerConnect = 0x0001
+
+	serviceQueryStatus    = 0x0004
+	serviceStart          = 0x0010
+	serviceStop           = 0x0020
+	servicePauseContinue  = 0x0040
+	serviceControlStop    = 0x00000001
+	serviceControlParams  = 0x00000006
+	serviceStopped        = 0x00000001
+	serviceRunning        = 0x00000004
+	errServiceNotActive   = syscall.Errno(1062)
+	errServiceAlreadyRuns = syscall.Errno(1056)
+)
+
+// servicePoll is how often the state of a service is queried while it stops
+// and starts.
+var servicePoll = 250 * time.Millisecond
+
+var (
+	advapi32               = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW     = advapi32.NewProc("OpenSCManagerW")
+	procOpenServiceW       = advapi32.NewProc("OpenServiceW")
+	procCloseServiceHandle = advapi32.NewProc("CloseServiceHandle")
+	procControlService     = advapi32.NewProc("ControlService")
+	procStartServiceW      = advapi32.NewProc("StartServiceW")
+	procQueryServiceStatus = advapi32.NewProc("QueryServiceStatus")
+)
+
+// serviceStatus is the SERVICE_STATUS of a service.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// openService opens the service with the access, and returns it along with
+// the func which closes it.
+func openService(name string, access uint32) (uintptr, func(), error) {
+	scm, _, err := procOpenSCManagerW.Call(0, 0, scManagerConnect)
+	if scm == 0 {
+		return 0, nil, fmt.Errorf("could not connect to the service control manager. err=%v", err)
+	}
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		procCloseServiceHandle.Call(scm)
+		return 0, nil, err
+	}
+	svc, _, err := procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(n)), uintptr(access))
+	if svc == 0 {
+		procCloseServiceHandle.Call(scm)
+		return 0, nil, err
+	}
+	return svc, func() {
+		procCloseServiceHandle.Call(svc)
+		procCloseServiceHandle.Call(scm)
+	}, nil
+}
+
+func controlService(svc uintptr, control uint32) error {
+	var st serviceStatus
+	if r, _, err := procControlService.Call(svc, uintptr(control), uintptr(unsafe.Pointer(&st))); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// waitService waits until the service is in the state, or the deadline.
+func waitService(svc uintptr, state uint32, deadline time.Time) error {
+	for {
+		var st serviceStatus
+		if r, _, err := procQueryServiceStatus.Call(svc, uintptr(unsafe.Pointer(&st))); r == 0 {
+			return err
+		}
+		if st.CurrentState == state {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return errServiceTimeout
+		}
+		time.Sleep(servicePoll)
+	}
+}
+
+// restartService stops the service, when it runs, and starts it again, and
+// waits for it to run, within the timeout.
+func restartService(name string, timeout time.Duration) error {
+	svc, closeService, err := openService(name, serviceQueryStatus|serviceStart|serviceStop)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	deadline := time.Now().Add(timeout)
+	if err = controlService(svc, serviceControlStop); err != nil && err != errServiceNotActive {
+		return err
+	}
+	if err = waitService(svc, serviceStopped, deadline); err != nil {
+		return err
+	}
+	if r, _, err := procStartServiceW.Call(svc, 0, 0); r == 0 && err != errServiceAlreadyRuns {
+		return err
+	}
+	return waitService(svc, serviceRunning, deadline)
+}
+
+// paramChangeService tells the running service that its parameters have
+// changed.
+func paramChangeService(name string) error {
+	svc, closeService, err := openService(name, servicePauseContinue)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+	return controlService(svc, serviceControlParams)
+}